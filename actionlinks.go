@@ -0,0 +1,242 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ActionLink is a short-lived, single-use link that performs one action without a login session
+type ActionLink struct {
+	ID        uint   `gorm:"primaryKey"`
+	Nonce     string `gorm:"uniqueIndex;size:191;not null"`
+	UserID    uint   `gorm:"default:0"` // The action runs on behalf of this user
+	Action    string `gorm:"not null"`
+	TargetID  uint
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// signedAction is an operation that can be triggered through an action link
+type signedAction struct {
+	Label string
+	Run   func(targetID uint, client ClientInfo) (string, error)
+}
+
+var signedActions = map[string]signedAction{
+	"stop_round": {
+		Label: "Stop round",
+		Run:   runStopRoundAction,
+	},
+}
+
+const (
+	defaultActionLinkTTL = 24 * time.Hour
+	maxActionLinkTTL     = 7 * 24 * time.Hour // Longest ttl_minutes accepted; a link is meant for the days ahead
+)
+
+func actionLinkSecret() ([]byte, error) {
+	if secret := cfg.ActionLinkSecret; secret != "" {
+		return []byte(secret), nil
+	}
+	secret, err := getOrCreateSetting("action_link_secret", func() (string, error) {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(buf), nil
+	})
+	return []byte(secret), err
+}
+
+func signActionLink(link ActionLink) (string, error) {
+	secret, err := actionLinkSecret()
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s|%s|%d|%d", link.Nonce, link.Action, link.TargetID, link.ExpiresAt.Unix())
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// createActionLink stores a new action link and returns its path, e.g. /a/<nonce>.<signature>
+func createActionLink(userID uint, action string, targetID uint, ttl time.Duration) (string, error) {
+	if _, ok := signedActions[action]; !ok {
+		return "", fmt.Errorf("unknown action %q", action)
+	}
+	if ttl <= 0 {
+		ttl = defaultActionLinkTTL
+	}
+
+	buf := make([]byte, 18)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	link := ActionLink{
+		Nonce:     base64.RawURLEncoding.EncodeToString(buf),
+		UserID:    userID,
+		Action:    action,
+		TargetID:  targetID,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	signature, err := signActionLink(link)
+	if err != nil {
+		return "", err
+	}
+	if err := db.Create(&link).Error; err != nil {
+		return "", err
+	}
+	return "/a/" + link.Nonce + "." + signature, nil
+}
+
+// resolveActionLink verifies the signature and validity of a link token
+func resolveActionLink(token string) (ActionLink, error) {
+	nonce, signature, found := strings.Cut(token, ".")
+	if !found {
+		return ActionLink{}, errors.New("malformed link")
+	}
+
+	var link ActionLink
+	if err := db.Where("nonce = ?", nonce).First(&link).Error; err != nil {
+		return ActionLink{}, errors.New("unknown link")
+	}
+
+	expected, err := signActionLink(link)
+	if err != nil {
+		return ActionLink{}, err
+	}
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ActionLink{}, errors.New("invalid signature")
+	}
+	if link.UsedAt != nil {
+		return ActionLink{}, errors.New("this link has already been used")
+	}
+	if time.Now().After(link.ExpiresAt) {
+		return ActionLink{}, errors.New("this link has expired")
+	}
+	return link, nil
+}
+
+func runStopRoundAction(roundID uint, client ClientInfo) (string, error) {
+	var round Round
+	if err := db.Scopes(userRounds(client.UserID)).First(&round, roundID).Error; err != nil {
+		return "", errors.New("round not found")
+	}
+	if round.EndTime != nil {
+		return "", fmt.Errorf("round #%d has already been stopped", round.ID)
+	}
+
+	stopped, err := stopRound(round.WorkingGroupID, client)
+	if err != nil {
+		return "", err
+	}
+	if stopped.Discarded {
+		return fmt.Sprintf("Round #%d discarded after %s, too short to count", stopped.ID,
+			formatDuration(roundWorkedSeconds(stopped, *stopped.EndTime))), nil
+	}
+	return fmt.Sprintf("Round #%d stopped after %s", stopped.ID,
+		formatDuration(roundWorkedSeconds(stopped, *stopped.EndTime))), nil
+}
+
+// renderActionLink shows a confirmation page, so link previews and scanners don't consume the link
+func renderActionLink(c *fiber.Ctx) error {
+	link, err := resolveActionLink(c.Params("token"))
+	if err != nil {
+		return c.Status(400).Render("action", fiber.Map{"Error": err.Error()})
+	}
+
+	return c.Render("action", fiber.Map{
+		"Label":     signedActions[link.Action].Label,
+		"TargetID":  link.TargetID,
+		"ExpiresAt": link.ExpiresAt.Format("2006-01-02 15:04:05"),
+	})
+}
+
+func executeActionLink(c *fiber.Ctx) error {
+	link, err := resolveActionLink(c.Params("token"))
+	if err != nil {
+		return c.Status(400).Render("action", fiber.Map{"Error": err.Error()})
+	}
+
+	// Claim the link atomically so that concurrent submissions run the action only once
+	now := time.Now()
+	result := db.Model(&ActionLink{}).Where("id = ? AND used_at IS NULL", link.ID).Update("used_at", now)
+	if result.Error != nil {
+		requestLog(c).Println("Error claiming action link:", result.Error)
+		return c.Status(500).SendString("Error running action")
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(400).Render("action", fiber.Map{"Error": "this link has already been used"})
+	}
+
+	client := clientInfoFromRequest(c)
+	client.Name = "action-link"
+	client.UserID = link.UserID
+	message, err := signedActions[link.Action].Run(link.TargetID, client)
+	if err != nil {
+		return c.Status(400).Render("action", fiber.Map{"Error": err.Error()})
+	}
+
+	return c.Render("action", fiber.Map{
+		"Done":    true,
+		"Message": message,
+	})
+}
+
+type actionLinkRequest struct {
+	Action     string `json:"action"`
+	TargetID   uint   `json:"target_id"`
+	TTLMinutes *int   `json:"ttl_minutes,omitempty"` // defaultActionLinkTTL when left out
+}
+
+type actionLinkResponse struct {
+	URL string `json:"url"`
+}
+
+func apiCreateActionLink(c *fiber.Ctx) error {
+	var req actionLinkRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(apiError{"invalid request body"})
+	}
+
+	ttl := defaultActionLinkTTL
+	if req.TTLMinutes != nil {
+		// Checked as minutes, before a huge value can overflow the duration
+		if *req.TTLMinutes <= 0 || *req.TTLMinutes > int(maxActionLinkTTL/time.Minute) {
+			return c.Status(400).JSON(apiError{fmt.Sprintf("ttl_minutes must be between 1 and %d", int(maxActionLinkTTL/time.Minute))})
+		}
+		ttl = time.Duration(*req.TTLMinutes) * time.Minute
+	}
+
+	path, err := createActionLink(currentUserID(c), req.Action, req.TargetID, ttl)
+	if err != nil {
+		return c.Status(400).JSON(apiError{err.Error()})
+	}
+
+	return c.JSON(actionLinkResponse{URL: appURL(c, path)})
+}
+
+func createStopLinkHandler(c *fiber.Ctx) error {
+	id, err := parseGroupID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid round")
+	}
+
+	path, err := createActionLink(currentUserID(c), "stop_round", id, defaultActionLinkTTL)
+	if err != nil {
+		requestLog(c).Println("Error creating action link:", err)
+		return c.Status(500).SendString("Error creating action link")
+	}
+
+	c.Locals("actionLink", appURL(c, path))
+	return renderRoundDetail(c)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestActionLinkTTLBounds(t *testing.T) {
+	useTestDatabase(t, "sqlite", "")
+	user, _ := createTestGroup(t)
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user", &user)
+		return c.Next()
+	})
+	app.Post("/api/v1/action-links", apiCreateActionLink)
+
+	for body, want := range map[string]int{
+		`{"action": "stop_round", "target_id": 1}`:                                  200,
+		`{"action": "stop_round", "target_id": 1, "ttl_minutes": 60}`:               200,
+		`{"action": "stop_round", "target_id": 1, "ttl_minutes": 10080}`:            200,
+		`{"action": "stop_round", "target_id": 1, "ttl_minutes": 0}`:                400,
+		`{"action": "stop_round", "target_id": 1, "ttl_minutes": -5}`:               400,
+		`{"action": "stop_round", "target_id": 1, "ttl_minutes": 10081}`:            400,
+		`{"action": "stop_round", "target_id": 1, "ttl_minutes": 9223372036854775}`: 400,
+	} {
+		request := httptest.NewRequest(http.MethodPost, "/api/v1/action-links", strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		response, err := app.Test(request, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.StatusCode != want {
+			t.Errorf("%s answered %d, want %d", body, response.StatusCode, want)
+		}
+	}
+}
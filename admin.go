@@ -0,0 +1,423 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Scheduled jobs, by the names the admin page shows them under
+const (
+	jobNightlySummary = "Nightly summary"
+	jobWeeklyReport   = "Weekly report"
+	jobMonthlyArchive = "Monthly report archive"
+	jobSync           = "Instance sync"
+	jobInflux         = "InfluxDB metrics"
+	jobExportCleanup  = "Export cleanup"
+)
+
+// jobStatus is how a scheduled job has been doing since the server started
+type jobStatus struct {
+	Name        string
+	Schedule    string // e.g. "every 5m0s"
+	LastRun     time.Time
+	LastSuccess time.Time
+	LastError   string // Of the last run, empty when it succeeded
+	Runs        int
+	Failures    int
+}
+
+// jobs holds the status of every scheduled job, in the order they were registered
+var jobs = struct {
+	sync.Mutex
+	byName map[string]*jobStatus
+	order  []string
+}{byName: make(map[string]*jobStatus)}
+
+// registerJob lists a scheduled job on the admin page before its first run
+func registerJob(name, schedule string) {
+	jobs.Lock()
+	defer jobs.Unlock()
+	if job, ok := jobs.byName[name]; ok {
+		job.Schedule = schedule
+		return
+	}
+	jobs.byName[name] = &jobStatus{Name: name, Schedule: schedule}
+	jobs.order = append(jobs.order, name)
+}
+
+// recordJobRun notes that a job ran, logging its error if it failed
+func recordJobRun(name string, err error) {
+	if err != nil {
+		log.Printf("Error running %s: %v", strings.ToLower(name), err)
+	}
+	jobs.Lock()
+	defer jobs.Unlock()
+	job, ok := jobs.byName[name]
+	if !ok {
+		job = &jobStatus{Name: name}
+		jobs.byName[name] = job
+		jobs.order = append(jobs.order, name)
+	}
+	job.LastRun = time.Now()
+	job.Runs++
+	if err != nil {
+		job.LastError = err.Error()
+		job.Failures++
+	} else {
+		job.LastError = ""
+		job.LastSuccess = job.LastRun
+	}
+}
+
+// jobStatuses is a copy of every job's status, safe to read without the lock
+func jobStatuses() []jobStatus {
+	jobs.Lock()
+	defer jobs.Unlock()
+	statuses := make([]jobStatus, 0, len(jobs.order))
+	for _, name := range jobs.order {
+		statuses = append(statuses, *jobs.byName[name])
+	}
+	return statuses
+}
+
+// recentErrorLimit is how many error and warning lines the admin page keeps
+const recentErrorLimit = 50
+
+// recentErrors keeps the last error and warning lines written to the log, for the admin page. It is added to the
+// log output at startup, so it sees request logs too.
+var recentErrors = &errorLog{}
+
+type errorLog struct {
+	sync.Mutex
+	lines []string
+}
+
+// Write keeps lines that report an error, a warning or a panic; the log package writes one entry per call
+func (e *errorLog) Write(p []byte) (int, error) {
+	line := strings.TrimRight(string(p), "\n")
+	if strings.Contains(line, "Error") || strings.Contains(line, "Warning") || strings.Contains(line, "panic") {
+		e.Lock()
+		e.lines = append(e.lines, line)
+		if len(e.lines) > recentErrorLimit {
+			e.lines = e.lines[len(e.lines)-recentErrorLimit:]
+		}
+		e.Unlock()
+	}
+	return len(p), nil
+}
+
+// recent returns the kept lines, newest first
+func (e *errorLog) recent() []string {
+	e.Lock()
+	defer e.Unlock()
+	lines := make([]string, len(e.lines))
+	for i, line := range e.lines {
+		lines[len(lines)-1-i] = line
+	}
+	return lines
+}
+
+// formatBytes renders a size such as 12.3 MB
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, exp := float64(size)/unit, 0
+	for value >= unit && exp < 4 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", value, "KMGTP"[exp])
+}
+
+// formatAge renders how long ago something happened in its largest unit, such as "3 hours"
+func formatAge(age time.Duration) string {
+	unit, count := "minute", int(age.Minutes())
+	if age >= 48*time.Hour {
+		unit, count = "day", int(age.Hours()/24)
+	} else if age >= time.Hour {
+		unit, count = "hour", int(age.Hours())
+	}
+	if count == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", count, unit)
+}
+
+// databaseSize is the space the database takes: the SQLite file with its write-ahead log, or what the server reports
+// for MySQL and PostgreSQL
+func databaseSize() (int64, error) {
+	var size int64
+	switch strings.ToLower(strings.TrimSpace(cfg.Database.Driver)) {
+	case "mysql", "mariadb":
+		err := db.Raw("SELECT COALESCE(SUM(data_length + index_length), 0) FROM information_schema.tables WHERE table_schema = DATABASE()").
+			Scan(&size).Error
+		return size, err
+	case "postgres", "postgresql":
+		err := db.Raw("SELECT pg_database_size(current_database())").Scan(&size).Error
+		return size, err
+	}
+	path := sqliteDatabasePath()
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	size = info.Size()
+	if wal, err := os.Stat(path + "-wal"); err == nil {
+		size += wal.Size()
+	}
+	return size, nil
+}
+
+// sqliteStorage is how the SQLite file is used: its pages, the free ones VACUUM would give back and the size of the
+// write-ahead log. Nil on MySQL and PostgreSQL.
+func sqliteStorage() (fiber.Map, error) {
+	if db.Dialector.Name() != "sqlite" {
+		return nil, nil
+	}
+	pragmas := map[string]int64{"page_size": 0, "page_count": 0, "freelist_count": 0}
+	for pragma := range pragmas {
+		var value int64
+		if err := db.Raw("PRAGMA " + pragma).Row().Scan(&value); err != nil {
+			return nil, fmt.Errorf("PRAGMA %s: %w", pragma, err)
+		}
+		pragmas[pragma] = value
+	}
+	storage := fiber.Map{
+		"Pages":     pragmas["page_count"],
+		"PageSize":  formatBytes(pragmas["page_size"]),
+		"FreePages": pragmas["freelist_count"],
+		"FreeSize":  formatBytes(pragmas["freelist_count"] * pragmas["page_size"]),
+	}
+	if wal, err := os.Stat(sqliteDatabasePath() + "-wal"); err == nil {
+		storage["WALSize"] = formatBytes(wal.Size())
+	}
+	return storage, nil
+}
+
+// adminTables are the tables whose row counts the admin page shows
+var adminTables = []struct {
+	Label string
+	Model interface{}
+}{
+	{"Users", &User{}},
+	{"Working groups", &WorkingGroup{}},
+	{"Rounds", &Round{}},
+	{"Audit entries", &AuditEntry{}},
+	{"Attachments", &Attachment{}},
+	{"Invoices", &Invoice{}},
+	{"API tokens", &APIToken{}},
+	{"Sessions", &Session{}},
+	{"Calendar feeds", &CalendarFeed{}},
+	{"Push subscriptions", &PushSubscription{}},
+	{"Export jobs", &ExportJob{}},
+	{"Archived reports", &ArchivedReport{}},
+	{"Sync tombstones", &SyncTombstone{}},
+}
+
+// activeIntegrations lists what the instance talks to besides its database, and how each is set up
+func activeIntegrations() []fiber.Map {
+	var integrations []fiber.Map
+	add := func(name, detail string) {
+		integrations = append(integrations, fiber.Map{"Name": name, "Detail": detail})
+	}
+	for _, name := range notifierNames() {
+		detail := "alerts: " + strings.Join(channelAlertTypes(name), ", ")
+		if name == "webpush" {
+			var browsers int64
+			db.Model(&PushSubscription{}).Count(&browsers)
+			detail += fmt.Sprintf("; %d subscribed browsers", browsers)
+		}
+		add("Notifications: "+name, detail)
+	}
+	if cfg.Sync.PeerURL != "" {
+		add("Instance sync", cfg.Sync.PeerURL)
+	}
+	if influx != nil {
+		add("InfluxDB", "every "+influx.interval.String())
+	}
+	if cfg.Tracing.Endpoint != "" {
+		add("Tracing", cfg.Tracing.Endpoint)
+	}
+	if oidcEnabled() {
+		add("Single sign-on", oidcConfig.Issuer)
+	}
+	if cfg.Attachments.S3.Bucket != "" {
+		add("Attachments on S3", cfg.Attachments.S3.Bucket)
+	}
+	if emailInEnabled() {
+		add("Email-in", cfg.Inbound.MailgunAddress)
+	}
+	if cfg.Inbound.TwilioAuthToken != "" {
+		add("SMS", "Twilio")
+	}
+	var feeds int64
+	db.Model(&CalendarFeed{}).Count(&feeds)
+	if feeds > 0 {
+		add("Calendar feeds", fmt.Sprintf("%d subscribed", feeds))
+	}
+	var tokens int64
+	db.Model(&APIToken{}).Where("last_used_at > ?", time.Now().AddDate(0, 0, -30)).Count(&tokens)
+	if tokens > 0 {
+		add("API tokens", fmt.Sprintf("%d used in the last 30 days", tokens))
+	}
+	return integrations
+}
+
+// channelAlertTypes lists the alert types routed to a notification channel
+func channelAlertTypes(channel string) []string {
+	var types []string
+	for _, alert := range alertTypes {
+		for _, name := range alertChannels(alert.Key) {
+			if name == channel {
+				types = append(types, alert.Key)
+			}
+		}
+	}
+	if len(types) == 0 {
+		return []string{"none"}
+	}
+	return types
+}
+
+// lastBackup finds the newest file in BACKUP_DIR, where backups made outside the app are expected
+func lastBackup() (fiber.Map, error) {
+	if cfg.BackupDir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(cfg.BackupDir)
+	if err != nil {
+		return nil, err
+	}
+	var newest os.FileInfo
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if newest == nil || info.ModTime().After(newest.ModTime()) {
+			newest = info
+		}
+	}
+	if newest == nil {
+		return fiber.Map{"Missing": true}, nil
+	}
+	age := time.Since(newest.ModTime())
+	return fiber.Map{
+		"Name":  filepath.Base(newest.Name()),
+		"Size":  formatBytes(newest.Size()),
+		"When":  newest.ModTime().Format("2006-01-02 15:04"),
+		"Age":   formatAge(age),
+		"Stale": age > 48*time.Hour,
+	}, nil
+}
+
+// renderAdminDashboard shows in one place whether the instance is healthy: database size and rows, integrations,
+// scheduled jobs, the last backup and recent errors
+func renderAdminDashboard(c *fiber.Ctx) error {
+	view := fiber.Map{
+		"Uptime":     formatDuration(int64(time.Since(startedAt).Seconds())),
+		"StartedAt":  startedAt.Format("2006-01-02 15:04"),
+		"GoVersion":  runtime.Version(),
+		"Goroutines": runtime.NumGoroutine(),
+		"Driver":     cfg.Database.Driver,
+		"BackupDir":  cfg.BackupDir,
+		"Errors":     recentErrors.recent(),
+		"Can":        permissionsView(c),
+	}
+
+	if size, err := databaseSize(); err != nil {
+		requestLog(c).Println("Error reading database size:", err)
+	} else {
+		view["DatabaseSize"] = formatBytes(size)
+	}
+
+	storage, err := sqliteStorage()
+	if err != nil {
+		requestLog(c).Println("Error reading SQLite storage:", err)
+	}
+	view["Storage"] = storage
+
+	if slowQueryThreshold > 0 {
+		operations, slow := queryStatistics()
+		var operationViews, slowViews []fiber.Map
+		for _, stats := range operations {
+			operationViews = append(operationViews, fiber.Map{
+				"Operation": stats.Operation,
+				"Count":     stats.Count,
+				"Average":   (stats.Total / time.Duration(stats.Count)).Round(time.Microsecond).String(),
+				"Max":       stats.Max.Round(time.Microsecond).String(),
+				"Slow":      stats.Slow,
+			})
+		}
+		for _, query := range slow {
+			slowViews = append(slowViews, fiber.Map{
+				"At":       query.At,
+				"Duration": query.Duration.Round(time.Microsecond).String(),
+				"SQL":      query.SQL,
+				"Rows":     query.Rows,
+			})
+		}
+		view["Queries"] = fiber.Map{"Threshold": slowQueryThreshold.String(), "Operations": operationViews, "Slow": slowViews}
+	}
+
+	var tables []fiber.Map
+	for _, table := range adminTables {
+		var count int64
+		if err := db.Model(table.Model).Count(&count).Error; err != nil {
+			requestLog(c).Println("Error counting rows:", err)
+			return c.Status(500).SendString("Error loading admin dashboard")
+		}
+		tables = append(tables, fiber.Map{"Label": table.Label, "Count": count})
+	}
+	view["Tables"] = tables
+	view["Integrations"] = activeIntegrations()
+
+	var jobViews []fiber.Map
+	for _, job := range jobStatuses() {
+		lastRun, lastSuccess := "not yet", "never"
+		if !job.LastRun.IsZero() {
+			lastRun = job.LastRun.Format("2006-01-02 15:04:05")
+		}
+		if !job.LastSuccess.IsZero() {
+			lastSuccess = job.LastSuccess.Format("2006-01-02 15:04:05")
+		}
+		jobViews = append(jobViews, fiber.Map{
+			"Name":        job.Name,
+			"Schedule":    job.Schedule,
+			"LastRun":     lastRun,
+			"LastSuccess": lastSuccess,
+			"LastError":   job.LastError,
+			"Runs":        job.Runs,
+			"Failures":    job.Failures,
+			"Failing":     job.LastError != "",
+		})
+	}
+	view["Jobs"] = jobViews
+
+	var failedExports int64
+	db.Model(&ExportJob{}).Where("status = ?", exportFailed).Count(&failedExports)
+	view["FailedExports"] = failedExports
+	view["ExportQueue"] = len(exportQueue)
+
+	backup, err := lastBackup()
+	if err != nil {
+		requestLog(c).Println("Error reading backup directory:", err)
+		view["BackupError"] = err.Error()
+	}
+	view["Backup"] = backup
+
+	return c.Render("admin", view)
+}
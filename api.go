@@ -0,0 +1,261 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// apiError is the body of every JSON API error response
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// apiStatus returns the state of a working group as JSON, e.g. for status badge widgets
+func apiStatus(c *fiber.Ctx) error {
+	var requestedGroupID uint
+	if groupParam := c.Query("group_id"); groupParam != "" {
+		parsed, err := parseGroupID(groupParam)
+		if err != nil {
+			return c.Status(400).JSON(apiError{"invalid working group"})
+		}
+		requestedGroupID = parsed
+	}
+
+	context, err := buildStatusContext(traceContext(c), currentUserID(c), requestedGroupID)
+	if err != nil {
+		requestLog(c).Println("Error building status context:", err)
+		return c.Status(500).JSON(apiError{"error building status"})
+	}
+
+	return c.JSON(context.State)
+}
+
+// apiGroup is a working group in GET /api/v1/groups with its place in the tree and its totals, once of its own rounds
+// and once rolled up with those of every group below it
+type apiGroup struct {
+	WorkingGroup
+	Color                            string            `json:"color"` // The group's color, or the one it got from groupPalette
+	Path                             string            `json:"path"`  // e.g. "Client A › Backend › Migration"
+	Metadata                         map[string]string `json:"metadata"`
+	Depth                            int               `json:"depth"`
+	TotalTodaySeconds                int64             `json:"total_today_seconds"`
+	TotalWeekSeconds                 int64             `json:"total_week_seconds"`
+	TotalOverallSeconds              int64             `json:"total_overall_seconds"`
+	TotalTodayWithSubgroupsSeconds   int64             `json:"total_today_with_subgroups_seconds"`
+	TotalWeekWithSubgroupsSeconds    int64             `json:"total_week_with_subgroups_seconds"`
+	TotalOverallWithSubgroupsSeconds int64             `json:"total_overall_with_subgroups_seconds"`
+}
+
+// apiListGroups lists the groups with subgroups right after their parent
+func apiListGroups(c *fiber.Ctx) error {
+	userID := currentUserID(c)
+	groups, err := getWorkingGroupsOrdered(userID)
+	if err != nil {
+		requestLog(c).Println("Error fetching working groups:", err)
+		return c.Status(500).JSON(apiError{"error fetching working groups"})
+	}
+	totals, err := sumRoundTotals(traceContext(c), userRounds(userID))
+	if err != nil {
+		requestLog(c).Println("Error summing round totals:", err)
+		return c.Status(500).JSON(apiError{"error fetching working groups"})
+	}
+
+	metadata, err := loadGroupMetadata(db, groups)
+	if err != nil {
+		requestLog(c).Println("Error loading group metadata:", err)
+		return c.Status(500).JSON(apiError{"error fetching working groups"})
+	}
+
+	paths := groupPaths(groups)
+	parents := groupParents(groups)
+	rolled := rollUpTotals(groups, totals)
+	list := make([]apiGroup, len(groups))
+	for i, group := range groups {
+		list[i] = apiGroup{
+			WorkingGroup:                     group,
+			Color:                            groupColor(group),
+			Path:                             paths[group.ID],
+			Metadata:                         groupMetadataMap(metadata[group.ID]),
+			Depth:                            len(groupAncestors(parents, group.ID)),
+			TotalTodaySeconds:                totals[group.ID].TodaySeconds,
+			TotalWeekSeconds:                 totals[group.ID].WeekSeconds,
+			TotalOverallSeconds:              totals[group.ID].TotalSeconds,
+			TotalTodayWithSubgroupsSeconds:   rolled[group.ID].TodaySeconds,
+			TotalWeekWithSubgroupsSeconds:    rolled[group.ID].WeekSeconds,
+			TotalOverallWithSubgroupsSeconds: rolled[group.ID].TotalSeconds,
+		}
+	}
+	return c.JSON(list)
+}
+
+func apiGetRound(c *fiber.Ctx) error {
+	id, err := parseGroupID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(apiError{"invalid round"})
+	}
+
+	var round Round
+	if err := db.Preload("Tags").Scopes(userRounds(currentUserID(c))).First(&round, id).Error; err != nil {
+		return c.Status(404).JSON(apiError{"round not found"})
+	}
+	return c.JSON(round)
+}
+
+// roundTimesRequest is the body of PATCH /api/v1/rounds/{id}; omitted fields keep their value
+type roundTimesRequest struct {
+	StartTime *time.Time `json:"start_time,omitempty"`
+	EndTime   *time.Time `json:"end_time,omitempty"` // Ignored for running rounds
+	Billable  *bool      `json:"billable,omitempty"`
+	Tags      *[]string  `json:"tags,omitempty"` // Replaces the round's tags; [] removes them
+}
+
+// apiUpdateRound moves or resizes a round, as the calendar does when a block is dragged, and changes its tags
+func apiUpdateRound(c *fiber.Ctx) error {
+	id, err := parseGroupID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(apiError{"invalid round"})
+	}
+	var req roundTimesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(apiError{"invalid request body"})
+	}
+	var tags []string
+	if req.Tags != nil {
+		if tags, err = parseTagNames(strings.Join(*req.Tags, ",")); err != nil {
+			return c.Status(400).JSON(apiError{err.Error()})
+		}
+	}
+
+	var round Round
+	if err := db.Scopes(userRounds(currentUserID(c))).First(&round, id).Error; err != nil {
+		return c.Status(404).JSON(apiError{"round not found"})
+	}
+	start, end := round.StartTime, round.EndTime
+	if req.StartTime != nil {
+		start = *req.StartTime
+	}
+	// A running round keeps running, so only its start can change
+	if req.EndTime != nil && round.EndTime != nil {
+		end = req.EndTime
+	}
+
+	client := clientInfoFromRequest(c)
+	// Only changing the tags leaves the rest alone, which also works for billed rounds
+	if req.StartTime != nil || req.EndTime != nil || req.Billable != nil || req.Tags == nil {
+		round, err = updateRound(round.ID, round.WorkingGroupID, start, end, req.Billable, client)
+		if err != nil {
+			return sendRoundUpdateError(c, err)
+		}
+	}
+	if req.Tags != nil {
+		if err := tagRound(&round, tags, client); err != nil {
+			requestLog(c).Println("Error tagging round:", err)
+			return c.Status(500).JSON(apiError{"error saving tags"})
+		}
+	}
+	return c.JSON(round)
+}
+
+// roundUpdateRequest is the body of PUT /api/v1/rounds/{id}, the complete new state of the round
+type roundUpdateRequest struct {
+	WorkingGroupID uint       `json:"working_group_id"`
+	StartTime      time.Time  `json:"start_time"`
+	EndTime        *time.Time `json:"end_time"`           // null keeps or makes the round running
+	Billable       *bool      `json:"billable,omitempty"` // Left out keeps whether the round is billable
+}
+
+// apiReplaceRound sets the group and both times of a round
+func apiReplaceRound(c *fiber.Ctx) error {
+	id, err := parseGroupID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(apiError{"invalid round"})
+	}
+	var req roundUpdateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(apiError{"invalid request body"})
+	}
+	if req.WorkingGroupID == 0 || req.StartTime.IsZero() {
+		return c.Status(400).JSON(apiError{"working_group_id and start_time are required"})
+	}
+
+	round, err := updateRound(id, req.WorkingGroupID, req.StartTime, req.EndTime, req.Billable, clientInfoFromRequest(c))
+	if err != nil {
+		return sendRoundUpdateError(c, err)
+	}
+	return c.JSON(round)
+}
+
+// roundSplitRequest is the body of POST /api/v1/rounds/{id}/split
+type roundSplitRequest struct {
+	At       time.Time  `json:"at"`                  // Where the round ends
+	ResumeAt *time.Time `json:"resume_at,omitempty"` // Start of the second round, at when left out
+	GroupID  uint       `json:"group_id,omitempty"`  // Group of the second round, the round's own when left out
+}
+
+// roundSplitResponse is the round and the new round it was split into
+type roundSplitResponse struct {
+	First  Round `json:"first"`
+	Second Round `json:"second"`
+}
+
+// apiSplitRound cuts a round in two, optionally leaving out a break between the parts
+func apiSplitRound(c *fiber.Ctx) error {
+	id, err := parseGroupID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(apiError{"invalid round"})
+	}
+	var req roundSplitRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(apiError{"invalid request body"})
+	}
+	if req.At.IsZero() {
+		return c.Status(400).JSON(apiError{"at is required"})
+	}
+	resume := req.At
+	if req.ResumeAt != nil {
+		resume = *req.ResumeAt
+	}
+
+	first, second, err := splitRound(id, req.At, resume, req.GroupID, clientInfoFromRequest(c))
+	if err != nil {
+		return sendRoundUpdateError(c, err)
+	}
+	return c.JSON(roundSplitResponse{First: first, Second: second})
+}
+
+// roundMergeRequest is the body of POST /api/v1/rounds/merge
+type roundMergeRequest struct {
+	RoundIDs []uint `json:"round_ids"`
+}
+
+// apiMergeRounds joins consecutive rounds of a group into one and returns it
+func apiMergeRounds(c *fiber.Ctx) error {
+	var req roundMergeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(apiError{"invalid request body"})
+	}
+	round, err := mergeRounds(req.RoundIDs, clientInfoFromRequest(c))
+	if err != nil {
+		return sendRoundUpdateError(c, err)
+	}
+	return c.JSON(round)
+}
+
+// sendRoundUpdateError answers a failed round update with its status code
+func sendRoundUpdateError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errRoundNotFound), errors.Is(err, errGroupNotFound):
+		return c.Status(404).JSON(apiError{err.Error()})
+	case errors.Is(err, errRoundBilled), errors.Is(err, errRoundRunning), errors.Is(err, errRoundChanged), errors.Is(err, errRoundOverlap),
+		errors.Is(err, errOverlapRejected):
+		return c.Status(409).JSON(apiError{err.Error()})
+	case errors.Is(err, errInvalidTimes), errors.Is(err, errInvalidSplit), errors.Is(err, errInvalidMerge), errors.Is(err, errInvalidBulk):
+		return c.Status(400).JSON(apiError{err.Error()})
+	default:
+		requestLog(c).Println("Error updating round:", err)
+		return c.Status(500).JSON(apiError{"error updating round"})
+	}
+}
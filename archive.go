@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Archived report kinds
+const (
+	reportInvoice = "invoice"
+	reportMonthly = "monthly"
+	reportReset   = "reset" // The rounds of a group before it was reset, see snapshotGroupRounds
+)
+
+// monthlyArchiveLastKey stores the last month (YYYY-MM) whose reports were archived, so restarts don't repeat it
+const monthlyArchiveLastKey = "reports.monthly_last_archived"
+
+// ArchivedReport is a generated document kept for good. The content lives in the attachment store (disk or S3) and the
+// figures are copied into it, so it stays retrievable after the rounds, invoice or group it was built from are gone.
+type ArchivedReport struct {
+	ID             uint   `gorm:"primaryKey"`
+	UserID         uint   `gorm:"index"`
+	Kind           string `gorm:"size:32;index"`
+	Title          string
+	WorkingGroupID uint   // 0 for reports across all groups
+	GroupName      string // Copied so the archive survives deleting the group
+	InvoiceID      *uint  `gorm:"index"`
+	PeriodStart    time.Time
+	PeriodEnd      time.Time // Exclusive
+	FileName       string
+	ContentType    string
+	Size           int64
+	StorageKey     string     `gorm:"not null"`
+	RestoredAt     *time.Time // When a reset snapshot's rounds were brought back
+	CreatedAt      time.Time
+}
+
+// archiveReport stores the content of a report and records it
+func archiveReport(report ArchivedReport, data []byte) (ArchivedReport, error) {
+	key, err := attachmentStorageKey(report.UserID, report.FileName)
+	if err != nil {
+		return report, err
+	}
+	report.StorageKey = "reports/" + key
+	report.Size = int64(len(data))
+	if err := attachments.Save(report.StorageKey, data, report.ContentType); err != nil {
+		return report, fmt.Errorf("storing report: %w", err)
+	}
+	if err := db.Create(&report).Error; err != nil {
+		attachments.Delete(report.StorageKey)
+		return report, err
+	}
+	return report, nil
+}
+
+// archiveInvoice keeps a standalone HTML copy of an invoice, once it has been sent or paid. Later status changes don't
+// replace the copy: it is the document that went out.
+func archiveInvoice(views fiber.Views, invoiceID uint) error {
+	var invoice Invoice
+	if err := db.Preload("WorkingGroup").Preload("Lines").First(&invoice, invoiceID).Error; err != nil {
+		return err
+	}
+	if invoice.Status == invoiceDraft {
+		return nil
+	}
+	var existing int64
+	if err := db.Model(&ArchivedReport{}).Where("invoice_id = ?", invoice.ID).Count(&existing).Error; err != nil || existing > 0 {
+		return err
+	}
+
+	var lines []fiber.Map
+	for _, line := range invoice.Lines {
+		lines = append(lines, fiber.Map{
+			"Description":    line.Description,
+			"TotalFormatted": formatDuration(line.Seconds),
+		})
+	}
+	var html bytes.Buffer
+	err := views.Render(&html, "invoice_document", fiber.Map{
+		"Invoice":    invoiceView(invoice),
+		"Lines":      lines,
+		"ArchivedAt": time.Now().Format("2006-01-02 15:04"),
+	})
+	if err != nil {
+		return fmt.Errorf("rendering invoice: %w", err)
+	}
+
+	_, err = archiveReport(ArchivedReport{
+		UserID:         invoice.WorkingGroup.UserID,
+		Kind:           reportInvoice,
+		Title:          "Invoice " + invoice.Number,
+		WorkingGroupID: invoice.WorkingGroupID,
+		GroupName:      invoice.WorkingGroup.Name,
+		InvoiceID:      &invoice.ID,
+		PeriodStart:    invoice.PeriodStart,
+		PeriodEnd:      invoice.PeriodEnd.AddDate(0, 0, 1),
+		FileName:       invoice.Number + ".html",
+		ContentType:    "text/html; charset=utf-8",
+	}, html.Bytes())
+	return err
+}
+
+// buildMonthlyReport is a CSV of the user's finished rounds in [from, to), one row per day and group, followed by the
+// totals per group, in the instance-wide CSV format. Breaks count pauses and the breaks taken outside rounds. It
+// returns nil when nothing was tracked.
+func buildMonthlyReport(userID uint, from, to time.Time) ([]byte, error) {
+	var rows []struct {
+		GroupName     string
+		GroupRef      string
+		StartTime     time.Time
+		EndTime       time.Time
+		Billable      *bool
+		PausedSeconds int64
+	}
+	err := db.Table("rounds").
+		Select("working_groups.name AS group_name, working_groups.external_ref AS group_ref, rounds.start_time, rounds.end_time, rounds.billable, rounds.paused_seconds").
+		Joins("JOIN working_groups ON working_groups.id = rounds.working_group_id").
+		Where("working_groups.user_id = ? AND rounds.end_time IS NOT NULL AND rounds.start_time >= ? AND rounds.start_time < ?", userID, from, to).
+		Order("rounds.start_time ASC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	var breakRows []struct {
+		GroupName string
+		GroupRef  string
+		StartTime time.Time
+		EndTime   time.Time
+	}
+	err = db.Table("breaks").
+		Select("working_groups.name AS group_name, working_groups.external_ref AS group_ref, breaks.start_time, breaks.end_time").
+		Joins("JOIN working_groups ON working_groups.id = breaks.working_group_id").
+		Where("working_groups.user_id = ? AND breaks.start_time >= ? AND breaks.start_time < ?", userID, from, to).
+		Scan(&breakRows).Error
+	if err != nil || len(rows)+len(breakRows) == 0 {
+		return nil, err
+	}
+
+	type total struct {
+		day, group, ref string
+		rounds          int
+		seconds         int64
+		billable        int64
+		breaks          int64
+	}
+	var days []*total
+	dayTotals := make(map[string]*total)
+	groupTotals := make(map[string]*total)
+	totalsFor := func(start time.Time, group, ref string) []*total {
+		day := start.In(from.Location()).Format("2006-01-02")
+		key := day + "\x00" + group
+		if dayTotals[key] == nil {
+			dayTotals[key] = &total{day: day, group: group, ref: ref}
+			days = append(days, dayTotals[key])
+		}
+		if groupTotals[group] == nil {
+			groupTotals[group] = &total{group: group, ref: ref}
+		}
+		return []*total{dayTotals[key], groupTotals[group]}
+	}
+	for _, row := range rows {
+		seconds := int64(row.EndTime.Sub(row.StartTime).Seconds()) - row.PausedSeconds
+		for _, t := range totalsFor(row.StartTime, row.GroupName, row.GroupRef) {
+			t.rounds++
+			t.seconds += seconds
+			if row.Billable == nil || *row.Billable {
+				t.billable += seconds
+			}
+			t.breaks += row.PausedSeconds
+		}
+	}
+	for _, row := range breakRows {
+		for _, t := range totalsFor(row.StartTime, row.GroupName, row.GroupRef) {
+			t.breaks += int64(row.EndTime.Sub(row.StartTime).Seconds())
+		}
+	}
+	sort.SliceStable(days, func(i, j int) bool {
+		if days[i].day != days[j].day {
+			return days[i].day < days[j].day
+		}
+		return days[i].group < days[j].group
+	})
+	groups := make([]*total, 0, len(groupTotals))
+	for _, t := range groupTotals {
+		groups = append(groups, t)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].group < groups[j].group })
+
+	options := defaultCSVOptions()
+	var buf bytes.Buffer
+	writer := options.newWriter(&buf)
+	writer.Write([]string{"Date", "Working Group", "Group Reference", "Rounds", "Duration", "Duration (minutes)", "Billable (minutes)", "Non-billable (minutes)",
+		"Breaks (minutes)"})
+	for _, t := range append(days, groups...) {
+		day := t.day
+		if day == "" {
+			day = "Total"
+		}
+		writer.Write([]string{day, options.text(t.group), options.text(t.ref), fmt.Sprintf("%d", t.rounds), formatDuration(t.seconds),
+			options.number(float64(t.seconds) / 60), options.number(float64(t.billable) / 60), options.number(float64(t.seconds-t.billable) / 60),
+			options.number(float64(t.breaks) / 60)})
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// archiveMonthlyReport archives the user's report for the month starting at month
+func archiveMonthlyReport(userID uint, month time.Time) (ArchivedReport, bool, error) {
+	end := month.AddDate(0, 1, 0)
+	data, err := buildMonthlyReport(userID, month, end)
+	if err != nil || data == nil {
+		return ArchivedReport{}, false, err
+	}
+	report, err := archiveReport(ArchivedReport{
+		UserID:      userID,
+		Kind:        reportMonthly,
+		Title:       "Monthly report " + month.Format("January 2006"),
+		PeriodStart: month,
+		PeriodEnd:   end,
+		FileName:    "workinghours-" + month.Format("2006-01") + ".csv",
+		ContentType: "text/csv",
+	}, data)
+	return report, err == nil, err
+}
+
+// archiveMonthlyReports archives last month's report of every user once the month is over
+func archiveMonthlyReports(now time.Time) error {
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).AddDate(0, -1, 0)
+	if getSetting(monthlyArchiveLastKey, "") == month.Format("2006-01") {
+		return nil
+	}
+	var userIDs []uint
+	if err := db.Model(&User{}).Pluck("id", &userIDs).Error; err != nil {
+		return fmt.Errorf("archiving monthly reports: %w", err)
+	}
+	for _, userID := range userIDs {
+		// A run that failed halfway is repeated the next day; skip the users it already covered
+		var existing int64
+		db.Model(&ArchivedReport{}).Where("user_id = ? AND kind = ? AND period_start = ?", userID, reportMonthly, month).Count(&existing)
+		if existing > 0 {
+			continue
+		}
+		if _, _, err := archiveMonthlyReport(userID, month); err != nil {
+			return fmt.Errorf("archiving monthly report of user %d: %w", userID, err)
+		}
+	}
+	if err := setSetting(monthlyArchiveLastKey, month.Format("2006-01")); err != nil {
+		return fmt.Errorf("saving monthly archive state: %w", err)
+	}
+	log.Printf("Archived monthly reports for %s", month.Format("2006-01"))
+	return nil
+}
+
+// renderReportArchive lists the user's archived reports, newest first, optionally of one kind (?kind=)
+func renderReportArchive(c *fiber.Ctx) error {
+	kind := c.Query("kind")
+	query := db.Where("user_id = ?", currentUserID(c)).Order("period_start DESC, id DESC")
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	var reports []ArchivedReport
+	if err := query.Find(&reports).Error; err != nil {
+		requestLog(c).Println("Error loading archived reports:", err)
+		return c.Status(500).SendString("Error loading the archive")
+	}
+
+	var reportViews []fiber.Map
+	for _, report := range reports {
+		restoredAt := ""
+		if report.RestoredAt != nil {
+			restoredAt = report.RestoredAt.Format("2006-01-02 15:04")
+		}
+		reportViews = append(reportViews, fiber.Map{
+			"ID":          report.ID,
+			"Kind":        report.Kind,
+			"Title":       report.Title,
+			"GroupName":   report.GroupName,
+			"PeriodStart": report.PeriodStart.Format("2006-01-02"),
+			"PeriodEnd":   report.PeriodEnd.AddDate(0, 0, -1).Format("2006-01-02"),
+			"Size":        formatFileSize(report.Size),
+			"CreatedAt":   report.CreatedAt.Format("2006-01-02 15:04"),
+			"RestoredAt":  restoredAt,
+		})
+	}
+	var kindViews []fiber.Map
+	for _, k := range []string{reportInvoice, reportMonthly, reportReset} {
+		kindViews = append(kindViews, fiber.Map{"Value": k, "Active": k == kind})
+	}
+	now := time.Now()
+	return c.Render("reports_archive", fiber.Map{
+		"Reports":   reportViews,
+		"AllKinds":  kind == "",
+		"Kinds":     kindViews,
+		"Can":       permissionsView(c),
+		"LastMonth": time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).AddDate(0, -1, 0).Format("2006-01"),
+	})
+}
+
+// archiveMonthHandler archives the monthly report of a past month on request, e.g. before resetting a group
+func archiveMonthHandler(c *fiber.Ctx) error {
+	month, err := time.ParseInLocation("2006-01", c.FormValue("month"), time.Local)
+	if err != nil {
+		return c.Status(400).SendString("Invalid month")
+	}
+	if !month.Before(time.Now()) {
+		return c.Status(400).SendString("The month has not started yet")
+	}
+	report, ok, err := archiveMonthlyReport(currentUserID(c), month)
+	if err != nil {
+		requestLog(c).Println("Error archiving monthly report:", err)
+		return c.Status(500).SendString("Error archiving the report")
+	}
+	if !ok {
+		return c.Status(400).SendString("No time was tracked in " + month.Format("January 2006"))
+	}
+	recordAudit("report.archive", clientInfoFromRequest(c), 0, nil, "Archived "+report.Title)
+	return c.Redirect("/reports/archive", fiber.StatusSeeOther)
+}
+
+// downloadArchivedReport serves an archived report; HTML documents open in the browser, others are downloaded
+func downloadArchivedReport(c *fiber.Ctx) error {
+	id, err := parseGroupID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid report")
+	}
+	var report ArchivedReport
+	if err := db.Where("user_id = ?", currentUserID(c)).First(&report, id).Error; err != nil {
+		return c.Status(404).SendString("Report not found")
+	}
+
+	reader, err := attachments.Open(report.StorageKey)
+	if err != nil {
+		requestLog(c).Println("Error opening archived report:", err)
+		return c.Status(404).SendString("Report file is missing")
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		requestLog(c).Println("Error reading archived report:", err)
+		return c.Status(500).SendString("Error reading report")
+	}
+
+	disposition := "attachment"
+	if report.Kind == reportInvoice {
+		disposition = "inline"
+	}
+	c.Set("Content-Type", report.ContentType)
+	setDownloadName(c, disposition, report.FileName)
+	return c.Send(data)
+}
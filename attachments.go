@@ -0,0 +1,470 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Attachment is a file attached to a round or to a day of a working group
+type Attachment struct {
+	ID             uint   `gorm:"primaryKey"`
+	WorkingGroupID uint   `gorm:"index"`
+	RoundID        *uint  `gorm:"index"` // NULL for day attachments
+	Date           string `gorm:"index"` // YYYY-MM-DD; for round attachments the day the round started
+	FileName       string
+	ContentType    string
+	Size           int64
+	StorageKey     string `gorm:"not null"`
+	CreatedAt      time.Time
+}
+
+// attachmentStore persists attachment contents; metadata always lives in the database
+type attachmentStore interface {
+	Save(key string, data []byte, contentType string) error
+	Open(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+var attachments attachmentStore
+
+// newAttachmentStore uses S3 when a bucket is configured, the attachments directory otherwise
+func newAttachmentStore() attachmentStore {
+	s3 := cfg.Attachments.S3
+	if bucket := s3.Bucket; bucket != "" {
+		endpoint := s3.Endpoint
+		region := s3.Region
+		if endpoint == "" {
+			endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+		}
+		return &s3AttachmentStore{
+			endpoint:  strings.TrimRight(endpoint, "/"),
+			bucket:    bucket,
+			region:    region,
+			accessKey: s3.AccessKey,
+			secretKey: s3.SecretKey,
+		}
+	}
+	return &diskAttachmentStore{dir: cfg.Attachments.Dir}
+}
+
+type diskAttachmentStore struct {
+	dir string
+}
+
+func (s *diskAttachmentStore) path(key string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(key))
+}
+
+func (s *diskAttachmentStore) Save(key string, data []byte, _ string) error {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func (s *diskAttachmentStore) Open(key string) (io.ReadCloser, error) {
+	return os.Open(s.path(key))
+}
+
+func (s *diskAttachmentStore) Delete(key string) error {
+	return os.Remove(s.path(key))
+}
+
+// s3AttachmentStore talks to S3 or an S3-compatible service (MinIO, R2, ...) using path-style URLs
+type s3AttachmentStore struct {
+	endpoint  string
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+}
+
+func (s *s3AttachmentStore) do(method, key string, body []byte, contentType string) (*http.Response, error) {
+	objectURL := fmt.Sprintf("%s/%s/%s", s.endpoint, s.bucket, (&url.URL{Path: key}).EscapedPath())
+	req, err := http.NewRequest(method, objectURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, body)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s: %s", method, key, resp.Status)
+	}
+	return resp, nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to the request
+func (s *s3AttachmentStore) sign(req *http.Request, body []byte) {
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256.Sum256(body)
+	payloadHex := hex.EncodeToString(payloadHash[:])
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHex)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"",
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHex,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHex,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", day, s.region)
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	hmacSHA256 := func(key []byte, data string) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(data))
+		return mac.Sum(nil)
+	}
+	signingKey := hmacSHA256(hmacSHA256(hmacSHA256(hmacSHA256([]byte("AWS4"+s.secretKey), day), s.region), "s3"), "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+func (s *s3AttachmentStore) Save(key string, data []byte, contentType string) error {
+	resp, err := s.do(http.MethodPut, key, data, contentType)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *s3AttachmentStore) Open(key string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *s3AttachmentStore) Delete(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, "")
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func attachmentStorageKey(groupID uint, fileName string) (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	safeName := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, filepath.Base(fileName))
+	return fmt.Sprintf("%d/%s-%s", groupID, hex.EncodeToString(buf), safeName), nil
+}
+
+func readUploadedFile(header *multipart.FileHeader) ([]byte, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+func attachmentViews(list []Attachment) []fiber.Map {
+	views := make([]fiber.Map, 0, len(list))
+	for _, attachment := range list {
+		views = append(views, fiber.Map{
+			"ID":        attachment.ID,
+			"FileName":  attachment.FileName,
+			"Size":      formatFileSize(attachment.Size),
+			"RoundID":   attachment.RoundID,
+			"CreatedAt": attachment.CreatedAt.Format("2006-01-02 15:04"),
+		})
+	}
+	return views
+}
+
+func formatFileSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
+
+// activeContentTypes run script when a browser opens them from this origin
+var activeContentTypes = map[string]bool{
+	"text/html":                true,
+	"application/xhtml+xml":    true,
+	"image/svg+xml":            true,
+	"text/xml":                 true,
+	"application/xml":          true,
+	"text/xsl":                 true,
+	"application/javascript":   true,
+	"text/javascript":          true,
+	"application/ecmascript":   true,
+	"text/ecmascript":          true,
+	"application/x-javascript": true,
+}
+
+// attachmentContentType is the type an attachment is served with: the one its uploader sent, or
+// application/octet-stream when that is missing, malformed or a type that runs script
+func attachmentContentType(uploaded string) string {
+	mediaType, params, err := mime.ParseMediaType(uploaded)
+	if err != nil || activeContentTypes[mediaType] || strings.HasSuffix(mediaType, "+xml") {
+		return "application/octet-stream"
+	}
+	return mime.FormatMediaType(mediaType, params)
+}
+
+// uploadAttachmentHandler stores a file for round_id, or for group_id and date when no round is given
+func uploadAttachmentHandler(c *fiber.Ctx) error {
+	header, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).SendString("A file is required")
+	}
+
+	attachment := Attachment{
+		FileName:    filepath.Base(header.Filename),
+		ContentType: header.Header.Get("Content-Type"),
+		Size:        header.Size,
+	}
+	redirect := ""
+
+	if roundParam := c.FormValue("round_id"); roundParam != "" {
+		roundID, err := parseGroupID(roundParam)
+		if err != nil {
+			return c.Status(400).SendString("Invalid round")
+		}
+		var round Round
+		if err := db.Scopes(userRounds(currentUserID(c))).First(&round, roundID).Error; err != nil {
+			return c.Status(404).SendString("Round not found")
+		}
+		attachment.RoundID = &round.ID
+		attachment.WorkingGroupID = round.WorkingGroupID
+		attachment.Date = round.StartTime.Format("2006-01-02")
+		redirect = fmt.Sprintf("/rounds/%d", round.ID)
+	} else {
+		groupID, err := parseGroupID(c.FormValue("group_id"))
+		if err != nil {
+			return c.Status(400).SendString("Invalid working group")
+		}
+		group, err := findUserGroup(currentUserID(c), groupID)
+		if err != nil {
+			return c.Status(404).SendString("Working group not found")
+		}
+		date, err := time.ParseInLocation("2006-01-02", c.FormValue("date"), time.Local)
+		if err != nil {
+			return c.Status(400).SendString("Invalid date")
+		}
+		attachment.WorkingGroupID = group.ID
+		attachment.Date = date.Format("2006-01-02")
+		redirect = fmt.Sprintf("/stats/day/%s?group_id=%d", attachment.Date, group.ID)
+	}
+
+	data, err := readUploadedFile(header)
+	if err != nil {
+		requestLog(c).Println("Error reading uploaded attachment:", err)
+		return c.Status(500).SendString("Error saving attachment")
+	}
+	if attachment.StorageKey, err = attachmentStorageKey(attachment.WorkingGroupID, attachment.FileName); err != nil {
+		requestLog(c).Println("Error generating attachment key:", err)
+		return c.Status(500).SendString("Error saving attachment")
+	}
+	if err := attachments.Save(attachment.StorageKey, data, attachment.ContentType); err != nil {
+		requestLog(c).Println("Error storing attachment:", err)
+		return c.Status(500).SendString("Error saving attachment")
+	}
+	if err := db.Create(&attachment).Error; err != nil {
+		requestLog(c).Println("Error creating attachment:", err)
+		return c.Status(500).SendString("Error saving attachment")
+	}
+	recordAudit("attachment.upload", clientInfoFromRequest(c), attachment.WorkingGroupID, attachment.RoundID,
+		fmt.Sprintf("Attached '%s' to %s", attachment.FileName, attachment.Date))
+
+	return c.Redirect(redirect, fiber.StatusSeeOther)
+}
+
+func downloadAttachmentHandler(c *fiber.Ctx) error {
+	id, err := parseGroupID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid attachment")
+	}
+
+	var attachment Attachment
+	if err := db.Scopes(userRounds(currentUserID(c))).First(&attachment, id).Error; err != nil {
+		return c.Status(404).SendString("Attachment not found")
+	}
+
+	reader, err := attachments.Open(attachment.StorageKey)
+	if err != nil {
+		requestLog(c).Println("Error opening attachment:", err)
+		return c.Status(404).SendString("Attachment file is missing")
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		requestLog(c).Println("Error reading attachment:", err)
+		return c.Status(500).SendString("Error reading attachment")
+	}
+
+	c.Set(fiber.HeaderContentType, attachmentContentType(attachment.ContentType))
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	setDownloadName(c, "attachment", attachment.FileName)
+	return c.Send(data)
+}
+
+func deleteAttachmentHandler(c *fiber.Ctx) error {
+	id, err := parseGroupID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid attachment")
+	}
+
+	var attachment Attachment
+	if err := db.Scopes(userRounds(currentUserID(c))).First(&attachment, id).Error; err != nil {
+		return c.Status(404).SendString("Attachment not found")
+	}
+
+	if err := db.Delete(&attachment).Error; err != nil {
+		requestLog(c).Println("Error deleting attachment:", err)
+		return c.Status(500).SendString("Error deleting attachment")
+	}
+	if err := attachments.Delete(attachment.StorageKey); err != nil {
+		requestLog(c).Println("Warning: failed to delete attachment file:", err)
+	}
+	recordAudit("attachment.delete", clientInfoFromRequest(c), attachment.WorkingGroupID, attachment.RoundID,
+		fmt.Sprintf("Deleted attachment '%s'", attachment.FileName))
+
+	if attachment.RoundID != nil {
+		return c.Redirect(fmt.Sprintf("/rounds/%d", *attachment.RoundID), fiber.StatusSeeOther)
+	}
+	return c.Redirect(fmt.Sprintf("/stats/day/%s?group_id=%d", attachment.Date, attachment.WorkingGroupID), fiber.StatusSeeOther)
+}
+
+// renderDayDetail lists the rounds and attachments of one working group on one day
+func renderDayDetail(c *fiber.Ctx) error {
+	date, err := time.ParseInLocation("2006-01-02", c.Params("date"), time.Local)
+	if err != nil {
+		return c.Status(400).SendString("Invalid date")
+	}
+	groupID, err := parseGroupID(c.Query("group_id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid working group")
+	}
+
+	group, err := findUserGroup(currentUserID(c), groupID)
+	if err != nil {
+		return c.Status(404).SendString("Working group not found")
+	}
+
+	clock, err := parseClock(c.Query("clock"))
+	if err != nil {
+		return c.Status(400).SendString(err.Error())
+	}
+
+	// The local clock's day of a round can be up to a day off the home one (UTC-12 to UTC+14), so a wider range is
+	// read and the rounds that started on another day where they were recorded are left out below
+	from, to := date, date.AddDate(0, 0, 1)
+	if clock == clockLocal {
+		from, to = from.AddDate(0, 0, -1), to.AddDate(0, 0, 1)
+	}
+	var rounds []Round
+	if err := db.Where("working_group_id = ? AND start_time >= ? AND start_time < ?", groupID, from, to).
+		Order("start_time ASC").Find(&rounds).Error; err != nil {
+		requestLog(c).Println("Error fetching rounds for day:", err)
+		return c.Status(500).SendString("Error loading day")
+	}
+
+	now := time.Now()
+	var totalSeconds int64
+	var roundViews []fiber.Map
+	for _, round := range rounds {
+		start := roundClock(round.StartTime, round, clock)
+		if start.Format("2006-01-02") != date.Format("2006-01-02") {
+			continue
+		}
+		end := now
+		var endClock *time.Time
+		if round.EndTime != nil {
+			end = *round.EndTime
+			stopped := roundClock(end, round, clock)
+			endClock = &stopped
+		}
+		seconds := roundWorkedSeconds(round, now)
+		totalSeconds += seconds
+		roundViews = append(roundViews, fiber.Map{
+			"ID":              round.ID,
+			"Note":            round.Note,
+			"Start":           start,
+			"End":             endClock, // nil while running
+			"TimeZone":        csvTimeZone(round, clock),
+			"DurationSeconds": seconds,
+			"Billable":        roundBillable(round),
+		})
+	}
+
+	var list []Attachment
+	if err := db.Where("working_group_id = ? AND date = ?", groupID, date.Format("2006-01-02")).
+		Order("created_at ASC").Find(&list).Error; err != nil {
+		requestLog(c).Println("Error fetching attachments for day:", err)
+	}
+
+	// Breaks go by the home day, so the local clock doesn't move a pause away from its round's neighbours
+	breaks, err := listBreaks(traceContext(c), currentUserID(c), groupID, date, date.AddDate(0, 0, 1))
+	if err != nil {
+		requestLog(c).Println("Error fetching breaks for day:", err)
+	}
+	var breakSeconds int64
+	for _, brk := range breaks {
+		breakSeconds += brk.Seconds
+	}
+
+	return c.Render("day", fiber.Map{
+		"GroupID":      group.ID,
+		"GroupName":    group.Name,
+		"Date":         date.Format("2006-01-02"),
+		"DateDisplay":  date.Format("Monday, January 2, 2006"),
+		"Rounds":       roundViews,
+		"TotalSeconds": totalSeconds,
+		"Breaks":       breaks,
+		"BreakSeconds": breakSeconds,
+		"Attachments":  attachmentViews(list),
+		"LocalClock":   clock == clockLocal,
+	})
+}
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestAttachmentContentType(t *testing.T) {
+	for uploaded, want := range map[string]string{
+		"image/png":                 "image/png",
+		"application/pdf":           "application/pdf",
+		"text/plain; charset=utf-8": "text/plain; charset=utf-8",
+		"":                          "application/octet-stream",
+		"not a type":                "application/octet-stream",
+		"text/html":                 "application/octet-stream",
+		"TEXT/HTML; charset=utf-8":  "application/octet-stream",
+		"image/svg+xml":             "application/octet-stream",
+		"application/javascript":    "application/octet-stream",
+		"application/rss+xml":       "application/octet-stream",
+	} {
+		if got := attachmentContentType(uploaded); got != want {
+			t.Errorf("attachmentContentType(%q) = %q, want %q", uploaded, got, want)
+		}
+	}
+}
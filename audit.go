@@ -0,0 +1,79 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AuditEntry records a state-changing action together with the client that performed it
+type AuditEntry struct {
+	ID             uint   `gorm:"primaryKey"`
+	Action         string `gorm:"index;not null"` // e.g. round.start, round.stop, group.reset
+	UserID         uint   `gorm:"index;default:0"`
+	WorkingGroupID uint   `gorm:"index"`
+	RoundID        *uint  `gorm:"index"`
+	Client         string
+	UserAgent      string
+	RemoteIP       string
+	Details        string
+	CreatedAt      time.Time `gorm:"index"`
+}
+
+func recordAudit(action string, client ClientInfo, groupID uint, roundID *uint, details string) {
+	entry := AuditEntry{
+		Action:         action,
+		UserID:         client.UserID,
+		WorkingGroupID: groupID,
+		RoundID:        roundID,
+		Client:         client.Name,
+		UserAgent:      client.UserAgent,
+		RemoteIP:       client.RemoteIP,
+		Details:        details,
+	}
+	if err := db.Create(&entry).Error; err != nil {
+		log.Println("Warning: failed to write audit entry:", err)
+	}
+}
+
+func auditEntryViews(entries []AuditEntry) []fiber.Map {
+	views := make([]fiber.Map, 0, len(entries))
+	for _, entry := range entries {
+		var roundID uint
+		if entry.RoundID != nil {
+			roundID = *entry.RoundID
+		}
+		views = append(views, fiber.Map{
+			"ID":        entry.ID,
+			"Action":    entry.Action,
+			"GroupID":   entry.WorkingGroupID,
+			"RoundID":   roundID,
+			"Client":    entry.Client,
+			"UserAgent": entry.UserAgent,
+			"RemoteIP":  entry.RemoteIP,
+			"Details":   entry.Details,
+			"CreatedAt": entry.CreatedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+	return views
+}
+
+func renderAuditLog(c *fiber.Ctx) error {
+	query := db.Where("user_id = ?", currentUserID(c)).Order("created_at DESC").Limit(200)
+	if groupParam := c.Query("group_id"); groupParam != "" {
+		if parsed, err := parseGroupID(groupParam); err == nil {
+			query = query.Where("working_group_id = ?", parsed)
+		}
+	}
+
+	var entries []AuditEntry
+	if err := query.Find(&entries).Error; err != nil {
+		requestLog(c).Println("Error fetching audit log:", err)
+		return c.Status(500).SendString("Error loading audit log")
+	}
+
+	return c.Render("audit", fiber.Map{
+		"AuditEntries": auditEntryViews(entries),
+	})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// serveBasePath mounts the app under cfg.BasePath. Routes, handlers and templates are written for "/"; this strips
+// the prefix before routing, prefixes redirects on the way out and hands the prefix to templates as BasePath.
+func serveBasePath(c *fiber.Ctx) error {
+	c.Locals("BasePath", cfg.BasePath)
+	base := cfg.BasePath
+	if base == "" || c.Locals("basePathStripped") != nil {
+		return c.Next()
+	}
+
+	path := c.Path()
+	if path != base && !strings.HasPrefix(path, base+"/") {
+		if path == "/" {
+			return c.Redirect(base+"/", fiber.StatusFound)
+		}
+		return c.Status(404).SendString("Not found")
+	}
+	stripped := strings.TrimPrefix(path, base)
+	if stripped == "" {
+		stripped = "/"
+	}
+	c.Locals("basePathStripped", true)
+	c.Path(stripped)
+	err := c.RestartRouting()
+
+	for _, header := range []string{fiber.HeaderLocation, "HX-Redirect"} {
+		if location := c.GetRespHeader(header); strings.HasPrefix(location, "/") && !strings.HasPrefix(location, "//") {
+			c.Set(header, base+location)
+		}
+	}
+	return err
+}
+
+// appURL turns an app path such as "/a/123" into an absolute URL for links that leave the app
+func appURL(c *fiber.Ctx, path string) string {
+	return c.BaseURL() + cfg.BasePath + path
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// basicRefreshSeconds is how often the basic page reloads itself, as often as the dashboard polls the status
+const basicRefreshSeconds = 30
+
+// spokenDuration reads seconds out the way a screen reader should say them, e.g. "2 hours 5 minutes"; the HH:MM:SS
+// of the dashboard comes out as a string of numbers
+func spokenDuration(seconds int64) string {
+	if seconds < 60 {
+		return "less than a minute"
+	}
+	hours, minutes := seconds/3600, (seconds%3600)/60
+	var parts []string
+	if hours > 0 {
+		parts = append(parts, pluralize(hours, "hour"))
+	}
+	if minutes > 0 {
+		parts = append(parts, pluralize(minutes, "minute"))
+	}
+	return strings.Join(parts, " ")
+}
+
+// pluralize counts a unit in words, such as "1 hour" or "3 hours"
+func pluralize(count int64, unit string) string {
+	if count == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", count, unit)
+}
+
+// statusSummary says in one sentence per fact what the dashboard shows of a group, for assistive technology and the
+// basic page: whether a round runs and since when, today's and the week's time and the daily target
+func statusSummary(state AppState) string {
+	var sentences []string
+	switch {
+	case state.IsPaused && state.PausedSince != nil:
+		sentences = append(sentences, fmt.Sprintf("%s: the round started at %s is paused since %s.",
+			state.GroupName, dateHelper(state.LastStartTime, "time"), dateHelper(state.PausedSince, "time")))
+	case state.IsRunning && state.LastStartTime != nil:
+		sentences = append(sentences, fmt.Sprintf("%s: a round is in progress since %s.",
+			state.GroupName, dateHelper(state.LastStartTime, "time")))
+	case state.LastStopTime != nil:
+		sentences = append(sentences, fmt.Sprintf("%s: no round in progress, the last one ended %s.",
+			state.GroupName, dateHelper(state.LastStopTime, "minutes")))
+	default:
+		sentences = append(sentences, state.GroupName+": no rounds yet.")
+	}
+	sentences = append(sentences, fmt.Sprintf("Today %s, this week %s.",
+		spokenDuration(state.TotalTodaySeconds), spokenDuration(state.TotalWeekSeconds)))
+	if state.DailyTargetSeconds > 0 {
+		if state.TargetReached {
+			sentences = append(sentences, "Today's target of "+spokenDuration(state.DailyTargetSeconds)+" is reached.")
+		} else {
+			sentences = append(sentences, fmt.Sprintf("%s left to today's target of %s.",
+				spokenDuration(state.DailyTargetSeconds-state.TotalTodaySeconds), spokenDuration(state.DailyTargetSeconds)))
+		}
+	}
+	return strings.Join(sentences, " ")
+}
+
+// basicStatusPath is the basic page of a group, keeping auto-refresh off when the reader turned it off
+func basicStatusPath(groupID uint, refresh bool) string {
+	path := fmt.Sprintf("/basic?group_id=%d", groupID)
+	if !refresh {
+		path += "&refresh=off"
+	}
+	return path
+}
+
+// basicStatusRedirect sends a round change posted by a form of the basic page (return=basic) back to the page, where
+// the dashboard would swap in the status partial with HTMX. Other clients of /start and /stop, such as scripts, still
+// get the partial.
+func basicStatusRedirect(c *fiber.Ctx, groupID uint) error {
+	return c.Redirect(basicStatusPath(groupID, c.FormValue("refresh") != "off"), fiber.StatusSeeOther)
+}
+
+// renderBasicStatus serves /basic: the dashboard rendered on the server without scripts, for text browsers, screen
+// readers and browsers with JavaScript off. It reloads itself unless ?refresh=off, and starts and stops rounds with
+// plain forms.
+func renderBasicStatus(c *fiber.Ctx) error {
+	var requestedGroupID uint
+	if groupParam := c.Query("group_id"); groupParam != "" {
+		if parsed, err := parseGroupID(groupParam); err == nil {
+			requestedGroupID = parsed
+		}
+	}
+
+	context, err := buildStatusContext(traceContext(c), currentUserID(c), requestedGroupID)
+	if err != nil {
+		requestLog(c).Println("Error building status context:", err)
+		return c.Status(500).SendString("Error rendering page")
+	}
+
+	refresh := c.Query("refresh") != "off"
+	return c.Render("basic", fiber.Map{
+		"GroupOptions":          context.GroupOptions,
+		"SelectedGroupID":       context.SelectedGroupID,
+		"State":                 context.State,
+		"AllGroupsTotalSeconds": context.AllGroupsTotalSeconds,
+		"CurrentUser":           currentUser(c),
+		"Can":                   permissionsView(c),
+		"Refresh":               refresh,
+		"RefreshSeconds":        basicRefreshSeconds,
+		"ToggleRefreshPath":     basicStatusPath(context.SelectedGroupID, !refresh),
+	})
+}
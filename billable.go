@@ -0,0 +1,33 @@
+package main
+
+import (
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// backfillRoundBillable gives rounds from before billable rounds existed the default of their group
+func backfillRoundBillable() {
+	// UpdateColumn keeps updated_at, which is what sync compares
+	err := db.Model(&Round{}).Where("billable IS NULL").UpdateColumn("billable", gorm.Expr(
+		"COALESCE((SELECT working_groups.billable FROM working_groups WHERE working_groups.id = rounds.working_group_id), ?)", true)).Error
+	if err != nil {
+		log.Println("Warning: failed to mark existing rounds billable:", err)
+	}
+}
+
+// roundBillable reports whether a round's time is billed to a client
+func roundBillable(round Round) bool {
+	return round.Billable == nil || *round.Billable
+}
+
+// billableSplit is a duration divided into billable and non-billable time, formatted for templates
+type billableSplit struct {
+	Billable    string
+	NonBillable string
+}
+
+// splitBillable formats the billable part of total seconds and the rest
+func splitBillable(total, billable int64) billableSplit {
+	return billableSplit{Billable: formatDuration(billable), NonBillable: formatDuration(total - billable)}
+}
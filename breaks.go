@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var (
+	errBreakOverlap  = errors.New("break overlaps a round or another break of the working group")
+	errBreakNotFound = errors.New("break not found")
+)
+
+// Break is time off taken on a day of a working group outside its rounds, such as a lunch between stopping one
+// round and starting the next. Breaks taken within a round are its pauses, see RoundPause; break statistics count
+// both kinds.
+type Break struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	WorkingGroupID uint      `gorm:"not null;index:idx_breaks_group_start,priority:1" json:"working_group_id"`
+	StartTime      time.Time `gorm:"not null;index:idx_breaks_group_start,priority:2" json:"start_time"`
+	EndTime        time.Time `gorm:"not null" json:"end_time"`
+	Note           string    `gorm:"size:255" json:"note"`
+	CreatedBy      string    `gorm:"size:64" json:"created_by"` // Client that recorded the break
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Kinds of break entries
+const (
+	breakKindPause = "pause" // Within a round, a RoundPause
+	breakKindBreak = "break" // On its own, a Break
+)
+
+// breakEntry is a pause or a standalone break, as listed by GET /api/v1/breaks and the day page
+type breakEntry struct {
+	ID             uint       `json:"id"`   // Of the pause or the break, depending on Kind
+	Kind           string     `json:"kind"` // "pause" within a round or "break" on its own
+	RoundID        *uint      `json:"round_id,omitempty"`
+	WorkingGroupID uint       `json:"working_group_id"`
+	StartTime      time.Time  `json:"start_time"`
+	EndTime        *time.Time `json:"end_time"` // NULL while the round is paused
+	Seconds        int64      `json:"seconds"`  // Up to now while paused
+	Note           string     `json:"note,omitempty"`
+}
+
+// breakRequest is the body of POST /api/v1/breaks
+type breakRequest struct {
+	GroupID   uint      `json:"group_id,omitempty"` // Defaults to the first working group
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	Note      string    `json:"note,omitempty"`
+}
+
+// addBreak records a break of one of the client user's groups. It may not overlap a round of the group, where a
+// pause is the way to take a break, nor another break of it.
+func addBreak(groupID uint, start, end time.Time, note string, client ClientInfo) (Break, error) {
+	group, err := findUserGroup(client.UserID, groupID)
+	if err != nil {
+		return Break{}, errGroupNotFound
+	}
+	if !end.After(start) || end.After(time.Now()) {
+		return Break{}, errInvalidTimes
+	}
+
+	brk := Break{
+		WorkingGroupID: group.ID,
+		StartTime:      start,
+		EndTime:        end,
+		Note:           truncateString(strings.TrimSpace(note), 255),
+		CreatedBy:      client.Name,
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var existing Round
+		err := tx.Where("working_group_id = ? AND start_time < ? AND (end_time IS NULL OR end_time > ?)", group.ID, end, start).
+			Order("start_time ASC").Take(&existing).Error
+		if err == nil {
+			return fmt.Errorf("%w: round #%d, %s", errBreakOverlap, existing.ID, roundSpan(existing.StartTime, existing.EndTime))
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		var other Break
+		err = tx.Where("working_group_id = ? AND start_time < ? AND end_time > ?", group.ID, end, start).
+			Order("start_time ASC").Take(&other).Error
+		if err == nil {
+			return fmt.Errorf("%w: break %s", errBreakOverlap, roundSpan(other.StartTime, &other.EndTime))
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		return tx.Create(&brk).Error
+	})
+	if errors.Is(err, errBreakOverlap) {
+		return Break{}, err
+	}
+	if err != nil {
+		log.Println("Error adding break:", err)
+		return Break{}, err
+	}
+
+	recordAudit("break.add", client, group.ID, nil,
+		fmt.Sprintf("Added a break of %s to '%s' (%s)", end.Sub(start).Round(time.Second), group.Name, roundSpan(start, &end)))
+	notifyRoundChange(group.ID)
+	return brk, nil
+}
+
+// deleteBreak removes a break of one of the client user's groups
+func deleteBreak(id uint, client ClientInfo) (Break, error) {
+	var brk Break
+	if err := db.Scopes(userRounds(client.UserID)).First(&brk, id).Error; err != nil {
+		return Break{}, errBreakNotFound
+	}
+	if err := db.Delete(&brk).Error; err != nil {
+		log.Println("Error deleting break:", err)
+		return Break{}, err
+	}
+	recordAudit("break.delete", client, brk.WorkingGroupID, nil,
+		fmt.Sprintf("Removed the break %s", roundSpan(brk.StartTime, &brk.EndTime)))
+	notifyRoundChange(brk.WorkingGroupID)
+	return brk, nil
+}
+
+// listBreaks returns the pauses and breaks of the user's groups, or of one group, that started in [from, to),
+// earliest first
+func listBreaks(ctx context.Context, userID, groupID uint, from, to time.Time) ([]breakEntry, error) {
+	scope := func(tx *gorm.DB) *gorm.DB {
+		tx = tx.Scopes(userRounds(userID))
+		if groupID != 0 {
+			tx = tx.Where("working_group_id = ?", groupID)
+		}
+		return tx
+	}
+
+	var pauses []struct {
+		RoundPause
+		WorkingGroupID uint
+	}
+	err := db.WithContext(ctx).Table("round_pauses").Select("round_pauses.*, rounds.working_group_id").
+		Joins("JOIN rounds ON rounds.id = round_pauses.round_id").Scopes(scope).
+		Where("round_pauses.start_time >= ? AND round_pauses.start_time < ?", from, to).Scan(&pauses).Error
+	if err != nil {
+		return nil, err
+	}
+	var breaks []Break
+	if err := db.WithContext(ctx).Scopes(scope).Where("start_time >= ? AND start_time < ?", from, to).
+		Find(&breaks).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	entries := make([]breakEntry, 0, len(pauses)+len(breaks))
+	for _, pause := range pauses {
+		roundID := pause.RoundID
+		seconds := pauseSeconds(pause.RoundPause)
+		if pause.EndTime == nil {
+			seconds = int64(now.Sub(pause.StartTime).Seconds())
+		}
+		entries = append(entries, breakEntry{
+			ID:             pause.ID,
+			Kind:           breakKindPause,
+			RoundID:        &roundID,
+			WorkingGroupID: pause.WorkingGroupID,
+			StartTime:      pause.StartTime,
+			EndTime:        pause.EndTime,
+			Seconds:        seconds,
+		})
+	}
+	for _, brk := range breaks {
+		end := brk.EndTime
+		entries = append(entries, breakEntry{
+			ID:             brk.ID,
+			Kind:           breakKindBreak,
+			WorkingGroupID: brk.WorkingGroupID,
+			StartTime:      brk.StartTime,
+			EndTime:        &end,
+			Seconds:        int64(end.Sub(brk.StartTime).Seconds()),
+			Note:           brk.Note,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].StartTime.Before(entries[j].StartTime) })
+	return entries, nil
+}
+
+// dailyBreakSeconds sums a group's standalone breaks by the home day they started on; pauses count with their
+// rounds
+func dailyBreakSeconds(ctx context.Context, groupID uint) (map[string]int64, error) {
+	var breaks []Break
+	if err := db.WithContext(ctx).Select("start_time", "end_time").Where("working_group_id = ?", groupID).
+		Find(&breaks).Error; err != nil {
+		return nil, err
+	}
+	days := make(map[string]int64)
+	for _, brk := range breaks {
+		days[brk.StartTime.In(time.Local).Format("2006-01-02")] += int64(brk.EndTime.Sub(brk.StartTime).Seconds())
+	}
+	return days, nil
+}
+
+// roundBreakSeconds is the time a round spent paused, its open pause counted up to now
+func roundBreakSeconds(round Round, now time.Time) int64 {
+	seconds := round.PausedSeconds
+	if round.EndTime == nil && round.PausedAt != nil {
+		seconds += int64(now.Sub(*round.PausedAt).Seconds())
+	}
+	return seconds
+}
+
+// saveBreakHandler adds a break from the day page and goes back to it
+func saveBreakHandler(c *fiber.Ctx) error {
+	groupID, err := parseGroupID(c.FormValue("group_id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid working group")
+	}
+	start, err := parseRoundInput(c.FormValue("start"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid start time")
+	}
+	end, err := parseRoundInput(c.FormValue("end"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid end time")
+	}
+
+	brk, err := addBreak(groupID, start, end, c.FormValue("note"), clientInfoFromRequest(c))
+	switch {
+	case errors.Is(err, errGroupNotFound):
+		return c.Status(404).SendString("Working group not found")
+	case errors.Is(err, errInvalidTimes):
+		return c.Status(400).SendString("The break must end after it starts and cannot be in the future")
+	case errors.Is(err, errBreakOverlap):
+		return c.Status(409).SendString("The " + err.Error() + "; pause the round for breaks within it")
+	case err != nil:
+		return c.Status(500).SendString("Error adding break")
+	}
+	return c.Redirect(fmt.Sprintf("/stats/day/%s?group_id=%d", brk.StartTime.In(time.Local).Format("2006-01-02"), groupID),
+		fiber.StatusSeeOther)
+}
+
+// deleteBreakHandler removes a break from the day page
+func deleteBreakHandler(c *fiber.Ctx) error {
+	id, err := parseGroupID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid break")
+	}
+	brk, err := deleteBreak(id, clientInfoFromRequest(c))
+	if errors.Is(err, errBreakNotFound) {
+		return c.Status(404).SendString("Break not found")
+	}
+	if err != nil {
+		return c.Status(500).SendString("Error removing break")
+	}
+	return c.Redirect(fmt.Sprintf("/stats/day/%s?group_id=%d", brk.StartTime.In(time.Local).Format("2006-01-02"), brk.WorkingGroupID),
+		fiber.StatusSeeOther)
+}
+
+// apiListBreaks lists pauses and breaks (?group_id=, ?from= and ?to= dates, the last 30 days by default)
+func apiListBreaks(c *fiber.Ctx) error {
+	userID := currentUserID(c)
+	var groupID uint
+	if value := c.Query("group_id"); value != "" {
+		parsed, err := parseGroupID(value)
+		if err != nil {
+			return c.Status(400).JSON(apiError{"invalid group_id"})
+		}
+		if _, err := findUserGroup(userID, parsed); err != nil {
+			return c.Status(404).JSON(apiError{"working group not found"})
+		}
+		groupID = parsed
+	}
+	now := time.Now()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, 1)
+	from := to.AddDate(0, 0, -30)
+	if value := c.Query("from"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return c.Status(400).JSON(apiError{"from must be a date like 2025-03-01"})
+		}
+		from = parsed
+	}
+	if value := c.Query("to"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return c.Status(400).JSON(apiError{"to must be a date like 2025-03-31"})
+		}
+		to = parsed.AddDate(0, 0, 1)
+	}
+
+	entries, err := listBreaks(traceContext(c), userID, groupID, from, to)
+	if err != nil {
+		requestLog(c).Println("Error listing breaks:", err)
+		return c.Status(500).JSON(apiError{"error listing breaks"})
+	}
+	return c.JSON(entries)
+}
+
+// apiAddBreak records a break outside the group's rounds
+func apiAddBreak(c *fiber.Ctx) error {
+	var req breakRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(apiError{"invalid request body"})
+	}
+	groupID, err := resolveAPIGroup(currentUserID(c), req.GroupID)
+	if err != nil {
+		return sendAPIRoundError(c, err, "error adding break")
+	}
+	brk, err := addBreak(groupID, req.StartTime, req.EndTime, req.Note, clientInfoFromRequest(c))
+	switch {
+	case errors.Is(err, errGroupNotFound):
+		return c.Status(404).JSON(apiError{"working group not found"})
+	case errors.Is(err, errInvalidTimes):
+		return c.Status(400).JSON(apiError{"break must end after it starts and cannot be in the future"})
+	case errors.Is(err, errBreakOverlap):
+		return c.Status(409).JSON(apiError{err.Error()})
+	case err != nil:
+		return c.Status(500).JSON(apiError{"error adding break"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(brk)
+}
+
+// apiDeleteBreak removes a standalone break; pauses go with their rounds
+func apiDeleteBreak(c *fiber.Ctx) error {
+	id, err := parseGroupID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(apiError{"invalid break"})
+	}
+	if _, err := deleteBreak(id, clientInfoFromRequest(c)); err != nil {
+		if errors.Is(err, errBreakNotFound) {
+			return c.Status(404).JSON(apiError{"break not found"})
+		}
+		return c.Status(500).JSON(apiError{"error removing break"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
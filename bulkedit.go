@@ -0,0 +1,299 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Actions of POST /api/v1/rounds/bulk
+const (
+	bulkAddTag      = "add_tag"
+	bulkRemoveTag   = "remove_tag"
+	bulkSetBillable = "set_billable"
+	bulkSetGroup    = "set_group"
+	bulkDelete      = "delete"
+	bulkKeep        = "keep" // Clears the review flag of rounds stopped before MIN_ROUND_DURATION
+)
+
+// maxBulkRounds is how many rounds one bulk edit may change, a few pages of the rounds list
+const maxBulkRounds = 500
+
+var errInvalidBulk = errors.New("invalid bulk edit")
+
+// roundBulkRequest is the body of POST /api/v1/rounds/bulk
+type roundBulkRequest struct {
+	RoundIDs []uint `json:"round_ids"`
+	Action   string `json:"action"`             // add_tag, remove_tag, set_billable, set_group, delete or keep
+	Tag      string `json:"tag,omitempty"`      // For add_tag and remove_tag
+	Billable *bool  `json:"billable,omitempty"` // For set_billable
+	GroupID  uint   `json:"group_id,omitempty"` // For set_group
+}
+
+// roundBulkResponse tells which of the selected rounds a bulk edit changed; the others already were as asked
+type roundBulkResponse struct {
+	Action  string `json:"action"`
+	Changed []uint `json:"changed"`
+}
+
+// bulkEditRounds applies one action to rounds of the client user's groups, all in one transaction: either every
+// round is changed or, when one of them can't be, none is. Billed rounds can be tagged but not changed otherwise.
+// Every changed round gets an audit entry as if it had been edited on its own.
+func bulkEditRounds(req roundBulkRequest, client ClientInfo) (roundBulkResponse, error) {
+	ids := make([]uint, 0, len(req.RoundIDs))
+	for _, id := range req.RoundIDs {
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 || len(ids) > maxBulkRounds {
+		return roundBulkResponse{}, fmt.Errorf("%w: select 1 to %d rounds", errInvalidBulk, maxBulkRounds)
+	}
+
+	var tagName string
+	var group WorkingGroup
+	switch req.Action {
+	case bulkAddTag, bulkRemoveTag:
+		names, err := parseTagNames(req.Tag)
+		if err != nil {
+			return roundBulkResponse{}, fmt.Errorf("%w: %s", errInvalidBulk, err.Error())
+		}
+		if len(names) != 1 {
+			return roundBulkResponse{}, fmt.Errorf("%w: name one tag", errInvalidBulk)
+		}
+		tagName = names[0]
+	case bulkSetBillable:
+		if req.Billable == nil {
+			return roundBulkResponse{}, fmt.Errorf("%w: billable is required", errInvalidBulk)
+		}
+	case bulkSetGroup:
+		var err error
+		if group, err = findUserGroup(client.UserID, req.GroupID); err != nil {
+			return roundBulkResponse{}, errGroupNotFound
+		}
+	case bulkDelete, bulkKeep:
+	default:
+		return roundBulkResponse{}, fmt.Errorf("%w: unknown action %q", errInvalidBulk, req.Action)
+	}
+
+	var rounds, changed []Round
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Preload("WorkingGroup").Preload("Tags").Scopes(userRounds(client.UserID)).Where("id IN ?", ids).
+			Order("start_time ASC, id ASC").Find(&rounds).Error; err != nil {
+			return err
+		}
+		if len(rounds) != len(ids) {
+			return errRoundNotFound
+		}
+		if req.Action != bulkAddTag && req.Action != bulkRemoveTag && req.Action != bulkKeep {
+			for _, round := range rounds {
+				if round.InvoiceID != nil {
+					return fmt.Errorf("%w: #%d", errRoundBilled, round.ID)
+				}
+			}
+		}
+
+		var err error
+		switch req.Action {
+		case bulkAddTag:
+			changed, err = bulkAddRoundTag(tx, rounds, tagName, client.UserID)
+		case bulkRemoveTag:
+			changed, err = bulkRemoveRoundTag(tx, rounds, tagName, client.UserID)
+		case bulkSetBillable:
+			for _, round := range rounds {
+				if roundBillable(round) == *req.Billable {
+					continue
+				}
+				if err := tx.Model(&round).Update("billable", *req.Billable).Error; err != nil {
+					return err
+				}
+				changed = append(changed, round)
+			}
+		case bulkSetGroup:
+			changed, err = bulkMoveRounds(tx, rounds, group)
+		case bulkDelete:
+			changed, err = rounds, bulkDeleteRounds(tx, rounds, client.UserID)
+		case bulkKeep:
+			for _, round := range rounds {
+				if !round.Flagged {
+					continue
+				}
+				if err := tx.Model(&round).Update("flagged", false).Error; err != nil {
+					return err
+				}
+				changed = append(changed, round)
+			}
+		}
+		return err
+	})
+	if errors.Is(err, errRoundNotFound) || errors.Is(err, errRoundBilled) || errors.Is(err, errRoundRunning) ||
+		errors.Is(err, errInvalidBulk) {
+		return roundBulkResponse{}, err
+	}
+	if err != nil {
+		log.Println("Error bulk editing rounds:", err)
+		return roundBulkResponse{}, err
+	}
+
+	response := roundBulkResponse{Action: req.Action, Changed: []uint{}}
+	groups := make(map[uint]bool)
+	for _, round := range changed {
+		response.Changed = append(response.Changed, round.ID)
+		groups[round.WorkingGroupID] = true
+		suffix := fmt.Sprintf(" (bulk edit of %s)", pluralize(int64(len(changed)), "round"))
+		switch req.Action {
+		case bulkAddTag:
+			recordAudit("round.tags", client, round.WorkingGroupID, &round.ID, "Tagged the round "+tagName+suffix)
+		case bulkRemoveTag:
+			recordAudit("round.tags", client, round.WorkingGroupID, &round.ID, "Removed the tag "+tagName+suffix)
+		case bulkSetBillable:
+			state := "non-billable"
+			if *req.Billable {
+				state = "billable"
+			}
+			recordAudit("round.update", client, round.WorkingGroupID, &round.ID,
+				fmt.Sprintf("Marked round of '%s' %s%s", round.WorkingGroup.Name, state, suffix))
+		case bulkSetGroup:
+			groups[group.ID] = true
+			recordAudit("round.update", client, group.ID, &round.ID,
+				fmt.Sprintf("Moved round %s from '%s' to '%s'%s", roundSpan(round.StartTime, round.EndTime),
+					round.WorkingGroup.Name, group.Name, suffix))
+		case bulkDelete:
+			recordAudit("round.delete", client, round.WorkingGroupID, nil,
+				fmt.Sprintf("Deleted round #%d of '%s' (%s)%s", round.ID, round.WorkingGroup.Name,
+					roundSpan(round.StartTime, round.EndTime), suffix))
+		case bulkKeep:
+			recordAudit("round.update", client, round.WorkingGroupID, &round.ID,
+				fmt.Sprintf("Kept round %s of '%s' after review%s", roundSpan(round.StartTime, round.EndTime),
+					round.WorkingGroup.Name, suffix))
+		}
+	}
+	for groupID := range groups {
+		notifyRoundChange(groupID)
+	}
+	return response, nil
+}
+
+// bulkAddRoundTag gives the rounds that don't have it yet the tag, creating it for the user when needed
+func bulkAddRoundTag(tx *gorm.DB, rounds []Round, name string, userID uint) ([]Round, error) {
+	tag := Tag{UserID: userID, Name: name}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tag).Error; err != nil {
+		return nil, err
+	}
+	if tag.ID == 0 {
+		if err := tx.Where("user_id = ? AND name = ?", userID, name).Take(&tag).Error; err != nil {
+			return nil, err
+		}
+	}
+	var changed []Round
+	for _, round := range rounds {
+		if slices.ContainsFunc(round.Tags, func(t Tag) bool { return t.ID == tag.ID }) {
+			continue
+		}
+		if len(round.Tags) >= maxRoundTags {
+			return nil, fmt.Errorf("%w: round #%d has %d tags already", errInvalidBulk, round.ID, maxRoundTags)
+		}
+		if err := tx.Model(&round).Association("Tags").Append(&tag); err != nil {
+			return nil, err
+		}
+		changed = append(changed, round)
+	}
+	return changed, nil
+}
+
+// bulkRemoveRoundTag takes the tag off the rounds that have it; the tag itself stays
+func bulkRemoveRoundTag(tx *gorm.DB, rounds []Round, name string, userID uint) ([]Round, error) {
+	var changed []Round
+	for _, round := range rounds {
+		index := slices.IndexFunc(round.Tags, func(t Tag) bool { return t.Name == name })
+		if index < 0 {
+			continue
+		}
+		if err := tx.Model(&round).Association("Tags").Delete(&round.Tags[index]); err != nil {
+			return nil, err
+		}
+		changed = append(changed, round)
+	}
+	return changed, nil
+}
+
+// bulkMoveRounds moves the rounds to group, keeping whether each is billable. A group never gets a second running
+// round, neither from the move nor next to one it has.
+func bulkMoveRounds(tx *gorm.DB, rounds []Round, group WorkingGroup) ([]Round, error) {
+	var moving []Round
+	var movingIDs []uint
+	running := 0
+	for _, round := range rounds {
+		if round.WorkingGroupID == group.ID {
+			continue
+		}
+		moving = append(moving, round)
+		movingIDs = append(movingIDs, round.ID)
+		if round.EndTime == nil {
+			running++
+		}
+	}
+	if len(moving) == 0 {
+		return nil, nil
+	}
+	if running > 0 {
+		var existing int64
+		if err := tx.Model(&Round{}).Where("working_group_id = ? AND end_time IS NULL", group.ID).Count(&existing).Error; err != nil {
+			return nil, err
+		}
+		if running+int(existing) > 1 {
+			return nil, errRoundRunning
+		}
+	}
+	if err := tx.Model(&Round{}).Where("id IN ?", movingIDs).Update("working_group_id", group.ID).Error; err != nil {
+		return nil, err
+	}
+	return moving, nil
+}
+
+// bulkDeleteRounds deletes the rounds with their tags and external IDs. Their attachments stay as attachments of the
+// day the round started, and synced instances are told through tombstones.
+func bulkDeleteRounds(tx *gorm.DB, rounds []Round, userID uint) error {
+	ids := make([]uint, len(rounds))
+	for i, round := range rounds {
+		ids[i] = round.ID
+	}
+	if err := tx.Model(&Attachment{}).Where("round_id IN ?", ids).Update("round_id", nil).Error; err != nil {
+		return err
+	}
+	if err := deleteRoundPauses(tx, ids...); err != nil {
+		return err
+	}
+	for _, round := range rounds {
+		if err := tx.Model(&round).Association("Tags").Clear(); err != nil {
+			return err
+		}
+		if err := deleteEntityMappings(tx, userID, mappingRound, round.ID); err != nil {
+			return err
+		}
+		if err := recordTombstone(tx, userID, "round", round.ID, round.SyncID); err != nil {
+			return err
+		}
+	}
+	return tx.Delete(&Round{}, ids).Error
+}
+
+// apiBulkEditRounds serves POST /api/v1/rounds/bulk, used by the selection toolbar of the rounds page
+func apiBulkEditRounds(c *fiber.Ctx) error {
+	var req roundBulkRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(apiError{"invalid request body"})
+	}
+	req.Action = strings.TrimSpace(req.Action)
+	response, err := bulkEditRounds(req, clientInfoFromRequest(c))
+	if err != nil {
+		return sendRoundUpdateError(c, err)
+	}
+	return c.JSON(response)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// calendarHourHeight is the height of one hour in the calendar, in pixels; the view script uses the same scale
+const calendarHourHeight = 48
+
+// calendarBlock is the part of a round shown in one day column
+type calendarBlock struct {
+	RoundID  uint
+	Group    string
+	Icon     string
+	Color    string
+	Top      int // Pixels from midnight
+	Height   int
+	Time     string // e.g. "09:00–12:30"
+	Note     string
+	Start    int64 // Unix times of the whole round, End is 0 while running
+	End      int64
+	Editable bool // Dragging is offered for finished, unbilled rounds within one day
+	Running  bool
+	Billed   bool
+}
+
+type calendarColumn struct {
+	Date     string
+	Label    string
+	Today    bool
+	DayStart int64 // Unix time of midnight, the script adds the dropped offset to it
+	Blocks   []calendarBlock
+}
+
+type calendarGroupOption struct {
+	ID       uint
+	Name     string
+	Icon     string
+	Color    string
+	Selected bool
+}
+
+// renderCalendar shows rounds as time blocks in a day or week view, e.g. /calendar?view=week&date=2025-03-03
+func renderCalendar(c *fiber.Ctx) error {
+	date := time.Now()
+	if value := c.Query("date"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return c.Status(400).SendString("Invalid date")
+		}
+		date = parsed
+	}
+	view := c.Query("view", "week")
+	if view != "day" && view != "week" {
+		return c.Status(400).SendString("Invalid view")
+	}
+	var groupID uint
+	if value := c.Query("group_id"); value != "" {
+		parsed, err := parseGroupID(value)
+		if err != nil {
+			return c.Status(400).SendString("Invalid working group")
+		}
+		groupID = parsed
+	}
+
+	start := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.Local)
+	days, step := 1, 1
+	if view == "week" {
+		start = weekStart(start)
+		days, step = 7, 7
+	}
+	end := start.AddDate(0, 0, days)
+
+	userID := currentUserID(c)
+	groups, err := getWorkingGroupsOrdered(userID)
+	if err != nil {
+		requestLog(c).Println("Error loading working groups:", err)
+		return c.Status(500).SendString("Error loading calendar")
+	}
+	colors := groupColors(groups)
+	options := make([]calendarGroupOption, 0, len(groups))
+	for _, group := range groups {
+		options = append(options, calendarGroupOption{ID: group.ID, Name: group.Name, Icon: group.Icon, Color: colors[group.ID],
+			Selected: group.ID == groupID})
+	}
+
+	query := db.Preload("WorkingGroup").Scopes(userRounds(userID)).
+		Where("start_time < ? AND (end_time IS NULL OR end_time > ?)", end, start)
+	if groupID != 0 {
+		query = query.Where("working_group_id = ?", groupID)
+	}
+	var rounds []Round
+	if err := query.Order("start_time ASC").Find(&rounds).Error; err != nil {
+		requestLog(c).Println("Error loading rounds:", err)
+		return c.Status(500).SendString("Error loading calendar")
+	}
+
+	now := time.Now()
+	canEdit := requestLevel(c) >= scopeLevels[scopeControl]
+	columns := make([]calendarColumn, days)
+	for i := range columns {
+		day := start.AddDate(0, 0, i)
+		columns[i] = calendarColumn{
+			Date:     day.Format("2006-01-02"),
+			Label:    day.Format("Mon, Jan 2"),
+			Today:    day.Format("2006-01-02") == now.Format("2006-01-02"),
+			DayStart: day.Unix(),
+		}
+		dayEnd := day.AddDate(0, 0, 1)
+		for _, round := range rounds {
+			roundEnd := now
+			if round.EndTime != nil {
+				roundEnd = *round.EndTime
+			}
+			if !round.StartTime.Before(dayEnd) || !roundEnd.After(day) {
+				continue
+			}
+			// Rounds across midnight show a piece in every day they touch
+			from, to := round.StartTime, roundEnd
+			if from.Before(day) {
+				from = day
+			}
+			if to.After(dayEnd) {
+				to = dayEnd
+			}
+			block := calendarBlock{
+				RoundID: round.ID,
+				Group:   round.WorkingGroup.Name,
+				Icon:    round.WorkingGroup.Icon,
+				Color:   colors[round.WorkingGroupID],
+				Top:     int(from.Sub(day).Minutes() * calendarHourHeight / 60),
+				Height:  max(int(to.Sub(from).Minutes()*calendarHourHeight/60), 4),
+				Time:    round.StartTime.Format("15:04") + "–" + roundEnd.Format("15:04"),
+				Note:    round.Note,
+				Start:   round.StartTime.Unix(),
+				Running: round.EndTime == nil,
+				Billed:  round.InvoiceID != nil,
+			}
+			if round.EndTime != nil {
+				block.End = round.EndTime.Unix()
+			}
+			block.Editable = canEdit && !block.Running && !block.Billed &&
+				!round.StartTime.Before(day) && !roundEnd.After(dayEnd)
+			columns[i].Blocks = append(columns[i].Blocks, block)
+		}
+	}
+
+	hours := make([]string, 24)
+	for h := range hours {
+		hours[h] = fmt.Sprintf("%02d:00", h)
+	}
+	title := start.Format("Monday, January 2, 2006")
+	if view == "week" {
+		title = start.Format("Jan 2") + " – " + end.AddDate(0, 0, -1).Format("Jan 2, 2006")
+	}
+
+	return c.Render("calendar", fiber.Map{
+		"Title":      title,
+		"View":       view,
+		"IsWeek":     view == "week",
+		"Date":       start.Format("2006-01-02"),
+		"Prev":       start.AddDate(0, 0, -step).Format("2006-01-02"),
+		"Next":       start.AddDate(0, 0, step).Format("2006-01-02"),
+		"GroupID":    groupID,
+		"Groups":     options,
+		"Columns":    columns,
+		"Hours":      hours,
+		"HourHeight": calendarHourHeight,
+		"DayHeight":  24 * calendarHourHeight,
+		"CanEdit":    canEdit,
+	})
+}
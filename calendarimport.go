@@ -0,0 +1,517 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// CalendarFeed is a subscribed ICS URL whose meetings can be turned into rounds
+type CalendarFeed struct {
+	ID             uint   `gorm:"primaryKey"`
+	UserID         uint   `gorm:"index;default:0"`
+	Name           string `gorm:"not null"`
+	URL            string `gorm:"not null"` // Usually carries the calendar's access token, so sealed like a secret
+	DefaultGroupID uint
+	LastFetchedAt  *time.Time
+	CreatedAt      time.Time
+}
+
+// GroupMappingRule assigns meetings with an attendee from Domain to a working group
+type GroupMappingRule struct {
+	ID             uint   `gorm:"primaryKey"`
+	UserID         uint   `gorm:"uniqueIndex:idx_group_mapping_rules_user_domain;default:0"`
+	Domain         string `gorm:"uniqueIndex:idx_group_mapping_rules_user_domain;size:191;not null"`
+	WorkingGroupID uint
+	WorkingGroup   WorkingGroup
+	CreatedAt      time.Time
+}
+
+// calendarEvent is a timed VEVENT parsed from an ICS document
+type calendarEvent struct {
+	UID       string
+	Summary   string
+	Start     time.Time
+	End       time.Time
+	Attendees []string // Email addresses
+}
+
+// unfoldICS joins folded continuation lines (RFC 5545 section 3.1)
+func unfoldICS(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+func unescapeICSText(value string) string {
+	replacer := strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`)
+	return strings.TrimSpace(replacer.Replace(value))
+}
+
+// parseICSTime parses DATE-TIME values; all-day DATE values report ok=false
+func parseICSTime(params, value string) (time.Time, bool) {
+	if strings.Contains(params, "VALUE=DATE") && !strings.Contains(params, "VALUE=DATE-TIME") {
+		return time.Time{}, false
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t.Local(), err == nil
+	}
+
+	loc := time.Local
+	for _, param := range strings.Split(params, ";") {
+		if tzid, found := strings.CutPrefix(param, "TZID="); found {
+			if tz, err := time.LoadLocation(strings.Trim(tzid, `"`)); err == nil {
+				loc = tz
+			}
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t.Local(), err == nil
+}
+
+func parseICS(r io.Reader) ([]calendarEvent, error) {
+	lines, err := unfoldICS(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []calendarEvent
+	var current *calendarEvent
+	timed := true
+	for _, line := range lines {
+		switch line {
+		case "BEGIN:VEVENT":
+			current = &calendarEvent{}
+			timed = true
+			continue
+		case "END:VEVENT":
+			if current != nil && timed && !current.Start.IsZero() && current.End.After(current.Start) {
+				events = append(events, *current)
+			}
+			current = nil
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		nameAndParams, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		name, params, _ := strings.Cut(nameAndParams, ";")
+		switch strings.ToUpper(name) {
+		case "UID":
+			current.UID = value
+		case "SUMMARY":
+			current.Summary = unescapeICSText(value)
+		case "DTSTART":
+			current.Start, timed = parseICSTime(params, value)
+		case "DTEND":
+			var ok bool
+			if current.End, ok = parseICSTime(params, value); !ok {
+				timed = false
+			}
+		case "ATTENDEE", "ORGANIZER":
+			if email, found := strings.CutPrefix(strings.ToLower(value), "mailto:"); found {
+				current.Attendees = append(current.Attendees, email)
+			}
+		}
+	}
+	return events, nil
+}
+
+// calendarProposal is an event offered for import as a round
+type calendarProposal struct {
+	Index         int
+	Note          string
+	Start         time.Time
+	End           time.Time
+	GroupID       uint
+	MatchedDomain string
+	AlreadyListed bool // Overlaps an existing round of the group, unselected by default
+	ExternalID    string
+	Duplicate     *importDuplicate // Already imported or tracked, left out when confirming
+}
+
+// calendarExternalID identifies an event for importDeduper: its UID, and its start since the occurrences of a
+// recurring meeting share the UID. Events without a UID have none.
+func calendarExternalID(event calendarEvent) string {
+	if event.UID == "" {
+		return ""
+	}
+	return event.UID + "@" + strconv.FormatInt(event.Start.Unix(), 10)
+}
+
+// proposeRounds maps events to working groups using the user's domain rules, falling back to defaultGroupID
+func proposeRounds(userID uint, events []calendarEvent, defaultGroupID uint, since time.Time) ([]calendarProposal, error) {
+	var rules []GroupMappingRule
+	if err := db.Where("user_id = ?", userID).Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	groupByDomain := make(map[string]uint)
+	for _, rule := range rules {
+		groupByDomain[strings.ToLower(rule.Domain)] = rule.WorkingGroupID
+	}
+
+	now := time.Now()
+	var proposals []calendarProposal
+	dedup := newImportDeduper(db, userID)
+	for _, event := range events {
+		if event.End.After(now) || event.Start.Before(since) {
+			continue
+		}
+
+		proposal := calendarProposal{
+			Note:       event.Summary,
+			Start:      event.Start,
+			End:        event.End,
+			GroupID:    defaultGroupID,
+			ExternalID: calendarExternalID(event),
+		}
+		for _, attendee := range event.Attendees {
+			_, domain, _ := strings.Cut(attendee, "@")
+			if groupID, ok := groupByDomain[domain]; ok {
+				proposal.GroupID = groupID
+				proposal.MatchedDomain = domain
+				break
+			}
+		}
+
+		var overlapping int64
+		db.Model(&Round{}).Where("working_group_id = ? AND start_time < ? AND (end_time IS NULL OR end_time > ?)",
+			proposal.GroupID, proposal.End, proposal.Start).Count(&overlapping)
+		proposal.AlreadyListed = overlapping > 0
+
+		proposals = append(proposals, proposal)
+	}
+
+	// In start order, so the first of a meeting listed twice is the one kept
+	sort.Slice(proposals, func(i, j int) bool {
+		return proposals[i].Start.Before(proposals[j].Start)
+	})
+	for i := range proposals {
+		duplicate, err := dedup.check(proposals[i].candidate())
+		if err != nil {
+			return nil, err
+		}
+		proposals[i].Duplicate = duplicate
+		proposals[i].Index = i
+	}
+	return proposals, nil
+}
+
+// candidate is the round a proposal becomes, for importDeduper
+func (p calendarProposal) candidate() importCandidate {
+	return importCandidate{Source: sourceCalendar, ExternalID: p.ExternalID, GroupID: p.GroupID, Start: p.Start, End: p.End,
+		Note: p.Note}
+}
+
+func fetchCalendar(url string) ([]calendarEvent, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+	return parseICS(io.LimitReader(resp.Body, 10<<20))
+}
+
+func renderCalendarImport(c *fiber.Ctx) error {
+	userID := currentUserID(c)
+	groups, err := getWorkingGroupsOrdered(userID)
+	if err != nil {
+		requestLog(c).Println("Error fetching working groups:", err)
+		return c.Status(500).SendString("Error loading calendar import")
+	}
+
+	var feeds []CalendarFeed
+	if err := db.Where("user_id = ?", userID).Order("name ASC").Find(&feeds).Error; err != nil {
+		requestLog(c).Println("Error fetching calendar feeds:", err)
+	}
+	var feedViews []fiber.Map
+	for _, feed := range feeds {
+		// Shown as a hint only; a feed that can't be read says so when it is fetched
+		feedURL, _ := openSecret(feed.URL)
+		lastFetched := "Never"
+		if feed.LastFetchedAt != nil {
+			lastFetched = feed.LastFetchedAt.Format("2006-01-02 15:04")
+		}
+		feedViews = append(feedViews, fiber.Map{
+			"ID":          feed.ID,
+			"Name":        feed.Name,
+			"URL":         feedURL,
+			"LastFetched": lastFetched,
+		})
+	}
+
+	var rules []GroupMappingRule
+	if err := db.Preload("WorkingGroup").Where("user_id = ?", userID).Order("domain ASC").Find(&rules).Error; err != nil {
+		requestLog(c).Println("Error fetching group mapping rules:", err)
+	}
+
+	return c.Render("calendar_import", fiber.Map{
+		"Groups": groups,
+		"Feeds":  feedViews,
+		"Rules":  rules,
+	})
+}
+
+// previewCalendarImport parses an uploaded file, a URL or a saved feed and lists the proposed rounds
+func previewCalendarImport(c *fiber.Ctx) error {
+	userID := currentUserID(c)
+	defaultGroupID, err := parseGroupID(c.FormValue("group_id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid working group")
+	}
+	days, err := strconv.Atoi(c.FormValue("days", "30"))
+	if err != nil || days <= 0 {
+		return c.Status(400).SendString("Invalid number of days")
+	}
+
+	var events []calendarEvent
+	var feed *CalendarFeed
+	if feedParam := c.FormValue("feed_id"); feedParam != "" {
+		feedID, err := parseGroupID(feedParam)
+		if err != nil {
+			return c.Status(400).SendString("Invalid calendar feed")
+		}
+		feed = &CalendarFeed{}
+		if err := db.Where("user_id = ?", userID).First(feed, feedID).Error; err != nil {
+			return c.Status(404).SendString("Calendar feed not found")
+		}
+		url, err := openSecret(feed.URL)
+		if err != nil {
+			requestLog(c).Printf("Error reading calendar feed #%d: %v", feed.ID, err)
+			return c.Status(500).SendString("Error reading calendar feed")
+		}
+		if events, err = fetchCalendar(url); err != nil {
+			return c.Status(502).SendString("Error fetching calendar feed: " + err.Error())
+		}
+	} else if header, err := c.FormFile("file"); err == nil {
+		file, err := header.Open()
+		if err != nil {
+			return c.Status(400).SendString("Error reading calendar file")
+		}
+		defer file.Close()
+		if events, err = parseICS(file); err != nil {
+			return c.Status(400).SendString("Error parsing calendar file: " + err.Error())
+		}
+	} else {
+		return c.Status(400).SendString("Upload an .ics file or choose a calendar feed")
+	}
+
+	proposals, err := proposeRounds(userID, events, defaultGroupID, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		requestLog(c).Println("Error proposing rounds:", err)
+		return c.Status(500).SendString("Error preparing calendar import")
+	}
+	if feed != nil {
+		now := time.Now()
+		db.Model(feed).Update("last_fetched_at", now)
+	}
+
+	groups, err := getWorkingGroupsOrdered(userID)
+	if err != nil {
+		requestLog(c).Println("Error fetching working groups:", err)
+		return c.Status(500).SendString("Error preparing calendar import")
+	}
+
+	paths := groupPaths(groups)
+	var rows []fiber.Map
+	for _, proposal := range proposals {
+		var options []StatusGroupOption
+		for _, group := range groups {
+			options = append(options, StatusGroupOption{ID: group.ID, Name: paths[group.ID], Selected: group.ID == proposal.GroupID})
+		}
+		rows = append(rows, fiber.Map{
+			"Index":         proposal.Index,
+			"Note":          proposal.Note,
+			"Start":         proposal.Start.Unix(),
+			"End":           proposal.End.Unix(),
+			"StartStr":      proposal.Start.Format("2006-01-02 15:04"),
+			"EndStr":        proposal.End.Format("15:04"),
+			"Duration":      formatDuration(int64(proposal.End.Sub(proposal.Start).Seconds())),
+			"MatchedDomain": proposal.MatchedDomain,
+			"AlreadyListed": proposal.AlreadyListed,
+			"ExternalID":    proposal.ExternalID,
+			"Duplicate":     proposal.Duplicate,
+			"GroupOptions":  options,
+		})
+	}
+
+	return c.Render("calendar_preview", fiber.Map{
+		"Proposals": rows,
+		"Count":     len(rows),
+	})
+}
+
+// confirmCalendarImport creates rounds for the selected proposals in one transaction, leaving out those importDeduper
+// finds, so confirming the same preview twice doesn't import meetings twice
+func confirmCalendarImport(c *fiber.Ctx) error {
+	count, err := strconv.Atoi(c.FormValue("count"))
+	if err != nil || count < 0 {
+		return c.Status(400).SendString("Invalid import")
+	}
+
+	client := clientInfoFromRequest(c)
+	client.Name = "calendar-import"
+	client.Source = sourceCalendar
+
+	var rounds []Round
+	for i := 0; i < count; i++ {
+		if c.FormValue(fmt.Sprintf("selected_%d", i)) == "" {
+			continue
+		}
+		start, err1 := strconv.ParseInt(c.FormValue(fmt.Sprintf("start_%d", i)), 10, 64)
+		end, err2 := strconv.ParseInt(c.FormValue(fmt.Sprintf("end_%d", i)), 10, 64)
+		groupID, err3 := parseGroupID(c.FormValue(fmt.Sprintf("group_%d", i)))
+		if err1 != nil || err2 != nil || err3 != nil || end <= start {
+			return c.Status(400).SendString(fmt.Sprintf("Invalid entry #%d", i+1))
+		}
+		endTime := time.Unix(end, 0)
+		rounds = append(rounds, Round{
+			StartTime:      time.Unix(start, 0),
+			EndTime:        &endTime,
+			WorkingGroupID: groupID,
+			Note:           truncateString(c.FormValue(fmt.Sprintf("note_%d", i)), 500),
+			StartedBy:      client.Name,
+			StartUserAgent: client.UserAgent,
+			StoppedBy:      client.Name,
+			StopUserAgent:  client.UserAgent,
+			TimeZone:       client.TimeZone,
+			Source:         client.Source,
+			ExternalID:     truncateString(c.FormValue(fmt.Sprintf("external_id_%d", i)), 191),
+		})
+	}
+	if len(rounds) == 0 {
+		return c.Status(400).SendString("No meetings selected")
+	}
+
+	report := importReport{Source: sourceCalendar, ImportPath: "/import/calendar"}
+	var created []Round
+	err = db.Transaction(func(tx *gorm.DB) error {
+		dedup := newImportDeduper(tx, client.UserID)
+		for _, round := range rounds {
+			var group WorkingGroup
+			if err := tx.Scopes(userGroups(client.UserID)).First(&group, round.WorkingGroupID).Error; err != nil {
+				return errGroupNotFound
+			}
+			duplicate, err := dedup.check(importCandidate{Source: round.Source, ExternalID: round.ExternalID,
+				GroupID: round.WorkingGroupID, Start: round.StartTime, End: *round.EndTime, Note: round.Note})
+			if err != nil {
+				return err
+			}
+			if duplicate != nil {
+				report.Skipped = append(report.Skipped, *duplicate)
+				continue
+			}
+			if err := tx.Create(&round).Error; err != nil {
+				return err
+			}
+			created = append(created, round)
+		}
+		return nil
+	})
+	if err != nil {
+		requestLog(c).Println("Error importing calendar rounds:", err)
+		return c.Status(400).SendString("Error importing meetings: " + err.Error())
+	}
+	report.Created = len(created)
+
+	for _, round := range created {
+		recordAudit("round.import", client, round.WorkingGroupID, &round.ID, fmt.Sprintf("Imported meeting '%s'", round.Note))
+		notifyRoundChange(round.WorkingGroupID)
+	}
+	requestLog(c).Printf("Imported %d meeting(s) from calendar, skipped %d duplicate(s)", report.Created, len(report.Skipped))
+
+	return renderImportReport(c, report)
+}
+
+func createCalendarFeedHandler(c *fiber.Ctx) error {
+	name := strings.TrimSpace(c.FormValue("name"))
+	url := strings.TrimSpace(c.FormValue("url"))
+	if name == "" || !(strings.HasPrefix(url, "https://") || strings.HasPrefix(url, "http://")) {
+		return c.Status(400).SendString("A name and an http(s) URL are required")
+	}
+
+	sealed, err := sealSecret(url)
+	if err != nil {
+		requestLog(c).Println("Error encrypting calendar feed URL:", err)
+		return c.Status(500).SendString("Error saving calendar feed")
+	}
+	feed := CalendarFeed{UserID: currentUserID(c), Name: name, URL: sealed}
+	if err := db.Create(&feed).Error; err != nil {
+		requestLog(c).Println("Error creating calendar feed:", err)
+		return c.Status(500).SendString("Error saving calendar feed")
+	}
+	return c.Redirect("/import/calendar", fiber.StatusSeeOther)
+}
+
+func deleteCalendarFeedHandler(c *fiber.Ctx) error {
+	id, err := parseGroupID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid calendar feed")
+	}
+	if err := db.Where("user_id = ?", currentUserID(c)).Delete(&CalendarFeed{}, id).Error; err != nil {
+		requestLog(c).Println("Error deleting calendar feed:", err)
+		return c.Status(500).SendString("Error deleting calendar feed")
+	}
+	return c.Redirect("/import/calendar", fiber.StatusSeeOther)
+}
+
+func createMappingRuleHandler(c *fiber.Ctx) error {
+	domain := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(c.FormValue("domain")), "@"))
+	if domain == "" {
+		return c.Status(400).SendString("Domain cannot be empty")
+	}
+	groupID, err := parseGroupID(c.FormValue("group_id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid working group")
+	}
+
+	userID := currentUserID(c)
+	if _, err := findUserGroup(userID, groupID); err != nil {
+		return c.Status(404).SendString("Working group not found")
+	}
+
+	rule := GroupMappingRule{UserID: userID, Domain: domain, WorkingGroupID: groupID}
+	if err := db.Create(&rule).Error; err != nil {
+		requestLog(c).Println("Error creating mapping rule:", err)
+		return c.Status(400).SendString("Error saving rule (is the domain already mapped?)")
+	}
+	return c.Redirect("/import/calendar", fiber.StatusSeeOther)
+}
+
+func deleteMappingRuleHandler(c *fiber.Ctx) error {
+	id, err := parseGroupID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid rule")
+	}
+	if err := db.Where("user_id = ?", currentUserID(c)).Delete(&GroupMappingRule{}, id).Error; err != nil {
+		requestLog(c).Println("Error deleting mapping rule:", err)
+		return c.Status(500).SendString("Error deleting rule")
+	}
+	return c.Redirect("/import/calendar", fiber.StatusSeeOther)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm/clause"
+)
+
+// CapacityException replaces a group's daily target on one date, such as 4 hours for a half day or none for a day
+// off, so the day and its week are measured against what was actually expected
+type CapacityException struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	UserID         uint      `gorm:"index" json:"user_id"`
+	WorkingGroupID uint      `gorm:"uniqueIndex:idx_capacity_exceptions_group_date" json:"working_group_id"`
+	Date           string    `gorm:"uniqueIndex:idx_capacity_exceptions_group_date;size:10" json:"date"` // YYYY-MM-DD
+	Minutes        int       `json:"minutes"`                                                            // Expected time that day, 0 for none
+	Reason         string    `gorm:"size:200" json:"reason"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// capacityExceptionDays is how far back the group page lists past exceptions
+const capacityExceptionDays = 14
+
+// loadCapacityExceptions returns the user's exceptions per group and date for the dates in [from, to). The public
+// holidays of the user's holiday region count as days off of every group, unless the group has an exception that day.
+func loadCapacityExceptions(ctx context.Context, userID uint, from, to time.Time) (map[uint]map[string]CapacityException, error) {
+	var exceptions []CapacityException
+	err := db.WithContext(ctx).Where("user_id = ? AND date >= ? AND date < ?", userID,
+		from.Format("2006-01-02"), to.Format("2006-01-02")).Find(&exceptions).Error
+	if err != nil {
+		return nil, err
+	}
+	byGroup := make(map[uint]map[string]CapacityException)
+	for _, exception := range exceptions {
+		if byGroup[exception.WorkingGroupID] == nil {
+			byGroup[exception.WorkingGroupID] = make(map[string]CapacityException)
+		}
+		byGroup[exception.WorkingGroupID][exception.Date] = exception
+	}
+
+	holidays, err := userHolidays(ctx, userID, from, to)
+	if err != nil || len(holidays) == 0 {
+		return byGroup, err
+	}
+	var groupIDs []uint
+	if err := db.WithContext(ctx).Model(&WorkingGroup{}).Scopes(userGroups(userID)).Pluck("id", &groupIDs).Error; err != nil {
+		return nil, err
+	}
+	for _, groupID := range groupIDs {
+		if byGroup[groupID] == nil {
+			byGroup[groupID] = make(map[string]CapacityException)
+		}
+		for _, holiday := range holidays {
+			if _, ok := byGroup[groupID][holiday.Date]; !ok {
+				byGroup[groupID][holiday.Date] = CapacityException{UserID: userID, WorkingGroupID: groupID, Date: holiday.Date, Reason: holiday.Name}
+			}
+		}
+	}
+	return byGroup, nil
+}
+
+// dayTargetMinutes is a group's target on date: the exception's when the day has one, otherwise the daily target
+func dayTargetMinutes(dailyTargetMinutes int, exceptions map[string]CapacityException, date string) int {
+	if exception, ok := exceptions[date]; ok {
+		return exception.Minutes
+	}
+	return dailyTargetMinutes
+}
+
+// capacityExceptionViews lists the exceptions of the user's groups from two weeks ago on, for the group page
+func capacityExceptionViews(userID uint, groups []WorkingGroup) ([]fiber.Map, error) {
+	var exceptions []CapacityException
+	since := time.Now().AddDate(0, 0, -capacityExceptionDays).Format("2006-01-02")
+	if err := db.Where("user_id = ? AND date >= ?", userID, since).Order("date ASC").Find(&exceptions).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string, len(groups))
+	for _, group := range groups {
+		names[group.ID] = group.Name
+	}
+	today := time.Now().Format("2006-01-02")
+	var views []fiber.Map
+	for _, exception := range exceptions {
+		date, _ := time.ParseInLocation("2006-01-02", exception.Date, time.Local)
+		views = append(views, fiber.Map{
+			"ID":        exception.ID,
+			"GroupID":   exception.WorkingGroupID,
+			"GroupName": names[exception.WorkingGroupID],
+			"Date":      date.Format("Mon, Jan 2, 2006"),
+			"Target":    formatTimesheetHours(int64(exception.Minutes) * 60),
+			"Reason":    exception.Reason,
+			"Past":      exception.Date < today,
+		})
+	}
+	return views, nil
+}
+
+// saveCapacityExceptionHandler sets the expected time of a group on one date, replacing an earlier exception of
+// that day
+func saveCapacityExceptionHandler(c *fiber.Ctx) error {
+	groupID, err := parseGroupID(c.FormValue("group_id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid working group")
+	}
+	userID := currentUserID(c)
+	group, err := findUserGroup(userID, groupID)
+	if err != nil {
+		return c.Status(404).SendString("Working group not found")
+	}
+	date, err := time.ParseInLocation("2006-01-02", c.FormValue("date"), time.Local)
+	if err != nil {
+		return c.Status(400).SendString("Invalid date")
+	}
+	seconds, err := parseTimesheetHours(c.FormValue("hours"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid hours: " + err.Error())
+	}
+	reason := c.FormValue("reason")
+	if len(reason) > 200 {
+		return c.Status(400).SendString("Reason is too long (200 characters at most)")
+	}
+
+	exception := CapacityException{
+		UserID:         userID,
+		WorkingGroupID: group.ID,
+		Date:           date.Format("2006-01-02"),
+		Minutes:        int((seconds + 30) / 60),
+		Reason:         reason,
+	}
+	err = db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "working_group_id"}, {Name: "date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"minutes", "reason", "updated_at"}),
+	}).Create(&exception).Error
+	if err != nil {
+		requestLog(c).Println("Error saving capacity exception:", err)
+		return c.Status(500).SendString("Error saving day exception")
+	}
+
+	hours := formatTimesheetHours(int64(exception.Minutes) * 60)
+	if hours == "" {
+		hours = "no time"
+	}
+	details := fmt.Sprintf("Expecting %s for '%s' on %s", hours, group.Name, exception.Date)
+	if reason != "" {
+		details += " (" + reason + ")"
+	}
+	recordAudit("group.exception", clientInfoFromRequest(c), group.ID, nil, details)
+
+	return c.Redirect("/groups/manage", fiber.StatusSeeOther)
+}
+
+// deleteCapacityExceptionHandler removes an exception, so the day's daily target applies again
+func deleteCapacityExceptionHandler(c *fiber.Ctx) error {
+	id, err := parseGroupID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid day exception")
+	}
+	var exception CapacityException
+	if err := db.Where("user_id = ?", currentUserID(c)).Take(&exception, id).Error; err != nil {
+		return c.Status(404).SendString("Day exception not found")
+	}
+	if err := db.Delete(&exception).Error; err != nil {
+		requestLog(c).Println("Error deleting capacity exception:", err)
+		return c.Status(500).SendString("Error deleting day exception")
+	}
+	recordAudit("group.exception", clientInfoFromRequest(c), exception.WorkingGroupID, nil,
+		fmt.Sprintf("Removed the exception of %s, the daily target applies again", exception.Date))
+
+	return c.Redirect("/groups/manage", fiber.StatusSeeOther)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Entity kinds of the changes feed, in the order they are listed when several changed at the same instant
+const (
+	changeKindGroup = iota
+	changeKindRound
+	changeKindDeletion
+)
+
+const (
+	defaultChangesLimit = 100
+	maxChangesLimit     = 1000
+)
+
+// changeCursor is the position of a change in the feed: its time, kind and row ID
+type changeCursor struct {
+	At   time.Time
+	Kind int
+	ID   uint
+}
+
+func (c changeCursor) String() string {
+	raw := fmt.Sprintf("%d.%d.%d", c.At.UnixNano(), c.Kind, c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func (c changeCursor) before(other changeCursor) bool {
+	if !c.At.Equal(other.At) {
+		return c.At.Before(other.At)
+	}
+	if c.Kind != other.Kind {
+		return c.Kind < other.Kind
+	}
+	return c.ID < other.ID
+}
+
+func parseChangeCursor(value string) (changeCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return changeCursor{}, err
+	}
+	parts := strings.Split(string(raw), ".")
+	if len(parts) != 3 {
+		return changeCursor{}, fmt.Errorf("malformed cursor")
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return changeCursor{}, err
+	}
+	kind, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return changeCursor{}, err
+	}
+	id, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		return changeCursor{}, err
+	}
+	return changeCursor{At: time.Unix(0, nanos), Kind: kind, ID: uint(id)}, nil
+}
+
+// after limits a query of one kind to rows past the cursor, ordered the way the feed is
+func (c changeCursor) after(column string, kind int) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		switch {
+		case kind > c.Kind:
+			tx = tx.Where(column+" >= ?", c.At)
+		case kind < c.Kind:
+			tx = tx.Where(column+" > ?", c.At)
+		default:
+			tx = tx.Where(column+" > ? OR ("+column+" = ? AND id > ?)", c.At, c.At, c.ID)
+		}
+		return tx.Order(column + " ASC").Order("id ASC")
+	}
+}
+
+// changeEntry is one item of the changes feed
+type changeEntry struct {
+	Cursor string      `json:"cursor"` // Resume after this change
+	Entity string      `json:"entity"` // "group" or "round"
+	Action string      `json:"action"` // "created", "updated" or "deleted"
+	ID     uint        `json:"id"`
+	SyncID string      `json:"sync_id"`
+	At     time.Time   `json:"at"`
+	Data   interface{} `json:"data,omitempty"` // The group or round as returned by the other endpoints, absent for deletions
+	cursor changeCursor
+}
+
+type changesResponse struct {
+	Changes []changeEntry `json:"changes"`
+	Next    string        `json:"next"`     // Pass as since for the next page, or to poll for later changes
+	HasMore bool          `json:"has_more"` // More changes are waiting, fetch again right away
+}
+
+// changeAction tells creation from update, rows that were never modified keep equal timestamps
+func changeAction(createdAt, updatedAt time.Time) string {
+	if updatedAt.Sub(createdAt) < time.Millisecond {
+		return "created"
+	}
+	return "updated"
+}
+
+// loadChanges merges the user's changed groups, changed rounds and deletions after the cursor. Each row appears
+// once, at its latest change, so the feed describes the current state rather than every intermediate edit.
+func loadChanges(userID uint, since changeCursor, limit int) ([]changeEntry, bool, error) {
+	var entries []changeEntry
+
+	var groups []WorkingGroup
+	if err := db.Scopes(userGroups(userID), since.after("updated_at", changeKindGroup)).Limit(limit + 1).Find(&groups).Error; err != nil {
+		return nil, false, err
+	}
+	for _, group := range groups {
+		entries = append(entries, changeEntry{
+			Entity: "group",
+			Action: changeAction(group.CreatedAt, group.UpdatedAt),
+			ID:     group.ID,
+			SyncID: group.SyncID,
+			At:     group.UpdatedAt,
+			Data:   group,
+			cursor: changeCursor{At: group.UpdatedAt, Kind: changeKindGroup, ID: group.ID},
+		})
+	}
+
+	var rounds []Round
+	if err := db.Scopes(userRounds(userID), since.after("updated_at", changeKindRound)).Limit(limit + 1).Find(&rounds).Error; err != nil {
+		return nil, false, err
+	}
+	for _, round := range rounds {
+		entries = append(entries, changeEntry{
+			Entity: "round",
+			Action: changeAction(round.CreatedAt, round.UpdatedAt),
+			ID:     round.ID,
+			SyncID: round.SyncID,
+			At:     round.UpdatedAt,
+			Data:   round,
+			cursor: changeCursor{At: round.UpdatedAt, Kind: changeKindRound, ID: round.ID},
+		})
+	}
+
+	var tombstones []SyncTombstone
+	if err := db.Where("user_id = ?", userID).Scopes(since.after("deleted_at", changeKindDeletion)).Limit(limit + 1).Find(&tombstones).Error; err != nil {
+		return nil, false, err
+	}
+	for _, tombstone := range tombstones {
+		entries = append(entries, changeEntry{
+			Entity: tombstone.Entity,
+			Action: "deleted",
+			ID:     tombstone.EntityID,
+			SyncID: tombstone.SyncID,
+			At:     tombstone.DeletedAt,
+			cursor: changeCursor{At: tombstone.DeletedAt, Kind: changeKindDeletion, ID: tombstone.ID},
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].cursor.before(entries[j].cursor) })
+	hasMore := len(entries) > limit
+	if hasMore {
+		entries = entries[:limit]
+	}
+	for i := range entries {
+		entries[i].Cursor = entries[i].cursor.String()
+	}
+	return entries, hasMore, nil
+}
+
+// apiChanges serves GET /api/v1/changes?since=<cursor>&limit=<n>, the user's groups and rounds in the order they
+// last changed, including deletions. Without since the feed starts at the beginning.
+func apiChanges(c *fiber.Ctx) error {
+	var since changeCursor
+	if value := c.Query("since"); value != "" {
+		parsed, err := parseChangeCursor(value)
+		if err != nil {
+			return c.Status(400).JSON(apiError{"invalid cursor"})
+		}
+		since = parsed
+	}
+	limit := c.QueryInt("limit", defaultChangesLimit)
+	if limit < 1 || limit > maxChangesLimit {
+		return c.Status(400).JSON(apiError{fmt.Sprintf("limit must be between 1 and %d", maxChangesLimit)})
+	}
+
+	entries, hasMore, err := loadChanges(currentUserID(c), since, limit)
+	if err != nil {
+		requestLog(c).Println("Error loading changes:", err)
+		return c.Status(500).JSON(apiError{"error loading changes"})
+	}
+
+	response := changesResponse{Changes: entries, Next: c.Query("since"), HasMore: hasMore}
+	if response.Changes == nil {
+		response.Changes = []changeEntry{}
+	}
+	if len(entries) > 0 {
+		response.Next = entries[len(entries)-1].Cursor
+	}
+	return c.JSON(response)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const cliUsage = `Usage: workinghours [-config file] [-db file] <command> [-user name] [group]
+
+Commands:
+  start [group]   Start a round, in the default group when none is named
+  stop [group]    Stop a round, the most recently started one when none is named
+  resume [group]  Reopen a round stopped within RESUME_GRACE, the last stopped one when none is named
+  pause [group]   Pause a running round for a break, the most recently started one when none is named
+  continue [group]
+                  End the pause of a running round
+  status          Show running rounds and today's total
+  rekey           Encrypt the secrets stored in the database with SECRETS_KEY, opening them with -old-key or
+                  -old-key-file when they were encrypted with another key; without SECRETS_KEY, decrypt them
+  serve           Run the web server (the default)
+`
+
+// runCommand runs a terminal subcommand against the configured database and returns the exit code. Rounds go
+// through startRound and stopRound, so the same one-running-round-per-group rule applies as in the web UI.
+func runCommand(args []string) int {
+	command := args[0]
+	if command == "rekey" {
+		return runRekey(args[1:])
+	}
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	username := flags.String("user", "", "Account to act for (default: the first account)")
+	flags.Usage = func() { fmt.Fprint(os.Stderr, cliUsage) }
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	groupName := strings.TrimSpace(strings.Join(flags.Args(), " "))
+
+	var user User
+	query := db.Order("id ASC")
+	if *username != "" {
+		query = db.Where("username = ?", *username)
+	}
+	if err := query.First(&user).Error; err != nil {
+		if *username != "" {
+			fmt.Fprintf(os.Stderr, "No account named %q\n", *username)
+		} else {
+			fmt.Fprintln(os.Stderr, "No account yet; finish the setup in the web UI first")
+		}
+		return 1
+	}
+	client := ClientInfo{UserID: user.ID, Name: "cli", UserAgent: "workinghours cli", RemoteIP: "local", Source: sourceCLI}
+
+	switch command {
+	case "start":
+		group, err := smsGroup(user.ID, groupName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, smsGroupError(user.ID, groupName))
+			return 1
+		}
+		round, err := startRound(group.ID, client)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not start %s: %v\n", group.Name, err)
+			return 1
+		}
+		fmt.Printf("Started %s at %s\n", group.Name, round.StartTime.Format("15:04"))
+	case "stop":
+		group, err := smsRunningGroup(user.ID, groupName)
+		if err != nil {
+			if groupName != "" {
+				fmt.Fprintln(os.Stderr, smsGroupError(user.ID, groupName))
+			} else {
+				fmt.Fprintln(os.Stderr, "Nothing is running")
+			}
+			return 1
+		}
+		round, err := stopRound(group.ID, client)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not stop %s: %v\n", group.Name, err)
+			return 1
+		}
+		if round.Discarded {
+			fmt.Printf("Discarded %s after %s, too short to count\n", group.Name, formatDuration(roundWorkedSeconds(round, *round.EndTime)))
+		} else {
+			fmt.Printf("Stopped %s after %s\n", group.Name, formatDuration(roundWorkedSeconds(round, *round.EndTime)))
+		}
+	case "resume":
+		group, err := lastStoppedGroup(user.ID, groupName)
+		if err != nil {
+			if groupName != "" {
+				fmt.Fprintln(os.Stderr, smsGroupError(user.ID, groupName))
+			} else {
+				fmt.Fprintln(os.Stderr, "Nothing was stopped yet")
+			}
+			return 1
+		}
+		round, err := resumeRound(group.ID, client)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not resume %s: %v\n", group.Name, err)
+			return 1
+		}
+		fmt.Printf("Resumed %s, running since %s\n", group.Name, round.StartTime.Format("15:04"))
+	case "pause", "continue":
+		group, err := smsRunningGroup(user.ID, groupName)
+		if err != nil {
+			if groupName != "" {
+				fmt.Fprintln(os.Stderr, smsGroupError(user.ID, groupName))
+			} else {
+				fmt.Fprintln(os.Stderr, "Nothing is running")
+			}
+			return 1
+		}
+		if command == "pause" {
+			if _, err := pauseRound(group.ID, client); err != nil {
+				fmt.Fprintf(os.Stderr, "Could not pause %s: %v\n", group.Name, err)
+				return 1
+			}
+			fmt.Printf("Paused %s at %s\n", group.Name, time.Now().Format("15:04"))
+			break
+		}
+		round, err := continueRound(group.ID, client)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not continue %s: %v\n", group.Name, err)
+			return 1
+		}
+		fmt.Printf("Continued %s, %s tracked so far\n", group.Name, formatDuration(roundWorkedSeconds(round, time.Now())))
+	case "status":
+		var running []Round
+		if err := db.Preload("WorkingGroup").Scopes(userRounds(user.ID)).Where("end_time IS NULL").
+			Order("start_time ASC").Find(&running).Error; err != nil {
+			fmt.Fprintln(os.Stderr, "Error loading rounds:", err)
+			return 1
+		}
+		if len(running) == 0 {
+			fmt.Println("Nothing is running")
+		}
+		for _, round := range running {
+			paused := ""
+			if round.PausedAt != nil {
+				paused = ", paused since " + round.PausedAt.Format("15:04")
+			}
+			fmt.Printf("%s running since %s (%s)%s\n", round.WorkingGroup.Name, round.StartTime.Format("15:04"),
+				formatDuration(roundWorkedSeconds(round, time.Now())), paused)
+		}
+		fmt.Printf("Today: %s\n", formatDuration(todaySeconds(user.ID)))
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", command, cliUsage)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // TIMEZONE must work in minimal containers without /usr/share/zoneinfo
+
+	"gopkg.in/yaml.v3"
+)
+
+// Authentication modes
+const (
+	authModePassword = "password" // Username and password, plus passkeys, single sign-on and Basic auth when configured
+	authModeOIDC     = "oidc"     // Single sign-on (and passkeys) only, the password form is disabled
+	authModeBasic    = "basic"    // HTTP Basic auth with AUTH_USER and AUTH_PASS, browsers get the native prompt
+)
+
+// defaultConfigFile is loaded when present and no other file is given
+const defaultConfigFile = "workinghours.yaml"
+
+// Config holds every setting of the app. Values come from the YAML config file and are overridden by the
+// environment variable named in the env tag, so existing environment-only deployments keep working.
+type Config struct {
+	Listen       string `yaml:"listen" env:"SERVER_ADDR"`               // host:port, or unix:/path/to.sock
+	SocketMode   string `yaml:"socket_mode" env:"SERVER_SOCKET_MODE"`   // Octal permissions of a Unix socket
+	SocketGroup  string `yaml:"socket_group" env:"SERVER_SOCKET_GROUP"` // Group a Unix socket is handed to, e.g. www-data
+	Timezone     string `yaml:"timezone" env:"TIMEZONE"`                // IANA name, e.g. Europe/Berlin; empty uses the system zone
+	DefaultGroup string `yaml:"default_group" env:"DEFAULT_GROUP"`      // Created for new accounts and selected when no group is given
+	BasePath     string `yaml:"base_path" env:"BASE_PATH"`              // Prefix the app is served under behind a proxy, e.g. /hours
+
+	TLS struct {
+		CertFile string `yaml:"cert_file" env:"TLS_CERT_FILE"` // PEM certificate chain, reloaded when the file changes
+		KeyFile  string `yaml:"key_file" env:"TLS_KEY_FILE"`
+		ACME     struct {
+			Domains   []string `yaml:"domains" env:"ACME_DOMAINS"` // Hostnames to get Let's Encrypt certificates for
+			Email     string   `yaml:"email" env:"ACME_EMAIL"`
+			CacheDir  string   `yaml:"cache_dir" env:"ACME_CACHE_DIR"`
+			Directory string   `yaml:"directory" env:"ACME_DIRECTORY"` // ACME server, default Let's Encrypt production
+		} `yaml:"acme"`
+		HTTPAddr string `yaml:"http_addr" env:"TLS_HTTP_ADDR"` // Plain HTTP listener that redirects to HTTPS, e.g. ":80"
+	} `yaml:"tls"`
+
+	Database struct {
+		Driver string `yaml:"driver" env:"DB_DRIVER"`
+		DSN    string `yaml:"dsn" env:"DB_DSN"`
+		SQLite struct {
+			Path        string `yaml:"path" env:"SQLITE_PATH"`
+			JournalMode string `yaml:"journal_mode" env:"SQLITE_JOURNAL_MODE"`
+			BusyTimeout string `yaml:"busy_timeout" env:"SQLITE_BUSY_TIMEOUT"`
+			Synchronous string `yaml:"synchronous" env:"SQLITE_SYNCHRONOUS"`
+			ForeignKeys string `yaml:"foreign_keys" env:"SQLITE_FOREIGN_KEYS"`
+			TxLock      string `yaml:"txlock" env:"SQLITE_TXLOCK"`
+		} `yaml:"sqlite"`
+		SlowQuery string `yaml:"slow_query" env:"DB_SLOW_QUERY"` // Queries taking longer are logged, e.g. 100ms; empty times nothing
+	} `yaml:"database"`
+
+	Auth struct {
+		Mode             string `yaml:"mode" env:"AUTH_MODE"`
+		User             string `yaml:"user" env:"AUTH_USER"`
+		Pass             string `yaml:"pass" env:"AUTH_PASS"`
+		SessionLifetime  string `yaml:"session_lifetime" env:"SESSION_LIFETIME"`
+		RememberLifetime string `yaml:"remember_lifetime" env:"SESSION_REMEMBER_LIFETIME"`
+		// Failed password sign-ins in a row before the account is locked for Lockout, doubled with every further
+		// failure up to MaxLockout; 0 turns lockout off. The address they come from gets four times as many.
+		MaxLoginAttempts string `yaml:"max_login_attempts" env:"LOGIN_MAX_ATTEMPTS"`
+		Lockout          string `yaml:"lockout" env:"LOGIN_LOCKOUT"`
+		MaxLockout       string `yaml:"max_lockout" env:"LOGIN_MAX_LOCKOUT"`
+		OIDC             struct {
+			Issuer       string `yaml:"issuer" env:"OIDC_ISSUER"`
+			ClientID     string `yaml:"client_id" env:"OIDC_CLIENT_ID"`
+			ClientSecret string `yaml:"client_secret" env:"OIDC_CLIENT_SECRET"`
+			RedirectURL  string `yaml:"redirect_url" env:"OIDC_REDIRECT_URL"`
+			GroupsClaim  string `yaml:"groups_claim" env:"OIDC_GROUPS_CLAIM"`
+			AdminGroup   string `yaml:"admin_group" env:"OIDC_ADMIN_GROUP"`
+		} `yaml:"oidc"`
+		WebAuthn struct {
+			RPID    string   `yaml:"rp_id" env:"WEBAUTHN_RP_ID"`
+			Origins []string `yaml:"origins" env:"WEBAUTHN_ORIGINS"`
+		} `yaml:"webauthn"`
+	} `yaml:"auth"`
+
+	// Features switches optional parts of the app off; disabled features have no routes and no UI
+	Features struct {
+		Passkeys    bool `yaml:"passkeys" env:"FEATURE_PASSKEYS"`
+		Grafana     bool `yaml:"grafana" env:"FEATURE_GRAFANA"`
+		Voice       bool `yaml:"voice" env:"FEATURE_VOICE"`
+		ActionLinks bool `yaml:"action_links" env:"FEATURE_ACTION_LINKS"`
+		APIDocs     bool `yaml:"api_docs" env:"FEATURE_API_DOCS"`
+		Profiling   bool `yaml:"profiling" env:"FEATURE_PROFILING"` // pprof and expvar for admins, off by default
+	} `yaml:"features"`
+	ProfilingPrefix string `yaml:"profiling_prefix" env:"PROFILING_PREFIX"` // Put in front of /debug/pprof and /debug/vars
+
+	RateLimit struct {
+		Write string `yaml:"write" env:"RATE_LIMIT_WRITE"`
+		API   string `yaml:"api" env:"RATE_LIMIT_API"`
+	} `yaml:"rate_limit"`
+
+	// Money is how amounts earned at hourly rates are shown, see moneyformat.go
+	Money struct {
+		Locale  string            `yaml:"locale" env:"MONEY_LOCALE"`   // Number format: en (1,234.50), de (1.234,50), fr (1 234,50), de-CH (1'234.50) or plain
+		Display string            `yaml:"display" env:"MONEY_DISPLAY"` // code (1,234.50 EUR) or symbol (€1,234.50)
+		Symbols map[string]string `yaml:"symbols" env:"MONEY_SYMBOLS"` // Added to and replacing the built-in symbols, e.g. CHF=Fr.
+	} `yaml:"money"`
+
+	ActionLinkSecret string   `yaml:"action_link_secret" env:"ACTION_LINK_SECRET"`
+	ExtensionOrigins []string `yaml:"extension_origins" env:"EXTENSION_ORIGINS"`
+
+	// Key secrets kept in the database are encrypted with, 32 bytes as base64 or hex, or a file holding it; see rekey
+	SecretsKey     string `yaml:"secrets_key" env:"SECRETS_KEY"`
+	SecretsKeyFile string `yaml:"secrets_key_file" env:"SECRETS_KEY_FILE"`
+
+	Attachments struct {
+		Dir string `yaml:"dir" env:"ATTACHMENTS_DIR"`
+		S3  struct {
+			Bucket    string `yaml:"bucket" env:"ATTACHMENTS_S3_BUCKET"`
+			Endpoint  string `yaml:"endpoint" env:"ATTACHMENTS_S3_ENDPOINT"`
+			Region    string `yaml:"region" env:"ATTACHMENTS_S3_REGION"`
+			AccessKey string `yaml:"access_key" env:"ATTACHMENTS_S3_ACCESS_KEY"`
+			SecretKey string `yaml:"secret_key" env:"ATTACHMENTS_S3_SECRET_KEY"`
+		} `yaml:"s3"`
+	} `yaml:"attachments"`
+
+	ExportDir string `yaml:"export_dir" env:"EXPORT_DIR"` // Background exports, kept for a day
+	BackupDir string `yaml:"backup_dir" env:"BACKUP_DIR"` // Where backups made outside the app land, for /admin
+	// How long the rounds of a reset group can be brought back, e.g. 15m; the snapshot stays in the report archive
+	ResetUndoWindow string `yaml:"reset_undo_window" env:"RESET_UNDO_WINDOW"`
+	// How long after a stop the round can be resumed instead of starting a new one, e.g. 5m
+	ResumeGrace string `yaml:"resume_grace" env:"RESUME_GRACE"`
+	// Rounds stopped sooner than this after their start, e.g. 30s, were most likely started by accident; 0 keeps them
+	MinRoundDuration string `yaml:"min_round_duration" env:"MIN_ROUND_DURATION"`
+	ShortRounds      string `yaml:"short_rounds" env:"SHORT_ROUNDS"` // flag (for review) or discard
+
+	Notify struct {
+		SummaryTime string `yaml:"summary_time" env:"SUMMARY_TIME"`
+		Email       struct {
+			SMTPHost string   `yaml:"smtp_host" env:"SMTP_HOST"`
+			SMTPPort string   `yaml:"smtp_port" env:"SMTP_PORT"`
+			SMTPUser string   `yaml:"smtp_user" env:"SMTP_USER"`
+			SMTPPass string   `yaml:"smtp_pass" env:"SMTP_PASS"`
+			From     string   `yaml:"from" env:"SMTP_FROM"`
+			To       []string `yaml:"to" env:"NOTIFY_EMAIL_TO"`
+		} `yaml:"email"`
+		Telegram struct {
+			BotToken string `yaml:"bot_token" env:"TELEGRAM_BOT_TOKEN"`
+			ChatID   string `yaml:"chat_id" env:"TELEGRAM_CHAT_ID"`
+		} `yaml:"telegram"`
+		WebhookURL string `yaml:"webhook_url" env:"NOTIFY_WEBHOOK_URL"`
+		SlackURL   string `yaml:"slack_webhook_url" env:"SLACK_WEBHOOK_URL"`
+		DiscordURL string `yaml:"discord_webhook_url" env:"DISCORD_WEBHOOK_URL"`
+		Matrix     struct {
+			Homeserver  string `yaml:"homeserver" env:"MATRIX_HOMESERVER"`
+			AccessToken string `yaml:"access_token" env:"MATRIX_ACCESS_TOKEN"`
+			RoomID      string `yaml:"room_id" env:"MATRIX_ROOM_ID"`
+		} `yaml:"matrix"`
+		Ntfy struct {
+			URL   string `yaml:"url" env:"NTFY_URL"`
+			Topic string `yaml:"topic" env:"NTFY_TOPIC"`
+			Token string `yaml:"token" env:"NTFY_TOKEN"` // Access token for protected topics
+		} `yaml:"ntfy"`
+		Gotify struct {
+			URL   string `yaml:"url" env:"GOTIFY_URL"`
+			Token string `yaml:"token" env:"GOTIFY_TOKEN"` // Application token
+		} `yaml:"gotify"`
+		// Priorities maps alert types to min, low, default, high or urgent for channels that have priorities
+		Priorities     map[string]string `yaml:"priorities" env:"NOTIFY_PRIORITIES"`
+		WebPushSubject string            `yaml:"webpush_subject" env:"WEBPUSH_SUBJECT"`
+	} `yaml:"notify"`
+
+	Influx struct {
+		URL      string `yaml:"url" env:"INFLUX_URL"`
+		Token    string `yaml:"token" env:"INFLUX_TOKEN"`
+		User     string `yaml:"user" env:"INFLUX_USER"`
+		Pass     string `yaml:"pass" env:"INFLUX_PASS"`
+		Interval string `yaml:"interval" env:"INFLUX_INTERVAL"`
+	} `yaml:"influx"`
+
+	// Tracing sends OpenTelemetry spans of requests, queries and template rendering to an OTLP/HTTP collector
+	Tracing struct {
+		Endpoint    string `yaml:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"` // e.g. http://localhost:4318; empty disables tracing
+		ServiceName string `yaml:"service_name" env:"OTEL_SERVICE_NAME"`
+	} `yaml:"tracing"`
+
+	// Sync exchanges groups and rounds with another instance, see sync.go
+	Sync struct {
+		PeerURL   string `yaml:"peer_url" env:"SYNC_PEER_URL"`
+		PeerToken string `yaml:"peer_token" env:"SYNC_PEER_TOKEN"` // API token with control scope on the peer
+		User      string `yaml:"user" env:"SYNC_USER"`             // Local account whose data is synced, default the first one
+		Interval  string `yaml:"interval" env:"SYNC_INTERVAL"`
+	} `yaml:"sync"`
+
+	Inbound struct {
+		MailgunSigningKey string `yaml:"mailgun_signing_key" env:"MAILGUN_SIGNING_KEY"`
+		MailgunAddress    string `yaml:"mailgun_address" env:"MAILGUN_ADDRESS"` // Route address, users mail secret hours+<key>@ variants
+		TwilioAuthToken   string `yaml:"twilio_auth_token" env:"TWILIO_AUTH_TOKEN"`
+		TwilioWebhookURL  string `yaml:"twilio_webhook_url" env:"TWILIO_WEBHOOK_URL"`
+	} `yaml:"inbound"`
+}
+
+// cfg is the loaded configuration, set once at startup before anything else runs
+var cfg = defaultConfig()
+
+func defaultConfig() *Config {
+	config := &Config{
+		Listen:       ":3000",
+		SocketMode:   "0660",
+		DefaultGroup: "General",
+	}
+	config.Database.Driver = "sqlite"
+	config.Database.SQLite.JournalMode = "WAL"
+	config.Database.SQLite.BusyTimeout = "5000"
+	config.Database.SQLite.Synchronous = "NORMAL"
+	config.Database.SQLite.ForeignKeys = "on"
+	config.Database.SQLite.TxLock = "immediate"
+	config.Auth.Mode = authModePassword
+	config.Auth.SessionLifetime = "12h"
+	config.Auth.RememberLifetime = "720h"
+	config.Auth.MaxLoginAttempts = "5"
+	config.Auth.Lockout = "1m"
+	config.Auth.MaxLockout = "1h"
+	config.Auth.OIDC.GroupsClaim = "groups"
+	config.Features.Passkeys = true
+	config.Features.Grafana = true
+	config.Features.Voice = true
+	config.Features.ActionLinks = true
+	config.Features.APIDocs = true
+	config.RateLimit.Write = "30/1m"
+	config.RateLimit.API = "300/1m"
+	config.Money.Locale = "en"
+	config.Money.Display = moneyDisplayCode
+	config.Money.Symbols = map[string]string{}
+	config.Attachments.Dir = "attachments"
+	config.Attachments.S3.Region = "us-east-1"
+	config.ExportDir = "exports"
+	config.ResetUndoWindow = "15m"
+	config.ResumeGrace = "5m"
+	config.MinRoundDuration = "0"
+	config.ShortRounds = shortRoundsFlag
+	config.Tracing.ServiceName = "workinghours"
+	config.Notify.SummaryTime = "00:05"
+	config.Notify.Email.SMTPPort = "587"
+	config.Notify.Ntfy.URL = "https://ntfy.sh"
+	config.Notify.Priorities = map[string]string{
+		alertBudget:  "high",
+		alertTarget:  "default",
+		alertPolicy:  "high",
+		alertSummary: "low",
+	}
+	config.Influx.Interval = "15m"
+	config.Sync.Interval = "5m"
+	config.TLS.ACME.CacheDir = "certs"
+	return config
+}
+
+// loadConfig reads the config file, if any, and applies environment overrides. An explicitly named
+// file must exist; the default workinghours.yaml is optional.
+func loadConfig(path string) (*Config, error) {
+	config := defaultConfig()
+
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfigFile
+	}
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		log.Printf("Loaded configuration from %s", path)
+	case explicit || !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+
+	if err := applyEnvOverrides(reflect.ValueOf(config).Elem()); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	// "hours", "/hours/" and "/hours" all mean /hours; "/" means no prefix
+	if config.BasePath = strings.Trim(config.BasePath, "/"); config.BasePath != "" {
+		config.BasePath = "/" + config.BasePath
+	}
+	if config.ProfilingPrefix = strings.Trim(config.ProfilingPrefix, "/"); config.ProfilingPrefix != "" {
+		config.ProfilingPrefix = "/" + config.ProfilingPrefix
+	}
+	return config, nil
+}
+
+// applyEnvOverrides sets every field whose env variable is set and not empty
+func applyEnvOverrides(v reflect.Value) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := applyEnvOverrides(field); err != nil {
+				return err
+			}
+			continue
+		}
+		name := v.Type().Field(i).Tag.Get("env")
+		value := strings.TrimSpace(os.Getenv(name))
+		if name == "" || value == "" {
+			continue
+		}
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Bool:
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("%s: expected true or false, got %q", name, value)
+			}
+			field.SetBool(enabled)
+		case reflect.Slice:
+			var items []string
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			field.Set(reflect.ValueOf(items))
+		case reflect.Map:
+			// "key=value,key=value" is merged into the defaults and the file
+			for _, item := range strings.Split(value, ",") {
+				key, mapped, found := strings.Cut(item, "=")
+				if !found {
+					return fmt.Errorf("%s: expected key=value pairs, got %q", name, item)
+				}
+				field.SetMapIndex(reflect.ValueOf(strings.TrimSpace(key)), reflect.ValueOf(strings.TrimSpace(mapped)))
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Config) validate() error {
+	switch c.Auth.Mode {
+	case authModePassword:
+	case authModeOIDC:
+		if c.Auth.OIDC.Issuer == "" || c.Auth.OIDC.ClientID == "" {
+			return fmt.Errorf("auth mode %q needs the OIDC issuer and client ID", c.Auth.Mode)
+		}
+	case authModeBasic:
+		if c.Auth.User == "" || c.Auth.Pass == "" {
+			return fmt.Errorf("auth mode %q needs AUTH_USER and AUTH_PASS", c.Auth.Mode)
+		}
+	default:
+		return fmt.Errorf("unknown auth mode %q, use %s, %s or %s", c.Auth.Mode, authModePassword, authModeOIDC, authModeBasic)
+	}
+	if attempts, err := strconv.Atoi(c.Auth.MaxLoginAttempts); err != nil || attempts < 0 {
+		return fmt.Errorf("auth max_login_attempts %q is not a number (0 turns lockout off)", c.Auth.MaxLoginAttempts)
+	}
+	lockout, err := time.ParseDuration(c.Auth.Lockout)
+	if err != nil || lockout <= 0 {
+		return fmt.Errorf("auth lockout %q is not a duration like 1m", c.Auth.Lockout)
+	}
+	if maxLockout, err := time.ParseDuration(c.Auth.MaxLockout); err != nil || maxLockout < lockout {
+		return fmt.Errorf("auth max_lockout %q is not a duration like 1h, at least lockout", c.Auth.MaxLockout)
+	}
+	for alertType, level := range c.Notify.Priorities {
+		if _, ok := ntfyPriorities[strings.ToLower(level)]; !ok {
+			return fmt.Errorf("notify priority %q for %s, use min, low, default, high or urgent", level, alertType)
+		}
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return errors.New("tls needs both cert_file and key_file")
+	}
+	if c.TLS.CertFile != "" && len(c.TLS.ACME.Domains) > 0 {
+		return errors.New("use either a TLS certificate or ACME domains, not both")
+	}
+	if c.tlsEnabled() && strings.HasPrefix(c.Listen, unixSocketPrefix) {
+		return errors.New("TLS cannot be used on a Unix socket; let the proxy terminate it")
+	}
+	if strings.ContainsAny(c.BasePath, "?#\"' ") {
+		return fmt.Errorf("base_path %q must be a plain URL path like /hours", c.BasePath)
+	}
+	if strings.ContainsAny(c.ProfilingPrefix, "?#\"' :*") {
+		return fmt.Errorf("profiling_prefix %q must be a plain URL path like /internal", c.ProfilingPrefix)
+	}
+	if _, err := strconv.ParseUint(c.SocketMode, 8, 32); err != nil {
+		return fmt.Errorf("socket_mode %q is not an octal mode like 0660", c.SocketMode)
+	}
+	if c.Database.SlowQuery != "" {
+		if threshold, err := time.ParseDuration(c.Database.SlowQuery); err != nil || threshold <= 0 {
+			return fmt.Errorf("database slow_query %q is not a duration like 100ms", c.Database.SlowQuery)
+		}
+	}
+	if window, err := time.ParseDuration(c.ResetUndoWindow); err != nil || window < 0 {
+		return fmt.Errorf("reset_undo_window %q is not a duration like 15m (0 turns undo off)", c.ResetUndoWindow)
+	}
+	if grace, err := time.ParseDuration(c.ResumeGrace); err != nil || grace < 0 {
+		return fmt.Errorf("resume_grace %q is not a duration like 5m (0 turns resuming off)", c.ResumeGrace)
+	}
+	if minimum, err := time.ParseDuration(c.MinRoundDuration); err != nil || minimum < 0 {
+		return fmt.Errorf("min_round_duration %q is not a duration like 30s (0 keeps every round)", c.MinRoundDuration)
+	}
+	if c.ShortRounds != shortRoundsFlag && c.ShortRounds != shortRoundsDiscard {
+		return fmt.Errorf("short_rounds must be %s or %s, not %q", shortRoundsFlag, shortRoundsDiscard, c.ShortRounds)
+	}
+	if strings.TrimSpace(c.DefaultGroup) == "" {
+		return errors.New("default_group cannot be empty")
+	}
+	return c.validateMoneyConfig()
+}
+
+func (c *Config) tlsEnabled() bool {
+	return c.TLS.CertFile != "" || len(c.TLS.ACME.Domains) > 0
+}
+
+// applyTimezone makes the configured zone the local time of the process, which day boundaries are computed in
+func applyTimezone() error {
+	if cfg.Timezone == "" {
+		return nil
+	}
+	location, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return fmt.Errorf("timezone: %w", err)
+	}
+	time.Local = location
+	return nil
+}
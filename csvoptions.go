@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CSV field delimiters and decimal separators, by the names used in forms, query strings and settings
+var (
+	csvDelimiters     = map[string]rune{"comma": ',', "semicolon": ';', "tab": '\t'}
+	decimalSeparators = map[string]string{"point": ".", "comma": ","}
+)
+
+// Settings keys of the instance-wide CSV format, used when an export doesn't choose one
+const (
+	csvDelimiterKey = "export.csv_delimiter"
+	csvDecimalKey   = "export.csv_decimal"
+	csvExcelSafeKey = "export.csv_excel_safe"
+)
+
+// csvOptions is how CSV exports separate fields and write numbers. Spreadsheets set up for most of Europe expect
+// semicolon-separated fields and "7,50", and turn "7.50" into a date or text.
+//
+// ExcelSafe ("on" or "off") guards against formula injection: Excel and LibreOffice run a cell starting with =, +, -
+// or @ as a formula, so a note like "=HYPERLINK(...)" would become a live link. Text typed in by users is then
+// prefixed with an apostrophe, and its line breaks are written the same way everywhere.
+//
+// Clock is the time zone of the start and end times: home, or local for where each round was recorded.
+type csvOptions struct {
+	Delimiter string // comma, semicolon or tab
+	Decimal   string // point or comma
+	ExcelSafe string // on or off
+	Clock     string // home or local
+}
+
+// defaultCSVOptions is the instance-wide CSV format: comma-separated, decimal points and Excel-safe unless an admin
+// changed it
+func defaultCSVOptions() csvOptions {
+	return csvOptions{
+		Delimiter: getSetting(csvDelimiterKey, "comma"),
+		Decimal:   getSetting(csvDecimalKey, "point"),
+		ExcelSafe: getSetting(csvExcelSafeKey, "on"),
+	}
+}
+
+// resolve fills in what an export left open from the instance default and checks the result. Choosing only a decimal
+// comma also switches to semicolons, so numbers don't contain the delimiter.
+func (o csvOptions) resolve() (csvOptions, error) {
+	defaults := defaultCSVOptions()
+	if o.Decimal == "" {
+		o.Decimal = defaults.Decimal
+	}
+	if o.Delimiter == "" {
+		o.Delimiter = defaults.Delimiter
+		if o.Decimal == "comma" && o.Delimiter == "comma" {
+			o.Delimiter = "semicolon"
+		}
+	}
+	if o.ExcelSafe == "" {
+		o.ExcelSafe = defaults.ExcelSafe
+	}
+	clock, err := parseClock(o.Clock)
+	if err != nil {
+		return o, err
+	}
+	o.Clock = clock
+	if _, ok := csvDelimiters[o.Delimiter]; !ok {
+		return o, fmt.Errorf("unknown CSV delimiter %q", o.Delimiter)
+	}
+	if _, ok := decimalSeparators[o.Decimal]; !ok {
+		return o, fmt.Errorf("unknown decimal separator %q", o.Decimal)
+	}
+	if o.ExcelSafe != "on" && o.ExcelSafe != "off" {
+		return o, fmt.Errorf("excel_safe must be on or off, not %q", o.ExcelSafe)
+	}
+	return o, nil
+}
+
+// csvOptionsFromQuery reads ?delimiter=, ?decimal=, ?excel_safe= and ?clock= of a download link
+func csvOptionsFromQuery(c *fiber.Ctx) (csvOptions, error) {
+	return csvOptions{
+		Delimiter: c.Query("delimiter"),
+		Decimal:   c.Query("decimal"),
+		ExcelSafe: c.Query("excel_safe"),
+		Clock:     c.Query("clock"),
+	}.resolve()
+}
+
+// newWriter is a CSV writer using the chosen delimiter. Excel-safe files end their lines with CRLF, as RFC 4180 and
+// Excel expect.
+func (o csvOptions) newWriter(w io.Writer) *csv.Writer {
+	writer := csv.NewWriter(w)
+	if delimiter, ok := csvDelimiters[o.Delimiter]; ok {
+		writer.Comma = delimiter
+	}
+	writer.UseCRLF = o.ExcelSafe == "on"
+	return writer
+}
+
+// number formats v with two decimals and the chosen decimal separator
+func (o csvOptions) number(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 2, 64)
+	if separator, ok := decimalSeparators[o.Decimal]; ok && separator != "." {
+		s = strings.Replace(s, ".", separator, 1)
+	}
+	return s
+}
+
+// text is a cell of user-provided text such as a group name or note. Excel-safe files get "\n" for every line break
+// (written as CRLF by the writer, where a lone CR would be dropped) and an apostrophe before text that a spreadsheet
+// would read as a formula; the apostrophe itself isn't shown.
+func (o csvOptions) text(s string) string {
+	if o.ExcelSafe != "on" {
+		return s
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	if s != "" && strings.ContainsRune("=+-@\t", rune(s[0])) {
+		s = "'" + s
+	}
+	return s
+}
+
+// csvOptionChoices lists the choices of the export forms, marking the current ones
+func csvOptionChoices(current csvOptions) fiber.Map {
+	option := func(value, label string, selected bool) fiber.Map {
+		return fiber.Map{"Value": value, "Label": label, "Selected": selected}
+	}
+	return fiber.Map{
+		"Delimiters": []fiber.Map{
+			option("comma", "Comma ( , )", current.Delimiter == "comma"),
+			option("semicolon", "Semicolon ( ; ) for European Excel", current.Delimiter == "semicolon"),
+			option("tab", "Tab", current.Delimiter == "tab"),
+		},
+		"Decimals": []fiber.Map{
+			option("point", "Decimal point (7.50)", current.Decimal == "point"),
+			option("comma", "Decimal comma (7,50)", current.Decimal == "comma"),
+		},
+		"ExcelSafe": []fiber.Map{
+			option("on", "Excel-safe text", current.ExcelSafe == "on"),
+			option("off", "Text as entered", current.ExcelSafe == "off"),
+		},
+		"Clocks": []fiber.Map{
+			option(clockHome, "Home time", current.Clock != clockLocal),
+			option(clockLocal, "Time where I was", current.Clock == clockLocal),
+		},
+	}
+}
+
+// saveCSVOptionsHandler changes the instance-wide CSV format
+func saveCSVOptionsHandler(c *fiber.Ctx) error {
+	options, err := csvOptions{
+		Delimiter: c.FormValue("delimiter"),
+		Decimal:   c.FormValue("decimal"),
+		ExcelSafe: c.FormValue("excel_safe"),
+	}.resolve()
+	if err != nil {
+		return c.Status(400).SendString(err.Error())
+	}
+	for key, value := range map[string]string{
+		csvDelimiterKey: options.Delimiter,
+		csvDecimalKey:   options.Decimal,
+		csvExcelSafeKey: options.ExcelSafe,
+	} {
+		if err := setSetting(key, value); err != nil {
+			requestLog(c).Println("Error saving CSV format:", err)
+			return c.Status(500).SendString("Error saving CSV format")
+		}
+	}
+	recordAudit("settings.export", clientInfoFromRequest(c), 0, nil,
+		fmt.Sprintf("Set default CSV format to %s-separated with decimal %s, Excel-safe %s", options.Delimiter, options.Decimal, options.ExcelSafe))
+	return c.Redirect("/exports", fiber.StatusSeeOther)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"expvar"
+	"runtime"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/gofiber/fiber/v2/middleware/pprof"
+)
+
+// startedAt is when the process started, reported as uptime in /debug/vars
+var startedAt = time.Now()
+
+// mountProfiling serves net/http/pprof under <prefix>/debug/pprof/ and expvar under <prefix>/debug/vars, for admins
+// only. Both are off unless the profiling feature is enabled, as profiles can reveal request data.
+func mountProfiling(app *fiber.App, admin fiber.Handler) {
+	expvar.Publish("uptime_seconds", expvar.Func(func() interface{} {
+		return int64(time.Since(startedAt).Seconds())
+	}))
+	expvar.Publish("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+	expvar.Publish("db", expvar.Func(func() interface{} {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil
+		}
+		return sqlDB.Stats()
+	}))
+	expvar.Publish("export_queue", expvar.Func(func() interface{} {
+		return len(exportQueue)
+	}))
+	if slowQueryThreshold > 0 {
+		expvar.Publish("db_queries", expvar.Func(func() interface{} {
+			operations, _ := queryStatistics()
+			return operations
+		}))
+	}
+
+	debug := app.Group(cfg.ProfilingPrefix+"/debug", admin)
+	debug.Get("/vars", adaptor.HTTPHandler(expvar.Handler()))
+	debug.Use(pprof.New(pprof.Config{Prefix: cfg.ProfilingPrefix}))
+}
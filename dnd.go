@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// dndSettingKey stores the do-not-disturb windows, one per line, as typed on the notification settings page
+const dndSettingKey = "notify.dnd"
+
+// dndWindow is a time of the week when notifications are held back, e.g. "Mon-Fri 19:00-07:00". A window ending at
+// or before its start runs past midnight into the next day.
+type dndWindow struct {
+	days       [7]bool // Indexed by time.Weekday, the days the window starts on
+	start, end int     // Minutes after midnight; end 1440 is the end of the day
+}
+
+var dndDayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseDNDClock reads "07:00" as minutes after midnight; "24:00" is allowed as an end
+func parseDNDClock(value string) (int, error) {
+	var hours, minutes int
+	if _, err := fmt.Sscanf(value, "%d:%d", &hours, &minutes); err != nil || len(value) != 5 ||
+		minutes < 0 || minutes > 59 || hours < 0 || hours > 24 || (hours == 24 && minutes > 0) {
+		return 0, fmt.Errorf("%q is not a time like 07:00", value)
+	}
+	return hours*60 + minutes, nil
+}
+
+// parseDNDDays reads "Mon", "Mon-Fri", "Sat,Sun" or "daily"; a range may wrap, as in "Fri-Mon"
+func parseDNDDays(value string) ([7]bool, error) {
+	var days [7]bool
+	if strings.EqualFold(value, "daily") {
+		for i := range days {
+			days[i] = true
+		}
+		return days, nil
+	}
+	for _, part := range strings.Split(value, ",") {
+		from, to, isRange := strings.Cut(strings.ToLower(strings.TrimSpace(part)), "-")
+		first, ok := dndDayNames[from]
+		if !ok {
+			return days, fmt.Errorf("%q is not a day like Mon", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = dndDayNames[to]; !ok {
+				return days, fmt.Errorf("%q is not a day like Fri", to)
+			}
+		}
+		for day := first; ; day = (day + 1) % 7 {
+			days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseDNDWindows reads one window per line: days, then optionally a time range, e.g. "Mon-Fri 19:00-07:00" or
+// "Sat-Sun" for whole days. Empty lines are skipped.
+func parseDNDWindows(text string) ([]dndWindow, error) {
+	var windows []dndWindow
+	for i, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("line %d: write days and a time range, like Mon-Fri 19:00-07:00", i+1)
+		}
+		days, err := parseDNDDays(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		window := dndWindow{days: days, start: 0, end: 24 * 60}
+		if len(fields) == 2 {
+			from, to, ok := strings.Cut(fields[1], "-")
+			if !ok {
+				return nil, fmt.Errorf("line %d: %q is not a time range like 19:00-07:00", i+1, fields[1])
+			}
+			if window.start, err = parseDNDClock(from); err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			if window.end, err = parseDNDClock(to); err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			if window.start == 24*60 {
+				return nil, fmt.Errorf("line %d: a window can't start at 24:00", i+1)
+			}
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+// endAfter returns when the window covering t ends, and false when it doesn't cover t. Windows that started on the
+// day before and run past midnight count too.
+func (w dndWindow) endAfter(t time.Time) (time.Time, bool) {
+	for back := 0; back <= 1; back++ {
+		day := t.AddDate(0, 0, -back)
+		if !w.days[day.Weekday()] {
+			continue
+		}
+		midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, t.Location())
+		start := midnight.Add(time.Duration(w.start) * time.Minute)
+		end := midnight.Add(time.Duration(w.end) * time.Minute)
+		if w.end <= w.start {
+			end = end.AddDate(0, 0, 1)
+		}
+		if !t.Before(start) && t.Before(end) {
+			return end, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// dndUntil returns when do-not-disturb ends if it is on at t, following windows that run into each other such as
+// "Fri 19:00-24:00" and "Sat-Sun"
+func dndUntil(windows []dndWindow, t time.Time) (time.Time, bool) {
+	until, quiet := t, false
+	// A week of back-to-back windows is the longest chain there can be
+	for i := 0; i < 2*7*len(windows)+1; i++ {
+		extended := false
+		for _, window := range windows {
+			if end, ok := window.endAfter(until); ok && end.After(until) {
+				until, quiet, extended = end, true, true
+			}
+		}
+		if !extended {
+			break
+		}
+	}
+	return until, quiet
+}
+
+// currentDNDWindows loads the configured windows; a broken setting is logged by the caller and treated as none
+func currentDNDWindows() ([]dndWindow, error) {
+	return parseDNDWindows(getSetting(dndSettingKey, ""))
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// fileNameSafe turns user text such as a group name into something usable in a file name. Path separators, characters
+// Windows doesn't allow and control characters become dashes; letters of any script are kept.
+func fileNameSafe(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '-'
+		}
+		return r
+	}, name)
+	// Leading dots would hide the file, trailing dots and spaces are dropped by Windows
+	return strings.Trim(name, ". ")
+}
+
+// contentDisposition is a Content-Disposition header value offering filename to the browser. filename= carries an
+// ASCII version for old clients, filename*= the UTF-8 name (RFC 6266 and RFC 5987), so names with spaces, quotes or
+// non-Latin letters arrive as they are.
+func contentDisposition(disposition, filename string) string {
+	filename = fileNameSafe(filename)
+	if filename == "" {
+		filename = "download"
+	}
+
+	var fallback, encoded strings.Builder
+	for _, r := range filename {
+		if r < unicode.MaxASCII && unicode.IsPrint(r) && r != '"' && r != '\\' {
+			fallback.WriteRune(r)
+		} else {
+			fallback.WriteByte('_')
+		}
+	}
+	for _, b := range []byte(filename) {
+		// attr-char of RFC 5987; everything else is percent-encoded
+		if b < unicode.MaxASCII && (unicode.IsLetter(rune(b)) || unicode.IsDigit(rune(b)) || strings.IndexByte("!#$&+-.^_`|~", b) >= 0) {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, disposition, fallback.String(), encoded.String())
+}
+
+// setDownloadName sets the Content-Disposition header for a download named filename
+func setDownloadName(c *fiber.Ctx, disposition, filename string) {
+	c.Set(fiber.HeaderContentDisposition, contentDisposition(disposition, filename))
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// emailLogPattern matches lines like "log 2h Client A: API review" or "log 1h30m on 2024-05-02 General"
+var emailLogPattern = regexp.MustCompile(`(?i)^\s*log\s+([0-9][0-9.]*\s*[a-z]+(?:\s*[0-9][0-9.]*\s*[a-z]+)?)\s+(?:on\s+(\d{4}-\d{2}-\d{2})\s+)?([^:]+?)\s*(?::\s*(.*?))?\s*$`)
+
+var durationUnits = strings.NewReplacer("hours", "h", "hour", "h", "hrs", "h", "hr", "h", "minutes", "m", "minute", "m", "mins", "m", "min", "m", " ", "")
+
+// emailEntry is one "log ..." command found in an email
+type emailEntry struct {
+	Duration time.Duration
+	Date     string // YYYY-MM-DD, empty for "ending now"
+	Group    string
+	Note     string
+}
+
+// parseEmailEntries extracts the "log" commands from the subject and body; other lines are ignored
+func parseEmailEntries(subject, body string) ([]emailEntry, []string) {
+	var entries []emailEntry
+	var problems []string
+	lines := append([]string{subject}, strings.Split(body, "\n")...)
+	for _, line := range lines {
+		line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "-"))
+		if !strings.HasPrefix(strings.ToLower(line), "log ") {
+			continue
+		}
+		match := emailLogPattern.FindStringSubmatch(line)
+		if match == nil {
+			problems = append(problems, fmt.Sprintf("%q: expected \"log <duration> [on YYYY-MM-DD] <group>[: note]\"", line))
+			continue
+		}
+		duration, err := time.ParseDuration(durationUnits.Replace(strings.ToLower(match[1])))
+		if err != nil || duration <= 0 || duration > 24*time.Hour {
+			problems = append(problems, fmt.Sprintf("%q: invalid duration %q", line, match[1]))
+			continue
+		}
+		entries = append(entries, emailEntry{
+			Duration: duration.Round(time.Second),
+			Date:     match[2],
+			Group:    strings.TrimSpace(match[3]),
+			Note:     strings.TrimSpace(match[4]),
+		})
+	}
+	return entries, problems
+}
+
+// mailgunSignatureAge is how far a webhook's timestamp may be off; its token is remembered twice as long
+const mailgunSignatureAge = 15 * time.Minute
+
+// mailgunTokens remembers the tokens of the webhooks taken recently, so a captured request can't be sent again
+var mailgunTokens = struct {
+	sync.Mutex
+	seen map[string]time.Time
+}{seen: make(map[string]time.Time)}
+
+// claimMailgunToken reports whether the token is new, remembering it; a signed request is only taken once
+func claimMailgunToken(token string, now time.Time) bool {
+	mailgunTokens.Lock()
+	defer mailgunTokens.Unlock()
+	for seen, at := range mailgunTokens.seen {
+		if now.Sub(at) > 2*mailgunSignatureAge {
+			delete(mailgunTokens.seen, seen)
+		}
+	}
+	if _, ok := mailgunTokens.seen[token]; ok {
+		return false
+	}
+	mailgunTokens.seen[token] = now
+	return true
+}
+
+// emailInEnabled is true once Mailgun's signing key and the route's address are set
+func emailInEnabled() bool {
+	return cfg.Inbound.MailgunSigningKey != "" && strings.Contains(cfg.Inbound.MailgunAddress, "@")
+}
+
+// emailInAddress is the secret address of a key: hours@in.example.com becomes hours+<key>@in.example.com
+func emailInAddress(key string) string {
+	local, domain, _ := strings.Cut(cfg.Inbound.MailgunAddress, "@")
+	return local + "+" + key + "@" + domain
+}
+
+// emailInKey finds the key in a recipient of the route's address, "" for any other address
+func emailInKey(recipient string) string {
+	address, err := mail.ParseAddress(recipient)
+	if err != nil {
+		return ""
+	}
+	local, domain, _ := strings.Cut(address.Address, "@")
+	base, key, ok := strings.Cut(local, "+")
+	wantLocal, wantDomain, _ := strings.Cut(cfg.Inbound.MailgunAddress, "@")
+	if !ok || !strings.EqualFold(base, wantLocal) || !strings.EqualFold(domain, wantDomain) {
+		return ""
+	}
+	return strings.ToLower(key)
+}
+
+// generateEmailInKey makes the secret part of an email-in address, short enough to type
+func generateEmailInKey() (string, error) {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// verifyMailgunSignature checks the webhook signature: HMAC-SHA256(timestamp + token) with the signing key
+func verifyMailgunSignature(key, timestamp, token, signature string) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.Unix(ts, 0)).Abs() > mailgunSignatureAge {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(timestamp + token))
+	expected := hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// inboundMailgunHandler receives emails forwarded by a Mailgun route and logs the time they describe. The account is
+// the one whose secret address the mail was sent to; the sender can be forged, so it picks nothing and gets no reply.
+func inboundMailgunHandler(c *fiber.Ctx) error {
+	if !emailInEnabled() {
+		return c.Status(404).SendString("Email-in is not configured")
+	}
+	token := c.FormValue("token")
+	if !verifyMailgunSignature(cfg.Inbound.MailgunSigningKey, c.FormValue("timestamp"), token, c.FormValue("signature")) {
+		return c.Status(401).SendString("Invalid signature")
+	}
+	// 406 tells Mailgun not to retry
+	if !claimMailgunToken(token, time.Now()) {
+		requestLog(c).Println("Ignoring a replayed email-in webhook")
+		return c.Status(406).SendString("Webhook already received")
+	}
+
+	var user User
+	key := emailInKey(c.FormValue("recipient"))
+	if key == "" || db.Where("email_in_hash = ?", hashToken(key)).First(&user).Error != nil {
+		requestLog(c).Printf("Ignoring email-in to unknown address %s", c.FormValue("recipient"))
+		// Mailgun retries on errors; accept and drop mail to addresses of no account
+		return c.SendStatus(fiber.StatusOK)
+	}
+	if scopeLevels[roleScopes[user.Role]] < scopeLevels[scopeControl] {
+		replyToEmail(user.Email, c.FormValue("subject"), "Your account can only view time, not log it.")
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	body := c.FormValue("stripped-text", c.FormValue("body-plain"))
+	entries, problems := parseEmailEntries(c.FormValue("subject"), body)
+	client := ClientInfo{UserID: user.ID, Name: "email", UserAgent: "email-in", RemoteIP: c.IP(), Source: sourceEmail}
+
+	var results []string
+	for _, entry := range entries {
+		round, err := logEmailEntry(user.ID, entry, client)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s for %s: %v", formatDuration(int64(entry.Duration.Seconds())), entry.Group, err))
+			continue
+		}
+		results = append(results, fmt.Sprintf("Logged %s for %s from %s to %s (round #%d)",
+			formatDuration(int64(entry.Duration.Seconds())), round.WorkingGroup.Name,
+			round.StartTime.Format("2006-01-02 15:04"), round.EndTime.Format("15:04"), round.ID))
+	}
+	if len(entries) == 0 && len(problems) == 0 {
+		problems = append(problems, "No \"log\" lines found. Example: log 2h Client A: API review")
+	}
+
+	replyToEmail(user.Email, c.FormValue("subject"), strings.Join(append(results, problems...), "\n"))
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// createEmailInHandler gives the user a new secret email-in address, which stops the old one from working
+func createEmailInHandler(c *fiber.Ctx) error {
+	if !emailInEnabled() {
+		return c.Status(404).SendString("Email-in is not configured")
+	}
+	key, err := generateEmailInKey()
+	if err != nil {
+		requestLog(c).Println("Error generating email-in address:", err)
+		return c.Status(500).SendString("Error creating email-in address")
+	}
+	if err := db.Model(currentUser(c)).Update("email_in_hash", hashToken(key)).Error; err != nil {
+		requestLog(c).Println("Error saving email-in address:", err)
+		return c.Status(500).SendString("Error creating email-in address")
+	}
+	recordAudit("settings.email_in", clientInfoFromRequest(c), 0, nil, "Created a new email-in address")
+	return renderUsersPage(c, emailInAddress(key))
+}
+
+// removeEmailInHandler turns email-in off for the user
+func removeEmailInHandler(c *fiber.Ctx) error {
+	if err := db.Model(currentUser(c)).Update("email_in_hash", "").Error; err != nil {
+		requestLog(c).Println("Error removing email-in address:", err)
+		return c.Status(500).SendString("Error removing email-in address")
+	}
+	recordAudit("settings.email_in", clientInfoFromRequest(c), 0, nil, "Removed the email-in address")
+	return c.Redirect("/users", fiber.StatusSeeOther)
+}
+
+// logEmailEntry creates a finished round: ending now, or starting at 09:00 on the given date
+func logEmailEntry(userID uint, entry emailEntry, client ClientInfo) (Round, error) {
+	var group WorkingGroup
+	if err := db.Scopes(userGroups(userID)).Where("LOWER(name) = ?", strings.ToLower(entry.Group)).First(&group).Error; err != nil {
+		return Round{}, errGroupNotFound
+	}
+
+	end := time.Now()
+	start := end.Add(-entry.Duration)
+	if entry.Date != "" {
+		day, err := time.ParseInLocation("2006-01-02", entry.Date, time.Local)
+		if err != nil {
+			return Round{}, fmt.Errorf("invalid date %q", entry.Date)
+		}
+		start = day.Add(9 * time.Hour)
+		end = start.Add(entry.Duration)
+		if end.After(time.Now()) {
+			return Round{}, fmt.Errorf("%s is in the future", entry.Date)
+		}
+	}
+
+	round := Round{
+		StartTime:      start,
+		EndTime:        &end,
+		WorkingGroupID: group.ID,
+		StartedBy:      client.Name,
+		StartUserAgent: client.UserAgent,
+		StoppedBy:      client.Name,
+		StopUserAgent:  client.UserAgent,
+		Note:           truncateString(entry.Note, 500),
+		Source:         client.Source,
+	}
+	if err := db.Create(&round).Error; err != nil {
+		log.Println("Error creating round from email:", err)
+		return Round{}, fmt.Errorf("could not save the round")
+	}
+
+	recordAudit("round.email", client, group.ID, &round.ID,
+		fmt.Sprintf("Logged %s for '%s' by email", entry.Duration, group.Name))
+	notifyRoundChange(group.ID)
+	pushRoundMetric(round, group)
+	round.WorkingGroup = group
+	return round, nil
+}
+
+// replyToEmail confirms what was logged to the account's own address; without SMTP or one the result is only logged
+func replyToEmail(to, subject, message string) {
+	mailer, ok := notifiers["email"].(*emailNotifier)
+	if !ok || to == "" {
+		log.Printf("Email-in result for %q:\n%s", to, message)
+		return
+	}
+	if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+		subject = "Re: " + subject
+	}
+	go func() {
+		if err := mailer.sendMail([]string{to}, subject, message); err != nil {
+			log.Println("Error replying to email-in:", err)
+		}
+	}()
+}
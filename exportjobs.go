@@ -0,0 +1,367 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Export job states
+const (
+	exportQueued  = "queued"
+	exportRunning = "running"
+	exportDone    = "done"
+	exportFailed  = "failed"
+)
+
+// exportRetention is how long finished export files can be downloaded before they are removed
+const exportRetention = 24 * time.Hour
+
+// exportFormat writes one kind of export. Every format runs through the job queue, so a new one (PDF, XLSX, ...)
+// only needs an entry here.
+type exportFormat struct {
+	Extension   string
+	ContentType string
+	Write       func(w io.Writer, userID, groupID uint, tag string, options csvOptions, progress func(done, total int)) error
+}
+
+var exportFormats = map[string]exportFormat{
+	"csv": {Extension: "csv", ContentType: "text/csv", Write: writeRoundsCSV},
+}
+
+// ExportJob is an export generated in the background and kept on disk until it expires
+type ExportJob struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index" json:"-"`
+	Format     string     `gorm:"size:16" json:"format"`
+	GroupID    uint       `json:"group_id,omitempty"`           // 0 exports every group
+	Tag        string     `gorm:"size:50" json:"tag,omitempty"` // Only rounds with this tag, empty for all
+	Delimiter  string     `gorm:"size:16" json:"delimiter"`
+	Decimal    string     `gorm:"size:16" json:"decimal"`
+	ExcelSafe  string     `gorm:"size:16" json:"excel_safe"`
+	Clock      string     `gorm:"size:16" json:"clock"`
+	Status     string     `gorm:"size:16;index" json:"status"`
+	Done       int        `json:"done"`  // Rounds written so far
+	Total      int        `json:"total"` // Rounds to write, known once the job runs
+	Error      string     `json:"error,omitempty"`
+	FileName   string     `json:"file_name"` // Offered when downloading
+	Path       string     `json:"-"`         // File in EXPORT_DIR
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+// Percent is the share of rounds written; 100 once the job is done
+func (j ExportJob) Percent() int {
+	if j.Status == exportDone {
+		return 100
+	}
+	if j.Total == 0 {
+		return 0
+	}
+	return j.Done * 100 / j.Total
+}
+
+// exportJobResponse is an export job with its progress and, once done, where to download it
+type exportJobResponse struct {
+	ExportJob
+	Progress    int    `json:"progress"` // Percent
+	DownloadURL string `json:"download_url,omitempty"`
+	CreatedStr  string `json:"-"`
+}
+
+func newExportJobResponse(job ExportJob) exportJobResponse {
+	response := exportJobResponse{ExportJob: job, Progress: job.Percent(), CreatedStr: job.CreatedAt.Format("2006-01-02 15:04")}
+	if job.Status == exportDone {
+		response.DownloadURL = fmt.Sprintf("%s/exports/%d/download", cfg.BasePath, job.ID)
+	}
+	return response
+}
+
+// exportQueue feeds job IDs to the worker; one export runs at a time so big ones don't compete for the database
+var exportQueue = make(chan uint, 100)
+
+// startExportWorker picks up jobs left over from the last run and starts the worker that runs them and removes
+// expired exports
+func startExportWorker() {
+	if err := os.MkdirAll(cfg.ExportDir, 0o750); err != nil {
+		log.Println("Warning: failed to create export directory:", err)
+	}
+
+	registerJob(jobExportCleanup, "hourly")
+
+	var pending []ExportJob
+	db.Where("status IN ?", []string{exportQueued, exportRunning}).Order("id ASC").Find(&pending)
+
+	go func() {
+		for _, job := range pending {
+			runExportJob(job.ID)
+		}
+		cleanup := time.NewTicker(time.Hour)
+		defer cleanup.Stop()
+		recordJobRun(jobExportCleanup, removeExpiredExports())
+		for {
+			select {
+			case id := <-exportQueue:
+				runExportJob(id)
+			case <-cleanup.C:
+				recordJobRun(jobExportCleanup, removeExpiredExports())
+			}
+		}
+	}()
+}
+
+// queueExport stores a new job for the user's rounds of one group (or all when groupID is 0) and queues it
+func queueExport(userID, groupID uint, tag, format string, options csvOptions) (ExportJob, error) {
+	groupName := "all-groups"
+	if groupID != 0 {
+		group, err := findUserGroup(userID, groupID)
+		if err != nil {
+			return ExportJob{}, errGroupNotFound
+		}
+		groupName = fileNameSafe(group.Name)
+		if groupName == "" {
+			groupName = fmt.Sprintf("Group-%d", groupID)
+		}
+	}
+	if tag != "" {
+		groupName += "-" + fileNameSafe(tag)
+	}
+	job := ExportJob{
+		UserID:    userID,
+		Format:    format,
+		GroupID:   groupID,
+		Tag:       tag,
+		Delimiter: options.Delimiter,
+		Decimal:   options.Decimal,
+		ExcelSafe: options.ExcelSafe,
+		Clock:     options.Clock,
+		Status:    exportQueued,
+		FileName:  fmt.Sprintf("workinghours-%s-%s.%s", groupName, time.Now().Format("2006-01-02-150405"), exportFormats[format].Extension),
+	}
+	if err := db.Create(&job).Error; err != nil {
+		return ExportJob{}, err
+	}
+	select {
+	case exportQueue <- job.ID:
+	default:
+		// The queue is full; the job stays queued and runs after the next restart at the latest
+		log.Printf("Export queue is full, job %d waits", job.ID)
+	}
+	return job, nil
+}
+
+// runExportJob writes the export to a file, saving the progress as it goes
+func runExportJob(id uint) {
+	var job ExportJob
+	if err := db.First(&job, id).Error; err != nil {
+		log.Println("Error loading export job:", err)
+		return
+	}
+	format, ok := exportFormats[job.Format]
+	if !ok {
+		failExportJob(&job, fmt.Errorf("unknown format %q", job.Format))
+		return
+	}
+
+	job.Path = filepath.Join(cfg.ExportDir, fmt.Sprintf("export-%d.%s", job.ID, format.Extension))
+	db.Model(&job).Updates(map[string]interface{}{"status": exportRunning, "path": job.Path, "done": 0})
+	file, err := os.Create(job.Path)
+	if err != nil {
+		failExportJob(&job, err)
+		return
+	}
+
+	lastSaved := time.Now()
+	progress := func(done, total int) {
+		// Saving every row would slow down big exports, a few times a second is enough to show progress
+		if time.Since(lastSaved) > 250*time.Millisecond || done == total {
+			db.Model(&job).Updates(map[string]interface{}{"done": done, "total": total})
+			lastSaved = time.Now()
+		}
+	}
+	options := csvOptions{Delimiter: job.Delimiter, Decimal: job.Decimal, ExcelSafe: job.ExcelSafe, Clock: job.Clock}
+	err = format.Write(file, job.UserID, job.GroupID, job.Tag, options, progress)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(job.Path)
+		failExportJob(&job, err)
+		return
+	}
+
+	now := time.Now()
+	db.Model(&job).Updates(map[string]interface{}{"status": exportDone, "finished_at": now})
+	log.Printf("Finished export job %d (%s)", job.ID, job.FileName)
+}
+
+func failExportJob(job *ExportJob, err error) {
+	log.Printf("Error running export job %d: %v", job.ID, err)
+	now := time.Now()
+	db.Model(job).Updates(map[string]interface{}{"status": exportFailed, "error": err.Error(), "finished_at": now})
+}
+
+// removeExpiredExports deletes export files and jobs that finished more than exportRetention ago. Files that can't
+// be removed are kept with their job and tried again next time.
+func removeExpiredExports() error {
+	var expired []ExportJob
+	if err := db.Where("finished_at < ?", time.Now().Add(-exportRetention)).Find(&expired).Error; err != nil {
+		return fmt.Errorf("finding expired exports: %w", err)
+	}
+	var failed error
+	for _, job := range expired {
+		if job.Path != "" {
+			if err := os.Remove(job.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				failed = fmt.Errorf("removing expired export: %w", err)
+				continue
+			}
+		}
+		db.Delete(&job)
+	}
+	return failed
+}
+
+// findExportJob loads one of the user's export jobs
+func findExportJob(c *fiber.Ctx) (ExportJob, error) {
+	var job ExportJob
+	id, err := parseGroupID(c.Params("id"))
+	if err != nil {
+		return job, gorm.ErrRecordNotFound
+	}
+	err = db.Where("user_id = ?", currentUserID(c)).First(&job, id).Error
+	return job, err
+}
+
+// exportRequest starts an export of one group, or of all groups when GroupID is 0, optionally only of the rounds with
+// a tag. Delimiter, Decimal and ExcelSafe default to the instance-wide CSV format, Clock to home time.
+type exportRequest struct {
+	Format    string `json:"format" form:"format"` // Default csv
+	GroupID   uint   `json:"group_id" form:"group_id"`
+	Tag       string `json:"tag" form:"tag"`
+	Delimiter string `json:"delimiter" form:"delimiter"`   // comma, semicolon or tab
+	Decimal   string `json:"decimal" form:"decimal"`       // point or comma
+	ExcelSafe string `json:"excel_safe" form:"excel_safe"` // on or off
+	Clock     string `json:"clock" form:"clock"`           // home or local
+}
+
+// parseExportRequest reads a new export from a form or JSON body
+func parseExportRequest(c *fiber.Ctx) (exportRequest, error) {
+	var req exportRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return req, errors.New("invalid request body")
+		}
+	}
+	if req.Format == "" {
+		req.Format = "csv"
+	}
+	if _, ok := exportFormats[req.Format]; !ok {
+		return req, fmt.Errorf("unknown export format %q", req.Format)
+	}
+	options, err := req.options().resolve()
+	if err != nil {
+		return req, err
+	}
+	if req.Tag, err = parseTagFilter(currentUserID(c), req.Tag); err != nil {
+		return req, err
+	}
+	req.Delimiter, req.Decimal, req.ExcelSafe, req.Clock = options.Delimiter, options.Decimal, options.ExcelSafe, options.Clock
+	return req, nil
+}
+
+func (req exportRequest) options() csvOptions {
+	return csvOptions{Delimiter: req.Delimiter, Decimal: req.Decimal, ExcelSafe: req.ExcelSafe, Clock: req.Clock}
+}
+
+// renderExports lists the user's export jobs, refreshing while any is still running
+func renderExports(c *fiber.Ctx) error {
+	var jobs []ExportJob
+	if err := db.Where("user_id = ?", currentUserID(c)).Order("id DESC").Find(&jobs).Error; err != nil {
+		requestLog(c).Println("Error loading export jobs:", err)
+		return c.Status(500).SendString("Error loading exports")
+	}
+	pending := false
+	views := make([]exportJobResponse, 0, len(jobs))
+	for _, job := range jobs {
+		pending = pending || job.Status == exportQueued || job.Status == exportRunning
+		views = append(views, newExportJobResponse(job))
+	}
+	groups, err := getWorkingGroupsOrdered(currentUserID(c))
+	if err != nil {
+		requestLog(c).Println("Error loading working groups:", err)
+		return c.Status(500).SendString("Error loading exports")
+	}
+	tags, err := userTagNames(currentUserID(c))
+	if err != nil {
+		requestLog(c).Println("Error loading tags:", err)
+		return c.Status(500).SendString("Error loading exports")
+	}
+	return c.Render("exports", fiber.Map{
+		"Jobs":       views,
+		"Pending":    pending,
+		"Groups":     groups,
+		"Tags":       tags,
+		"CSVOptions": csvOptionChoices(defaultCSVOptions()),
+		"Can":        permissionsView(c),
+	})
+}
+
+func createExportHandler(c *fiber.Ctx) error {
+	req, err := parseExportRequest(c)
+	if err != nil {
+		return c.Status(400).SendString(err.Error())
+	}
+	if _, err := queueExport(currentUserID(c), req.GroupID, req.Tag, req.Format, req.options()); err != nil {
+		if errors.Is(err, errGroupNotFound) {
+			return c.Status(404).SendString("Working group not found")
+		}
+		requestLog(c).Println("Error queueing export:", err)
+		return c.Status(500).SendString("Error starting export")
+	}
+	return c.Redirect("/exports", fiber.StatusSeeOther)
+}
+
+func downloadExportHandler(c *fiber.Ctx) error {
+	job, err := findExportJob(c)
+	if err != nil {
+		return c.Status(404).SendString("Export not found")
+	}
+	if job.Status != exportDone {
+		return c.Status(409).SendString("Export is not ready yet")
+	}
+	c.Set(fiber.HeaderContentType, exportFormats[job.Format].ContentType)
+	setDownloadName(c, "attachment", job.FileName)
+	return c.SendFile(job.Path)
+}
+
+func apiCreateExport(c *fiber.Ctx) error {
+	req, err := parseExportRequest(c)
+	if err != nil {
+		return c.Status(400).JSON(apiError{err.Error()})
+	}
+	job, err := queueExport(currentUserID(c), req.GroupID, req.Tag, req.Format, req.options())
+	if err != nil {
+		if errors.Is(err, errGroupNotFound) {
+			return c.Status(404).JSON(apiError{"working group not found"})
+		}
+		requestLog(c).Println("Error queueing export:", err)
+		return c.Status(500).JSON(apiError{"error starting export"})
+	}
+	c.Location(fmt.Sprintf("/api/v1/exports/%d", job.ID)) // Prefixed with the base path on the way out
+	return c.Status(fiber.StatusAccepted).JSON(newExportJobResponse(job))
+}
+
+func apiGetExport(c *fiber.Ctx) error {
+	job, err := findExportJob(c)
+	if err != nil {
+		return c.Status(404).JSON(apiError{"export not found"})
+	}
+	return c.JSON(newExportJobResponse(job))
+}
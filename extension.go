@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+)
+
+// Browser extensions call the JSON API from their own origin using a bearer token, never cookies
+var extensionOriginSchemes = []string{"chrome-extension://", "moz-extension://", "safari-web-extension://"}
+
+// apiCORS allows browser extensions, plus any origin listed in extension_origins, to call /api/v1
+func apiCORS() fiber.Handler {
+	extra := make(map[string]bool)
+	for _, origin := range cfg.ExtensionOrigins {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			extra[strings.TrimSuffix(origin, "/")] = true
+		}
+	}
+
+	return cors.New(cors.Config{
+		AllowOriginsFunc: func(origin string) bool {
+			for _, scheme := range extensionOriginSchemes {
+				if strings.HasPrefix(origin, scheme) {
+					return true
+				}
+			}
+			return extra[origin]
+		},
+		// Every method of an /api/v1 route belongs here, or cross-origin calls to it fail the preflight
+		AllowMethods:  "GET,POST,PUT,PATCH,DELETE",
+		AllowHeaders:  "Authorization,Content-Type,X-Client-Name,X-Time-Zone",
+		ExposeHeaders: "X-RateLimit-Limit,X-RateLimit-Remaining,X-RateLimit-Reset,Retry-After,X-Request-ID",
+		MaxAge:        3600,
+	})
+}
+
+type toggleRequest struct {
+	GroupID uint   `json:"group_id,omitempty"` // Defaults to the first working group
+	Note    string `json:"note,omitempty"`     // Stored on the round when the toggle starts one
+}
+
+type toggleResponse struct {
+	Action string   `json:"action"` // "started", "stopped" or "discarded" (shorter than MIN_ROUND_DURATION), "resumed" from /api/v1/resume, "paused" or "continued"
+	Round  Round    `json:"round"`
+	Status AppState `json:"status"`
+}
+
+// stoppedRound is one round closed by stop-all
+type stoppedRound struct {
+	Round           Round  `json:"round"`
+	GroupName       string `json:"group_name"`
+	DurationSeconds int64  `json:"duration_seconds"`
+}
+
+type stopAllResponse struct {
+	Stopped      []stoppedRound `json:"stopped"`
+	Count        int            `json:"count"`         // 0 when nothing was running
+	TotalSeconds int64          `json:"total_seconds"` // Combined length of the stopped rounds
+}
+
+type noteRequest struct {
+	GroupID uint   `json:"group_id,omitempty"`
+	Note    string `json:"note"`
+}
+
+// resolveAPIGroup returns the requested working group of the user, or the default one when none is requested
+func resolveAPIGroup(userID, groupID uint) (uint, error) {
+	if groupID != 0 {
+		if _, err := findUserGroup(userID, groupID); err != nil {
+			return 0, errGroupNotFound
+		}
+		return groupID, nil
+	}
+	groups, err := getWorkingGroupsOrdered(userID)
+	if err != nil {
+		return 0, err
+	}
+	if len(groups) == 0 {
+		return ensureDefaultWorkingGroup(userID).ID, nil
+	}
+	return defaultGroup(groups).ID, nil
+}
+
+// sendAPIRoundError is the JSON counterpart of sendRoundError
+func sendAPIRoundError(c *fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, errGroupNotFound):
+		return c.Status(404).JSON(apiError{"working group not found"})
+	case errors.Is(err, errRoundRunning), errors.Is(err, errNoRoundRunning), errors.Is(err, errNothingToResume),
+		errors.Is(err, errRoundPaused), errors.Is(err, errRoundNotPaused):
+		return c.Status(409).JSON(apiError{err.Error()})
+	default:
+		requestLog(c).Println(fallback+":", err)
+		return c.Status(500).JSON(apiError{fallback})
+	}
+}
+
+// apiToggle starts a round when the group is idle and stops the running one otherwise
+func apiToggle(c *fiber.Ctx) error {
+	var req toggleRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(apiError{"invalid request body"})
+		}
+	}
+
+	userID := currentUserID(c)
+	groupID, err := resolveAPIGroup(userID, req.GroupID)
+	if err != nil {
+		return sendAPIRoundError(c, err, "error toggling round")
+	}
+
+	client := clientInfoFromRequest(c)
+	response := toggleResponse{}
+	if getCurrentState(traceContext(c), groupID).IsRunning {
+		response.Action = "stopped"
+		response.Round, err = stopRound(groupID, client)
+	} else {
+		response.Action = "started"
+		response.Round, err = startRound(groupID, client)
+		if err == nil && strings.TrimSpace(req.Note) != "" {
+			err = setRoundNote(&response.Round, req.Note, client)
+		}
+	}
+	if err != nil {
+		return sendAPIRoundError(c, err, "error toggling round")
+	}
+	if response.Round.Discarded {
+		response.Action = "discarded"
+	}
+
+	response.Status = getCurrentState(traceContext(c), groupID)
+	return c.JSON(response)
+}
+
+// apiStopAll stops every running round of the user, e.g. from a "leaving the office" automation
+func apiStopAll(c *fiber.Ctx) error {
+	rounds, err := stopAllRounds(clientInfoFromRequest(c))
+	if err != nil {
+		return c.Status(500).JSON(apiError{"error stopping rounds"})
+	}
+	response := stopAllResponse{Stopped: []stoppedRound{}, Count: len(rounds)}
+	for _, round := range rounds {
+		seconds := roundWorkedSeconds(round, *round.EndTime)
+		response.Stopped = append(response.Stopped, stoppedRound{Round: round, GroupName: round.WorkingGroup.Name, DurationSeconds: seconds})
+		response.TotalSeconds += seconds
+	}
+	return c.JSON(response)
+}
+
+// apiAddNote appends a line to the note of the group's running round
+func apiAddNote(c *fiber.Ctx) error {
+	var req noteRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(apiError{"invalid request body"})
+	}
+	if strings.TrimSpace(req.Note) == "" {
+		return c.Status(400).JSON(apiError{"note cannot be empty"})
+	}
+
+	groupID, err := resolveAPIGroup(currentUserID(c), req.GroupID)
+	if err != nil {
+		return sendAPIRoundError(c, err, "error adding note")
+	}
+
+	var round Round
+	if err := db.Where("working_group_id = ? AND end_time IS NULL", groupID).First(&round).Error; err != nil {
+		return sendAPIRoundError(c, errNoRoundRunning, "error adding note")
+	}
+
+	note := strings.TrimSpace(req.Note)
+	if round.Note != "" {
+		note = round.Note + "\n" + note
+	}
+	if err := setRoundNote(&round, note, clientInfoFromRequest(c)); err != nil {
+		return sendAPIRoundError(c, err, "error adding note")
+	}
+	return c.JSON(round)
+}
+
+func setRoundNote(round *Round, note string, client ClientInfo) error {
+	round.Note = truncateString(strings.TrimSpace(note), 500)
+	if err := db.Model(round).Update("note", round.Note).Error; err != nil {
+		return err
+	}
+	recordAudit("round.note", client, round.WorkingGroupID, &round.ID, fmt.Sprintf("Set note '%s'", round.Note))
+	return nil
+}
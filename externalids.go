@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Local entities an external ID can stand for
+const (
+	mappingGroup = "group" // e.g. a Toggl project or a Harvest client
+	mappingRound = "round" // e.g. a Toggl time entry
+	mappingTag   = "tag"   // e.g. a Jira issue, as rounds are tagged with the task they were spent on
+)
+
+// mappingSync is the system of the groups the sync peer has, keyed by their sync_id
+const mappingSync = "sync"
+
+var mappingSystemPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,31}$`)
+
+// ExternalMapping ties a group, round or tag to its ID in another system, so integrations find it again by that ID
+// instead of by name, even after it was renamed on either side
+type ExternalMapping struct {
+	ID     uint `gorm:"primaryKey" json:"id"`
+	UserID uint `gorm:"uniqueIndex:idx_external_mappings_key,priority:1;default:0" json:"-"`
+	// The system, e.g. toggl, jira or sync; the column isn't called system, a reserved word in MySQL
+	System     string    `gorm:"column:external_system;uniqueIndex:idx_external_mappings_key,priority:2;size:32;not null" json:"system"`
+	Entity     string    `gorm:"uniqueIndex:idx_external_mappings_key,priority:3;size:16;not null" json:"entity"` // group, round or tag
+	ExternalID string    `gorm:"uniqueIndex:idx_external_mappings_key,priority:4;size:191;not null" json:"external_id"`
+	LocalID    uint      `gorm:"index;not null" json:"local_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+var errUnknownLocalEntity = errors.New("local entity not found")
+
+// checkMappingKey validates the system, entity and external ID of a mapping
+func checkMappingKey(system, entity, externalID string) error {
+	if !mappingSystemPattern.MatchString(system) {
+		return fmt.Errorf("system must be up to 32 lowercase letters, digits, dots, dashes or underscores, like toggl")
+	}
+	switch entity {
+	case mappingGroup, mappingRound, mappingTag:
+	default:
+		return fmt.Errorf("entity must be %s, %s or %s", mappingGroup, mappingRound, mappingTag)
+	}
+	if externalID == "" || len(externalID) > 191 {
+		return fmt.Errorf("external_id must be 1 to 191 characters")
+	}
+	return nil
+}
+
+// mappedEntityExists reports whether the user has the group, round or tag with the local ID
+func mappedEntityExists(tx *gorm.DB, userID uint, entity string, localID uint) (bool, error) {
+	var count int64
+	var err error
+	switch entity {
+	case mappingGroup:
+		err = tx.Model(&WorkingGroup{}).Scopes(userGroups(userID)).Where("id = ?", localID).Count(&count).Error
+	case mappingRound:
+		err = tx.Model(&Round{}).Scopes(userRounds(userID)).Where("id = ?", localID).Count(&count).Error
+	case mappingTag:
+		err = tx.Model(&Tag{}).Where("user_id = ? AND id = ?", userID, localID).Count(&count).Error
+	}
+	return count > 0, err
+}
+
+// findExternalMapping looks up the local entity an external ID stands for. Mappings whose entity was deleted since
+// are removed and reported as not found.
+func findExternalMapping(tx *gorm.DB, userID uint, system, entity, externalID string) (ExternalMapping, error) {
+	var mapping ExternalMapping
+	err := tx.Where("user_id = ? AND external_system = ? AND entity = ? AND external_id = ?", userID, system, entity, externalID).
+		Take(&mapping).Error
+	if err != nil {
+		return ExternalMapping{}, err
+	}
+	exists, err := mappedEntityExists(tx, userID, entity, mapping.LocalID)
+	if err != nil {
+		return ExternalMapping{}, err
+	}
+	if !exists {
+		if err := tx.Delete(&mapping).Error; err != nil {
+			return ExternalMapping{}, err
+		}
+		return ExternalMapping{}, gorm.ErrRecordNotFound
+	}
+	return mapping, nil
+}
+
+// saveExternalMapping points an external ID at a local entity, replacing what it pointed at before
+func saveExternalMapping(tx *gorm.DB, userID uint, system, entity, externalID string, localID uint) (ExternalMapping, error) {
+	mapping := ExternalMapping{UserID: userID, System: system, Entity: entity, ExternalID: externalID, LocalID: localID}
+	err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "external_system"}, {Name: "entity"}, {Name: "external_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"local_id", "updated_at"}),
+	}).Create(&mapping).Error
+	if err != nil {
+		return ExternalMapping{}, err
+	}
+	// The ID of an updated row isn't returned by every database
+	err = tx.Where("user_id = ? AND external_system = ? AND entity = ? AND external_id = ?", userID, system, entity, externalID).
+		Take(&mapping).Error
+	return mapping, err
+}
+
+// deleteEntityMappings removes the mappings of a deleted group, round or tag
+func deleteEntityMappings(tx *gorm.DB, userID uint, entity string, localID uint) error {
+	return tx.Where("user_id = ? AND entity = ? AND local_id = ?", userID, entity, localID).Delete(&ExternalMapping{}).Error
+}
+
+// externalMappingRequest is the body of PUT /api/v1/mappings
+type externalMappingRequest struct {
+	System     string `json:"system"`
+	Entity     string `json:"entity"`
+	ExternalID string `json:"external_id"`
+	LocalID    uint   `json:"local_id"`
+}
+
+// apiListMappings lists the user's mappings, filtered by system, entity, external_id or local_id
+func apiListMappings(c *fiber.Ctx) error {
+	query := db.Where("user_id = ?", currentUserID(c))
+	for param, column := range map[string]string{"system": "external_system", "entity": "entity", "external_id": "external_id", "local_id": "local_id"} {
+		if value := c.Query(param); value != "" {
+			query = query.Where(column+" = ?", value)
+		}
+	}
+	mappings := []ExternalMapping{}
+	if err := query.Order("external_system ASC, entity ASC, external_id ASC").Limit(1000).Find(&mappings).Error; err != nil {
+		requestLog(c).Println("Error fetching external mappings:", err)
+		return c.Status(500).JSON(apiError{"error fetching mappings"})
+	}
+	return c.JSON(mappings)
+}
+
+// apiSaveMapping creates or moves the mapping of an external ID
+func apiSaveMapping(c *fiber.Ctx) error {
+	var req externalMappingRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(apiError{"invalid request body"})
+	}
+	req.System = strings.ToLower(strings.TrimSpace(req.System))
+	req.ExternalID = strings.TrimSpace(req.ExternalID)
+	if err := checkMappingKey(req.System, req.Entity, req.ExternalID); err != nil {
+		return c.Status(400).JSON(apiError{err.Error()})
+	}
+
+	client := clientInfoFromRequest(c)
+	var mapping ExternalMapping
+	err := db.Transaction(func(tx *gorm.DB) error {
+		exists, err := mappedEntityExists(tx, client.UserID, req.Entity, req.LocalID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return errUnknownLocalEntity
+		}
+		mapping, err = saveExternalMapping(tx, client.UserID, req.System, req.Entity, req.ExternalID, req.LocalID)
+		return err
+	})
+	if errors.Is(err, errUnknownLocalEntity) {
+		return c.Status(404).JSON(apiError{req.Entity + " not found"})
+	}
+	if err != nil {
+		requestLog(c).Println("Error saving external mapping:", err)
+		return c.Status(500).JSON(apiError{"error saving mapping"})
+	}
+
+	var groupID uint
+	var roundID *uint
+	switch req.Entity {
+	case mappingGroup:
+		groupID = req.LocalID
+	case mappingRound:
+		roundID = &mapping.LocalID
+	}
+	recordAudit("mapping.save", client, groupID, roundID,
+		fmt.Sprintf("Mapped %s %s '%s' to %s #%d", req.System, req.Entity, req.ExternalID, req.Entity, req.LocalID))
+	return c.JSON(mapping)
+}
+
+// apiDeleteMapping forgets a mapping; the local entity stays
+func apiDeleteMapping(c *fiber.Ctx) error {
+	id, err := parseGroupID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(apiError{"invalid mapping"})
+	}
+	client := clientInfoFromRequest(c)
+	var mapping ExternalMapping
+	if err := db.Where("user_id = ?", client.UserID).First(&mapping, id).Error; err != nil {
+		return c.Status(404).JSON(apiError{"mapping not found"})
+	}
+	if err := db.Delete(&mapping).Error; err != nil {
+		requestLog(c).Println("Error deleting external mapping:", err)
+		return c.Status(500).JSON(apiError{"error deleting mapping"})
+	}
+	recordAudit("mapping.delete", client, 0, nil,
+		fmt.Sprintf("Removed the mapping of %s %s '%s'", mapping.System, mapping.Entity, mapping.ExternalID))
+	return c.SendStatus(fiber.StatusNoContent)
+}
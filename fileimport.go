@@ -0,0 +1,1021 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Rows of a CSV or XLSX file become rounds in two steps. The preview stages the uploaded file under a token and shows
+// what importing it would do: the columns it recognized, the group each group name goes to and what is wrong with
+// which row. The confirmation imports the staged file by its token, with the groups picked meanwhile; nothing is
+// written before.
+
+const (
+	stagedImportTTL      = time.Hour // How long a preview can be confirmed
+	importPreviewRows    = 20        // Rows a preview lists unless it asks for more
+	maxImportPreviewRows = 200
+	maxImportRows        = 10000
+	maxImportColumns     = 100
+	importProblemLimit   = 100    // Problems a preview lists, of all rows
+	importMappingSystem  = "file" // System of the external IDs remembering which group a name in a file stands for
+)
+
+var (
+	errStagedImportNotFound = errors.New("the import preview expired or was imported already; upload the file again")
+	errUnreadableImport     = errors.New("the file can't be imported")
+)
+
+// Fields a column of an imported file can fill
+const (
+	importFieldID       = "external_id"
+	importFieldGroup    = "group"
+	importFieldDate     = "date"
+	importFieldStart    = "start"
+	importFieldEndDate  = "end_date"
+	importFieldEnd      = "end"
+	importFieldMinutes  = "minutes"
+	importFieldHours    = "hours"
+	importFieldDuration = "duration"
+	importFieldTimeZone = "time_zone"
+	importFieldStatus   = "status"
+	importFieldNote     = "note"
+	importFieldTags     = "tags"
+)
+
+// importHeaders recognizes columns by their header, compared by looseName. They cover the CSV export, so rounds
+// exported from one instance can be imported into another, and the exports of common trackers, such as Toggl's
+// Project, Description, Start date, Start time and Duration.
+var importHeaders = map[string]string{
+	"roundid": importFieldID, "id": importFieldID, "externalid": importFieldID, "entryid": importFieldID,
+	"workinggroup": importFieldGroup, "group": importFieldGroup, "project": importFieldGroup, "client": importFieldGroup,
+	"date": importFieldDate, "day": importFieldDate, "startdate": importFieldDate,
+	"starttime": importFieldStart, "start": importFieldStart, "from": importFieldStart, "begin": importFieldStart,
+	"enddate": importFieldEndDate, "stopdate": importFieldEndDate,
+	"endtime": importFieldEnd, "end": importFieldEnd, "to": importFieldEnd, "until": importFieldEnd, "stop": importFieldEnd,
+	"durationminutes": importFieldMinutes, "minutes": importFieldMinutes,
+	"durationhours": importFieldHours, "hours": importFieldHours,
+	"duration": importFieldDuration,
+	"timezone": importFieldTimeZone, "zone": importFieldTimeZone,
+	"status": importFieldStatus,
+	"note":   importFieldNote, "notes": importFieldNote, "description": importFieldNote, "comment": importFieldNote,
+	"task": importFieldNote,
+	"tags": importFieldTags, "tag": importFieldTags,
+}
+
+// How the group of a name in an imported file was found
+const (
+	importMatchChosen  = "chosen"  // Picked on the preview
+	importMatchMapping = "mapping" // An external ID of system file, remembered from an earlier import
+	importMatchName    = "name"    // A group of the same name or path
+	importMatchDefault = "default" // None of the above, or the file has no group column
+)
+
+// Layouts of the start and end cells; dates are ISO, German or with slashes, as a month first can't be told from a
+// day first
+var (
+	importDateTimeLayouts = []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02T15:04:05", "2006-01-02T15:04",
+		"2.1.2006 15:04:05", "2.1.2006 15:04", "2006/01/02 15:04:05", "2006/01/02 15:04"}
+	importDateLayouts  = []string{"2006-01-02", "2.1.2006", "2006/01/02"}
+	importClockLayouts = []string{"15:04:05", "15:04", "3:04:05 PM", "3:04 PM"}
+)
+
+// StagedImport is an uploaded file waiting for its preview to be confirmed
+type StagedImport struct {
+	ID             uint      `gorm:"primaryKey"`
+	UserID         uint      `gorm:"index"`
+	Token          string    `gorm:"uniqueIndex;size:64"`
+	FileName       string    `gorm:"size:255"`
+	DefaultGroupID uint      // Rows without a group, or with one no group matches, go here
+	Data           []byte    // The file as uploaded
+	ExpiresAt      time.Time `gorm:"index"`
+	CreatedAt      time.Time
+}
+
+// importRecord is a row of an imported file with its line number, 1 for the first row of the sheet
+type importRecord struct {
+	Line  int
+	Cells []string
+}
+
+// importColumn is a column of an imported file and the field it fills
+type importColumn struct {
+	Index  int    `json:"index"`
+	Header string `json:"header"`
+	Field  string `json:"field,omitempty"` // Empty when the column is left out
+}
+
+// importGroupMatch is the group the rows with one group name go to
+type importGroupMatch struct {
+	Name      string `json:"name"` // As written in the file, empty for rows without a group
+	Rows      int    `json:"rows"`
+	GroupID   uint   `json:"group_id"`
+	GroupPath string `json:"group_path"`
+	MatchedBy string `json:"matched_by"` // chosen, mapping, name or default
+}
+
+// importRow is the round a row of the file becomes, or why it can't
+type importRow struct {
+	Line            int        `json:"line"`
+	GroupName       string     `json:"group_name"` // As written in the file
+	GroupID         uint       `json:"group_id"`
+	Start           *time.Time `json:"start,omitempty"`
+	End             *time.Time `json:"end,omitempty"`
+	TimeZone        string     `json:"time_zone,omitempty"`
+	Note            string     `json:"note,omitempty"`
+	Tags            []string   `json:"tags,omitempty"`
+	ExternalID      string     `json:"external_id,omitempty"`
+	Error           string     `json:"error,omitempty"`            // Why the row can't be imported
+	DuplicateOf     uint       `json:"duplicate_of,omitempty"`     // The round the row repeats, see importDeduper
+	DuplicateReason string     `json:"duplicate_reason,omitempty"` // Set for duplicates, which aren't imported either
+	Warnings        []string   `json:"warnings,omitempty"`         // Imported anyway
+	duplicate       *importDuplicate
+}
+
+// importable reports whether confirming creates a round for the row
+func (r importRow) importable() bool {
+	return r.Error == "" && r.duplicate == nil
+}
+
+// importProblem is an error, duplicate or warning of one row
+type importProblem struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+	Skipped bool   `json:"skipped"` // The row isn't imported
+}
+
+// importAnalysis is what importing a staged file would do, row by row
+type importAnalysis struct {
+	Columns []importColumn
+	Groups  []importGroupMatch
+	Rows    []importRow
+}
+
+// importPreview is POST /api/v1/import/preview: the first rows of the file and the problems of all of them
+type importPreview struct {
+	Token      string             `json:"token"` // Confirms the import, until expires_at
+	ExpiresAt  time.Time          `json:"expires_at"`
+	FileName   string             `json:"file_name"`
+	Columns    []importColumn     `json:"columns"`
+	Groups     []importGroupMatch `json:"groups"`
+	Rows       []importRow        `json:"rows"`       // The first rows of the file
+	TotalRows  int                `json:"total_rows"` // Rows of the file below the header, blank ones left out
+	Importable int                `json:"importable"` // Rows confirming would import
+	Duplicates int                `json:"duplicates"`
+	Invalid    int                `json:"invalid"`  // Rows that can't be read as a finished round
+	Problems   []importProblem    `json:"problems"` // The first problems of the whole file
+}
+
+// importConfirmRequest is the body of POST /api/v1/import/confirm
+type importConfirmRequest struct {
+	Token    string          `json:"token"`
+	Groups   map[string]uint `json:"groups,omitempty"` // Group IDs by name in the file, where the preview's won't do
+	Remember bool            `json:"remember"`         // Keep the groups of the names for later imports
+}
+
+// importConfirmResponse is what confirming an import did
+type importConfirmResponse struct {
+	Created    int    `json:"created"`
+	Duplicates int    `json:"duplicates"`
+	Invalid    int    `json:"invalid"`
+	RoundIDs   []uint `json:"round_ids"`
+}
+
+// readImportFile returns the rows of a CSV or XLSX file, told apart by the name and the content
+func readImportFile(fileName string, data []byte) ([]importRecord, error) {
+	name := strings.ToLower(fileName)
+	switch {
+	case strings.HasSuffix(name, ".xls"):
+		return nil, errors.New("old .xls workbooks can't be read; save the sheet as .xlsx or .csv")
+	case strings.HasSuffix(name, ".xlsx") || bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return readXLSX(data)
+	default:
+		return readImportCSV(data)
+	}
+}
+
+// readImportCSV reads comma-, semicolon- or tab-separated rows, whichever the first line has most of
+func readImportCSV(data []byte) ([]importRecord, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // Excel starts UTF-8 files with a byte order mark
+	if !utf8.Valid(data) {
+		return nil, errors.New("the file isn't UTF-8 text; save it as CSV UTF-8 or as .xlsx")
+	}
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	delimiter, most := ',', 0
+	for _, candidate := range []rune{',', ';', '\t'} {
+		if n := bytes.Count(firstLine, []byte(string(candidate))); n > most {
+			delimiter, most = candidate, n
+		}
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	var records []importRecord
+	for {
+		cells, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if len(cells) > maxImportColumns {
+			cells = cells[:maxImportColumns]
+		}
+		records = append(records, importRecord{Line: line, Cells: cells})
+	}
+	return records, nil
+}
+
+// blank reports whether every cell of the row is empty
+func (r importRecord) blank() bool {
+	for _, cell := range r.Cells {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// detectImportColumns matches the header row's cells to fields. A field only takes its first column.
+func detectImportColumns(header []string) ([]importColumn, map[string]int, error) {
+	columns := make([]importColumn, len(header))
+	fields := make(map[string]int)
+	for i, cell := range header {
+		cell = strings.TrimSpace(cell)
+		columns[i] = importColumn{Index: i, Header: cell}
+		field, ok := importHeaders[looseName(cell)]
+		if _, taken := fields[field]; !ok || taken {
+			continue
+		}
+		columns[i].Field = field
+		fields[field] = i
+	}
+	if _, ok := fields[importFieldStart]; !ok {
+		return nil, nil, errors.New("no start column found; name the column of start times Start Time or Start")
+	}
+	_, end := fields[importFieldEnd]
+	_, minutes := fields[importFieldMinutes]
+	_, hours := fields[importFieldHours]
+	_, duration := fields[importFieldDuration]
+	if !end && !minutes && !hours && !duration {
+		return nil, nil, errors.New("no end or duration column found; name one End Time, Duration (minutes), Hours or Duration")
+	}
+	return columns, fields, nil
+}
+
+// importCell is the trimmed cell of a field in the row, without the apostrophe Excel-safe exports put before text
+// that looks like a formula
+func importCell(cells []string, fields map[string]int, field string) string {
+	i, ok := fields[field]
+	if !ok || i >= len(cells) {
+		return ""
+	}
+	value := strings.TrimSpace(cells[i])
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune("=+-@\t", rune(value[1])) {
+		value = value[1:]
+	}
+	return value
+}
+
+// parseImportTime reads a start or end cell in zone. A cell with only a time of day is on day, when there is one;
+// clockOnly tells the caller so.
+func parseImportTime(value string, day *time.Time, zone *time.Location) (t time.Time, clockOnly bool, err error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	for _, layout := range importDateTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, zone); err == nil {
+			return t, false, nil
+		}
+	}
+	for _, layout := range importClockLayouts {
+		clock, err := time.Parse(layout, strings.ToUpper(value))
+		if err != nil {
+			continue
+		}
+		if day == nil {
+			return time.Time{}, true, fmt.Errorf("%q has no date; add a Date column", value)
+		}
+		return time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, zone), true, nil
+	}
+	return time.Time{}, false, fmt.Errorf("%q isn't a date and time", value)
+}
+
+// parseImportDate reads a date cell in zone
+func parseImportDate(value string, zone *time.Location) (time.Time, error) {
+	for _, layout := range importDateLayouts {
+		if t, err := time.ParseInLocation(layout, value, zone); err == nil {
+			return t, nil
+		}
+	}
+	// Workbooks store a date as midnight
+	for _, layout := range importDateTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, zone); err == nil {
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, zone), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q isn't a date", value)
+}
+
+// parseImportNumber reads "90", "1.5" or "1,5"
+func parseImportNumber(value string) (float64, error) {
+	if !strings.Contains(value, ".") {
+		value = strings.Replace(value, ",", ".", 1)
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q isn't a number", value)
+	}
+	return n, nil
+}
+
+// parseImportDuration reads "1:30", "1:30:00" or "1h30m"
+func parseImportDuration(value string) (time.Duration, error) {
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return d, nil
+	}
+	parts := strings.Split(value, ":")
+	if len(parts) == 2 || len(parts) == 3 {
+		var total time.Duration
+		units := []time.Duration{time.Hour, time.Minute, time.Second}
+		for i, part := range parts {
+			n, err := strconv.Atoi(part)
+			if err != nil || n < 0 || (i > 0 && n > 59) {
+				return 0, fmt.Errorf("%q isn't a duration", value)
+			}
+			total += time.Duration(n) * units[i]
+		}
+		return total, nil
+	}
+	return 0, fmt.Errorf("%q isn't a duration", value)
+}
+
+// parseImportRow reads the round of one row, leaving its group to analyzeImport
+func parseImportRow(record importRecord, fields map[string]int, now time.Time) importRow {
+	cell := func(field string) string {
+		return importCell(record.Cells, fields, field)
+	}
+	row := importRow{
+		Line:       record.Line,
+		GroupName:  cell(importFieldGroup),
+		Note:       truncateString(cell(importFieldNote), 500),
+		ExternalID: truncateString(cell(importFieldID), 191),
+	}
+
+	zone := time.Local
+	if name := cell(importFieldTimeZone); name != "" {
+		if validTimeZone(name) {
+			zone = loadZone(name)
+			if name != time.Local.String() {
+				row.TimeZone = name
+			}
+		} else {
+			row.Warnings = append(row.Warnings, fmt.Sprintf("unknown time zone %q, read as home time", name))
+		}
+	}
+	if tags := cell(importFieldTags); tags != "" {
+		names, err := parseTagNames(tags)
+		if err != nil {
+			row.Warnings = append(row.Warnings, "tags left out: "+err.Error())
+		} else {
+			row.Tags = names
+		}
+	}
+	switch strings.ToLower(cell(importFieldStatus)) {
+	case "in progress", "running":
+		row.Error = "still running in the file"
+		return row
+	}
+
+	var day *time.Time
+	if value := cell(importFieldDate); value != "" {
+		date, err := parseImportDate(value, zone)
+		if err != nil {
+			row.Error = err.Error()
+			return row
+		}
+		day = &date
+	}
+	value := cell(importFieldStart)
+	if value == "" {
+		row.Error = "no start time"
+		return row
+	}
+	start, _, err := parseImportTime(value, day, zone)
+	if err != nil {
+		row.Error = err.Error()
+		return row
+	}
+
+	var end time.Time
+	if value := cell(importFieldEnd); value != "" {
+		// Without an end date, the end is on the day the round started, or the next when it is earlier
+		endDay := time.Date(start.In(zone).Year(), start.In(zone).Month(), start.In(zone).Day(), 0, 0, 0, 0, zone)
+		if value := cell(importFieldEndDate); value != "" {
+			if endDay, err = parseImportDate(value, zone); err != nil {
+				row.Error = err.Error()
+				return row
+			}
+		}
+		var clockOnly bool
+		end, clockOnly, err = parseImportTime(value, &endDay, zone)
+		if err != nil {
+			row.Error = err.Error()
+			return row
+		}
+		if clockOnly && cell(importFieldEndDate) == "" && end.Before(start) {
+			end = end.AddDate(0, 0, 1)
+		}
+	} else {
+		var length time.Duration
+		switch {
+		case cell(importFieldMinutes) != "":
+			var minutes float64
+			minutes, err = parseImportNumber(cell(importFieldMinutes))
+			length = time.Duration(minutes * float64(time.Minute))
+		case cell(importFieldHours) != "":
+			var hours float64
+			hours, err = parseImportNumber(cell(importFieldHours))
+			length = time.Duration(hours * float64(time.Hour))
+		case cell(importFieldDuration) != "":
+			length, err = parseImportDuration(cell(importFieldDuration))
+		default:
+			row.Error = "no end time or duration"
+			return row
+		}
+		if err != nil {
+			row.Error = err.Error()
+			return row
+		}
+		end = start.Add(length.Round(time.Second))
+	}
+
+	row.Start, row.End = &start, &end
+	switch {
+	case !end.After(start):
+		row.Error = "ends before it starts"
+	case end.After(now):
+		row.Error = "ends in the future"
+	case end.Sub(start) > 24*time.Hour:
+		row.Warnings = append(row.Warnings, "longer than a day")
+	}
+	return row
+}
+
+// analyzeImport works out what importing the staged file does, writing nothing: the round of each row, the group
+// each group name goes to and the duplicates importDeduper finds. A name goes to the group chosen for it, else to the
+// group its external ID of system file is mapped to, else to the group of the same name or path, else to the
+// staged file's default group.
+func analyzeImport(tx *gorm.DB, staged StagedImport, chosen map[string]uint) (importAnalysis, error) {
+	var analysis importAnalysis
+	records, err := readImportFile(staged.FileName, staged.Data)
+	if err != nil {
+		return analysis, fmt.Errorf("%w: %v", errUnreadableImport, err)
+	}
+	headerAt := 0
+	for headerAt < len(records) && records[headerAt].blank() {
+		headerAt++
+	}
+	if headerAt == len(records) {
+		return analysis, fmt.Errorf("%w: the file is empty", errUnreadableImport)
+	}
+	columns, fields, err := detectImportColumns(records[headerAt].Cells)
+	if err != nil {
+		return analysis, fmt.Errorf("%w: %v", errUnreadableImport, err)
+	}
+	analysis.Columns = columns
+
+	now := time.Now()
+	for _, record := range records[headerAt+1:] {
+		if record.blank() {
+			continue
+		}
+		if len(analysis.Rows) == maxImportRows {
+			return analysis, fmt.Errorf("%w: it has more than %d rows; split it", errUnreadableImport, maxImportRows)
+		}
+		analysis.Rows = append(analysis.Rows, parseImportRow(record, fields, now))
+	}
+
+	groups, err := getWorkingGroupsOrdered(staged.UserID)
+	if err != nil {
+		return analysis, err
+	}
+	paths := groupPaths(groups)
+	byName := make(map[string]uint)
+	known := make(map[uint]bool, len(groups))
+	for _, group := range groups {
+		known[group.ID] = true
+		for _, name := range []string{group.Name, paths[group.ID]} {
+			if _, ok := byName[looseName(name)]; !ok {
+				byName[looseName(name)] = group.ID
+			}
+		}
+	}
+	if !known[staged.DefaultGroupID] {
+		return analysis, errGroupNotFound
+	}
+
+	matches := make(map[string]int)
+	for _, row := range analysis.Rows {
+		if index, ok := matches[row.GroupName]; ok {
+			analysis.Groups[index].Rows++
+			continue
+		}
+		match := importGroupMatch{Name: row.GroupName, Rows: 1, GroupID: staged.DefaultGroupID, MatchedBy: importMatchDefault}
+		if match.Name != "" {
+			mapping, err := findExternalMapping(tx, staged.UserID, importMappingSystem, mappingGroup, truncateString(match.Name, 191))
+			switch {
+			case err == nil:
+				match.GroupID, match.MatchedBy = mapping.LocalID, importMatchMapping
+			case !errors.Is(err, gorm.ErrRecordNotFound):
+				return analysis, err
+			default:
+				if groupID, ok := byName[looseName(match.Name)]; ok && looseName(match.Name) != "" {
+					match.GroupID, match.MatchedBy = groupID, importMatchName
+				}
+			}
+		}
+		if groupID, ok := chosen[match.Name]; ok && groupID != match.GroupID {
+			if !known[groupID] {
+				return analysis, errGroupNotFound
+			}
+			match.GroupID, match.MatchedBy = groupID, importMatchChosen
+		}
+		match.GroupPath = paths[match.GroupID]
+		matches[row.GroupName] = len(analysis.Groups)
+		analysis.Groups = append(analysis.Groups, match)
+	}
+
+	dedup := newImportDeduper(tx, staged.UserID)
+	for i := range analysis.Rows {
+		row := &analysis.Rows[i]
+		row.GroupID = analysis.Groups[matches[row.GroupName]].GroupID
+		if row.Error != "" {
+			continue
+		}
+		duplicate, err := dedup.check(row.candidate())
+		if err != nil {
+			return analysis, err
+		}
+		if duplicate != nil {
+			row.duplicate = duplicate
+			row.DuplicateOf = duplicate.RoundID
+			row.DuplicateReason = duplicate.Reason
+			continue
+		}
+		var overlapping int64
+		if err := tx.Model(&Round{}).Where("working_group_id = ? AND start_time < ? AND (end_time IS NULL OR end_time > ?)",
+			row.GroupID, *row.End, *row.Start).Count(&overlapping).Error; err != nil {
+			return analysis, err
+		}
+		if overlapping > 0 {
+			row.Warnings = append(row.Warnings, "overlaps a tracked round")
+		}
+	}
+	return analysis, nil
+}
+
+// candidate is the round a row becomes, for importDeduper
+func (r importRow) candidate() importCandidate {
+	return importCandidate{Source: sourceFile, ExternalID: r.ExternalID, GroupID: r.GroupID, Start: *r.Start, End: *r.End,
+		Note: r.Note}
+}
+
+// preview is the analysis as shown before confirming: the first limit rows, and the problems of all
+func (a importAnalysis) preview(staged StagedImport, limit int) importPreview {
+	preview := importPreview{
+		Token:     staged.Token,
+		ExpiresAt: staged.ExpiresAt,
+		FileName:  staged.FileName,
+		Columns:   a.Columns,
+		Groups:    a.Groups,
+		Rows:      a.Rows[:min(limit, len(a.Rows))],
+		TotalRows: len(a.Rows),
+		Problems:  []importProblem{},
+	}
+	problem := func(row importRow, message string, skipped bool) {
+		if len(preview.Problems) < importProblemLimit {
+			preview.Problems = append(preview.Problems, importProblem{Line: row.Line, Message: message, Skipped: skipped})
+		}
+	}
+	for _, row := range a.Rows {
+		switch {
+		case row.Error != "":
+			preview.Invalid++
+			problem(row, row.Error, true)
+		case row.duplicate != nil:
+			preview.Duplicates++
+			message := "duplicate: " + row.DuplicateReason
+			if row.DuplicateOf != 0 {
+				message += fmt.Sprintf(" (round #%d)", row.DuplicateOf)
+			}
+			problem(row, message, true)
+		default:
+			preview.Importable++
+		}
+		for _, warning := range row.Warnings {
+			problem(row, warning, !row.importable())
+		}
+	}
+	return preview
+}
+
+// stageImport keeps an uploaded file for stagedImportTTL, under a token only its uploader can confirm it with. Files
+// whose preview expired are removed on the way.
+func stageImport(userID, defaultGroupID uint, fileName string, data []byte) (StagedImport, error) {
+	if _, err := findUserGroup(userID, defaultGroupID); err != nil {
+		return StagedImport{}, errGroupNotFound
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return StagedImport{}, err
+	}
+	now := time.Now()
+	if err := db.Where("expires_at < ?", now).Delete(&StagedImport{}).Error; err != nil {
+		log.Println("Error removing expired import previews:", err)
+	}
+	staged := StagedImport{
+		UserID:         userID,
+		Token:          hex.EncodeToString(buf),
+		FileName:       truncateString(fileName, 255),
+		DefaultGroupID: defaultGroupID,
+		Data:           data,
+		ExpiresAt:      now.Add(stagedImportTTL),
+	}
+	return staged, db.Create(&staged).Error
+}
+
+// findStagedImport loads the user's staged file by its token, unless it expired
+func findStagedImport(tx *gorm.DB, userID uint, token string) (StagedImport, error) {
+	var staged StagedImport
+	err := tx.Where("user_id = ? AND token = ? AND expires_at > ?", userID, token, time.Now()).Take(&staged).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return staged, errStagedImportNotFound
+	}
+	return staged, err
+}
+
+// previewStagedImport analyzes a staged file, removing it when it can't be imported at all
+func previewStagedImport(staged StagedImport, chosen map[string]uint, limit int) (importPreview, error) {
+	analysis, err := analyzeImport(db, staged, chosen)
+	if errors.Is(err, errUnreadableImport) {
+		db.Delete(&staged)
+	}
+	if err != nil {
+		return importPreview{}, err
+	}
+	return analysis.preview(staged, limit), nil
+}
+
+// confirmImport imports the rows of the staged file the preview found importable, again leaving out duplicates, and
+// removes the file in the same transaction, so confirming twice imports nothing twice. With remember, the groups of
+// the names in the file are saved as external IDs of system file for the next import.
+func confirmImport(client ClientInfo, token string, chosen map[string]uint, remember bool) (importAnalysis, []Round, error) {
+	var analysis importAnalysis
+	var created []Round
+	var rows []importRow // The row of each created round
+	var fileName string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		staged, err := findStagedImport(tx, client.UserID, token)
+		if err != nil {
+			return err
+		}
+		if analysis, err = analyzeImport(tx, staged, chosen); err != nil {
+			return err
+		}
+		fileName = staged.FileName
+		for _, row := range analysis.Rows {
+			if !row.importable() {
+				continue
+			}
+			round := Round{
+				StartTime:      *row.Start,
+				EndTime:        row.End,
+				WorkingGroupID: row.GroupID,
+				Note:           row.Note,
+				StartedBy:      client.Name,
+				StartUserAgent: client.UserAgent,
+				StoppedBy:      client.Name,
+				StopUserAgent:  client.UserAgent,
+				TimeZone:       row.TimeZone,
+				Source:         client.Source,
+				ExternalID:     row.ExternalID,
+			}
+			if err := tx.Create(&round).Error; err != nil {
+				return err
+			}
+			created = append(created, round)
+			rows = append(rows, row)
+		}
+		if remember {
+			for _, match := range analysis.Groups {
+				if match.Name == "" || match.MatchedBy == importMatchMapping || len(match.Name) > 191 {
+					continue
+				}
+				if _, err := saveExternalMapping(tx, client.UserID, importMappingSystem, mappingGroup, match.Name, match.GroupID); err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Delete(&staged).Error
+	})
+	if err != nil {
+		return analysis, nil, err
+	}
+
+	groups := make(map[uint]bool)
+	for i := range created {
+		round := &created[i]
+		recordAudit("round.import", client, round.WorkingGroupID, &round.ID,
+			fmt.Sprintf("Imported line %d of '%s'", rows[i].Line, fileName))
+		if len(rows[i].Tags) > 0 {
+			if err := tagRound(round, rows[i].Tags, client); err != nil {
+				log.Println("Error tagging imported round:", err)
+			}
+		}
+		groups[round.WorkingGroupID] = true
+	}
+	for groupID := range groups {
+		notifyRoundChange(groupID)
+	}
+	return analysis, created, nil
+}
+
+// skipped lists the rows left out as duplicates and counts those that can't be imported
+func (a importAnalysis) skipped() ([]importDuplicate, int) {
+	var duplicates []importDuplicate
+	invalid := 0
+	for _, row := range a.Rows {
+		switch {
+		case row.Error != "":
+			invalid++
+		case row.duplicate != nil:
+			duplicates = append(duplicates, *row.duplicate)
+		}
+	}
+	return duplicates, invalid
+}
+
+// importPreviewLimit is how many rows a preview lists, by the rows form field or query parameter
+func importPreviewLimit(c *fiber.Ctx) int {
+	limit, err := strconv.Atoi(c.FormValue("rows", c.Query("rows")))
+	if err != nil || limit <= 0 {
+		return importPreviewRows
+	}
+	return min(limit, maxImportPreviewRows)
+}
+
+// uploadedImport reads the file field of a multipart request
+func uploadedImport(c *fiber.Ctx) (string, []byte, error) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		return "", nil, errors.New("upload a .csv or .xlsx file")
+	}
+	file, err := header.Open()
+	if err != nil {
+		return "", nil, errors.New("error reading the uploaded file")
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", nil, errors.New("error reading the uploaded file")
+	}
+	return header.Filename, data, nil
+}
+
+// chosenImportGroups reads the groups picked on the preview page: name_N is a name in the file, group_N its group
+func chosenImportGroups(c *fiber.Ctx) (map[string]uint, error) {
+	count, err := strconv.Atoi(c.FormValue("group_count", "0"))
+	if err != nil || count < 0 || count > maxImportRows {
+		return nil, errGroupNotFound
+	}
+	chosen := make(map[string]uint, count)
+	for i := 0; i < count; i++ {
+		groupID, err := parseGroupID(c.FormValue(fmt.Sprintf("group_%d", i)))
+		if err != nil {
+			return nil, errGroupNotFound
+		}
+		chosen[c.FormValue(fmt.Sprintf("name_%d", i))] = groupID
+	}
+	return chosen, nil
+}
+
+// sendImportError answers a preview or confirmation that failed
+func sendImportError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errUnreadableImport):
+		return c.Status(400).SendString(err.Error())
+	case errors.Is(err, errStagedImportNotFound):
+		return c.Status(404).SendString("The import preview expired or was imported already; upload the file again")
+	case errors.Is(err, errGroupNotFound):
+		return c.Status(404).SendString("Working group not found")
+	default:
+		requestLog(c).Println("Error importing file:", err)
+		return c.Status(500).SendString("Error importing file")
+	}
+}
+
+// sendAPIImportError is the JSON counterpart of sendImportError
+func sendAPIImportError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errUnreadableImport):
+		return c.Status(400).JSON(apiError{err.Error()})
+	case errors.Is(err, errStagedImportNotFound):
+		return c.Status(404).JSON(apiError{err.Error()})
+	case errors.Is(err, errGroupNotFound):
+		return c.Status(404).JSON(apiError{"working group not found"})
+	default:
+		requestLog(c).Println("Error importing file:", err)
+		return c.Status(500).JSON(apiError{"error importing file"})
+	}
+}
+
+func renderFileImport(c *fiber.Ctx) error {
+	groups, err := getWorkingGroupsOrdered(currentUserID(c))
+	if err != nil {
+		requestLog(c).Println("Error fetching working groups:", err)
+		return c.Status(500).SendString("Error loading file import")
+	}
+	return c.Render("file_import", fiber.Map{
+		"Groups":         groups,
+		"PreviewRows":    importPreviewRows,
+		"MaxPreviewRows": maxImportPreviewRows,
+		"TTL":            formatDuration(int64(stagedImportTTL.Seconds())),
+	})
+}
+
+// previewFileImportHandler stages an uploaded file and shows its preview, or shows the preview of a staged file
+// again with the groups picked on it
+func previewFileImportHandler(c *fiber.Ctx) error {
+	userID := currentUserID(c)
+	var staged StagedImport
+	var chosen map[string]uint
+	var err error
+	if token := c.FormValue("token"); token != "" {
+		if staged, err = findStagedImport(db, userID, token); err != nil {
+			return sendImportError(c, err)
+		}
+		if chosen, err = chosenImportGroups(c); err != nil {
+			return c.Status(400).SendString("Invalid working group")
+		}
+	} else {
+		groupID, err := parseGroupID(c.FormValue("group_id"))
+		if err != nil {
+			return c.Status(400).SendString("Invalid working group")
+		}
+		name, data, err := uploadedImport(c)
+		if err != nil {
+			return c.Status(400).SendString(err.Error())
+		}
+		if staged, err = stageImport(userID, groupID, name, data); err != nil {
+			return sendImportError(c, err)
+		}
+	}
+
+	preview, err := previewStagedImport(staged, chosen, importPreviewLimit(c))
+	if err != nil {
+		return sendImportError(c, err)
+	}
+	groups, err := getWorkingGroupsOrdered(userID)
+	if err != nil {
+		requestLog(c).Println("Error fetching working groups:", err)
+		return c.Status(500).SendString("Error preparing file import")
+	}
+	paths := groupPaths(groups)
+
+	matches := make([]fiber.Map, len(preview.Groups))
+	for i, match := range preview.Groups {
+		var options []StatusGroupOption
+		for _, group := range groups {
+			options = append(options, StatusGroupOption{ID: group.ID, Name: paths[group.ID], Selected: group.ID == match.GroupID})
+		}
+		matches[i] = fiber.Map{
+			"Index":     i,
+			"Name":      match.Name,
+			"Rows":      match.Rows,
+			"MatchedBy": match.MatchedBy,
+			"Options":   options,
+		}
+	}
+	rows := make([]fiber.Map, len(preview.Rows))
+	for i, row := range preview.Rows {
+		duration := ""
+		if row.Start != nil && row.End != nil {
+			duration = formatDuration(int64(row.End.Sub(*row.Start).Seconds()))
+		}
+		rows[i] = fiber.Map{
+			"Line":            row.Line,
+			"GroupID":         row.GroupID,
+			"GroupPath":       paths[row.GroupID],
+			"Start":           row.Start,
+			"End":             row.End,
+			"Duration":        duration,
+			"Note":            row.Note,
+			"Tags":            row.Tags,
+			"Error":           row.Error,
+			"DuplicateOf":     row.DuplicateOf,
+			"DuplicateReason": row.DuplicateReason,
+			"Warnings":        row.Warnings,
+		}
+	}
+	return c.Render("file_import_preview", fiber.Map{
+		"Preview":    preview,
+		"Groups":     matches,
+		"GroupCount": len(matches),
+		"Rows":       rows,
+		"MoreRows":   preview.TotalRows - len(rows),
+		"Limit":      importPreviewLimit(c),
+	})
+}
+
+// confirmFileImportHandler imports the staged file of a preview and shows what was imported and skipped
+func confirmFileImportHandler(c *fiber.Ctx) error {
+	chosen, err := chosenImportGroups(c)
+	if err != nil {
+		return c.Status(400).SendString("Invalid working group")
+	}
+	client := clientInfoFromRequest(c)
+	client.Name = "file-import"
+	client.Source = sourceFile
+
+	analysis, created, err := confirmImport(client, c.FormValue("token"), chosen, c.FormValue("remember") != "")
+	if err != nil {
+		return sendImportError(c, err)
+	}
+	report := importReport{Source: sourceFile, ImportPath: "/import/file", Created: len(created)}
+	report.Skipped, report.Invalid = analysis.skipped()
+	requestLog(c).Printf("Imported %d round(s) from a file, skipped %d duplicate(s) and %d invalid row(s)", report.Created,
+		len(report.Skipped), report.Invalid)
+	return renderImportReport(c, report)
+}
+
+// apiImportPreview stages a file uploaded as the multipart field file and returns its preview with the token that
+// confirms it. Rows no group matches go to group_id, the first group without one.
+func apiImportPreview(c *fiber.Ctx) error {
+	userID := currentUserID(c)
+	var groupID uint
+	if value := c.FormValue("group_id"); value != "" {
+		parsed, err := parseGroupID(value)
+		if err != nil {
+			return c.Status(400).JSON(apiError{"invalid group_id"})
+		}
+		groupID = parsed
+	}
+	groupID, err := resolveAPIGroup(userID, groupID)
+	if err != nil {
+		return sendAPIImportError(c, err)
+	}
+	name, data, err := uploadedImport(c)
+	if err != nil {
+		return c.Status(400).JSON(apiError{err.Error()})
+	}
+	staged, err := stageImport(userID, groupID, name, data)
+	if err != nil {
+		return sendAPIImportError(c, err)
+	}
+	preview, err := previewStagedImport(staged, nil, importPreviewLimit(c))
+	if err != nil {
+		return sendAPIImportError(c, err)
+	}
+	return c.JSON(preview)
+}
+
+// apiImportConfirm imports a previewed file by its token
+func apiImportConfirm(c *fiber.Ctx) error {
+	var req importConfirmRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(apiError{"invalid request body"})
+	}
+	if req.Token == "" {
+		return c.Status(400).JSON(apiError{"token is required"})
+	}
+	client := clientInfoFromRequest(c)
+	client.Source = sourceFile
+
+	analysis, created, err := confirmImport(client, req.Token, req.Groups, req.Remember)
+	if err != nil {
+		return sendAPIImportError(c, err)
+	}
+	duplicates, invalid := analysis.skipped()
+	response := importConfirmResponse{Created: len(created), Duplicates: len(duplicates), Invalid: invalid, RoundIDs: []uint{}}
+	for _, round := range created {
+		response.RoundIDs = append(response.RoundIDs, round.ID)
+	}
+	return c.JSON(response)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// forgottenDay is a day on which a user's groups expected time but none was tracked, most likely because tracking
+// was forgotten
+type forgottenDay struct {
+	Username        string
+	Date            time.Time
+	ExpectedSeconds int64
+}
+
+// expectedDaySeconds spreads weeklyTarget over the week starting at start, by date: the hours planned for the group
+// when the week has a plan for it, otherwise its daily target on workdays, with day exceptions replacing the target of
+// their day
+func expectedDaySeconds(planned map[string]int64, dailyTargetMinutes int, exceptions map[string]CapacityException, start time.Time) map[string]int64 {
+	expected := make(map[string]int64, 7)
+	if len(planned) > 0 {
+		for date, seconds := range planned {
+			expected[date] = seconds
+		}
+		return expected
+	}
+	for i := 0; i < 7; i++ {
+		daily := dailyTargetMinutes
+		if i >= workdaysPerWeek {
+			daily = 0
+		}
+		date := start.AddDate(0, 0, i).Format("2006-01-02")
+		if minutes := dayTargetMinutes(daily, exceptions, date); minutes > 0 {
+			expected[date] = int64(minutes) * 60
+		}
+	}
+	return expected
+}
+
+// findForgottenDays lists the days of the week starting at start on which a user's unmuted groups expected time
+// (see expectedDaySeconds) but no round of the user started, per user and by date. A day off entered as an exception
+// of 0 hours or a public holiday isn't expected, and time tracked in any group of the user, muted ones included, counts.
+func findForgottenDays(start time.Time) ([]forgottenDay, error) {
+	end := start.AddDate(0, 0, 7)
+	from, to := start.Format("2006-01-02"), end.Format("2006-01-02")
+
+	var groups []WorkingGroup
+	if err := db.Where("notify_muted = ?", false).Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	var plans []PlannedHours
+	if err := db.Where("date >= ? AND date < ?", from, to).Find(&plans).Error; err != nil {
+		return nil, err
+	}
+	planned := make(map[uint]map[string]int64)
+	for _, plan := range plans {
+		if planned[plan.WorkingGroupID] == nil {
+			planned[plan.WorkingGroupID] = make(map[string]int64)
+		}
+		planned[plan.WorkingGroupID][plan.Date] += int64(plan.Minutes) * 60
+	}
+	exceptions := make(map[uint]map[string]CapacityException)
+	loaded := make(map[uint]bool)
+	for _, group := range groups {
+		if loaded[group.UserID] {
+			continue
+		}
+		loaded[group.UserID] = true
+		userExceptions, err := loadCapacityExceptions(context.Background(), group.UserID, start, end)
+		if err != nil {
+			return nil, err
+		}
+		for groupID, dates := range userExceptions {
+			exceptions[groupID] = dates
+		}
+	}
+
+	expected := make(map[uint]map[string]int64) // By user and date
+	for _, group := range groups {
+		for date, seconds := range expectedDaySeconds(planned[group.ID], group.DailyTargetMinutes, exceptions[group.ID], start) {
+			if expected[group.UserID] == nil {
+				expected[group.UserID] = make(map[string]int64)
+			}
+			expected[group.UserID][date] += seconds
+		}
+	}
+	if len(expected) == 0 {
+		return nil, nil
+	}
+
+	var rounds []struct {
+		UserID    uint
+		StartTime time.Time
+	}
+	err := db.Table("rounds").Select("working_groups.user_id, rounds.start_time").
+		Joins("JOIN working_groups ON working_groups.id = rounds.working_group_id").
+		Where("rounds.start_time >= ? AND rounds.start_time < ?", start, end).
+		Scan(&rounds).Error
+	if err != nil {
+		return nil, err
+	}
+	tracked := make(map[uint]map[string]bool)
+	for _, round := range rounds {
+		if tracked[round.UserID] == nil {
+			tracked[round.UserID] = make(map[string]bool)
+		}
+		tracked[round.UserID][round.StartTime.In(start.Location()).Format("2006-01-02")] = true
+	}
+
+	var users []User
+	if err := db.Select("id, username").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	usernames := make(map[uint]string, len(users))
+	for _, user := range users {
+		usernames[user.ID] = user.Username
+	}
+
+	var days []forgottenDay
+	for userID, dates := range expected {
+		for date, seconds := range dates {
+			if tracked[userID][date] {
+				continue
+			}
+			day, err := time.ParseInLocation("2006-01-02", date, start.Location())
+			if err != nil {
+				continue
+			}
+			days = append(days, forgottenDay{Username: usernames[userID], Date: day, ExpectedSeconds: seconds})
+		}
+	}
+	sort.Slice(days, func(i, j int) bool {
+		if days[i].Username != days[j].Username {
+			return days[i].Username < days[j].Username
+		}
+		return days[i].Date.Before(days[j].Date)
+	})
+	return days, nil
+}
+
+// formatForgottenDays writes the forgotten days for the weekly report, e.g. "• alice: Tuesday, October 6 (08:00:00
+// expected)"; it is empty when there are none
+func formatForgottenDays(days []forgottenDay) string {
+	if len(days) == 0 {
+		return ""
+	}
+	lines := []string{fmt.Sprintf("Nothing tracked on %s:", pluralize(int64(len(days)), "expected day"))}
+	for _, day := range days {
+		line := "• "
+		if day.Username != "" {
+			line += day.Username + ": "
+		}
+		line += fmt.Sprintf("%s (%s expected)", day.Date.Format("Monday, January 2"), formatDuration(day.ExpectedSeconds))
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// allGroupsTarget is the metric summing every working group of the user
+const allGroupsTarget = "All groups"
+
+// grafanaQueryRequest is the body Grafana's simple-JSON datasource posts to /grafana/query
+type grafanaQueryRequest struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	Targets []struct {
+		Target string `json:"target"`
+		RefID  string `json:"refId"`
+		Type   string `json:"type"` // "timeserie" (default) or "table"
+	} `json:"targets"`
+}
+
+// grafanaSeries is one time series; each datapoint is [hours, unix milliseconds at local midnight]
+type grafanaSeries struct {
+	Target     string       `json:"target"`
+	Color      string       `json:"color,omitempty"` // The group's color, for panels and clients that color series themselves
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+type grafanaColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+type grafanaTable struct {
+	Type    string          `json:"type"`
+	Columns []grafanaColumn `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+type grafanaMetric struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// grafanaTest answers the datasource's "Save & test" request
+func grafanaTest(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// grafanaTargets lists the metric names: one per working group plus the sum of all groups
+func grafanaTargets(userID uint) ([]string, error) {
+	groups, err := getWorkingGroupsOrdered(userID)
+	if err != nil {
+		return nil, err
+	}
+	targets := []string{allGroupsTarget}
+	for _, group := range groups {
+		targets = append(targets, group.Name)
+	}
+	return targets, nil
+}
+
+func grafanaSearch(c *fiber.Ctx) error {
+	targets, err := grafanaTargets(currentUserID(c))
+	if err != nil {
+		requestLog(c).Println("Error fetching working groups:", err)
+		return c.Status(500).JSON(apiError{"error fetching working groups"})
+	}
+	return c.JSON(targets)
+}
+
+// grafanaMetrics serves the /metrics variant of newer JSON datasource plugins, with the same targets as
+// grafanaSearch labelled with the group's icon
+func grafanaMetrics(c *fiber.Ctx) error {
+	groups, err := getWorkingGroupsOrdered(currentUserID(c))
+	if err != nil {
+		requestLog(c).Println("Error fetching working groups:", err)
+		return c.Status(500).JSON(apiError{"error fetching working groups"})
+	}
+	metrics := []grafanaMetric{{Label: allGroupsTarget, Value: allGroupsTarget}}
+	for _, group := range groups {
+		label := group.Name
+		if group.Icon != "" {
+			label = group.Icon + " " + group.Name
+		}
+		metrics = append(metrics, grafanaMetric{Label: label, Value: group.Name})
+	}
+	return c.JSON(metrics)
+}
+
+// grafanaAnnotations is required by the datasource protocol; there are no annotations
+func grafanaAnnotations(c *fiber.Ctx) error {
+	return c.JSON([]interface{}{})
+}
+
+// dailyHours sums finished rounds per local day of their start, with a zero for every day without rounds
+func dailyHours(groupIDs []uint, from, to time.Time) ([]time.Time, map[string]float64, error) {
+	from = from.In(time.Local)
+	to = to.In(time.Local)
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.Local)
+
+	var rounds []Round
+	if len(groupIDs) > 0 {
+		if err := db.Select("start_time", "end_time", "paused_seconds").
+			Where("working_group_id IN ? AND end_time IS NOT NULL AND start_time >= ? AND start_time <= ?", groupIDs, start, to).
+			Find(&rounds).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+
+	hours := make(map[string]float64)
+	for _, round := range rounds {
+		hours[round.StartTime.Format("2006-01-02")] += float64(roundWorkedSeconds(round, *round.EndTime)) / 3600
+	}
+
+	var days []time.Time
+	for day := start; !day.After(to); day = day.AddDate(0, 0, 1) {
+		days = append(days, day)
+	}
+	return days, hours, nil
+}
+
+// grafanaQuery returns per-day hours for each requested group over the dashboard's time range
+func grafanaQuery(c *fiber.Ctx) error {
+	var request grafanaQueryRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(400).JSON(apiError{"invalid query"})
+	}
+	if request.Range.From.IsZero() || request.Range.To.IsZero() || request.Range.To.Before(request.Range.From) {
+		return c.Status(400).JSON(apiError{"invalid time range"})
+	}
+	if request.Range.To.Sub(request.Range.From) > 10*366*24*time.Hour {
+		return c.Status(400).JSON(apiError{"time range too long"})
+	}
+
+	groups, err := getWorkingGroupsOrdered(currentUserID(c))
+	if err != nil {
+		requestLog(c).Println("Error fetching working groups:", err)
+		return c.Status(500).JSON(apiError{"error fetching working groups"})
+	}
+	groupIDs := make(map[string][]uint)
+	colors := make(map[string]string)
+	for _, group := range groups {
+		groupIDs[group.Name] = []uint{group.ID}
+		colors[group.Name] = groupColor(group)
+		groupIDs[allGroupsTarget] = append(groupIDs[allGroupsTarget], group.ID)
+	}
+
+	var response []interface{}
+	for _, target := range request.Targets {
+		ids, ok := groupIDs[target.Target]
+		if !ok {
+			continue
+		}
+		days, hours, err := dailyHours(ids, request.Range.From, request.Range.To)
+		if err != nil {
+			requestLog(c).Println("Error querying rounds for Grafana:", err)
+			return c.Status(500).JSON(apiError{"error querying rounds"})
+		}
+
+		if target.Type == "table" {
+			table := grafanaTable{
+				Type:    "table",
+				Columns: []grafanaColumn{{Text: "Time", Type: "time"}, {Text: target.Target, Type: "number"}},
+				Rows:    [][]interface{}{},
+			}
+			for _, day := range days {
+				table.Rows = append(table.Rows, []interface{}{day.UnixMilli(), hours[day.Format("2006-01-02")]})
+			}
+			response = append(response, table)
+			continue
+		}
+
+		series := grafanaSeries{Target: target.Target, Color: colors[target.Target], Datapoints: [][2]float64{}}
+		for _, day := range days {
+			series.Datapoints = append(series.Datapoints, [2]float64{hours[day.Format("2006-01-02")], float64(day.UnixMilli())})
+		}
+		response = append(response, series)
+	}
+	if response == nil {
+		response = []interface{}{}
+	}
+
+	return c.JSON(response)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// boardTile is one working group on the all-groups dashboard: whether a round runs and how today and the week compare
+// with the group's targets
+type boardTile struct {
+	GroupID             uint       `json:"group_id"`
+	Name                string     `json:"name"`
+	Path                string     `json:"path"` // e.g. "Client A › Backend"
+	Color               string     `json:"color"`
+	Icon                string     `json:"icon,omitempty"`
+	Running             bool       `json:"running"`
+	RoundID             *uint      `json:"round_id,omitempty"`      // The running round
+	RunningSince        *time.Time `json:"running_since,omitempty"` // Start of the running round
+	StartedBy           string     `json:"started_by,omitempty"`
+	TodaySeconds        int64      `json:"today_seconds"` // Running rounds counted up to generated_at
+	WeekSeconds         int64      `json:"week_seconds"`
+	DailyTargetSeconds  int64      `json:"daily_target_seconds,omitempty"`
+	WeeklyTargetSeconds int64      `json:"weekly_target_seconds,omitempty"`
+	TodayLevel          string     `json:"today_level,omitempty"` // under, on or over, empty without a target
+	WeekLevel           string     `json:"week_level,omitempty"`
+	TodayClass          string     `json:"-"`
+	WeekClass           string     `json:"-"`
+}
+
+// boardState is GET /api/v1/board: every group of the user at once, in the order of the group tree
+type boardState struct {
+	GeneratedAt  time.Time   `json:"generated_at"` // Clients count running tiles up from here
+	Running      int         `json:"running"`      // Groups with a running round
+	TodaySeconds int64       `json:"today_seconds"`
+	WeekSeconds  int64       `json:"week_seconds"`
+	Groups       []boardTile `json:"groups"`
+}
+
+// buildBoardState builds the tiles of every group with a fixed number of queries however many groups there are: the
+// groups, one sum of all their rounds, their running rounds, the planned hours and the day exceptions of the week
+func buildBoardState(ctx context.Context, userID uint) (boardState, error) {
+	ctx, span := tracer.Start(ctx, "buildBoardState")
+	defer span.End()
+
+	now := time.Now()
+	state := boardState{GeneratedAt: now, Groups: []boardTile{}}
+	groups, err := getWorkingGroupsOrdered(userID)
+	if err != nil {
+		return state, err
+	}
+	totals, err := sumRoundTotals(ctx, userRounds(userID))
+	if err != nil {
+		return state, err
+	}
+	var running []Round
+	if err := db.WithContext(ctx).Select("id", "working_group_id", "start_time", "started_by").
+		Scopes(userRounds(userID)).Where("end_time IS NULL").Order("start_time DESC").Find(&running).Error; err != nil {
+		return state, err
+	}
+	active := make(map[uint]Round, len(running))
+	for _, round := range running {
+		if _, ok := active[round.WorkingGroupID]; !ok {
+			active[round.WorkingGroupID] = round
+		}
+	}
+	week := weekStart(now)
+	planned, err := plannedWeekSeconds(ctx, userID, week)
+	if err != nil {
+		log.Println("Error loading planned hours:", err)
+	}
+	exceptions, err := loadCapacityExceptions(ctx, userID, week, week.AddDate(0, 0, 7))
+	if err != nil {
+		log.Println("Error loading day exceptions:", err)
+	}
+
+	today := now.Format("2006-01-02")
+	paths := groupPaths(groups)
+	for _, group := range groups {
+		tile := boardTile{
+			GroupID:      group.ID,
+			Name:         group.Name,
+			Path:         paths[group.ID],
+			Color:        groupColor(group),
+			Icon:         group.Icon,
+			TodaySeconds: totals[group.ID].TodaySeconds,
+			WeekSeconds:  totals[group.ID].WeekSeconds,
+		}
+		if round, ok := active[group.ID]; ok {
+			tile.Running = true
+			tile.RoundID = &round.ID
+			tile.RunningSince = &round.StartTime
+			tile.StartedBy = round.StartedBy
+			state.Running++
+		}
+		tile.DailyTargetSeconds = int64(dayTargetMinutes(group.DailyTargetMinutes, exceptions[group.ID], today)) * 60
+		tile.WeeklyTargetSeconds = weeklyTarget(planned[group.ID], group.DailyTargetMinutes, exceptions[group.ID], week)
+		tile.TodayLevel = targetLevel(tile.TodaySeconds, tile.DailyTargetSeconds)
+		tile.WeekLevel = targetLevel(tile.WeekSeconds, tile.WeeklyTargetSeconds)
+		tile.TodayClass = targetLevelClass(tile.TodayLevel)
+		tile.WeekClass = targetLevelClass(tile.WeekLevel)
+		state.TodaySeconds += tile.TodaySeconds
+		state.WeekSeconds += tile.WeekSeconds
+		state.Groups = append(state.Groups, tile)
+	}
+	return state, nil
+}
+
+// renderBoard shows every group as a live tile; the page refreshes itself from GET /api/v1/board when a round changes
+func renderBoard(c *fiber.Ctx) error {
+	state, err := buildBoardState(traceContext(c), currentUserID(c))
+	if err != nil {
+		requestLog(c).Println("Error building board:", err)
+		return c.Status(500).SendString("Error rendering page")
+	}
+	return c.Render("board", fiber.Map{
+		"Board":       state,
+		"CurrentUser": currentUser(c),
+		"Can":         permissionsView(c),
+	})
+}
+
+// apiBoard returns the tiles of every group in one response, for the all-groups dashboard and wall displays
+func apiBoard(c *fiber.Ctx) error {
+	state, err := buildBoardState(traceContext(c), currentUserID(c))
+	if err != nil {
+		requestLog(c).Println("Error building board:", err)
+		return c.Status(500).JSON(apiError{"error building board"})
+	}
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(state)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// Limits of a group's descriptive fields
+const (
+	groupDescriptionMaxRunes = 1000
+	groupExternalRefMaxRunes = 100
+	groupMetadataMaxEntries  = 50
+	groupMetadataValueMax    = 500
+)
+
+var groupMetadataNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// GroupMetadata is a custom key/value pair of a working group, e.g. cost_center=4711 or po_number=PO-2025-17, passed
+// on in exports for billing systems
+type GroupMetadata struct {
+	ID             uint   `gorm:"primaryKey" json:"-"`
+	WorkingGroupID uint   `gorm:"uniqueIndex:idx_group_metadata_name;not null" json:"-"`
+	Name           string `gorm:"uniqueIndex:idx_group_metadata_name;size:64;not null" json:"name"` // Not "key", reserved in MySQL
+	Value          string `gorm:"size:500;not null" json:"value"`
+}
+
+// parseGroupDescription reads the description of the group form
+func parseGroupDescription(text string) (string, error) {
+	description := strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n"))
+	if utf8.RuneCountInString(description) > groupDescriptionMaxRunes {
+		return "", fmt.Errorf("at most %d characters", groupDescriptionMaxRunes)
+	}
+	return description, nil
+}
+
+// parseGroupExternalRef reads the reference of the group in another system, such as a Jira project key
+func parseGroupExternalRef(text string) (string, error) {
+	ref := strings.TrimSpace(text)
+	if utf8.RuneCountInString(ref) > groupExternalRefMaxRunes || strings.ContainsAny(ref, "\r\n") {
+		return "", fmt.Errorf("at most %d characters on one line", groupExternalRefMaxRunes)
+	}
+	return ref, nil
+}
+
+// parseGroupMetadata reads the metadata field of the group form, one name=value per line. Blank lines are skipped and
+// a name given twice keeps its last value; the result is sorted by name.
+func parseGroupMetadata(text string) ([]GroupMetadata, error) {
+	values := make(map[string]string)
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || !groupMetadataNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("line %d is not name=value with a name of letters, digits, dots, dashes or underscores", i+1)
+		}
+		if utf8.RuneCountInString(value) > groupMetadataValueMax {
+			return nil, fmt.Errorf("the value of %s is longer than %d characters", name, groupMetadataValueMax)
+		}
+		values[name] = value
+	}
+	if len(values) > groupMetadataMaxEntries {
+		return nil, fmt.Errorf("at most %d entries", groupMetadataMaxEntries)
+	}
+	entries := make([]GroupMetadata, 0, len(values))
+	for name, value := range values {
+		entries = append(entries, GroupMetadata{Name: name, Value: value})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries, nil
+}
+
+// formatGroupMetadata writes entries as the form reads them, one name=value per line
+func formatGroupMetadata(entries []GroupMetadata) string {
+	return joinGroupMetadata(entries, "\n")
+}
+
+// joinGroupMetadata writes entries as name=value pairs separated by sep, e.g. "; " for a CSV column
+func joinGroupMetadata(entries []GroupMetadata, sep string) string {
+	pairs := make([]string, len(entries))
+	for i, entry := range entries {
+		pairs[i] = entry.Name + "=" + entry.Value
+	}
+	return strings.Join(pairs, sep)
+}
+
+// groupMetadataMap turns entries into the metadata object of the API
+func groupMetadataMap(entries []GroupMetadata) map[string]string {
+	values := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		values[entry.Name] = entry.Value
+	}
+	return values
+}
+
+// loadGroupMetadata returns the metadata of groups by group ID, sorted by name
+func loadGroupMetadata(tx *gorm.DB, groups []WorkingGroup) (map[uint][]GroupMetadata, error) {
+	metadata := make(map[uint][]GroupMetadata)
+	if len(groups) == 0 {
+		return metadata, nil
+	}
+	groupIDs := make([]uint, len(groups))
+	for i, group := range groups {
+		groupIDs[i] = group.ID
+	}
+	var entries []GroupMetadata
+	if err := tx.Where("working_group_id IN ?", groupIDs).Order("working_group_id ASC, name ASC").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		metadata[entry.WorkingGroupID] = append(metadata[entry.WorkingGroupID], entry)
+	}
+	return metadata, nil
+}
+
+// replaceGroupMetadata makes entries the group's metadata
+func replaceGroupMetadata(tx *gorm.DB, groupID uint, entries []GroupMetadata) error {
+	if err := deleteGroupMetadata(tx, groupID); err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	rows := make([]GroupMetadata, len(entries))
+	for i, entry := range entries {
+		rows[i] = GroupMetadata{WorkingGroupID: groupID, Name: entry.Name, Value: entry.Value}
+	}
+	return tx.Create(&rows).Error
+}
+
+// deleteGroupMetadata removes the metadata of a group, e.g. when it is deleted
+func deleteGroupMetadata(tx *gorm.DB, groupID uint) error {
+	return tx.Where("working_group_id = ?", groupID).Delete(&GroupMetadata{}).Error
+}
+
+// sameGroupMetadata reports whether two sorted lists of entries are equal
+func sameGroupMetadata(a, b []GroupMetadata) bool {
+	return formatGroupMetadata(a) == formatGroupMetadata(b)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// resetSnapshot is the content of the report archived before a group is reset: its rounds as the API returns them,
+// tags included, so the reset can be undone and the time is never lost
+type resetSnapshot struct {
+	GroupID   uint      `json:"group_id"`
+	GroupName string    `json:"group_name"`
+	ResetAt   time.Time `json:"reset_at"`
+	Rounds    []Round   `json:"rounds"`
+}
+
+// resetUndoOffer is the undo button the dashboard shows for a while after its group was reset
+type resetUndoOffer struct {
+	ReportID uint
+	Until    string // When the offer ends, e.g. 14:35
+}
+
+var (
+	errResetExpired    = errors.New("the reset can no longer be undone")
+	errResetRunning    = errors.New("the group has a running round; stop it before undoing the reset")
+	errResetGroupGone  = errors.New("the group of the reset no longer exists")
+	errResetNotPending = errors.New("no reset to undo")
+)
+
+// resetUndoWindow is how long after a reset it can be undone, RESET_UNDO_WINDOW; 0 when undo is off
+func resetUndoWindow() time.Duration {
+	window, err := time.ParseDuration(cfg.ResetUndoWindow)
+	if err != nil || window < 0 {
+		return 0
+	}
+	return window
+}
+
+// snapshotGroupRounds archives the rounds of a group before they are reset, as a JSON report of kind "reset" that
+// stays downloadable from the report archive. It returns the snapshot, whose rounds are the ones to delete.
+func snapshotGroupRounds(userID uint, group WorkingGroup) (resetSnapshot, ArchivedReport, error) {
+	snapshot := resetSnapshot{GroupID: group.ID, GroupName: group.Name, ResetAt: time.Now()}
+	if err := db.Preload("Tags").Where("working_group_id = ?", group.ID).Order("start_time ASC").Find(&snapshot.Rounds).Error; err != nil {
+		return snapshot, ArchivedReport{}, err
+	}
+	if len(snapshot.Rounds) == 0 {
+		return snapshot, ArchivedReport{}, nil
+	}
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return snapshot, ArchivedReport{}, err
+	}
+	first := snapshot.Rounds[0].StartTime
+	last := snapshot.Rounds[len(snapshot.Rounds)-1].StartTime
+	report, err := archiveReport(ArchivedReport{
+		UserID:         userID,
+		Kind:           reportReset,
+		Title:          fmt.Sprintf("%s of '%s' before the reset", pluralize(int64(len(snapshot.Rounds)), "round"), group.Name),
+		WorkingGroupID: group.ID,
+		GroupName:      group.Name,
+		PeriodStart:    time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, time.Local),
+		PeriodEnd:      time.Date(last.Year(), last.Month(), last.Day()+1, 0, 0, 0, 0, time.Local),
+		FileName:       fmt.Sprintf("reset-%s-%s.json", fileNameSafe(group.Name), snapshot.ResetAt.Format("2006-01-02-150405")),
+		ContentType:    "application/json",
+	}, data)
+	return snapshot, report, err
+}
+
+// pendingResetUndo is the latest reset of a group that can still be undone, nil when there is none
+func pendingResetUndo(userID, groupID uint) *resetUndoOffer {
+	window := resetUndoWindow()
+	if window == 0 {
+		return nil
+	}
+	var report ArchivedReport
+	err := db.Where("user_id = ? AND kind = ? AND working_group_id = ? AND restored_at IS NULL AND created_at > ?",
+		userID, reportReset, groupID, time.Now().Add(-window)).Order("created_at DESC").Take(&report).Error
+	if err != nil {
+		return nil
+	}
+	return &resetUndoOffer{
+		ReportID: report.ID,
+		Until:    report.CreatedAt.Add(window).Format("15:04"),
+	}
+}
+
+// undoGroupReset brings back the rounds of a reset from its snapshot, with their IDs, so attachments and external IDs
+// point at them again, and their tags. Synced instances get them back as well. Rounds tracked since the reset stay.
+func undoGroupReset(userID, reportID uint) (resetSnapshot, error) {
+	var report ArchivedReport
+	if err := db.Where("user_id = ? AND kind = ?", userID, reportReset).Take(&report, reportID).Error; err != nil {
+		return resetSnapshot{}, errResetNotPending
+	}
+	if report.RestoredAt != nil {
+		return resetSnapshot{}, errResetNotPending
+	}
+	if window := resetUndoWindow(); window == 0 || time.Since(report.CreatedAt) > window {
+		return resetSnapshot{}, errResetExpired
+	}
+	if _, err := findUserGroup(userID, report.WorkingGroupID); err != nil {
+		return resetSnapshot{}, errResetGroupGone
+	}
+
+	reader, err := attachments.Open(report.StorageKey)
+	if err != nil {
+		return resetSnapshot{}, fmt.Errorf("opening snapshot: %w", err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return resetSnapshot{}, fmt.Errorf("reading snapshot: %w", err)
+	}
+	var snapshot resetSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return resetSnapshot{}, fmt.Errorf("reading snapshot: %w", err)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Another undo may have run since the report was read
+		result := tx.Model(&ArchivedReport{}).Where("id = ? AND restored_at IS NULL", report.ID).Update("restored_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errResetNotPending
+		}
+		for _, round := range snapshot.Rounds {
+			if round.EndTime != nil {
+				continue
+			}
+			var running int64
+			if err := tx.Model(&Round{}).Where("working_group_id = ? AND end_time IS NULL", report.WorkingGroupID).Count(&running).Error; err != nil {
+				return err
+			}
+			if running > 0 {
+				return errResetRunning
+			}
+		}
+
+		now := time.Now()
+		syncIDs := make([]string, 0, len(snapshot.Rounds))
+		for _, round := range snapshot.Rounds {
+			tags := round.Tags
+			round.Tags = nil
+			round.WorkingGroupID = report.WorkingGroupID
+			round.UpdatedAt = now // So sync sends it again
+			if round.InvoiceID != nil {
+				var invoices int64
+				if err := tx.Model(&Invoice{}).Where("id = ?", *round.InvoiceID).Count(&invoices).Error; err != nil {
+					return err
+				}
+				if invoices == 0 {
+					round.InvoiceID = nil
+				}
+			}
+			var taken int64
+			if err := tx.Model(&Round{}).Where("id = ?", round.ID).Count(&taken).Error; err != nil {
+				return err
+			}
+			if taken > 0 {
+				round.ID = 0
+			}
+			if err := tx.Create(&round).Error; err != nil {
+				return err
+			}
+			for _, tag := range tags {
+				restored := Tag{UserID: userID, Name: tag.Name}
+				if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&restored).Error; err != nil {
+					return err
+				}
+				if err := tx.Where("user_id = ? AND name = ?", userID, tag.Name).Take(&restored).Error; err != nil {
+					return err
+				}
+				if err := tx.Model(&round).Association("Tags").Append(&restored); err != nil {
+					return err
+				}
+			}
+			syncIDs = append(syncIDs, round.SyncID)
+		}
+		return tx.Where("user_id = ? AND entity = ? AND sync_id IN ?", userID, "round", syncIDs).Delete(&SyncTombstone{}).Error
+	})
+	if err != nil {
+		if !errors.Is(err, errResetNotPending) && !errors.Is(err, errResetRunning) {
+			log.Println("Error undoing group reset:", err)
+		}
+		return resetSnapshot{}, err
+	}
+	return snapshot, nil
+}
+
+// undoResetHandler undoes a reset from the dashboard's offer and shows the group with its rounds back
+func undoResetHandler(c *fiber.Ctx) error {
+	reportID, err := parseGroupID(c.FormValue("report_id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid reset")
+	}
+	userID := currentUserID(c)
+	snapshot, err := undoGroupReset(userID, reportID)
+	switch {
+	case errors.Is(err, errResetNotPending):
+		return c.Status(404).SendString("No reset to undo")
+	case errors.Is(err, errResetExpired), errors.Is(err, errResetRunning), errors.Is(err, errResetGroupGone):
+		return c.Status(409).SendString(err.Error())
+	case err != nil:
+		return c.Status(500).SendString("Error undoing the reset")
+	}
+
+	recordAudit("group.reset", clientInfoFromRequest(c), snapshot.GroupID, nil,
+		fmt.Sprintf("Undid the reset of '%s', bringing back %s", snapshot.GroupName, pluralize(int64(len(snapshot.Rounds)), "round")))
+	notifyRoundChange(snapshot.GroupID)
+
+	context, err := buildStatusContext(traceContext(c), userID, snapshot.GroupID)
+	if err != nil {
+		requestLog(c).Println("Error building status context:", err)
+		return c.Status(500).SendString("Error rendering status")
+	}
+	return renderStatusTemplate(c, context)
+}
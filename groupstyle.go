@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// groupPalette colors groups that have no color of their own
+var groupPalette = []string{"#485fc7", "#00b89c", "#f14668", "#ffb70f", "#8e44ad", "#3e8ed0", "#e67e22", "#2c3e50"}
+
+// groupIconMaxRunes leaves room for emoji made of several code points, like flags or 👩‍💻
+const groupIconMaxRunes = 8
+
+var groupColorPattern = regexp.MustCompile(`^#(?:[0-9a-f]{3}|[0-9a-f]{6})$`)
+
+// groupColor is the color a group is shown in: its own, or one of groupPalette picked by its ID, so a group keeps its
+// color on every page even when groups are added or renamed
+func groupColor(group WorkingGroup) string {
+	if group.Color != "" {
+		return group.Color
+	}
+	if group.ID == 0 {
+		return groupPalette[0]
+	}
+	return groupPalette[int((group.ID-1)%uint(len(groupPalette)))]
+}
+
+// groupColors maps every group to groupColor
+func groupColors(groups []WorkingGroup) map[uint]string {
+	colors := make(map[uint]string, len(groups))
+	for _, group := range groups {
+		colors[group.ID] = groupColor(group)
+	}
+	return colors
+}
+
+// parseGroupColor reads a color of the group form as #rrggbb; empty picks one from groupPalette
+func parseGroupColor(text string) (string, error) {
+	color := strings.ToLower(strings.TrimSpace(text))
+	if color == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(color, "#") {
+		color = "#" + color
+	}
+	if !groupColorPattern.MatchString(color) {
+		return "", fmt.Errorf("%q is not a color like #3e8ed0", text)
+	}
+	if len(color) == 4 {
+		color = string([]byte{'#', color[1], color[1], color[2], color[2], color[3], color[3]})
+	}
+	return color, nil
+}
+
+// parseGroupIcon reads the icon of the group form: an emoji or a few characters shown in front of the name
+func parseGroupIcon(text string) (string, error) {
+	icon := strings.TrimSpace(text)
+	if utf8.RuneCountInString(icon) > groupIconMaxRunes || strings.IndexFunc(icon, unicode.IsSpace) >= 0 ||
+		strings.IndexFunc(icon, unicode.IsControl) >= 0 {
+		return "", fmt.Errorf("%q is not a single emoji or symbol", text)
+	}
+	return icon, nil
+}
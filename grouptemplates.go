@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var errUnknownTemplate = errors.New("unknown group template")
+
+// templateGroup is a working group a template creates
+type templateGroup struct {
+	Name               string
+	Icon               string
+	Description        string
+	DailyTargetMinutes int
+	Billable           bool
+	Internal           bool
+}
+
+// groupTemplate is a starter set of working groups for a new account, picked instead of the single default group
+type groupTemplate struct {
+	Key         string
+	Label       string
+	Description string
+	Groups      []templateGroup
+	// Do-not-disturb windows, as typed on the notification settings page; only set up with the first account, as
+	// they are the instance's
+	DNDWindows string
+}
+
+// groupTemplates are offered on /setup and when adding an account on /users, in this order. The first group of each
+// sorts first by name too, so it is the one picked when no group is given.
+var groupTemplates = []groupTemplate{
+	{
+		Key:         "freelancer",
+		Label:       "Freelancer",
+		Description: "Billable client work next to the unbilled time it takes to run the business",
+		Groups: []templateGroup{
+			{Name: "Client Work", Icon: "💼", Description: "Time billed to clients; add a subgroup per client",
+				DailyTargetMinutes: 360, Billable: true},
+			{Name: "Invoicing & Admin", Icon: "🧾", Description: "Bookkeeping, invoices and email", DailyTargetMinutes: 30,
+				Internal: true},
+			{Name: "Sales & Proposals", Icon: "📣", Description: "Finding the next client", DailyTargetMinutes: 30,
+				Internal: true},
+			{Name: "Learning", Icon: "📚", Description: "Courses, reading and side projects", Internal: true},
+		},
+		DNDWindows: "Mon-Fri 19:00-08:00\nSat,Sun",
+	},
+	{
+		Key:         "employee",
+		Label:       "Employee",
+		Description: "An eight-hour working day, split between project work, meetings and admin",
+		Groups: []templateGroup{
+			{Name: "Focus Work", Icon: "🛠", Description: "Project work that needs your full attention", DailyTargetMinutes: 360},
+			{Name: "Meetings", Icon: "👥", Description: "Meetings, calls and stand-ups", DailyTargetMinutes: 60,
+				Internal: true},
+			{Name: "Office Admin", Icon: "📋", Description: "Email, planning and paperwork", DailyTargetMinutes: 60,
+				Internal: true},
+		},
+		DNDWindows: "Mon-Fri 18:00-08:00\nSat,Sun",
+	},
+	{
+		Key:         "student",
+		Label:       "Student",
+		Description: "Lectures, study time and assignments, with room for a side job",
+		Groups: []templateGroup{
+			{Name: "Classes", Icon: "🎓", Description: "Lectures, seminars and labs", DailyTargetMinutes: 180},
+			{Name: "Homework", Icon: "✍️", Description: "Assignments, papers and projects", DailyTargetMinutes: 60},
+			{Name: "Part-time Job", Icon: "💼", Description: "Paid hours next to studying", Billable: true},
+			{Name: "Self-Study", Icon: "📚", Description: "Reading, revision and exam preparation", DailyTargetMinutes: 120},
+		},
+		DNDWindows: "daily 22:00-07:00",
+	},
+}
+
+// findGroupTemplate looks a template up by its key; an empty key is the single default group and no template
+func findGroupTemplate(key string) (groupTemplate, error) {
+	for _, template := range groupTemplates {
+		if strings.EqualFold(template.Key, key) {
+			return template, nil
+		}
+	}
+	return groupTemplate{}, fmt.Errorf("%w %q", errUnknownTemplate, key)
+}
+
+// applyGroupTemplate creates the template's groups for the user. A fresh account's default group, still empty, becomes
+// the first of them, so the template replaces it rather than sitting next to it; groups the user already has by name
+// are left alone. It returns the groups it created or changed.
+func applyGroupTemplate(tx *gorm.DB, userID uint, template groupTemplate) ([]WorkingGroup, error) {
+	var existing []WorkingGroup
+	if err := tx.Scopes(userGroups(userID)).Order("id ASC").Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	taken := make(map[string]bool, len(existing))
+	for _, group := range existing {
+		taken[looseName(group.Name)] = true
+	}
+	var reuse *WorkingGroup
+	if len(existing) == 1 && strings.EqualFold(existing[0].Name, cfg.DefaultGroup) {
+		var rounds int64
+		if err := tx.Model(&Round{}).Where("working_group_id = ?", existing[0].ID).Count(&rounds).Error; err != nil {
+			return nil, err
+		}
+		if rounds == 0 {
+			reuse = &existing[0]
+			delete(taken, looseName(reuse.Name))
+		}
+	}
+
+	var groups []WorkingGroup
+	for _, spec := range template.Groups {
+		if taken[looseName(spec.Name)] {
+			continue
+		}
+		values := map[string]interface{}{
+			"name":                 spec.Name,
+			"icon":                 spec.Icon,
+			"description":          spec.Description,
+			"daily_target_minutes": spec.DailyTargetMinutes,
+			"billable":             spec.Billable,
+			"internal":             spec.Internal,
+		}
+		group := WorkingGroup{UserID: userID, Name: spec.Name}
+		if reuse != nil {
+			group, reuse = *reuse, nil
+		} else if err := tx.Create(&group).Error; err != nil {
+			return nil, err
+		}
+		// A map, as Create leaves out false and zero, which the column defaults would turn into billable
+		if err := tx.Model(&group).Updates(values).Error; err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// applyFirstRunSchedule sets up the template's do-not-disturb windows unless some were set already
+func applyFirstRunSchedule(template groupTemplate) error {
+	if template.DNDWindows == "" || getSetting(dndSettingKey, "") != "" {
+		return nil
+	}
+	return setSetting(dndSettingKey, template.DNDWindows)
+}
+
+// groupTemplateViews lists the templates for a form, with the groups each creates
+func groupTemplateViews(selected string) []fiber.Map {
+	views := make([]fiber.Map, 0, len(groupTemplates))
+	for _, template := range groupTemplates {
+		names := make([]string, len(template.Groups))
+		for i, group := range template.Groups {
+			names[i] = group.Icon + " " + group.Name
+		}
+		views = append(views, fiber.Map{
+			"Key":         template.Key,
+			"Label":       template.Label,
+			"Description": template.Description,
+			"Groups":      strings.Join(names, ", "),
+			"Selected":    template.Key == selected,
+		})
+	}
+	return views
+}
+
+// chosenGroupTemplate reads the template field of an account form; empty is the single default group
+func chosenGroupTemplate(c *fiber.Ctx) (*groupTemplate, error) {
+	key := strings.TrimSpace(c.FormValue("template"))
+	if key == "" {
+		return nil, nil
+	}
+	template, err := findGroupTemplate(key)
+	if err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// groupPathSeparator goes between the names of a group's parents and its own, as in "Client A › Backend › Migration"
+const groupPathSeparator = " › "
+
+var (
+	errUnknownParent = errors.New("parent group not found")
+	errParentCycle   = errors.New("a group can't be placed under itself or one of its subgroups")
+)
+
+// groupParents maps every group to its parent, leaving out top-level groups and parents that aren't among groups
+func groupParents(groups []WorkingGroup) map[uint]uint {
+	known := make(map[uint]bool, len(groups))
+	for _, group := range groups {
+		known[group.ID] = true
+	}
+	parents := make(map[uint]uint)
+	for _, group := range groups {
+		if group.ParentID != nil && known[*group.ParentID] && *group.ParentID != group.ID {
+			parents[group.ID] = *group.ParentID
+		}
+	}
+	return parents
+}
+
+// groupAncestors are the parent, grandparent and so on of a group, nearest first. The walk stops after as many steps
+// as there are groups, so a loop in the rows can't hang a page.
+func groupAncestors(parents map[uint]uint, id uint) []uint {
+	var ancestors []uint
+	for parent, ok := parents[id]; ok && len(ancestors) <= len(parents); parent, ok = parents[parent] {
+		ancestors = append(ancestors, parent)
+	}
+	return ancestors
+}
+
+// sortGroupTree orders groups so every group comes right after its parent, with the subgroups of a parent in the
+// order they had, e.g. by name. Groups whose parent is missing count as top-level.
+func sortGroupTree(groups []WorkingGroup) []WorkingGroup {
+	parents := groupParents(groups)
+	children := make(map[uint][]WorkingGroup)
+	var roots []WorkingGroup
+	for _, group := range groups {
+		if parent, ok := parents[group.ID]; ok {
+			children[parent] = append(children[parent], group)
+		} else {
+			roots = append(roots, group)
+		}
+	}
+
+	sorted := make([]WorkingGroup, 0, len(groups))
+	visited := make(map[uint]bool, len(groups))
+	var visit func(group WorkingGroup)
+	visit = func(group WorkingGroup) {
+		if visited[group.ID] {
+			return
+		}
+		visited[group.ID] = true
+		sorted = append(sorted, group)
+		for _, child := range children[group.ID] {
+			visit(child)
+		}
+	}
+	for _, root := range roots {
+		visit(root)
+	}
+	// Groups in a loop have no top-level ancestor; list them rather than lose them
+	for _, group := range groups {
+		visit(group)
+	}
+	return sorted
+}
+
+// groupPaths names every group with its parents in front, such as "Client A › Backend"; top-level groups keep their
+// name. Groups without a name are called "Group #<id>", as groupLabel does.
+func groupPaths(groups []WorkingGroup) map[uint]string {
+	names := make(map[uint]string, len(groups))
+	for _, group := range groups {
+		names[group.ID] = groupLabelHelper(group.Name, group.ID)
+	}
+	parents := groupParents(groups)
+	paths := make(map[uint]string, len(groups))
+	for _, group := range groups {
+		ancestors := groupAncestors(parents, group.ID)
+		parts := make([]string, len(ancestors)+1)
+		for i, ancestor := range ancestors {
+			parts[len(ancestors)-1-i] = names[ancestor]
+		}
+		parts[len(ancestors)] = names[group.ID]
+		paths[group.ID] = strings.Join(parts, groupPathSeparator)
+	}
+	return paths
+}
+
+// subgroupIDs are all groups below a group: its subgroups, theirs and so on
+func subgroupIDs(groups []WorkingGroup, id uint) []uint {
+	parents := groupParents(groups)
+	var ids []uint
+	for _, group := range groups {
+		for _, ancestor := range groupAncestors(parents, group.ID) {
+			if ancestor == id {
+				ids = append(ids, group.ID)
+				break
+			}
+		}
+	}
+	return ids
+}
+
+// rollUpTotals adds the totals of every group to those of all groups above it, so each level counts the rounds of
+// its subgroups as well as its own
+func rollUpTotals(groups []WorkingGroup, totals map[uint]groupRoundTotals) map[uint]groupRoundTotals {
+	parents := groupParents(groups)
+	rolled := make(map[uint]groupRoundTotals, len(groups))
+	for _, group := range groups {
+		own := totals[group.ID]
+		for _, id := range append([]uint{group.ID}, groupAncestors(parents, group.ID)...) {
+			sum := rolled[id]
+			sum.GroupID = id
+			sum.TodaySeconds += own.TodaySeconds
+			sum.WeekSeconds += own.WeekSeconds
+			sum.TotalSeconds += own.TotalSeconds
+			sum.BillableTodaySeconds += own.BillableTodaySeconds
+			sum.BillableSeconds += own.BillableSeconds
+			sum.Running += own.Running
+			rolled[id] = sum
+		}
+	}
+	return rolled
+}
+
+// checkGroupParent makes sure a group can be placed under parentID: a group of the same user that isn't the group
+// itself or below it. groups are all groups of the user; groupID is 0 for a group yet to be created.
+func checkGroupParent(groups []WorkingGroup, groupID, parentID uint) error {
+	if _, ok := findGroupByID(groups, parentID); !ok {
+		return errUnknownParent
+	}
+	if parentID == groupID {
+		return errParentCycle
+	}
+	for _, id := range subgroupIDs(groups, groupID) {
+		if id == parentID {
+			return errParentCycle
+		}
+	}
+	return nil
+}
+
+// parseParentID reads the parent_id of the group forms, nil for a top-level group
+func parseParentID(value string) (*uint, error) {
+	if value = strings.TrimSpace(value); value == "" || value == "0" {
+		return nil, nil
+	}
+	id, err := parseGroupID(value)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
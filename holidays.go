@@ -0,0 +1,477 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// publicHoliday is a day off by law in a country or region
+type publicHoliday struct {
+	Date string `json:"date"` // YYYY-MM-DD
+	Name string `json:"name"`
+}
+
+// How a holiday that falls on a weekend is made up for
+type holidayMove int
+
+const (
+	moveNone            holidayMove = iota
+	moveNearestWeekday              // Saturday to Friday, Sunday to Monday, like US federal holidays
+	moveNextFreeWeekday             // To the next weekday that isn't a holiday already, like UK substitute days
+	moveSundayBack                  // Sunday to Saturday, like King's Day in the Netherlands
+)
+
+// holidayRule is one holiday of a country: its date in a year, how it moves off weekends, the regions it is limited
+// to and the first year it was observed
+type holidayRule struct {
+	Name    string
+	Date    func(year int) time.Time
+	Move    holidayMove
+	Regions []string // Subdivision codes such as BY; empty for the whole country
+	Since   int      // 0 for always
+}
+
+// holidayCountry is the holidays of a country, with the regions that add their own
+type holidayCountry struct {
+	Name    string
+	Regions map[string]string // Subdivision code to name
+	Rules   []holidayRule
+}
+
+// on is a fixed date of every year
+func on(month time.Month, day int) func(int) time.Time {
+	return func(year int) time.Time { return time.Date(year, month, day, 0, 0, 0, 0, time.UTC) }
+}
+
+// easterPlus is a date relative to Easter Sunday, e.g. -2 for Good Friday and 39 for Ascension Day
+func easterPlus(days int) func(int) time.Time {
+	return func(year int) time.Time { return easterSunday(year).AddDate(0, 0, days) }
+}
+
+// nthWeekday is the nth weekday of a month, counted from the end when n is negative: -1 is the last
+func nthWeekday(month time.Month, weekday time.Weekday, n int) func(int) time.Time {
+	return func(year int) time.Time {
+		if n < 0 {
+			last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC)
+			return last.AddDate(0, 0, -((int(last.Weekday())-int(weekday)+7)%7 + 7*(-n-1)))
+		}
+		first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+		return first.AddDate(0, 0, (int(weekday)-int(first.Weekday())+7)%7+7*(n-1))
+	}
+}
+
+// weekdayBefore is the last weekday on or before a date, e.g. the Wednesday before November 23
+func weekdayBefore(month time.Month, day int, weekday time.Weekday) func(int) time.Time {
+	return func(year int) time.Time {
+		date := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+		return date.AddDate(0, 0, -((int(date.Weekday()) - int(weekday) + 7) % 7))
+	}
+}
+
+// easterSunday computes Easter Sunday of the Gregorian calendar (the anonymous Gregorian algorithm)
+func easterSunday(year int) time.Time {
+	a, b, c := year%19, year/100, year%100
+	d, e := b/4, b%4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i, k := c/4, c%4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
+
+// holidayCountries is the embedded holiday calendar, keyed by ISO 3166-1 code. It has the recurring holidays only;
+// one-off days off such as a coronation or a jubilee are entered as day exceptions.
+var holidayCountries = map[string]holidayCountry{
+	"AT": {
+		Name: "Austria",
+		Rules: []holidayRule{
+			{Name: "New Year's Day", Date: on(time.January, 1)},
+			{Name: "Epiphany", Date: on(time.January, 6)},
+			{Name: "Easter Monday", Date: easterPlus(1)},
+			{Name: "Labour Day", Date: on(time.May, 1)},
+			{Name: "Ascension Day", Date: easterPlus(39)},
+			{Name: "Whit Monday", Date: easterPlus(50)},
+			{Name: "Corpus Christi", Date: easterPlus(60)},
+			{Name: "Assumption Day", Date: on(time.August, 15)},
+			{Name: "National Day", Date: on(time.October, 26)},
+			{Name: "All Saints' Day", Date: on(time.November, 1)},
+			{Name: "Immaculate Conception", Date: on(time.December, 8)},
+			{Name: "Christmas Day", Date: on(time.December, 25)},
+			{Name: "St. Stephen's Day", Date: on(time.December, 26)},
+		},
+	},
+	"DE": {
+		Name: "Germany",
+		Regions: map[string]string{
+			"BW": "Baden-Württemberg", "BY": "Bavaria", "BE": "Berlin", "BB": "Brandenburg", "HB": "Bremen",
+			"HH": "Hamburg", "HE": "Hesse", "MV": "Mecklenburg-Vorpommern", "NI": "Lower Saxony",
+			"NW": "North Rhine-Westphalia", "RP": "Rhineland-Palatinate", "SL": "Saarland", "SN": "Saxony",
+			"ST": "Saxony-Anhalt", "SH": "Schleswig-Holstein", "TH": "Thuringia",
+		},
+		Rules: []holidayRule{
+			{Name: "New Year's Day", Date: on(time.January, 1)},
+			{Name: "Epiphany", Date: on(time.January, 6), Regions: []string{"BW", "BY", "ST"}},
+			{Name: "International Women's Day", Date: on(time.March, 8), Regions: []string{"BE"}, Since: 2019},
+			{Name: "International Women's Day", Date: on(time.March, 8), Regions: []string{"MV"}, Since: 2023},
+			{Name: "Good Friday", Date: easterPlus(-2)},
+			{Name: "Easter Monday", Date: easterPlus(1)},
+			{Name: "Labour Day", Date: on(time.May, 1)},
+			{Name: "Ascension Day", Date: easterPlus(39)},
+			{Name: "Whit Monday", Date: easterPlus(50)},
+			{Name: "Corpus Christi", Date: easterPlus(60), Regions: []string{"BW", "BY", "HE", "NW", "RP", "SL"}},
+			{Name: "Assumption Day", Date: on(time.August, 15), Regions: []string{"SL"}},
+			{Name: "World Children's Day", Date: on(time.September, 20), Regions: []string{"TH"}, Since: 2019},
+			{Name: "German Unity Day", Date: on(time.October, 3)},
+			{Name: "Reformation Day", Date: on(time.October, 31), Regions: []string{"BB", "MV", "SN", "ST", "TH"}},
+			{Name: "Reformation Day", Date: on(time.October, 31), Regions: []string{"HB", "HH", "NI", "SH"}, Since: 2018},
+			{Name: "All Saints' Day", Date: on(time.November, 1), Regions: []string{"BW", "BY", "NW", "RP", "SL"}},
+			{Name: "Repentance and Prayer Day", Date: weekdayBefore(time.November, 22, time.Wednesday), Regions: []string{"SN"}},
+			{Name: "Christmas Day", Date: on(time.December, 25)},
+			{Name: "St. Stephen's Day", Date: on(time.December, 26)},
+		},
+	},
+	"ES": {
+		Name: "Spain",
+		Rules: []holidayRule{
+			{Name: "New Year's Day", Date: on(time.January, 1)},
+			{Name: "Epiphany", Date: on(time.January, 6)},
+			{Name: "Good Friday", Date: easterPlus(-2)},
+			{Name: "Labour Day", Date: on(time.May, 1)},
+			{Name: "Assumption Day", Date: on(time.August, 15)},
+			{Name: "National Day", Date: on(time.October, 12)},
+			{Name: "All Saints' Day", Date: on(time.November, 1)},
+			{Name: "Constitution Day", Date: on(time.December, 6)},
+			{Name: "Immaculate Conception", Date: on(time.December, 8)},
+			{Name: "Christmas Day", Date: on(time.December, 25)},
+		},
+	},
+	"FR": {
+		Name: "France",
+		Rules: []holidayRule{
+			{Name: "New Year's Day", Date: on(time.January, 1)},
+			{Name: "Easter Monday", Date: easterPlus(1)},
+			{Name: "Labour Day", Date: on(time.May, 1)},
+			{Name: "Victory in Europe Day", Date: on(time.May, 8)},
+			{Name: "Ascension Day", Date: easterPlus(39)},
+			{Name: "Whit Monday", Date: easterPlus(50)},
+			{Name: "Bastille Day", Date: on(time.July, 14)},
+			{Name: "Assumption Day", Date: on(time.August, 15)},
+			{Name: "All Saints' Day", Date: on(time.November, 1)},
+			{Name: "Armistice Day", Date: on(time.November, 11)},
+			{Name: "Christmas Day", Date: on(time.December, 25)},
+		},
+	},
+	"GB": {
+		Name:    "United Kingdom",
+		Regions: map[string]string{"ENG": "England", "WLS": "Wales", "SCT": "Scotland", "NIR": "Northern Ireland"},
+		Rules: []holidayRule{
+			{Name: "New Year's Day", Date: on(time.January, 1), Move: moveNextFreeWeekday},
+			{Name: "2nd January", Date: on(time.January, 2), Move: moveNextFreeWeekday, Regions: []string{"SCT"}},
+			{Name: "St Patrick's Day", Date: on(time.March, 17), Move: moveNextFreeWeekday, Regions: []string{"NIR"}},
+			{Name: "Good Friday", Date: easterPlus(-2)},
+			{Name: "Easter Monday", Date: easterPlus(1), Regions: []string{"ENG", "WLS", "NIR"}},
+			{Name: "Early May bank holiday", Date: nthWeekday(time.May, time.Monday, 1)},
+			{Name: "Spring bank holiday", Date: nthWeekday(time.May, time.Monday, -1)},
+			{Name: "Battle of the Boyne", Date: on(time.July, 12), Move: moveNextFreeWeekday, Regions: []string{"NIR"}},
+			{Name: "Summer bank holiday", Date: nthWeekday(time.August, time.Monday, 1), Regions: []string{"SCT"}},
+			{Name: "Summer bank holiday", Date: nthWeekday(time.August, time.Monday, -1), Regions: []string{"ENG", "WLS", "NIR"}},
+			{Name: "St Andrew's Day", Date: on(time.November, 30), Move: moveNextFreeWeekday, Regions: []string{"SCT"}},
+			{Name: "Christmas Day", Date: on(time.December, 25), Move: moveNextFreeWeekday},
+			{Name: "Boxing Day", Date: on(time.December, 26), Move: moveNextFreeWeekday},
+		},
+	},
+	"IT": {
+		Name: "Italy",
+		Rules: []holidayRule{
+			{Name: "New Year's Day", Date: on(time.January, 1)},
+			{Name: "Epiphany", Date: on(time.January, 6)},
+			{Name: "Easter Monday", Date: easterPlus(1)},
+			{Name: "Liberation Day", Date: on(time.April, 25)},
+			{Name: "Labour Day", Date: on(time.May, 1)},
+			{Name: "Republic Day", Date: on(time.June, 2)},
+			{Name: "Assumption Day", Date: on(time.August, 15)},
+			{Name: "All Saints' Day", Date: on(time.November, 1)},
+			{Name: "Immaculate Conception", Date: on(time.December, 8)},
+			{Name: "Christmas Day", Date: on(time.December, 25)},
+			{Name: "St. Stephen's Day", Date: on(time.December, 26)},
+		},
+	},
+	"NL": {
+		Name: "Netherlands",
+		Rules: []holidayRule{
+			{Name: "New Year's Day", Date: on(time.January, 1)},
+			{Name: "Easter Monday", Date: easterPlus(1)},
+			{Name: "King's Day", Date: on(time.April, 27), Move: moveSundayBack, Since: 2014},
+			{Name: "Ascension Day", Date: easterPlus(39)},
+			{Name: "Whit Monday", Date: easterPlus(50)},
+			{Name: "Christmas Day", Date: on(time.December, 25)},
+			{Name: "Second Day of Christmas", Date: on(time.December, 26)},
+		},
+	},
+	"US": {
+		Name: "United States (federal)",
+		Rules: []holidayRule{
+			{Name: "New Year's Day", Date: on(time.January, 1), Move: moveNearestWeekday},
+			{Name: "Martin Luther King Jr. Day", Date: nthWeekday(time.January, time.Monday, 3)},
+			{Name: "Washington's Birthday", Date: nthWeekday(time.February, time.Monday, 3)},
+			{Name: "Memorial Day", Date: nthWeekday(time.May, time.Monday, -1)},
+			{Name: "Juneteenth", Date: on(time.June, 19), Move: moveNearestWeekday, Since: 2021},
+			{Name: "Independence Day", Date: on(time.July, 4), Move: moveNearestWeekday},
+			{Name: "Labor Day", Date: nthWeekday(time.September, time.Monday, 1)},
+			{Name: "Columbus Day", Date: nthWeekday(time.October, time.Monday, 2)},
+			{Name: "Veterans Day", Date: on(time.November, 11), Move: moveNearestWeekday},
+			{Name: "Thanksgiving Day", Date: nthWeekday(time.November, time.Thursday, 4)},
+			{Name: "Christmas Day", Date: on(time.December, 25), Move: moveNearestWeekday},
+		},
+	},
+}
+
+// parseHolidayRegion reads a country code such as DE or a country with its region such as DE-BY; empty is none
+func parseHolidayRegion(value string) (string, error) {
+	code := strings.ToUpper(strings.TrimSpace(value))
+	if code == "" {
+		return "", nil
+	}
+	countryCode, region, hasRegion := strings.Cut(code, "-")
+	country, ok := holidayCountries[countryCode]
+	if !ok {
+		return "", fmt.Errorf("no holidays are known for %q", value)
+	}
+	if hasRegion {
+		if _, ok := country.Regions[region]; !ok {
+			return "", fmt.Errorf("%s has no region %q", country.Name, region)
+		}
+	}
+	return code, nil
+}
+
+// holidayRegionName names a code of parseHolidayRegion, e.g. "Germany – Bavaria"
+func holidayRegionName(code string) string {
+	countryCode, region, _ := strings.Cut(code, "-")
+	country, ok := holidayCountries[countryCode]
+	if !ok {
+		return code
+	}
+	if name, ok := country.Regions[region]; ok {
+		return country.Name + " – " + name
+	}
+	return country.Name
+}
+
+// holidayRegionOptions lists every country, each followed by its regions, for the holiday menu
+func holidayRegionOptions(selected string) []map[string]interface{} {
+	codes := make([]string, 0, len(holidayCountries))
+	for code := range holidayCountries {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return holidayCountries[codes[i]].Name < holidayCountries[codes[j]].Name })
+
+	var options []map[string]interface{}
+	for _, code := range codes {
+		country := holidayCountries[code]
+		label := country.Name
+		if len(country.Regions) > 0 {
+			label += " (national holidays only)"
+		}
+		options = append(options, map[string]interface{}{"Value": code, "Label": label, "Selected": code == selected})
+		regions := make([]string, 0, len(country.Regions))
+		for region := range country.Regions {
+			regions = append(regions, region)
+		}
+		sort.Slice(regions, func(i, j int) bool { return country.Regions[regions[i]] < country.Regions[regions[j]] })
+		for _, region := range regions {
+			value := code + "-" + region
+			options = append(options, map[string]interface{}{
+				"Value":    value,
+				"Label":    holidayRegionName(value),
+				"Selected": value == selected,
+			})
+		}
+	}
+	return options
+}
+
+// holidaysInYear lists the holidays of a code of parseHolidayRegion in a year by date, on the days they are taken off
+func holidaysInYear(code string, year int) []publicHoliday {
+	countryCode, region, _ := strings.Cut(code, "-")
+	country, ok := holidayCountries[countryCode]
+	if !ok {
+		return nil
+	}
+
+	// Holidays of the years around can move into this one, like a New Year's Day on a Saturday to December 31
+	type dated struct {
+		rule holidayRule
+		date time.Time
+	}
+	var all []dated
+	for y := year - 1; y <= year+1; y++ {
+		for _, rule := range country.Rules {
+			if rule.Since > y || (len(rule.Regions) > 0 && !slices.Contains(rule.Regions, region)) {
+				continue
+			}
+			all = append(all, dated{rule, rule.Date(y)})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].date.Before(all[j].date) })
+
+	taken := make(map[time.Time]bool, len(all))
+	for _, holiday := range all {
+		taken[holiday.date] = true
+	}
+	var holidays []publicHoliday
+	for _, holiday := range all {
+		date := holiday.date
+		weekday := date.Weekday()
+		switch holiday.rule.Move {
+		case moveNearestWeekday:
+			if weekday == time.Saturday {
+				date = date.AddDate(0, 0, -1)
+			} else if weekday == time.Sunday {
+				date = date.AddDate(0, 0, 1)
+			}
+		case moveNextFreeWeekday:
+			if weekday == time.Saturday || weekday == time.Sunday {
+				for date.Weekday() == time.Saturday || date.Weekday() == time.Sunday || taken[date] {
+					date = date.AddDate(0, 0, 1)
+				}
+				taken[date] = true
+			}
+		case moveSundayBack:
+			if weekday == time.Sunday {
+				date = date.AddDate(0, 0, -1)
+			}
+		}
+		if date.Year() != year {
+			continue
+		}
+		name := holiday.rule.Name
+		if !date.Equal(holiday.date) && holiday.rule.Move == moveNearestWeekday {
+			name += " (observed)"
+		} else if !date.Equal(holiday.date) {
+			name += " (substitute day)"
+		}
+		holidays = append(holidays, publicHoliday{Date: date.Format("2006-01-02"), Name: name})
+	}
+	sort.SliceStable(holidays, func(i, j int) bool { return holidays[i].Date < holidays[j].Date })
+	return holidays
+}
+
+// holidaysBetween lists the holidays of a code of parseHolidayRegion on the dates in [from, to)
+func holidaysBetween(code string, from, to time.Time) []publicHoliday {
+	if code == "" {
+		return nil
+	}
+	first, last := from.Format("2006-01-02"), to.Format("2006-01-02")
+	var holidays []publicHoliday
+	for year := from.Year(); year <= to.Year(); year++ {
+		for _, holiday := range holidaysInYear(code, year) {
+			if holiday.Date >= first && holiday.Date < last {
+				holidays = append(holidays, holiday)
+			}
+		}
+	}
+	return holidays
+}
+
+// userHolidayRegion is the user's holiday region, empty when none is picked or the user doesn't exist
+func userHolidayRegion(ctx context.Context, userID uint) (string, error) {
+	var user User
+	err := db.WithContext(ctx).Select("holiday_region").Where("id = ?", userID).Limit(1).Find(&user).Error
+	return user.HolidayRegion, err
+}
+
+// userHolidays lists the public holidays of the user's holiday region on the dates in [from, to)
+func userHolidays(ctx context.Context, userID uint, from, to time.Time) ([]publicHoliday, error) {
+	region, err := userHolidayRegion(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return holidaysBetween(region, from, to), nil
+}
+
+// upcomingHolidayCount is how many of the next holidays the group page lists
+const upcomingHolidayCount = 5
+
+// holidayPageData is what the group page shows of the user's public holidays: the region menu and the next holidays
+func holidayPageData(userID uint) (fiber.Map, error) {
+	region, err := userHolidayRegion(context.Background(), userID)
+	if err != nil {
+		return nil, err
+	}
+	today := time.Now()
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, today.Location())
+	var upcoming []fiber.Map
+	for _, holiday := range holidaysBetween(region, today, today.AddDate(1, 0, 0)) {
+		if len(upcoming) == upcomingHolidayCount {
+			break
+		}
+		date, _ := time.ParseInLocation("2006-01-02", holiday.Date, time.Local)
+		upcoming = append(upcoming, fiber.Map{"Date": date.Format("Mon, Jan 2, 2006"), "Name": holiday.Name})
+	}
+	return fiber.Map{
+		"Region":   region,
+		"Name":     holidayRegionName(region),
+		"Options":  holidayRegionOptions(region),
+		"Upcoming": upcoming,
+	}, nil
+}
+
+// saveHolidayRegionHandler picks the country or region whose public holidays are the user's days off
+func saveHolidayRegionHandler(c *fiber.Ctx) error {
+	region, err := parseHolidayRegion(c.FormValue("holiday_region"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid holiday region: " + err.Error())
+	}
+	userID := currentUserID(c)
+	if err := db.Model(&User{}).Where("id = ?", userID).Update("holiday_region", region).Error; err != nil {
+		requestLog(c).Println("Error saving holiday region:", err)
+		return c.Status(500).SendString("Error saving public holidays")
+	}
+	details := "Stopped taking public holidays off"
+	if region != "" {
+		details = "Taking the public holidays of " + holidayRegionName(region) + " off"
+	}
+	recordAudit("group.exception", clientInfoFromRequest(c), 0, nil, details)
+	return c.Redirect("/groups/manage", fiber.StatusSeeOther)
+}
+
+// apiListHolidays lists the public holidays of a year in the user's holiday region, or in ?region= when given
+func apiListHolidays(c *fiber.Ctx) error {
+	year := time.Now().Year()
+	if value := c.Query("year"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1900 || parsed > 2200 {
+			return c.Status(400).JSON(apiError{"year must be between 1900 and 2200"})
+		}
+		year = parsed
+	}
+	region := c.Query("region")
+	if region == "" {
+		var err error
+		if region, err = userHolidayRegion(traceContext(c), currentUserID(c)); err != nil {
+			requestLog(c).Println("Error loading holiday region:", err)
+			return c.Status(500).JSON(apiError{"error loading holidays"})
+		}
+	}
+	region, err := parseHolidayRegion(region)
+	if err != nil {
+		return c.Status(400).JSON(apiError{err.Error()})
+	}
+	holidays := holidaysInYear(region, year)
+	if holidays == nil {
+		holidays = []publicHoliday{}
+	}
+	return c.JSON(holidays)
+}
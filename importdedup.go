@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// importMatchWindow is how far apart the starts and the ends of an imported entry and a round of the same group may
+// be for both to be the same work, e.g. when a source rounds times to the minute
+const importMatchWindow = time.Minute
+
+// Why an import entry is skipped as a duplicate
+const (
+	duplicateExternalID = "imported before"             // A round has the same source and external ID
+	duplicateTimes      = "already tracked"             // A round of the group has the same start and end
+	duplicateInImport   = "listed twice in this import" // An earlier entry of the import is the same
+)
+
+// importCandidate is a finished round an importer wants to create
+type importCandidate struct {
+	Source     string // The importer, see roundSources
+	ExternalID string // The entry's ID in the source, such as a calendar event's UID; empty when it has none
+	GroupID    uint
+	Start      time.Time
+	End        time.Time
+	Note       string
+}
+
+// importDuplicate is an entry left out of an import, with the round it repeats
+type importDuplicate struct {
+	Candidate importCandidate
+	RoundID   uint // 0 when it repeats an earlier entry of the import
+	Reason    string
+}
+
+// importReport is what an import did, shown once it is done
+type importReport struct {
+	Source     string
+	ImportPath string // The importer's page, for importing more
+	Created    int
+	Skipped    []importDuplicate
+	Invalid    int // Entries that couldn't be read, such as rows of a file without a start time
+}
+
+// importDeduper is the duplicate check shared by importers, which makes running an import twice safe. An entry is a
+// duplicate when a round of the user came from the same source with the same external ID, or when a round of the
+// same group starts and ends within importMatchWindow of it. Entries of one import are checked against each other
+// the same way.
+type importDeduper struct {
+	tx       *gorm.DB
+	userID   uint
+	accepted []importCandidate
+}
+
+func newImportDeduper(tx *gorm.DB, userID uint) *importDeduper {
+	return &importDeduper{tx: tx, userID: userID}
+}
+
+// check returns why candidate is a duplicate, or nil when it is new; new entries count for the checks that follow
+func (d *importDeduper) check(candidate importCandidate) (*importDuplicate, error) {
+	for _, earlier := range d.accepted {
+		if sameImportEntry(earlier, candidate) {
+			return &importDuplicate{Candidate: candidate, Reason: duplicateInImport}, nil
+		}
+	}
+
+	var round Round
+	if candidate.ExternalID != "" {
+		err := d.tx.Scopes(userRounds(d.userID)).Select("id").
+			Where("source = ? AND external_id = ?", candidate.Source, candidate.ExternalID).Take(&round).Error
+		if err == nil {
+			return &importDuplicate{Candidate: candidate, RoundID: round.ID, Reason: duplicateExternalID}, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+	err := d.tx.Select("id").Where("working_group_id = ? AND start_time BETWEEN ? AND ? AND end_time BETWEEN ? AND ?",
+		candidate.GroupID, candidate.Start.Add(-importMatchWindow), candidate.Start.Add(importMatchWindow),
+		candidate.End.Add(-importMatchWindow), candidate.End.Add(importMatchWindow)).Take(&round).Error
+	if err == nil {
+		return &importDuplicate{Candidate: candidate, RoundID: round.ID, Reason: duplicateTimes}, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	d.accepted = append(d.accepted, candidate)
+	return nil, nil
+}
+
+// sameImportEntry reports whether two entries of an import are the same by the rules of importDeduper
+func sameImportEntry(a, b importCandidate) bool {
+	if a.ExternalID != "" && a.Source == b.Source && a.ExternalID == b.ExternalID {
+		return true
+	}
+	return a.GroupID == b.GroupID && a.Start.Sub(b.Start).Abs() <= importMatchWindow &&
+		a.End.Sub(b.End).Abs() <= importMatchWindow
+}
+
+// renderImportReport shows how many rounds an import created and which entries it skipped as duplicates, with the
+// rounds they repeat
+func renderImportReport(c *fiber.Ctx, report importReport) error {
+	groups, err := getWorkingGroupsOrdered(currentUserID(c))
+	if err != nil {
+		requestLog(c).Println("Error fetching working groups:", err)
+	}
+	paths := groupPaths(groups)
+	skipped := make([]fiber.Map, len(report.Skipped))
+	for i, duplicate := range report.Skipped {
+		skipped[i] = fiber.Map{
+			"Note":      duplicate.Candidate.Note,
+			"Start":     duplicate.Candidate.Start,
+			"End":       duplicate.Candidate.End,
+			"GroupID":   duplicate.Candidate.GroupID,
+			"GroupName": paths[duplicate.Candidate.GroupID],
+			"RoundID":   duplicate.RoundID,
+			"Reason":    duplicate.Reason,
+		}
+	}
+	return c.Render("import_report", fiber.Map{
+		"Source":       report.Source,
+		"SourceLabel":  roundSourceLabel(report.Source),
+		"ImportPath":   report.ImportPath,
+		"Created":      report.Created,
+		"Skipped":      skipped,
+		"SkippedCount": len(skipped),
+		"Invalid":      report.Invalid,
+	})
+}
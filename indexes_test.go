@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// benchRounds and benchGroups size the database of BenchmarkRoundIndexes: rounds of a few hours, one after the
+// other, spread over the groups, the latest of each group still running
+const (
+	benchRounds = 200_000
+	benchGroups = 20
+)
+
+// seedBenchRounds fills the test database with benchRounds rounds and returns the owner and the groups
+func seedBenchRounds(b *testing.B) (uint, []WorkingGroup) {
+	b.Helper()
+	user := User{Username: "bench", Role: roleAdmin}
+	if err := db.Create(&user).Error; err != nil {
+		b.Fatalf("creating user: %v", err)
+	}
+	groups := make([]WorkingGroup, benchGroups)
+	for i := range groups {
+		groups[i] = WorkingGroup{UserID: user.ID, Name: fmt.Sprintf("Group %d", i+1), Billable: true}
+		if err := db.Create(&groups[i]).Error; err != nil {
+			b.Fatalf("creating group: %v", err)
+		}
+	}
+
+	perGroup := benchRounds / benchGroups
+	start := time.Now().Add(-time.Duration(perGroup) * 3 * time.Hour).Truncate(time.Second)
+	billable := true
+	rounds := make([]Round, 0, benchRounds)
+	for i := 0; i < perGroup; i++ {
+		for _, group := range groups {
+			round := Round{WorkingGroupID: group.ID, StartTime: start.Add(time.Duration(i) * 3 * time.Hour),
+				Billable: &billable, Source: sourceManual}
+			if i < perGroup-1 {
+				end := round.StartTime.Add(2 * time.Hour)
+				round.EndTime = &end
+			}
+			rounds = append(rounds, round)
+		}
+	}
+	if err := db.CreateInBatches(rounds, 500).Error; err != nil {
+		b.Fatalf("creating rounds: %v", err)
+	}
+	return user.ID, groups
+}
+
+// useRoundIndexesBefore puts back the indexes rounds had before the composite ones: working_group_id on its own
+func useRoundIndexesBefore(b *testing.B) {
+	b.Helper()
+	for _, index := range []string{"idx_rounds_group_start", "idx_rounds_group_end"} {
+		if err := db.Migrator().DropIndex(&Round{}, index); err != nil {
+			b.Fatalf("dropping %s: %v", index, err)
+		}
+	}
+	if err := db.Exec("CREATE INDEX idx_rounds_working_group_id ON rounds (working_group_id)").Error; err != nil {
+		b.Fatalf("creating the old index: %v", err)
+	}
+	db.Exec("ANALYZE")
+}
+
+// loadDailyRoundsInGo totals a group's rounds per day the way getDailySummaries did before the database summed them:
+// every round of the group is loaded and added to its day in Go. It is the baseline of BenchmarkRoundIndexes.
+func loadDailyRoundsInGo(ctx context.Context, groupID uint, clock string) map[string]int64 {
+	var rounds []Round
+	if err := db.WithContext(ctx).Select("start_time", "end_time", "billable", "time_zone", "flagged", "paused_at", "paused_seconds").
+		Where("working_group_id = ?", groupID).Order("start_time DESC").Find(&rounds).Error; err != nil {
+		return nil
+	}
+	days := make(map[string]int64)
+	now := time.Now()
+	for _, round := range rounds {
+		days[roundClock(round.StartTime, round, clock).Format("2006-01-02")] += roundWorkedSeconds(round, now)
+	}
+	return days
+}
+
+// BenchmarkRoundIndexes compares the per-group round lookups, a group's status and its daily summaries with the
+// composite round indexes against the single working_group_id index they replaced, on a seeded SQLite database, and
+// the daily summaries summed by the database against loading every round:
+//
+//	go test -run '^$' -bench RoundIndexes
+func BenchmarkRoundIndexes(b *testing.B) {
+	for _, variant := range []struct {
+		name   string
+		before bool
+	}{{"composite", false}, {"group_id_only", true}} {
+		useTestDatabase(b, "sqlite", "")
+		userID, groups := seedBenchRounds(b)
+		if variant.before {
+			useRoundIndexesBefore(b)
+		} else {
+			db.Exec("ANALYZE")
+		}
+		ctx := context.Background()
+
+		group := func(i int) uint { return groups[i%len(groups)].ID }
+		weekAgo := time.Now().AddDate(0, 0, -7)
+
+		b.Run(variant.name+"/running_round", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var round Round
+				if err := db.Where("working_group_id = ? AND end_time IS NULL", group(i)).Order("start_time DESC").
+					Take(&round).Error; err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(variant.name+"/last_round", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var round Round
+				if err := db.Where("working_group_id = ? AND end_time IS NOT NULL", group(i)).Order("end_time DESC").
+					Take(&round).Error; err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(variant.name+"/last_week", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var rounds []Round
+				if err := db.Select("start_time", "end_time").Where("working_group_id = ? AND start_time >= ?", group(i), weekAgo).
+					Find(&rounds).Error; err != nil || len(rounds) == 0 {
+					b.Fatal("no rounds in the last week", err)
+				}
+			}
+		})
+		b.Run(variant.name+"/status", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if state := getCurrentState(ctx, group(i)); !state.IsRunning {
+					b.Fatal("the group's running round was not found")
+				}
+			}
+		})
+		b.Run(variant.name+"/daily_summaries", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if summaries := getDailySummaries(ctx, userID, group(i), clockHome, ""); len(summaries) == 0 {
+					b.Fatal("no daily summaries")
+				}
+			}
+		})
+		b.Run(variant.name+"/daily_rounds_in_go", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if days := loadDailyRoundsInGo(ctx, group(i), clockHome); len(days) == 0 {
+					b.Fatal("no days")
+				}
+			}
+		})
+	}
+}
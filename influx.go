@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// influxConfig is the optional line-protocol endpoint that receives round and daily metrics
+type influxConfig struct {
+	writeURL string // Full write URL, e.g. http://influx:8086/api/v2/write?org=home&bucket=hours
+	token    string // InfluxDB 2.x API token
+	username string // InfluxDB 1.x credentials
+	password string
+	interval time.Duration
+}
+
+var influx *influxConfig
+
+var influxHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// configureInflux enables metric pushes when an InfluxDB URL is set and starts the daily totals schedule
+func configureInflux() {
+	writeURL := cfg.Influx.URL
+	if writeURL == "" {
+		return
+	}
+	parsed, err := url.Parse(writeURL)
+	if err != nil {
+		log.Println("Warning: ignoring invalid INFLUX_URL:", err)
+		return
+	}
+	// All timestamps are written in seconds
+	query := parsed.Query()
+	query.Set("precision", "s")
+	parsed.RawQuery = query.Encode()
+
+	interval := 15 * time.Minute
+	if value := cfg.Influx.Interval; value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d >= time.Minute {
+			interval = d
+		} else {
+			log.Printf("Warning: ignoring INFLUX_INTERVAL %q, using %s", value, interval)
+		}
+	}
+
+	influx = &influxConfig{
+		writeURL: parsed.String(),
+		token:    cfg.Influx.Token,
+		username: cfg.Influx.User,
+		password: cfg.Influx.Pass,
+		interval: interval,
+	}
+	log.Printf("Pushing metrics to %s every %s", parsed.Host, interval)
+
+	registerJob(jobInflux, "every "+interval.String())
+	go func() {
+		recordJobRun(jobInflux, pushDailyMetrics())
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			recordJobRun(jobInflux, pushDailyMetrics())
+		}
+	}()
+}
+
+// escapeLineProtocol escapes measurement names and tag keys/values
+var escapeLineProtocol = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`).Replace
+
+func (cfg *influxConfig) write(lines []string) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodPost, cfg.writeURL, bytes.NewBufferString(strings.Join(lines, "\n")+"\n"))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if cfg.token != "" {
+		req.Header.Set("Authorization", "Token "+cfg.token)
+	} else if cfg.username != "" {
+		req.SetBasicAuth(cfg.username, cfg.password)
+	}
+
+	resp, err := influxHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+	return nil
+}
+
+func influxTags(username string, group WorkingGroup) string {
+	return fmt.Sprintf("user=%s,group=%s,group_id=%d",
+		escapeLineProtocol(username), escapeLineProtocol(group.Name), group.ID)
+}
+
+func usernameOf(userID uint) string {
+	var user User
+	if err := db.Select("username").First(&user, userID).Error; err != nil || user.Username == "" {
+		return "unknown"
+	}
+	return user.Username
+}
+
+// pushRoundMetric writes one point for a finished round, timestamped at its end
+func pushRoundMetric(round Round, group WorkingGroup) {
+	if influx == nil || round.EndTime == nil {
+		return
+	}
+	line := fmt.Sprintf("work_round,%s duration_seconds=%di,round_id=%di %d",
+		influxTags(usernameOf(group.UserID), group),
+		roundWorkedSeconds(round, *round.EndTime),
+		round.ID,
+		round.EndTime.Unix())
+	go func() {
+		if err := influx.write([]string{line}); err != nil {
+			log.Println("Error pushing round metric:", err)
+		}
+	}()
+}
+
+// pushDailyMetrics writes today's and yesterday's totals of every group, timestamped at local
+// midnight; rewriting the same points keeps them current as rounds finish or are imported
+func pushDailyMetrics() error {
+	var groups []WorkingGroup
+	if err := db.Find(&groups).Error; err != nil {
+		return fmt.Errorf("loading groups for metrics: %w", err)
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	usernames := make(map[uint]string)
+	var lines []string
+	for _, group := range groups {
+		if _, ok := usernames[group.UserID]; !ok {
+			usernames[group.UserID] = usernameOf(group.UserID)
+		}
+		for _, day := range []time.Time{today.AddDate(0, 0, -1), today} {
+			var rounds []Round
+			if err := db.Select("start_time", "end_time", "paused_seconds").
+				Where("working_group_id = ? AND end_time IS NOT NULL AND start_time >= ? AND start_time < ?", group.ID, day, day.AddDate(0, 0, 1)).
+				Find(&rounds).Error; err != nil {
+				return fmt.Errorf("loading rounds for metrics: %w", err)
+			}
+			var seconds int64
+			for _, round := range rounds {
+				seconds += roundWorkedSeconds(round, *round.EndTime)
+			}
+			lines = append(lines, fmt.Sprintf("work_day,%s seconds=%di,hours=%.4f,rounds=%di %d",
+				influxTags(usernames[group.UserID], group), seconds, float64(seconds)/3600, len(rounds), day.Unix()))
+		}
+	}
+
+	if err := influx.write(lines); err != nil {
+		return fmt.Errorf("pushing daily metrics: %w", err)
+	}
+	return nil
+}
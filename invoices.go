@@ -0,0 +1,301 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Invoice statuses
+const (
+	invoiceDraft = "draft"
+	invoiceSent  = "sent"
+	invoicePaid  = "paid"
+)
+
+var invoiceStatuses = []string{invoiceDraft, invoiceSent, invoicePaid}
+
+// Invoice bills the completed, not yet billed rounds of a working group within a period
+type Invoice struct {
+	ID             uint   `gorm:"primaryKey"`
+	Number         string `gorm:"uniqueIndex;size:191;not null"` // e.g. INV-2024-0007
+	WorkingGroupID uint   `gorm:"index"`
+	WorkingGroup   WorkingGroup
+	PeriodStart    time.Time
+	PeriodEnd      time.Time // Inclusive last day of the period
+	Status         string    `gorm:"not null;default:draft"`
+	TotalSeconds   int64
+	PaidAt         *time.Time
+	Lines          []InvoiceLine
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// InvoiceLine is one billed round; it keeps its own copy of the figures so it survives group resets
+type InvoiceLine struct {
+	ID          uint `gorm:"primaryKey"`
+	InvoiceID   uint `gorm:"index"`
+	RoundID     uint
+	Description string
+	Seconds     int64
+}
+
+func nextInvoiceNumber(tx *gorm.DB, now time.Time) (string, error) {
+	prefix := fmt.Sprintf("INV-%d-", now.Year())
+	var count int64
+	if err := tx.Model(&Invoice{}).Where("number LIKE ?", prefix+"%").Count(&count).Error; err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%04d", prefix, count+1), nil
+}
+
+// createInvoice bills every unbilled completed billable round of the group that started within the period
+func createInvoice(groupID uint, periodStart, periodEnd time.Time) (Invoice, error) {
+	var invoice Invoice
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var rounds []Round
+		if err := tx.Where("working_group_id = ? AND end_time IS NOT NULL AND invoice_id IS NULL AND billable = ? AND start_time >= ? AND start_time < ?",
+			groupID, true, periodStart, periodEnd.AddDate(0, 0, 1)).
+			Order("start_time ASC").Find(&rounds).Error; err != nil {
+			return err
+		}
+		if len(rounds) == 0 {
+			return errors.New("no unbilled completed billable rounds in this period")
+		}
+
+		number, err := nextInvoiceNumber(tx, time.Now())
+		if err != nil {
+			return err
+		}
+
+		invoice = Invoice{
+			Number:         number,
+			WorkingGroupID: groupID,
+			PeriodStart:    periodStart,
+			PeriodEnd:      periodEnd,
+			Status:         invoiceDraft,
+		}
+		for _, round := range rounds {
+			seconds := roundWorkedSeconds(round, *round.EndTime)
+			invoice.TotalSeconds += seconds
+			invoice.Lines = append(invoice.Lines, InvoiceLine{
+				RoundID: round.ID,
+				Description: fmt.Sprintf("Round #%d, %s - %s", round.ID,
+					round.StartTime.Format("2006-01-02 15:04"), round.EndTime.Format("15:04")),
+				Seconds: seconds,
+			})
+		}
+		if err := tx.Create(&invoice).Error; err != nil {
+			return err
+		}
+
+		roundIDs := make([]uint, 0, len(rounds))
+		for _, round := range rounds {
+			roundIDs = append(roundIDs, round.ID)
+		}
+		return tx.Model(&Round{}).Where("id IN ?", roundIDs).Update("invoice_id", invoice.ID).Error
+	})
+	return invoice, err
+}
+
+func renderInvoices(c *fiber.Ctx) error {
+	var invoices []Invoice
+	userID := currentUserID(c)
+	if err := db.Preload("WorkingGroup").Scopes(userRounds(userID)).Order("created_at DESC").Find(&invoices).Error; err != nil {
+		requestLog(c).Println("Error fetching invoices:", err)
+		return c.Status(500).SendString("Error loading invoices")
+	}
+
+	groups, err := getWorkingGroupsOrdered(userID)
+	if err != nil {
+		requestLog(c).Println("Error fetching working groups:", err)
+		return c.Status(500).SendString("Error loading invoices")
+	}
+
+	var invoiceViews []fiber.Map
+	for _, invoice := range invoices {
+		invoiceViews = append(invoiceViews, invoiceView(invoice))
+	}
+
+	now := time.Now()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	return c.Render("invoices", fiber.Map{
+		"Invoices":           invoiceViews,
+		"Groups":             groups,
+		"DefaultPeriodStart": monthStart.AddDate(0, -1, 0).Format("2006-01-02"),
+		"DefaultPeriodEnd":   monthStart.AddDate(0, 0, -1).Format("2006-01-02"),
+	})
+}
+
+func invoiceView(invoice Invoice) fiber.Map {
+	paidAt := ""
+	if invoice.PaidAt != nil {
+		paidAt = invoice.PaidAt.Format("2006-01-02")
+	}
+	return fiber.Map{
+		"ID":             invoice.ID,
+		"Number":         invoice.Number,
+		"GroupName":      invoice.WorkingGroup.Name,
+		"GroupRef":       invoice.WorkingGroup.ExternalRef,
+		"PeriodStart":    invoice.PeriodStart.Format("2006-01-02"),
+		"PeriodEnd":      invoice.PeriodEnd.Format("2006-01-02"),
+		"Status":         invoice.Status,
+		"IsDraft":        invoice.Status == invoiceDraft,
+		"IsPaid":         invoice.Status == invoicePaid,
+		"PaidAt":         paidAt,
+		"TotalFormatted": formatDuration(invoice.TotalSeconds),
+		"CreatedAt":      invoice.CreatedAt.Format("2006-01-02"),
+	}
+}
+
+func renderInvoiceDetail(c *fiber.Ctx) error {
+	id, err := parseGroupID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid invoice")
+	}
+
+	var invoice Invoice
+	if err := db.Preload("WorkingGroup").Preload("Lines").Scopes(userRounds(currentUserID(c))).First(&invoice, id).Error; err != nil {
+		return c.Status(404).SendString("Invoice not found")
+	}
+
+	var lineViews []fiber.Map
+	for _, line := range invoice.Lines {
+		lineViews = append(lineViews, fiber.Map{
+			"RoundID":        line.RoundID,
+			"Description":    line.Description,
+			"TotalFormatted": formatDuration(line.Seconds),
+		})
+	}
+
+	var statusOptions []fiber.Map
+	for _, status := range invoiceStatuses {
+		statusOptions = append(statusOptions, fiber.Map{
+			"Value":    status,
+			"Selected": status == invoice.Status,
+		})
+	}
+
+	var archived ArchivedReport
+	db.Where("invoice_id = ?", invoice.ID).Limit(1).Find(&archived)
+
+	return c.Render("invoice", fiber.Map{
+		"Invoice":       invoiceView(invoice),
+		"ArchivedID":    archived.ID,
+		"Lines":         lineViews,
+		"StatusOptions": statusOptions,
+		"Today":         time.Now().Format("2006-01-02"),
+	})
+}
+
+func createInvoiceHandler(c *fiber.Ctx) error {
+	groupID, err := parseGroupID(c.FormValue("group_id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid working group")
+	}
+
+	if _, err := findUserGroup(currentUserID(c), groupID); err != nil {
+		return c.Status(404).SendString("Working group not found")
+	}
+
+	periodStart, err := time.ParseInLocation("2006-01-02", c.FormValue("period_start"), time.Local)
+	if err != nil {
+		return c.Status(400).SendString("Invalid period start")
+	}
+	periodEnd, err := time.ParseInLocation("2006-01-02", c.FormValue("period_end"), time.Local)
+	if err != nil || periodEnd.Before(periodStart) {
+		return c.Status(400).SendString("Invalid period end")
+	}
+
+	invoice, err := createInvoice(groupID, periodStart, periodEnd)
+	if err != nil {
+		requestLog(c).Println("Error creating invoice:", err)
+		return c.Status(400).SendString("Cannot create invoice: " + err.Error())
+	}
+	recordAudit("invoice.create", clientInfoFromRequest(c), groupID, nil,
+		fmt.Sprintf("Created invoice %s with %d round(s)", invoice.Number, len(invoice.Lines)))
+
+	return c.Redirect(fmt.Sprintf("/invoices/%d", invoice.ID), fiber.StatusSeeOther)
+}
+
+func updateInvoiceStatusHandler(c *fiber.Ctx) error {
+	id, err := parseGroupID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid invoice")
+	}
+
+	var invoice Invoice
+	if err := db.Scopes(userRounds(currentUserID(c))).First(&invoice, id).Error; err != nil {
+		return c.Status(404).SendString("Invoice not found")
+	}
+
+	status := c.FormValue("status")
+	valid := false
+	for _, s := range invoiceStatuses {
+		valid = valid || s == status
+	}
+	if !valid {
+		return c.Status(400).SendString("Invalid invoice status")
+	}
+
+	invoice.Status = status
+	invoice.PaidAt = nil
+	if status == invoicePaid {
+		paidAt := time.Now()
+		if value := c.FormValue("paid_at"); value != "" {
+			if paidAt, err = time.ParseInLocation("2006-01-02", value, time.Local); err != nil {
+				return c.Status(400).SendString("Invalid payment date")
+			}
+		}
+		invoice.PaidAt = &paidAt
+	}
+
+	if err := db.Save(&invoice).Error; err != nil {
+		requestLog(c).Println("Error updating invoice:", err)
+		return c.Status(500).SendString("Error updating invoice")
+	}
+	recordAudit("invoice.status", clientInfoFromRequest(c), invoice.WorkingGroupID, nil,
+		fmt.Sprintf("Marked invoice %s as %s", invoice.Number, status))
+	if err := archiveInvoice(c.App().Config().Views, invoice.ID); err != nil {
+		requestLog(c).Println("Error archiving invoice:", err)
+	}
+
+	return c.Redirect(fmt.Sprintf("/invoices/%d", invoice.ID), fiber.StatusSeeOther)
+}
+
+// deleteInvoiceHandler removes a draft invoice and releases its rounds for billing again
+func deleteInvoiceHandler(c *fiber.Ctx) error {
+	id, err := parseGroupID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid invoice")
+	}
+
+	var invoice Invoice
+	if err := db.Scopes(userRounds(currentUserID(c))).First(&invoice, id).Error; err != nil {
+		return c.Status(404).SendString("Invoice not found")
+	}
+	if invoice.Status != invoiceDraft {
+		return c.Status(400).SendString("Only draft invoices can be deleted")
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Round{}).Where("invoice_id = ?", invoice.ID).Update("invoice_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("invoice_id = ?", invoice.ID).Delete(&InvoiceLine{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&invoice).Error
+	})
+	if err != nil {
+		requestLog(c).Println("Error deleting invoice:", err)
+		return c.Status(500).SendString("Error deleting invoice")
+	}
+	recordAudit("invoice.delete", clientInfoFromRequest(c), invoice.WorkingGroupID, nil,
+		fmt.Sprintf("Deleted draft invoice %s", invoice.Number))
+
+	return c.Redirect("/invoices", fiber.StatusSeeOther)
+}
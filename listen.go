@@ -0,0 +1,193 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const unixSocketPrefix = "unix:"
+
+// listen serves the app on cfg.Listen, a TCP address like ":3000" or a Unix socket like "unix:/run/workinghours.sock",
+// over HTTPS when a certificate or ACME domains are configured
+func listen(app *fiber.App) error {
+	path, isSocket := strings.CutPrefix(cfg.Listen, unixSocketPrefix)
+	if !isSocket && !cfg.tlsEnabled() {
+		log.Printf("Server starting on %s", cfg.Listen)
+		return app.Listen(cfg.Listen)
+	}
+	if !isSocket {
+		return listenTLS(app)
+	}
+
+	listener, err := listenUnix(path)
+	if err != nil {
+		return err
+	}
+	log.Printf("Server starting on Unix socket %s (mode %s)", path, cfg.SocketMode)
+	return app.Listener(listener)
+}
+
+// listenUnix creates the socket with the configured permissions. A socket file left behind by a crashed run is
+// replaced, but one that still accepts connections belongs to a running instance and is left alone.
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another process", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("removing stale socket: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	mode, _ := strconv.ParseUint(cfg.SocketMode, 8, 32) // Checked by Config.validate
+	if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("setting socket permissions: %w", err)
+	}
+	if cfg.SocketGroup != "" {
+		group, err := user.LookupGroup(cfg.SocketGroup)
+		if err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("socket group: %w", err)
+		}
+		gid, _ := strconv.Atoi(group.Gid)
+		if err := os.Chown(path, -1, gid); err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("handing socket to group %s: %w", cfg.SocketGroup, err)
+		}
+	}
+	return listener, nil
+}
+
+// listenTLS serves HTTPS with the configured certificate or with certificates obtained from Let's Encrypt
+func listenTLS(app *fiber.App) error {
+	var tlsConfig *tls.Config
+	var challengeHandler func(http.Handler) http.Handler
+	if cfg.TLS.CertFile != "" {
+		certificate := &certificateFile{certFile: cfg.TLS.CertFile, keyFile: cfg.TLS.KeyFile}
+		if _, err := certificate.load(); err != nil {
+			return fmt.Errorf("loading TLS certificate: %w", err)
+		}
+		tlsConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return certificate.load()
+			},
+		}
+		log.Printf("Server starting on %s with HTTPS (certificate %s)", cfg.Listen, cfg.TLS.CertFile)
+	} else {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.TLS.ACME.Domains...),
+			Cache:      autocert.DirCache(cfg.TLS.ACME.CacheDir),
+			Email:      cfg.TLS.ACME.Email,
+		}
+		if cfg.TLS.ACME.Directory != "" {
+			manager.Client = &acme.Client{DirectoryURL: cfg.TLS.ACME.Directory}
+		}
+		tlsConfig = manager.TLSConfig() // Answers TLS-ALPN-01 challenges on the HTTPS port itself
+		tlsConfig.MinVersion = tls.VersionTLS12
+		challengeHandler = manager.HTTPHandler
+		log.Printf("Server starting on %s with HTTPS for %s (Let's Encrypt, cache %s)",
+			cfg.Listen, strings.Join(cfg.TLS.ACME.Domains, ", "), cfg.TLS.ACME.CacheDir)
+	}
+
+	listener, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return err
+	}
+	if cfg.TLS.HTTPAddr != "" {
+		go serveHTTPSRedirect(challengeHandler)
+	}
+	return app.Listener(tls.NewListener(listener, tlsConfig))
+}
+
+// serveHTTPSRedirect sends plain HTTP requests to HTTPS; with ACME it also answers HTTP-01 challenges
+func serveHTTPSRedirect(challengeHandler func(http.Handler) http.Handler) {
+	_, httpsPort, _ := net.SplitHostPort(cfg.Listen)
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+	if challengeHandler != nil {
+		handler = challengeHandler(handler)
+	}
+	log.Printf("Redirecting HTTP on %s to HTTPS", cfg.TLS.HTTPAddr)
+	server := &http.Server{Addr: cfg.TLS.HTTPAddr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	if err := server.ListenAndServe(); err != nil {
+		log.Println("Error serving HTTP redirect:", err)
+	}
+}
+
+// certificateFile serves a certificate from disk and reloads it when the file changes, so renewals by certbot or
+// similar tools are picked up without a restart
+type certificateFile struct {
+	certFile, keyFile string
+	mu                sync.Mutex
+	certificate       *tls.Certificate
+	modified          time.Time
+	checked           time.Time
+}
+
+func (f *certificateFile) load() (*tls.Certificate, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.certificate != nil && time.Since(f.checked) < time.Minute {
+		return f.certificate, nil
+	}
+	f.checked = time.Now()
+	info, err := os.Stat(f.certFile)
+	if err != nil {
+		if f.certificate != nil {
+			return f.certificate, nil
+		}
+		return nil, err
+	}
+	if f.certificate != nil && info.ModTime().Equal(f.modified) {
+		return f.certificate, nil
+	}
+	certificate, err := tls.LoadX509KeyPair(f.certFile, f.keyFile)
+	if err != nil {
+		if f.certificate != nil {
+			log.Println("Error reloading TLS certificate, keeping the previous one:", err)
+			return f.certificate, nil
+		}
+		return nil, err
+	}
+	if f.certificate != nil {
+		log.Printf("Reloaded TLS certificate %s", f.certFile)
+	}
+	f.certificate = &certificate
+	f.modified = info.ModTime()
+	return f.certificate, nil
+}
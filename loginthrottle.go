@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// loginAddressFactor is how many times as many failures an address may have as one account, for an office
+	// signing in from behind one address
+	loginAddressFactor = 4
+	// loginFailureMemory is how long failures are remembered without another one; after that the count starts over
+	loginFailureMemory = 24 * time.Hour
+)
+
+// loginFailures counts the failed password sign-ins in a row of an account or an address
+type loginFailures struct {
+	Count       int
+	Last        time.Time
+	LockedUntil time.Time
+}
+
+// loginAttempts keeps the failures by key, "user:<name>" or "ip:<address>". It lives in memory like the rate
+// limiters, so a restart forgets them. Unknown usernames are counted like accounts, so a lockout doesn't tell
+// which accounts exist.
+var loginAttempts = struct {
+	sync.Mutex
+	byKey     map[string]*loginFailures
+	lastSweep time.Time
+}{byKey: make(map[string]*loginFailures)}
+
+func loginAccountKey(username string) string {
+	return "user:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+func loginAddressKey(ip string) string {
+	return "ip:" + ip
+}
+
+// loginLockoutSettings reads LOGIN_MAX_ATTEMPTS, LOGIN_LOCKOUT and LOGIN_MAX_LOCKOUT, checked on start; 0 attempts
+// turns lockout off
+func loginLockoutSettings() (int, time.Duration, time.Duration) {
+	attempts, _ := strconv.Atoi(cfg.Auth.MaxLoginAttempts)
+	lockout, _ := time.ParseDuration(cfg.Auth.Lockout)
+	maxLockout, _ := time.ParseDuration(cfg.Auth.MaxLockout)
+	return attempts, lockout, maxLockout
+}
+
+// loginLockedFor is how much longer sign-ins under any of the keys are refused, 0 when none is locked
+func loginLockedFor(keys ...string) time.Duration {
+	loginAttempts.Lock()
+	defer loginAttempts.Unlock()
+	var longest time.Duration
+	now := time.Now()
+	for _, key := range keys {
+		if failures := loginAttempts.byKey[key]; failures != nil && failures.LockedUntil.After(now) {
+			longest = max(longest, failures.LockedUntil.Sub(now))
+		}
+	}
+	return longest
+}
+
+// recordLoginFailure counts a failed sign-in under key, which may fail attempts times in a row. From then on every
+// failure locks it, for LOGIN_LOCKOUT at first and twice as long with each further failure up to LOGIN_MAX_LOCKOUT.
+// It returns the failures in a row and how long they lock the key, 0 when they don't.
+func recordLoginFailure(key string, attempts int) (int, time.Duration) {
+	loginAttempts.Lock()
+	defer loginAttempts.Unlock()
+	now := time.Now()
+	if now.Sub(loginAttempts.lastSweep) > time.Minute {
+		for other, failures := range loginAttempts.byKey {
+			if now.Sub(failures.Last) > loginFailureMemory && !failures.LockedUntil.After(now) {
+				delete(loginAttempts.byKey, other)
+			}
+		}
+		loginAttempts.lastSweep = now
+	}
+
+	failures := loginAttempts.byKey[key]
+	if failures == nil || now.Sub(failures.Last) > loginFailureMemory {
+		failures = &loginFailures{}
+		loginAttempts.byKey[key] = failures
+	}
+	failures.Count++
+	failures.Last = now
+	if failures.Count < attempts {
+		return failures.Count, 0
+	}
+	_, lockout, maxLockout := loginLockoutSettings()
+	lock := lockout
+	for i := attempts; i < failures.Count && lock < maxLockout; i++ {
+		lock *= 2
+	}
+	lock = min(lock, maxLockout)
+	failures.LockedUntil = now.Add(lock)
+	return failures.Count, lock
+}
+
+// clearLoginFailures forgets the failures under the keys, after a successful sign-in or when an admin unlocks an account
+func clearLoginFailures(keys ...string) {
+	loginAttempts.Lock()
+	defer loginAttempts.Unlock()
+	for _, key := range keys {
+		delete(loginAttempts.byKey, key)
+	}
+}
+
+// loginFailed counts a failed password sign-in against the account and the address it came from, audits it for an
+// existing account, and returns how long sign-ins are now refused
+func loginFailed(c *fiber.Ctx, username string, user *User) time.Duration {
+	attempts, _, _ := loginLockoutSettings()
+	if attempts == 0 {
+		return 0
+	}
+	count, locked := recordLoginFailure(loginAccountKey(username), attempts)
+	addressLocked := addressLoginFailed(c, attempts)
+	if user != nil {
+		client := clientInfoFromRequest(c)
+		client.UserID = user.ID
+		recordAudit("user.login_failed", client, 0, nil,
+			fmt.Sprintf("Failed sign-in with a wrong password, %d in a row", count))
+		if locked > 0 {
+			recordAudit("user.lockout", client, 0, nil,
+				fmt.Sprintf("Password sign-in locked for %s after %d failed attempts in a row", locked, count))
+		}
+	}
+	return max(locked, addressLocked)
+}
+
+// addressLoginFailed counts a failed sign-in against the address it came from and returns how long it is now locked
+func addressLoginFailed(c *fiber.Ctx, attempts int) time.Duration {
+	count, locked := recordLoginFailure(loginAddressKey(c.IP()), attempts*loginAddressFactor)
+	if locked > 0 {
+		log.Printf("Sign-in from %s locked for %s after %d failed attempts in a row", c.IP(), locked, count)
+	}
+	return locked
+}
+
+// basicAuthFailed counts wrong HTTP Basic credentials against the address they came from only: AUTH_USER is one
+// account shared by everyone, so locking it would lock them all out
+func basicAuthFailed(c *fiber.Ctx) {
+	if attempts, _, _ := loginLockoutSettings(); attempts > 0 {
+		addressLoginFailed(c, attempts)
+	}
+}
+
+// loginWait tells how long until sign-in works again, rounded up, e.g. "3 minutes"
+func loginWait(wait time.Duration) string {
+	if wait < time.Minute {
+		return pluralize(int64(math.Ceil(wait.Seconds())), "second")
+	}
+	return pluralize(int64(math.Ceil(wait.Minutes())), "minute")
+}
+
+// setRetryAfter tells clients in whole seconds when to try signing in again
+func setRetryAfter(c *fiber.Ctx, wait time.Duration) {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
+
+// renderLoginLocked answers a sign-in while the account or address is locked, without checking the password
+func renderLoginLocked(c *fiber.Ctx, username string, wait time.Duration) error {
+	setRetryAfter(c, wait)
+	return c.Status(fiber.StatusTooManyRequests).Render("login", loginView(fiber.Map{
+		"Error":    "Too many failed sign-ins. Try again in " + loginWait(wait) + ".",
+		"Username": username,
+	}))
+}
+
+// unlockUserHandler lets an admin lift the lockout of an account before it runs out
+func unlockUserHandler(c *fiber.Ctx) error {
+	id, err := parseGroupID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid user")
+	}
+	var user User
+	if err := db.First(&user, id).Error; err != nil {
+		return c.Status(404).SendString("User not found")
+	}
+	clearLoginFailures(loginAccountKey(user.Username))
+	recordAudit("user.unlock", clientInfoFromRequest(c), 0, nil, fmt.Sprintf("Unlocked password sign-in of '%s'", user.Username))
+	return c.Redirect("/users", fiber.StatusSeeOther)
+}
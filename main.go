@@ -1,13 +1,17 @@
 package main
 
 import (
-	"bytes"
+	"bufio"
+	"context"
 	"embed"
-	"encoding/csv"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"sort"
 	"strconv"
@@ -16,7 +20,7 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/template/handlebars/v2"
-	"gorm.io/driver/sqlite"
+	"github.com/valyala/fasthttp"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
@@ -26,92 +30,221 @@ var embeddedFS embed.FS
 
 // Round represents a work session with start and end times
 type WorkingGroup struct {
-	ID        uint   `gorm:"primaryKey"`
-	Name      string `gorm:"unique;not null"`
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	Rounds    []Round
+	ID                 uint      `gorm:"primaryKey" json:"id"`
+	UserID             uint      `gorm:"uniqueIndex:idx_working_groups_user_name;default:0" json:"user_id"` // Owner, 0 until the first account claims it
+	Name               string    `gorm:"uniqueIndex:idx_working_groups_user_name;size:191;not null" json:"name"`
+	ParentID           *uint     `gorm:"index" json:"parent_id"`                      // Group this one is a subgroup of, nil at the top level
+	SyncID             string    `gorm:"index;size:36" json:"sync_id"`                // Identifies the group across synced instances
+	DailyTargetMinutes int       `gorm:"default:0" json:"daily_target_minutes"`       // Time aimed for per day, 0 for none
+	Billable           bool      `gorm:"not null;default:true" json:"billable"`       // Whether new rounds of the group are billable
+	Internal           bool      `gorm:"not null;default:false" json:"internal"`      // Internal work (meetings, admin) rather than for a client
+	NotifyMuted        bool      `gorm:"not null;default:false" json:"notify_muted"`  // Left out of notifications and summaries
+	HourlyRateCents    int64     `gorm:"not null;default:0" json:"hourly_rate_cents"` // Earned per hour of billable time, in the currency's cents; 0 for none
+	Currency           string    `gorm:"size:3" json:"currency,omitempty"`            // ISO 4217 code of the rate, e.g. EUR
+	Color              string    `gorm:"size:7" json:"color,omitempty"`               // #rrggbb; empty for one from groupPalette
+	Icon               string    `gorm:"size:32" json:"icon,omitempty"`               // Emoji shown in front of the name
+	Description        string    `gorm:"size:1000" json:"description,omitempty"`
+	ExternalRef        string    `gorm:"size:100;index" json:"external_ref,omitempty"`        // The group in another system, e.g. a Jira project key
+	OverlapPolicy      string    `gorm:"size:8;not null;default:allow" json:"overlap_policy"` // Whether rounds added or edited by hand may overlap other groups' rounds, see overlapAllow
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+	Rounds             []Round   `json:"rounds,omitempty"`
 }
 
 type Round struct {
-	ID             uint       `gorm:"primaryKey"`
-	StartTime      time.Time  `gorm:"not null"`
-	EndTime        *time.Time `gorm:"index"` // NULL means round is still in progress
-	WorkingGroupID uint       `gorm:"index"`
-	WorkingGroup   WorkingGroup
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
+	ID             uint         `gorm:"primaryKey" json:"id"`
+	StartTime      time.Time    `gorm:"not null;index:idx_rounds_group_start,priority:2" json:"start_time"`
+	EndTime        *time.Time   `gorm:"index;index:idx_rounds_group_end,priority:2;index:idx_rounds_group_start,priority:3" json:"end_time"` // NULL means round is still in progress
+	WorkingGroupID uint         `gorm:"index:idx_rounds_group_end,priority:1;index:idx_rounds_group_start,priority:1" json:"working_group_id"`
+	WorkingGroup   WorkingGroup `json:"-"`
+	StartedBy      string       `json:"started_by"` // Client that started the round (browser, curl, token name, ...)
+	StartUserAgent string       `json:"start_user_agent"`
+	StoppedBy      string       `json:"stopped_by"` // Client that stopped the round, empty while running
+	StopUserAgent  string       `json:"stop_user_agent"`
+	InvoiceID      *uint        `gorm:"index" json:"invoice_id"` // Set once the round has been billed
+	Billable       *bool        `json:"billable"`                // Client time; taken from the group when created without
+	Note           string       `json:"note"`
+	TimeZone       string       `gorm:"size:64" json:"time_zone,omitempty"`          // IANA zone the client was in, empty for home
+	Source         string       `gorm:"size:16;index" json:"source"`                 // How the round was created, see roundSources
+	ExternalID     string       `gorm:"size:191;index" json:"external_id,omitempty"` // ID of the entry it was imported from, see importDeduper
+	Flagged        bool         `gorm:"index" json:"flagged"`                        // Stopped before MIN_ROUND_DURATION and not reviewed yet
+	Discarded      bool         `gorm:"-" json:"discarded,omitempty"`                // Stopped before MIN_ROUND_DURATION and deleted at once
+	PausedAt       *time.Time   `json:"paused_at,omitempty"`                         // Set while the running round is paused, see RoundPause
+	PausedSeconds  int64        `gorm:"not null;default:0" json:"paused_seconds"`    // Finished pauses, left out of the round's duration
+	Overlaps       []uint       `gorm:"-" json:"overlaps,omitempty"`                 // Rounds of other groups it was saved over with an overlap warning
+	Tags           []Tag        `gorm:"many2many:round_tags;constraint:OnDelete:CASCADE" json:"tags,omitempty"`
+	SyncID         string       `gorm:"index;size:36" json:"sync_id"` // Identifies the round across synced instances
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
 }
 
 var db *gorm.DB
 
 // AppState represents the current state of the application
 type AppState struct {
-	GroupID               uint
-	GroupName             string
-	LastStartTime         *time.Time
-	LastStopTime          *time.Time
-	IsRunning             bool
-	LastStartStr          string
-	LastStopStr           string
-	CurrentRoundID        *uint
-	TotalTodaySeconds     int64
-	TotalTodayFormatted   string
-	TotalOverallSeconds   int64
-	TotalOverallFormatted string
+	GroupID                  uint          `json:"group_id"`
+	GroupName                string        `json:"group_name"`
+	GroupColor               string        `json:"group_color"` // The group's color, or the one it got from groupPalette
+	GroupIcon                string        `json:"group_icon,omitempty"`
+	LastStartTime            *time.Time    `json:"last_start_time"`
+	LastStopTime             *time.Time    `json:"last_stop_time"`
+	ResumableUntil           *time.Time    `json:"resumable_until,omitempty"` // The last round can be resumed until then, see RESUME_GRACE
+	IsRunning                bool          `json:"is_running"`
+	IsPaused                 bool          `json:"is_paused"`              // The running round is on a break; totals stand still
+	PausedSince              *time.Time    `json:"paused_since,omitempty"` // Start of the running round's pause
+	CurrentRoundID           *uint         `json:"current_round_id"`
+	LastRoundID              uint          `json:"-"` // Round shown in the start/stop boxes, 0 if none
+	LastStartedBy            string        `json:"last_started_by"`
+	TotalTodaySeconds        int64         `json:"total_today_seconds"`
+	TotalTodayFormatted      string        `json:"total_today"`        // HH:MM:SS for API clients; views format the seconds
+	TotalWeekSeconds         int64         `json:"total_week_seconds"` // Rounds started since Monday
+	TotalWeekFormatted       string        `json:"total_week"`
+	TotalOverallSeconds      int64         `json:"total_overall_seconds"`
+	TotalOverallFormatted    string        `json:"total_overall"`
+	BillableTodaySeconds     int64         `json:"billable_today_seconds"` // The rest of today's total is non-billable
+	BillableOverallSeconds   int64         `json:"billable_overall_seconds"`
+	TodaySplit               billableSplit `json:"-"`
+	OverallSplit             billableSplit `json:"-"`
+	DailyTargetSeconds       int64         `json:"daily_target_seconds,omitempty"`
+	DailyTargetFormatted     string        `json:"-"`
+	DailyTargetLevel         string        `json:"daily_target_level,omitempty"` // under, on or over, empty without a target
+	DailyTargetClass         string        `json:"-"`
+	DailyTargetException     bool          `json:"daily_target_exception,omitempty"` // Today has its own target, see /groups/manage
+	DailyTargetReason        string        `json:"daily_target_reason,omitempty"`
+	TargetRemainingFormatted string        `json:"-"`
+	TargetReached            bool          `json:"target_reached,omitempty"`
+	TargetETA                *time.Time    `json:"target_eta,omitempty"` // When the target is hit at the current pace
+	TargetETAStr             string        `json:"-"`
+	WeeklyTargetSeconds      int64         `json:"weekly_target_seconds,omitempty"` // The week's plan, or its daily targets with exceptions
+	WeeklyTargetFormatted    string        `json:"-"`
+	WeeklyTargetLevel        string        `json:"weekly_target_level,omitempty"` // under, on or over, empty without a target
+	WeeklyTargetClass        string        `json:"-"`
+	Summary                  string        `json:"-"` // The state in sentences for screen readers, see statusSummary
+	// With the rounds of every group below this one; only set when the group has subgroups
+	SubgroupCount                    int   `json:"subgroup_count,omitempty"`
+	TotalTodayWithSubgroupsSeconds   int64 `json:"total_today_with_subgroups_seconds,omitempty"`
+	TotalWeekWithSubgroupsSeconds    int64 `json:"total_week_with_subgroups_seconds,omitempty"`
+	TotalOverallWithSubgroupsSeconds int64 `json:"total_overall_with_subgroups_seconds,omitempty"`
 }
 
 type StatusGroupOption struct {
 	ID       uint
 	Name     string
+	Icon     string
 	Selected bool
 }
 
 type StatusContext struct {
-	GroupOptions            []StatusGroupOption
-	SelectedGroupID         uint
-	State                   AppState
-	AllGroupsTotalSeconds   int64
-	AllGroupsTotalFormatted string
+	GroupOptions          []StatusGroupOption
+	SelectedGroupID       uint
+	State                 AppState
+	AllGroupsTotalSeconds int64
+	GroupWeeks            []GroupWeekStatus // Every group's week against its weekly target
+	UndoReset             *resetUndoOffer   // Set for a while after the group was reset
 }
 
 type GroupTotal struct {
-	GroupID        uint
-	GroupName      string
-	TotalSeconds   int64
-	TotalFormatted string
+	GroupID         uint
+	GroupName       string
+	GroupPath       string // The name with those of the parents, see groupPaths
+	Color           string // See groupColor
+	Icon            string
+	TotalSeconds    int64
+	Running         bool // A round of the group is running, its time so far is included
+	BillableSeconds int64
+	Split           billableSplit
+	EarnedCents     int64  // What the billable time earned at the group's rate
+	Currency        string // Of the group's rate, empty when it has none
+	HasSubgroups    bool
+	// With the rounds of the subgroups; earnings per currency, as their rates may differ
+	TotalWithSubgroupsSeconds int64
+	RunningWithSubgroups      bool
+	EarnedWithSubgroups       string
 }
 
 // DailySummary represents the total hours worked for a specific day
 type DailySummary struct {
-	GroupID        uint
-	GroupName      string
-	Date           string // Date in YYYY-MM-DD format
-	DateDisplay    string // Date in readable format
-	TotalSeconds   int64  // Total seconds worked
-	TotalFormatted string // Formatted as HH:mm:ss
-	RoundCount     int    // Number of rounds completed
+	GroupID         uint
+	GroupName       string
+	Date            string // Date in YYYY-MM-DD format
+	DateDisplay     string // Date in readable format
+	TotalSeconds    int64  // Total seconds worked
+	BillableSeconds int64  // The billable part of TotalSeconds
+	Split           billableSplit
+	EarnedCents     int64 // What BillableSeconds earned at the group's rate
+	RoundCount      int   // Number of rounds completed, without the flagged ones
+	FlaggedCount    int   // Rounds stopped before MIN_ROUND_DURATION that wait for review
+	RunningCount    int   // Number of rounds still running, counted up to now
+	Provisional     bool  // The total still grows while a round runs
+	BreakSeconds    int64 // Pauses of the day's rounds and breaks taken outside them, left out of TotalSeconds
 }
 
 func main() {
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML configuration file (default: "+defaultConfigFile+" when present)")
+	sqlitePath := flag.String("db", "", "SQLite database file, overrides the configuration")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, cliUsage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	// Errors and warnings are also kept for the admin dashboard
+	log.SetOutput(io.MultiWriter(os.Stderr, recentErrors))
+
+	config, err := loadConfig(*configFile)
+	if err != nil {
+		log.Fatal("Failed to load configuration: ", err)
+	}
+	cfg = config
+	if *sqlitePath != "" {
+		cfg.Database.SQLite.Path = *sqlitePath
+	}
+	if err := applyTimezone(); err != nil {
+		log.Fatal("Failed to load configuration: ", err)
+	}
+	oidcConfig = loadOIDCSettings()
+	if secrets, err = loadSecretKey(cfg.SecretsKey, cfg.SecretsKeyFile); err != nil {
+		log.Fatal("Failed to load configuration: secrets key: ", err)
+	}
+
 	// Initialize database with custom logger config
 	// Suppress "record not found" errors as they're expected in our logic
-	var err error
-	db, err = gorm.Open(sqlite.Open("hours.db"), &gorm.Config{
+	db, err = openDatabase(&gorm.Config{
 		Logger: logger.Default.LogMode(logger.Silent),
 	})
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
-	// Auto migrate the schema
-	err = db.AutoMigrate(&WorkingGroup{}, &Round{})
-	if err != nil {
+	if err := migrateDatabase(); err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
+	ensureSharedAuthUser()
+	ensureAdminExists()
 
 	// Ensure at least one working group exists and backfill existing rounds
-	ensureDefaultWorkingGroup()
+	ensureDefaultWorkingGroup(defaultOwnerID())
+
+	// Terminal subcommands work on the database and exit without starting the server
+	if command := flag.Arg(0); command != "" && command != "serve" {
+		os.Exit(runCommand(flag.Args()))
+	}
+	plaintext, err := checkStoredSecrets()
+	if err != nil {
+		log.Fatal("Failed to read the secrets stored in the database (set the key they were encrypted with, or see rekey): ", err)
+	}
+	if plaintext > 0 && secrets != nil {
+		log.Printf("Warning: %s in the database not encrypted yet; run the rekey command to encrypt them", pluralize(int64(plaintext), "secret"))
+	}
+
+	attachments = newAttachmentStore()
+	configureSessions()
+	configureNotifiers()
+	configureInflux()
+	configureTracing()
+	configureQueryStats()
+	startNightlySummary()
+	startSync()
+	startExportWorker()
 
 	// Initialize Handlebars template engine with embedded filesystem
 	// Wrap the embedded FS with http.FS for compatibility
@@ -119,12 +252,27 @@ func main() {
 	if err != nil {
 		log.Fatal("Failed to create sub filesystem:", err)
 	}
-	engine := handlebars.NewFileSystem(http.FS(viewsSubFS), ".hbs")
+	handlebarsEngine := handlebars.NewFileSystem(http.FS(viewsSubFS), ".hbs")
+	registerTemplateHelpers(handlebarsEngine)
+	var engine fiber.Views = handlebarsEngine
+	if tracingEnabled() {
+		engine = tracedViews{engine}
+	}
 
 	// Create Fiber app with template engine
-	app := fiber.New(fiber.Config{
-		Views: engine,
-	})
+	appConfig := fiber.Config{
+		Views:             engine,
+		PassLocalsToViews: true, // Exposes CSRFToken to every template
+		ErrorHandler:      requestErrorHandler,
+	}
+	if strings.HasPrefix(cfg.Listen, unixSocketPrefix) {
+		// Only the reverse proxy can reach a socket, so the client address it forwards can be trusted
+		appConfig.ProxyHeader = fiber.HeaderXForwardedFor
+		appConfig.EnableIPValidation = true
+	}
+	app := fiber.New(appConfig)
+	app.Use(assignRequestID)
+	app.Use(serveBasePath)
 
 	// Serve embedded static files
 	publicSubFS, err := fs.Sub(embeddedFS, "public")
@@ -152,27 +300,194 @@ func main() {
 	})
 
 	// Routes
-	app.Get("/", renderIndex)
-	app.Get("/status", getStatus)
-	app.Get("/stats", renderStats)
-	app.Post("/start", handleStart)
-	app.Post("/stop", handleStop)
-	app.Get("/export/csv", exportToCSV)
-	app.Post("/groups/reset", resetWorkingGroupHandler)
-	app.Get("/groups/manage", renderGroupManagement)
-	app.Post("/groups", createWorkingGroupHandler)
-	app.Post("/groups/:id/update", updateWorkingGroupHandler)
-	app.Post("/groups/:id/delete", deleteWorkingGroupHandler)
-
-	// Get server address from environment variable or use default
-	serverAddr := os.Getenv("SERVER_ADDR")
-	if serverAddr == "" {
-		serverAddr = ":3000"
+	if tracingEnabled() {
+		app.Use(traceRequests)
+	}
+	app.Use("/api/v1", apiCORS())
+	app.Use(tokenAuth)
+	for _, handler := range rateLimiters() {
+		app.Use(handler)
+	}
+	app.Use(requireLogin)
+	app.Use(csrfProtect)
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("Features", cfg.Features)
+		return c.Next()
+	})
+	read := requireScope(scopeRead)
+	control := requireScope(scopeControl)
+	admin := requireScope(scopeAdmin)
+
+	app.Get("/setup", renderSetup)
+	app.Post("/setup", setupHandler)
+	app.Get("/login", renderLogin)
+	app.Post("/login", loginHandler)
+	app.Post("/logout", logoutHandler)
+	app.Get("/auth/oidc/login", oidcLoginHandler)
+	app.Get("/auth/oidc/callback", oidcCallbackHandler)
+	if cfg.Features.Passkeys {
+		app.Post("/auth/passkey/begin", beginPasskeyLogin)
+		app.Post("/auth/passkey/finish", finishPasskeyLogin)
+		app.Post("/passkeys/register/begin", read, beginPasskeyRegistration)
+		app.Post("/passkeys/register/finish", read, finishPasskeyRegistration)
+		app.Post("/passkeys/:id/delete", read, deletePasskeyHandler)
+		app.Post("/users/password/remove", read, removePasswordHandler)
+	}
+	app.Post("/sessions/revoke-others", read, revokeOtherSessionsHandler)
+	app.Post("/sessions/:id/delete", read, deleteSessionHandler)
+	app.Get("/users", read, renderUsers)
+	app.Post("/users", admin, createUserHandler)
+	app.Post("/users/password", read, changePasswordHandler)
+	app.Post("/users/email", read, updateEmailHandler)
+	app.Post("/users/email-in", control, createEmailInHandler)
+	app.Post("/users/email-in/remove", control, removeEmailInHandler)
+	app.Post("/users/phone", read, updatePhoneHandler)
+	app.Post("/inbound/mailgun", inboundMailgunHandler)
+	app.Post("/inbound/twilio", inboundTwilioHandler)
+	if cfg.Features.Voice {
+		app.Post("/inbound/voice", voiceHandler)
+	}
+	app.Post("/users/:id/role", admin, updateUserRoleHandler)
+	app.Post("/users/:id/unlock", admin, unlockUserHandler)
+
+	app.Get("/", read, renderIndex)
+	app.Get("/status", read, getStatus)
+	app.Get("/board", read, renderBoard)
+	app.Get("/wallboard", read, renderWallboard)
+	app.Get("/basic", read, renderBasicStatus)
+	app.Get("/events", read, eventsHandler)
+	app.Get("/stats", read, renderStats)
+	app.Post("/start", control, handleStart)
+	app.Post("/stop", control, handleStop)
+	app.Post("/resume", control, handleResume)
+	app.Post("/pause", control, handlePause)
+	app.Post("/continue", control, handleContinue)
+	app.Get("/export/csv", read, exportToCSV)
+	app.Get("/exports", read, renderExports)
+	app.Post("/exports", read, createExportHandler)
+	app.Get("/exports/:id/download", read, downloadExportHandler)
+	app.Post("/exports/settings", admin, saveCSVOptionsHandler)
+	app.Post("/groups/reset", admin, resetWorkingGroupHandler)
+	app.Post("/groups/reset/undo", admin, undoResetHandler)
+	app.Get("/groups/manage", control, renderGroupManagement)
+	app.Post("/groups", control, createWorkingGroupHandler)
+	app.Post("/groups/:id/update", control, updateWorkingGroupHandler)
+	app.Post("/groups/exceptions", control, saveCapacityExceptionHandler)
+	app.Post("/groups/exceptions/:id/delete", control, deleteCapacityExceptionHandler)
+	app.Post("/groups/holidays", control, saveHolidayRegionHandler)
+	app.Post("/groups/:id/delete", admin, deleteWorkingGroupHandler)
+	app.Get("/rounds", read, renderRoundList)
+	app.Get("/search", read, renderSearch)
+	app.Post("/rounds/manual", control, manualRoundHandler)
+	app.Get("/rounds/:id", read, renderRoundDetail)
+	app.Post("/rounds/:id/edit", control, editRoundHandler)
+	app.Post("/rounds/:id/split", control, splitRoundHandler)
+	app.Post("/rounds/:id/review", control, reviewRoundHandler)
+	app.Post("/rounds/merge", control, mergeRoundsHandler)
+	app.Get("/audit", read, renderAuditLog)
+	app.Get("/tokens", control, renderTokens)
+	app.Post("/tokens", control, createTokenHandler)
+	app.Post("/tokens/:id/delete", control, deleteTokenHandler)
+	app.Get("/invoices", read, renderInvoices)
+	app.Post("/invoices", admin, createInvoiceHandler)
+	app.Get("/invoices/:id", read, renderInvoiceDetail)
+	app.Post("/invoices/:id/status", admin, updateInvoiceStatusHandler)
+	app.Post("/invoices/:id/delete", admin, deleteInvoiceHandler)
+	app.Get("/reports/archive", read, renderReportArchive)
+	app.Post("/reports/archive", control, archiveMonthHandler)
+	app.Get("/reports/archive/:id", read, downloadArchivedReport)
+	app.Get("/reports/overhead", read, renderOverheadReport)
+	app.Get("/reports/overlaps", read, renderOverlapReport)
+	app.Get("/stats/day/:date", read, renderDayDetail)
+	app.Post("/breaks", control, saveBreakHandler)
+	app.Post("/breaks/:id/delete", control, deleteBreakHandler)
+	app.Post("/attachments", control, uploadAttachmentHandler)
+	app.Get("/attachments/:id", read, downloadAttachmentHandler)
+	app.Post("/attachments/:id/delete", admin, deleteAttachmentHandler)
+	app.Get("/settings/notifications", admin, renderNotificationSettings)
+	app.Post("/settings/notifications", admin, saveNotificationSettingsHandler)
+	app.Post("/settings/notifications/test", admin, testNotificationHandler)
+	app.Post("/settings/notifications/dnd", admin, saveDNDHandler)
+	app.Get("/admin", admin, renderAdminDashboard)
+	app.Post("/api/v1/push/subscribe", admin, subscribePushHandler)
+	app.Get("/timesheet", read, renderTimesheet)
+	app.Get("/calendar", read, renderCalendar)
+	app.Post("/timesheet", control, saveTimesheet)
+	app.Get("/planning", read, renderPlanning)
+	app.Post("/planning", control, savePlanning)
+	app.Get("/import/calendar", control, renderCalendarImport)
+	app.Post("/import/calendar/preview", control, previewCalendarImport)
+	app.Post("/import/calendar/confirm", control, confirmCalendarImport)
+	app.Post("/import/calendar/feeds", control, createCalendarFeedHandler)
+	app.Post("/import/calendar/feeds/:id/delete", control, deleteCalendarFeedHandler)
+	app.Post("/import/calendar/rules", control, createMappingRuleHandler)
+	app.Post("/import/calendar/rules/:id/delete", control, deleteMappingRuleHandler)
+	app.Get("/import/file", control, renderFileImport)
+	app.Post("/import/file/preview", control, previewFileImportHandler)
+	app.Post("/import/file/confirm", control, confirmFileImportHandler)
+	app.Get("/api/v1/status", read, apiStatus)
+	app.Get("/api/v1/board", read, apiBoard)
+	app.Get("/api/v1/wallboard", read, apiWallboard)
+	app.Get("/api/v1/groups", read, apiListGroups)
+	app.Get("/api/v1/rounds", read, apiListRounds)
+	app.Get("/api/v1/search", read, apiSearch)
+	app.Get("/api/v1/rounds/:id", read, apiGetRound)
+	app.Put("/api/v1/rounds/:id", control, apiReplaceRound)
+	app.Patch("/api/v1/rounds/:id", control, apiUpdateRound)
+	app.Post("/api/v1/rounds/:id/split", control, apiSplitRound)
+	app.Post("/api/v1/rounds/merge", control, apiMergeRounds)
+	app.Post("/api/v1/rounds/bulk", control, apiBulkEditRounds)
+	app.Get("/api/v1/reports/overhead", read, apiOverheadReport)
+	app.Get("/api/v1/reports/overlaps", read, apiOverlapReport)
+	app.Get("/api/v1/holidays", read, apiListHolidays)
+	app.Get("/api/v1/breaks", read, apiListBreaks)
+	app.Post("/api/v1/breaks", control, apiAddBreak)
+	app.Delete("/api/v1/breaks/:id", control, apiDeleteBreak)
+	app.Post("/api/v1/toggle", control, apiToggle)
+	app.Post("/api/v1/resume", control, apiResume)
+	app.Post("/api/v1/pause", control, apiPause)
+	app.Post("/api/v1/continue", control, apiContinue)
+	app.Post("/api/v1/stop-all", control, apiStopAll)
+	app.Post("/api/v1/note", control, apiAddNote)
+	app.Post("/api/v1/exports", read, apiCreateExport)
+	app.Get("/api/v1/exports/:id", read, apiGetExport)
+	app.Get("/api/v1/deck", read, apiDeckStatus)
+	app.Post("/api/v1/deck/toggle", control, apiDeckToggle)
+	if cfg.Features.Grafana {
+		app.Get("/grafana", read, grafanaTest)
+		app.Post("/grafana/search", read, grafanaSearch)
+		app.Post("/grafana/metrics", read, grafanaMetrics)
+		app.Post("/grafana/query", read, grafanaQuery)
+		app.Post("/grafana/annotations", read, grafanaAnnotations)
+	}
+	app.Get("/api/v1/mappings", read, apiListMappings)
+	app.Put("/api/v1/mappings", control, apiSaveMapping)
+	app.Delete("/api/v1/mappings/:id", control, apiDeleteMapping)
+	app.Post("/api/v1/import/preview", control, apiImportPreview)
+	app.Post("/api/v1/import/confirm", control, apiImportConfirm)
+	app.Get("/api/v1/sync", read, apiSyncExport)
+	app.Post("/api/v1/sync", control, apiSyncImport)
+	app.Get("/api/v1/changes", read, apiChanges)
+	app.Get("/api/v1/watch", read, apiWatchStatus)
+	app.Post("/api/v1/watch/toggle", control, apiWatchToggle)
+	if cfg.Features.APIDocs {
+		app.Get("/api/openapi.json", serveOpenAPISpec)
+		app.Get("/api/docs", renderAPIDocs)
+	}
+	if cfg.Features.Profiling {
+		mountProfiling(app, admin)
+	}
+	if cfg.Features.ActionLinks {
+		app.Post("/api/v1/action-links", control, apiCreateActionLink)
+		app.Post("/rounds/:id/stop-link", control, createStopLinkHandler)
+
+		// Signed action links carry their own authorization
+		app.Get("/a/:token", renderActionLink)
+		app.Post("/a/:token", executeActionLink)
 	}
 
 	// Start server
-	log.Printf("Server starting on %s", serverAddr)
-	log.Fatal(app.Listen(serverAddr))
+	log.Fatal(listen(app))
 }
 
 func renderIndex(c *fiber.Ctx) error {
@@ -183,18 +498,21 @@ func renderIndex(c *fiber.Ctx) error {
 		}
 	}
 
-	context, err := buildStatusContext(requestedGroupID)
+	context, err := buildStatusContext(traceContext(c), currentUserID(c), requestedGroupID)
 	if err != nil {
-		log.Println("Error building status context:", err)
+		requestLog(c).Println("Error building status context:", err)
 		return c.Status(500).SendString("Error rendering page")
 	}
 
 	return c.Render("index", fiber.Map{
-		"GroupOptions":            context.GroupOptions,
-		"SelectedGroupID":         context.SelectedGroupID,
-		"State":                   context.State,
-		"AllGroupsTotalSeconds":   context.AllGroupsTotalSeconds,
-		"AllGroupsTotalFormatted": context.AllGroupsTotalFormatted,
+		"GroupOptions":          context.GroupOptions,
+		"SelectedGroupID":       context.SelectedGroupID,
+		"State":                 context.State,
+		"AllGroupsTotalSeconds": context.AllGroupsTotalSeconds,
+		"GroupWeeks":            context.GroupWeeks,
+		"UndoReset":             context.UndoReset,
+		"CurrentUser":           currentUser(c),
+		"Can":                   permissionsView(c),
 	})
 }
 
@@ -206,9 +524,9 @@ func getStatus(c *fiber.Ctx) error {
 		}
 	}
 
-	context, err := buildStatusContext(requestedGroupID)
+	context, err := buildStatusContext(traceContext(c), currentUserID(c), requestedGroupID)
 	if err != nil {
-		log.Println("Error building status context:", err)
+		requestLog(c).Println("Error building status context:", err)
 		return c.Status(500).SendString("Error rendering status")
 	}
 
@@ -217,11 +535,13 @@ func getStatus(c *fiber.Ctx) error {
 
 func renderStatusTemplate(c *fiber.Ctx, context StatusContext) error {
 	return c.Render("status", fiber.Map{
-		"GroupOptions":            context.GroupOptions,
-		"SelectedGroupID":         context.SelectedGroupID,
-		"State":                   context.State,
-		"AllGroupsTotalSeconds":   context.AllGroupsTotalSeconds,
-		"AllGroupsTotalFormatted": context.AllGroupsTotalFormatted,
+		"GroupOptions":          context.GroupOptions,
+		"SelectedGroupID":       context.SelectedGroupID,
+		"State":                 context.State,
+		"AllGroupsTotalSeconds": context.AllGroupsTotalSeconds,
+		"GroupWeeks":            context.GroupWeeks,
+		"UndoReset":             context.UndoReset,
+		"Can":                   permissionsView(c),
 	})
 }
 
@@ -236,32 +556,16 @@ func handleStart(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid working group")
 	}
 
-	var group WorkingGroup
-	if err := db.First(&group, groupID).Error; err != nil {
-		return c.Status(404).SendString("Working group not found")
-	}
-
-	// Ensure no active round for this group
-	var activeRound Round
-	if err := db.Where("working_group_id = ? AND end_time IS NULL", groupID).First(&activeRound).Error; err == nil {
-		return c.Status(400).SendString("Cannot start: this working group already has a running round")
+	if _, err := startRound(groupID, clientInfoFromRequest(c)); err != nil {
+		return sendRoundError(c, err, "Error starting round")
 	}
-
-	round := Round{
-		StartTime:      time.Now(),
-		WorkingGroupID: groupID,
-	}
-
-	if err := db.Create(&round).Error; err != nil {
-		log.Println("Error creating round:", err)
-		return c.Status(500).SendString("Error starting round")
+	if c.FormValue("return") == "basic" {
+		return basicStatusRedirect(c, groupID)
 	}
 
-	log.Printf("Started new round #%d for group '%s' at %s", round.ID, group.Name, round.StartTime.Format("2006-01-02 15:04:05"))
-
-	context, err := buildStatusContext(groupID)
+	context, err := buildStatusContext(traceContext(c), currentUserID(c), groupID)
 	if err != nil {
-		log.Println("Error building status context:", err)
+		requestLog(c).Println("Error building status context:", err)
 		return c.Status(500).SendString("Error rendering status")
 	}
 
@@ -279,39 +583,57 @@ func handleStop(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid working group")
 	}
 
-	var group WorkingGroup
-	if err := db.First(&group, groupID).Error; err != nil {
-		return c.Status(404).SendString("Working group not found")
+	// Tags are checked first, so a typo doesn't leave the round stopped without them
+	tags, err := parseTagNames(c.FormValue("tags"))
+	if err != nil {
+		return c.Status(400).SendString(err.Error())
 	}
 
-	var activeRound Round
-	if err := db.Where("working_group_id = ? AND end_time IS NULL", groupID).First(&activeRound).Error; err != nil {
-		return c.Status(400).SendString("Cannot stop: no round is running for this working group")
+	client := clientInfoFromRequest(c)
+	round, err := stopRound(groupID, client)
+	if err != nil {
+		return sendRoundError(c, err, "Error stopping round")
 	}
-
-	now := time.Now()
-	activeRound.EndTime = &now
-	if err := db.Save(&activeRound).Error; err != nil {
-		log.Println("Error updating round:", err)
-		return c.Status(500).SendString("Error stopping round")
+	// A round discarded as too short is gone, and its tags with it
+	if len(tags) > 0 && !round.Discarded {
+		if err := tagRound(&round, tags, client); err != nil {
+			requestLog(c).Println("Error tagging round:", err)
+			return c.Status(500).SendString("The round was stopped, but its tags could not be saved")
+		}
+	}
+	if c.FormValue("return") == "basic" {
+		return basicStatusRedirect(c, groupID)
 	}
 
-	duration := now.Sub(activeRound.StartTime)
-	log.Printf("Stopped round #%d for group '%s' at %s (duration: %s)",
-		activeRound.ID,
-		group.Name,
-		now.Format("2006-01-02 15:04:05"),
-		duration.Round(time.Second))
-
-	context, err := buildStatusContext(groupID)
+	context, err := buildStatusContext(traceContext(c), currentUserID(c), groupID)
 	if err != nil {
-		log.Println("Error building status context:", err)
+		requestLog(c).Println("Error building status context:", err)
 		return c.Status(500).SendString("Error rendering status")
 	}
 
 	return renderStatusTemplate(c, context)
 }
 
+// sendRoundError maps errors returned by startRound/stopRound to HTTP responses
+func sendRoundError(c *fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, errGroupNotFound):
+		return c.Status(404).SendString("Working group not found")
+	case errors.Is(err, errRoundRunning):
+		return c.Status(400).SendString("Cannot start: this working group already has a running round")
+	case errors.Is(err, errNoRoundRunning):
+		return c.Status(400).SendString("Cannot stop: no round is running for this working group")
+	case errors.Is(err, errNothingToResume):
+		return c.Status(400).SendString("Cannot resume: the last round stopped too long ago, is billed, or there is none")
+	case errors.Is(err, errRoundPaused):
+		return c.Status(400).SendString("Cannot pause: the round is already paused")
+	case errors.Is(err, errRoundNotPaused):
+		return c.Status(400).SendString("Cannot continue: the round is not paused")
+	default:
+		return c.Status(500).SendString(fallback)
+	}
+}
+
 func resetWorkingGroupHandler(c *fiber.Ctx) error {
 	groupIDStr := c.FormValue("group_id")
 	if groupIDStr == "" {
@@ -323,21 +645,47 @@ func resetWorkingGroupHandler(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid working group")
 	}
 
-	var group WorkingGroup
-	if err := db.First(&group, groupID).Error; err != nil {
+	group, err := findUserGroup(currentUserID(c), groupID)
+	if err != nil {
 		return c.Status(404).SendString("Working group not found")
 	}
 
-	if err := db.Where("working_group_id = ?", groupID).Delete(&Round{}).Error; err != nil {
-		log.Println("Error resetting working group rounds:", err)
+	// Nothing is deleted unless it was saved first; rounds started since the snapshot stay
+	snapshot, report, err := snapshotGroupRounds(currentUserID(c), group)
+	if err != nil {
+		requestLog(c).Println("Error saving snapshot before reset:", err)
+		return c.Status(500).SendString("Error resetting working group")
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, round := range snapshot.Rounds {
+			if err := deleteRoundPauses(tx, round.ID); err != nil {
+				return err
+			}
+			if err := tx.Delete(&Round{}, round.ID).Error; err != nil {
+				return err
+			}
+			if err := recordTombstone(tx, currentUserID(c), "round", round.ID, round.SyncID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		requestLog(c).Println("Error resetting working group rounds:", err)
 		return c.Status(500).SendString("Error resetting working group")
 	}
 
-	log.Printf("Reset all rounds for working group '%s'", group.Name)
+	requestLog(c).Printf("Reset all rounds for working group '%s'", group.Name)
+	details := fmt.Sprintf("Reset all rounds for '%s'", group.Name)
+	if report.ID != 0 {
+		details += fmt.Sprintf(", saved as archived report #%d", report.ID)
+	}
+	recordAudit("group.reset", clientInfoFromRequest(c), group.ID, nil, details)
+	notifyRoundChange(group.ID)
 
-	context, err := buildStatusContext(groupID)
+	context, err := buildStatusContext(traceContext(c), currentUserID(c), groupID)
 	if err != nil {
-		log.Println("Error building status context:", err)
+		requestLog(c).Println("Error building status context:", err)
 		return c.Status(500).SendString("Error rendering status")
 	}
 
@@ -345,30 +693,91 @@ func resetWorkingGroupHandler(c *fiber.Ctx) error {
 }
 
 func renderGroupManagement(c *fiber.Ctx) error {
-	groups, err := getWorkingGroupsOrdered()
+	userID := currentUserID(c)
+	groups, err := getWorkingGroupsOrdered(userID)
 	if err != nil {
-		log.Println("Error fetching working groups:", err)
+		requestLog(c).Println("Error fetching working groups:", err)
 		return c.Status(500).SendString("Error loading working group management")
 	}
 
 	if len(groups) == 0 {
-		defaultGroup := ensureDefaultWorkingGroup()
+		defaultGroup := ensureDefaultWorkingGroup(userID)
 		groups = []WorkingGroup{defaultGroup}
 	}
 
+	totals, err := sumRoundTotals(traceContext(c), userRounds(userID))
+	if err != nil {
+		requestLog(c).Println("Error summing round totals:", err)
+		return c.Status(500).SendString("Error loading working group management")
+	}
+
+	metadata, err := loadGroupMetadata(db, groups)
+	if err != nil {
+		requestLog(c).Println("Error loading group metadata:", err)
+		return c.Status(500).SendString("Error loading working group management")
+	}
+
+	paths := groupPaths(groups)
+	rolled := rollUpTotals(groups, totals)
 	var groupViews []fiber.Map
+	var parentOptions []StatusGroupOption
 	for _, group := range groups {
-		_, total := calculateGroupTotals(group.ID)
+		total := totals[group.ID].TotalSeconds
+		subgroups := subgroupIDs(groups, group.ID)
+		// A group can go under any other group except those below it
+		var parents []StatusGroupOption
+		for _, parent := range groups {
+			if checkGroupParent(groups, group.ID, parent.ID) == nil {
+				parents = append(parents, StatusGroupOption{
+					ID:       parent.ID,
+					Name:     paths[parent.ID],
+					Selected: group.ParentID != nil && *group.ParentID == parent.ID,
+				})
+			}
+		}
+		parentOptions = append(parentOptions, StatusGroupOption{ID: group.ID, Name: paths[group.ID]})
 		groupViews = append(groupViews, fiber.Map{
-			"ID":             group.ID,
-			"Name":           group.Name,
-			"TotalFormatted": formatDuration(total),
-			"HasRounds":      total > 0,
+			"ID":                        group.ID,
+			"Name":                      group.Name,
+			"Color":                     groupColor(group),
+			"Icon":                      group.Icon,
+			"Description":               group.Description,
+			"ExternalRef":               group.ExternalRef,
+			"Metadata":                  formatGroupMetadata(metadata[group.ID]),
+			"MetadataCount":             len(metadata[group.ID]),
+			"Path":                      paths[group.ID],
+			"ParentOptions":             parents,
+			"HasSubgroups":              len(subgroups) > 0,
+			"TotalWithSubgroupsSeconds": rolled[group.ID].TotalSeconds,
+			"TotalSeconds":              total,
+			"HasRounds":                 total > 0,
+			"DailyTarget":               formatTimesheetHours(int64(group.DailyTargetMinutes) * 60),
+			"Billable":                  group.Billable,
+			"Internal":                  group.Internal,
+			"NotifyMuted":               group.NotifyMuted,
+			"OverlapPolicies":           overlapPolicyOptions(group.OverlapPolicy),
+			"HourlyRate":                formatRateInput(group.HourlyRateCents),
+			"Currency":                  group.Currency,
 		})
 	}
 
+	exceptions, err := capacityExceptionViews(userID, groups)
+	if err != nil {
+		requestLog(c).Println("Error loading day exceptions:", err)
+		return c.Status(500).SendString("Error loading working group management")
+	}
+	holidays, err := holidayPageData(userID)
+	if err != nil {
+		requestLog(c).Println("Error loading public holidays:", err)
+		return c.Status(500).SendString("Error loading working group management")
+	}
+
 	return c.Render("groups", fiber.Map{
-		"Groups": groupViews,
+		"Groups":        groupViews,
+		"ParentOptions": parentOptions,
+		"Exceptions":    exceptions,
+		"Holidays":      holidays,
+		"Today":         time.Now().Format("2006-01-02"),
 	})
 }
 
@@ -378,11 +787,35 @@ func createWorkingGroupHandler(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Group name cannot be empty")
 	}
 
-	group := WorkingGroup{Name: name}
+	icon, err := parseGroupIcon(c.FormValue("icon"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid icon: " + err.Error())
+	}
+
+	userID := currentUserID(c)
+	parentID, err := parseParentID(c.FormValue("parent_id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid parent group")
+	}
+	details := fmt.Sprintf("Created group '%s'", name)
+	if parentID != nil {
+		groups, err := getWorkingGroupsOrdered(userID)
+		if err != nil {
+			requestLog(c).Println("Error fetching working groups:", err)
+			return c.Status(500).SendString("Error creating working group")
+		}
+		if err := checkGroupParent(groups, 0, *parentID); err != nil {
+			return c.Status(400).SendString("Invalid parent group: " + err.Error())
+		}
+		details += fmt.Sprintf(" under '%s'", groupPaths(groups)[*parentID])
+	}
+
+	group := WorkingGroup{Name: name, UserID: userID, ParentID: parentID, Icon: icon}
 	if err := db.Create(&group).Error; err != nil {
-		log.Println("Error creating working group:", err)
+		requestLog(c).Println("Error creating working group:", err)
 		return c.Status(500).SendString("Error creating working group")
 	}
+	recordAudit("group.create", clientInfoFromRequest(c), group.ID, nil, details)
 
 	return c.Redirect("/groups/manage", fiber.StatusSeeOther)
 }
@@ -398,11 +831,177 @@ func updateWorkingGroupHandler(c *fiber.Ctx) error {
 	if name == "" {
 		return c.Status(400).SendString("Group name cannot be empty")
 	}
+	target, err := parseTimesheetHours(c.FormValue("daily_target"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid daily target: " + err.Error())
+	}
 
-	if err := db.Model(&WorkingGroup{}).Where("id = ?", id).Update("name", name).Error; err != nil {
-		log.Println("Error updating working group:", err)
+	userID := currentUserID(c)
+	group, err := findUserGroup(userID, id)
+	if err != nil {
+		return c.Status(404).SendString("Working group not found")
+	}
+	parentID, err := parseParentID(c.FormValue("parent_id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid parent group")
+	}
+	groups, err := getWorkingGroupsOrdered(userID)
+	if err != nil {
+		requestLog(c).Println("Error fetching working groups:", err)
 		return c.Status(500).SendString("Error updating working group")
 	}
+	if parentID != nil {
+		if err := checkGroupParent(groups, id, *parentID); err != nil {
+			return c.Status(400).SendString("Invalid parent group: " + err.Error())
+		}
+	}
+	billable := c.FormValue("billable") == "on"
+	internal := c.FormValue("internal") == "on"
+	muted := c.FormValue("notify_muted") == "on"
+	overlapPolicy, err := parseOverlapPolicy(c.FormValue("overlap_policy"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid overlap policy: " + err.Error())
+	}
+	rate, err := parseHourlyRate(c.FormValue("hourly_rate"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid hourly rate: " + err.Error())
+	}
+	currency := ""
+	if rate > 0 {
+		if currency, err = parseCurrency(c.FormValue("currency")); err != nil {
+			return c.Status(400).SendString("Invalid currency of the hourly rate: " + err.Error())
+		}
+	}
+	color, err := parseGroupColor(c.FormValue("color"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid color: " + err.Error())
+	}
+	if color == "" || color == groupColor(group) {
+		// The picker always sends a color; an untouched one keeps the group on its palette color
+		color = group.Color
+	}
+	icon, err := parseGroupIcon(c.FormValue("icon"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid icon: " + err.Error())
+	}
+	description, err := parseGroupDescription(c.FormValue("description"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid description: " + err.Error())
+	}
+	externalRef, err := parseGroupExternalRef(c.FormValue("external_ref"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid external reference: " + err.Error())
+	}
+	metadata, err := parseGroupMetadata(c.FormValue("metadata"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid metadata: " + err.Error())
+	}
+	oldMetadata, err := loadGroupMetadata(db, []WorkingGroup{group})
+	if err != nil {
+		requestLog(c).Println("Error loading group metadata:", err)
+		return c.Status(500).SendString("Error updating working group")
+	}
+	// Updates writes the new values into group, so keep the old ones for the audit entry
+	oldTarget, oldBillable, oldInternal, oldMuted := group.DailyTargetMinutes, group.Billable, group.Internal, group.NotifyMuted
+	oldRate, oldCurrency, oldParentID := group.HourlyRateCents, group.Currency, group.ParentID
+	oldColor, oldIcon, oldDescription, oldExternalRef := group.Color, group.Icon, group.Description, group.ExternalRef
+	oldOverlapPolicy := group.OverlapPolicy
+	updates := map[string]interface{}{"name": name, "daily_target_minutes": int(target / 60), "billable": billable, "internal": internal,
+		"notify_muted": muted, "hourly_rate_cents": rate, "currency": currency, "parent_id": parentID, "color": color, "icon": icon,
+		"description": description, "external_ref": externalRef, "overlap_policy": overlapPolicy}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&group).Updates(updates).Error; err != nil {
+			return err
+		}
+		if sameGroupMetadata(metadata, oldMetadata[group.ID]) {
+			return nil
+		}
+		return replaceGroupMetadata(tx, group.ID, metadata)
+	})
+	if err != nil {
+		requestLog(c).Println("Error updating working group:", err)
+		return c.Status(500).SendString("Error updating working group")
+	}
+	details := fmt.Sprintf("Renamed group to '%s'", name)
+	if int(target/60) != oldTarget {
+		if target >= 60 {
+			details += ", daily target " + formatTimesheetHours(target)
+		} else {
+			details += ", daily target removed"
+		}
+	}
+	if billable != oldBillable {
+		if billable {
+			details += ", new rounds billable"
+		} else {
+			details += ", new rounds non-billable"
+		}
+	}
+	if internal != oldInternal {
+		if internal {
+			details += ", now internal"
+		} else {
+			details += ", now client-facing"
+		}
+	}
+	if muted != oldMuted {
+		if muted {
+			details += ", notifications muted"
+		} else {
+			details += ", notifications unmuted"
+		}
+	}
+	if overlapPolicy != oldOverlapPolicy {
+		switch overlapPolicy {
+		case overlapWarn:
+			details += ", warns on overlaps"
+		case overlapReject:
+			details += ", rejects overlaps"
+		default:
+			details += ", allows overlaps"
+		}
+	}
+	if rate != oldRate || currency != oldCurrency {
+		if rate > 0 {
+			details += ", hourly rate " + formatMoney(rate, currency)
+		} else {
+			details += ", hourly rate removed"
+		}
+	}
+	if color != oldColor {
+		details += ", color " + color
+	}
+	if icon != oldIcon {
+		if icon != "" {
+			details += ", icon " + icon
+		} else {
+			details += ", icon removed"
+		}
+	}
+	if description != oldDescription {
+		details += ", description changed"
+	}
+	if externalRef != oldExternalRef {
+		if externalRef != "" {
+			details += ", external reference " + externalRef
+		} else {
+			details += ", external reference removed"
+		}
+	}
+	if !sameGroupMetadata(metadata, oldMetadata[group.ID]) {
+		if len(metadata) > 0 {
+			details += ", metadata " + joinGroupMetadata(metadata, ", ")
+		} else {
+			details += ", metadata removed"
+		}
+	}
+	switch {
+	case parentID == nil && oldParentID != nil:
+		details += ", moved to the top level"
+	case parentID != nil && (oldParentID == nil || *oldParentID != *parentID):
+		details += fmt.Sprintf(", moved under '%s'", groupPaths(groups)[*parentID])
+	}
+	recordAudit("group.update", clientInfoFromRequest(c), id, nil, details)
 
 	return c.Redirect("/groups/manage", fiber.StatusSeeOther)
 }
@@ -414,9 +1013,15 @@ func deleteWorkingGroupHandler(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid working group")
 	}
 
+	userID := currentUserID(c)
+	group, err := findUserGroup(userID, id)
+	if err != nil {
+		return c.Status(404).SendString("Working group not found")
+	}
+
 	var totalGroups int64
-	if err := db.Model(&WorkingGroup{}).Count(&totalGroups).Error; err != nil {
-		log.Println("Error counting working groups:", err)
+	if err := db.Model(&WorkingGroup{}).Scopes(userGroups(userID)).Count(&totalGroups).Error; err != nil {
+		requestLog(c).Println("Error counting working groups:", err)
 		return c.Status(500).SendString("Error deleting working group")
 	}
 
@@ -426,7 +1031,7 @@ func deleteWorkingGroupHandler(c *fiber.Ctx) error {
 
 	var roundCount int64
 	if err := db.Model(&Round{}).Where("working_group_id = ?", id).Count(&roundCount).Error; err != nil {
-		log.Println("Error counting rounds for group:", err)
+		requestLog(c).Println("Error counting rounds for group:", err)
 		return c.Status(500).SendString("Error deleting working group")
 	}
 
@@ -434,11 +1039,43 @@ func deleteWorkingGroupHandler(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Cannot delete working group with recorded rounds. Reset the group first.")
 	}
 
-	if err := db.Delete(&WorkingGroup{}, id).Error; err != nil {
-		log.Println("Error deleting working group:", err)
+	var subgroupCount int64
+	if err := db.Model(&WorkingGroup{}).Scopes(userGroups(userID)).Where("parent_id = ?", id).Count(&subgroupCount).Error; err != nil {
+		requestLog(c).Println("Error counting subgroups:", err)
 		return c.Status(500).SendString("Error deleting working group")
 	}
 
+	if subgroupCount > 0 {
+		return c.Status(400).SendString("Cannot delete working group with subgroups. Move or delete them first.")
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&group).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("working_group_id = ?", group.ID).Delete(&PlannedHours{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("working_group_id = ?", group.ID).Delete(&CapacityException{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("working_group_id = ?", group.ID).Delete(&Break{}).Error; err != nil {
+			return err
+		}
+		if err := deleteEntityMappings(tx, userID, mappingGroup, group.ID); err != nil {
+			return err
+		}
+		if err := deleteGroupMetadata(tx, group.ID); err != nil {
+			return err
+		}
+		return recordTombstone(tx, currentUserID(c), "group", group.ID, group.SyncID)
+	})
+	if err != nil {
+		requestLog(c).Println("Error deleting working group:", err)
+		return c.Status(500).SendString("Error deleting working group")
+	}
+	recordAudit("group.delete", clientInfoFromRequest(c), id, nil, "Deleted group")
+
 	return c.Redirect("/groups/manage", fiber.StatusSeeOther)
 }
 
@@ -447,7 +1084,7 @@ func exportToCSV(c *fiber.Ctx) error {
 	var groupFilter uint
 	var groupName string
 
-	query := db.Preload("WorkingGroup").Order("start_time ASC")
+	userID := currentUserID(c)
 	if groupIDParam != "" {
 		parsedID, err := parseGroupID(groupIDParam)
 		if err != nil {
@@ -455,98 +1092,229 @@ func exportToCSV(c *fiber.Ctx) error {
 		}
 		groupFilter = parsedID
 
-		var group WorkingGroup
-		if err := db.First(&group, groupFilter).Error; err != nil {
+		group, err := findUserGroup(userID, groupFilter)
+		if err != nil {
 			return c.Status(404).SendString("Working group not found")
 		}
-		groupName = group.Name
+		groupName = fileNameSafe(group.Name)
 		if groupName == "" {
 			groupName = fmt.Sprintf("Group-%d", groupFilter)
 		}
+	}
+	if groupName == "" {
+		groupName = "all-groups"
+	}
 
-		query = query.Where("working_group_id = ?", groupFilter)
+	options, err := csvOptionsFromQuery(c)
+	if err != nil {
+		return c.Status(400).SendString(err.Error())
 	}
+	tag, err := parseTagFilter(userID, c.Query("tag"))
+	if errors.Is(err, errUnknownTag) {
+		return c.Status(400).SendString(err.Error())
+	}
+	if err != nil {
+		requestLog(c).Println("Error checking tag filter:", err)
+		return c.Status(500).SendString("Error exporting rounds")
+	}
+	if tag != "" {
+		groupName += "-" + fileNameSafe(tag)
+	}
+
+	filename := fmt.Sprintf("workinghours-%s-%s.csv", groupName, time.Now().Format("2006-01-02-150405"))
+	c.Set("Content-Type", "text/csv")
+	setDownloadName(c, "attachment", filename)
+
+	// Rows go out as they are read, in chunks, so exporting years of rounds doesn't hold the whole file in memory.
+	// The handler has returned by the time the stream runs, so it only keeps what it needs of the request.
+	logger := requestLog(c)
+	c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+		// The response has started already; a failure can only cut the file short
+		if err := writeRoundsCSV(w, userID, groupFilter, tag, options, nil); err != nil {
+			logger.Println("Error streaming CSV export:", err)
+		}
+	}))
+	return nil
+}
 
-	var rounds []Round
-	if err := query.Find(&rounds).Error; err != nil {
-		log.Println("Error fetching rounds for CSV export:", err)
-		return c.Status(500).SendString("Error exporting data")
+// csvExportBatch is how many rounds writeRoundsCSV collects before looking up their attachments and writing them out
+const csvExportBatch = 500
+
+// writeRoundsCSV writes the user's rounds, of one group or of all when groupID is 0 and only those with the tag when
+// one is given, as CSV with the given options. progress, when given, is told after every round how many of them are
+// written. The rounds are read through a database cursor and written in batches, so memory use doesn't grow with
+// their number.
+func writeRoundsCSV(w io.Writer, userID, groupID uint, tag string, options csvOptions, progress func(done, total int)) error {
+	exported := func() *gorm.DB {
+		query := db.Model(&Round{}).Scopes(userRounds(userID))
+		if groupID != 0 {
+			query = query.Where("working_group_id = ?", groupID)
+		}
+		if tag != "" {
+			query = query.Scopes(roundsTagged(userID, tag))
+		}
+		return query
+	}
+	var total int64
+	if err := exported().Count(&total).Error; err != nil {
+		return fmt.Errorf("counting rounds: %w", err)
 	}
 
-	if groupName == "" {
-		groupName = "all-groups"
+	groupsByID := make(map[uint]WorkingGroup)
+	var groups []WorkingGroup
+	if err := db.Where("user_id = ?", userID).Find(&groups).Error; err != nil {
+		return fmt.Errorf("fetching working groups: %w", err)
+	}
+	for _, group := range groups {
+		groupsByID[group.ID] = group
+	}
+	metadata, err := loadGroupMetadata(db, groups)
+	if err != nil {
+		return fmt.Errorf("fetching group metadata: %w", err)
+	}
+
+	rows, err := exported().Order("start_time ASC, id ASC").Rows()
+	if err != nil {
+		return fmt.Errorf("fetching rounds: %w", err)
 	}
+	defer rows.Close()
 
-	buf := new(bytes.Buffer)
-	writer := csv.NewWriter(buf)
+	writer := options.newWriter(w)
 
-	header := []string{"Round ID", "Working Group", "Start Time", "End Time", "Duration (minutes)", "Status"}
+	// The billable and non-billable columns split the duration, so a spreadsheet can sum either
+	// The times are in the chosen clock's time zone, named in the Time Zone column so a spreadsheet can tell
+	// Earned is the billable time at the group's hourly rate, empty for groups without one
+	// The group's reference, description and metadata (name=value pairs separated by "; ") are for billing systems
+	// Breaks are the pauses taken within the round, already left out of its duration
+	header := []string{"Round ID", "Working Group", "Group Reference", "Group Description", "Group Metadata", "Start Time", "End Time", "Time Zone", "Duration (minutes)",
+		"Billable (minutes)", "Non-billable (minutes)", "Breaks (minutes)", "Earned", "Currency", "Status", "Source", "Tags", "Attachments", "Note"}
 	if err := writer.Write(header); err != nil {
-		log.Println("Error writing CSV header:", err)
-		return c.Status(500).SendString("Error generating CSV")
+		return fmt.Errorf("writing CSV header: %w", err)
 	}
 
 	now := time.Now()
+	done := 0
+	batch := make([]Round, 0, csvExportBatch)
+
+	writeBatch := func() error {
+		// Attachment file names per round, referenced in the export
+		roundIDs := make([]uint, len(batch))
+		for i, round := range batch {
+			roundIDs[i] = round.ID
+		}
+		attachmentNames := make(map[uint][]string)
+		var roundAttachments []Attachment
+		if len(roundIDs) > 0 {
+			if err := db.Where("round_id IN ?", roundIDs).Order("id ASC").Find(&roundAttachments).Error; err != nil {
+				log.Println("Error fetching attachments for CSV export:", err)
+			}
+		}
+		for _, attachment := range roundAttachments {
+			attachmentNames[*attachment.RoundID] = append(attachmentNames[*attachment.RoundID], attachment.FileName)
+		}
+		tagNames, err := loadRoundTags(roundIDs)
+		if err != nil {
+			log.Println("Error fetching tags for CSV export:", err)
+		}
 
-	for _, round := range rounds {
-		endTimeStr := ""
-		durationMinutes := 0.0
-		status := "In Progress"
+		for _, round := range batch {
+			endTimeStr := ""
+			durationMinutes := 0.0
+			status := "In Progress"
+
+			if round.EndTime != nil {
+				endTimeStr = roundClock(*round.EndTime, round, options.Clock).Format("2006-01-02 15:04:05")
+				durationMinutes = round.EndTime.Sub(round.StartTime).Minutes()
+				status = "Completed"
+			} else if round.PausedAt != nil {
+				durationMinutes = round.PausedAt.Sub(round.StartTime).Minutes()
+				status = "Paused"
+			} else {
+				durationMinutes = now.Sub(round.StartTime).Minutes()
+			}
+			durationMinutes = max(durationMinutes-float64(round.PausedSeconds)/60, 0)
 
-		if round.EndTime != nil {
-			endTimeStr = round.EndTime.Format("2006-01-02 15:04:05")
-			durationMinutes = round.EndTime.Sub(round.StartTime).Minutes()
-			status = "Completed"
-		} else {
-			durationMinutes = now.Sub(round.StartTime).Minutes()
-		}
+			group := groupsByID[round.WorkingGroupID]
+			groupName := group.Name
+			if groupName == "" {
+				groupName = fmt.Sprintf("Group #%d", round.WorkingGroupID)
+			}
+			billableMinutes, nonBillableMinutes := durationMinutes, 0.0
+			if !roundBillable(round) {
+				billableMinutes, nonBillableMinutes = 0, durationMinutes
+			}
+			earned, currency := "", ""
+			if cents, ok := groupEarned(group, int64(billableMinutes*60)); ok {
+				earned, currency = options.number(float64(cents)/100), group.Currency
+			}
 
-		groupName := round.WorkingGroup.Name
-		if groupName == "" {
-			groupName = fmt.Sprintf("Group #%d", round.WorkingGroupID)
-		}
+			row := []string{
+				fmt.Sprintf("%d", round.ID),
+				options.text(groupName),
+				options.text(group.ExternalRef),
+				options.text(group.Description),
+				options.text(joinGroupMetadata(metadata[group.ID], "; ")),
+				roundClock(round.StartTime, round, options.Clock).Format("2006-01-02 15:04:05"),
+				endTimeStr,
+				csvTimeZone(round, options.Clock),
+				options.number(durationMinutes),
+				options.number(billableMinutes),
+				options.number(nonBillableMinutes),
+				options.number(float64(roundBreakSeconds(round, now)) / 60),
+				earned,
+				currency,
+				status,
+				round.Source,
+				options.text(strings.Join(tagNames[round.ID], ", ")),
+				options.text(strings.Join(attachmentNames[round.ID], "; ")),
+				options.text(round.Note),
+			}
 
-		row := []string{
-			fmt.Sprintf("%d", round.ID),
-			groupName,
-			round.StartTime.Format("2006-01-02 15:04:05"),
-			endTimeStr,
-			fmt.Sprintf("%.2f", durationMinutes),
-			status,
+			if err := writer.Write(row); err != nil {
+				return fmt.Errorf("writing CSV row: %w", err)
+			}
+			done++
+			if progress != nil {
+				progress(done, int(total))
+			}
 		}
+		batch = batch[:0]
+		writer.Flush()
+		return writer.Error()
+	}
 
-		if err := writer.Write(row); err != nil {
-			log.Println("Error writing CSV row:", err)
-			return c.Status(500).SendString("Error generating CSV")
+	for rows.Next() {
+		var round Round
+		if err := db.ScanRows(rows, &round); err != nil {
+			return fmt.Errorf("reading round: %w", err)
+		}
+		batch = append(batch, round)
+		if len(batch) == csvExportBatch {
+			if err := writeBatch(); err != nil {
+				return err
+			}
 		}
 	}
-
-	writer.Flush()
-	if err := writer.Error(); err != nil {
-		log.Println("Error flushing CSV writer:", err)
-		return c.Status(500).SendString("Error generating CSV")
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("fetching rounds: %w", err)
 	}
-
-	filename := fmt.Sprintf("workinghours-%s-%s.csv", groupName, time.Now().Format("2006-01-02-150405"))
-	c.Set("Content-Type", "text/csv")
-	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
-
-	return c.Send(buf.Bytes())
+	return writeBatch()
 }
 
 func renderStats(c *fiber.Ctx) error {
-	groups, err := getWorkingGroupsOrdered()
+	userID := currentUserID(c)
+	groups, err := getWorkingGroupsOrdered(userID)
 	if err != nil {
-		log.Println("Error fetching working groups:", err)
+		requestLog(c).Println("Error fetching working groups:", err)
 		return c.Status(500).SendString("Error rendering statistics")
 	}
 
 	if len(groups) == 0 {
-		defaultGroup := ensureDefaultWorkingGroup()
+		defaultGroup := ensureDefaultWorkingGroup(userID)
 		groups = []WorkingGroup{defaultGroup}
 	}
 
-	selectedGroupID := groups[0].ID
+	selectedGroupID := defaultGroup(groups).ID
 	if groupParam := c.Query("group_id"); groupParam != "" {
 		if parsed, err := parseGroupID(groupParam); err == nil {
 			if _, exists := findGroupByID(groups, parsed); exists {
@@ -555,76 +1323,183 @@ func renderStats(c *fiber.Ctx) error {
 		}
 	}
 
-	dailySummaries := getDailySummaries(selectedGroupID)
-	groupTotals := getGroupTotalsSummary()
-	todaySeconds, totalSeconds := calculateGroupTotals(selectedGroupID)
-	allGroupsTotal := calculateAllGroupsTotalSeconds()
+	clock, err := parseClock(c.Query("clock"))
+	if err != nil {
+		return c.Status(400).SendString(err.Error())
+	}
+
+	tag, err := parseTagFilter(userID, c.Query("tag"))
+	if errors.Is(err, errUnknownTag) {
+		return c.Status(400).SendString(err.Error())
+	}
+	if err != nil {
+		requestLog(c).Println("Error checking tag filter:", err)
+		return c.Status(500).SendString("Error rendering statistics")
+	}
+	tagNames, err := userTagNames(userID)
+	if err != nil {
+		requestLog(c).Println("Error fetching tags:", err)
+		return c.Status(500).SendString("Error rendering statistics")
+	}
+	var tagOptions []fiber.Map
+	for _, name := range tagNames {
+		tagOptions = append(tagOptions, fiber.Map{"Name": name, "Selected": name == tag})
+	}
+
+	ctx := traceContext(c)
+	dailySummaries := getDailySummaries(ctx, userID, selectedGroupID, clock, tag)
+	groupTotals := getGroupTotalsSummary(ctx, userID)
+	selectedTotals := calculateGroupTotals(ctx, selectedGroupID)
+	allGroupsTotal := calculateAllGroupsTotalSeconds(ctx, userID)
+	tagTotals, err := getTagTotals(ctx, selectedGroupID)
+	if err != nil {
+		requestLog(c).Println("Error totaling tags:", err)
+	}
 
 	selectedGroupName := fmt.Sprintf("Group #%d", selectedGroupID)
+	var selectedGroup WorkingGroup
 	var groupOptions []StatusGroupOption
+	paths := groupPaths(groups)
 	for _, group := range groups {
 		if group.ID == selectedGroupID {
 			selectedGroupName = group.Name
+			selectedGroup = group
 		}
 		groupOptions = append(groupOptions, StatusGroupOption{
 			ID:       group.ID,
-			Name:     group.Name,
+			Name:     paths[group.ID],
+			Icon:     group.Icon,
 			Selected: group.ID == selectedGroupID,
 		})
 	}
+	var selectedWithSubgroups GroupTotal
+	anySubgroups := false
+	for _, total := range groupTotals {
+		if total.GroupID == selectedGroupID {
+			selectedWithSubgroups = total
+		}
+		anySubgroups = anySubgroups || total.HasSubgroups
+	}
+	// Amounts in different currencies can't be summed, so the total of all groups is one per currency
+	earnedByCurrency := moneyTotals{}
+	for _, total := range groupTotals {
+		if total.Currency != "" {
+			earnedByCurrency[total.Currency] += total.EarnedCents
+		}
+	}
+	// Breaks of the days listed below; today's only while the home day is the first row
+	var breakSeconds, breakTodaySeconds int64
+	today := time.Now().Format("2006-01-02")
+	for _, summary := range dailySummaries {
+		breakSeconds += summary.BreakSeconds
+		if summary.Date == today {
+			breakTodaySeconds = summary.BreakSeconds
+		}
+	}
+	selectedEarnedToday, _ := groupEarned(selectedGroup, selectedTotals.BillableTodaySeconds)
+	selectedEarnedTotal, selectedHasRate := groupEarned(selectedGroup, selectedTotals.BillableSeconds)
+	selectedCurrency := ""
+	if selectedHasRate {
+		selectedCurrency = selectedGroup.Currency
+	}
 
 	return c.Render("stats", fiber.Map{
-		"GroupOptions":                groupOptions,
-		"SelectedGroupID":             selectedGroupID,
-		"SelectedGroupName":           selectedGroupName,
-		"DailySummaries":              dailySummaries,
-		"GroupTotals":                 groupTotals,
-		"SelectedGroupTotalFormatted": formatDuration(totalSeconds),
-		"SelectedGroupTodayFormatted": formatDuration(todaySeconds),
-		"AllGroupsTotalFormatted":     formatDuration(allGroupsTotal),
+		"GroupOptions":              groupOptions,
+		"SelectedGroupID":           selectedGroupID,
+		"SelectedGroupName":         selectedGroupName,
+		"DailySummaries":            dailySummaries,
+		"GroupTotals":               groupTotals,
+		"SelectedGroupTotalSeconds": selectedTotals.TotalSeconds,
+		"SelectedGroupTodaySeconds": selectedTotals.TodaySeconds,
+		"SelectedGroupTotalSplit":   splitBillable(selectedTotals.TotalSeconds, selectedTotals.BillableSeconds),
+		"SelectedGroupTodaySplit":   splitBillable(selectedTotals.TodaySeconds, selectedTotals.BillableTodaySeconds),
+		"AllGroupsTotalSeconds":     allGroupsTotal,
+		"SelectedGroupBreakSeconds": breakSeconds,
+		"SelectedGroupBreakToday":   breakTodaySeconds,
+		"SelectedGroupCurrency":     selectedCurrency,
+		"SelectedGroupEarnedToday":  selectedEarnedToday,
+		"SelectedGroupEarnedTotal":  selectedEarnedTotal,
+		"AllGroupsEarned":           earnedByCurrency.String(),
+		"SelectedGroupRunning":      groupHasRunningRound(ctx, selectedGroupID),
+		"SelectedGroupPath":         paths[selectedGroupID],
+		"SelectedWithSubgroups":     selectedWithSubgroups,
+		"AnySubgroups":              anySubgroups,
+		"Clock":                     clock,
+		"LocalClock":                clock == clockLocal,
+		"HomeTimeZone":              homeTimeZoneName(),
+		"Tag":                       tag,
+		"TagQuery":                  url.QueryEscape(tag),
+		"TagOptions":                tagOptions,
+		"TagTotals":                 tagTotals,
 	})
 }
 
-func getDailySummaries(groupID uint) []DailySummary {
-	var rounds []Round
-	if err := db.Where("working_group_id = ? AND end_time IS NOT NULL", groupID).
-		Order("start_time DESC").Find(&rounds).Error; err != nil {
+// getDailySummaries totals a group's rounds by the day they started on. With the home clock that is the day in the
+// home time zone; with the local clock it is the day where the round was recorded, so a trip abroad doesn't move late
+// evenings onto the next day. A tag, when given, counts only the rounds of the user's that carry it. Breaks count on
+// the day of their round, breaks outside rounds on their home day and only without a tag, as they carry none.
+func getDailySummaries(ctx context.Context, userID, groupID uint, clock, tag string) []DailySummary {
+	ctx, span := tracer.Start(ctx, "getDailySummaries")
+	defer span.End()
+
+	days, err := sumDailyRounds(ctx, userID, groupID, clock, tag)
+	if err != nil {
+		log.Println("Error summing daily rounds:", err)
 		return []DailySummary{}
 	}
 
 	var group WorkingGroup
-	db.First(&group, groupID)
+	db.WithContext(ctx).First(&group, groupID)
 	groupName := group.Name
 	if groupName == "" {
 		groupName = fmt.Sprintf("Group #%d", groupID)
 	}
 
 	dailyMap := make(map[string]*DailySummary)
+	for _, day := range days {
+		date := time.Unix(day.DayNumber*86400, 0).UTC()
+		summary := &DailySummary{
+			GroupID:         groupID,
+			GroupName:       groupName,
+			Date:            date.Format("2006-01-02"),
+			DateDisplay:     date.Format("Monday, January 2, 2006"),
+			TotalSeconds:    day.TotalSeconds,
+			BillableSeconds: day.BillableSeconds,
+			RoundCount:      day.RoundCount,
+			FlaggedCount:    day.FlaggedCount,
+			// A running round counts up to now, which makes its day's total provisional
+			RunningCount: day.RunningCount,
+			Provisional:  day.RunningCount > 0,
+			BreakSeconds: day.BreakSeconds,
+		}
+		dailyMap[summary.Date] = summary
+	}
 
-	for _, round := range rounds {
-		dateKey := round.StartTime.Format("2006-01-02")
-		duration := round.EndTime.Sub(round.StartTime)
-		seconds := int64(duration.Seconds())
-
-		if summary, exists := dailyMap[dateKey]; exists {
-			summary.TotalSeconds += seconds
-			summary.RoundCount++
-		} else {
-			dailyMap[dateKey] = &DailySummary{
-				GroupID:        groupID,
-				GroupName:      groupName,
-				Date:           dateKey,
-				DateDisplay:    round.StartTime.Format("Monday, January 2, 2006"),
-				TotalSeconds:   seconds,
-				TotalFormatted: "",
-				RoundCount:     1,
+	if tag == "" {
+		breaks, err := dailyBreakSeconds(ctx, groupID)
+		if err != nil {
+			log.Println("Error summing breaks:", err)
+		}
+		for dateKey, seconds := range breaks {
+			summary, exists := dailyMap[dateKey]
+			if !exists {
+				day, _ := time.ParseInLocation("2006-01-02", dateKey, time.Local)
+				summary = &DailySummary{
+					GroupID:     groupID,
+					GroupName:   groupName,
+					Date:        dateKey,
+					DateDisplay: day.Format("Monday, January 2, 2006"),
+				}
+				dailyMap[dateKey] = summary
 			}
+			summary.BreakSeconds += seconds
 		}
 	}
 
 	var summaries []DailySummary
 	for _, summary := range dailyMap {
-		summary.TotalFormatted = formatDuration(summary.TotalSeconds)
+		summary.Split = splitBillable(summary.TotalSeconds, summary.BillableSeconds)
+		summary.EarnedCents, _ = groupEarned(group, summary.BillableSeconds)
 		summaries = append(summaries, *summary)
 	}
 
@@ -636,11 +1511,91 @@ func getDailySummaries(groupID uint) []DailySummary {
 	return summaries
 }
 
-func ensureDefaultWorkingGroup() WorkingGroup {
+// dailyRoundTotals are a group's rounds of one day, summed by the database
+type dailyRoundTotals struct {
+	DayNumber       int64 // Days since 1970-01-01 on the report's clock
+	RoundCount      int   // Finished rounds, without the flagged ones
+	FlaggedCount    int
+	RunningCount    int
+	TotalSeconds    int64
+	BillableSeconds int64
+	BreakSeconds    int64
+}
+
+// sumDailyRounds totals a group's rounds per day in the database, so years of rounds come back as a row per day. A
+// round's day is its start in seconds since 1970, moved by the UTC offset its clock had then and divided into days;
+// the offsets are worked out in Go for the time between the group's first and last start.
+func sumDailyRounds(ctx context.Context, userID, groupID uint, clock, tag string) ([]dailyRoundTotals, error) {
+	scope := func(tx *gorm.DB) *gorm.DB {
+		tx = tx.Where("rounds.working_group_id = ?", groupID)
+		if tag != "" {
+			tx = tx.Scopes(roundsTagged(userID, tag))
+		}
+		return tx
+	}
+
+	// Both ends come straight from idx_rounds_group_start
+	var first, last Round
+	err := db.WithContext(ctx).Select("start_time").Scopes(scope).Order("start_time ASC").Take(&first).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := db.WithContext(ctx).Select("start_time").Scopes(scope).Order("start_time DESC").Take(&last).Error; err != nil {
+		return nil, err
+	}
+
+	offset := zoneOffsetSQL("start_unix", time.Local, first.StartTime, last.StartTime)
+	var offsetArgs []interface{}
+	if clock == clockLocal {
+		// Rounds without a zone of their own, or with one this server doesn't know, stay on the home clock like
+		// roundClock keeps them
+		var zones []string
+		if err := db.WithContext(ctx).Model(&Round{}).Scopes(scope).Where("rounds.time_zone <> ''").
+			Distinct("rounds.time_zone").Pluck("rounds.time_zone", &zones).Error; err != nil {
+			return nil, err
+		}
+		if len(zones) > 0 {
+			local := "CASE time_zone"
+			for _, zone := range zones {
+				local += " WHEN ? THEN (" + zoneOffsetSQL("start_unix", loadZone(zone), first.StartTime, last.StartTime) + ")"
+				offsetArgs = append(offsetArgs, zone)
+			}
+			offset = local + " ELSE (" + offset + ") END"
+		}
+	}
+
+	now := time.Now()
+	seconds := roundSecondsSQL()
+	rounds := db.WithContext(ctx).Model(&Round{}).Scopes(scope).
+		Select(secondsBetweenSQL("?", "rounds.start_time")+" AS start_unix, rounds.time_zone, "+
+			"CASE WHEN rounds.end_time IS NULL THEN 1 ELSE 0 END AS running, "+
+			"CASE WHEN rounds.end_time IS NOT NULL AND rounds.flagged = ? THEN 1 ELSE 0 END AS flagged, "+
+			seconds+" AS seconds, "+
+			"CASE WHEN rounds.billable IS NULL OR rounds.billable = ? THEN 1 ELSE 0 END AS billable, "+
+			"rounds.paused_seconds + CASE WHEN rounds.end_time IS NULL AND rounds.paused_at IS NOT NULL THEN "+
+			secondsBetweenSQL("rounds.paused_at", "?")+" ELSE 0 END AS break_seconds",
+			time.Unix(0, 0).UTC(), true, now, true, now)
+
+	var days []dailyRoundTotals
+	err = db.WithContext(ctx).Table("(?) AS day_rounds", rounds).
+		Select(integerDivSQL("start_unix + "+offset, "86400")+" AS day_number, "+
+			"COUNT(*) - SUM(running) - SUM(flagged) AS round_count, SUM(flagged) AS flagged_count, "+
+			"SUM(running) AS running_count, SUM(seconds) AS total_seconds, SUM(billable * seconds) AS billable_seconds, "+
+			"SUM(break_seconds) AS break_seconds", offsetArgs...).
+		Group("day_number").
+		Scan(&days).Error
+	return days, err
+}
+
+// ensureDefaultWorkingGroup makes sure the user owns at least one working group
+func ensureDefaultWorkingGroup(userID uint) WorkingGroup {
 	var group WorkingGroup
-	result := db.Order("id ASC").First(&group)
+	result := db.Scopes(userGroups(userID)).Order("id ASC").First(&group)
 	if result.Error != nil {
-		group = WorkingGroup{Name: "General"}
+		group = WorkingGroup{Name: cfg.DefaultGroup, UserID: userID}
 		if err := db.Create(&group).Error; err != nil {
 			log.Fatal("Failed to create default working group:", err)
 		}
@@ -656,12 +1611,23 @@ func ensureDefaultWorkingGroup() WorkingGroup {
 	return group
 }
 
-func getWorkingGroupsOrdered() ([]WorkingGroup, error) {
+// defaultGroup picks the group named like the configured default group, or the first one
+func defaultGroup(groups []WorkingGroup) WorkingGroup {
+	for _, group := range groups {
+		if strings.EqualFold(group.Name, cfg.DefaultGroup) {
+			return group
+		}
+	}
+	return groups[0]
+}
+
+// getWorkingGroupsOrdered lists the user's groups by name, with subgroups right after their parent
+func getWorkingGroupsOrdered(userID uint) ([]WorkingGroup, error) {
 	var groups []WorkingGroup
-	if err := db.Order("name ASC").Find(&groups).Error; err != nil {
+	if err := db.Scopes(userGroups(userID)).Order("name ASC").Find(&groups).Error; err != nil {
 		return nil, err
 	}
-	return groups, nil
+	return sortGroupTree(groups), nil
 }
 
 func findGroupByID(groups []WorkingGroup, id uint) (*WorkingGroup, bool) {
@@ -691,160 +1657,292 @@ func formatDuration(seconds int64) string {
 	return fmt.Sprintf("%02d:%02d:%02d", hours, minutes, secs)
 }
 
-func calculateGroupTotals(groupID uint) (int64, int64) {
-	var rounds []Round
-	if err := db.Where("working_group_id = ?", groupID).Find(&rounds).Error; err != nil {
-		return 0, 0
-	}
+// groupRoundTotals are the summed round durations of one working group
+type groupRoundTotals struct {
+	GroupID              uint
+	TodaySeconds         int64 // Rounds started today
+	WeekSeconds          int64 // Rounds started this week, from Monday
+	TotalSeconds         int64
+	BillableTodaySeconds int64 // The billable part of TodaySeconds
+	BillableSeconds      int64 // The billable part of TotalSeconds
+	Running              int64 // Rounds in progress, counted up to now in the sums
+}
 
+// sumRoundTotals adds up the durations of the rounds matched by scope per working group in the database, so pages
+// don't have to load every round
+func sumRoundTotals(ctx context.Context, scope func(*gorm.DB) *gorm.DB) (map[uint]groupRoundTotals, error) {
 	now := time.Now()
 	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
 	todayEnd := todayStart.Add(24 * time.Hour)
+	thisWeek := weekStart(now)
+	seconds := roundSecondsSQL()
+
+	var rows []groupRoundTotals
+	err := db.WithContext(ctx).Model(&Round{}).Scopes(scope).
+		Select("working_group_id AS group_id, "+
+			"COALESCE(SUM(CASE WHEN start_time >= ? AND start_time < ? THEN "+seconds+" ELSE 0 END), 0) AS today_seconds, "+
+			"COALESCE(SUM(CASE WHEN start_time >= ? AND start_time < ? THEN "+seconds+" ELSE 0 END), 0) AS week_seconds, "+
+			"COALESCE(SUM("+seconds+"), 0) AS total_seconds, "+
+			"COALESCE(SUM(CASE WHEN billable = ? AND start_time >= ? AND start_time < ? THEN "+seconds+" ELSE 0 END), 0) AS billable_today_seconds, "+
+			"COALESCE(SUM(CASE WHEN billable = ? THEN "+seconds+" ELSE 0 END), 0) AS billable_seconds, "+
+			"SUM(CASE WHEN end_time IS NULL THEN 1 ELSE 0 END) AS running",
+			todayStart, todayEnd, now, thisWeek, thisWeek.AddDate(0, 0, 7), now, now,
+			true, todayStart, todayEnd, now, true, now).
+		Group("working_group_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	totals := make(map[uint]groupRoundTotals, len(rows))
+	for _, row := range rows {
+		totals[row.GroupID] = row
+	}
+	return totals, nil
+}
 
-	var totalSeconds int64
-	var todaySeconds int64
-
-	for _, round := range rounds {
-		endTime := round.EndTime
-		if endTime == nil {
-			// Still running - include time up to now
-			duration := now.Sub(round.StartTime)
-			seconds := int64(duration.Seconds())
-			totalSeconds += seconds
-			if !round.StartTime.Before(todayStart) && round.StartTime.Before(todayEnd) {
-				todaySeconds += seconds
-			}
-			continue
-		}
-		duration := endTime.Sub(round.StartTime)
-		seconds := int64(duration.Seconds())
-		totalSeconds += seconds
-		if !round.StartTime.Before(todayStart) && round.StartTime.Before(todayEnd) {
-			todaySeconds += seconds
-		}
+// calculateGroupTotals sums the rounds of one working group
+func calculateGroupTotals(ctx context.Context, groupID uint) groupRoundTotals {
+	ctx, span := tracer.Start(ctx, "calculateGroupTotals")
+	defer span.End()
+
+	totals, err := sumRoundTotals(ctx, func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("working_group_id = ?", groupID)
+	})
+	if err != nil {
+		log.Println("Error summing round totals:", err)
 	}
+	return totals[groupID]
+}
 
-	return todaySeconds, totalSeconds
+// groupHasRunningRound reports whether the group has a round in progress
+func groupHasRunningRound(ctx context.Context, groupID uint) bool {
+	var count int64
+	db.WithContext(ctx).Model(&Round{}).Where("working_group_id = ? AND end_time IS NULL", groupID).Count(&count)
+	return count > 0
 }
 
-func calculateAllGroupsTotalSeconds() int64 {
-	var rounds []Round
-	if err := db.Find(&rounds).Error; err != nil {
+func calculateAllGroupsTotalSeconds(ctx context.Context, userID uint) int64 {
+	ctx, span := tracer.Start(ctx, "calculateAllGroupsTotalSeconds")
+	defer span.End()
+
+	totals, err := sumRoundTotals(ctx, userRounds(userID))
+	if err != nil {
+		log.Println("Error summing round totals:", err)
 		return 0
 	}
-	now := time.Now()
 	var totalSeconds int64
-	for _, round := range rounds {
-		endTime := round.EndTime
-		if endTime == nil {
-			totalSeconds += int64(now.Sub(round.StartTime).Seconds())
-			continue
-		}
-		totalSeconds += int64(endTime.Sub(round.StartTime).Seconds())
+	for _, group := range totals {
+		totalSeconds += group.TotalSeconds
 	}
 	return totalSeconds
 }
 
-func getGroupTotalsSummary() []GroupTotal {
-	groups, err := getWorkingGroupsOrdered()
+func getGroupTotalsSummary(ctx context.Context, userID uint) []GroupTotal {
+	ctx, span := tracer.Start(ctx, "getGroupTotalsSummary")
+	defer span.End()
+
+	groups, err := getWorkingGroupsOrdered(userID)
+	if err != nil {
+		return []GroupTotal{}
+	}
+	totals, err := sumRoundTotals(ctx, userRounds(userID))
 	if err != nil {
+		log.Println("Error summing round totals:", err)
 		return []GroupTotal{}
 	}
 
+	paths := groupPaths(groups)
+	rolled := rollUpTotals(groups, totals)
+	earned := make(map[uint]int64, len(groups))
 	var summaries []GroupTotal
 	for _, group := range groups {
-		_, total := calculateGroupTotals(group.ID)
+		total := totals[group.ID].TotalSeconds
+		groupEarnedCents, hasRate := groupEarned(group, totals[group.ID].BillableSeconds)
+		currency := ""
+		if hasRate {
+			currency = group.Currency
+			earned[group.ID] = groupEarnedCents
+		}
 		summaries = append(summaries, GroupTotal{
-			GroupID:        group.ID,
-			GroupName:      group.Name,
-			TotalSeconds:   total,
-			TotalFormatted: formatDuration(total),
+			GroupID:                   group.ID,
+			GroupName:                 group.Name,
+			GroupPath:                 paths[group.ID],
+			Color:                     groupColor(group),
+			Icon:                      group.Icon,
+			TotalSeconds:              total,
+			Running:                   totals[group.ID].Running > 0,
+			BillableSeconds:           totals[group.ID].BillableSeconds,
+			Split:                     splitBillable(total, totals[group.ID].BillableSeconds),
+			EarnedCents:               groupEarnedCents,
+			Currency:                  currency,
+			TotalWithSubgroupsSeconds: rolled[group.ID].TotalSeconds,
+			RunningWithSubgroups:      rolled[group.ID].Running > 0,
 		})
 	}
+	for i := range summaries {
+		subgroups := subgroupIDs(groups, summaries[i].GroupID)
+		if len(subgroups) == 0 {
+			continue
+		}
+		summaries[i].HasSubgroups = true
+		byCurrency := moneyTotals{}
+		for _, id := range append(subgroups, summaries[i].GroupID) {
+			if cents, rated := earned[id]; rated {
+				group, _ := findGroupByID(groups, id)
+				byCurrency[group.Currency] += cents
+			}
+		}
+		summaries[i].EarnedWithSubgroups = byCurrency.String()
+	}
 	return summaries
 }
 
-func buildStatusContext(requestedGroupID uint) (StatusContext, error) {
-	groups, err := getWorkingGroupsOrdered()
+func buildStatusContext(ctx context.Context, userID, requestedGroupID uint) (StatusContext, error) {
+	ctx, span := tracer.Start(ctx, "buildStatusContext")
+	defer span.End()
+
+	groups, err := getWorkingGroupsOrdered(userID)
 	if err != nil {
 		return StatusContext{}, err
 	}
 
 	if len(groups) == 0 {
-		defaultGroup := ensureDefaultWorkingGroup()
+		defaultGroup := ensureDefaultWorkingGroup(userID)
 		groups = []WorkingGroup{defaultGroup}
 	}
 
 	selectedGroupID := requestedGroupID
-	if selectedGroupID == 0 {
-		selectedGroupID = groups[0].ID
-	} else if _, exists := findGroupByID(groups, selectedGroupID); !exists {
-		selectedGroupID = groups[0].ID
+	if _, exists := findGroupByID(groups, selectedGroupID); !exists {
+		selectedGroupID = defaultGroup(groups).ID
 	}
 
-	state := getCurrentState(selectedGroupID)
-	allTotal := calculateAllGroupsTotalSeconds()
+	state := getCurrentState(ctx, selectedGroupID)
+	// One pass over the rounds gives both the all-groups total and every group's week for the heat strip
+	totals, err := sumRoundTotals(ctx, userRounds(userID))
+	if err != nil {
+		log.Println("Error summing round totals:", err)
+	}
+	var allTotal int64
+	for _, group := range totals {
+		allTotal += group.TotalSeconds
+	}
+	week := weekStart(time.Now())
+	planned, err := plannedWeekSeconds(ctx, userID, week)
+	if err != nil {
+		log.Println("Error loading planned hours:", err)
+	}
+	exceptions, err := loadCapacityExceptions(ctx, userID, week, week.AddDate(0, 0, 7))
+	if err != nil {
+		log.Println("Error loading day exceptions:", err)
+	}
 
+	paths := groupPaths(groups)
 	var options []StatusGroupOption
 	for _, group := range groups {
 		options = append(options, StatusGroupOption{
 			ID:       group.ID,
-			Name:     group.Name,
+			Name:     paths[group.ID],
+			Icon:     group.Icon,
 			Selected: group.ID == selectedGroupID,
 		})
 	}
 
+	if subgroups := subgroupIDs(groups, selectedGroupID); len(subgroups) > 0 {
+		rolled := rollUpTotals(groups, totals)[selectedGroupID]
+		state.SubgroupCount = len(subgroups)
+		state.TotalTodayWithSubgroupsSeconds = rolled.TodaySeconds
+		state.TotalWeekWithSubgroupsSeconds = rolled.WeekSeconds
+		state.TotalOverallWithSubgroupsSeconds = rolled.TotalSeconds
+	}
+	state.Summary = statusSummary(state)
 	return StatusContext{
-		GroupOptions:            options,
-		SelectedGroupID:         selectedGroupID,
-		State:                   state,
-		AllGroupsTotalSeconds:   allTotal,
-		AllGroupsTotalFormatted: formatDuration(allTotal),
+		GroupOptions:          options,
+		SelectedGroupID:       selectedGroupID,
+		State:                 state,
+		AllGroupsTotalSeconds: allTotal,
+		GroupWeeks:            groupWeekStatuses(groups, totals, planned, exceptions, week),
+		UndoReset:             pendingResetUndo(userID, selectedGroupID),
 	}, nil
 }
 
-func getCurrentState(groupID uint) AppState {
+func getCurrentState(ctx context.Context, groupID uint) AppState {
+	ctx, span := tracer.Start(ctx, "getCurrentState")
+	defer span.End()
+
 	state := AppState{
 		GroupID:               groupID,
 		GroupName:             fmt.Sprintf("Group #%d", groupID),
-		LastStartStr:          "Never",
-		LastStopStr:           "Never",
 		IsRunning:             false,
 		TotalTodayFormatted:   "00:00:00",
+		TotalWeekFormatted:    "00:00:00",
 		TotalOverallFormatted: "00:00:00",
 	}
 
+	var group WorkingGroup
 	if groupID != 0 {
-		var group WorkingGroup
-		if err := db.First(&group, groupID).Error; err == nil {
+		if err := db.WithContext(ctx).First(&group, groupID).Error; err == nil {
 			state.GroupName = group.Name
+			state.GroupIcon = group.Icon
 		}
 	}
+	state.GroupColor = groupColor(WorkingGroup{ID: groupID, Color: group.Color})
 
+	// Both lookups are answered by idx_rounds_group_end. Take instead of First: First also orders by ID, which makes
+	// the database sort every finished round of the group to find the last one.
 	var activeRound Round
-	if err := db.Where("working_group_id = ? AND end_time IS NULL", groupID).
-		Order("start_time DESC").First(&activeRound).Error; err == nil {
+	if err := db.WithContext(ctx).Where("working_group_id = ? AND end_time IS NULL", groupID).
+		Order("start_time DESC").Take(&activeRound).Error; err == nil {
 		state.IsRunning = true
 		state.CurrentRoundID = &activeRound.ID
+		state.LastRoundID = activeRound.ID
+		state.LastStartedBy = activeRound.StartedBy
 		state.LastStartTime = &activeRound.StartTime
-		state.LastStartStr = activeRound.StartTime.Format("2006-01-02 15:04:05")
-		state.LastStopStr = "In progress..."
+		state.IsPaused = activeRound.PausedAt != nil
+		state.PausedSince = activeRound.PausedAt
 	} else {
 		var lastRound Round
-		if err := db.Where("working_group_id = ? AND end_time IS NOT NULL", groupID).
-			Order("end_time DESC").First(&lastRound).Error; err == nil {
+		if err := db.WithContext(ctx).Where("working_group_id = ? AND end_time IS NOT NULL", groupID).
+			Order("end_time DESC").Take(&lastRound).Error; err == nil {
 			state.LastStartTime = &lastRound.StartTime
 			state.LastStopTime = lastRound.EndTime
-			state.LastStartStr = lastRound.StartTime.Format("2006-01-02 15:04:05")
-			state.LastStopStr = lastRound.EndTime.Format("2006-01-02 15:04:05")
+			state.LastRoundID = lastRound.ID
+			state.LastStartedBy = lastRound.StartedBy
+			if until, ok := resumableUntil(lastRound, time.Now()); ok {
+				state.ResumableUntil = &until
+			}
 		}
 	}
 
-	todaySeconds, totalSeconds := calculateGroupTotals(groupID)
-	state.TotalTodaySeconds = todaySeconds
-	state.TotalOverallSeconds = totalSeconds
-	state.TotalTodayFormatted = formatDuration(todaySeconds)
-	state.TotalOverallFormatted = formatDuration(totalSeconds)
+	totals := calculateGroupTotals(ctx, groupID)
+	state.TotalTodaySeconds = totals.TodaySeconds
+	state.TotalWeekSeconds = totals.WeekSeconds
+	state.TotalOverallSeconds = totals.TotalSeconds
+	state.TotalTodayFormatted = formatDuration(state.TotalTodaySeconds)
+	state.TotalWeekFormatted = formatDuration(state.TotalWeekSeconds)
+	state.TotalOverallFormatted = formatDuration(state.TotalOverallSeconds)
+	state.BillableTodaySeconds = totals.BillableTodaySeconds
+	state.BillableOverallSeconds = totals.BillableSeconds
+	state.TodaySplit = splitBillable(state.TotalTodaySeconds, state.BillableTodaySeconds)
+	state.OverallSplit = splitBillable(state.TotalOverallSeconds, state.BillableOverallSeconds)
+	now := time.Now()
+	if group.ID == 0 {
+		return state
+	}
+	week := weekStart(now)
+	exceptions, err := loadCapacityExceptions(ctx, group.UserID, week, week.AddDate(0, 0, 7))
+	if err != nil {
+		log.Println("Error loading day exceptions:", err)
+	}
+	if exception, ok := exceptions[groupID][now.Format("2006-01-02")]; ok {
+		state.DailyTargetException = true
+		state.DailyTargetReason = exception.Reason
+	}
+	applyDailyTarget(&state, dayTargetMinutes(group.DailyTargetMinutes, exceptions[groupID], now.Format("2006-01-02")), now)
+	planned, err := plannedWeekSeconds(ctx, group.UserID, week)
+	if err != nil {
+		log.Println("Error loading planned hours:", err)
+	}
+	applyWeeklyTarget(&state, planned[groupID], group.DailyTargetMinutes, exceptions[groupID], week)
 
 	return state
 }
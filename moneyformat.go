@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Ways of showing the currency of an amount, by the names money.display takes
+const (
+	moneyDisplayCode   = "code"   // 1,234.50 EUR
+	moneyDisplaySymbol = "symbol" // €1,234.50, or the code for currencies without a symbol
+)
+
+// numberFormat is how a locale writes amounts: the separator between thousands, the decimal separator and on which
+// side of the number a currency symbol goes
+type numberFormat struct {
+	Group       string
+	Decimal     string
+	SymbolFirst bool
+}
+
+var (
+	formatPointDecimal = numberFormat{Group: ",", Decimal: ".", SymbolFirst: true} // 1,234.50
+	formatCommaDecimal = numberFormat{Group: ".", Decimal: ","}                    // 1.234,50
+	formatSpaceGrouped = numberFormat{Group: "\u00a0", Decimal: ","}               // 1 234,50, with a no-break space
+	formatApostrophe   = numberFormat{Group: "'", Decimal: ".", SymbolFirst: true} // 1'234.50
+	formatUngrouped    = numberFormat{Group: "", Decimal: ".", SymbolFirst: true}  // 1234.50
+)
+
+// localeNumberFormats maps money.locale, a language such as "de" or a language and region such as "de-CH", to its
+// number format. A region without an entry of its own uses the format of its language.
+var localeNumberFormats = map[string]numberFormat{
+	"en": formatPointDecimal, "ja": formatPointDecimal, "zh": formatPointDecimal, "ko": formatPointDecimal,
+	"he": formatPointDecimal, "th": formatPointDecimal, "ms": formatPointDecimal, "es-mx": formatPointDecimal,
+	"de": formatCommaDecimal, "nl": formatCommaDecimal, "it": formatCommaDecimal, "es": formatCommaDecimal,
+	"pt": formatCommaDecimal, "da": formatCommaDecimal, "id": formatCommaDecimal, "tr": formatCommaDecimal,
+	"el": formatCommaDecimal, "ro": formatCommaDecimal, "hr": formatCommaDecimal, "sl": formatCommaDecimal,
+	"sr": formatCommaDecimal, "fa": formatCommaDecimal,
+	"fr": formatSpaceGrouped, "sv": formatSpaceGrouped, "nb": formatSpaceGrouped, "nn": formatSpaceGrouped,
+	"no": formatSpaceGrouped, "fi": formatSpaceGrouped, "pl": formatSpaceGrouped, "cs": formatSpaceGrouped,
+	"sk": formatSpaceGrouped, "ru": formatSpaceGrouped, "uk": formatSpaceGrouped, "hu": formatSpaceGrouped,
+	"bg": formatSpaceGrouped, "lt": formatSpaceGrouped, "lv": formatSpaceGrouped, "et": formatSpaceGrouped,
+	"de-ch": formatApostrophe, "it-ch": formatApostrophe, "de-li": formatApostrophe,
+	"plain": formatUngrouped, // The format before money.locale, without thousands separators
+}
+
+// currencySymbols are the symbols money.display=symbol shows, where they are unambiguous enough; money.symbols adds
+// to and replaces them
+var currencySymbols = map[string]string{
+	"EUR": "€", "USD": "$", "GBP": "£", "JPY": "¥", "CNY": "CN¥", "INR": "₹", "KRW": "₩", "ILS": "₪",
+	"CAD": "CA$", "AUD": "A$", "NZD": "NZ$", "MXN": "MX$", "BRL": "R$", "TRY": "₺", "UAH": "₴", "RUB": "₽",
+	"PLN": "zł", "CZK": "Kč", "HUF": "Ft", "SEK": "kr", "NOK": "kr", "DKK": "kr", "ZAR": "R", "VND": "₫",
+}
+
+// numberFormatFor looks up the number format of a locale, written as "de", "de-CH" or "de_CH" in any case
+func numberFormatFor(locale string) (numberFormat, bool) {
+	tag := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+	if format, ok := localeNumberFormats[tag]; ok {
+		return format, true
+	}
+	language, _, _ := strings.Cut(tag, "-")
+	format, ok := localeNumberFormats[language]
+	return format, ok
+}
+
+// moneyNumberFormat is the number format of money.locale, checked when the config is loaded
+func moneyNumberFormat() numberFormat {
+	if format, ok := numberFormatFor(cfg.Money.Locale); ok {
+		return format
+	}
+	return formatPointDecimal
+}
+
+// currencySymbol is the symbol of a currency, from money.symbols or the built-in ones; false when it has none
+func currencySymbol(currency string) (string, bool) {
+	if symbol, ok := cfg.Money.Symbols[currency]; ok {
+		return symbol, true
+	}
+	symbol, ok := currencySymbols[currency]
+	return symbol, ok
+}
+
+// amount writes cents in the format, such as "1.234,50"
+func (f numberFormat) amount(cents int64) string {
+	whole := strconv.FormatInt(cents/100, 10)
+	for i := len(whole) - 3; i > 0 && f.Group != ""; i -= 3 {
+		whole = whole[:i] + f.Group + whole[i:]
+	}
+	return fmt.Sprintf("%s%s%02d", whole, f.Decimal, cents%100)
+}
+
+// placeSymbol puts a currency symbol on its side of an amount. Symbols ending in a letter, such as "kr" or "Fr.",
+// are kept apart from the number by a space.
+func (f numberFormat) placeSymbol(amount, symbol string) string {
+	if !f.SymbolFirst {
+		return amount + " " + symbol
+	}
+	last, _ := utf8.DecodeLastRuneInString(strings.TrimSuffix(symbol, "."))
+	if unicode.IsLetter(last) {
+		return symbol + " " + amount
+	}
+	return symbol + amount
+}
+
+// validateMoneyConfig checks the money section: a known locale, display and symbols keyed by currency codes
+func (c *Config) validateMoneyConfig() error {
+	if _, ok := numberFormatFor(c.Money.Locale); !ok {
+		return fmt.Errorf("unknown money locale %q, use a language like en, de or fr, or plain", c.Money.Locale)
+	}
+	switch c.Money.Display {
+	case moneyDisplayCode, moneyDisplaySymbol:
+	default:
+		return fmt.Errorf("unknown money display %q, use %s or %s", c.Money.Display, moneyDisplayCode, moneyDisplaySymbol)
+	}
+	for currency, symbol := range c.Money.Symbols {
+		if code, err := parseCurrency(currency); err != nil || code != currency {
+			return fmt.Errorf("money symbol for %q: use an uppercase currency code like EUR", currency)
+		}
+		if strings.TrimSpace(symbol) == "" {
+			return fmt.Errorf("money symbol for %s is empty", currency)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,571 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	webpush "github.com/SherClockHolmes/webpush-go"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Alert types that can be routed to notification channels
+const (
+	alertBudget  = "budget"
+	alertTarget  = "target"
+	alertPolicy  = "policy"
+	alertSummary = "summary"
+)
+
+var alertTypes = []struct {
+	Key   string
+	Label string
+}{
+	{alertBudget, "Budget alerts"},
+	{alertTarget, "Target alerts"},
+	{alertPolicy, "Policy alerts"},
+	{alertSummary, "Nightly summary"},
+}
+
+// Notification is a message sent through one or more notification channels
+type Notification struct {
+	Type    string `json:"type"`
+	Title   string `json:"title"`
+	Message string `json:"message"`
+	GroupID uint   `json:"group_id,omitempty"`
+	URL     string `json:"url,omitempty"`
+}
+
+// Notifier delivers notifications over one channel
+type Notifier interface {
+	Name() string
+	Send(n Notification) error
+}
+
+// notifiers holds the configured channels keyed by name
+var notifiers = map[string]Notifier{}
+
+var notifyHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+// configureNotifiers registers every channel that is configured
+func configureNotifiers() {
+	notify := cfg.Notify
+	if email := notify.Email; email.SMTPHost != "" && len(email.To) > 0 {
+		registerNotifier(&emailNotifier{
+			addr:     email.SMTPHost + ":" + email.SMTPPort,
+			host:     email.SMTPHost,
+			username: email.SMTPUser,
+			password: email.SMTPPass,
+			from:     email.From,
+			to:       email.To,
+		})
+	}
+	if telegram := notify.Telegram; telegram.BotToken != "" && telegram.ChatID != "" {
+		registerNotifier(&telegramNotifier{token: telegram.BotToken, chatID: telegram.ChatID})
+	}
+	if notify.WebhookURL != "" {
+		registerNotifier(&webhookNotifier{url: notify.WebhookURL})
+	}
+	if notify.SlackURL != "" {
+		registerNotifier(&slackNotifier{url: notify.SlackURL})
+	}
+	if notify.DiscordURL != "" {
+		registerNotifier(&discordNotifier{url: notify.DiscordURL})
+	}
+	if ntfy := notify.Ntfy; ntfy.Topic != "" {
+		registerNotifier(&ntfyNotifier{server: strings.TrimRight(ntfy.URL, "/"), topic: ntfy.Topic, token: ntfy.Token})
+	}
+	if gotify := notify.Gotify; gotify.URL != "" && gotify.Token != "" {
+		registerNotifier(&gotifyNotifier{server: strings.TrimRight(gotify.URL, "/"), token: gotify.Token})
+	}
+	if matrix := notify.Matrix; matrix.Homeserver != "" && matrix.AccessToken != "" && matrix.RoomID != "" {
+		registerNotifier(&matrixNotifier{
+			homeserver: strings.TrimRight(matrix.Homeserver, "/"),
+			token:      matrix.AccessToken,
+			roomID:     matrix.RoomID,
+		})
+	}
+	registerNotifier(&webPushNotifier{subject: notify.WebPushSubject})
+}
+
+func registerNotifier(n Notifier) {
+	notifiers[n.Name()] = n
+}
+
+func notifierNames() []string {
+	names := make([]string, 0, len(notifiers))
+	for name := range notifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// alertChannels returns the channels selected for an alert type in the notification settings
+func alertChannels(alertType string) []string {
+	value := getSetting("notify."+alertType, "")
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// notify sends n to every channel selected for its type; delivery happens in the background. Notifications about a
+// muted group are dropped, and during do-not-disturb they are held until it ends (in memory, so a restart loses them).
+func notify(n Notification) {
+	if n.GroupID != 0 {
+		var group WorkingGroup
+		if err := db.Select("notify_muted").Take(&group, n.GroupID).Error; err == nil && group.NotifyMuted {
+			return
+		}
+	}
+	windows, err := currentDNDWindows()
+	if err != nil {
+		log.Println("Ignoring invalid do-not-disturb windows:", err)
+	}
+	if until, quiet := dndUntil(windows, time.Now()); quiet {
+		log.Printf("Holding %s notification until %s (do not disturb)", n.Type, until.Format("Mon 15:04"))
+		time.AfterFunc(time.Until(until), func() { notify(n) })
+		return
+	}
+
+	for _, name := range alertChannels(n.Type) {
+		notifier, ok := notifiers[name]
+		if !ok {
+			continue
+		}
+		go func(notifier Notifier) {
+			if err := notifier.Send(n); err != nil {
+				log.Printf("Error sending %s notification via %s: %v", n.Type, notifier.Name(), err)
+			}
+		}(notifier)
+	}
+}
+
+func postJSON(target string, payload interface{}) error {
+	return postJSONWithHeaders(target, nil, payload)
+}
+
+func postJSONWithHeaders(target string, headers map[string]string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := notifyHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+	return nil
+}
+
+type emailNotifier struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func (e *emailNotifier) Name() string { return "email" }
+
+func (e *emailNotifier) Send(n Notification) error {
+	return e.sendMail(e.to, n.Title, n.Message+linkSuffix(n.URL))
+}
+
+func (e *emailNotifier) sendMail(to []string, subject, body string) error {
+	var auth smtp.Auth
+	if e.username != "" {
+		auth = smtp.PlainAuth("", e.username, e.password, e.host)
+	}
+	from := e.from
+	if from == "" {
+		from = e.username
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		from, strings.Join(to, ", "), subject, body)
+	return smtp.SendMail(e.addr, auth, from, to, []byte(msg))
+}
+
+type telegramNotifier struct {
+	token  string
+	chatID string
+}
+
+func (t *telegramNotifier) Name() string { return "telegram" }
+
+func (t *telegramNotifier) Send(n Notification) error {
+	return postJSON(fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", url.PathEscape(t.token)), map[string]string{
+		"chat_id": t.chatID,
+		"text":    n.Title + "\n" + n.Message + linkSuffix(n.URL),
+	})
+}
+
+type webhookNotifier struct {
+	url string
+}
+
+func (w *webhookNotifier) Name() string { return "webhook" }
+
+func (w *webhookNotifier) Send(n Notification) error {
+	return postJSON(w.url, n)
+}
+
+// slackNotifier posts to a Slack incoming webhook
+type slackNotifier struct {
+	url string
+}
+
+func (s *slackNotifier) Name() string { return "slack" }
+
+func (s *slackNotifier) Send(n Notification) error {
+	return postJSON(s.url, map[string]string{"text": "*" + n.Title + "*\n" + n.Message + linkSuffix(n.URL)})
+}
+
+// discordNotifier posts to a Discord channel webhook
+type discordNotifier struct {
+	url string
+}
+
+func (d *discordNotifier) Name() string { return "discord" }
+
+func (d *discordNotifier) Send(n Notification) error {
+	return postJSON(d.url, map[string]string{"content": "**" + n.Title + "**\n" + n.Message + linkSuffix(n.URL)})
+}
+
+// Priority levels shared by ntfy and Gotify, from the notify.priorities setting
+var (
+	ntfyPriorities   = map[string]int{"min": 1, "low": 2, "default": 3, "high": 4, "urgent": 5}
+	gotifyPriorities = map[string]int{"min": 1, "low": 3, "default": 5, "high": 8, "urgent": 10}
+)
+
+// notificationPriority looks up the level of an alert type in a service's scale, unknown levels map to default
+func notificationPriority(alertType string, scale map[string]int) int {
+	if priority, ok := scale[strings.ToLower(cfg.Notify.Priorities[alertType])]; ok {
+		return priority
+	}
+	return scale["default"]
+}
+
+// ntfyNotifier publishes to an ntfy topic, on ntfy.sh or a self-hosted server
+type ntfyNotifier struct {
+	server string
+	topic  string
+	token  string
+}
+
+func (n *ntfyNotifier) Name() string { return "ntfy" }
+
+func (n *ntfyNotifier) Send(notification Notification) error {
+	headers := map[string]string{}
+	if n.token != "" {
+		headers["Authorization"] = "Bearer " + n.token
+	}
+	// JSON publishing keeps non-ASCII titles intact, unlike the Title header
+	payload := map[string]interface{}{
+		"topic":    n.topic,
+		"title":    notification.Title,
+		"message":  notification.Message,
+		"priority": notificationPriority(notification.Type, ntfyPriorities),
+		"tags":     []string{"stopwatch"},
+	}
+	if notification.URL != "" {
+		payload["click"] = notification.URL
+	}
+	return postJSONWithHeaders(n.server, headers, payload)
+}
+
+// gotifyNotifier posts to a Gotify server with an application token
+type gotifyNotifier struct {
+	server string
+	token  string
+}
+
+func (g *gotifyNotifier) Name() string { return "gotify" }
+
+func (g *gotifyNotifier) Send(n Notification) error {
+	payload := map[string]interface{}{
+		"title":    n.Title,
+		"message":  n.Message + linkSuffix(n.URL),
+		"priority": notificationPriority(n.Type, gotifyPriorities),
+	}
+	if n.URL != "" {
+		payload["extras"] = map[string]interface{}{
+			"client::notification": map[string]interface{}{"click": map[string]string{"url": n.URL}},
+		}
+	}
+	return postJSONWithHeaders(g.server+"/message", map[string]string{"X-Gotify-Key": g.token}, payload)
+}
+
+// matrixNotifier sends a text message to a Matrix room as the access token's user
+type matrixNotifier struct {
+	homeserver string
+	token      string
+	roomID     string
+}
+
+func (m *matrixNotifier) Name() string { return "matrix" }
+
+func (m *matrixNotifier) Send(n Notification) error {
+	body, err := json.Marshal(map[string]string{
+		"msgtype": "m.text",
+		"body":    n.Title + "\n" + n.Message + linkSuffix(n.URL),
+	})
+	if err != nil {
+		return err
+	}
+	// The transaction ID makes retries of the same request idempotent
+	target := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/hours-%d",
+		m.homeserver, url.PathEscape(m.roomID), time.Now().UnixNano())
+	req, err := http.NewRequest(http.MethodPut, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+m.token)
+	resp, err := notifyHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+	return nil
+}
+
+// PushSubscription is a browser registered for Web Push notifications
+type PushSubscription struct {
+	ID        uint   `gorm:"primaryKey"`
+	Endpoint  string `gorm:"uniqueIndex;size:500;not null"`
+	P256dh    string
+	Auth      string // Sealed with SECRETS_KEY when one is set, see sealSecret
+	CreatedAt time.Time
+}
+
+type webPushNotifier struct {
+	subject string
+}
+
+func (w *webPushNotifier) Name() string { return "webpush" }
+
+func (w *webPushNotifier) Send(n Notification) error {
+	publicKey, privateKey, err := vapidKeys()
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	var subscriptions []PushSubscription
+	if err := db.Find(&subscriptions).Error; err != nil {
+		return err
+	}
+	subject := w.subject
+	if subject == "" {
+		subject = "mailto:admin@localhost"
+	}
+
+	for _, sub := range subscriptions {
+		auth, err := openSecret(sub.Auth)
+		if err != nil {
+			log.Printf("Error reading push subscription #%d: %v", sub.ID, err)
+			continue
+		}
+		resp, err := webpush.SendNotification(payload, &webpush.Subscription{
+			Endpoint: sub.Endpoint,
+			Keys:     webpush.Keys{P256dh: sub.P256dh, Auth: auth},
+		}, &webpush.Options{
+			Subscriber:      subject,
+			VAPIDPublicKey:  publicKey,
+			VAPIDPrivateKey: privateKey,
+			TTL:             3600,
+		})
+		if err != nil {
+			log.Println("Error sending web push notification:", err)
+			continue
+		}
+		resp.Body.Close()
+		// The browser unsubscribed, forget the endpoint
+		if resp.StatusCode == http.StatusGone || resp.StatusCode == http.StatusNotFound {
+			db.Delete(&sub)
+		}
+	}
+	return nil
+}
+
+// vapidKeys returns the instance's VAPID key pair, generating it on first use
+func vapidKeys() (string, string, error) {
+	var privateKey string
+	publicKey, err := getOrCreateSetting("webpush_public_key", func() (string, error) {
+		private, public, err := webpush.GenerateVAPIDKeys()
+		if err != nil {
+			return "", err
+		}
+		privateKey = private
+		return public, setSetting("webpush_private_key", private)
+	})
+	if err != nil {
+		return "", "", err
+	}
+	if privateKey == "" {
+		privateKey = getSetting("webpush_private_key", "")
+	}
+	return publicKey, privateKey, nil
+}
+
+func linkSuffix(link string) string {
+	if link == "" {
+		return ""
+	}
+	return "\n" + link
+}
+
+func renderNotificationSettings(c *fiber.Ctx) error {
+	names := notifierNames()
+
+	var rows []fiber.Map
+	for _, alert := range alertTypes {
+		selected := make(map[string]bool)
+		for _, name := range alertChannels(alert.Key) {
+			selected[name] = true
+		}
+		var channels []fiber.Map
+		for _, name := range names {
+			channels = append(channels, fiber.Map{
+				"Name":     name,
+				"Selected": selected[name],
+			})
+		}
+		rows = append(rows, fiber.Map{
+			"Key":      alert.Key,
+			"Label":    alert.Label,
+			"Channels": channels,
+		})
+	}
+
+	publicKey, _, err := vapidKeys()
+	if err != nil {
+		requestLog(c).Println("Error loading VAPID keys:", err)
+	}
+
+	view := fiber.Map{
+		"Channels":       names,
+		"AlertRows":      rows,
+		"VAPIDPublicKey": publicKey,
+		"Saved":          c.Query("saved") != "",
+		"DNDWindows":     getSetting(dndSettingKey, ""),
+	}
+	if windows, err := currentDNDWindows(); err == nil {
+		if until, quiet := dndUntil(windows, time.Now()); quiet {
+			view["DNDActive"] = true
+			view["DNDUntil"] = until.Format("Mon, Jan 2 15:04")
+		}
+	}
+	return c.Render("notifications", view)
+}
+
+// saveDNDHandler replaces the do-not-disturb windows, rejecting the lot when a line can't be read
+func saveDNDHandler(c *fiber.Ctx) error {
+	// Checked as typed, so the line numbers of errors match the text box
+	if _, err := parseDNDWindows(c.FormValue("windows")); err != nil {
+		return c.Status(400).SendString("Invalid do-not-disturb window: " + err.Error())
+	}
+	var lines []string
+	for _, line := range strings.Split(c.FormValue("windows"), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	text := strings.Join(lines, "\n")
+	if err := setSetting(dndSettingKey, text); err != nil {
+		requestLog(c).Println("Error saving do-not-disturb windows:", err)
+		return c.Status(500).SendString("Error saving do-not-disturb windows")
+	}
+	details := "Cleared the do-not-disturb windows"
+	if text != "" {
+		details = "Set the do-not-disturb windows to " + strings.Join(lines, "; ")
+	}
+	recordAudit("settings.notifications", clientInfoFromRequest(c), 0, nil, details)
+	return c.Redirect("/settings/notifications?saved=1", fiber.StatusSeeOther)
+}
+
+func saveNotificationSettingsHandler(c *fiber.Ctx) error {
+	for _, alert := range alertTypes {
+		var selected []string
+		for _, name := range notifierNames() {
+			if c.FormValue(alert.Key+"."+name) != "" {
+				selected = append(selected, name)
+			}
+		}
+		if err := setSetting("notify."+alert.Key, strings.Join(selected, ",")); err != nil {
+			requestLog(c).Println("Error saving notification settings:", err)
+			return c.Status(500).SendString("Error saving notification settings")
+		}
+	}
+	return c.Redirect("/settings/notifications?saved=1", fiber.StatusSeeOther)
+}
+
+func testNotificationHandler(c *fiber.Ctx) error {
+	notifier, ok := notifiers[c.FormValue("channel")]
+	if !ok {
+		return c.Status(400).SendString("Unknown notification channel")
+	}
+	err := notifier.Send(Notification{
+		Type:    "test",
+		Title:   "Hours Tracker test notification",
+		Message: "Notifications from Hours Tracker reach you through this channel.",
+	})
+	if err != nil {
+		return c.Status(502).SendString("Test notification failed: " + err.Error())
+	}
+	return c.SendString("Test notification sent via " + notifier.Name())
+}
+
+func subscribePushHandler(c *fiber.Ctx) error {
+	var req struct {
+		Endpoint string `json:"endpoint"`
+		Keys     struct {
+			P256dh string `json:"p256dh"`
+			Auth   string `json:"auth"`
+		} `json:"keys"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Endpoint == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid subscription"})
+	}
+
+	auth, err := sealSecret(req.Keys.Auth)
+	if err != nil {
+		requestLog(c).Println("Error encrypting push subscription:", err)
+		return c.Status(500).JSON(fiber.Map{"error": "error saving subscription"})
+	}
+	sub := PushSubscription{Endpoint: req.Endpoint}
+	if err := db.Where(PushSubscription{Endpoint: req.Endpoint}).
+		Assign(PushSubscription{P256dh: req.Keys.P256dh, Auth: auth}).
+		FirstOrCreate(&sub).Error; err != nil {
+		requestLog(c).Println("Error saving push subscription:", err)
+		return c.Status(500).JSON(fiber.Map{"error": "error saving subscription"})
+	}
+	return c.JSON(fiber.Map{"id": sub.ID})
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+const (
+	oidcStateCookie    = "hours_oidc_state"
+	oidcNonceCookie    = "hours_oidc_nonce"
+	oidcRememberCookie = "hours_oidc_remember"
+)
+
+// oidcSettings is the OpenID Connect configuration
+type oidcSettings struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string // Defaults to <base URL>/auth/oidc/callback
+	GroupsClaim  string
+	AdminGroup   string // Members of this group get the admin role
+}
+
+func loadOIDCSettings() oidcSettings {
+	settings := oidcSettings{
+		Issuer:       cfg.Auth.OIDC.Issuer,
+		ClientID:     cfg.Auth.OIDC.ClientID,
+		ClientSecret: cfg.Auth.OIDC.ClientSecret,
+		RedirectURL:  cfg.Auth.OIDC.RedirectURL,
+		GroupsClaim:  cfg.Auth.OIDC.GroupsClaim,
+		AdminGroup:   cfg.Auth.OIDC.AdminGroup,
+	}
+	if settings.GroupsClaim == "" {
+		settings.GroupsClaim = "groups"
+	}
+	return settings
+}
+
+// oidcConfig is loaded in main once the configuration is read
+var oidcConfig oidcSettings
+
+func oidcEnabled() bool {
+	return oidcConfig.Issuer != "" && oidcConfig.ClientID != ""
+}
+
+var (
+	oidcProviderMu sync.Mutex
+	oidcProvider   *oidc.Provider
+)
+
+// getOIDCProvider runs discovery on first use and caches the result, so an unreachable issuer does not block startup
+func getOIDCProvider(ctx context.Context) (*oidc.Provider, error) {
+	oidcProviderMu.Lock()
+	defer oidcProviderMu.Unlock()
+	if oidcProvider != nil {
+		return oidcProvider, nil
+	}
+	provider, err := oidc.NewProvider(ctx, oidcConfig.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	oidcProvider = provider
+	return provider, nil
+}
+
+func oauth2Config(c *fiber.Ctx, provider *oidc.Provider) *oauth2.Config {
+	redirectURL := oidcConfig.RedirectURL
+	if redirectURL == "" {
+		redirectURL = appURL(c, "/auth/oidc/callback")
+	}
+	return &oauth2.Config{
+		ClientID:     oidcConfig.ClientID,
+		ClientSecret: oidcConfig.ClientSecret,
+		RedirectURL:  redirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       []string{oidc.ScopeOpenID, "profile", "email", oidcConfig.GroupsClaim},
+	}
+}
+
+func randomString() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func setShortCookie(c *fiber.Ctx, name, value string) {
+	c.Cookie(&fiber.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/auth/oidc",
+		Expires:  time.Now().Add(10 * time.Minute),
+		HTTPOnly: true,
+		SameSite: "Lax",
+		Secure:   c.Protocol() == "https",
+	})
+}
+
+// oidcLoginHandler redirects to the identity provider
+func oidcLoginHandler(c *fiber.Ctx) error {
+	if !oidcEnabled() {
+		return c.Status(404).SendString("Single sign-on is not configured")
+	}
+	provider, err := getOIDCProvider(c.Context())
+	if err != nil {
+		requestLog(c).Println("Error discovering OIDC provider:", err)
+		return c.Status(502).SendString("Identity provider is unavailable")
+	}
+
+	state, err := randomString()
+	if err != nil {
+		return c.Status(500).SendString("Error starting sign-in")
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return c.Status(500).SendString("Error starting sign-in")
+	}
+	setShortCookie(c, oidcStateCookie, state)
+	setShortCookie(c, oidcNonceCookie, nonce)
+	if c.Query("remember") != "" {
+		setShortCookie(c, oidcRememberCookie, "1")
+	}
+
+	return c.Redirect(oauth2Config(c, provider).AuthCodeURL(state, oidc.Nonce(nonce)), fiber.StatusFound)
+}
+
+// oidcClaims are the ID token claims used to provision and update accounts
+type oidcClaims struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	PreferredUsername string `json:"preferred_username"`
+	Nonce             string `json:"nonce"`
+}
+
+// oidcCallbackHandler completes the authorization code flow and signs the user in
+func oidcCallbackHandler(c *fiber.Ctx) error {
+	if !oidcEnabled() {
+		return c.Status(404).SendString("Single sign-on is not configured")
+	}
+	if c.Query("error") != "" {
+		return c.Status(401).Render("login", loginView(fiber.Map{"Error": "Sign-in was cancelled: " + c.Query("error_description", c.Query("error"))}))
+	}
+	state := c.Cookies(oidcStateCookie)
+	if state == "" || c.Query("state") != state {
+		return c.Status(400).SendString("Invalid sign-in state, please try again")
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 15*time.Second)
+	defer cancel()
+	provider, err := getOIDCProvider(ctx)
+	if err != nil {
+		requestLog(c).Println("Error discovering OIDC provider:", err)
+		return c.Status(502).SendString("Identity provider is unavailable")
+	}
+
+	token, err := oauth2Config(c, provider).Exchange(ctx, c.Query("code"))
+	if err != nil {
+		requestLog(c).Println("Error exchanging OIDC code:", err)
+		return c.Status(401).SendString("Sign-in failed")
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return c.Status(401).SendString("Sign-in failed: no ID token returned")
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: oidcConfig.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		requestLog(c).Println("Error verifying OIDC ID token:", err)
+		return c.Status(401).SendString("Sign-in failed")
+	}
+
+	var claims oidcClaims
+	var allClaims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return c.Status(401).SendString("Sign-in failed: unreadable claims")
+	}
+	if err := idToken.Claims(&allClaims); err != nil {
+		return c.Status(401).SendString("Sign-in failed: unreadable claims")
+	}
+	if claims.Nonce == "" || claims.Nonce != c.Cookies(oidcNonceCookie) {
+		return c.Status(400).SendString("Invalid sign-in nonce, please try again")
+	}
+	c.ClearCookie(oidcStateCookie, oidcNonceCookie)
+
+	user, err := provisionOIDCUser(claims, claimGroups(allClaims[oidcConfig.GroupsClaim]))
+	if err != nil {
+		requestLog(c).Println("Error provisioning OIDC user:", err)
+		return c.Status(409).Render("login", loginView(fiber.Map{"Error": err.Error()}))
+	}
+
+	remember := c.Cookies(oidcRememberCookie) != ""
+	c.ClearCookie(oidcRememberCookie)
+	if err := startSession(c, user, remember); err != nil {
+		requestLog(c).Println("Error creating session:", err)
+		return c.Status(500).SendString("Error signing in")
+	}
+	return c.Redirect("/", fiber.StatusSeeOther)
+}
+
+// claimGroups accepts the group claim as a list or a single string
+func claimGroups(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var groups []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+		return groups
+	}
+	return nil
+}
+
+// provisionOIDCUser finds the account linked to the subject, creating it on first login, and syncs its role
+func provisionOIDCUser(claims oidcClaims, groups []string) (User, error) {
+	isAdmin := false
+	for _, group := range groups {
+		isAdmin = isAdmin || (oidcConfig.AdminGroup != "" && group == oidcConfig.AdminGroup)
+	}
+
+	var user User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("oidc_subject = ?", claims.Subject).First(&user).Error
+		if err == nil {
+			if oidcConfig.AdminGroup == "" {
+				return nil
+			}
+			role := user.Role
+			if isAdmin {
+				role = roleAdmin
+			} else if role == roleAdmin && !isLastAdmin(tx, user) {
+				role = roleMember
+			}
+			if role != user.Role {
+				user.Role = role
+				return tx.Model(&user).Update("role", role).Error
+			}
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		username := claims.PreferredUsername
+		if username == "" {
+			username = claims.Email
+		}
+		if username == "" {
+			username = claims.Subject
+		}
+		var existing int64
+		tx.Model(&User{}).Where("username = ?", username).Count(&existing)
+		if existing > 0 {
+			return fmt.Errorf("a local account named '%s' already exists; ask an admin to rename it", username)
+		}
+
+		var userCount int64
+		if err := tx.Model(&User{}).Count(&userCount).Error; err != nil {
+			return err
+		}
+		user = User{Username: username, OIDCSubject: claims.Subject, Role: roleMember}
+		if isAdmin || userCount == 0 {
+			user.Role = roleAdmin
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if userCount == 0 {
+			return claimUnownedData(tx, user.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return User{}, err
+	}
+
+	ensureDefaultWorkingGroup(user.ID)
+	log.Printf("Signed in '%s' via single sign-on", user.Username)
+	return user, nil
+}
+
+// oidcButtonLabel names the provider on the login page, e.g. "auth.example.com"
+func oidcButtonLabel() string {
+	label := strings.TrimPrefix(strings.TrimPrefix(oidcConfig.Issuer, "https://"), "http://")
+	if i := strings.Index(label, "/"); i > 0 {
+		label = label[:i]
+	}
+	return label
+}
@@ -0,0 +1,582 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// apiParam documents a path or query parameter of an API operation
+type apiParam struct {
+	Name        string
+	In          string // "path" or "query"
+	Description string
+	Required    bool
+	Type        string // Schema type, "integer" when empty
+}
+
+// apiOperation documents one JSON API endpoint; request and response schemas are derived from Go types
+type apiOperation struct {
+	Method      string
+	Path        string // OpenAPI path template, e.g. /api/v1/rounds/{id}
+	Summary     string
+	Scope       string
+	Params      []apiParam
+	RequestBody interface{} // Zero value of the request type, nil for none
+	Upload      string      // File field of a multipart/form-data body, for uploads instead of RequestBody
+	Response    interface{} // Zero value of the response type, nil for 204 No Content
+}
+
+var apiOperations = []apiOperation{
+	{
+		Method:   "get",
+		Path:     "/api/v1/status",
+		Summary:  "Current state of a working group",
+		Scope:    scopeRead,
+		Params:   []apiParam{{Name: "group_id", In: "query", Description: "Working group, defaults to the first group"}},
+		Response: AppState{},
+	},
+	{
+		Method:   "get",
+		Path:     "/api/v1/board",
+		Summary:  "Running state, today and this week of every working group at once, for the all-groups dashboard",
+		Scope:    scopeRead,
+		Response: boardState{},
+	},
+	{
+		Method:  "get",
+		Path:    "/api/v1/wallboard",
+		Summary: "Running round, today and this week of one working group, trimmed for wall displays; long-polls like /api/v1/watch",
+		Scope:   scopeRead,
+		Params: []apiParam{
+			{Name: "group_id", In: "query", Description: "Working group, defaults to the first group"},
+			{Name: "v", In: "query", Description: "Version the client has; answers 304 when it is still current"},
+			{Name: "wait", In: "query", Description: "Seconds to wait for a change when v is current, at most 120"},
+		},
+		Response: wallboardState{},
+	},
+	{
+		Method:   "get",
+		Path:     "/api/v1/groups",
+		Summary:  "List working groups, subgroups after their parent, with their own and rolled-up totals",
+		Scope:    scopeRead,
+		Response: []apiGroup{},
+	},
+	{
+		Method:  "get",
+		Path:    "/api/v1/rounds",
+		Summary: "List rounds a page at a time, filtered by group, source, tag, words and start date and sorted by a column",
+		Scope:   scopeRead,
+		Params: []apiParam{
+			{Name: "group_id", In: "query", Description: "Working group, all groups when omitted"},
+			{Name: "source", In: "query", Description: "manual, api, cli, timesheet, calendar, email, sms, voice or sync; any when omitted", Type: "string"},
+			{Name: "tag", In: "query", Description: "Only rounds with this tag; any when omitted", Type: "string"},
+			{Name: "q", In: "query", Description: "Only rounds whose note or tags contain all these words", Type: "string"},
+			{Name: "flagged", In: "query", Description: "true for only the rounds flagged for review as shorter than MIN_ROUND_DURATION", Type: "boolean"},
+			{Name: "from", In: "query", Description: "Rounds starting on or after this day (YYYY-MM-DD)", Type: "string"},
+			{Name: "to", In: "query", Description: "Rounds starting on or before this day (YYYY-MM-DD)", Type: "string"},
+			{Name: "sort", In: "query", Description: "id, start_time (default), end_time, group or duration", Type: "string"},
+			{Name: "order", In: "query", Description: "asc or desc (default)", Type: "string"},
+			{Name: "page", In: "query", Description: "Page number, starting at 1"},
+			{Name: "per_page", In: "query", Description: "Rounds per page, 1 to 500 (default 50)"},
+		},
+		Response: roundListResponse{},
+	},
+	{
+		Method:  "get",
+		Path:    "/api/v1/search",
+		Summary: "Search the notes and tags of rounds for words, newest first; takes the filters of the rounds list with q required",
+		Scope:   scopeRead,
+		Params: []apiParam{
+			{Name: "q", In: "query", Required: true, Description: "Words every round found has in its note or tags, 10 at most; #word finds a tag", Type: "string"},
+			{Name: "group_id", In: "query", Description: "Working group, all groups when omitted"},
+			{Name: "from", In: "query", Description: "Rounds starting on or after this day (YYYY-MM-DD)", Type: "string"},
+			{Name: "to", In: "query", Description: "Rounds starting on or before this day (YYYY-MM-DD)", Type: "string"},
+			{Name: "page", In: "query", Description: "Page number, starting at 1"},
+			{Name: "per_page", In: "query", Description: "Rounds per page, 1 to 500 (default 50)"},
+		},
+		Response: roundListResponse{},
+	},
+	{
+		Method:   "get",
+		Path:     "/api/v1/rounds/{id}",
+		Summary:  "Get a round",
+		Scope:    scopeRead,
+		Params:   []apiParam{{Name: "id", In: "path", Required: true}},
+		Response: Round{},
+	},
+	{
+		Method:      "put",
+		Path:        "/api/v1/rounds/{id}",
+		Summary:     "Set a round's group, start and end; a null end keeps it running unless the group already has a running round",
+		Scope:       scopeControl,
+		Params:      []apiParam{{Name: "id", In: "path", Required: true}},
+		RequestBody: roundUpdateRequest{},
+		Response:    Round{},
+	},
+	{
+		Method:      "patch",
+		Path:        "/api/v1/rounds/{id}",
+		Summary:     "Move or resize a round, change whether it is billable or replace its tags; running rounds only take a new start, billed rounds only new tags",
+		Scope:       scopeControl,
+		Params:      []apiParam{{Name: "id", In: "path", Required: true}},
+		RequestBody: roundTimesRequest{},
+		Response:    Round{},
+	},
+	{
+		Method:      "post",
+		Path:        "/api/v1/rounds/{id}/split",
+		Summary:     "Split a round in two at a time, optionally resuming later to leave out a break; billed rounds cannot be split",
+		Scope:       scopeControl,
+		Params:      []apiParam{{Name: "id", In: "path", Required: true}},
+		RequestBody: roundSplitRequest{},
+		Response:    roundSplitResponse{},
+	},
+	{
+		Method:      "post",
+		Path:        "/api/v1/rounds/merge",
+		Summary:     "Merge consecutive rounds of one group into the earliest, from the earliest start to the latest end",
+		Scope:       scopeControl,
+		RequestBody: roundMergeRequest{},
+		Response:    Round{},
+	},
+	{
+		Method:      "post",
+		Path:        "/api/v1/rounds/bulk",
+		Summary:     "Tag, untag, mark billable or non-billable, move, delete or keep flagged rounds at once; nothing changes if one of them can't",
+		Scope:       scopeControl,
+		RequestBody: roundBulkRequest{},
+		Response:    roundBulkResponse{},
+	},
+	{
+		Method:  "get",
+		Path:    "/api/v1/reports/overhead",
+		Summary: "Internal and client-facing time of a quarter, by month and group, with the internal-overhead percentage",
+		Scope:   scopeRead,
+		Params: []apiParam{
+			{Name: "quarter", In: "query", Type: "string", Description: "Quarter like 2025-Q1 (default: the current one)"},
+		},
+		Response: overheadReport{},
+	},
+	{
+		Method:  "get",
+		Path:    "/api/v1/reports/overlaps",
+		Summary: "Rounds that ran at the same time within a period, by pair of groups and one by one, with the overlap policy of each pair",
+		Scope:   scopeRead,
+		Params: []apiParam{
+			{Name: "from", In: "query", Type: "string", Description: "First day (YYYY-MM-DD, default: 29 days before to)"},
+			{Name: "to", In: "query", Type: "string", Description: "Last day (YYYY-MM-DD, default: today); the period spans at most 366 days"},
+		},
+		Response: overlapReport{},
+	},
+	{
+		Method:  "get",
+		Path:    "/api/v1/holidays",
+		Summary: "Public holidays of a year in the user's holiday region, which count as days off of every group",
+		Scope:   scopeRead,
+		Params: []apiParam{
+			{Name: "year", In: "query", Description: "Defaults to the current year"},
+			{Name: "region", In: "query", Type: "string", Description: "Country or region like DE or DE-BY instead of the user's"},
+		},
+		Response: []publicHoliday{},
+	},
+	{
+		Method:  "get",
+		Path:    "/api/v1/breaks",
+		Summary: "Pauses within rounds and breaks taken outside them, earliest first",
+		Scope:   scopeRead,
+		Params: []apiParam{
+			{Name: "group_id", In: "query", Description: "Only this working group's; all groups by default"},
+			{Name: "from", In: "query", Type: "string", Description: "First day, YYYY-MM-DD; defaults to 30 days ago"},
+			{Name: "to", In: "query", Type: "string", Description: "Last day, YYYY-MM-DD; defaults to today"},
+		},
+		Response: []breakEntry{},
+	},
+	{
+		Method:      "post",
+		Path:        "/api/v1/breaks",
+		Summary:     "Record a break outside the group's rounds; overlaps with its rounds or breaks are refused with 409",
+		Scope:       scopeControl,
+		RequestBody: breakRequest{},
+		Response:    Break{},
+	},
+	{
+		Method:  "delete",
+		Path:    "/api/v1/breaks/{id}",
+		Summary: "Remove a break recorded outside rounds; pauses go with their rounds",
+		Scope:   scopeControl,
+		Params:  []apiParam{{Name: "id", In: "path", Required: true}},
+	},
+	{
+		Method:      "post",
+		Path:        "/api/v1/toggle",
+		Summary:     "Start a round if the group is idle, otherwise stop the running round",
+		Scope:       scopeControl,
+		RequestBody: toggleRequest{},
+		Response:    toggleResponse{},
+	},
+	{
+		Method:      "post",
+		Path:        "/api/v1/resume",
+		Summary:     "Reopen the group's last round when it stopped within RESUME_GRACE, instead of starting a new one",
+		Scope:       scopeControl,
+		RequestBody: toggleRequest{},
+		Response:    toggleResponse{},
+	},
+	{
+		Method:      "post",
+		Path:        "/api/v1/pause",
+		Summary:     "Pause the group's running round for a break; the pause doesn't count in its duration",
+		Scope:       scopeControl,
+		RequestBody: toggleRequest{},
+		Response:    toggleResponse{},
+	},
+	{
+		Method:      "post",
+		Path:        "/api/v1/continue",
+		Summary:     "End the pause of the group's running round",
+		Scope:       scopeControl,
+		RequestBody: toggleRequest{},
+		Response:    toggleResponse{},
+	},
+	{
+		Method:   "post",
+		Path:     "/api/v1/stop-all",
+		Summary:  "Stop every running round across all working groups in one transaction",
+		Scope:    scopeControl,
+		Response: stopAllResponse{},
+	},
+	{
+		Method:      "post",
+		Path:        "/api/v1/exports",
+		Summary:     "Start a background export (csv) of one group or all; answers 202 with the job",
+		Scope:       scopeRead,
+		RequestBody: exportRequest{},
+		Response:    exportJobResponse{},
+	},
+	{
+		Method:   "get",
+		Path:     "/api/v1/exports/{id}",
+		Summary:  "Progress of an export job, with download_url once it is done",
+		Scope:    scopeRead,
+		Params:   []apiParam{{Name: "id", In: "path", Required: true}},
+		Response: exportJobResponse{},
+	},
+	{
+		Method:      "post",
+		Path:        "/api/v1/note",
+		Summary:     "Append a line to the note of the running round",
+		Scope:       scopeControl,
+		RequestBody: noteRequest{},
+		Response:    Round{},
+	},
+	{
+		Method:   "get",
+		Path:     "/api/v1/deck",
+		Summary:  "Compact key state for Stream Deck polling",
+		Scope:    scopeRead,
+		Params:   []apiParam{{Name: "group_id", In: "query", Description: "Working group, defaults to the first group"}},
+		Response: deckState{},
+	},
+	{
+		Method:   "post",
+		Path:     "/api/v1/deck/toggle",
+		Summary:  "Toggle the round of a working group and return the new key state",
+		Scope:    scopeControl,
+		Params:   []apiParam{{Name: "group_id", In: "query", Description: "Working group, defaults to the first group"}},
+		Response: deckState{},
+	},
+	{
+		Method:  "get",
+		Path:    "/api/v1/watch",
+		Summary: "Minimal state for watch complications, with optional long-polling (304 when unchanged)",
+		Scope:   scopeRead,
+		Params: []apiParam{
+			{Name: "group_id", In: "query", Description: "Working group, defaults to the first group"},
+			{Name: "v", In: "query", Description: "Version from the previous response; the request waits for a change"},
+			{Name: "wait", In: "query", Description: "Seconds to wait for a change when v is current (max 120)"},
+		},
+		Response: watchState{},
+	},
+	{
+		Method:   "post",
+		Path:     "/api/v1/watch/toggle",
+		Summary:  "Toggle the round of a working group and return the new watch state",
+		Scope:    scopeControl,
+		Params:   []apiParam{{Name: "group_id", In: "query", Description: "Working group, defaults to the first group"}},
+		Response: watchState{},
+	},
+	{
+		Method:  "get",
+		Path:    "/api/v1/mappings",
+		Summary: "External IDs of groups, rounds and tags in other systems, such as Toggl projects or Jira issues",
+		Scope:   scopeRead,
+		Params: []apiParam{
+			{Name: "system", In: "query", Description: "e.g. toggl", Type: "string"},
+			{Name: "entity", In: "query", Description: "group, round or tag", Type: "string"},
+			{Name: "external_id", In: "query", Description: "The ID in the other system", Type: "string"},
+			{Name: "local_id", In: "query", Description: "The group, round or tag"},
+		},
+		Response: []ExternalMapping{},
+	},
+	{
+		Method:      "put",
+		Path:        "/api/v1/mappings",
+		Summary:     "Map an external ID to a group, round or tag, replacing its previous mapping",
+		Scope:       scopeControl,
+		RequestBody: externalMappingRequest{},
+		Response:    ExternalMapping{},
+	},
+	{
+		Method:  "delete",
+		Path:    "/api/v1/mappings/{id}",
+		Summary: "Remove a mapping; the group, round or tag stays",
+		Scope:   scopeControl,
+		Params:  []apiParam{{Name: "id", In: "path", Required: true}},
+	},
+	{
+		Method:  "post",
+		Path:    "/api/v1/import/preview",
+		Summary: "Stage a CSV or XLSX file of rounds and preview its import: recognized columns, groups, first rows and problems",
+		Scope:   scopeControl,
+		Params: []apiParam{
+			{Name: "group_id", In: "query", Description: "Group of rows no working group matches, defaults to the first group"},
+			{Name: "rows", In: "query", Description: "Rows to list, 20 by default and 200 at most"},
+		},
+		Upload:   "file",
+		Response: importPreview{},
+	},
+	{
+		Method:      "post",
+		Path:        "/api/v1/import/confirm",
+		Summary:     "Import a previewed file by its token, skipping duplicates and invalid rows; the token is used up",
+		Scope:       scopeControl,
+		RequestBody: importConfirmRequest{},
+		Response:    importConfirmResponse{},
+	},
+	{
+		Method:   "get",
+		Path:     "/api/v1/sync",
+		Summary:  "Groups, rounds and deletions changed since a cursor, for instance sync",
+		Scope:    scopeRead,
+		Params:   []apiParam{{Name: "since", In: "query", Description: "The until value of the previous batch (RFC 3339); omit for everything", Type: "string"}},
+		Response: syncBatch{},
+	},
+	{
+		Method:      "post",
+		Path:        "/api/v1/sync",
+		Summary:     "Apply a batch from another instance, newer versions win",
+		Scope:       scopeControl,
+		RequestBody: syncBatch{},
+		Response:    syncResult{},
+	},
+	{
+		Method:  "get",
+		Path:    "/api/v1/changes",
+		Summary: "Created, updated and deleted groups and rounds in the order they changed",
+		Scope:   scopeRead,
+		Params: []apiParam{
+			{Name: "since", In: "query", Description: "The next value of the previous page; omit to start at the beginning", Type: "string"},
+			{Name: "limit", In: "query", Description: "Changes per page, 1 to 1000 (default 100)"},
+		},
+		Response: changesResponse{},
+	},
+	{
+		Method:      "post",
+		Path:        "/api/v1/action-links",
+		Summary:     "Create a signed single-use action link",
+		Scope:       scopeControl,
+		RequestBody: actionLinkRequest{},
+		Response:    actionLinkResponse{},
+	},
+}
+
+// openAPIBuilder collects component schemas while walking Go types
+type openAPIBuilder struct {
+	schemas map[string]interface{}
+}
+
+func (b *openAPIBuilder) schemaFor(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := b.schemaFor(t.Elem())
+		if _, isRef := schema["$ref"]; isRef {
+			return map[string]interface{}{"allOf": []interface{}{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": b.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schemaFor(t.Elem())}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Struct:
+		if t == reflect.TypeOf(time.Time{}) {
+			return map[string]interface{}{"type": "string", "format": "date-time"}
+		}
+		return b.structRef(t)
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// structRef registers a struct as a component schema and returns a reference to it
+func (b *openAPIBuilder) structRef(t reflect.Type) map[string]interface{} {
+	name := t.Name()
+	ref := map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	if _, seen := b.schemas[name]; seen {
+		return ref
+	}
+	// Reserve the name first so self-referencing types terminate
+	b.schemas[name] = nil
+
+	properties := map[string]interface{}{}
+	var required []string
+	// Visible fields include those promoted from embedded structs, which encoding/json flattens the same way
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || (field.Anonymous && field.Tag.Get("json") == "") {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = b.schemaFor(field.Type)
+		if field.Type.Kind() != reflect.Ptr && !strings.Contains(options, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	b.schemas[t.Name()] = schema
+	return ref
+}
+
+func buildOpenAPISpec() map[string]interface{} {
+	b := &openAPIBuilder{schemas: map[string]interface{}{}}
+	errorSchema := b.schemaFor(reflect.TypeOf(apiError{}))
+
+	paths := map[string]interface{}{}
+	for _, op := range apiOperations {
+		responses := map[string]interface{}{
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": errorSchema},
+				},
+			},
+		}
+		if op.Response != nil {
+			responses["200"] = map[string]interface{}{
+				"description": "OK",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": b.schemaFor(reflect.TypeOf(op.Response))},
+				},
+			}
+		} else {
+			responses["204"] = map[string]interface{}{"description": "No Content"}
+		}
+		operation := map[string]interface{}{
+			"summary":     op.Summary,
+			"description": "Requires a token with the '" + op.Scope + "' scope.",
+			"responses":   responses,
+		}
+		if len(op.Params) > 0 {
+			var params []interface{}
+			for _, p := range op.Params {
+				paramType := p.Type
+				if paramType == "" {
+					paramType = "integer"
+				}
+				params = append(params, map[string]interface{}{
+					"name":        p.Name,
+					"in":          p.In,
+					"description": p.Description,
+					"required":    p.Required,
+					"schema":      map[string]interface{}{"type": paramType},
+				})
+			}
+			operation["parameters"] = params
+		}
+		if op.RequestBody != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": b.schemaFor(reflect.TypeOf(op.RequestBody))},
+				},
+			}
+		}
+		if op.Upload != "" {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"multipart/form-data": map[string]interface{}{"schema": map[string]interface{}{
+						"type":       "object",
+						"required":   []string{op.Upload},
+						"properties": map[string]interface{}{op.Upload: map[string]interface{}{"type": "string", "format": "binary"}},
+					}},
+				},
+			}
+		}
+
+		item, _ := paths[op.Path].(map[string]interface{})
+		if item == nil {
+			item = map[string]interface{}{}
+			paths[op.Path] = item
+		}
+		item[op.Method] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Hours Tracker API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": b.schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []interface{}{map[string]interface{}{"bearerAuth": []string{}}},
+		"servers":  []interface{}{map[string]interface{}{"url": cfg.BasePath + "/"}},
+	}
+}
+
+var (
+	openAPISpec     map[string]interface{}
+	openAPISpecOnce sync.Once
+)
+
+func serveOpenAPISpec(c *fiber.Ctx) error {
+	openAPISpecOnce.Do(func() {
+		openAPISpec = buildOpenAPISpec()
+	})
+	return c.JSON(openAPISpec)
+}
+
+func renderAPIDocs(c *fiber.Ctx) error {
+	return c.Render("apidocs", fiber.Map{})
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// overheadTrendQuarters is how many quarters the overhead page compares, ending with the one shown
+const overheadTrendQuarters = 4
+
+// overheadGroup is the time tracked for one group in a quarter
+type overheadGroup struct {
+	GroupID  uint    `json:"group_id"`
+	Name     string  `json:"name"`
+	Internal bool    `json:"internal"`
+	Seconds  int64   `json:"seconds"`
+	Share    float64 `json:"share_percent"` // Of all time tracked in the quarter
+}
+
+// overheadMonth is the internal and client-facing time of one month of a quarter
+type overheadMonth struct {
+	Month           string  `json:"month"` // YYYY-MM
+	InternalSeconds int64   `json:"internal_seconds"`
+	ExternalSeconds int64   `json:"external_seconds"`
+	OverheadPercent float64 `json:"overhead_percent"`
+}
+
+// overheadReport splits a quarter's time into internal work and work for clients. The overhead percentage is the
+// internal share of all tracked time.
+type overheadReport struct {
+	Quarter         string          `json:"quarter"` // e.g. 2025-Q1
+	From            string          `json:"from"`    // First day, YYYY-MM-DD
+	To              string          `json:"to"`      // Last day, YYYY-MM-DD
+	InternalSeconds int64           `json:"internal_seconds"`
+	ExternalSeconds int64           `json:"external_seconds"`
+	OverheadPercent float64         `json:"overhead_percent"`
+	Months          []overheadMonth `json:"months"`
+	Groups          []overheadGroup `json:"groups"` // Groups with time in the quarter, most time first
+}
+
+// quarterStart is the first day of the quarter containing t
+func quarterStart(t time.Time) time.Time {
+	t = t.In(time.Local)
+	month := time.Month((int(t.Month())-1)/3*3 + 1)
+	return time.Date(t.Year(), month, 1, 0, 0, 0, 0, time.Local)
+}
+
+// quarterLabel names the quarter starting at start, e.g. "2025-Q1"
+func quarterLabel(start time.Time) string {
+	return fmt.Sprintf("%d-Q%d", start.Year(), (int(start.Month())-1)/3+1)
+}
+
+// parseQuarter reads a quarter like "2025-Q1"; empty means the current quarter
+func parseQuarter(value string) (time.Time, error) {
+	if value == "" {
+		return quarterStart(time.Now()), nil
+	}
+	var year, quarter int
+	if _, err := fmt.Sscanf(value, "%d-Q%d", &year, &quarter); err != nil || quarter < 1 || quarter > 4 || year < 1 {
+		return time.Time{}, errors.New("quarter must look like 2025-Q1")
+	}
+	start := time.Date(year, time.Month((quarter-1)*3+1), 1, 0, 0, 0, 0, time.Local)
+	// Sscanf stops at the second number, so "2025-Q1x" would pass without this
+	if quarterLabel(start) != value {
+		return time.Time{}, errors.New("quarter must look like 2025-Q1")
+	}
+	return start, nil
+}
+
+// overheadPercent is internal of internal+external as a percentage with one decimal, 0 when nothing was tracked
+func overheadPercent(internal, external int64) float64 {
+	if internal+external == 0 {
+		return 0
+	}
+	return math.Round(float64(internal)*1000/float64(internal+external)) / 10
+}
+
+// buildOverheadReport sums the user's rounds started in the quarter beginning at start by group and month. Running
+// rounds count up to now.
+func buildOverheadReport(userID uint, start time.Time) (overheadReport, error) {
+	end := start.AddDate(0, 3, 0)
+	report := overheadReport{
+		Quarter: quarterLabel(start),
+		From:    start.Format("2006-01-02"),
+		To:      end.AddDate(0, 0, -1).Format("2006-01-02"),
+		Groups:  []overheadGroup{},
+	}
+
+	groups, err := getWorkingGroupsOrdered(userID)
+	if err != nil {
+		return report, err
+	}
+	var rounds []Round
+	if err := db.Scopes(userRounds(userID)).
+		Where("start_time >= ? AND start_time < ?", start, end).
+		Find(&rounds).Error; err != nil {
+		return report, err
+	}
+
+	now := time.Now()
+	seconds := make(map[uint]int64)
+	months := make(map[string]*overheadMonth)
+	report.Months = make([]overheadMonth, 3)
+	for i := range report.Months {
+		report.Months[i].Month = start.AddDate(0, i, 0).Format("2006-01")
+		months[report.Months[i].Month] = &report.Months[i]
+	}
+	internal := make(map[uint]bool)
+	for _, group := range groups {
+		internal[group.ID] = group.Internal
+	}
+	for _, round := range rounds {
+		duration := roundWorkedSeconds(round, now)
+		seconds[round.WorkingGroupID] += duration
+		month := months[round.StartTime.In(time.Local).Format("2006-01")]
+		if internal[round.WorkingGroupID] {
+			month.InternalSeconds += duration
+			report.InternalSeconds += duration
+		} else {
+			month.ExternalSeconds += duration
+			report.ExternalSeconds += duration
+		}
+	}
+	for i := range report.Months {
+		report.Months[i].OverheadPercent = overheadPercent(report.Months[i].InternalSeconds, report.Months[i].ExternalSeconds)
+	}
+	report.OverheadPercent = overheadPercent(report.InternalSeconds, report.ExternalSeconds)
+
+	total := report.InternalSeconds + report.ExternalSeconds
+	for _, group := range groups {
+		if seconds[group.ID] == 0 {
+			continue
+		}
+		report.Groups = append(report.Groups, overheadGroup{
+			GroupID:  group.ID,
+			Name:     group.Name,
+			Internal: group.Internal,
+			Seconds:  seconds[group.ID],
+			Share:    math.Round(float64(seconds[group.ID])*1000/float64(total)) / 10,
+		})
+	}
+	sort.SliceStable(report.Groups, func(i, j int) bool { return report.Groups[i].Seconds > report.Groups[j].Seconds })
+	return report, nil
+}
+
+// renderOverheadReport shows the internal-overhead percentage of a quarter with its months and groups, and how it
+// compares to the quarters before
+func renderOverheadReport(c *fiber.Ctx) error {
+	start, err := parseQuarter(c.Query("quarter"))
+	if err != nil {
+		return c.Status(400).SendString(err.Error())
+	}
+	userID := currentUserID(c)
+	report, err := buildOverheadReport(userID, start)
+	if err != nil {
+		requestLog(c).Println("Error building overhead report:", err)
+		return c.Status(500).SendString("Error loading overhead report")
+	}
+
+	var months []fiber.Map
+	for _, month := range report.Months {
+		date, _ := time.ParseInLocation("2006-01", month.Month, time.Local)
+		months = append(months, fiber.Map{
+			"Label":    date.Format("January 2006"),
+			"Internal": formatDuration(month.InternalSeconds),
+			"External": formatDuration(month.ExternalSeconds),
+			"Percent":  fmt.Sprintf("%.1f%%", month.OverheadPercent),
+			"Tracked":  month.InternalSeconds+month.ExternalSeconds > 0,
+		})
+	}
+	var groups []fiber.Map
+	for _, group := range report.Groups {
+		groups = append(groups, fiber.Map{
+			"ID":       group.GroupID,
+			"Name":     group.Name,
+			"Internal": group.Internal,
+			"Total":    formatDuration(group.Seconds),
+			"Share":    fmt.Sprintf("%.1f%%", group.Share),
+		})
+	}
+	var trend []fiber.Map
+	for i := overheadTrendQuarters - 1; i >= 0; i-- {
+		quarter := start.AddDate(0, -3*i, 0)
+		past := report
+		if i > 0 {
+			if past, err = buildOverheadReport(userID, quarter); err != nil {
+				requestLog(c).Println("Error building overhead report:", err)
+				return c.Status(500).SendString("Error loading overhead report")
+			}
+		}
+		trend = append(trend, fiber.Map{
+			"Quarter":  past.Quarter,
+			"Internal": formatDuration(past.InternalSeconds),
+			"External": formatDuration(past.ExternalSeconds),
+			"Percent":  fmt.Sprintf("%.1f%%", past.OverheadPercent),
+			"Tracked":  past.InternalSeconds+past.ExternalSeconds > 0,
+			"Current":  i == 0,
+		})
+	}
+
+	return c.Render("overhead", fiber.Map{
+		"Quarter":     report.Quarter,
+		"Period":      start.Format("Jan 2") + " – " + start.AddDate(0, 3, -1).Format("Jan 2, 2006"),
+		"PrevQuarter": quarterLabel(start.AddDate(0, -3, 0)),
+		"NextQuarter": quarterLabel(start.AddDate(0, 3, 0)),
+		"Internal":    formatDuration(report.InternalSeconds),
+		"External":    formatDuration(report.ExternalSeconds),
+		"Percent":     fmt.Sprintf("%.1f%%", report.OverheadPercent),
+		"Tracked":     report.InternalSeconds+report.ExternalSeconds > 0,
+		"Months":      months,
+		"Groups":      groups,
+		"Trend":       trend,
+		"Can":         permissionsView(c),
+	})
+}
+
+// apiOverheadReport serves GET /api/v1/reports/overhead?quarter=2025-Q1
+func apiOverheadReport(c *fiber.Ctx) error {
+	start, err := parseQuarter(c.Query("quarter"))
+	if err != nil {
+		return c.Status(400).JSON(apiError{err.Error()})
+	}
+	report, err := buildOverheadReport(currentUserID(c), start)
+	if err != nil {
+		requestLog(c).Println("Error building overhead report:", err)
+		return c.Status(500).JSON(apiError{"error building overhead report"})
+	}
+	return c.JSON(report)
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Whether a round added by hand or edited may overlap the user's rounds of other groups, WorkingGroup.OverlapPolicy.
+// Where two groups disagree, the stricter policy applies. Rounds of one group never overlap, whatever the policy.
+const (
+	overlapAllow  = "allow"  // Concurrent rounds are fine, e.g. a call for one client while a build runs for another
+	overlapWarn   = "warn"   // Saved, with the rounds it overlaps listed on its page and in Round.Overlaps
+	overlapReject = "reject" // Refused with errOverlapRejected
+)
+
+// overlapPolicies are the policies in order of strictness, with their labels for the group form
+var overlapPolicies = []struct{ Value, Label string }{
+	{overlapAllow, "Allow overlaps"},
+	{overlapWarn, "Warn on overlaps"},
+	{overlapReject, "Reject overlaps"},
+}
+
+var errOverlapRejected = errors.New("round overlaps a round of another working group")
+
+// overlapReportMaxDays is the longest period the overlap report covers
+const overlapReportMaxDays = 366
+
+// parseOverlapPolicy reads the overlap policy of the group form; empty allows overlaps
+func parseOverlapPolicy(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return overlapAllow, nil
+	}
+	for _, policy := range overlapPolicies {
+		if policy.Value == value {
+			return value, nil
+		}
+	}
+	return "", errors.New("must be allow, warn or reject")
+}
+
+// overlapStrictness ranks a policy, an unknown one as allow
+func overlapStrictness(policy string) int {
+	for i, known := range overlapPolicies {
+		if known.Value == policy {
+			return i
+		}
+	}
+	return 0
+}
+
+// stricterOverlapPolicy is the stricter of two groups' policies
+func stricterOverlapPolicy(a, b string) string {
+	if overlapStrictness(b) > overlapStrictness(a) {
+		return b
+	}
+	if a == "" {
+		return overlapAllow
+	}
+	return a
+}
+
+// overlapPolicyOptions lists the policies for the group form with selected chosen
+func overlapPolicyOptions(selected string) []fiber.Map {
+	options := make([]fiber.Map, len(overlapPolicies))
+	for i, policy := range overlapPolicies {
+		options[i] = fiber.Map{"Value": policy.Value, "Label": policy.Label, "Selected": policy.Value == selected}
+	}
+	return options
+}
+
+// roundOverlap is a round of another group that a round overlaps, with the policy that applies to the two
+type roundOverlap struct {
+	Round  Round
+	Policy string
+}
+
+// findOverlaps lists the user's rounds of other groups that overlap round in group, running rounds up to now
+func findOverlaps(tx *gorm.DB, userID uint, round Round, group WorkingGroup) ([]roundOverlap, error) {
+	end := time.Now()
+	if round.EndTime != nil {
+		end = *round.EndTime
+	}
+	var others []Round
+	if err := tx.Preload("WorkingGroup").Scopes(userRounds(userID)).
+		Where("working_group_id <> ? AND id <> ? AND start_time < ? AND (end_time IS NULL OR end_time > ?)",
+			group.ID, round.ID, end, round.StartTime).
+		Order("start_time ASC").Find(&others).Error; err != nil {
+		return nil, err
+	}
+	overlaps := make([]roundOverlap, len(others))
+	for i, other := range others {
+		overlaps[i] = roundOverlap{Round: other, Policy: stricterOverlapPolicy(group.OverlapPolicy, other.WorkingGroup.OverlapPolicy)}
+	}
+	return overlaps, nil
+}
+
+// checkOverlapPolicy applies the overlap policies to a round about to be saved in group: it returns
+// errOverlapRejected naming the first round it may not overlap, else the rounds it overlaps with a warning
+func checkOverlapPolicy(tx *gorm.DB, userID uint, round Round, group WorkingGroup) ([]Round, error) {
+	overlaps, err := findOverlaps(tx, userID, round, group)
+	if err != nil {
+		return nil, err
+	}
+	var warned []Round
+	for _, overlap := range overlaps {
+		switch overlap.Policy {
+		case overlapReject:
+			other := overlap.Round
+			return nil, fmt.Errorf("%w: #%d of '%s', %s", errOverlapRejected, other.ID, other.WorkingGroup.Name,
+				roundSpan(other.StartTime, other.EndTime))
+		case overlapWarn:
+			warned = append(warned, overlap.Round)
+		}
+	}
+	return warned, nil
+}
+
+// overlapIDs are the IDs of rounds, for Round.Overlaps
+func overlapIDs(rounds []Round) []uint {
+	var ids []uint
+	for _, round := range rounds {
+		ids = append(ids, round.ID)
+	}
+	return ids
+}
+
+// overlapDetails is added to audit details of a round saved with overlap warnings, e.g. ", overlapping #12 of 'Meetings'"
+func overlapDetails(rounds []Round) string {
+	if len(rounds) == 0 {
+		return ""
+	}
+	names := make([]string, len(rounds))
+	for i, round := range rounds {
+		names[i] = fmt.Sprintf("#%d of '%s'", round.ID, round.WorkingGroup.Name)
+	}
+	return ", overlapping " + strings.Join(names, ", ")
+}
+
+// overlapViews lists the overlaps a round page warns about, those that aren't allowed
+func overlapViews(overlaps []roundOverlap) []fiber.Map {
+	var views []fiber.Map
+	for _, overlap := range overlaps {
+		if overlap.Policy == overlapAllow {
+			continue
+		}
+		views = append(views, fiber.Map{
+			"ID":        overlap.Round.ID,
+			"GroupID":   overlap.Round.WorkingGroupID,
+			"GroupName": overlap.Round.WorkingGroup.Name,
+			"Span":      roundSpan(overlap.Round.StartTime, overlap.Round.EndTime),
+			"Rejected":  overlap.Policy == overlapReject,
+		})
+	}
+	return views
+}
+
+// overlapRound is one of the two rounds of an overlap in the report
+type overlapRound struct {
+	ID        uint       `json:"id"`
+	GroupID   uint       `json:"working_group_id"`
+	GroupName string     `json:"working_group"`
+	StartTime time.Time  `json:"start_time"`
+	EndTime   *time.Time `json:"end_time"` // null while running
+}
+
+// overlapPair is two rounds that ran at the same time
+type overlapPair struct {
+	First     overlapRound `json:"first"`  // The one that started first
+	Second    overlapRound `json:"second"` // The one that started during it
+	Start     time.Time    `json:"start"`
+	End       time.Time    `json:"end"`
+	Seconds   int64        `json:"seconds"`
+	SameGroup bool         `json:"same_group"`       // Both in one group, counting the time twice in its totals
+	Policy    string       `json:"policy,omitempty"` // Stricter overlap policy of the two groups; empty within one group
+}
+
+// overlapGroupPair sums the overlaps between two groups, or within one
+type overlapGroupPair struct {
+	FirstGroupID    uint   `json:"first_group_id"`
+	FirstGroupName  string `json:"first_group"`
+	SecondGroupID   uint   `json:"second_group_id"`
+	SecondGroupName string `json:"second_group"`
+	Count           int    `json:"count"`
+	Seconds         int64  `json:"seconds"`
+}
+
+// overlapReport lists the user's rounds that ran at the same time within a period
+type overlapReport struct {
+	From       string             `json:"from"` // First day, YYYY-MM-DD
+	To         string             `json:"to"`   // Last day, YYYY-MM-DD
+	Count      int                `json:"count"`
+	Seconds    int64              `json:"seconds"`     // Sum of the pairs' overlapping time
+	GroupPairs []overlapGroupPair `json:"group_pairs"` // Most overlapping time first
+	Pairs      []overlapPair      `json:"pairs"`       // In the order they started
+}
+
+// parseOverlapPeriod reads the from and to days of the overlap report, the last 30 days by default
+func parseOverlapPeriod(c *fiber.Ctx) (time.Time, time.Time, error) {
+	today := time.Now().In(time.Local)
+	to := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.Local)
+	if value := c.Query("to"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("to must be a date like 2025-03-31")
+		}
+		to = parsed
+	}
+	from := to.AddDate(0, 0, -29)
+	if value := c.Query("from"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("from must be a date like 2025-03-01")
+		}
+		from = parsed
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, errors.New("to cannot be before from")
+	}
+	if from.AddDate(0, 0, overlapReportMaxDays-1).Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("the period can be at most %d days", overlapReportMaxDays)
+	}
+	return from, to, nil
+}
+
+// buildOverlapReport finds the user's rounds that overlap each other within the days from and to, within a group as
+// well as across groups. Overlaps are cut to the period, and running rounds count up to now.
+func buildOverlapReport(userID uint, from, to time.Time) (overlapReport, error) {
+	periodEnd := to.AddDate(0, 0, 1)
+	report := overlapReport{
+		From:       from.Format("2006-01-02"),
+		To:         to.Format("2006-01-02"),
+		GroupPairs: []overlapGroupPair{},
+		Pairs:      []overlapPair{},
+	}
+	var rounds []Round
+	if err := db.Preload("WorkingGroup").Scopes(userRounds(userID)).
+		Where("start_time < ? AND (end_time IS NULL OR end_time > ?)", periodEnd, from).
+		Order("start_time ASC, id ASC").Find(&rounds).Error; err != nil {
+		return report, err
+	}
+
+	now := time.Now()
+	roundEnd := func(round Round) time.Time {
+		if round.EndTime != nil {
+			return *round.EndTime
+		}
+		return now
+	}
+	sums := make(map[[2]uint]*overlapGroupPair)
+	for i, first := range rounds {
+		firstEnd := roundEnd(first)
+		// Sorted by start, so the rounds overlapping this one are those right after it that start before it ends
+		for _, second := range rounds[i+1:] {
+			if !second.StartTime.Before(firstEnd) {
+				break
+			}
+			start, end := second.StartTime, roundEnd(second)
+			if firstEnd.Before(end) {
+				end = firstEnd
+			}
+			if start.Before(from) {
+				start = from
+			}
+			if end.After(periodEnd) {
+				end = periodEnd
+			}
+			if !end.After(start) {
+				continue
+			}
+			pair := overlapPair{
+				First:     overlapReportRound(first),
+				Second:    overlapReportRound(second),
+				Start:     start,
+				End:       end,
+				Seconds:   int64(end.Sub(start).Seconds()),
+				SameGroup: first.WorkingGroupID == second.WorkingGroupID,
+			}
+			if !pair.SameGroup {
+				pair.Policy = stricterOverlapPolicy(first.WorkingGroup.OverlapPolicy, second.WorkingGroup.OverlapPolicy)
+			}
+			report.Pairs = append(report.Pairs, pair)
+			report.Count++
+			report.Seconds += pair.Seconds
+
+			// Each pair of groups once, whichever of the two started first
+			a, b := first.WorkingGroup, second.WorkingGroup
+			if a.Name > b.Name || (a.Name == b.Name && a.ID > b.ID) {
+				a, b = b, a
+			}
+			sum, ok := sums[[2]uint{a.ID, b.ID}]
+			if !ok {
+				sum = &overlapGroupPair{FirstGroupID: a.ID, FirstGroupName: a.Name, SecondGroupID: b.ID, SecondGroupName: b.Name}
+				sums[[2]uint{a.ID, b.ID}] = sum
+			}
+			sum.Count++
+			sum.Seconds += pair.Seconds
+		}
+	}
+	for _, sum := range sums {
+		report.GroupPairs = append(report.GroupPairs, *sum)
+	}
+	sort.Slice(report.GroupPairs, func(i, j int) bool {
+		x, y := report.GroupPairs[i], report.GroupPairs[j]
+		if x.Seconds != y.Seconds {
+			return x.Seconds > y.Seconds
+		}
+		if x.FirstGroupName != y.FirstGroupName {
+			return x.FirstGroupName < y.FirstGroupName
+		}
+		return x.SecondGroupName < y.SecondGroupName
+	})
+	return report, nil
+}
+
+func overlapReportRound(round Round) overlapRound {
+	return overlapRound{
+		ID:        round.ID,
+		GroupID:   round.WorkingGroupID,
+		GroupName: round.WorkingGroup.Name,
+		StartTime: round.StartTime,
+		EndTime:   round.EndTime,
+	}
+}
+
+// renderOverlapReport shows the rounds that ran at the same time within a period, by pair of groups and one by one
+func renderOverlapReport(c *fiber.Ctx) error {
+	from, to, err := parseOverlapPeriod(c)
+	if err != nil {
+		return c.Status(400).SendString(err.Error())
+	}
+	report, err := buildOverlapReport(currentUserID(c), from, to)
+	if err != nil {
+		requestLog(c).Println("Error building overlap report:", err)
+		return c.Status(500).SendString("Error loading overlap report")
+	}
+
+	var groupPairs []fiber.Map
+	for _, sum := range report.GroupPairs {
+		groupPairs = append(groupPairs, fiber.Map{
+			"FirstID":    sum.FirstGroupID,
+			"FirstName":  sum.FirstGroupName,
+			"SecondID":   sum.SecondGroupID,
+			"SecondName": sum.SecondGroupName,
+			"SameGroup":  sum.FirstGroupID == sum.SecondGroupID,
+			"Count":      sum.Count,
+			"Total":      formatDuration(sum.Seconds),
+		})
+	}
+	var pairs []fiber.Map
+	for _, pair := range report.Pairs {
+		pairs = append(pairs, fiber.Map{
+			"First":     pair.First,
+			"Second":    pair.Second,
+			"Span":      roundSpan(pair.Start, &pair.End),
+			"Total":     formatDuration(pair.Seconds),
+			"SameGroup": pair.SameGroup,
+			"Warned":    pair.Policy == overlapWarn,
+			"Rejected":  pair.Policy == overlapReject,
+		})
+	}
+
+	return c.Render("overlaps", fiber.Map{
+		"From":       report.From,
+		"To":         report.To,
+		"Count":      report.Count,
+		"Total":      formatDuration(report.Seconds),
+		"GroupPairs": groupPairs,
+		"Pairs":      pairs,
+		"Can":        permissionsView(c),
+	})
+}
+
+// apiOverlapReport serves GET /api/v1/reports/overlaps?from=2025-03-01&to=2025-03-31
+func apiOverlapReport(c *fiber.Ctx) error {
+	from, to, err := parseOverlapPeriod(c)
+	if err != nil {
+		return c.Status(400).JSON(apiError{err.Error()})
+	}
+	report, err := buildOverlapReport(currentUserID(c), from, to)
+	if err != nil {
+		requestLog(c).Println("Error building overlap report:", err)
+		return c.Status(500).JSON(apiError{"error building overlap report"})
+	}
+	return c.JSON(report)
+}
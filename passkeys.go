@@ -0,0 +1,364 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	webAuthnCookieName   = "hours_webauthn"
+	webAuthnChallengeTTL = 5 * time.Minute
+)
+
+// PasskeyCredential is a WebAuthn public key registered by a user
+type PasskeyCredential struct {
+	ID           uint   `gorm:"primaryKey"`
+	UserID       uint   `gorm:"index;not null"`
+	Name         string // Label chosen by the user, e.g. "Laptop"
+	CredentialID string `gorm:"uniqueIndex;size:191;not null"` // base64url
+	Credential   string `gorm:"not null"`                      // JSON of webauthn.Credential (public key, sign count, flags)
+	LastUsedAt   *time.Time
+	CreatedAt    time.Time
+}
+
+// WebAuthnChallenge keeps the server side of a registration or login ceremony until it is finished
+type WebAuthnChallenge struct {
+	ID        uint   `gorm:"primaryKey"`
+	Token     string `gorm:"uniqueIndex;size:191;not null"` // Random value stored in the browser's cookie
+	UserID    uint   // Registering user, 0 for logins
+	Ceremony  string `gorm:"not null"` // "register" or "login"
+	Session   string `gorm:"not null"` // JSON of webauthn.SessionData
+	ExpiresAt time.Time
+}
+
+// webAuthnUser adapts a User and its passkeys to the webauthn library
+type webAuthnUser struct {
+	user        User
+	credentials []webauthn.Credential
+}
+
+func (u webAuthnUser) WebAuthnID() []byte                         { return webAuthnUserHandle(u.user.ID) }
+func (u webAuthnUser) WebAuthnName() string                       { return u.user.Username }
+func (u webAuthnUser) WebAuthnDisplayName() string                { return u.user.Username }
+func (u webAuthnUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+
+func webAuthnUserHandle(userID uint) []byte {
+	handle := make([]byte, 8)
+	binary.BigEndian.PutUint64(handle, uint64(userID))
+	return handle
+}
+
+func loadWebAuthnUser(user User) (webAuthnUser, []PasskeyCredential, error) {
+	var passkeys []PasskeyCredential
+	if err := db.Where("user_id = ?", user.ID).Order("created_at ASC").Find(&passkeys).Error; err != nil {
+		return webAuthnUser{}, nil, err
+	}
+	wu := webAuthnUser{user: user}
+	for _, passkey := range passkeys {
+		var credential webauthn.Credential
+		if err := json.Unmarshal([]byte(passkey.Credential), &credential); err != nil {
+			return webAuthnUser{}, nil, err
+		}
+		wu.credentials = append(wu.credentials, credential)
+	}
+	return wu, passkeys, nil
+}
+
+// webAuthnFor configures the relying party from the configured RP ID and origins, falling back to the request host
+func webAuthnFor(c *fiber.Ctx) (*webauthn.WebAuthn, error) {
+	rpID := cfg.Auth.WebAuthn.RPID
+	if rpID == "" {
+		rpID = c.Hostname()
+		if i := strings.LastIndex(rpID, ":"); i > 0 && !strings.HasSuffix(rpID, "]") {
+			rpID = rpID[:i]
+		}
+	}
+	origins := []string{c.BaseURL()}
+	if len(cfg.Auth.WebAuthn.Origins) > 0 {
+		origins = cfg.Auth.WebAuthn.Origins
+	}
+	return webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: "Hours Tracker",
+		RPOrigins:     origins,
+	})
+}
+
+// saveChallenge stores the ceremony session server side and hands the browser only an opaque token
+func saveChallenge(c *fiber.Ctx, ceremony string, userID uint, session *webauthn.SessionData) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	token, err := randomString()
+	if err != nil {
+		return err
+	}
+	db.Where("expires_at < ?", time.Now()).Delete(&WebAuthnChallenge{})
+	challenge := WebAuthnChallenge{
+		Token:     token,
+		UserID:    userID,
+		Ceremony:  ceremony,
+		Session:   string(data),
+		ExpiresAt: time.Now().Add(webAuthnChallengeTTL),
+	}
+	if err := db.Create(&challenge).Error; err != nil {
+		return err
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     webAuthnCookieName,
+		Value:    token,
+		Expires:  challenge.ExpiresAt,
+		HTTPOnly: true,
+		SameSite: "Strict",
+		Secure:   c.Protocol() == "https",
+	})
+	return nil
+}
+
+// takeChallenge loads and deletes the ceremony session, so every challenge is answered at most once
+func takeChallenge(c *fiber.Ctx, ceremony string, userID uint) (webauthn.SessionData, error) {
+	var session webauthn.SessionData
+	var challenge WebAuthnChallenge
+	err := db.Where("token = ? AND ceremony = ? AND user_id = ?", c.Cookies(webAuthnCookieName), ceremony, userID).
+		First(&challenge).Error
+	c.ClearCookie(webAuthnCookieName)
+	if err != nil {
+		return session, errors.New("no passkey ceremony in progress")
+	}
+	db.Delete(&challenge)
+	if time.Now().After(challenge.ExpiresAt) {
+		return session, errors.New("the passkey request has expired, please try again")
+	}
+	err = json.Unmarshal([]byte(challenge.Session), &session)
+	return session, err
+}
+
+func beginPasskeyRegistration(c *fiber.Ctx) error {
+	wa, err := webAuthnFor(c)
+	if err != nil {
+		requestLog(c).Println("Error configuring WebAuthn:", err)
+		return c.Status(500).JSON(apiError{"passkeys are not available"})
+	}
+	wu, _, err := loadWebAuthnUser(*currentUser(c))
+	if err != nil {
+		requestLog(c).Println("Error loading passkeys:", err)
+		return c.Status(500).JSON(apiError{"error loading passkeys"})
+	}
+
+	var exclusions []protocol.CredentialDescriptor
+	for _, credential := range wu.credentials {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+	options, session, err := wa.BeginRegistration(wu,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(exclusions))
+	if err != nil {
+		requestLog(c).Println("Error starting passkey registration:", err)
+		return c.Status(500).JSON(apiError{"error starting passkey registration"})
+	}
+	if err := saveChallenge(c, "register", wu.user.ID, session); err != nil {
+		requestLog(c).Println("Error storing passkey challenge:", err)
+		return c.Status(500).JSON(apiError{"error starting passkey registration"})
+	}
+	return c.JSON(options)
+}
+
+func finishPasskeyRegistration(c *fiber.Ctx) error {
+	user := currentUser(c)
+	session, err := takeChallenge(c, "register", user.ID)
+	if err != nil {
+		return c.Status(400).JSON(apiError{err.Error()})
+	}
+	wa, err := webAuthnFor(c)
+	if err != nil {
+		return c.Status(500).JSON(apiError{"passkeys are not available"})
+	}
+	wu, _, err := loadWebAuthnUser(*user)
+	if err != nil {
+		return c.Status(500).JSON(apiError{"error loading passkeys"})
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(c.Body())
+	if err != nil {
+		return c.Status(400).JSON(apiError{"invalid passkey response"})
+	}
+	credential, err := wa.CreateCredential(wu, session, parsed)
+	if err != nil {
+		requestLog(c).Println("Error verifying passkey registration:", err)
+		return c.Status(400).JSON(apiError{"passkey could not be verified"})
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return c.Status(500).JSON(apiError{"error saving passkey"})
+	}
+	name := strings.TrimSpace(c.Query("name"))
+	if name == "" {
+		name = "Passkey"
+	}
+	passkey := PasskeyCredential{
+		UserID:       user.ID,
+		Name:         truncateString(name, 64),
+		CredentialID: base64.RawURLEncoding.EncodeToString(credential.ID),
+		Credential:   string(data),
+	}
+	if err := db.Create(&passkey).Error; err != nil {
+		requestLog(c).Println("Error saving passkey:", err)
+		return c.Status(500).JSON(apiError{"error saving passkey"})
+	}
+	recordAudit("passkey.create", clientInfoFromRequest(c), 0, nil, fmt.Sprintf("Registered passkey '%s'", passkey.Name))
+
+	return c.JSON(fiber.Map{"id": passkey.ID, "name": passkey.Name})
+}
+
+func beginPasskeyLogin(c *fiber.Ctx) error {
+	wa, err := webAuthnFor(c)
+	if err != nil {
+		requestLog(c).Println("Error configuring WebAuthn:", err)
+		return c.Status(500).JSON(apiError{"passkeys are not available"})
+	}
+	options, session, err := wa.BeginDiscoverableLogin()
+	if err != nil {
+		requestLog(c).Println("Error starting passkey login:", err)
+		return c.Status(500).JSON(apiError{"error starting passkey login"})
+	}
+	if err := saveChallenge(c, "login", 0, session); err != nil {
+		requestLog(c).Println("Error storing passkey challenge:", err)
+		return c.Status(500).JSON(apiError{"error starting passkey login"})
+	}
+	return c.JSON(options)
+}
+
+func finishPasskeyLogin(c *fiber.Ctx) error {
+	session, err := takeChallenge(c, "login", 0)
+	if err != nil {
+		return c.Status(400).JSON(apiError{err.Error()})
+	}
+	wa, err := webAuthnFor(c)
+	if err != nil {
+		return c.Status(500).JSON(apiError{"passkeys are not available"})
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(c.Body())
+	if err != nil {
+		return c.Status(400).JSON(apiError{"invalid passkey response"})
+	}
+
+	var passkeys []PasskeyCredential
+	lookup := func(rawID, userHandle []byte) (webauthn.User, error) {
+		if len(userHandle) != 8 {
+			return nil, errors.New("unknown user handle")
+		}
+		var user User
+		if err := db.First(&user, binary.BigEndian.Uint64(userHandle)).Error; err != nil {
+			return nil, err
+		}
+		wu, list, err := loadWebAuthnUser(user)
+		passkeys = list
+		return wu, err
+	}
+	found, credential, err := wa.ValidatePasskeyLogin(lookup, session, parsed)
+	if err != nil {
+		requestLog(c).Println("Error verifying passkey login:", err)
+		return c.Status(401).JSON(apiError{"passkey sign-in failed"})
+	}
+	if credential.Authenticator.CloneWarning {
+		requestLog(c).Println("Warning: passkey sign count went backwards, the authenticator may be cloned")
+	}
+
+	// Persist the new signature counter
+	credentialID := base64.RawURLEncoding.EncodeToString(credential.ID)
+	for _, passkey := range passkeys {
+		if passkey.CredentialID != credentialID {
+			continue
+		}
+		data, _ := json.Marshal(credential)
+		now := time.Now()
+		db.Model(&passkey).Updates(map[string]interface{}{"credential": string(data), "last_used_at": now})
+	}
+
+	user := found.(webAuthnUser).user
+	if err := startSession(c, user, c.Query("remember") != ""); err != nil {
+		requestLog(c).Println("Error creating session:", err)
+		return c.Status(500).JSON(apiError{"error signing in"})
+	}
+	return c.JSON(fiber.Map{"redirect": cfg.BasePath + "/"})
+}
+
+func deletePasskeyHandler(c *fiber.Ctx) error {
+	id, err := parseGroupID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid passkey")
+	}
+	user := currentUser(c)
+
+	var passkey PasskeyCredential
+	if err := db.Where("user_id = ?", user.ID).First(&passkey, id).Error; err != nil {
+		return c.Status(404).SendString("Passkey not found")
+	}
+	var remaining int64
+	db.Model(&PasskeyCredential{}).Where("user_id = ?", user.ID).Count(&remaining)
+	if remaining <= 1 && user.PasswordHash == "" && user.OIDCSubject == "" {
+		return c.Status(400).SendString("Cannot delete your only passkey while the account has no password")
+	}
+
+	if err := db.Delete(&passkey).Error; err != nil {
+		requestLog(c).Println("Error deleting passkey:", err)
+		return c.Status(500).SendString("Error deleting passkey")
+	}
+	recordAudit("passkey.delete", clientInfoFromRequest(c), 0, nil, fmt.Sprintf("Removed passkey '%s'", passkey.Name))
+
+	return c.Redirect("/users", fiber.StatusSeeOther)
+}
+
+// removePasswordHandler makes the account passwordless once it has a passkey
+func removePasswordHandler(c *fiber.Ctx) error {
+	user := currentUser(c)
+	if isSharedAuthUser(user) {
+		return c.Status(400).SendString("The password of this account is set by AUTH_PASS")
+	}
+	var passkeyCount int64
+	db.Model(&PasskeyCredential{}).Where("user_id = ?", user.ID).Count(&passkeyCount)
+	if passkeyCount == 0 {
+		return c.Status(400).SendString("Register a passkey before removing your password")
+	}
+
+	if err := db.Model(user).Update("password_hash", "").Error; err != nil {
+		requestLog(c).Println("Error removing password:", err)
+		return c.Status(500).SendString("Error removing password")
+	}
+	recordAudit("user.password", clientInfoFromRequest(c), 0, nil, "Removed password, passkeys only")
+
+	return c.Redirect("/users", fiber.StatusSeeOther)
+}
+
+func passkeyViews(userID uint) []fiber.Map {
+	var passkeys []PasskeyCredential
+	if err := db.Where("user_id = ?", userID).Order("created_at ASC").Find(&passkeys).Error; err != nil {
+		log.Println("Error fetching passkeys:", err)
+	}
+	var views []fiber.Map
+	for _, passkey := range passkeys {
+		lastUsed := "Never"
+		if passkey.LastUsedAt != nil {
+			lastUsed = passkey.LastUsedAt.Format("2006-01-02 15:04:05")
+		}
+		views = append(views, fiber.Map{
+			"ID":        passkey.ID,
+			"Name":      passkey.Name,
+			"CreatedAt": passkey.CreatedAt.Format("2006-01-02 15:04:05"),
+			"LastUsed":  lastUsed,
+		})
+	}
+	return views
+}
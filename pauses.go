@@ -0,0 +1,344 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var (
+	errRoundPaused    = errors.New("the running round is already paused")
+	errRoundNotPaused = errors.New("the running round is not paused")
+)
+
+// RoundPause is a break taken within a round, such as lunch, without stopping it. Round.PausedSeconds sums the
+// finished pauses of a round and Round.PausedAt is set while one is open, so totals can leave them out without
+// reading this table.
+type RoundPause struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	RoundID     uint       `gorm:"not null;index" json:"round_id"`
+	StartTime   time.Time  `gorm:"not null" json:"start_time"`
+	EndTime     *time.Time `json:"end_time"` // NULL while the round is paused
+	PausedBy    string     `gorm:"size:64" json:"paused_by"`
+	ContinuedBy string     `gorm:"size:64" json:"continued_by"` // Empty while paused, and for pauses ended by the stop
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// roundWorkedSeconds is how long a round counts in totals: from its start to its end, to the start of its pause
+// while paused, or to now while running, without the breaks taken in it
+func roundWorkedSeconds(round Round, now time.Time) int64 {
+	end := now
+	switch {
+	case round.EndTime != nil:
+		end = *round.EndTime
+	case round.PausedAt != nil:
+		end = *round.PausedAt
+	}
+	return max(int64(end.Sub(round.StartTime).Seconds())-round.PausedSeconds, 0)
+}
+
+// pauseSeconds is the length of a finished pause in whole seconds, like round durations
+func pauseSeconds(pause RoundPause) int64 {
+	if pause.EndTime == nil {
+		return 0
+	}
+	return int64(pause.EndTime.Sub(pause.StartTime).Seconds())
+}
+
+// pauseRound pauses the running round of one of the client user's groups until continueRound
+func pauseRound(groupID uint, client ClientInfo) (Round, error) {
+	group, err := findUserGroup(client.UserID, groupID)
+	if err != nil {
+		return Round{}, errGroupNotFound
+	}
+
+	now := time.Now()
+	var round Round
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("working_group_id = ? AND end_time IS NULL", groupID).Take(&round).Error; err != nil {
+			return errNoRoundRunning
+		}
+		// A pause from another device may have won meanwhile
+		result := tx.Model(&round).Where("paused_at IS NULL").Update("paused_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errRoundPaused
+		}
+		return tx.Create(&RoundPause{RoundID: round.ID, StartTime: now, PausedBy: client.Name}).Error
+	})
+	if errors.Is(err, errNoRoundRunning) || errors.Is(err, errRoundPaused) {
+		return Round{}, err
+	}
+	if err != nil {
+		log.Println("Error pausing round:", err)
+		return Round{}, err
+	}
+
+	log.Printf("Paused round #%d for group '%s' at %s (by %s)", round.ID, group.Name, now.Format("2006-01-02 15:04:05"), client.Name)
+	recordAudit("round.pause", client, groupID, &round.ID,
+		fmt.Sprintf("Paused round for '%s' after %s", group.Name, time.Duration(roundWorkedSeconds(round, now))*time.Second))
+	notifyRoundChange(groupID)
+	return round, nil
+}
+
+// continueRound ends the pause of the running round of one of the client user's groups
+func continueRound(groupID uint, client ClientInfo) (Round, error) {
+	group, err := findUserGroup(client.UserID, groupID)
+	if err != nil {
+		return Round{}, errGroupNotFound
+	}
+
+	now := time.Now()
+	var round Round
+	var pause RoundPause
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("working_group_id = ? AND end_time IS NULL", groupID).Take(&round).Error; err != nil {
+			return errNoRoundRunning
+		}
+		if round.PausedAt == nil {
+			return errRoundNotPaused
+		}
+		err := tx.Where("round_id = ? AND end_time IS NULL", round.ID).Order("start_time DESC").Take(&pause).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			pause = RoundPause{RoundID: round.ID, StartTime: *round.PausedAt}
+		} else if err != nil {
+			return err
+		}
+		pause.EndTime = &now
+		pause.ContinuedBy = client.Name
+		if err := tx.Save(&pause).Error; err != nil {
+			return err
+		}
+		result := tx.Model(&round).Where("paused_at IS NOT NULL").Updates(map[string]interface{}{
+			"paused_at":      nil,
+			"paused_seconds": gorm.Expr("paused_seconds + ?", pauseSeconds(pause)),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errRoundNotPaused
+		}
+		return nil
+	})
+	if errors.Is(err, errNoRoundRunning) || errors.Is(err, errRoundNotPaused) {
+		return Round{}, err
+	}
+	if err != nil {
+		log.Println("Error continuing round:", err)
+		return Round{}, err
+	}
+	round.PausedAt = nil
+	round.PausedSeconds += pauseSeconds(pause)
+
+	log.Printf("Continued round #%d for group '%s' at %s (by %s)", round.ID, group.Name, now.Format("2006-01-02 15:04:05"), client.Name)
+	recordAudit("round.continue", client, groupID, &round.ID,
+		fmt.Sprintf("Continued round for '%s' after a pause of %s", group.Name, time.Duration(pauseSeconds(pause))*time.Second))
+	notifyRoundChange(groupID)
+	return round, nil
+}
+
+// fitRoundPauses keeps the pauses of a round inside it after its times changed: they are cut at its start and end,
+// the open one ends with the round, and pauses left outside are deleted. Round.PausedSeconds and Round.PausedAt are
+// counted again from what is left.
+func fitRoundPauses(tx *gorm.DB, round *Round, now time.Time) error {
+	var pauses []RoundPause
+	if err := tx.Where("round_id = ?", round.ID).Order("start_time ASC").Find(&pauses).Error; err != nil {
+		return err
+	}
+	upper := now
+	if round.EndTime != nil {
+		upper = *round.EndTime
+	}
+	round.PausedSeconds = 0
+	round.PausedAt = nil
+	for _, pause := range pauses {
+		original := pause
+		if pause.StartTime.Before(round.StartTime) {
+			pause.StartTime = round.StartTime
+		}
+		if pause.EndTime == nil && round.EndTime != nil {
+			pause.EndTime = round.EndTime
+		}
+		if pause.EndTime != nil && pause.EndTime.After(upper) {
+			pause.EndTime = &upper
+		}
+		if !pause.StartTime.Before(upper) || (pause.EndTime != nil && !pause.EndTime.After(pause.StartTime)) {
+			if err := tx.Delete(&pause).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		if !pause.StartTime.Equal(original.StartTime) || (original.EndTime == nil) != (pause.EndTime == nil) ||
+			(pause.EndTime != nil && !pause.EndTime.Equal(*original.EndTime)) {
+			if err := tx.Model(&pause).Select("start_time", "end_time").Updates(&pause).Error; err != nil {
+				return err
+			}
+		}
+		if pause.EndTime == nil {
+			start := pause.StartTime
+			round.PausedAt = &start
+		} else {
+			round.PausedSeconds += pauseSeconds(pause)
+		}
+	}
+	return tx.Model(round).Select("paused_at", "paused_seconds").Updates(round).Error
+}
+
+// endOpenPause ends the pause of a round being stopped while paused, at its stop, so the break doesn't count
+func endOpenPause(tx *gorm.DB, round *Round) error {
+	if round.PausedAt == nil || round.EndTime == nil {
+		return nil
+	}
+	pause := RoundPause{RoundID: round.ID, StartTime: *round.PausedAt}
+	if err := tx.Where("round_id = ? AND end_time IS NULL", round.ID).Order("start_time DESC").Take(&pause).Error; err != nil &&
+		!errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	pause.EndTime = round.EndTime
+	if err := tx.Save(&pause).Error; err != nil {
+		return err
+	}
+	round.PausedSeconds += pauseSeconds(pause)
+	round.PausedAt = nil
+	return nil
+}
+
+// splitRoundPauses gives the second part of a split round the pauses after resume, cutting a pause that spans the
+// split in two; pauses between the split and resume fall away with the time left out
+func splitRoundPauses(tx *gorm.DB, first, second *Round, resume time.Time, now time.Time) error {
+	var spanning []RoundPause
+	if err := tx.Where("round_id = ? AND start_time < ? AND (end_time IS NULL OR end_time > ?)", first.ID, *first.EndTime, resume).
+		Find(&spanning).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&RoundPause{}).Where("round_id = ? AND start_time >= ?", first.ID, *first.EndTime).
+		Update("round_id", second.ID).Error; err != nil {
+		return err
+	}
+	for _, pause := range spanning {
+		rest := RoundPause{RoundID: second.ID, StartTime: resume, EndTime: pause.EndTime, PausedBy: pause.PausedBy, ContinuedBy: pause.ContinuedBy}
+		if err := tx.Create(&rest).Error; err != nil {
+			return err
+		}
+	}
+	if err := fitRoundPauses(tx, first, now); err != nil {
+		return err
+	}
+	return fitRoundPauses(tx, second, now)
+}
+
+// deleteRoundPauses deletes the pauses of rounds about to be deleted, so none are left without their round
+func deleteRoundPauses(tx *gorm.DB, roundIDs ...uint) error {
+	if len(roundIDs) == 0 {
+		return nil
+	}
+	return tx.Where("round_id IN ?", roundIDs).Delete(&RoundPause{}).Error
+}
+
+// loadRoundPauses lists the pauses of a round, earliest first
+func loadRoundPauses(roundID uint) ([]RoundPause, error) {
+	var pauses []RoundPause
+	err := db.Where("round_id = ?", roundID).Order("start_time ASC").Find(&pauses).Error
+	return pauses, err
+}
+
+// roundPauseView is one pause on the round page
+type roundPauseView struct {
+	StartTime   time.Time
+	EndTime     *time.Time
+	Seconds     int64 // 0 while paused
+	PausedBy    string
+	ContinuedBy string
+}
+
+func roundPauseViews(pauses []RoundPause) []roundPauseView {
+	views := make([]roundPauseView, 0, len(pauses))
+	for _, pause := range pauses {
+		views = append(views, roundPauseView{
+			StartTime:   pause.StartTime,
+			EndTime:     pause.EndTime,
+			Seconds:     pauseSeconds(pause),
+			PausedBy:    pause.PausedBy,
+			ContinuedBy: pause.ContinuedBy,
+		})
+	}
+	return views
+}
+
+// handlePause serves the dashboard's Pause button, like /stop
+func handlePause(c *fiber.Ctx) error {
+	groupID, err := parseGroupID(c.FormValue("group_id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid working group")
+	}
+	if _, err := pauseRound(groupID, clientInfoFromRequest(c)); err != nil {
+		return sendRoundError(c, err, "Error pausing round")
+	}
+	if c.FormValue("return") == "basic" {
+		return basicStatusRedirect(c, groupID)
+	}
+
+	context, err := buildStatusContext(traceContext(c), currentUserID(c), groupID)
+	if err != nil {
+		requestLog(c).Println("Error building status context:", err)
+		return c.Status(500).SendString("Error rendering status")
+	}
+	return renderStatusTemplate(c, context)
+}
+
+// handleContinue serves the dashboard's Continue button, ending the pause
+func handleContinue(c *fiber.Ctx) error {
+	groupID, err := parseGroupID(c.FormValue("group_id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid working group")
+	}
+	if _, err := continueRound(groupID, clientInfoFromRequest(c)); err != nil {
+		return sendRoundError(c, err, "Error continuing round")
+	}
+	if c.FormValue("return") == "basic" {
+		return basicStatusRedirect(c, groupID)
+	}
+
+	context, err := buildStatusContext(traceContext(c), currentUserID(c), groupID)
+	if err != nil {
+		requestLog(c).Println("Error building status context:", err)
+		return c.Status(500).SendString("Error rendering status")
+	}
+	return renderStatusTemplate(c, context)
+}
+
+// apiPause pauses the group's running round (body {"group_id": 1}, the first group without one)
+func apiPause(c *fiber.Ctx) error {
+	return apiPauseAction(c, "paused", "error pausing round", pauseRound)
+}
+
+// apiContinue ends the pause of the group's running round
+func apiContinue(c *fiber.Ctx) error {
+	return apiPauseAction(c, "continued", "error continuing round", continueRound)
+}
+
+// apiPauseAction applies pauseRound or continueRound to the requested group and answers like /api/v1/toggle
+func apiPauseAction(c *fiber.Ctx, action, fallback string, apply func(uint, ClientInfo) (Round, error)) error {
+	var req toggleRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(apiError{"invalid request body"})
+		}
+	}
+	groupID, err := resolveAPIGroup(currentUserID(c), req.GroupID)
+	if err != nil {
+		return sendAPIRoundError(c, err, fallback)
+	}
+	round, err := apply(groupID, clientInfoFromRequest(c))
+	if err != nil {
+		return sendAPIRoundError(c, err, fallback)
+	}
+	return c.JSON(toggleResponse{Action: action, Round: round, Status: getCurrentState(traceContext(c), groupID)})
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// weeklyReportLastSentKey stores the Monday of the last week a weekly report was posted for
+const weeklyReportLastSentKey = "summary.weekly_last_sent"
+
+// PlannedHours is the time a user intends to spend on a group on one day
+type PlannedHours struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	UserID         uint      `gorm:"index" json:"user_id"`
+	WorkingGroupID uint      `gorm:"uniqueIndex:idx_planned_hours_group_date" json:"working_group_id"`
+	Date           string    `gorm:"uniqueIndex:idx_planned_hours_group_date;size:10" json:"date"` // YYYY-MM-DD
+	Minutes        int       `json:"minutes"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// planningCell is the plan and the tracked time of one group on one day
+type planningCell struct {
+	Name   string // Form field, e.g. "p_3_2025-03-03"
+	Plan   string // Planned hours as h:mm, empty for none
+	Actual string // Tracked hours as h:mm, including running rounds so far
+	Status string // Bulma text class: success when the plan is met, danger when a past day fell short
+}
+
+type planningRow struct {
+	GroupID   uint
+	GroupName string
+	Cells     []planningCell
+	Plan      string
+	Actual    string
+	Percent   int // Actual of plan, capped at 100 for the progress bar
+}
+
+type planningDay struct {
+	Date   string
+	Label  string
+	Today  bool
+	Plan   string
+	Actual string
+}
+
+// loadPlan returns the planned seconds of the user's groups per group and day in [start, start+7d)
+func loadPlan(userID uint, start time.Time) (map[uint]map[string]int64, error) {
+	var plans []PlannedHours
+	err := db.Where("user_id = ? AND date >= ? AND date < ?", userID,
+		start.Format("2006-01-02"), start.AddDate(0, 0, 7).Format("2006-01-02")).Find(&plans).Error
+	if err != nil {
+		return nil, err
+	}
+	planned := make(map[uint]map[string]int64)
+	for _, plan := range plans {
+		if planned[plan.WorkingGroupID] == nil {
+			planned[plan.WorkingGroupID] = make(map[string]int64)
+		}
+		planned[plan.WorkingGroupID][plan.Date] = int64(plan.Minutes) * 60
+	}
+	return planned, nil
+}
+
+// loadActuals returns the tracked seconds per group and day for rounds started in [start, start+7d); running
+// rounds count up to now
+func loadActuals(userID uint, start time.Time) (map[uint]map[string]int64, error) {
+	var rounds []Round
+	if err := db.Scopes(userRounds(userID)).
+		Where("start_time >= ? AND start_time < ?", start, start.AddDate(0, 0, 7)).
+		Find(&rounds).Error; err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	actuals := make(map[uint]map[string]int64)
+	for _, round := range rounds {
+		if actuals[round.WorkingGroupID] == nil {
+			actuals[round.WorkingGroupID] = make(map[string]int64)
+		}
+		actuals[round.WorkingGroupID][round.StartTime.In(time.Local).Format("2006-01-02")] += roundWorkedSeconds(round, now)
+	}
+	return actuals, nil
+}
+
+// renderPlanning shows the week's planned hours per group and day next to what was tracked
+func renderPlanning(c *fiber.Ctx) error {
+	start, err := parseTimesheetWeek(c.Query("week"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid week")
+	}
+	userID := currentUserID(c)
+	groups, err := getWorkingGroupsOrdered(userID)
+	if err != nil {
+		requestLog(c).Println("Error loading working groups:", err)
+		return c.Status(500).SendString("Error loading plan")
+	}
+	planned, err := loadPlan(userID, start)
+	if err != nil {
+		requestLog(c).Println("Error loading plan:", err)
+		return c.Status(500).SendString("Error loading plan")
+	}
+	actuals, err := loadActuals(userID, start)
+	if err != nil {
+		requestLog(c).Println("Error loading rounds:", err)
+		return c.Status(500).SendString("Error loading plan")
+	}
+
+	today := time.Now().Format("2006-01-02")
+	days := make([]planningDay, 7)
+	dayPlan := make([]int64, 7)
+	dayActual := make([]int64, 7)
+	for i := range days {
+		date := start.AddDate(0, 0, i)
+		days[i] = planningDay{Date: date.Format("2006-01-02"), Label: date.Format("Mon 2"), Today: date.Format("2006-01-02") == today}
+	}
+	var weekPlan, weekActual int64
+	rows := make([]planningRow, 0, len(groups))
+	for _, group := range groups {
+		row := planningRow{GroupID: group.ID, GroupName: group.Name}
+		var rowPlan, rowActual int64
+		for i, day := range days {
+			plan, actual := planned[group.ID][day.Date], actuals[group.ID][day.Date]
+			cell := planningCell{
+				Name:   fmt.Sprintf("p_%d_%s", group.ID, day.Date),
+				Plan:   formatTimesheetHours(plan),
+				Actual: formatTimesheetHours(actual),
+			}
+			switch {
+			case plan > 0 && actual >= plan:
+				cell.Status = "has-text-success"
+			case plan > 0 && day.Date < today:
+				cell.Status = "has-text-danger"
+			}
+			row.Cells = append(row.Cells, cell)
+			rowPlan += plan
+			rowActual += actual
+			dayPlan[i] += plan
+			dayActual[i] += actual
+		}
+		row.Plan = formatTimesheetHours(rowPlan)
+		row.Actual = formatTimesheetHours(rowActual)
+		if rowPlan > 0 {
+			row.Percent = int(min(rowActual*100/rowPlan, 100))
+		}
+		weekPlan += rowPlan
+		weekActual += rowActual
+		rows = append(rows, row)
+	}
+	for i := range days {
+		days[i].Plan = formatTimesheetHours(dayPlan[i])
+		days[i].Actual = formatTimesheetHours(dayActual[i])
+	}
+
+	return c.Render("planning", fiber.Map{
+		"Week":       start.Format("2006-01-02"),
+		"WeekLabel":  start.Format("Jan 2") + " – " + start.AddDate(0, 0, 6).Format("Jan 2, 2006"),
+		"PrevWeek":   start.AddDate(0, 0, -7).Format("2006-01-02"),
+		"NextWeek":   start.AddDate(0, 0, 7).Format("2006-01-02"),
+		"Days":       days,
+		"Rows":       rows,
+		"WeekPlan":   formatTimesheetHours(weekPlan),
+		"WeekActual": formatTimesheetHours(weekActual),
+		"Saved":      c.Query("saved") != "",
+		"Can":        permissionsView(c),
+	})
+}
+
+// savePlanning stores the planned hours of the week; cleared cells remove their plan
+func savePlanning(c *fiber.Ctx) error {
+	start, err := parseTimesheetWeek(c.FormValue("week"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid week")
+	}
+	userID := currentUserID(c)
+	groups, err := getWorkingGroupsOrdered(userID)
+	if err != nil {
+		requestLog(c).Println("Error loading working groups:", err)
+		return c.Status(500).SendString("Error saving plan")
+	}
+	planned, err := loadPlan(userID, start)
+	if err != nil {
+		requestLog(c).Println("Error loading plan:", err)
+		return c.Status(500).SendString("Error saving plan")
+	}
+
+	var upserts []PlannedHours
+	var removals []PlannedHours
+	weekTotals := make(map[uint]int64) // New planned total of every changed group
+	for _, group := range groups {
+		for i := 0; i < 7; i++ {
+			date := start.AddDate(0, 0, i).Format("2006-01-02")
+			field := fmt.Sprintf("p_%d_%s", group.ID, date)
+			if c.Request().PostArgs().Peek(field) == nil {
+				continue
+			}
+			seconds, err := parseTimesheetHours(c.FormValue(field))
+			if err != nil {
+				return c.Status(400).SendString(fmt.Sprintf("%s on %s: %v", group.Name, date, err))
+			}
+			minutes := int((seconds + 30) / 60)
+			if int64(minutes)*60 == planned[group.ID][date] {
+				continue
+			}
+			plan := PlannedHours{UserID: userID, WorkingGroupID: group.ID, Date: date, Minutes: minutes}
+			if minutes == 0 {
+				removals = append(removals, plan)
+			} else {
+				upserts = append(upserts, plan)
+			}
+			if _, changed := weekTotals[group.ID]; !changed {
+				for _, seconds := range planned[group.ID] {
+					weekTotals[group.ID] += seconds
+				}
+			}
+			weekTotals[group.ID] += int64(minutes)*60 - planned[group.ID][date]
+		}
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, plan := range removals {
+			if err := tx.Where("working_group_id = ? AND date = ?", plan.WorkingGroupID, plan.Date).Delete(&PlannedHours{}).Error; err != nil {
+				return err
+			}
+		}
+		for _, plan := range upserts {
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "working_group_id"}, {Name: "date"}},
+				DoUpdates: clause.AssignmentColumns([]string{"minutes", "updated_at"}),
+			}).Create(&plan).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		requestLog(c).Println("Error saving plan:", err)
+		return c.Status(500).SendString("Error saving plan")
+	}
+
+	client := clientInfoFromRequest(c)
+	for _, group := range groups {
+		total, changed := weekTotals[group.ID]
+		if !changed {
+			continue
+		}
+		hours := formatTimesheetHours(total)
+		if hours == "" {
+			hours = "0:00"
+		}
+		recordAudit("group.plan", client, group.ID, nil,
+			fmt.Sprintf("Planned %s for '%s' in the week of %s", hours, group.Name, start.Format("2006-01-02")))
+	}
+
+	return c.Redirect("/planning?week="+start.Format("2006-01-02")+"&saved=1", fiber.StatusSeeOther)
+}
+
+// sendWeeklyReport posts last week's planned and tracked hours per user and group to the channels selected for the
+// "summary" alert type, once a week after Sunday, followed by the days that expected time but have none tracked
+func sendWeeklyReport(now time.Time) error {
+	if len(alertChannels(alertSummary)) == 0 {
+		return nil
+	}
+	start := weekStart(now).AddDate(0, 0, -7)
+	week := start.Format("2006-01-02")
+	if getSetting(weeklyReportLastSentKey, "") == week {
+		return nil
+	}
+
+	message, err := buildWeeklyReport(start, start.AddDate(0, 0, 7))
+	if err != nil {
+		return fmt.Errorf("building weekly report: %w", err)
+	}
+	forgotten, err := findForgottenDays(start)
+	if err != nil {
+		return fmt.Errorf("checking for forgotten days: %w", err)
+	}
+	if section := formatForgottenDays(forgotten); section != "" {
+		message += "\n\n" + section
+	}
+	if err := setSetting(weeklyReportLastSentKey, week); err != nil {
+		return fmt.Errorf("saving weekly report state: %w", err)
+	}
+	notify(Notification{
+		Type:    alertSummary,
+		Title:   "Week of " + start.Format("January 2, 2006"),
+		Message: message,
+	})
+	log.Printf("Posted weekly report for %s", week)
+	return nil
+}
+
+// buildWeeklyReport lists the finished rounds and the plan of every group in [from, to) per user and group
+func buildWeeklyReport(from, to time.Time) (string, error) {
+	var tracked []struct {
+		Username      string
+		GroupName     string
+		StartTime     time.Time
+		EndTime       time.Time
+		PausedSeconds int64
+	}
+	err := db.Table("rounds").
+		Select("users.username, working_groups.name AS group_name, rounds.start_time, rounds.end_time, rounds.paused_seconds").
+		Joins("JOIN working_groups ON working_groups.id = rounds.working_group_id").
+		Joins("LEFT JOIN users ON users.id = working_groups.user_id").
+		Where("rounds.end_time IS NOT NULL AND rounds.start_time >= ? AND rounds.start_time < ?", from, to).
+		Where("working_groups.notify_muted = ?", false).
+		Scan(&tracked).Error
+	if err != nil {
+		return "", err
+	}
+	var plans []struct {
+		Username  string
+		GroupName string
+		Minutes   int
+	}
+	err = db.Table("planned_hours").
+		Select("users.username, working_groups.name AS group_name, planned_hours.minutes").
+		Joins("JOIN working_groups ON working_groups.id = planned_hours.working_group_id").
+		Joins("LEFT JOIN users ON users.id = working_groups.user_id").
+		Where("planned_hours.date >= ? AND planned_hours.date < ?", from.Format("2006-01-02"), to.Format("2006-01-02")).
+		Where("working_groups.notify_muted = ?", false).
+		Scan(&plans).Error
+	if err != nil {
+		return "", err
+	}
+
+	type total struct {
+		label           string
+		actual, planned int64
+	}
+	totals := make(map[string]*total)
+	entry := func(username, group string) *total {
+		label := group
+		if username != "" {
+			label = username + " / " + group
+		}
+		if totals[label] == nil {
+			totals[label] = &total{label: label}
+		}
+		return totals[label]
+	}
+	var allActual, allPlanned int64
+	for _, row := range tracked {
+		seconds := int64(row.EndTime.Sub(row.StartTime).Seconds()) - row.PausedSeconds
+		entry(row.Username, row.GroupName).actual += seconds
+		allActual += seconds
+	}
+	for _, row := range plans {
+		entry(row.Username, row.GroupName).planned += int64(row.Minutes) * 60
+		allPlanned += int64(row.Minutes) * 60
+	}
+	if len(totals) == 0 {
+		return "No time was planned or tracked.", nil
+	}
+
+	list := make([]*total, 0, len(totals))
+	for _, t := range totals {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].actual != list[j].actual {
+			return list[i].actual > list[j].actual
+		}
+		return list[i].label < list[j].label
+	})
+
+	var lines []string
+	for _, t := range list {
+		line := fmt.Sprintf("• %s: %s", t.label, formatDuration(t.actual))
+		if t.planned > 0 {
+			line += fmt.Sprintf(" of %s planned (%.0f%%)", formatDuration(t.planned), float64(t.actual)*100/float64(t.planned))
+		}
+		lines = append(lines, line)
+	}
+	summary := "Total: " + formatDuration(allActual)
+	if allPlanned > 0 {
+		summary += " of " + formatDuration(allPlanned) + " planned"
+	}
+	lines = append(lines, summary)
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+const presenceHeartbeat = 15 * time.Second
+
+// presenceConn is one open dashboard, listening on /events
+type presenceConn struct {
+	device   string        // Session the dashboard belongs to; tabs of one browser count as one device
+	presence chan struct{} // Pending "presence" event; one buffered slot so repeated changes collapse into one
+	rounds   chan struct{} // Pending "rounds" event
+}
+
+// presence tracks the open dashboards of every user so they can be told about each other and about round changes
+var presence = struct {
+	sync.Mutex
+	users  map[uint]map[*presenceConn]bool
+	nextID int
+}{users: make(map[uint]map[*presenceConn]bool)}
+
+// signal marks an event as pending without ever blocking the caller
+func signal(pending chan struct{}) {
+	select {
+	case pending <- struct{}{}:
+	default: // Already pending
+	}
+}
+
+// presenceJoin registers a dashboard and tells the user's other dashboards about it
+func presenceJoin(userID uint, device string) *presenceConn {
+	presence.Lock()
+	defer presence.Unlock()
+	if device == "" {
+		presence.nextID++
+		device = fmt.Sprintf("conn:%d", presence.nextID)
+	}
+	conn := &presenceConn{device: device, presence: make(chan struct{}, 1), rounds: make(chan struct{}, 1)}
+	if presence.users[userID] == nil {
+		presence.users[userID] = make(map[*presenceConn]bool)
+	}
+	presence.users[userID][conn] = true
+	broadcastPresenceLocked(userID)
+	return conn
+}
+
+func presenceLeave(userID uint, conn *presenceConn) {
+	presence.Lock()
+	defer presence.Unlock()
+	delete(presence.users[userID], conn)
+	if len(presence.users[userID]) == 0 {
+		delete(presence.users, userID)
+		return
+	}
+	broadcastPresenceLocked(userID)
+}
+
+func broadcastPresenceLocked(userID uint) {
+	for conn := range presence.users[userID] {
+		signal(conn.presence)
+	}
+}
+
+// otherDevices counts the devices other than the connection's own that have a dashboard open
+func otherDevices(userID uint, conn *presenceConn) int {
+	presence.Lock()
+	defer presence.Unlock()
+	devices := make(map[string]bool)
+	for other := range presence.users[userID] {
+		if other.device != conn.device {
+			devices[other.device] = true
+		}
+	}
+	return len(devices)
+}
+
+// notifyPresenceRounds tells the open dashboards of the group's owner to refresh
+func notifyPresenceRounds(groupID uint) {
+	presence.Lock()
+	empty := len(presence.users) == 0
+	presence.Unlock()
+	if empty {
+		return
+	}
+
+	var group WorkingGroup
+	if err := db.Select("user_id").First(&group, groupID).Error; err != nil {
+		return
+	}
+	presence.Lock()
+	defer presence.Unlock()
+	for conn := range presence.users[group.UserID] {
+		signal(conn.rounds)
+	}
+}
+
+// eventsHandler streams server-sent events to the dashboard: "presence" with the number of other devices that have
+// it open, and "rounds" whenever a round of the user's groups was started or stopped anywhere
+func eventsHandler(c *fiber.Ctx) error {
+	userID := currentUserID(c)
+	device := ""
+	if session := currentSession(c); session != nil {
+		device = fmt.Sprintf("session:%d", session.ID)
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set("X-Accel-Buffering", "no") // Keep nginx from holding the stream back
+
+	conn := presenceJoin(userID, device)
+	c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+		defer presenceLeave(userID, conn)
+
+		heartbeat := time.NewTicker(presenceHeartbeat)
+		defer heartbeat.Stop()
+		fmt.Fprint(w, "retry: 5000\n\n")
+		for {
+			var err error
+			select {
+			case <-conn.presence:
+				_, err = fmt.Fprintf(w, "event: presence\ndata: {\"others\":%d}\n\n", otherDevices(userID, conn))
+			case <-conn.rounds:
+				_, err = fmt.Fprint(w, "event: rounds\ndata: {}\n\n")
+			case <-heartbeat.C:
+				_, err = fmt.Fprint(w, ": ping\n\n")
+			}
+			// A failed write or flush means the client disconnected
+			if err != nil || w.Flush() != nil {
+				return
+			}
+		}
+	}))
+	return nil
+}
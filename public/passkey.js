@@ -0,0 +1,88 @@
+// Passkey (WebAuthn) helpers: the server speaks base64url, the browser API wants ArrayBuffers.
+(function () {
+    // The app may live under a base path; it is wherever this script was loaded from, minus /static/passkey.js
+    var basePath = document.currentScript ? new URL(document.currentScript.src).pathname.replace(/\/static\/passkey\.js$/, '') : '';
+
+    function toBuffer(value) {
+        var base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+        while (base64.length % 4) base64 += '=';
+        var binary = atob(base64);
+        var bytes = new Uint8Array(binary.length);
+        for (var i = 0; i < binary.length; i++) bytes[i] = binary.charCodeAt(i);
+        return bytes.buffer;
+    }
+
+    function toBase64url(buffer) {
+        var bytes = new Uint8Array(buffer);
+        var binary = '';
+        for (var i = 0; i < bytes.length; i++) binary += String.fromCharCode(bytes[i]);
+        return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+    }
+
+    function csrfToken() {
+        var meta = document.querySelector('meta[name="csrf-token"]');
+        return meta ? meta.content : '';
+    }
+
+    function post(url, body) {
+        return fetch(basePath + url, {
+            method: 'POST',
+            credentials: 'same-origin',
+            headers: {'Content-Type': 'application/json', 'X-CSRF-Token': csrfToken()},
+            body: body ? JSON.stringify(body) : undefined
+        }).then(function (response) {
+            return response.json().then(function (data) {
+                if (!response.ok) throw new Error(data.error || 'Request failed');
+                return data;
+            });
+        });
+    }
+
+    function supported() {
+        return !!(window.PublicKeyCredential && navigator.credentials);
+    }
+
+    function register(name) {
+        return post('/passkeys/register/begin').then(function (options) {
+            var publicKey = options.publicKey;
+            publicKey.challenge = toBuffer(publicKey.challenge);
+            publicKey.user.id = toBuffer(publicKey.user.id);
+            (publicKey.excludeCredentials || []).forEach(function (c) { c.id = toBuffer(c.id); });
+            return navigator.credentials.create({publicKey: publicKey});
+        }).then(function (credential) {
+            return post('/passkeys/register/finish?name=' + encodeURIComponent(name || ''), {
+                id: credential.id,
+                rawId: toBase64url(credential.rawId),
+                type: credential.type,
+                response: {
+                    attestationObject: toBase64url(credential.response.attestationObject),
+                    clientDataJSON: toBase64url(credential.response.clientDataJSON),
+                    transports: credential.response.getTransports ? credential.response.getTransports() : []
+                }
+            });
+        });
+    }
+
+    function login(remember) {
+        return post('/auth/passkey/begin').then(function (options) {
+            var publicKey = options.publicKey;
+            publicKey.challenge = toBuffer(publicKey.challenge);
+            (publicKey.allowCredentials || []).forEach(function (c) { c.id = toBuffer(c.id); });
+            return navigator.credentials.get({publicKey: publicKey});
+        }).then(function (assertion) {
+            return post('/auth/passkey/finish' + (remember ? '?remember=1' : ''), {
+                id: assertion.id,
+                rawId: toBase64url(assertion.rawId),
+                type: assertion.type,
+                response: {
+                    authenticatorData: toBase64url(assertion.response.authenticatorData),
+                    clientDataJSON: toBase64url(assertion.response.clientDataJSON),
+                    signature: toBase64url(assertion.response.signature),
+                    userHandle: assertion.response.userHandle ? toBase64url(assertion.response.userHandle) : null
+                }
+            });
+        });
+    }
+
+    window.Passkeys = {supported: supported, register: register, login: login};
+})();
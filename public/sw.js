@@ -0,0 +1,17 @@
+// Service worker showing Web Push notifications sent by Hours Tracker
+self.addEventListener('push', function (event) {
+    var data = {};
+    if (event.data) {
+        data = event.data.json();
+    }
+    event.waitUntil(self.registration.showNotification(data.title || 'Hours Tracker', {
+        body: data.message || '',
+        // The worker lives in <base path>/static/, so the app itself is one level up
+        data: { url: data.url || new URL('..', self.registration.scope).href }
+    }));
+});
+
+self.addEventListener('notificationclick', function (event) {
+    event.notification.close();
+    event.waitUntil(clients.openWindow(event.notification.data.url));
+});
@@ -0,0 +1,17 @@
+// Tells the server which time zone the browser is in, so rounds started or added from here remember it. Reports can
+// then show a work trip's days on the wall clock where they happened.
+(function () {
+    // The app may live under a base path; it is wherever this script was loaded from, minus /static/timezone.js
+    var basePath = document.currentScript ? new URL(document.currentScript.src).pathname.replace(/\/static\/timezone\.js$/, '') : '';
+
+    var zone;
+    try {
+        zone = Intl.DateTimeFormat().resolvedOptions().timeZone;
+    } catch (e) {
+        return;
+    }
+    // IANA names are letters, digits and /_+-, which a cookie can hold as they are
+    if (!zone || !/^[A-Za-z0-9\/_+-]+$/.test(zone)) return;
+
+    document.cookie = 'tz=' + zone + '; path=' + (basePath || '/') + '; max-age=31536000; SameSite=Lax';
+})();
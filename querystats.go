@@ -0,0 +1,178 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// slowQueryLimit is how many slow queries the admin page keeps
+const slowQueryLimit = 20
+
+// slowQueryThreshold is DB_SLOW_QUERY: queries taking longer are logged. 0 when the query statistics are off.
+var slowQueryThreshold time.Duration
+
+// operationStats sums up the queries of one kind (select, create, update, delete, row or raw)
+type operationStats struct {
+	Operation string
+	Count     int64
+	Total     time.Duration
+	Max       time.Duration
+	Slow      int64 // Took longer than DB_SLOW_QUERY
+}
+
+// slowQuery is a query that took longer than DB_SLOW_QUERY, with its values redacted
+type slowQuery struct {
+	At       time.Time
+	Duration time.Duration
+	SQL      string
+	Rows     int64
+}
+
+// queryStats holds the durations of queries since the server started, when DB_SLOW_QUERY is set
+var queryStats = struct {
+	sync.Mutex
+	byOperation map[string]*operationStats
+	slow        []slowQuery // Oldest first
+}{byOperation: make(map[string]*operationStats)}
+
+// configureQueryStats times every query when DB_SLOW_QUERY is set, for the admin page and /debug/vars, and logs the
+// ones slower than it
+func configureQueryStats() {
+	if cfg.Database.SlowQuery == "" {
+		return
+	}
+	threshold, err := time.ParseDuration(cfg.Database.SlowQuery)
+	if err != nil {
+		log.Println("Warning: query statistics disabled:", err)
+		return
+	}
+	slowQueryThreshold = threshold
+	if err := db.Use(gormQueryStats{}); err != nil {
+		slowQueryThreshold = 0
+		log.Println("Warning: failed to time database queries:", err)
+		return
+	}
+	log.Printf("Logging database queries slower than %s", threshold)
+}
+
+// recordQuery adds a finished query to the statistics and logs it when it was slow
+func recordQuery(operation string, duration time.Duration, sql string, rows int64) {
+	slow := duration > slowQueryThreshold
+	var redacted string
+	if slow {
+		redacted = redactSQL(sql)
+		log.Printf("Slow query took %s (%s, %d rows): %s", duration.Round(time.Microsecond), operation, rows, redacted)
+	}
+
+	queryStats.Lock()
+	defer queryStats.Unlock()
+	stats, ok := queryStats.byOperation[operation]
+	if !ok {
+		stats = &operationStats{Operation: operation}
+		queryStats.byOperation[operation] = stats
+	}
+	stats.Count++
+	stats.Total += duration
+	if duration > stats.Max {
+		stats.Max = duration
+	}
+	if !slow {
+		return
+	}
+	stats.Slow++
+	queryStats.slow = append(queryStats.slow, slowQuery{At: time.Now(), Duration: duration, SQL: redacted, Rows: rows})
+	if len(queryStats.slow) > slowQueryLimit {
+		queryStats.slow = queryStats.slow[len(queryStats.slow)-slowQueryLimit:]
+	}
+}
+
+// queryStatistics is a copy of the statistics by operation, most frequent first, and of the slow queries, newest
+// first
+func queryStatistics() ([]operationStats, []slowQuery) {
+	queryStats.Lock()
+	defer queryStats.Unlock()
+	operations := make([]operationStats, 0, len(queryStats.byOperation))
+	for _, stats := range queryStats.byOperation {
+		operations = append(operations, *stats)
+	}
+	sort.Slice(operations, func(i, j int) bool {
+		if operations[i].Count != operations[j].Count {
+			return operations[i].Count > operations[j].Count
+		}
+		return operations[i].Operation < operations[j].Operation
+	})
+	slow := make([]slowQuery, len(queryStats.slow))
+	for i, query := range queryStats.slow {
+		slow[len(slow)-1-i] = query
+	}
+	return operations, slow
+}
+
+var (
+	sqlStringLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	sqlNumericLiteral = regexp.MustCompile(`(^|[^\w$.])-?\d+(?:\.\d+)?\b`)
+)
+
+// redactSQL replaces the literals in a statement with ?, so logs and the admin page show its shape without the notes,
+// names or tokens it was run with. Values passed as query arguments are never part of the statement; this covers
+// the ones written into raw SQL. Long statements are shortened.
+func redactSQL(sql string) string {
+	sql = sqlStringLiteral.ReplaceAllString(sql, "?")
+	sql = sqlNumericLiteral.ReplaceAllString(sql, "${1}?")
+	sql = strings.Join(strings.Fields(sql), " ")
+	if len(sql) > 500 {
+		sql = sql[:500] + "…"
+	}
+	return sql
+}
+
+// gormQueryStats is a GORM plugin that times every query for recordQuery
+type gormQueryStats struct{}
+
+const gormQueryStartKey = "querystats:start"
+
+func (gormQueryStats) Name() string {
+	return "querystats"
+}
+
+func (gormQueryStats) Initialize(db *gorm.DB) error {
+	before := func(tx *gorm.DB) {
+		tx.InstanceSet(gormQueryStartKey, time.Now())
+	}
+	after := func(operation string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			value, ok := tx.InstanceGet(gormQueryStartKey)
+			if !ok {
+				return
+			}
+			recordQuery(operation, time.Since(value.(time.Time)), tx.Statement.SQL.String(), tx.Statement.RowsAffected)
+		}
+	}
+
+	callbacks := db.Callback()
+	for _, err := range []error{
+		callbacks.Create().Before("gorm:create").Register("querystats:before_create", before),
+		callbacks.Create().After("gorm:create").Register("querystats:after_create", after("create")),
+		callbacks.Query().Before("gorm:query").Register("querystats:before_query", before),
+		callbacks.Query().After("gorm:query").Register("querystats:after_query", after("select")),
+		callbacks.Update().Before("gorm:update").Register("querystats:before_update", before),
+		callbacks.Update().After("gorm:update").Register("querystats:after_update", after("update")),
+		callbacks.Delete().Before("gorm:delete").Register("querystats:before_delete", before),
+		callbacks.Delete().After("gorm:delete").Register("querystats:after_delete", after("delete")),
+		callbacks.Row().Before("gorm:row").Register("querystats:before_row", before),
+		callbacks.Row().After("gorm:row").Register("querystats:after_row", after("row")),
+		callbacks.Raw().Before("gorm:raw").Register("querystats:before_raw", before),
+		callbacks.Raw().After("gorm:raw").Register("querystats:after_raw", after("raw")),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
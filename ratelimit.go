@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+	"gorm.io/gorm"
+)
+
+// parseRateLimit parses "<requests>/<window>" such as "30/1m"; a bare number means per minute
+func parseRateLimit(value string) (int, time.Duration, error) {
+	countPart, windowPart, found := strings.Cut(value, "/")
+	count, err := strconv.Atoi(strings.TrimSpace(countPart))
+	if err != nil || count < 0 {
+		return 0, 0, fmt.Errorf("invalid request count %q", countPart)
+	}
+	window := time.Minute
+	if found {
+		window, err = time.ParseDuration(strings.TrimSpace(windowPart))
+		if err != nil || window <= 0 {
+			return 0, 0, fmt.Errorf("invalid window %q", windowPart)
+		}
+	}
+	return count, window, nil
+}
+
+// rateLimitSetting parses a configured limit; "0" or "off" disables it
+func rateLimitSetting(name, value, fallback string) (int, time.Duration) {
+	value = strings.TrimSpace(value)
+	if value == "off" {
+		return 0, 0
+	}
+	if value != "" {
+		if count, window, err := parseRateLimit(value); err == nil {
+			return count, window
+		}
+		log.Printf("Warning: ignoring %s %q, using %s", name, value, fallback)
+	}
+	count, window, _ := parseRateLimit(fallback)
+	return count, window
+}
+
+// rateLimitKey limits API token requests per token and everything else per client IP
+func rateLimitKey(c *fiber.Ctx) string {
+	if token := requestToken(c); token != nil {
+		return fmt.Sprintf("token:%d", token.ID)
+	}
+	return "ip:" + c.IP()
+}
+
+// tokenQuota is where a token stood in a limiter's window after its last request
+type tokenQuota struct {
+	Limit     int
+	Remaining int
+	ResetAt   time.Time
+}
+
+// tokenQuotas keeps the latest quota of every token per limiter ("write" or "api") for the tokens page; it lives in
+// memory like the limiters' own counters
+var tokenQuotas = struct {
+	sync.Mutex
+	byToken map[uint]map[string]tokenQuota
+}{byToken: make(map[uint]map[string]tokenQuota)}
+
+// currentTokenQuotas returns the token's quotas whose window has not ended yet
+func currentTokenQuotas(tokenID uint) map[string]tokenQuota {
+	tokenQuotas.Lock()
+	defer tokenQuotas.Unlock()
+	quotas := make(map[string]tokenQuota)
+	for bucket, quota := range tokenQuotas.byToken[tokenID] {
+		if time.Now().Before(quota.ResetAt) {
+			quotas[bucket] = quota
+		}
+	}
+	return quotas
+}
+
+// trackTokenQuota runs a limiter and remembers the X-RateLimit-* headers it set for token requests
+func trackTokenQuota(bucket string, skip func(*fiber.Ctx) bool, limit fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if skip(c) {
+			return c.Next()
+		}
+		err := limit(c)
+		token := requestToken(c)
+		if token == nil {
+			return err
+		}
+		max, _ := strconv.Atoi(c.GetRespHeader("X-RateLimit-Limit"))
+		remaining, _ := strconv.Atoi(c.GetRespHeader("X-RateLimit-Remaining"))
+		reset, _ := strconv.Atoi(c.GetRespHeader("X-RateLimit-Reset"))
+		if max > 0 {
+			tokenQuotas.Lock()
+			if tokenQuotas.byToken[token.ID] == nil {
+				tokenQuotas.byToken[token.ID] = make(map[string]tokenQuota)
+			}
+			tokenQuotas.byToken[token.ID][bucket] = tokenQuota{
+				Limit:     max,
+				Remaining: remaining,
+				ResetAt:   time.Now().Add(time.Duration(reset) * time.Second),
+			}
+			tokenQuotas.Unlock()
+		}
+		return err
+	}
+}
+
+// rateLimitReached answers a request over the limit. The limiter only sets Retry-After then, so the X-RateLimit-*
+// headers are added to match the ones successful requests carry.
+func rateLimitReached(max int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set("X-RateLimit-Limit", strconv.Itoa(max))
+		c.Set("X-RateLimit-Remaining", "0")
+		c.Set("X-RateLimit-Reset", c.GetRespHeader(fiber.HeaderRetryAfter))
+		if token := requestToken(c); token != nil {
+			if err := db.Model(token).UpdateColumn("rate_limited_count", gorm.Expr("rate_limited_count + 1")).Error; err != nil {
+				requestLog(c).Println("Warning: failed to count rate limited token request:", err)
+			}
+		}
+
+		if strings.HasPrefix(c.Path(), "/api/") || strings.HasPrefix(c.Path(), "/grafana") {
+			return c.Status(fiber.StatusTooManyRequests).JSON(apiError{"rate limit exceeded, slow down"})
+		}
+		return c.Status(fiber.StatusTooManyRequests).SendString("Too many requests, please slow down")
+	}
+}
+
+// rateLimiters returns the write limiter (RATE_LIMIT_WRITE, every state-changing request) and the
+// API read limiter (RATE_LIMIT_API, GET requests to /api/ and /grafana); disabled limits are skipped.
+// Both answer with X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset headers.
+func rateLimiters() []fiber.Handler {
+	var handlers []fiber.Handler
+
+	if max, window := rateLimitSetting("RATE_LIMIT_WRITE", cfg.RateLimit.Write, "30/1m"); max > 0 {
+		skip := func(c *fiber.Ctx) bool { return !unsafeMethod(c.Method()) }
+		handlers = append(handlers, trackTokenQuota("write", skip, limiter.New(limiter.Config{
+			Max:          max,
+			Expiration:   window,
+			KeyGenerator: func(c *fiber.Ctx) string { return "write:" + rateLimitKey(c) },
+			LimitReached: rateLimitReached(max),
+		})))
+	}
+
+	if max, window := rateLimitSetting("RATE_LIMIT_API", cfg.RateLimit.API, "300/1m"); max > 0 {
+		skip := func(c *fiber.Ctx) bool {
+			path := c.Path()
+			return unsafeMethod(c.Method()) || !(strings.HasPrefix(path, "/api/v1/") || strings.HasPrefix(path, "/grafana"))
+		}
+		handlers = append(handlers, trackTokenQuota("api", skip, limiter.New(limiter.Config{
+			Max:          max,
+			Expiration:   window,
+			KeyGenerator: func(c *fiber.Ctx) string { return "api:" + rateLimitKey(c) },
+			LimitReached: rateLimitReached(max),
+		})))
+	}
+
+	return handlers
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxHourlyRateCents keeps earnings of years of rounds far from overflowing int64
+const maxHourlyRateCents = 100_000_000
+
+// parseHourlyRate reads a group's hourly rate as typed on the group page, e.g. "85", "85.50" or "85,50", in cents (or
+// the minor unit of the group's currency). Empty means no rate.
+func parseHourlyRate(text string) (int64, error) {
+	text = strings.TrimSpace(strings.Replace(text, ",", ".", 1))
+	if text == "" {
+		return 0, nil
+	}
+	whole, fraction, _ := strings.Cut(text, ".")
+	if whole == "" {
+		whole = "0"
+	}
+	if len(fraction) > 2 {
+		return 0, errors.New("use at most two decimals")
+	}
+	fraction += strings.Repeat("0", 2-len(fraction))
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units < 0 || strings.HasPrefix(whole, "+") {
+		return 0, fmt.Errorf("%q is not an amount like 85.50", text)
+	}
+	cents, err := strconv.ParseInt(fraction, 10, 64)
+	if err != nil || cents < 0 {
+		return 0, fmt.Errorf("%q is not an amount like 85.50", text)
+	}
+	rate := units*100 + cents
+	if rate > maxHourlyRateCents {
+		return 0, errors.New("the rate is too high")
+	}
+	return rate, nil
+}
+
+// formatRateInput is a rate as the group form shows it, with the decimal separator of money.locale; empty for none
+func formatRateInput(cents int64) string {
+	if cents == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d%s%02d", cents/100, moneyNumberFormat().Decimal, cents%100)
+}
+
+// parseCurrency reads an ISO 4217 currency code such as "EUR", in any case
+func parseCurrency(text string) (string, error) {
+	code := strings.ToUpper(strings.TrimSpace(text))
+	if len(code) != 3 || strings.IndexFunc(code, func(r rune) bool { return r < 'A' || r > 'Z' }) >= 0 {
+		return "", fmt.Errorf("%q is not a currency code like EUR", text)
+	}
+	return code, nil
+}
+
+// earnedCents is what billable time earns at an hourly rate, rounded to the nearest cent
+func earnedCents(billableSeconds, rateCents int64) int64 {
+	if billableSeconds <= 0 || rateCents <= 0 {
+		return 0
+	}
+	return (billableSeconds*rateCents + 1800) / 3600
+}
+
+// formatMoney shows an amount in cents with its currency as money.locale and money.display say, e.g. "1,234.50 EUR"
+// or "1.234,50 €"
+func formatMoney(cents int64, currency string) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	format := moneyNumberFormat()
+	amount := format.amount(cents)
+	if cfg.Money.Display == moneyDisplaySymbol {
+		if symbol, ok := currencySymbol(currency); ok {
+			return sign + format.placeSymbol(amount, symbol)
+		}
+	}
+	return sign + amount + " " + currency
+}
+
+// moneyTotals adds up amounts of several groups by currency, as amounts in different currencies can't be summed
+type moneyTotals map[string]int64
+
+// String lists the total of every currency, such as "1,200.00 EUR + 300.00 USD"; empty when there are none
+func (m moneyTotals) String() string {
+	currencies := make([]string, 0, len(m))
+	for currency := range m {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	amounts := make([]string, len(currencies))
+	for i, currency := range currencies {
+		amounts[i] = formatMoney(m[currency], currency)
+	}
+	return strings.Join(amounts, " + ")
+}
+
+// groupEarned is what a group's billable seconds earned, and false when the group has no rate
+func groupEarned(group WorkingGroup, billableSeconds int64) (int64, bool) {
+	if group.HourlyRateCents == 0 || group.Currency == "" {
+		return 0, false
+	}
+	return earnedCents(billableSeconds, group.HourlyRateCents), true
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// requestIDHeader carries the request ID back to the client; a proxy may also set it on the way in
+const requestIDHeader = "X-Request-ID"
+
+// assignRequestID gives every request an ID, taken from a proxy's X-Request-ID header when it is sane, and returns
+// it in the response so an error a user reports can be found in the logs. Server errors also show it in the body.
+func assignRequestID(c *fiber.Ctx) error {
+	if c.Locals("requestID") != nil {
+		return c.Next() // Routing restarted, e.g. after the base path was stripped
+	}
+	id := c.Get(requestIDHeader)
+	if !validRequestID(id) {
+		buf := make([]byte, 8)
+		if _, err := rand.Read(buf); err != nil {
+			log.Println("Error generating request ID:", err)
+		}
+		id = hex.EncodeToString(buf)
+	}
+	c.Locals("requestID", id)
+	c.Set(requestIDHeader, id)
+	if err := c.Next(); err != nil {
+		return err // requestErrorHandler adds the ID
+	}
+	return annotateServerError(c)
+}
+
+// annotateServerError appends the request ID to 5xx responses: a "Request ID" line below plain-text errors and a
+// request_id field in JSON ones, so users can quote it from the page they see
+func annotateServerError(c *fiber.Ctx) error {
+	if c.Response().StatusCode() < fiber.StatusInternalServerError {
+		return nil
+	}
+	contentType := string(c.Response().Header.ContentType())
+	switch {
+	case strings.HasPrefix(contentType, fiber.MIMETextPlain):
+		c.Response().AppendBodyString("\n\nRequest ID: " + requestID(c))
+	case strings.HasPrefix(contentType, fiber.MIMEApplicationJSON):
+		var body map[string]interface{}
+		if json.Unmarshal(c.Response().Body(), &body) == nil {
+			body["request_id"] = requestID(c)
+			return c.JSON(body)
+		}
+	}
+	return nil
+}
+
+// requestErrorHandler answers errors returned by handlers like Fiber's default handler, logging server errors and
+// adding the request ID to them
+func requestErrorHandler(c *fiber.Ctx, err error) error {
+	code := fiber.StatusInternalServerError
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		code = fiberErr.Code
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+	if code < fiber.StatusInternalServerError {
+		return c.Status(code).SendString(err.Error())
+	}
+	requestLog(c).Println("Error handling request:", err)
+	return c.Status(code).SendString(err.Error() + "\n\nRequest ID: " + requestID(c))
+}
+
+// validRequestID accepts short IDs of letters, digits and "-_." so they are safe to log and echo
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// requestID returns the ID assigned to the request
+func requestID(c *fiber.Ctx) string {
+	id, _ := c.Locals("requestID").(string)
+	return id
+}
+
+// requestLog returns the standard logger with the request ID in front of the message, e.g.
+// "2025/03/03 09:00:00 [3f2a9c1e0b7d4e65] Error starting round: ..."
+func requestLog(c *fiber.Ctx) *log.Logger {
+	id := requestID(c)
+	if id == "" {
+		return log.Default()
+	}
+	return log.New(log.Writer(), log.Prefix()+"["+id+"] ", log.Flags()|log.Lmsgprefix)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var errNothingToResume = errors.New("no round of this working group stopped recently enough to resume")
+
+// resumeGrace is how long after its stop a round can be resumed, RESUME_GRACE; 0 when resuming is off
+func resumeGrace() time.Duration {
+	grace, err := time.ParseDuration(cfg.ResumeGrace)
+	if err != nil || grace < 0 {
+		return 0
+	}
+	return grace
+}
+
+// resumableUntil is when the grace period of a stopped round ends, if it hasn't yet. Billed rounds can't be resumed.
+func resumableUntil(round Round, now time.Time) (time.Time, bool) {
+	grace := resumeGrace()
+	if grace == 0 || round.EndTime == nil || round.InvoiceID != nil {
+		return time.Time{}, false
+	}
+	until := round.EndTime.Add(grace)
+	return until, now.Before(until)
+}
+
+// resumeRound reopens the group's last round when it stopped within the grace period, for a stop made by accident:
+// the round keeps running as if it had never stopped, its tags and note included, and no short round is left behind
+func resumeRound(groupID uint, client ClientInfo) (Round, error) {
+	group, err := findUserGroup(client.UserID, groupID)
+	if err != nil {
+		return Round{}, errGroupNotFound
+	}
+
+	var round Round
+	var stoppedAt time.Time
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var running int64
+		if err := tx.Model(&Round{}).Where("working_group_id = ? AND end_time IS NULL", groupID).Count(&running).Error; err != nil {
+			return err
+		}
+		if running > 0 {
+			return errRoundRunning
+		}
+		err := tx.Where("working_group_id = ? AND end_time IS NOT NULL", groupID).Order("end_time DESC").Take(&round).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errNothingToResume
+		}
+		if err != nil {
+			return err
+		}
+		if _, ok := resumableUntil(round, time.Now()); !ok {
+			return errNothingToResume
+		}
+		stoppedAt = *round.EndTime
+		// A resume from another device may have won meanwhile
+		result := tx.Model(&round).Where("end_time IS NOT NULL").
+			Updates(map[string]interface{}{"end_time": nil, "stopped_by": "", "stop_user_agent": "", "flagged": false})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errNothingToResume
+		}
+		return nil
+	})
+	if errors.Is(err, errRoundRunning) || errors.Is(err, errNothingToResume) {
+		return Round{}, err
+	}
+	if err != nil {
+		log.Println("Error resuming round:", err)
+		return Round{}, err
+	}
+
+	log.Printf("Resumed round #%d for group '%s' stopped at %s (by %s)", round.ID, group.Name,
+		stoppedAt.Format("2006-01-02 15:04:05"), client.Name)
+	recordAudit("round.resume", client, groupID, &round.ID,
+		fmt.Sprintf("Resumed round for '%s' %s after it was stopped", group.Name, time.Since(stoppedAt).Round(time.Second)))
+	notifyRoundChange(groupID)
+	return round, nil
+}
+
+// lastStoppedGroup resolves the named group, or without a name the group of the round that stopped last
+func lastStoppedGroup(userID uint, name string) (WorkingGroup, error) {
+	if name != "" {
+		return findGroupByLooseName(userID, name)
+	}
+	var round Round
+	if err := db.Preload("WorkingGroup").Scopes(userRounds(userID)).Where("end_time IS NOT NULL").
+		Order("end_time DESC").Take(&round).Error; err != nil {
+		return WorkingGroup{}, err
+	}
+	return round.WorkingGroup, nil
+}
+
+// handleResume serves the dashboard's Resume button, like /start
+func handleResume(c *fiber.Ctx) error {
+	groupID, err := parseGroupID(c.FormValue("group_id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid working group")
+	}
+	if _, err := resumeRound(groupID, clientInfoFromRequest(c)); err != nil {
+		if errors.Is(err, errRoundRunning) {
+			return c.Status(400).SendString("Cannot resume: this working group already has a running round")
+		}
+		return sendRoundError(c, err, "Error resuming round")
+	}
+	if c.FormValue("return") == "basic" {
+		return basicStatusRedirect(c, groupID)
+	}
+
+	context, err := buildStatusContext(traceContext(c), currentUserID(c), groupID)
+	if err != nil {
+		requestLog(c).Println("Error building status context:", err)
+		return c.Status(500).SendString("Error rendering status")
+	}
+	return renderStatusTemplate(c, context)
+}
+
+// apiResume reopens the group's last round (body {"group_id": 1}, the first group without one)
+func apiResume(c *fiber.Ctx) error {
+	var req toggleRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(apiError{"invalid request body"})
+		}
+	}
+	groupID, err := resolveAPIGroup(currentUserID(c), req.GroupID)
+	if err != nil {
+		return sendAPIRoundError(c, err, "error resuming round")
+	}
+	round, err := resumeRound(groupID, clientInfoFromRequest(c))
+	if err != nil {
+		return sendAPIRoundError(c, err, "error resuming round")
+	}
+	return c.JSON(toggleResponse{Action: "resumed", Round: round, Status: getCurrentState(traceContext(c), groupID)})
+}
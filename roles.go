@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// User roles, ordered from least to most privileged
+const (
+	roleViewer = "viewer" // stats, exports and the audit log
+	roleMember = "member" // viewer plus tracking time in their own groups
+	roleAdmin  = "admin"  // everything, including deletes, resets and user management
+)
+
+var roles = []string{roleViewer, roleMember, roleAdmin}
+
+// roleScopes maps each role to the token scope with the same privileges, so roles and
+// scopes share one permission ladder and every route declares a single requirement
+var roleScopes = map[string]string{
+	roleViewer: scopeRead,
+	roleMember: scopeControl,
+	roleAdmin:  scopeAdmin,
+}
+
+func validRole(role string) bool {
+	_, ok := roleScopes[role]
+	return ok
+}
+
+// requestLevel is the privilege level of the request: the user's role, capped by the token scope if a token is used
+func requestLevel(c *fiber.Ctx) int {
+	user := currentUser(c)
+	if user == nil {
+		return 0
+	}
+	level := scopeLevels[roleScopes[user.Role]]
+	if token := requestToken(c); token != nil && scopeLevels[token.Scope] < level {
+		level = scopeLevels[token.Scope]
+	}
+	return level
+}
+
+// requireScope rejects requests whose role or token scope is below the given scope
+func requireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if requestLevel(c) >= scopeLevels[scope] {
+			return c.Next()
+		}
+
+		message := fmt.Sprintf("Your role does not allow this action (requires %s)", scopeRole(scope))
+		if token := requestToken(c); token != nil && scopeLevels[token.Scope] < scopeLevels[scope] {
+			message = fmt.Sprintf("API token '%s' lacks the '%s' scope", token.Name, scope)
+		}
+		return c.Status(403).SendString(message)
+	}
+}
+
+func scopeRole(scope string) string {
+	for role, roleScope := range roleScopes {
+		if roleScope == scope {
+			return role
+		}
+	}
+	return scope
+}
+
+// permissionsView tells templates which controls to offer to the current request
+func permissionsView(c *fiber.Ctx) fiber.Map {
+	level := requestLevel(c)
+	return fiber.Map{
+		"Control": level >= scopeLevels[scopeControl],
+		"Admin":   level >= scopeLevels[scopeAdmin],
+	}
+}
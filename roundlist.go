@@ -0,0 +1,343 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultRoundsPerPage = 50
+	maxRoundsPerPage     = 500
+)
+
+// roundSortColumns are the columns the rounds list can be sorted by, with the SQL they sort on. duration is computed
+// by roundSecondsSQL, so running rounds sort by their time so far.
+var roundSortColumns = map[string]string{
+	"id":         "rounds.id",
+	"start_time": "rounds.start_time",
+	"end_time":   "rounds.end_time",
+	"group":      "working_groups.name",
+	"duration":   "",
+}
+
+// roundListQuery is a page of the rounds list, as given by the query string of /rounds and /api/v1/rounds
+type roundListQuery struct {
+	GroupID uint   // 0 lists every group
+	Source  string // Only rounds created this way, see roundSources; empty lists all
+	Tag     string // Only rounds with this tag; empty lists all
+	Search  string // Only rounds whose note or tags contain these words, see roundsMatching; empty lists all
+	Flagged bool   // Only rounds flagged for review, see MIN_ROUND_DURATION
+	From    string // YYYY-MM-DD, rounds starting on or after this day
+	To      string // YYYY-MM-DD, rounds starting on or before this day
+	Sort    string
+	Order   string // asc or desc
+	Page    int
+	PerPage int
+
+	from, to time.Time
+	terms    []string
+}
+
+// parseRoundListQuery reads and checks the filters, sorting and page of a rounds list request
+func parseRoundListQuery(c *fiber.Ctx) (roundListQuery, error) {
+	q := roundListQuery{
+		From:    c.Query("from"),
+		To:      c.Query("to"),
+		Sort:    c.Query("sort", "start_time"),
+		Order:   c.Query("order", "desc"),
+		Page:    c.QueryInt("page", 1),
+		PerPage: c.QueryInt("per_page", defaultRoundsPerPage),
+	}
+	if groupParam := c.Query("group_id"); groupParam != "" && groupParam != "0" {
+		groupID, err := parseGroupID(groupParam)
+		if err != nil {
+			return q, errors.New("invalid working group")
+		}
+		q.GroupID = groupID
+	}
+	if q.Source = c.Query("source"); q.Source != "" && !validRoundSource(q.Source) {
+		return q, errors.New("unknown source")
+	}
+	tag, err := parseTagFilter(currentUserID(c), c.Query("tag"))
+	if err != nil {
+		return q, err
+	}
+	q.Tag = tag
+	q.Flagged = c.QueryBool("flagged")
+	if q.Search = strings.TrimSpace(c.Query("q")); q.Search != "" {
+		if q.terms, err = searchTerms(q.Search); err != nil {
+			return q, err
+		}
+	}
+	if q.From != "" {
+		from, err := time.ParseInLocation("2006-01-02", q.From, time.Local)
+		if err != nil {
+			return q, errors.New("from must be a date like 2025-03-01")
+		}
+		q.from = from
+	}
+	if q.To != "" {
+		to, err := time.ParseInLocation("2006-01-02", q.To, time.Local)
+		if err != nil {
+			return q, errors.New("to must be a date like 2025-03-31")
+		}
+		q.to = to.AddDate(0, 0, 1)
+	}
+	if _, ok := roundSortColumns[q.Sort]; !ok {
+		return q, fmt.Errorf("sort must be one of id, start_time, end_time, group or duration")
+	}
+	if q.Order != "asc" && q.Order != "desc" {
+		return q, errors.New("order must be asc or desc")
+	}
+	if q.Page < 1 {
+		return q, errors.New("page must be 1 or more")
+	}
+	if q.PerPage < 1 || q.PerPage > maxRoundsPerPage {
+		return q, fmt.Errorf("per_page must be between 1 and %d", maxRoundsPerPage)
+	}
+	return q, nil
+}
+
+// values is the query string of the list with the given sorting and page, for links that keep the filters
+func (q roundListQuery) values(sort, order string, page int) string {
+	values := url.Values{}
+	if q.GroupID != 0 {
+		values.Set("group_id", strconv.FormatUint(uint64(q.GroupID), 10))
+	}
+	if q.Source != "" {
+		values.Set("source", q.Source)
+	}
+	if q.Tag != "" {
+		values.Set("tag", q.Tag)
+	}
+	if q.Search != "" {
+		values.Set("q", q.Search)
+	}
+	if q.Flagged {
+		values.Set("flagged", "1")
+	}
+	if q.From != "" {
+		values.Set("from", q.From)
+	}
+	if q.To != "" {
+		values.Set("to", q.To)
+	}
+	values.Set("sort", sort)
+	values.Set("order", order)
+	values.Set("page", strconv.Itoa(page))
+	if q.PerPage != defaultRoundsPerPage {
+		values.Set("per_page", strconv.Itoa(q.PerPage))
+	}
+	return values.Encode()
+}
+
+// roundListItem is a round with what the list shows next to it
+type roundListItem struct {
+	Round
+	GroupName       string `json:"group_name"`
+	DurationSeconds int64  `json:"duration_seconds"` // Up to now for running rounds
+}
+
+// roundListResponse is a page of GET /api/v1/rounds
+type roundListResponse struct {
+	Rounds     []roundListItem `json:"rounds"`
+	Page       int             `json:"page"`
+	PerPage    int             `json:"per_page"`
+	Total      int64           `json:"total"` // Rounds matching the filters, on all pages
+	TotalPages int             `json:"total_pages"`
+}
+
+// listRounds loads one page of the user's rounds matching q
+func listRounds(userID uint, q roundListQuery) (roundListResponse, error) {
+	filtered := func() *gorm.DB {
+		query := db.Model(&Round{}).Scopes(userRounds(userID))
+		if q.GroupID != 0 {
+			query = query.Where("rounds.working_group_id = ?", q.GroupID)
+		}
+		if q.Source != "" {
+			query = query.Where("rounds.source = ?", q.Source)
+		}
+		if q.Tag != "" {
+			query = query.Scopes(roundsTagged(userID, q.Tag))
+		}
+		if len(q.terms) > 0 {
+			query = query.Scopes(roundsMatching(q.terms))
+		}
+		if q.Flagged {
+			query = query.Where("rounds.flagged = ?", true)
+		}
+		if !q.from.IsZero() {
+			query = query.Where("rounds.start_time >= ?", q.from)
+		}
+		if !q.to.IsZero() {
+			query = query.Where("rounds.start_time < ?", q.to)
+		}
+		return query
+	}
+
+	response := roundListResponse{Rounds: []roundListItem{}, Page: q.Page, PerPage: q.PerPage}
+	if err := filtered().Count(&response.Total).Error; err != nil {
+		return response, err
+	}
+	response.TotalPages = int((response.Total + int64(q.PerPage) - 1) / int64(q.PerPage))
+
+	now := time.Now()
+	direction := " ASC"
+	if q.Order == "desc" {
+		direction = " DESC"
+	}
+	query := filtered().Joins("JOIN working_groups ON working_groups.id = rounds.working_group_id")
+	// rounds.id last keeps ties (rounds of one group, rounds still running) in the same order on every page
+	if q.Sort == "duration" {
+		query = query.Clauses(clause.OrderBy{Expression: clause.Expr{
+			SQL:  roundSecondsSQL() + direction + ", rounds.id DESC",
+			Vars: []interface{}{now},
+		}})
+	} else {
+		query = query.Order(roundSortColumns[q.Sort] + direction).Order("rounds.id DESC")
+	}
+
+	var rows []struct {
+		Round
+		GroupName string
+	}
+	err := query.Select("rounds.*, working_groups.name AS group_name").
+		Offset((q.Page - 1) * q.PerPage).Limit(q.PerPage).
+		Scan(&rows).Error
+	if err != nil {
+		return response, err
+	}
+	roundIDs := make([]uint, len(rows))
+	for i, row := range rows {
+		roundIDs[i] = row.ID
+	}
+	tags, err := loadRoundTags(roundIDs)
+	if err != nil {
+		return response, err
+	}
+	for _, row := range rows {
+		row.Tags = tagsNamed(tags[row.ID])
+		response.Rounds = append(response.Rounds, roundListItem{
+			Round:           row.Round,
+			GroupName:       row.GroupName,
+			DurationSeconds: roundWorkedSeconds(row.Round, now),
+		})
+	}
+	return response, nil
+}
+
+// renderRoundList shows the rounds page: every round, filtered by group and dates, sortable by column and paged
+func renderRoundList(c *fiber.Ctx) error {
+	q, err := parseRoundListQuery(c)
+	if err != nil {
+		return c.Status(400).SendString(err.Error())
+	}
+	userID := currentUserID(c)
+	page, err := listRounds(userID, q)
+	if err != nil {
+		requestLog(c).Println("Error listing rounds:", err)
+		return c.Status(500).SendString("Error loading rounds")
+	}
+	groups, err := getWorkingGroupsOrdered(userID)
+	if err != nil {
+		requestLog(c).Println("Error fetching working groups:", err)
+		return c.Status(500).SendString("Error loading rounds")
+	}
+
+	var rounds []fiber.Map
+	for _, round := range page.Rounds {
+		rounds = append(rounds, fiber.Map{
+			"ID":              round.ID,
+			"GroupName":       round.GroupName,
+			"GroupID":         round.WorkingGroupID,
+			"StartTime":       round.StartTime,
+			"EndTime":         round.EndTime,
+			"DurationSeconds": round.DurationSeconds,
+			"Note":            round.Note,
+			"Billed":          round.InvoiceID != nil,
+			"Billable":        roundBillable(round.Round),
+			"Flagged":         round.Flagged,
+			"SourceLabel":     roundSourceLabel(round.Source),
+			"Tags":            round.Tags,
+		})
+	}
+
+	// Clicking a column sorts by it, clicking the sorted column again flips the order
+	var columns []fiber.Map
+	for _, column := range []struct{ Key, Label string }{
+		{"id", "Round"}, {"group", "Working Group"}, {"start_time", "Start"}, {"end_time", "End"}, {"duration", "Duration"},
+	} {
+		order, arrow := "desc", ""
+		if column.Key == q.Sort {
+			if q.Order == "desc" {
+				order, arrow = "asc", "▼"
+			} else {
+				arrow = "▲"
+			}
+		}
+		columns = append(columns, fiber.Map{
+			"Label": column.Label,
+			"Query": q.values(column.Key, order, 1),
+			"Arrow": arrow,
+		})
+	}
+
+	var groupOptions []fiber.Map
+	for _, group := range groups {
+		groupOptions = append(groupOptions, fiber.Map{"ID": group.ID, "Name": group.Name, "Selected": group.ID == q.GroupID})
+	}
+	var sourceOptions []fiber.Map
+	for _, source := range roundSources {
+		sourceOptions = append(sourceOptions, fiber.Map{"Value": source.Value, "Label": source.Label, "Selected": source.Value == q.Source})
+	}
+	tagNames, err := userTagNames(userID)
+	if err != nil {
+		requestLog(c).Println("Error fetching tags:", err)
+		return c.Status(500).SendString("Error loading rounds")
+	}
+	var tagOptions []fiber.Map
+	for _, name := range tagNames {
+		tagOptions = append(tagOptions, fiber.Map{"Name": name, "Selected": name == q.Tag})
+	}
+	pagination := fiber.Map{"Page": page.Page, "TotalPages": page.TotalPages, "Total": page.Total}
+	if page.Page > 1 {
+		pagination["PrevQuery"] = q.values(q.Sort, q.Order, page.Page-1)
+	}
+	if page.Page < page.TotalPages {
+		pagination["NextQuery"] = q.values(q.Sort, q.Order, page.Page+1)
+	}
+
+	return c.Render("rounds", fiber.Map{
+		"Rounds":     rounds,
+		"Columns":    columns,
+		"Groups":     groupOptions,
+		"Sources":    sourceOptions,
+		"Tags":       tagOptions,
+		"Query":      q,
+		"Pagination": pagination,
+		"PerPage":    q.PerPage,
+		"Can":        permissionsView(c),
+	})
+}
+
+// apiListRounds serves GET /api/v1/rounds with the same filters, sorting and paging as the rounds page
+func apiListRounds(c *fiber.Ctx) error {
+	q, err := parseRoundListQuery(c)
+	if err != nil {
+		return c.Status(400).JSON(apiError{err.Error()})
+	}
+	page, err := listRounds(currentUserID(c), q)
+	if err != nil {
+		requestLog(c).Println("Error listing rounds:", err)
+		return c.Status(500).JSON(apiError{"error listing rounds"})
+	}
+	return c.JSON(page)
+}
@@ -0,0 +1,845 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var (
+	errGroupNotFound  = errors.New("working group not found")
+	errRoundRunning   = errors.New("working group already has a running round")
+	errNoRoundRunning = errors.New("no round is running for this working group")
+	errRoundNotFound  = errors.New("round not found")
+	errRoundBilled    = errors.New("round is already billed")
+	errInvalidTimes   = errors.New("round cannot end before it starts or be in the future")
+	errRoundOverlap   = errors.New("round overlaps another round of the working group")
+	errInvalidSplit   = errors.New("split time must fall inside the round")
+	errRoundChanged   = errors.New("round changed in the meantime")
+	errInvalidMerge   = errors.New("rounds cannot be merged")
+)
+
+// ClientInfo describes the device or program that issued a request
+type ClientInfo struct {
+	UserID    uint   // Account the request acts for
+	Name      string // Short label such as "browser", "curl" or a value sent via X-Client-Name
+	UserAgent string
+	RemoteIP  string
+	TimeZone  string // IANA time zone the client is in, empty when unknown or home
+	Source    string // Recorded as the source of rounds the client creates
+}
+
+func clientInfoFromRequest(c *fiber.Ctx) ClientInfo {
+	userAgent := c.Get(fiber.HeaderUserAgent)
+	name := strings.TrimSpace(c.Get("X-Client-Name"))
+	token := requestToken(c)
+	if token != nil {
+		name = "token:" + token.Name
+	} else if name == "" {
+		name = clientNameFromUserAgent(userAgent)
+	}
+	return ClientInfo{
+		UserID:    currentUserID(c),
+		Name:      truncateString(name, 64),
+		UserAgent: truncateString(userAgent, 255),
+		RemoteIP:  c.IP(),
+		TimeZone:  clientTimeZone(c),
+		Source:    requestSource(name, token != nil),
+	}
+}
+
+func clientNameFromUserAgent(userAgent string) string {
+	fields := strings.Fields(userAgent)
+	if len(fields) == 0 {
+		return "unknown"
+	}
+	if strings.HasPrefix(userAgent, "Mozilla/") {
+		return "browser"
+	}
+	// Use the product token, e.g. "curl" from "curl/8.4.0"
+	product := fields[0]
+	if i := strings.Index(product, "/"); i > 0 {
+		product = product[:i]
+	}
+	return product
+}
+
+func truncateString(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+	return value[:max]
+}
+
+// startRound opens a new round for one of the client user's groups, refusing if one is already running
+func startRound(groupID uint, client ClientInfo) (Round, error) {
+	group, err := findUserGroup(client.UserID, groupID)
+	if err != nil {
+		return Round{}, errGroupNotFound
+	}
+
+	var activeRound Round
+	if err := db.Where("working_group_id = ? AND end_time IS NULL", groupID).First(&activeRound).Error; err == nil {
+		return Round{}, errRoundRunning
+	}
+
+	round := Round{
+		StartTime:      time.Now(),
+		WorkingGroupID: groupID,
+		StartedBy:      client.Name,
+		StartUserAgent: client.UserAgent,
+		TimeZone:       client.TimeZone,
+		Source:         client.Source,
+	}
+
+	if err := db.Create(&round).Error; err != nil {
+		log.Println("Error creating round:", err)
+		return Round{}, err
+	}
+
+	log.Printf("Started new round #%d for group '%s' at %s (by %s)", round.ID, group.Name, round.StartTime.Format("2006-01-02 15:04:05"), client.Name)
+	recordAudit("round.start", client, groupID, &round.ID, fmt.Sprintf("Started round for '%s'", group.Name))
+	notifyRoundChange(groupID)
+
+	return round, nil
+}
+
+// stopRound closes the running round of one of the client user's groups
+func stopRound(groupID uint, client ClientInfo) (Round, error) {
+	group, err := findUserGroup(client.UserID, groupID)
+	if err != nil {
+		return Round{}, errGroupNotFound
+	}
+
+	var activeRound Round
+	if err := db.Where("working_group_id = ? AND end_time IS NULL", groupID).First(&activeRound).Error; err != nil {
+		return Round{}, errNoRoundRunning
+	}
+
+	now := time.Now()
+	activeRound.EndTime = &now
+	activeRound.StoppedBy = client.Name
+	activeRound.StopUserAgent = client.UserAgent
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return settleStoppedRound(tx, &activeRound, client.UserID)
+	}); err != nil {
+		log.Println("Error updating round:", err)
+		return Round{}, err
+	}
+
+	duration := time.Duration(roundWorkedSeconds(activeRound, now)) * time.Second
+	verb := "Stopped"
+	if activeRound.Discarded {
+		verb = "Discarded"
+	}
+	log.Printf("%s round #%d for group '%s' at %s (duration: %s, by %s)",
+		verb,
+		activeRound.ID,
+		group.Name,
+		now.Format("2006-01-02 15:04:05"),
+		duration.Round(time.Second),
+		client.Name)
+	recordStop(client, activeRound, group.Name, "")
+	notifyRoundChange(groupID)
+	if !activeRound.Discarded {
+		pushRoundMetric(activeRound, group)
+	}
+
+	return activeRound, nil
+}
+
+// stopAllRounds closes every running round of the client user in one transaction, so either all of them stop at
+// the same moment or none does
+func stopAllRounds(client ClientInfo) ([]Round, error) {
+	now := time.Now()
+	var rounds []Round
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Preload("WorkingGroup").Scopes(userRounds(client.UserID)).Where("end_time IS NULL").
+			Order("start_time ASC").Find(&rounds).Error; err != nil {
+			return err
+		}
+		for i := range rounds {
+			rounds[i].EndTime = &now
+			rounds[i].StoppedBy = client.Name
+			rounds[i].StopUserAgent = client.UserAgent
+			if err := settleStoppedRound(tx, &rounds[i], client.UserID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println("Error stopping all rounds:", err)
+		return nil, err
+	}
+
+	for _, round := range rounds {
+		duration := time.Duration(roundWorkedSeconds(round, now)) * time.Second
+		verb := "Stopped"
+		if round.Discarded {
+			verb = "Discarded"
+		}
+		log.Printf("%s round #%d for group '%s' at %s (duration: %s, by %s, stop all)",
+			verb, round.ID, round.WorkingGroup.Name, now.Format("2006-01-02 15:04:05"), duration, client.Name)
+		recordStop(client, round, round.WorkingGroup.Name, " (stop all)")
+		notifyRoundChange(round.WorkingGroupID)
+		if !round.Discarded {
+			pushRoundMetric(round, round.WorkingGroup)
+		}
+	}
+	return rounds, nil
+}
+
+// updateRound changes the group and times of a round of one of the client user's groups; a nil end leaves it
+// running and a nil billable keeps whether it is billable. Billed rounds cannot change, a group never gets a
+// second running round, and overlaps with other groups' rounds follow their overlap policies.
+func updateRound(roundID, groupID uint, start time.Time, end *time.Time, billable *bool, client ClientInfo) (Round, error) {
+	var round Round
+	if err := db.Preload("WorkingGroup").Scopes(userRounds(client.UserID)).First(&round, roundID).Error; err != nil {
+		return Round{}, errRoundNotFound
+	}
+	if round.InvoiceID != nil {
+		return Round{}, errRoundBilled
+	}
+	group, err := findUserGroup(client.UserID, groupID)
+	if err != nil {
+		return Round{}, errGroupNotFound
+	}
+	now := time.Now()
+	if start.After(now) || (end != nil && (end.Before(start) || end.After(now))) {
+		return Round{}, errInvalidTimes
+	}
+
+	before, previousGroup, wasBillable := roundSpan(round.StartTime, round.EndTime), round.WorkingGroup, roundBillable(round)
+	wasFlagged := round.Flagged
+	round.StartTime = start
+	round.EndTime = end
+	round.WorkingGroupID = group.ID
+	if billable != nil {
+		round.Billable = billable
+	}
+	round.Flagged = false // Setting its times is as good as reviewing it
+	var warned []Round
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if warned, err = checkOverlapPolicy(tx, client.UserID, round, group); err != nil {
+			return err
+		}
+		if end == nil {
+			var running int64
+			if err := tx.Model(&Round{}).Where("working_group_id = ? AND end_time IS NULL AND id <> ?", group.ID, round.ID).
+				Count(&running).Error; err != nil {
+				return err
+			}
+			if running > 0 {
+				return errRoundRunning
+			}
+		}
+		if err := tx.Model(&round).Select("start_time", "end_time", "working_group_id", "billable", "flagged").Updates(&round).Error; err != nil {
+			return err
+		}
+		return fitRoundPauses(tx, &round, now)
+	})
+	if errors.Is(err, errRoundRunning) || errors.Is(err, errOverlapRejected) {
+		return Round{}, err
+	}
+	if err != nil {
+		log.Println("Error updating round:", err)
+		return Round{}, err
+	}
+	round.WorkingGroup = group
+	round.Overlaps = overlapIDs(warned)
+
+	details := fmt.Sprintf("Moved round of '%s' from %s to %s", previousGroup.Name, before, roundSpan(round.StartTime, round.EndTime))
+	if previousGroup.ID != group.ID {
+		details += fmt.Sprintf(", now in '%s'", group.Name)
+		notifyRoundChange(previousGroup.ID)
+	}
+	switch {
+	case roundBillable(round) && !wasBillable:
+		details += ", now billable"
+	case !roundBillable(round) && wasBillable:
+		details += ", now non-billable"
+	}
+	if wasFlagged {
+		details += ", no longer flagged"
+	}
+	details += overlapDetails(warned)
+	recordAudit("round.update", client, round.WorkingGroupID, &round.ID, details)
+	notifyRoundChange(round.WorkingGroupID)
+	return round, nil
+}
+
+// addManualRound records a finished round that was never timed, such as a session someone forgot to start. It may not
+// overlap another round of the group, running ones included, and overlaps with other groups' rounds follow their
+// overlap policies.
+func addManualRound(groupID uint, start, end time.Time, note string, client ClientInfo) (Round, error) {
+	group, err := findUserGroup(client.UserID, groupID)
+	if err != nil {
+		return Round{}, errGroupNotFound
+	}
+	if !end.After(start) || end.After(time.Now()) {
+		return Round{}, errInvalidTimes
+	}
+
+	round := Round{
+		StartTime:      start,
+		EndTime:        &end,
+		WorkingGroupID: group.ID,
+		StartedBy:      client.Name,
+		StartUserAgent: client.UserAgent,
+		StoppedBy:      client.Name,
+		StopUserAgent:  client.UserAgent,
+		Note:           truncateString(strings.TrimSpace(note), 500),
+		TimeZone:       client.TimeZone,
+		Source:         client.Source,
+	}
+	var warned []Round
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var existing Round
+		err := tx.Where("working_group_id = ? AND start_time < ? AND (end_time IS NULL OR end_time > ?)", group.ID, end, start).
+			Order("start_time ASC").Take(&existing).Error
+		if err == nil {
+			return fmt.Errorf("%w: #%d, %s", errRoundOverlap, existing.ID, roundSpan(existing.StartTime, existing.EndTime))
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if warned, err = checkOverlapPolicy(tx, client.UserID, round, group); err != nil {
+			return err
+		}
+		return tx.Create(&round).Error
+	})
+	if errors.Is(err, errRoundOverlap) || errors.Is(err, errOverlapRejected) {
+		return Round{}, err
+	}
+	if err != nil {
+		log.Println("Error creating manual round:", err)
+		return Round{}, err
+	}
+
+	recordAudit("round.manual", client, group.ID, &round.ID,
+		fmt.Sprintf("Added %s for '%s' by hand (%s)%s", end.Sub(start).Round(time.Second), group.Name, roundSpan(start, &end),
+			overlapDetails(warned)))
+	notifyRoundChange(group.ID)
+	pushRoundMetric(round, group)
+	round.WorkingGroup = group
+	round.Overlaps = overlapIDs(warned)
+	return round, nil
+}
+
+// manualRoundHandler saves the form for adding a forgotten round
+func manualRoundHandler(c *fiber.Ctx) error {
+	groupID, err := parseGroupID(c.FormValue("group_id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid working group")
+	}
+	start, err := parseRoundInput(c.FormValue("start"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid start time")
+	}
+	end, err := parseRoundInput(c.FormValue("end"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid end time")
+	}
+
+	round, err := addManualRound(groupID, start, end, c.FormValue("note"), clientInfoFromRequest(c))
+	switch {
+	case errors.Is(err, errGroupNotFound):
+		return c.Status(404).SendString("Working group not found")
+	case errors.Is(err, errInvalidTimes):
+		return c.Status(400).SendString("The round must end after it starts and cannot be in the future")
+	case errors.Is(err, errRoundOverlap), errors.Is(err, errOverlapRejected):
+		return c.Status(409).SendString("The round " + strings.TrimPrefix(err.Error(), "round "))
+	case err != nil:
+		return c.Status(500).SendString("Error adding round")
+	}
+	return c.Redirect(fmt.Sprintf("/rounds/%d", round.ID), fiber.StatusSeeOther)
+}
+
+// splitRound cuts a round of one of the client user's groups in two: the round itself ends at at, and a new round
+// runs from resume to where the round ended. A resume later than at leaves a gap between the two, such as a lunch
+// break carved out of a long session. A running round keeps running as the second part.
+//
+// The new round belongs to the same group, or to groupID when a session covered two projects; it then takes that
+// group's billable setting and may not overlap its rounds. Overlaps with other groups' rounds follow their overlap
+// policies.
+func splitRound(roundID uint, at, resume time.Time, groupID uint, client ClientInfo) (Round, Round, error) {
+	var first Round
+	if err := db.Preload("WorkingGroup").Preload("Tags").Scopes(userRounds(client.UserID)).First(&first, roundID).Error; err != nil {
+		return Round{}, Round{}, errRoundNotFound
+	}
+	if first.InvoiceID != nil {
+		return Round{}, Round{}, errRoundBilled
+	}
+	end := time.Now()
+	if first.EndTime != nil {
+		end = *first.EndTime
+	}
+	if !at.After(first.StartTime) || resume.Before(at) || !resume.Before(end) {
+		return Round{}, Round{}, errInvalidSplit
+	}
+	group := first.WorkingGroup
+	billable := first.Billable
+	if groupID != 0 && groupID != first.WorkingGroupID {
+		var err error
+		if group, err = findUserGroup(client.UserID, groupID); err != nil {
+			return Round{}, Round{}, errGroupNotFound
+		}
+		billable = &group.Billable
+	}
+
+	second := Round{
+		StartTime:      resume,
+		EndTime:        first.EndTime,
+		WorkingGroupID: group.ID,
+		StartedBy:      client.Name,
+		StartUserAgent: client.UserAgent,
+		StoppedBy:      first.StoppedBy,
+		StopUserAgent:  first.StopUserAgent,
+		Billable:       billable,
+		Note:           first.Note,
+		TimeZone:       first.TimeZone,
+		Source:         first.Source,
+		Tags:           first.Tags,
+	}
+	before := roundSpan(first.StartTime, first.EndTime)
+	first.EndTime = &at
+	first.StoppedBy = client.Name
+	first.StopUserAgent = client.UserAgent
+	var warned []Round
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// The round may have been stopped, edited or billed since it was read; only split it as it was
+		var current Round
+		if err := tx.Take(&current, first.ID).Error; err != nil {
+			return errRoundNotFound
+		}
+		if current.InvoiceID != nil {
+			return errRoundBilled
+		}
+		if (current.EndTime == nil) != (second.EndTime == nil) || (current.EndTime != nil && !current.EndTime.Equal(*second.EndTime)) ||
+			!current.StartTime.Equal(first.StartTime) {
+			return errRoundChanged
+		}
+		if group.ID != first.WorkingGroupID {
+			// Same rules as adding a round by hand, and a group never gets a second running round
+			var existing Round
+			err := tx.Where("working_group_id = ? AND start_time < ? AND (end_time IS NULL OR end_time > ?)", group.ID, end, resume).
+				Order("start_time ASC").Take(&existing).Error
+			switch {
+			case err == nil && existing.EndTime == nil && second.EndTime == nil:
+				return errRoundRunning
+			case err == nil:
+				return fmt.Errorf("%w: #%d, %s", errRoundOverlap, existing.ID, roundSpan(existing.StartTime, existing.EndTime))
+			case !errors.Is(err, gorm.ErrRecordNotFound):
+				return err
+			}
+		}
+		if err := tx.Model(&first).Select("end_time", "stopped_by", "stop_user_agent").Updates(&first).Error; err != nil {
+			return err
+		}
+		// Checked once the round is cut short, so the rest doesn't count as overlapping it
+		var err error
+		if warned, err = checkOverlapPolicy(tx, client.UserID, second, group); err != nil {
+			return err
+		}
+		if err := tx.Omit("WorkingGroup").Create(&second).Error; err != nil {
+			return err
+		}
+		return splitRoundPauses(tx, &first, &second, resume, time.Now())
+	})
+	if errors.Is(err, errRoundNotFound) || errors.Is(err, errRoundBilled) || errors.Is(err, errRoundChanged) ||
+		errors.Is(err, errRoundRunning) || errors.Is(err, errRoundOverlap) || errors.Is(err, errOverlapRejected) {
+		return Round{}, Round{}, err
+	}
+	if err != nil {
+		log.Println("Error splitting round:", err)
+		return Round{}, Round{}, err
+	}
+	second.WorkingGroup = group
+	second.Overlaps = overlapIDs(warned)
+
+	details := fmt.Sprintf("Split round of '%s' (%s) into #%d %s and #%d %s", first.WorkingGroup.Name, before,
+		first.ID, roundSpan(first.StartTime, first.EndTime), second.ID, roundSpan(second.StartTime, second.EndTime))
+	if group.ID != first.WorkingGroupID {
+		details += fmt.Sprintf(" in '%s'", group.Name)
+	}
+	if resume.After(at) {
+		details += fmt.Sprintf(", leaving out %s", resume.Sub(at).Round(time.Second))
+	}
+	recordAudit("round.split", client, first.WorkingGroupID, &first.ID, details)
+	recordAudit("round.split", client, second.WorkingGroupID, &second.ID, details+overlapDetails(warned))
+	notifyRoundChange(first.WorkingGroupID)
+	if group.ID != first.WorkingGroupID {
+		notifyRoundChange(group.ID)
+	}
+	return first, second, nil
+}
+
+// splitRoundHandler saves the split form of the round page; an empty resume time continues right at the split, and
+// an empty group keeps the rest in the round's group
+func splitRoundHandler(c *fiber.Ctx) error {
+	id, err := parseGroupID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid round")
+	}
+	at, err := parseRoundInput(c.FormValue("at"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid split time")
+	}
+	resume := at
+	if value := c.FormValue("resume"); value != "" {
+		if resume, err = parseRoundInput(value); err != nil {
+			return c.Status(400).SendString("Invalid resume time")
+		}
+	}
+	var groupID uint
+	if value := c.FormValue("group_id"); value != "" {
+		if groupID, err = parseGroupID(value); err != nil {
+			return c.Status(400).SendString("Invalid working group")
+		}
+	}
+
+	_, _, err = splitRound(id, at, resume, groupID, clientInfoFromRequest(c))
+	switch {
+	case errors.Is(err, errRoundNotFound):
+		return c.Status(404).SendString("Round not found")
+	case errors.Is(err, errGroupNotFound):
+		return c.Status(404).SendString("Working group not found")
+	case errors.Is(err, errRoundRunning):
+		return c.Status(409).SendString("The other group already has a running round")
+	case errors.Is(err, errRoundOverlap):
+		return c.Status(409).SendString("The rest of the round would overlap a round of the other group (" + err.Error() + ")")
+	case errors.Is(err, errOverlapRejected):
+		return c.Status(409).SendString("The rest of the round " + strings.TrimPrefix(err.Error(), "round "))
+	case errors.Is(err, errRoundBilled):
+		return c.Status(409).SendString("Billed rounds cannot be split")
+	case errors.Is(err, errInvalidSplit):
+		return c.Status(400).SendString("The split must fall inside the round, and the round must resume before it ends")
+	case errors.Is(err, errRoundChanged):
+		return c.Status(409).SendString("The round was changed in the meantime; reload the page and try again")
+	case err != nil:
+		return c.Status(500).SendString("Error splitting round")
+	}
+	return c.Redirect(fmt.Sprintf("/rounds/%d", id), fiber.StatusSeeOther)
+}
+
+// mergeRounds joins consecutive rounds of one of the client user's groups into the earliest of them, which then runs
+// from the earliest start to the latest end, e.g. after a flaky connection stopped and restarted a round. The other
+// rounds are deleted and their attachments move to the merged round. Rounds with another round of the group between
+// them, billed rounds and a mix of billable and non-billable rounds are refused.
+func mergeRounds(roundIDs []uint, client ClientInfo) (Round, error) {
+	ids := make([]uint, 0, len(roundIDs))
+	seen := make(map[uint]bool, len(roundIDs))
+	for _, id := range roundIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) < 2 {
+		return Round{}, fmt.Errorf("%w: choose at least two rounds", errInvalidMerge)
+	}
+
+	var merged Round
+	var removed []Round
+	var gaps time.Duration
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var rounds []Round
+		if err := tx.Preload("WorkingGroup").Preload("Tags").Scopes(userRounds(client.UserID)).Where("id IN ?", ids).
+			Order("start_time ASC, id ASC").Find(&rounds).Error; err != nil {
+			return err
+		}
+		if len(rounds) != len(ids) {
+			return errRoundNotFound
+		}
+		merged, removed = rounds[0], rounds[1:]
+		end := merged.EndTime
+		stopped := merged
+		for _, round := range rounds {
+			switch {
+			case round.InvoiceID != nil:
+				return errRoundBilled
+			case round.WorkingGroupID != merged.WorkingGroupID:
+				return fmt.Errorf("%w: the rounds belong to different working groups", errInvalidMerge)
+			case roundBillable(round) != roundBillable(merged):
+				return fmt.Errorf("%w: some of the rounds are billable and some are not", errInvalidMerge)
+			}
+			if end != nil && round.StartTime.After(*end) {
+				gaps += round.StartTime.Sub(*end)
+			}
+			if round.EndTime == nil || (end != nil && round.EndTime.After(*end)) {
+				end = round.EndTime
+				stopped = round
+			}
+		}
+
+		// Merging across a round that isn't part of the merge would swallow it
+		until := time.Now()
+		if end != nil {
+			until = *end
+		}
+		var between Round
+		err := tx.Where("working_group_id = ? AND id NOT IN ? AND start_time < ? AND (end_time IS NULL OR end_time > ?)",
+			merged.WorkingGroupID, ids, until, merged.StartTime).Order("start_time ASC").Take(&between).Error
+		if err == nil {
+			return fmt.Errorf("%w: round #%d (%s) lies between them", errInvalidMerge, between.ID, roundSpan(between.StartTime, between.EndTime))
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		var notes []string
+		for _, round := range rounds {
+			if note := strings.TrimSpace(round.Note); note != "" && !slices.Contains(notes, note) {
+				notes = append(notes, note)
+			}
+		}
+		merged.EndTime = end
+		merged.StoppedBy = stopped.StoppedBy
+		merged.StopUserAgent = stopped.StopUserAgent
+		merged.Note = truncateString(strings.Join(notes, "\n"), 500)
+		if err := tx.Model(&merged).Select("end_time", "stopped_by", "stop_user_agent", "note").Updates(&merged).Error; err != nil {
+			return err
+		}
+		removedIDs := make([]uint, 0, len(removed))
+		for _, round := range removed {
+			removedIDs = append(removedIDs, round.ID)
+		}
+		if err := tx.Model(&Attachment{}).Where("round_id IN ?", removedIDs).Update("round_id", merged.ID).Error; err != nil {
+			return err
+		}
+		// Breaks taken in any of them stay breaks; the gaps between the rounds count as work
+		if err := tx.Model(&RoundPause{}).Where("round_id IN ?", removedIDs).Update("round_id", merged.ID).Error; err != nil {
+			return err
+		}
+		if err := fitRoundPauses(tx, &merged, time.Now()); err != nil {
+			return err
+		}
+		// The merged round carries the tags of all of them
+		var tags []Tag
+		for _, round := range removed {
+			for _, tag := range round.Tags {
+				if !slices.ContainsFunc(merged.Tags, func(t Tag) bool { return t.ID == tag.ID }) &&
+					!slices.ContainsFunc(tags, func(t Tag) bool { return t.ID == tag.ID }) {
+					tags = append(tags, tag)
+				}
+			}
+		}
+		if len(tags) > 0 {
+			if err := tx.Model(&merged).Association("Tags").Append(tags); err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(&Round{}, removedIDs).Error; err != nil {
+			return err
+		}
+		for _, round := range removed {
+			if err := recordTombstone(tx, client.UserID, "round", round.ID, round.SyncID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errRoundNotFound) || errors.Is(err, errRoundBilled) || errors.Is(err, errInvalidMerge) {
+		return Round{}, err
+	}
+	if err != nil {
+		log.Println("Error merging rounds:", err)
+		return Round{}, err
+	}
+
+	var removedLabels []string
+	for _, round := range removed {
+		removedLabels = append(removedLabels, fmt.Sprintf("#%d", round.ID))
+	}
+	details := fmt.Sprintf("Merged %s into this round of '%s', now %s", strings.Join(removedLabels, ", "),
+		merged.WorkingGroup.Name, roundSpan(merged.StartTime, merged.EndTime))
+	if gaps > 0 {
+		details += fmt.Sprintf(", including %s between them", gaps.Round(time.Second))
+	}
+	recordAudit("round.merge", client, merged.WorkingGroupID, &merged.ID, details)
+	notifyRoundChange(merged.WorkingGroupID)
+	return merged, nil
+}
+
+// mergeRoundsHandler merges the rounds ticked on the rounds page
+func mergeRoundsHandler(c *fiber.Ctx) error {
+	var ids []uint
+	for _, value := range c.Request().PostArgs().PeekMulti("round_id") {
+		id, err := parseGroupID(string(value))
+		if err != nil {
+			return c.Status(400).SendString("Invalid round")
+		}
+		ids = append(ids, id)
+	}
+
+	round, err := mergeRounds(ids, clientInfoFromRequest(c))
+	switch {
+	case errors.Is(err, errRoundNotFound):
+		return c.Status(404).SendString("Round not found")
+	case errors.Is(err, errRoundBilled):
+		return c.Status(409).SendString("Billed rounds cannot be merged")
+	case errors.Is(err, errInvalidMerge):
+		return c.Status(400).SendString("The " + err.Error())
+	case err != nil:
+		return c.Status(500).SendString("Error merging rounds")
+	}
+	return c.Redirect(fmt.Sprintf("/rounds/%d", round.ID), fiber.StatusSeeOther)
+}
+
+// roundSpan renders a round's times for audit details, e.g. "2025-03-03 09:00–12:30"
+func roundSpan(start time.Time, end *time.Time) string {
+	span := start.Format("2006-01-02 15:04")
+	switch {
+	case end == nil:
+		return span + "–now"
+	case end.Format("2006-01-02") == start.Format("2006-01-02"):
+		return span + "–" + end.Format("15:04")
+	default:
+		return span + "–" + end.Format("2006-01-02 15:04")
+	}
+}
+
+func renderRoundDetail(c *fiber.Ctx) error {
+	id, err := parseGroupID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid round")
+	}
+
+	var round Round
+	if err := db.Preload("WorkingGroup").Scopes(userRounds(currentUserID(c))).First(&round, id).Error; err != nil {
+		return c.Status(404).SendString("Round not found")
+	}
+
+	seconds := roundWorkedSeconds(round, time.Now())
+
+	var entries []AuditEntry
+	if err := db.Where("round_id = ?", round.ID).Order("created_at ASC").Find(&entries).Error; err != nil {
+		requestLog(c).Println("Error fetching audit entries for round:", err)
+	}
+
+	var list []Attachment
+	if err := db.Where("round_id = ?", round.ID).Order("created_at ASC").Find(&list).Error; err != nil {
+		requestLog(c).Println("Error fetching attachments for round:", err)
+	}
+
+	var groupOptions []StatusGroupOption
+	if groups, err := getWorkingGroupsOrdered(currentUserID(c)); err == nil {
+		paths := groupPaths(groups)
+		for _, group := range groups {
+			groupOptions = append(groupOptions, StatusGroupOption{ID: group.ID, Name: paths[group.ID], Selected: group.ID == round.WorkingGroupID})
+		}
+	} else {
+		requestLog(c).Println("Error fetching working groups:", err)
+	}
+	endInput := ""
+	if round.EndTime != nil {
+		endInput = round.EndTime.Format(roundInputLayout)
+	}
+	roundTags, err := loadRoundTags([]uint{round.ID})
+	if err != nil {
+		requestLog(c).Println("Error fetching tags for round:", err)
+	}
+	overlaps, err := findOverlaps(db, currentUserID(c), round, round.WorkingGroup)
+	if err != nil {
+		requestLog(c).Println("Error fetching overlapping rounds:", err)
+	}
+	pauses, err := loadRoundPauses(round.ID)
+	if err != nil {
+		requestLog(c).Println("Error fetching pauses for round:", err)
+	}
+
+	return c.Render("round", fiber.Map{
+		"Round":            round,
+		"GroupName":        round.WorkingGroup.Name,
+		"IsRunning":        round.EndTime == nil,
+		"DurationSeconds":  seconds,
+		"AuditEntries":     auditEntryViews(entries),
+		"ActionLink":       c.Locals("actionLink"),
+		"Attachments":      attachmentViews(list),
+		"Date":             round.StartTime.Format("2006-01-02"),
+		"GroupOptions":     groupOptions,
+		"StartInput":       round.StartTime.Format(roundInputLayout),
+		"EndInput":         endInput,
+		"Billable":         roundBillable(round),
+		"LocalTimes":       roundLocalTimes(round),
+		"SourceLabel":      roundSourceLabel(round.Source),
+		"Tags":             tagViews(roundTags[round.ID]),
+		"TagsInput":        strings.Join(roundTags[round.ID], ", "),
+		"Can":              permissionsView(c),
+		"MinRoundDuration": minRoundShown(),
+		"Overlaps":         overlapViews(overlaps),
+		"Pauses":           roundPauseViews(pauses),
+	})
+}
+
+// roundInputLayout is the value format of datetime-local inputs with seconds
+const roundInputLayout = "2006-01-02T15:04:05"
+
+// parseRoundInput reads a datetime-local value in local time; browsers leave out the seconds when they are zero
+func parseRoundInput(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation(roundInputLayout, value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02T15:04", value, time.Local)
+}
+
+// editRoundHandler saves the edit form of the round page; an empty end leaves the round running
+func editRoundHandler(c *fiber.Ctx) error {
+	id, err := parseGroupID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid round")
+	}
+	groupID, err := parseGroupID(c.FormValue("group_id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid working group")
+	}
+	start, err := parseRoundInput(c.FormValue("start"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid start time")
+	}
+	var end *time.Time
+	if value := c.FormValue("end"); value != "" {
+		parsed, err := parseRoundInput(value)
+		if err != nil {
+			return c.Status(400).SendString("Invalid end time")
+		}
+		end = &parsed
+	}
+	billable := c.FormValue("billable") == "on"
+	tags, err := parseTagNames(c.FormValue("tags"))
+	if err != nil {
+		return c.Status(400).SendString(err.Error())
+	}
+
+	client := clientInfoFromRequest(c)
+	round, err := updateRound(id, groupID, start, end, &billable, client)
+	switch {
+	case errors.Is(err, errRoundNotFound):
+		return c.Status(404).SendString("Round not found")
+	case errors.Is(err, errGroupNotFound):
+		return c.Status(404).SendString("Working group not found")
+	case errors.Is(err, errRoundBilled):
+		return c.Status(409).SendString("Billed rounds cannot be edited")
+	case errors.Is(err, errRoundRunning):
+		return c.Status(409).SendString("That working group already has a running round; give this one an end time")
+	case errors.Is(err, errOverlapRejected):
+		return c.Status(409).SendString("The round " + strings.TrimPrefix(err.Error(), "round "))
+	case errors.Is(err, errInvalidTimes):
+		return c.Status(400).SendString("The round cannot end before it starts or be in the future")
+	case err != nil:
+		return c.Status(500).SendString("Error updating round")
+	}
+	if err := tagRound(&round, tags, client); err != nil {
+		requestLog(c).Println("Error tagging round:", err)
+		return c.Status(500).SendString("The round was saved, but its tags could not be")
+	}
+	return c.Redirect(fmt.Sprintf("/rounds/%d", id), fiber.StatusSeeOther)
+}
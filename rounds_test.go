@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestSplitRoundFollowsOverlapPolicy splits a round so the rest goes to another group, over a round of a third group
+// whose policy rejects overlaps, then warns about them
+func TestSplitRoundFollowsOverlapPolicy(t *testing.T) {
+	useTestDatabase(t, "sqlite", "")
+	user, group := createTestGroup(t)
+	target := WorkingGroup{UserID: user.ID, Name: "Target", Billable: true}
+	strict := WorkingGroup{UserID: user.ID, Name: "Strict", Billable: true, OverlapPolicy: overlapReject}
+	for _, g := range []*WorkingGroup{&target, &strict} {
+		if err := db.Create(g).Error; err != nil {
+			t.Fatalf("creating group: %v", err)
+		}
+	}
+	t.Cleanup(func() {
+		db.Where("working_group_id IN ?", []uint{target.ID, strict.ID}).Delete(&Round{})
+		db.Delete(&target)
+		db.Delete(&strict)
+	})
+
+	now := time.Now().Truncate(time.Second)
+	end := now.Add(-time.Hour)
+	start := end.Add(-2 * time.Hour)
+	otherEnd := end.Add(-15 * time.Minute)
+	round := Round{WorkingGroupID: group.ID, StartTime: start, EndTime: &end, Source: sourceManual}
+	other := Round{WorkingGroupID: strict.ID, StartTime: otherEnd.Add(-30 * time.Minute), EndTime: &otherEnd, Source: sourceManual}
+	for _, r := range []*Round{&round, &other} {
+		if err := db.Create(r).Error; err != nil {
+			t.Fatalf("creating round: %v", err)
+		}
+	}
+	client := ClientInfo{UserID: user.ID, Name: "test"}
+	at := start.Add(time.Hour)
+
+	if _, _, err := splitRound(round.ID, at, at, target.ID, client); !errors.Is(err, errOverlapRejected) {
+		t.Fatalf("split over a rejecting group = %v, want %v", err, errOverlapRejected)
+	}
+	var unchanged Round
+	db.First(&unchanged, round.ID)
+	if unchanged.EndTime == nil || !unchanged.EndTime.Equal(end) {
+		t.Errorf("the refused split still moved the round's end to %v", unchanged.EndTime)
+	}
+
+	if err := db.Model(&strict).Update("overlap_policy", overlapWarn).Error; err != nil {
+		t.Fatalf("changing policy: %v", err)
+	}
+	_, second, err := splitRound(round.ID, at, at, target.ID, client)
+	if err != nil {
+		t.Fatalf("split over a warning group: %v", err)
+	}
+	// Only the other group's round, not the round it was split from, which now ends where it starts
+	if len(second.Overlaps) != 1 || second.Overlaps[0] != other.ID {
+		t.Errorf("second part overlaps %v, want [%d]", second.Overlaps, other.ID)
+	}
+	if second.WorkingGroupID != target.ID {
+		t.Errorf("second part is in group %d, want %d", second.WorkingGroupID, target.ID)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// maxSearchTerms is how many words a search may have
+const maxSearchTerms = 10
+
+// roundSearchFTS is set at startup when the SQLite build has FTS5 and the round_search index is in place. Otherwise
+// searches fall back to LIKE (ILIKE on PostgreSQL), which finds the same rounds by scanning them.
+var roundSearchFTS bool
+
+// roundSearchTriggers keep round_search in step with rounds and their tags, whichever code path changes them. The
+// index row of a round has the round's ID as its rowid.
+var roundSearchTriggers = []struct{ Name, SQL string }{
+	{"round_search_insert", `AFTER INSERT ON rounds BEGIN
+		INSERT INTO round_search (rowid, note, tags) VALUES (new.id, new.note, '');
+	END`},
+	{"round_search_update", `AFTER UPDATE OF note ON rounds BEGIN
+		UPDATE round_search SET note = new.note WHERE rowid = new.id;
+	END`},
+	{"round_search_delete", `AFTER DELETE ON rounds BEGIN
+		DELETE FROM round_search WHERE rowid = old.id;
+	END`},
+	{"round_search_tag_insert", `AFTER INSERT ON round_tags BEGIN
+		UPDATE round_search SET tags = (` + roundSearchTagsSQL("new.round_id") + `) WHERE rowid = new.round_id;
+	END`},
+	{"round_search_tag_delete", `AFTER DELETE ON round_tags BEGIN
+		UPDATE round_search SET tags = (` + roundSearchTagsSQL("old.round_id") + `) WHERE rowid = old.round_id;
+	END`},
+}
+
+// roundSearchTagsSQL selects the tag names of a round as the index stores them, separated by spaces
+func roundSearchTagsSQL(roundID string) string {
+	return "SELECT COALESCE(group_concat(tags.name, ' '), '') FROM round_tags JOIN tags ON tags.id = round_tags.tag_id " +
+		"WHERE round_tags.round_id = " + roundID
+}
+
+// setupRoundSearch creates the FTS5 index of round notes and tags on SQLite, filling it from the existing rounds when
+// its triggers weren't in place. FTS5 needs the sqlite_fts5 build tag; without it searches use LIKE.
+func setupRoundSearch() {
+	if db.Dialector.Name() != "sqlite" {
+		return
+	}
+	var triggers int64
+	err := db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'round_search_%'").Scan(&triggers).Error
+	if err == nil {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec("CREATE VIRTUAL TABLE IF NOT EXISTS round_search USING fts5(note, tags, tokenize = 'unicode61 remove_diacritics 2')").Error; err != nil {
+				return err
+			}
+			// The table outlives a build with FTS5, so only a query tells whether this one has it
+			var probe int64
+			if err := tx.Raw("SELECT COUNT(*) FROM round_search WHERE round_search MATCH 'probe'").Scan(&probe).Error; err != nil {
+				return err
+			}
+			for _, trigger := range roundSearchTriggers {
+				if err := tx.Exec("CREATE TRIGGER IF NOT EXISTS " + trigger.Name + " " + trigger.SQL).Error; err != nil {
+					return err
+				}
+			}
+			if triggers == int64(len(roundSearchTriggers)) {
+				return nil
+			}
+			// A new index, or one left behind while a build without FTS5 changed rounds
+			if err := tx.Exec("DELETE FROM round_search").Error; err != nil {
+				return err
+			}
+			return tx.Exec("INSERT INTO round_search (rowid, note, tags) SELECT rounds.id, rounds.note, (" +
+				roundSearchTagsSQL("rounds.id") + ") FROM rounds").Error
+		})
+	}
+	if err == nil {
+		roundSearchFTS = true
+		return
+	}
+
+	if strings.Contains(err.Error(), "no such module") {
+		log.Println("Warning: SQLite was built without FTS5 (build with -tags sqlite_fts5), searching with LIKE")
+	} else {
+		log.Println("Warning: full-text search unavailable, searching with LIKE:", err)
+	}
+	// Triggers created by a build with FTS5 would make every change to rounds fail in this one
+	for _, trigger := range roundSearchTriggers {
+		if err := db.Exec("DROP TRIGGER IF EXISTS " + trigger.Name).Error; err != nil {
+			log.Println("Warning: failed to drop search trigger:", err)
+		}
+	}
+}
+
+// searchTerms splits a search into lowercase words, trimming the punctuation around them so "#meetings" finds the tag
+// and "(review)" the word. Words without a letter or digit are skipped, as neither the index nor a reader would match
+// them.
+func searchTerms(text string) ([]string, error) {
+	var terms []string
+	seen := make(map[string]bool)
+	isWordRune := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+	for _, field := range strings.Fields(strings.ToLower(text)) {
+		term := strings.TrimFunc(field, func(r rune) bool { return !isWordRune(r) })
+		if term == "" || seen[term] {
+			continue
+		}
+		seen[term] = true
+		terms = append(terms, term)
+	}
+	if len(terms) == 0 {
+		return nil, errors.New("search for at least one word")
+	}
+	if len(terms) > maxSearchTerms {
+		return nil, fmt.Errorf("search for %d words at most", maxSearchTerms)
+	}
+	return terms, nil
+}
+
+// roundsMatching limits a query on rounds to those whose note or tags contain every term. With FTS5 a term matches
+// words starting with it; with LIKE it matches anywhere in the note or a tag name.
+func roundsMatching(terms []string) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		if roundSearchFTS {
+			quoted := make([]string, len(terms))
+			for i, term := range terms {
+				quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+			}
+			return tx.Where("rounds.id IN (SELECT rowid FROM round_search WHERE round_search MATCH ?)", strings.Join(quoted, " "))
+		}
+		like := "LOWER(rounds.note) LIKE ? ESCAPE '!'"
+		if db.Dialector.Name() == "postgres" {
+			like = "rounds.note ILIKE ? ESCAPE '!'"
+		}
+		escaper := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+		for _, term := range terms {
+			pattern := "%" + escaper.Replace(term) + "%"
+			tagged := db.Table("round_tags").Select("round_tags.round_id").
+				Joins("JOIN tags ON tags.id = round_tags.tag_id").Where("tags.name LIKE ? ESCAPE '!'", pattern)
+			tx = tx.Where("("+like+" OR rounds.id IN (?))", pattern, tagged)
+		}
+		return tx
+	}
+}
+
+// renderSearch shows the search page: rounds whose notes or tags contain the words searched for, within a group and
+// dates, newest first, with the words marked
+func renderSearch(c *fiber.Ctx) error {
+	userID := currentUserID(c)
+	groups, err := getWorkingGroupsOrdered(userID)
+	if err != nil {
+		requestLog(c).Println("Error fetching working groups:", err)
+		return c.Status(500).SendString("Error loading search")
+	}
+	q, err := parseRoundListQuery(c)
+	if err != nil {
+		return c.Status(400).SendString(err.Error())
+	}
+	var groupOptions []fiber.Map
+	for _, group := range groups {
+		groupOptions = append(groupOptions, fiber.Map{"ID": group.ID, "Name": group.Name, "Selected": group.ID == q.GroupID})
+	}
+	view := fiber.Map{"Groups": groupOptions, "Query": q, "Can": permissionsView(c)}
+	if q.Search == "" {
+		return c.Render("search", view)
+	}
+
+	page, err := listRounds(userID, q)
+	if err != nil {
+		requestLog(c).Println("Error searching rounds:", err)
+		return c.Status(500).SendString("Error searching rounds")
+	}
+	var rounds []fiber.Map
+	for _, round := range page.Rounds {
+		var tags []string
+		for _, tag := range round.Tags {
+			tags = append(tags, tag.Name)
+		}
+		rounds = append(rounds, fiber.Map{
+			"ID":              round.ID,
+			"GroupName":       round.GroupName,
+			"GroupID":         round.WorkingGroupID,
+			"StartTime":       round.StartTime,
+			"EndTime":         round.EndTime,
+			"DurationSeconds": round.DurationSeconds,
+			"Note":            round.Note,
+			"Tags":            tags,
+		})
+	}
+	pagination := fiber.Map{"Page": page.Page, "TotalPages": page.TotalPages, "Total": page.Total}
+	if page.Page > 1 {
+		pagination["PrevQuery"] = q.values(q.Sort, q.Order, page.Page-1)
+	}
+	if page.Page < page.TotalPages {
+		pagination["NextQuery"] = q.values(q.Sort, q.Order, page.Page+1)
+	}
+	view["Rounds"] = rounds
+	view["Terms"] = q.terms
+	view["Pagination"] = pagination
+	return c.Render("search", view)
+}
+
+// apiSearch serves GET /api/v1/search, the rounds list with q required
+func apiSearch(c *fiber.Ctx) error {
+	q, err := parseRoundListQuery(c)
+	if err == nil && q.Search == "" {
+		err = errors.New("q is required")
+	}
+	if err != nil {
+		return c.Status(400).JSON(apiError{err.Error()})
+	}
+	page, err := listRounds(currentUserID(c), q)
+	if err != nil {
+		requestLog(c).Println("Error searching rounds:", err)
+		return c.Status(500).JSON(apiError{"error searching rounds"})
+	}
+	return c.JSON(page)
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// sealedPrefix marks a secret encrypted with AES-256-GCM, stored as "enc:v1:<key ID>:<base64 of nonce and
+// ciphertext>". Values without it are plaintext, written before SECRETS_KEY was set.
+const sealedPrefix = "enc:v1:"
+
+var (
+	errSecretsKeyMissing  = errors.New("secret is encrypted, but neither SECRETS_KEY nor SECRETS_KEY_FILE is set")
+	errSecretsKeyMismatch = errors.New("secret is encrypted with another key")
+)
+
+// secretSettings are the AppSetting keys whose values are secrets, sealed by setSetting and opened by getSetting
+var secretSettings = map[string]bool{
+	"action_link_secret":  true,
+	"webpush_private_key": true,
+}
+
+// secretKey is a key secrets are sealed with; its ID is stored with every sealed value, so a wrong key is told apart
+// from damaged data
+type secretKey struct {
+	ID   string
+	aead cipher.AEAD
+}
+
+// secrets seals secrets written to the database, nil to write them as plaintext; set from the configuration on start
+var secrets *secretKey
+
+// parseSecretKey reads a 32-byte key written as base64 (openssl rand -base64 32) or hex
+func parseSecretKey(text string) (*secretKey, error) {
+	text = strings.TrimSpace(text)
+	key, err := base64.StdEncoding.DecodeString(text)
+	if err != nil || len(key) != 32 {
+		if key, err = hex.DecodeString(text); err != nil || len(key) != 32 {
+			return nil, errors.New("the key must be 32 bytes as base64 or hex, e.g. from openssl rand -base64 32")
+		}
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key)
+	return &secretKey{ID: hex.EncodeToString(sum[:4]), aead: aead}, nil
+}
+
+// loadSecretKey reads the key given as it is or, without one, from file; neither is no key
+func loadSecretKey(value, file string) (*secretKey, error) {
+	if value == "" && file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading the secrets key file: %w", err)
+		}
+		value = string(data)
+	}
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	return parseSecretKey(value)
+}
+
+func (k *secretKey) seal(plain string) (string, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := k.aead.Seal(nonce, nonce, []byte(plain), nil)
+	return sealedPrefix + k.ID + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (k *secretKey) open(stored string) (string, error) {
+	_, payload, _ := strings.Cut(strings.TrimPrefix(stored, sealedPrefix), ":")
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil || len(data) < k.aead.NonceSize() {
+		return "", errors.New("secret is damaged")
+	}
+	plain, err := k.aead.Open(nil, data[:k.aead.NonceSize()], data[k.aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("secret is damaged")
+	}
+	return string(plain), nil
+}
+
+// sealedKeyID is the ID of the key a stored secret is sealed with, empty for plaintext
+func sealedKeyID(stored string) string {
+	if !strings.HasPrefix(stored, sealedPrefix) {
+		return ""
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(stored, sealedPrefix), ":")
+	return id
+}
+
+// sealSecret is how a secret is written to the database: sealed with SECRETS_KEY, or as it is without one
+func sealSecret(plain string) (string, error) {
+	if secrets == nil || plain == "" {
+		return plain, nil
+	}
+	return secrets.seal(plain)
+}
+
+// openSecret reads a secret written by sealSecret, with any of the given keys besides SECRETS_KEY
+func openSecret(stored string, others ...*secretKey) (string, error) {
+	id := sealedKeyID(stored)
+	if id == "" {
+		return stored, nil
+	}
+	for _, key := range append([]*secretKey{secrets}, others...) {
+		if key != nil && key.ID == id {
+			return key.open(stored)
+		}
+	}
+	if secrets == nil && len(others) == 0 {
+		return "", errSecretsKeyMissing
+	}
+	return "", fmt.Errorf("%w (%s)", errSecretsKeyMismatch, id)
+}
+
+// storedSecret is one secret column of one row, for checking and re-keying them all
+type storedSecret struct {
+	Label string
+	Value string
+	save  func(tx *gorm.DB, value string) error
+}
+
+// storedSecrets lists every secret kept in the database: secret settings, calendar feed URLs (which carry the
+// calendar's access token) and the auth secrets of push subscriptions
+func storedSecrets(tx *gorm.DB) ([]storedSecret, error) {
+	var list []storedSecret
+	for key := range secretSettings {
+		var setting AppSetting
+		err := tx.Where(&AppSetting{Key: key}).First(&setting).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, storedSecret{Label: "setting " + key, Value: setting.Value, save: func(tx *gorm.DB, value string) error {
+			return tx.Save(&AppSetting{Key: key, Value: value}).Error
+		}})
+	}
+	var feeds []CalendarFeed
+	if err := tx.Order("id ASC").Find(&feeds).Error; err != nil {
+		return nil, err
+	}
+	for _, feed := range feeds {
+		list = append(list, storedSecret{Label: fmt.Sprintf("calendar feed #%d", feed.ID), Value: feed.URL, save: func(tx *gorm.DB, value string) error {
+			return tx.Model(&CalendarFeed{}).Where("id = ?", feed.ID).Update("url", value).Error
+		}})
+	}
+	var subscriptions []PushSubscription
+	if err := tx.Order("id ASC").Find(&subscriptions).Error; err != nil {
+		return nil, err
+	}
+	for _, sub := range subscriptions {
+		list = append(list, storedSecret{Label: fmt.Sprintf("push subscription #%d", sub.ID), Value: sub.Auth, save: func(tx *gorm.DB, value string) error {
+			return tx.Model(&PushSubscription{}).Where("id = ?", sub.ID).Update("auth", value).Error
+		}})
+	}
+	return list, nil
+}
+
+// checkStoredSecrets makes sure every secret in the database can be read with the configured key, so a missing or
+// wrong key stops the server on start rather than failing the first notification; it returns how many are plaintext
+func checkStoredSecrets() (int, error) {
+	list, err := storedSecrets(db)
+	if err != nil {
+		return 0, err
+	}
+	plaintext := 0
+	for _, secret := range list {
+		if sealedKeyID(secret.Value) == "" {
+			if secret.Value != "" {
+				plaintext++
+			}
+			continue
+		}
+		if _, err := openSecret(secret.Value); err != nil {
+			return 0, fmt.Errorf("%s: %w", secret.Label, err)
+		}
+	}
+	return plaintext, nil
+}
+
+// rekeySecrets writes every secret again with SECRETS_KEY, opening those sealed with another key with old; without
+// SECRETS_KEY they are written back as plaintext. It returns how many changed; all change or, on an error, none.
+func rekeySecrets(old *secretKey) (int, error) {
+	changed := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		list, err := storedSecrets(tx)
+		if err != nil {
+			return err
+		}
+		for _, secret := range list {
+			id := sealedKeyID(secret.Value)
+			if secret.Value == "" || (secrets != nil && id == secrets.ID) || (secrets == nil && id == "") {
+				continue
+			}
+			plain, err := openSecret(secret.Value, old)
+			if err != nil {
+				return fmt.Errorf("%s: %w", secret.Label, err)
+			}
+			sealed, err := sealSecret(plain)
+			if err != nil {
+				return err
+			}
+			if err := secret.save(tx, sealed); err != nil {
+				return err
+			}
+			changed++
+		}
+		return nil
+	})
+	return changed, err
+}
+
+// runRekey is the rekey command: it re-encrypts the stored secrets with SECRETS_KEY, e.g. after rotating it, or
+// encrypts those written before a key was set; without SECRETS_KEY it decrypts them, to turn encryption off
+func runRekey(args []string) int {
+	flags := flag.NewFlagSet("rekey", flag.ContinueOnError)
+	oldKey := flags.String("old-key", os.Getenv("SECRETS_OLD_KEY"), "Key the secrets are encrypted with now, when it isn't SECRETS_KEY")
+	oldKeyFile := flags.String("old-key-file", os.Getenv("SECRETS_OLD_KEY_FILE"), "File holding that key")
+	flags.Usage = func() { fmt.Fprint(os.Stderr, cliUsage) }
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	old, err := loadSecretKey(*oldKey, *oldKeyFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid old key:", err)
+		return 2
+	}
+
+	changed, err := rekeySecrets(old)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Nothing was changed:", err)
+		if errors.Is(err, errSecretsKeyMismatch) || errors.Is(err, errSecretsKeyMissing) {
+			fmt.Fprintln(os.Stderr, "Pass the key they are encrypted with as -old-key or -old-key-file")
+		}
+		return 1
+	}
+	if secrets == nil {
+		fmt.Printf("Decrypted %s; they are stored as plaintext\n", pluralize(int64(changed), "secret"))
+	} else {
+		fmt.Printf("Encrypted %s with key %s\n", pluralize(int64(changed), "secret"), secrets.ID)
+	}
+	return 0
+}
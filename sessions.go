@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const sessionCookieName = "hours_session"
+
+// Session is a signed-in browser; the cookie carries a random token and only its hash is stored
+type Session struct {
+	ID         uint   `gorm:"primaryKey"`
+	TokenHash  string `gorm:"uniqueIndex;size:191;not null"`
+	UserID     uint   `gorm:"index;not null"`
+	Remember   bool   // Persistent cookie with the longer remember-me lifetime
+	CSRFToken  string // Echoed by forms and HTMX requests, see csrfProtect
+	UserAgent  string
+	RemoteIP   string
+	ExpiresAt  time.Time `gorm:"index"`
+	LastSeenAt time.Time
+	CreatedAt  time.Time
+}
+
+var (
+	// sessionLifetime is the idle timeout of regular sessions
+	sessionLifetime = 12 * time.Hour
+	// rememberLifetime is the idle timeout of "remember me" sessions
+	rememberLifetime = 30 * 24 * time.Hour
+)
+
+// sessionTouchInterval limits how often sliding expiry writes to the database
+const sessionTouchInterval = time.Minute
+
+// configureSessions applies the configured session and remember-me lifetimes
+func configureSessions() {
+	for _, setting := range []struct {
+		name   string
+		config string
+		value  *time.Duration
+	}{
+		{"SESSION_LIFETIME", cfg.Auth.SessionLifetime, &sessionLifetime},
+		{"SESSION_REMEMBER_LIFETIME", cfg.Auth.RememberLifetime, &rememberLifetime},
+	} {
+		value := setting.config
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d < time.Minute {
+			log.Printf("Warning: ignoring %s %q, using %s", setting.name, value, *setting.value)
+			continue
+		}
+		*setting.value = d
+	}
+}
+
+func (s *Session) lifetime() time.Duration {
+	if s.Remember {
+		return rememberLifetime
+	}
+	return sessionLifetime
+}
+
+// setSessionCookie writes the cookie; regular sessions end with the browser, remembered ones persist
+func setSessionCookie(c *fiber.Ctx, token string, session *Session) {
+	cookie := &fiber.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		HTTPOnly: true,
+		SameSite: "Lax",
+		Secure:   c.Protocol() == "https",
+	}
+	if session.Remember {
+		cookie.Expires = session.ExpiresAt
+	}
+	c.Cookie(cookie)
+}
+
+// startSession signs the user in on this browser
+func startSession(c *fiber.Ctx, user User, remember bool) error {
+	token, err := randomString()
+	if err != nil {
+		return err
+	}
+	csrfToken, err := randomString()
+	if err != nil {
+		return err
+	}
+	db.Where("expires_at < ?", time.Now()).Delete(&Session{})
+
+	now := time.Now()
+	session := Session{
+		TokenHash:  hashToken(token),
+		UserID:     user.ID,
+		Remember:   remember,
+		CSRFToken:  csrfToken,
+		UserAgent:  truncateString(c.Get(fiber.HeaderUserAgent), 255),
+		RemoteIP:   c.IP(),
+		LastSeenAt: now,
+	}
+	session.ExpiresAt = now.Add(session.lifetime())
+	if err := db.Create(&session).Error; err != nil {
+		return err
+	}
+	setSessionCookie(c, token, &session)
+	return nil
+}
+
+// userFromSession resolves the session cookie and slides its expiry forward
+func userFromSession(c *fiber.Ctx) (*User, *Session) {
+	token := c.Cookies(sessionCookieName)
+	if token == "" {
+		return nil, nil
+	}
+	var session Session
+	if err := db.Where("token_hash = ?", hashToken(token)).First(&session).Error; err != nil {
+		return nil, nil
+	}
+	now := time.Now()
+	if now.After(session.ExpiresAt) {
+		db.Delete(&session)
+		return nil, nil
+	}
+
+	var user User
+	if err := db.First(&user, session.UserID).Error; err != nil {
+		return nil, nil
+	}
+	if session.CSRFToken == "" {
+		// Sessions created before CSRF protection existed
+		if csrfToken, err := randomString(); err == nil {
+			session.CSRFToken = csrfToken
+			db.Model(&session).Update("csrf_token", csrfToken)
+		}
+	}
+
+	if now.Sub(session.LastSeenAt) >= sessionTouchInterval {
+		session.LastSeenAt = now
+		session.ExpiresAt = now.Add(session.lifetime())
+		if err := db.Model(&session).Updates(map[string]interface{}{"last_seen_at": session.LastSeenAt, "expires_at": session.ExpiresAt}).Error; err != nil {
+			requestLog(c).Println("Warning: failed to extend session:", err)
+		} else if session.Remember {
+			setSessionCookie(c, token, &session)
+		}
+	}
+	return &user, &session
+}
+
+func currentSession(c *fiber.Ctx) *Session {
+	session, _ := c.Locals("session").(*Session)
+	return session
+}
+
+// revokeOtherSessions signs the user out everywhere except the given session (0 for all)
+func revokeOtherSessions(userID, keepID uint) error {
+	return db.Where("user_id = ? AND id <> ?", userID, keepID).Delete(&Session{}).Error
+}
+
+func logoutHandler(c *fiber.Ctx) error {
+	if session := currentSession(c); session != nil {
+		db.Delete(session)
+	}
+	c.ClearCookie(sessionCookieName)
+	return c.Redirect("/login", fiber.StatusSeeOther)
+}
+
+func deleteSessionHandler(c *fiber.Ctx) error {
+	id, err := parseGroupID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid session")
+	}
+	result := db.Where("user_id = ?", currentUserID(c)).Delete(&Session{}, id)
+	if result.Error != nil {
+		requestLog(c).Println("Error deleting session:", result.Error)
+		return c.Status(500).SendString("Error signing out session")
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(404).SendString("Session not found")
+	}
+	if session := currentSession(c); session != nil && session.ID == id {
+		c.ClearCookie(sessionCookieName)
+		return c.Redirect("/login", fiber.StatusSeeOther)
+	}
+	return c.Redirect("/users", fiber.StatusSeeOther)
+}
+
+func revokeOtherSessionsHandler(c *fiber.Ctx) error {
+	var keepID uint
+	if session := currentSession(c); session != nil {
+		keepID = session.ID
+	}
+	if err := revokeOtherSessions(currentUserID(c), keepID); err != nil {
+		requestLog(c).Println("Error revoking sessions:", err)
+		return c.Status(500).SendString("Error signing out other sessions")
+	}
+	recordAudit("user.sessions", clientInfoFromRequest(c), 0, nil, "Signed out all other sessions")
+	return c.Redirect("/users", fiber.StatusSeeOther)
+}
+
+func sessionViews(c *fiber.Ctx) []fiber.Map {
+	var sessions []Session
+	if err := db.Where("user_id = ? AND expires_at > ?", currentUserID(c), time.Now()).
+		Order("last_seen_at DESC").Find(&sessions).Error; err != nil {
+		requestLog(c).Println("Error fetching sessions:", err)
+	}
+	current := currentSession(c)
+	var views []fiber.Map
+	for _, session := range sessions {
+		kind := fmt.Sprintf("expires after %s idle", sessionLifetime)
+		if session.Remember {
+			kind = "remembered"
+		}
+		views = append(views, fiber.Map{
+			"ID":        session.ID,
+			"Client":    clientNameFromUserAgent(session.UserAgent),
+			"UserAgent": session.UserAgent,
+			"RemoteIP":  session.RemoteIP,
+			"Kind":      kind,
+			"LastSeen":  session.LastSeenAt.Format("2006-01-02 15:04:05"),
+			"CreatedAt": session.CreatedAt.Format("2006-01-02 15:04:05"),
+			"IsCurrent": current != nil && current.ID == session.ID,
+		})
+	}
+	return views
+}
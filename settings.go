@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// AppSetting is a key/value pair for instance-wide settings and generated secrets
+type AppSetting struct {
+	Key   string `gorm:"primaryKey"`
+	Value string
+}
+
+// getSetting returns the stored value for key, or fallback when it has never been set or, for a secret setting,
+// can't be read
+func getSetting(key, fallback string) string {
+	var setting AppSetting
+	// Struct conditions quote the column, "key" is reserved in MySQL
+	if err := db.Where(&AppSetting{Key: key}).First(&setting).Error; err != nil {
+		return fallback
+	}
+	if secretSettings[key] {
+		value, err := openSecret(setting.Value)
+		if err != nil {
+			log.Printf("Error reading setting %s: %v", key, err)
+			return fallback
+		}
+		return value
+	}
+	return setting.Value
+}
+
+// setSetting stores value for key, sealed with SECRETS_KEY for secret settings
+func setSetting(key, value string) error {
+	if secretSettings[key] {
+		var err error
+		if value, err = sealSecret(value); err != nil {
+			return err
+		}
+	}
+	return db.Save(&AppSetting{Key: key, Value: value}).Error
+}
+
+// getOrCreateSetting returns the stored value for key, storing generate()'s result on first use
+func getOrCreateSetting(key string, generate func() (string, error)) (string, error) {
+	var setting AppSetting
+	err := db.Where(&AppSetting{Key: key}).First(&setting).Error
+	if err == nil {
+		if secretSettings[key] {
+			return openSecret(setting.Value)
+		}
+		return setting.Value, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+
+	value, err := generate()
+	if err != nil {
+		return "", err
+	}
+	if err := setSetting(key, value); err != nil {
+		return "", err
+	}
+	return value, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// sharedAuthCredentials returns AUTH_USER and AUTH_PASS; the shared-secret mode is on when both are set
+func sharedAuthCredentials() (string, string, bool) {
+	username := strings.TrimSpace(cfg.Auth.User)
+	password := cfg.Auth.Pass
+	return username, password, username != "" && password != ""
+}
+
+func isSharedAuthUser(user *User) bool {
+	username, _, enabled := sharedAuthCredentials()
+	return enabled && user.Username == username
+}
+
+// ensureSharedAuthUser provisions the AUTH_USER account as admin and keeps its password in sync
+// with AUTH_PASS, so single-user deployments skip /setup entirely
+func ensureSharedAuthUser() {
+	username, password, enabled := sharedAuthCredentials()
+	if !enabled {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var user User
+		if err := tx.Where("username = ?", username).First(&user).Error; err == nil {
+			if user.Role == roleAdmin && user.checkPassword(password) {
+				return nil
+			}
+			if err := user.setPassword(password); err != nil {
+				return err
+			}
+			return tx.Model(&user).Updates(map[string]interface{}{"password_hash": user.PasswordHash, "role": roleAdmin}).Error
+		}
+
+		var userCount int64
+		if err := tx.Model(&User{}).Count(&userCount).Error; err != nil {
+			return err
+		}
+		user = User{Username: username, Role: roleAdmin}
+		if err := user.setPassword(password); err != nil {
+			return err
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		log.Printf("Created account '%s' from AUTH_USER", username)
+		if userCount == 0 {
+			return claimUnownedData(tx, user.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal("Failed to provision the AUTH_USER account:", err)
+	}
+}
+
+// basicAuthUser checks HTTP Basic credentials against AUTH_USER/AUTH_PASS. ok is false when the
+// request has no Basic credentials; a nil user with ok set means they were wrong.
+func basicAuthUser(c *fiber.Ctx) (user *User, ok bool) {
+	header := c.Get(fiber.HeaderAuthorization)
+	if !strings.HasPrefix(header, "Basic ") {
+		return nil, false
+	}
+	username, password, enabled := sharedAuthCredentials()
+	if !enabled {
+		return nil, false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(header[len("Basic "):]))
+	if err != nil {
+		return nil, true
+	}
+	givenUser, givenPass, _ := strings.Cut(string(decoded), ":")
+	userMatch := subtle.ConstantTimeCompare([]byte(givenUser), []byte(username))
+	passMatch := subtle.ConstantTimeCompare([]byte(givenPass), []byte(password))
+	if userMatch&passMatch != 1 {
+		return nil, true
+	}
+
+	var account User
+	if err := db.Where("username = ?", username).First(&account).Error; err != nil {
+		return nil, true
+	}
+	return &account, true
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// What happens to a round stopped before MIN_ROUND_DURATION, SHORT_ROUNDS
+const (
+	shortRoundsFlag    = "flag"    // Kept with Round.Flagged set, left out of round counts until it is reviewed
+	shortRoundsDiscard = "discard" // Deleted as if it had never been started
+)
+
+// minRoundDuration is MIN_ROUND_DURATION, 0 when every round counts however short
+func minRoundDuration() time.Duration {
+	minimum, err := time.ParseDuration(cfg.MinRoundDuration)
+	if err != nil || minimum < 0 {
+		return 0
+	}
+	return minimum
+}
+
+// minRoundShown is MIN_ROUND_DURATION for pages, such as "30s"; empty when it is off
+func minRoundShown() string {
+	if minimum := minRoundDuration(); minimum > 0 {
+		return minimum.String()
+	}
+	return ""
+}
+
+// shortRoundOutcome tells what happens to a round that ran for duration before being stopped: empty when it counts,
+// else shortRoundsFlag or shortRoundsDiscard. A round with a note, tags or attachments is only ever flagged, so
+// nothing typed into it is lost.
+func shortRoundOutcome(tx *gorm.DB, round Round, duration time.Duration) (string, error) {
+	minimum := minRoundDuration()
+	if minimum == 0 || duration >= minimum {
+		return "", nil
+	}
+	if cfg.ShortRounds != shortRoundsDiscard || strings.TrimSpace(round.Note) != "" {
+		return shortRoundsFlag, nil
+	}
+	var attached int64
+	if err := tx.Model(&Attachment{}).Where("round_id = ?", round.ID).Count(&attached).Error; err != nil {
+		return "", err
+	}
+	if attached > 0 || tx.Model(&round).Association("Tags").Count() > 0 {
+		return shortRoundsFlag, nil
+	}
+	return shortRoundsDiscard, nil
+}
+
+// settleStoppedRound saves the end of a round that was just stopped, flagging it or deleting it instead when it
+// stopped before MIN_ROUND_DURATION; round.Discarded tells the caller it is gone
+func settleStoppedRound(tx *gorm.DB, round *Round, userID uint) error {
+	if err := endOpenPause(tx, round); err != nil {
+		return err
+	}
+	outcome, err := shortRoundOutcome(tx, *round, time.Duration(roundWorkedSeconds(*round, *round.EndTime))*time.Second)
+	if err != nil {
+		return err
+	}
+	if outcome == shortRoundsDiscard {
+		round.Discarded = true
+		return bulkDeleteRounds(tx, []Round{*round}, userID)
+	}
+	round.Flagged = outcome == shortRoundsFlag
+	return tx.Model(round).Select("end_time", "stopped_by", "stop_user_agent", "flagged", "paused_at", "paused_seconds").Updates(round).Error
+}
+
+// recordStop audits a stop as round.stop, or as round.discard without a round to point to when the round was
+// discarded; note is added to the details, e.g. " (stop all)"
+func recordStop(client ClientInfo, round Round, groupName string, note string) {
+	duration := time.Duration(roundWorkedSeconds(round, *round.EndTime)) * time.Second
+	switch {
+	case round.Discarded:
+		recordAudit("round.discard", client, round.WorkingGroupID, nil,
+			fmt.Sprintf("Discarded round #%d of '%s' stopped after %s, shorter than %s%s", round.ID, groupName, duration,
+				minRoundDuration(), note))
+	case round.Flagged:
+		recordAudit("round.stop", client, round.WorkingGroupID, &round.ID,
+			fmt.Sprintf("Stopped round for '%s' after %s, flagged for review as shorter than %s%s", groupName, duration,
+				minRoundDuration(), note))
+	default:
+		recordAudit("round.stop", client, round.WorkingGroupID, &round.ID,
+			fmt.Sprintf("Stopped round for '%s' after %s%s", groupName, duration, note))
+	}
+}
+
+// reviewRoundHandler settles a flagged round from its page: decision=keep counts it like any other round, discard
+// deletes it
+func reviewRoundHandler(c *fiber.Ctx) error {
+	id, err := parseGroupID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid round")
+	}
+	req := roundBulkRequest{RoundIDs: []uint{id}}
+	switch c.FormValue("decision") {
+	case "keep":
+		req.Action = bulkKeep
+	case "discard":
+		req.Action = bulkDelete
+	default:
+		return c.Status(400).SendString("Decide to keep or discard the round")
+	}
+	if _, err := bulkEditRounds(req, clientInfoFromRequest(c)); err != nil {
+		if errors.Is(err, errRoundNotFound) {
+			return c.Status(404).SendString("Round not found")
+		}
+		if errors.Is(err, errRoundBilled) {
+			return c.Status(400).SendString("Cannot discard a billed round")
+		}
+		requestLog(c).Println("Error reviewing round:", err)
+		return c.Status(500).SendString("Error reviewing round")
+	}
+	if req.Action == bulkDelete {
+		return c.Redirect("/rounds?flagged=1", fiber.StatusSeeOther)
+	}
+	return c.Redirect(fmt.Sprintf("/rounds/%d", id), fiber.StatusSeeOther)
+}
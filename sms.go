@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// normalizePhone keeps the leading + and digits, so "+1 (555) 010-0200" matches "+15550100200"
+func normalizePhone(phone string) string {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(phone) {
+		if unicode.IsDigit(r) || (r == '+' && i == 0) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// looseName lowercases a group name and drops everything but letters and digits, so "clienta" matches "Client A"
+func looseName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// findGroupByLooseName picks the user's group whose name matches when spaces and punctuation are ignored
+func findGroupByLooseName(userID uint, name string) (WorkingGroup, error) {
+	groups, err := getWorkingGroupsOrdered(userID)
+	if err != nil {
+		return WorkingGroup{}, err
+	}
+	wanted := looseName(name)
+	for _, group := range groups {
+		if looseName(group.Name) == wanted {
+			return group, nil
+		}
+	}
+	return WorkingGroup{}, errGroupNotFound
+}
+
+// verifyTwilioSignature checks X-Twilio-Signature: base64(HMAC-SHA1(auth token, URL + sorted POST parameters))
+func verifyTwilioSignature(authToken, requestURL, signature string, params map[string]string) bool {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	payload := requestURL
+	for _, key := range keys {
+		payload += key + params[key]
+	}
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(payload))
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// todaySeconds sums today's rounds of all the user's groups, including the running ones
+func todaySeconds(userID uint) int64 {
+	now := time.Now()
+	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	var rounds []Round
+	db.Select("start_time", "end_time", "paused_at", "paused_seconds").Scopes(userRounds(userID)).
+		Where("start_time >= ? OR end_time IS NULL", todayStart).Find(&rounds)
+
+	var total int64
+	for _, round := range rounds {
+		worked := roundWorkedSeconds(round, now)
+		// Only today's part of a round running since yesterday counts
+		if round.StartTime.Before(todayStart) {
+			worked = max(worked-int64(todayStart.Sub(round.StartTime).Seconds()), 0)
+		}
+		total += worked
+	}
+	return total
+}
+
+type twimlResponse struct {
+	XMLName xml.Name `xml:"Response"`
+	Message string   `xml:"Message"`
+}
+
+func sendTwiML(c *fiber.Ctx, message string) error {
+	body, err := xml.Marshal(twimlResponse{Message: message})
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, "text/xml; charset=utf-8")
+	return c.Send(append([]byte(xml.Header), body...))
+}
+
+// inboundTwilioHandler lets users control the timer by text message: "start <group>", "stop", "status" or "help"
+func inboundTwilioHandler(c *fiber.Ctx) error {
+	authToken := cfg.Inbound.TwilioAuthToken
+	if authToken == "" {
+		return c.Status(404).SendString("SMS entry is not configured")
+	}
+
+	params := make(map[string]string)
+	c.Request().PostArgs().VisitAll(func(key, value []byte) {
+		params[string(key)] = string(value)
+	})
+	// Behind a reverse proxy the public URL differs from what the app sees
+	requestURL := cfg.Inbound.TwilioWebhookURL
+	if requestURL == "" {
+		requestURL = c.BaseURL() + c.OriginalURL()
+	}
+	if !verifyTwilioSignature(authToken, requestURL, c.Get("X-Twilio-Signature"), params) {
+		return c.Status(403).SendString("Invalid signature")
+	}
+
+	phone := normalizePhone(params["From"])
+	var user User
+	if phone == "" || db.Where("phone = ?", phone).First(&user).Error != nil {
+		requestLog(c).Printf("Ignoring SMS from unknown number %s", params["From"])
+		return sendTwiML(c, "This number is not linked to an Hours Tracker account.")
+	}
+
+	return sendTwiML(c, runSMSCommand(user, params["Body"], ClientInfo{
+		UserID:    user.ID,
+		Name:      "sms",
+		UserAgent: "twilio",
+		RemoteIP:  c.IP(),
+		Source:    sourceSMS,
+	}))
+}
+
+func runSMSCommand(user User, text string, client ClientInfo) string {
+	command, argument, _ := strings.Cut(strings.TrimSpace(text), " ")
+	argument = strings.TrimSpace(argument)
+	command = strings.ToLower(command)
+
+	if command != "status" && command != "total" && command != "help" &&
+		scopeLevels[roleScopes[user.Role]] < scopeLevels[scopeControl] {
+		return "Your account can only view time. Send STATUS for today's total."
+	}
+
+	var reply string
+	switch command {
+	case "start":
+		group, err := smsGroup(user.ID, argument)
+		if err != nil {
+			return smsGroupError(user.ID, argument)
+		}
+		if _, err := startRound(group.ID, client); err != nil {
+			return fmt.Sprintf("Could not start %s: %v.", group.Name, err)
+		}
+		reply = "Started " + group.Name + "."
+	case "stop":
+		group, err := smsRunningGroup(user.ID, argument)
+		if err != nil {
+			if argument != "" {
+				return smsGroupError(user.ID, argument)
+			}
+			return "Nothing is running."
+		}
+		round, err := stopRound(group.ID, client)
+		if err != nil {
+			return fmt.Sprintf("Could not stop %s: %v.", group.Name, err)
+		}
+		reply = fmt.Sprintf("Stopped %s after %s.", group.Name, formatShortDuration(roundWorkedSeconds(round, *round.EndTime)))
+		if round.Discarded {
+			reply = fmt.Sprintf("Discarded %s after %s, too short to count.", group.Name,
+				formatShortDuration(roundWorkedSeconds(round, *round.EndTime)))
+		}
+	case "status", "total":
+		if group, err := smsRunningGroup(user.ID, ""); err == nil {
+			reply = "Running: " + group.Name + "."
+		} else {
+			reply = "Nothing is running."
+		}
+	default:
+		return "Commands: START <group>, STOP [group], STATUS."
+	}
+	return fmt.Sprintf("%s Today: %s.", reply, formatShortDuration(todaySeconds(user.ID)))
+}
+
+// smsGroup resolves the group named in a command, defaulting to the first group
+func smsGroup(userID uint, name string) (WorkingGroup, error) {
+	if name == "" {
+		groupID, err := resolveAPIGroup(userID, 0)
+		if err != nil {
+			return WorkingGroup{}, err
+		}
+		return findUserGroup(userID, groupID)
+	}
+	return findGroupByLooseName(userID, name)
+}
+
+// smsRunningGroup resolves the named group, or without a name the group with the most recently started round
+func smsRunningGroup(userID uint, name string) (WorkingGroup, error) {
+	if name != "" {
+		return findGroupByLooseName(userID, name)
+	}
+	var round Round
+	if err := db.Preload("WorkingGroup").Scopes(userRounds(userID)).Where("end_time IS NULL").
+		Order("start_time DESC").First(&round).Error; err != nil {
+		return WorkingGroup{}, err
+	}
+	return round.WorkingGroup, nil
+}
+
+func smsGroupError(userID uint, name string) string {
+	groups, _ := getWorkingGroupsOrdered(userID)
+	names := make([]string, 0, len(groups))
+	for _, group := range groups {
+		names = append(names, group.Name)
+	}
+	return fmt.Sprintf("No group called %q. Your groups: %s.", name, strings.Join(names, ", "))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// Round sources: how a round came to exist. Unlike StartedBy, which is whatever the client calls itself, there is a
+// fixed set of them, so reports can be filtered by source to check what an automation recorded.
+const (
+	sourceManual    = "manual"    // Buttons and forms of the web UI
+	sourceAPI       = "api"       // API tokens, extensions and other non-browser clients
+	sourceCLI       = "cli"       // workinghours start
+	sourceTimesheet = "timesheet" // Hours typed into the weekly timesheet
+	sourceCalendar  = "calendar"  // Meetings imported from a calendar feed
+	sourceFile      = "file"      // Rows of an imported CSV or XLSX file
+	sourceEmail     = "email"     // "log" lines mailed in
+	sourceSMS       = "sms"       // Text messages
+	sourceVoice     = "voice"     // Voice assistants
+	sourceSync      = "sync"      // Received from a synced instance that didn't say
+)
+
+// roundSources lists every source with its label, in the order filters offer them
+var roundSources = []struct{ Value, Label string }{
+	{sourceManual, "🖱 Web UI"},
+	{sourceAPI, "🔌 API"},
+	{sourceCLI, "⌨️ Command line"},
+	{sourceTimesheet, "🗓 Timesheet"},
+	{sourceCalendar, "📅 Calendar import"},
+	{sourceFile, "📄 File import"},
+	{sourceEmail, "✉️ Email"},
+	{sourceSMS, "💬 SMS"},
+	{sourceVoice, "🗣 Voice assistant"},
+	{sourceSync, "🔄 Sync"},
+}
+
+// validRoundSource reports whether source is one of roundSources
+func validRoundSource(source string) bool {
+	for _, known := range roundSources {
+		if known.Value == source {
+			return true
+		}
+	}
+	return false
+}
+
+// roundSourceLabel is how pages show a round's source
+func roundSourceLabel(source string) string {
+	for _, known := range roundSources {
+		if known.Value == source {
+			return known.Label
+		}
+	}
+	return source
+}
+
+// requestSource is the source of rounds created by a request: the web UI for browsers using their session, the API
+// for tokens and every other client
+func requestSource(clientName string, hasToken bool) string {
+	if !hasToken && clientName == "browser" {
+		return sourceManual
+	}
+	return sourceAPI
+}
+
+// backfillRoundSource labels rounds from before sources were recorded, telling them apart by the client that started
+// them the same way new rounds are labeled
+func backfillRoundSource() {
+	unlabeled := func() *gorm.DB {
+		return db.Model(&Round{}).Where("source IS NULL OR source = ''")
+	}
+	// UpdateColumn keeps updated_at, which is what sync compares
+	for _, rule := range []struct {
+		where  string
+		value  string
+		source string
+	}{
+		{"start_user_agent = ?", "sync", sourceSync},
+		{"started_by = ?", timesheetClient, sourceTimesheet},
+		{"started_by = ?", "calendar-import", sourceCalendar},
+		{"started_by = ?", "cli", sourceCLI},
+		{"started_by = ?", "email", sourceEmail},
+		{"started_by = ?", "sms", sourceSMS},
+		{"started_by LIKE ?", "voice:%", sourceVoice},
+		{"started_by = ?", "browser", sourceManual},
+	} {
+		if err := unlabeled().Where(rule.where, rule.value).UpdateColumn("source", rule.source).Error; err != nil {
+			log.Println("Warning: failed to label the source of existing rounds:", err)
+			return
+		}
+	}
+	if err := unlabeled().UpdateColumn("source", sourceAPI).Error; err != nil {
+		log.Println("Warning: failed to label the source of existing rounds:", err)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build cgo && !sqlite_purego
+
+package main
+
+import (
+	"net/url"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// sqliteDriver is the SQLite driver built in: go-sqlite3, which needs cgo. See sqlite_purego.go for the other one.
+const sqliteDriver = "go-sqlite3"
+
+func sqliteDialector(dsn string) gorm.Dialector {
+	return sqlite.Open(dsn)
+}
+
+// sqliteDSNParam is a pragma as go-sqlite3 takes it in the DSN, e.g. _busy_timeout=5000, and what a path that sets
+// it already contains
+func sqliteDSNParam(pragma sqlitePragma, value string) (param, set string) {
+	return pragma.Param + "=" + url.QueryEscape(value), pragma.Param + "="
+}
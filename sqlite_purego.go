@@ -0,0 +1,39 @@
+//go:build !cgo || sqlite_purego
+
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	_ "modernc.org/sqlite" // Registers the "sqlite" driver
+)
+
+// sqliteDriver is the SQLite driver built in: modernc.org/sqlite, SQLite translated to Go. It is used when building
+// with -tags sqlite_purego or CGO_ENABLED=0, so binaries for ARM boards and NAS boxes cross-compile without a C
+// toolchain. It has FTS5 built in.
+const sqliteDriver = "modernc.org/sqlite"
+
+// sqliteDialector is GORM's SQLite dialect on the modernc.org/sqlite driver. Times are written in the format
+// go-sqlite3 uses, so the database file works with both builds.
+func sqliteDialector(dsn string) gorm.Dialector {
+	if !strings.Contains(dsn, "_time_format=") {
+		separator := "?"
+		if strings.Contains(dsn, "?") {
+			separator = "&"
+		}
+		dsn += separator + "_time_format=sqlite"
+	}
+	return sqlite.Dialector{DriverName: "sqlite", DSN: dsn}
+}
+
+// sqliteDSNParam is a pragma as modernc.org/sqlite takes it in the DSN, e.g. _pragma=busy_timeout(5000), and what a
+// path that sets it already contains
+func sqliteDSNParam(pragma sqlitePragma, value string) (param, set string) {
+	if pragma.Pragma == "" {
+		return pragma.Param + "=" + url.QueryEscape(value), pragma.Param + "="
+	}
+	return "_pragma=" + url.QueryEscape(pragma.Pragma+"("+value+")"), "_pragma=" + pragma.Pragma
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// deckState is the compact payload polled by Stream Deck keys; it avoids the totals
+// computed for the full status so that a poll costs two small queries
+type deckState struct {
+	State   int    `json:"state"` // Stream Deck action state: 0 idle, 1 running, paused or not
+	Title   string `json:"title"` // Key title: time worked in the running round, otherwise today's total
+	Icon    string `json:"icon"`  // "running", "paused" or "idle"
+	Color   string `json:"color"` // Suggested key background color
+	GroupID uint   `json:"group_id"`
+}
+
+// formatShortDuration renders seconds as H:MM, short enough for a key title
+func formatShortDuration(seconds int64) string {
+	if seconds < 0 {
+		seconds = 0
+	}
+	return fmt.Sprintf("%d:%02d", seconds/3600, (seconds%3600)/60)
+}
+
+func buildDeckState(groupID uint) deckState {
+	now := time.Now()
+	var active Round
+	if err := db.Where("working_group_id = ? AND end_time IS NULL", groupID).First(&active).Error; err == nil {
+		state := deckState{
+			State:   1,
+			Title:   formatShortDuration(roundWorkedSeconds(active, now)),
+			Icon:    "running",
+			Color:   "#48c774",
+			GroupID: groupID,
+		}
+		// A paused round stays running for the toggle, which stops it, but its time stands still
+		if active.PausedAt != nil {
+			state.Icon = "paused"
+			state.Color = "#ffdd57"
+		}
+		return state
+	}
+
+	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	var rounds []Round
+	db.Select("start_time", "end_time", "paused_seconds").
+		Where("working_group_id = ? AND start_time >= ? AND end_time IS NOT NULL", groupID, todayStart).
+		Find(&rounds)
+	var todaySeconds int64
+	for _, round := range rounds {
+		todaySeconds += roundWorkedSeconds(round, *round.EndTime)
+	}
+
+	return deckState{
+		State:   0,
+		Title:   formatShortDuration(todaySeconds),
+		Icon:    "idle",
+		Color:   "#f14668",
+		GroupID: groupID,
+	}
+}
+
+func sendDeckState(c *fiber.Ctx, groupID uint) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(buildDeckState(groupID))
+}
+
+func deckGroupID(c *fiber.Ctx) (uint, error) {
+	var requested uint
+	if groupParam := c.Query("group_id"); groupParam != "" {
+		parsed, err := parseGroupID(groupParam)
+		if err != nil {
+			return 0, errGroupNotFound
+		}
+		requested = parsed
+	}
+	return resolveAPIGroup(currentUserID(c), requested)
+}
+
+// apiDeckStatus returns the key state for a working group (?group_id=, defaults to the first group)
+func apiDeckStatus(c *fiber.Ctx) error {
+	groupID, err := deckGroupID(c)
+	if err != nil {
+		return sendAPIRoundError(c, err, "error loading status")
+	}
+	return sendDeckState(c, groupID)
+}
+
+// apiDeckToggle starts or stops a round and returns the new key state
+func apiDeckToggle(c *fiber.Ctx) error {
+	groupID, err := deckGroupID(c)
+	if err != nil {
+		return sendAPIRoundError(c, err, "error toggling round")
+	}
+
+	client := clientInfoFromRequest(c)
+	var active Round
+	if db.Where("working_group_id = ? AND end_time IS NULL", groupID).First(&active).Error == nil {
+		_, err = stopRound(groupID, client)
+	} else {
+		_, err = startRound(groupID, client)
+	}
+	if err != nil {
+		return sendAPIRoundError(c, err, "error toggling round")
+	}
+	return sendDeckState(c, groupID)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// summaryLastSentKey stores the last day a nightly summary was posted for, so restarts don't repeat it
+const summaryLastSentKey = "summary.last_sent"
+
+// summaryTime parses SUMMARY_TIME ("HH:MM", local time, default 00:05)
+func summaryTime() (int, int) {
+	value := cfg.Notify.SummaryTime
+	if value == "" {
+		return 0, 5
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		log.Printf("Warning: ignoring SUMMARY_TIME %q, using 00:05", value)
+		return 0, 5
+	}
+	return t.Hour(), t.Minute()
+}
+
+// startNightlySummary posts yesterday's per-group totals to the channels selected for the
+// "summary" alert type, once a day at SUMMARY_TIME, and on Mondays last week's plan against the tracked hours.
+// On the first run of a month it also archives last month's reports.
+func startNightlySummary() {
+	hour, minute := summaryTime()
+	for _, name := range []string{jobNightlySummary, jobWeeklyReport, jobMonthlyArchive} {
+		registerJob(name, fmt.Sprintf("daily at %02d:%02d", hour, minute))
+	}
+	go func() {
+		for {
+			now := time.Now()
+			next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+			if !now.Before(next) {
+				// Today's run time has passed: catch up if it was missed, then wait for tomorrow
+				recordJobRun(jobNightlySummary, sendNightlySummary(now))
+				recordJobRun(jobWeeklyReport, sendWeeklyReport(now))
+				recordJobRun(jobMonthlyArchive, archiveMonthlyReports(now))
+				next = next.AddDate(0, 0, 1)
+			}
+			time.Sleep(time.Until(next))
+			recordJobRun(jobNightlySummary, sendNightlySummary(time.Now()))
+			recordJobRun(jobWeeklyReport, sendWeeklyReport(time.Now()))
+			recordJobRun(jobMonthlyArchive, archiveMonthlyReports(time.Now()))
+		}
+	}()
+}
+
+func sendNightlySummary(now time.Time) error {
+	if len(alertChannels(alertSummary)) == 0 {
+		return nil
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	yesterday := today.AddDate(0, 0, -1)
+	day := yesterday.Format("2006-01-02")
+	if getSetting(summaryLastSentKey, "") == day {
+		return nil
+	}
+
+	message, err := buildDailySummary(yesterday, today)
+	if err != nil {
+		return fmt.Errorf("building nightly summary: %w", err)
+	}
+	if err := setSetting(summaryLastSentKey, day); err != nil {
+		return fmt.Errorf("saving nightly summary state: %w", err)
+	}
+	notify(Notification{
+		Type:    alertSummary,
+		Title:   "Hours for " + yesterday.Format("Monday, January 2, 2006"),
+		Message: message,
+	})
+	log.Printf("Posted nightly summary for %s", day)
+	return nil
+}
+
+// buildDailySummary lists the finished rounds of every group in [from, to) per user and group, largest first
+func buildDailySummary(from, to time.Time) (string, error) {
+	var rows []struct {
+		Username      string
+		GroupName     string
+		StartTime     time.Time
+		EndTime       time.Time
+		Billable      *bool
+		PausedSeconds int64
+	}
+	err := db.Table("rounds").
+		Select("users.username, working_groups.name AS group_name, rounds.start_time, rounds.end_time, rounds.billable, rounds.paused_seconds").
+		Joins("JOIN working_groups ON working_groups.id = rounds.working_group_id").
+		Joins("LEFT JOIN users ON users.id = working_groups.user_id").
+		Where("rounds.end_time IS NOT NULL AND rounds.start_time >= ? AND rounds.start_time < ?", from, to).
+		Where("working_groups.notify_muted = ?", false).
+		Scan(&rows).Error
+	if err != nil {
+		return "", err
+	}
+
+	type total struct {
+		label    string
+		seconds  int64
+		billable int64
+	}
+	totals := make(map[string]*total)
+	var allSeconds, allBillable int64
+	for _, row := range rows {
+		label := row.GroupName
+		if row.Username != "" {
+			label = row.Username + " / " + row.GroupName
+		}
+		if totals[label] == nil {
+			totals[label] = &total{label: label}
+		}
+		seconds := int64(row.EndTime.Sub(row.StartTime).Seconds()) - row.PausedSeconds
+		totals[label].seconds += seconds
+		allSeconds += seconds
+		if row.Billable == nil || *row.Billable {
+			totals[label].billable += seconds
+			allBillable += seconds
+		}
+	}
+	if len(totals) == 0 {
+		return "No time was tracked.", nil
+	}
+
+	list := make([]*total, 0, len(totals))
+	for _, t := range totals {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].seconds != list[j].seconds {
+			return list[i].seconds > list[j].seconds
+		}
+		return list[i].label < list[j].label
+	})
+
+	var lines []string
+	for _, t := range list {
+		line := fmt.Sprintf("• %s: %s (%.0f%%)", t.label, formatDuration(t.seconds), float64(t.seconds)*100/float64(max(allSeconds, 1)))
+		if t.billable != t.seconds {
+			line += fmt.Sprintf(", %s billable", formatDuration(t.billable))
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, fmt.Sprintf("Total: %s (%s billable, %s non-billable)",
+		formatDuration(allSeconds), formatDuration(allBillable), formatDuration(allSeconds-allBillable)))
+	return strings.Join(lines, "\n"), nil
+}
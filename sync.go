@@ -0,0 +1,539 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Settings holding the sync cursors, the peer's export time of the last pull and our own time of the last push
+const (
+	syncPulledKey = "sync.pulled"
+	syncPushedKey = "sync.pushed"
+)
+
+// syncOverlap is re-sent on every exchange so rows committed while an export ran are not missed;
+// last-write-wins makes receiving them twice harmless
+const syncOverlap = time.Minute
+
+// SyncTombstone remembers a deleted group or round so the deletion reaches the other instance and the changes feed
+type SyncTombstone struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"index"`
+	Entity    string    `gorm:"size:16;not null"` // "group" or "round"
+	EntityID  uint      // Local ID of the deleted row
+	SyncID    string    `gorm:"index;size:36;not null"`
+	DeletedAt time.Time `gorm:"index"`
+}
+
+// BeforeCreate gives every group an ID that is the same on all instances
+func (g *WorkingGroup) BeforeCreate(tx *gorm.DB) error {
+	if g.SyncID == "" {
+		g.SyncID = uuid.NewString()
+	}
+	return nil
+}
+
+// BeforeCreate gives every round an ID that is the same on all instances and, unless it was chosen, the billable
+// default of its group
+func (r *Round) BeforeCreate(tx *gorm.DB) error {
+	if r.SyncID == "" {
+		r.SyncID = uuid.NewString()
+	}
+	if r.Billable == nil {
+		group := WorkingGroup{Billable: true}
+		if r.WorkingGroupID != 0 {
+			tx.Session(&gorm.Session{NewDB: true}).Select("billable").Take(&group, r.WorkingGroupID)
+		}
+		r.Billable = &group.Billable
+	}
+	return nil
+}
+
+// ensureSyncIDs assigns sync IDs to rows created before sync existed
+func ensureSyncIDs() {
+	for _, model := range []interface{}{&WorkingGroup{}, &Round{}} {
+		var ids []uint
+		if err := db.Model(model).Where("sync_id IS NULL OR sync_id = ''").Pluck("id", &ids).Error; err != nil {
+			log.Println("Warning: failed to look up rows without sync ID:", err)
+			continue
+		}
+		for _, id := range ids {
+			// UpdateColumn keeps updated_at, which is what last-write-wins compares
+			if err := db.Model(model).Where("id = ?", id).UpdateColumn("sync_id", uuid.NewString()).Error; err != nil {
+				log.Println("Warning: failed to assign sync ID:", err)
+			}
+		}
+	}
+}
+
+// recordTombstone remembers a deleted row; entity is "group" or "round"
+func recordTombstone(tx *gorm.DB, userID uint, entity string, entityID uint, syncID string) error {
+	return tx.Create(&SyncTombstone{UserID: userID, Entity: entity, EntityID: entityID, SyncID: syncID, DeletedAt: time.Now()}).Error
+}
+
+type syncGroup struct {
+	SyncID    string    `json:"sync_id"`
+	Name      string    `json:"name"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type syncRound struct {
+	SyncID        string     `json:"sync_id"`
+	GroupSyncID   string     `json:"group_sync_id"`
+	GroupName     string     `json:"group_name"` // Lets groups created separately on both sides, e.g. "General", be matched
+	StartTime     time.Time  `json:"start_time"`
+	EndTime       *time.Time `json:"end_time"`
+	StartedBy     string     `json:"started_by"`
+	StoppedBy     string     `json:"stopped_by"`
+	Note          string     `json:"note"`
+	Billable      *bool      `json:"billable,omitempty"`       // Left out by instances from before billable rounds
+	TimeZone      string     `json:"time_zone,omitempty"`      // Where the round was recorded, empty for the sender's home
+	Source        string     `json:"source,omitempty"`         // How the round was created on the sender
+	PausedAt      *time.Time `json:"paused_at,omitempty"`      // Set while the running round is paused
+	PausedSeconds int64      `json:"paused_seconds,omitempty"` // Breaks left out of the round; pauses themselves don't sync
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+type syncDeletion struct {
+	Entity    string    `json:"entity"`
+	SyncID    string    `json:"sync_id"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// syncBatch is what instances exchange: everything of one user changed since a cursor
+type syncBatch struct {
+	Groups  []syncGroup    `json:"groups"`
+	Rounds  []syncRound    `json:"rounds"`
+	Deleted []syncDeletion `json:"deleted"`
+	Until   time.Time      `json:"until"` // Pass as since to get the next batch
+}
+
+type syncResult struct {
+	Groups  int `json:"groups"`
+	Rounds  int `json:"rounds"`
+	Deleted int `json:"deleted"`
+	Skipped int `json:"skipped"`
+}
+
+// exportSyncBatch collects the user's groups, rounds and deletions changed after since
+func exportSyncBatch(userID uint, since time.Time) (syncBatch, error) {
+	batch := syncBatch{Groups: []syncGroup{}, Rounds: []syncRound{}, Deleted: []syncDeletion{}, Until: time.Now()}
+	if !since.IsZero() {
+		since = since.Add(-syncOverlap)
+	}
+
+	var groups []WorkingGroup
+	if err := db.Scopes(userGroups(userID)).Where("updated_at > ?", since).Order("updated_at ASC").Find(&groups).Error; err != nil {
+		return batch, err
+	}
+	for _, group := range groups {
+		batch.Groups = append(batch.Groups, syncGroup{SyncID: group.SyncID, Name: group.Name, UpdatedAt: group.UpdatedAt})
+	}
+
+	var rounds []Round
+	if err := db.Preload("WorkingGroup").Scopes(userRounds(userID)).Where("updated_at > ?", since).
+		Order("updated_at ASC").Find(&rounds).Error; err != nil {
+		return batch, err
+	}
+	for _, round := range rounds {
+		batch.Rounds = append(batch.Rounds, syncRound{
+			SyncID:        round.SyncID,
+			GroupSyncID:   round.WorkingGroup.SyncID,
+			GroupName:     round.WorkingGroup.Name,
+			StartTime:     round.StartTime,
+			EndTime:       round.EndTime,
+			StartedBy:     round.StartedBy,
+			StoppedBy:     round.StoppedBy,
+			Note:          round.Note,
+			Billable:      round.Billable,
+			TimeZone:      round.TimeZone,
+			Source:        round.Source,
+			PausedAt:      round.PausedAt,
+			PausedSeconds: round.PausedSeconds,
+			UpdatedAt:     round.UpdatedAt,
+		})
+	}
+
+	var tombstones []SyncTombstone
+	if err := db.Where("user_id = ? AND deleted_at > ?", userID, since).Order("deleted_at ASC").Find(&tombstones).Error; err != nil {
+		return batch, err
+	}
+	for _, tombstone := range tombstones {
+		batch.Deleted = append(batch.Deleted, syncDeletion{Entity: tombstone.Entity, SyncID: tombstone.SyncID, DeletedAt: tombstone.DeletedAt})
+	}
+	return batch, nil
+}
+
+// findSyncedGroup finds the local group of a group of the peer: the one with its sync_id, or the one it was matched
+// with by name before, which keeps its own sync_id
+func findSyncedGroup(tx *gorm.DB, userID uint, syncID string) (WorkingGroup, error) {
+	var group WorkingGroup
+	err := tx.Scopes(userGroups(userID)).Where("sync_id = ?", syncID).First(&group).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return group, err
+	}
+	mapping, err := findExternalMapping(tx, userID, mappingSync, mappingGroup, syncID)
+	if err != nil {
+		return WorkingGroup{}, err
+	}
+	err = tx.Scopes(userGroups(userID)).First(&group, mapping.LocalID).Error
+	return group, err
+}
+
+// importSyncBatch applies a batch from another instance to the user's data. A row is only changed when the
+// incoming version is newer; billed rounds and rounds that would run twice in a group are left alone.
+func importSyncBatch(userID uint, batch syncBatch) (syncResult, error) {
+	var result syncResult
+	changedGroups := make(map[uint]bool)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		groupsBySyncID := make(map[string]WorkingGroup)
+		resolveGroup := func(syncID, name string, updatedAt time.Time) (WorkingGroup, error) {
+			if group, ok := groupsBySyncID[syncID]; ok {
+				return group, nil
+			}
+			group, err := findSyncedGroup(tx, userID, syncID)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				// Matched by name once; the mapping keeps them together when either side renames its group
+				err = tx.Scopes(userGroups(userID)).Where("LOWER(name) = ?", strings.ToLower(name)).First(&group).Error
+				if err == nil {
+					_, err = saveExternalMapping(tx, userID, mappingSync, mappingGroup, syncID, group.ID)
+				}
+			}
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				group = WorkingGroup{SyncID: syncID, Name: name, UserID: userID, UpdatedAt: updatedAt}
+				if err = tx.Create(&group).Error; err == nil {
+					result.Groups++
+				}
+			}
+			if err != nil {
+				return WorkingGroup{}, err
+			}
+			groupsBySyncID[syncID] = group
+			return group, nil
+		}
+
+		for _, incoming := range batch.Groups {
+			if incoming.SyncID == "" || strings.TrimSpace(incoming.Name) == "" {
+				continue
+			}
+			group, err := resolveGroup(incoming.SyncID, incoming.Name, incoming.UpdatedAt)
+			if err != nil {
+				return err
+			}
+			if group.Name == incoming.Name || !incoming.UpdatedAt.After(group.UpdatedAt) {
+				continue
+			}
+			// Compared like names are matched above, so no two groups end up differing only in case
+			var clashes int64
+			tx.Model(&WorkingGroup{}).Scopes(userGroups(userID)).
+				Where("LOWER(name) = ? AND id <> ?", strings.ToLower(incoming.Name), group.ID).Count(&clashes)
+			if clashes > 0 {
+				result.Skipped++
+				continue
+			}
+			if err := tx.Model(&group).UpdateColumns(map[string]interface{}{"name": incoming.Name, "updated_at": incoming.UpdatedAt}).Error; err != nil {
+				return err
+			}
+			group.Name = incoming.Name
+			groupsBySyncID[incoming.SyncID] = group
+			result.Groups++
+		}
+
+		for _, incoming := range batch.Rounds {
+			if incoming.SyncID == "" {
+				continue
+			}
+			group, err := resolveGroup(incoming.GroupSyncID, incoming.GroupName, incoming.UpdatedAt)
+			if err != nil {
+				return err
+			}
+
+			var running int64
+			if incoming.EndTime == nil {
+				tx.Model(&Round{}).Where("working_group_id = ? AND end_time IS NULL AND sync_id <> ?", group.ID, incoming.SyncID).Count(&running)
+			}
+
+			// A zone this instance doesn't know is dropped rather than stored, as reports couldn't use it
+			incomingTimeZone := incoming.TimeZone
+			if !validTimeZone(incomingTimeZone) {
+				incomingTimeZone = ""
+			}
+			// Rounds keep the source they had on the instance that created them
+			incomingSource := incoming.Source
+			if !validRoundSource(incomingSource) {
+				incomingSource = sourceSync
+			}
+
+			var round Round
+			err = tx.Scopes(userRounds(userID)).Where("sync_id = ?", incoming.SyncID).First(&round).Error
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				if running > 0 {
+					result.Skipped++
+					continue
+				}
+				round = Round{
+					SyncID:         incoming.SyncID,
+					StartTime:      incoming.StartTime,
+					EndTime:        incoming.EndTime,
+					WorkingGroupID: group.ID,
+					StartedBy:      incoming.StartedBy,
+					StartUserAgent: "sync",
+					StoppedBy:      incoming.StoppedBy,
+					Note:           incoming.Note,
+					Billable:       incoming.Billable,
+					TimeZone:       incomingTimeZone,
+					Source:         incomingSource,
+					PausedAt:       incoming.PausedAt,
+					PausedSeconds:  incoming.PausedSeconds,
+					UpdatedAt:      incoming.UpdatedAt,
+				}
+				if err := tx.Create(&round).Error; err != nil {
+					return err
+				}
+			case err != nil:
+				return err
+			case !incoming.UpdatedAt.After(round.UpdatedAt):
+				continue
+			case round.InvoiceID != nil || running > 0:
+				result.Skipped++
+				continue
+			default:
+				columns := map[string]interface{}{
+					"start_time":       incoming.StartTime,
+					"end_time":         incoming.EndTime,
+					"working_group_id": group.ID,
+					"stopped_by":       incoming.StoppedBy,
+					"note":             incoming.Note,
+					"paused_at":        incoming.PausedAt,
+					"paused_seconds":   incoming.PausedSeconds,
+					"updated_at":       incoming.UpdatedAt,
+				}
+				if incoming.Billable != nil {
+					columns["billable"] = *incoming.Billable
+				}
+				if incomingTimeZone != "" {
+					columns["time_zone"] = incomingTimeZone
+				}
+				if err := tx.Model(&round).UpdateColumns(columns).Error; err != nil {
+					return err
+				}
+				changedGroups[round.WorkingGroupID] = true
+			}
+			changedGroups[group.ID] = true
+			result.Rounds++
+		}
+
+		for _, deletion := range batch.Deleted {
+			switch deletion.Entity {
+			case "round":
+				var round Round
+				if tx.Scopes(userRounds(userID)).Where("sync_id = ?", deletion.SyncID).First(&round).Error != nil {
+					continue
+				}
+				if round.InvoiceID != nil || round.UpdatedAt.After(deletion.DeletedAt) {
+					result.Skipped++
+					continue
+				}
+				if err := deleteRoundPauses(tx, round.ID); err != nil {
+					return err
+				}
+				if err := tx.Delete(&round).Error; err != nil {
+					return err
+				}
+				if err := recordTombstone(tx, userID, "round", round.ID, round.SyncID); err != nil {
+					return err
+				}
+				changedGroups[round.WorkingGroupID] = true
+			case "group":
+				group, err := findSyncedGroup(tx, userID, deletion.SyncID)
+				if err != nil {
+					continue
+				}
+				// Same rules as deleting in the UI: never the last group, never one with rounds or subgroups
+				var rounds, groups, subgroups int64
+				tx.Model(&Round{}).Where("working_group_id = ?", group.ID).Count(&rounds)
+				tx.Model(&WorkingGroup{}).Scopes(userGroups(userID)).Count(&groups)
+				tx.Model(&WorkingGroup{}).Scopes(userGroups(userID)).Where("parent_id = ?", group.ID).Count(&subgroups)
+				if rounds > 0 || groups <= 1 || subgroups > 0 {
+					result.Skipped++
+					continue
+				}
+				if err := tx.Delete(&group).Error; err != nil {
+					return err
+				}
+				if err := deleteEntityMappings(tx, userID, mappingGroup, group.ID); err != nil {
+					return err
+				}
+				if err := deleteGroupMetadata(tx, group.ID); err != nil {
+					return err
+				}
+				if err := recordTombstone(tx, userID, "group", group.ID, group.SyncID); err != nil {
+					return err
+				}
+			default:
+				continue
+			}
+			result.Deleted++
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	for groupID := range changedGroups {
+		notifyRoundChange(groupID)
+	}
+	return result, nil
+}
+
+// apiSyncExport serves GET /api/v1/sync?since=<RFC 3339 time>, the peer's pull
+func apiSyncExport(c *fiber.Ctx) error {
+	var since time.Time
+	if value := c.Query("since"); value != "" {
+		parsed, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return c.Status(400).JSON(apiError{"since must be an RFC 3339 time"})
+		}
+		since = parsed
+	}
+	batch, err := exportSyncBatch(currentUserID(c), since)
+	if err != nil {
+		requestLog(c).Println("Error exporting sync batch:", err)
+		return c.Status(500).JSON(apiError{"error exporting changes"})
+	}
+	return c.JSON(batch)
+}
+
+// apiSyncImport serves POST /api/v1/sync, the peer's push
+func apiSyncImport(c *fiber.Ctx) error {
+	var batch syncBatch
+	if err := c.BodyParser(&batch); err != nil {
+		return c.Status(400).JSON(apiError{"invalid sync batch"})
+	}
+	result, err := importSyncBatch(currentUserID(c), batch)
+	if err != nil {
+		requestLog(c).Println("Error importing sync batch:", err)
+		return c.Status(500).JSON(apiError{"error importing changes"})
+	}
+	if result != (syncResult{}) {
+		recordAudit("sync.import", clientInfoFromRequest(c), 0, nil, syncResultSummary(result))
+	}
+	return c.JSON(result)
+}
+
+func syncResultSummary(result syncResult) string {
+	return fmt.Sprintf("Synced %d groups, %d rounds, %d deletions (%d skipped)", result.Groups, result.Rounds, result.Deleted, result.Skipped)
+}
+
+var syncHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// startSync exchanges changes with the configured peer on a schedule: pull its changes, then push ours
+func startSync() {
+	peer := strings.TrimRight(cfg.Sync.PeerURL, "/")
+	if peer == "" {
+		return
+	}
+	interval, err := time.ParseDuration(cfg.Sync.Interval)
+	if err != nil || interval < time.Minute {
+		log.Printf("Warning: ignoring SYNC_INTERVAL %q, using 5m", cfg.Sync.Interval)
+		interval = 5 * time.Minute
+	}
+	log.Printf("Syncing with %s every %s", peer, interval)
+
+	registerJob(jobSync, "every "+interval.String())
+	go func() {
+		for {
+			recordJobRun(jobSync, syncWithPeer(peer))
+			time.Sleep(interval)
+		}
+	}()
+}
+
+func syncWithPeer(peer string) error {
+	var user User
+	query := db.Order("id ASC")
+	if cfg.Sync.User != "" {
+		query = db.Where("username = ?", cfg.Sync.User)
+	}
+	if err := query.First(&user).Error; err != nil {
+		return fmt.Errorf("no local account to sync: %w", err)
+	}
+	client := ClientInfo{UserID: user.ID, Name: "sync", UserAgent: "sync", RemoteIP: peer}
+
+	// Pull
+	target := peer + "/api/v1/sync"
+	if pulled := getSetting(syncPulledKey, ""); pulled != "" {
+		target += "?since=" + url.QueryEscape(pulled)
+	}
+	var incoming syncBatch
+	if err := syncRequest(http.MethodGet, target, nil, &incoming); err != nil {
+		return fmt.Errorf("pull: %w", err)
+	}
+	result, err := importSyncBatch(user.ID, incoming)
+	if err != nil {
+		return fmt.Errorf("pull: %w", err)
+	}
+	if result != (syncResult{}) {
+		recordAudit("sync.import", client, 0, nil, syncResultSummary(result))
+	}
+	if err := setSetting(syncPulledKey, incoming.Until.UTC().Format(time.RFC3339Nano)); err != nil {
+		return err
+	}
+
+	// Push
+	var since time.Time
+	if pushed := getSetting(syncPushedKey, ""); pushed != "" {
+		since, _ = time.Parse(time.RFC3339Nano, pushed)
+	}
+	outgoing, err := exportSyncBatch(user.ID, since)
+	if err != nil {
+		return fmt.Errorf("push: %w", err)
+	}
+	if len(outgoing.Groups)+len(outgoing.Rounds)+len(outgoing.Deleted) > 0 {
+		if err := syncRequest(http.MethodPost, peer+"/api/v1/sync", outgoing, nil); err != nil {
+			return fmt.Errorf("push: %w", err)
+		}
+	}
+	return setSetting(syncPushedKey, outgoing.Until.UTC().Format(time.RFC3339Nano))
+}
+
+func syncRequest(method, target string, payload, response interface{}) error {
+	var body bytes.Buffer
+	if payload != nil {
+		if err := json.NewEncoder(&body).Encode(payload); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, target, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+cfg.Sync.PeerToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := syncHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+	if response == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Tag labels what a round was spent on within its group, such as "meetings" or "coding" in a client's group. Tags
+// belong to a user and can be used in all their groups; they are created the first time a round gets them.
+type Tag struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	UserID    uint      `gorm:"uniqueIndex:idx_tags_user_name" json:"-"`
+	Name      string    `gorm:"uniqueIndex:idx_tags_user_name;size:50;not null" json:"name"` // Lowercase, see parseTagNames
+	CreatedAt time.Time `json:"-"`
+}
+
+const (
+	maxTagLength = 50
+	maxRoundTags = 10
+)
+
+// parseTagNames reads tags typed as "meetings, coding": lowercased, with a leading # dropped and duplicates removed
+func parseTagNames(text string) ([]string, error) {
+	names := []string{}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(text, ",") {
+		name := strings.ToLower(strings.Join(strings.Fields(strings.TrimPrefix(strings.TrimSpace(part), "#")), " "))
+		if name == "" || seen[name] {
+			continue
+		}
+		if len(name) > maxTagLength {
+			return nil, fmt.Errorf("tag %q is too long (%d characters at most)", name, maxTagLength)
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	if len(names) > maxRoundTags {
+		return nil, fmt.Errorf("a round can have %d tags at most", maxRoundTags)
+	}
+	return names, nil
+}
+
+// tagRound replaces the tags of a round, creating the user's tags that don't exist yet, and records the change in
+// the audit log. Setting the tags the round already has does nothing.
+func tagRound(round *Round, names []string, client ClientInfo) error {
+	before, err := loadRoundTags([]uint{round.ID})
+	if err != nil {
+		return err
+	}
+	previous := before[round.ID]
+	if strings.Join(previous, ",") == strings.Join(sortedTagNames(names), ",") {
+		round.Tags = tagsNamed(previous)
+		return nil
+	}
+
+	var tags []Tag
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, name := range names {
+			tag := Tag{UserID: client.UserID, Name: name}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tag).Error; err != nil {
+				return err
+			}
+			// The user had the tag already
+			if tag.ID == 0 {
+				if err := tx.Where("user_id = ? AND name = ?", client.UserID, name).Take(&tag).Error; err != nil {
+					return err
+				}
+			}
+			tags = append(tags, tag)
+		}
+		if len(tags) == 0 {
+			return tx.Model(round).Association("Tags").Clear()
+		}
+		return tx.Model(round).Association("Tags").Replace(tags)
+	})
+	if err != nil {
+		return err
+	}
+	round.Tags = tags
+
+	details := "Removed the tags of the round"
+	if len(names) > 0 {
+		details = "Tagged the round " + strings.Join(names, ", ")
+	}
+	if len(previous) > 0 && len(names) > 0 {
+		details += " (was " + strings.Join(previous, ", ") + ")"
+	}
+	recordAudit("round.tags", client, round.WorkingGroupID, &round.ID, details)
+	return nil
+}
+
+// sortedTagNames is a sorted copy of names, the order loadRoundTags returns them in
+func sortedTagNames(names []string) []string {
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// tagsNamed turns tag names back into tags, for JSON responses
+func tagsNamed(names []string) []Tag {
+	tags := make([]Tag, len(names))
+	for i, name := range names {
+		tags[i].Name = name
+	}
+	return tags
+}
+
+// tagViews are tags as pages link them, to the statistics filtered by the tag
+func tagViews(names []string) []fiber.Map {
+	views := make([]fiber.Map, len(names))
+	for i, name := range names {
+		views[i] = fiber.Map{"Name": name, "Query": url.QueryEscape(name)}
+	}
+	return views
+}
+
+// loadRoundTags returns the tag names of each of the rounds, sorted
+func loadRoundTags(roundIDs []uint) (map[uint][]string, error) {
+	byRound := make(map[uint][]string)
+	if len(roundIDs) == 0 {
+		return byRound, nil
+	}
+	var rows []struct {
+		RoundID uint
+		Name    string
+	}
+	err := db.Table("round_tags").Select("round_tags.round_id, tags.name").
+		Joins("JOIN tags ON tags.id = round_tags.tag_id").
+		Where("round_tags.round_id IN ?", roundIDs).Order("tags.name ASC").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		byRound[row.RoundID] = append(byRound[row.RoundID], row.Name)
+	}
+	return byRound, nil
+}
+
+// userTagNames lists the names of the user's tags, for filters
+func userTagNames(userID uint) ([]string, error) {
+	var names []string
+	err := db.Model(&Tag{}).Where("user_id = ?", userID).Order("name ASC").Pluck("name", &names).Error
+	return names, err
+}
+
+// roundsTagged limits a query on rounds to those carrying the user's tag
+func roundsTagged(userID uint, name string) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("rounds.id IN (?)", db.Table("round_tags").Select("round_tags.round_id").
+			Joins("JOIN tags ON tags.id = round_tags.tag_id").Where("tags.user_id = ? AND tags.name = ?", userID, name))
+	}
+}
+
+// errUnknownTag is returned for filters naming a tag the user doesn't have
+var errUnknownTag = errors.New("unknown tag")
+
+// parseTagFilter reads the ?tag= of a report; empty means all rounds
+func parseTagFilter(userID uint, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	name := strings.ToLower(strings.TrimSpace(value))
+	var count int64
+	if err := db.Model(&Tag{}).Where("user_id = ? AND name = ?", userID, name).Count(&count).Error; err != nil {
+		return "", err
+	}
+	if count == 0 {
+		return "", errUnknownTag
+	}
+	return name, nil
+}
+
+// TagTotal is the time of a group's rounds with one tag, for the statistics page
+type TagTotal struct {
+	Name         string
+	TotalSeconds int64 // Rounds with several tags count toward each
+	RoundCount   int
+	Query        string // The name escaped for links
+}
+
+// getTagTotals sums a group's rounds per tag, running rounds up to now, largest first
+func getTagTotals(ctx context.Context, groupID uint) ([]TagTotal, error) {
+	var rows []struct {
+		Name          string
+		StartTime     time.Time
+		EndTime       *time.Time
+		PausedAt      *time.Time
+		PausedSeconds int64
+	}
+	err := db.WithContext(ctx).Table("round_tags").Select("tags.name, rounds.start_time, rounds.end_time, rounds.paused_at, rounds.paused_seconds").
+		Joins("JOIN tags ON tags.id = round_tags.tag_id").
+		Joins("JOIN rounds ON rounds.id = round_tags.round_id").
+		Where("rounds.working_group_id = ?", groupID).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	byName := make(map[string]*TagTotal)
+	for _, row := range rows {
+		total, ok := byName[row.Name]
+		if !ok {
+			total = &TagTotal{Name: row.Name, Query: url.QueryEscape(row.Name)}
+			byName[row.Name] = total
+		}
+		total.TotalSeconds += roundWorkedSeconds(Round{StartTime: row.StartTime, EndTime: row.EndTime, PausedAt: row.PausedAt,
+			PausedSeconds: row.PausedSeconds}, now)
+		total.RoundCount++
+	}
+
+	totals := make([]TagTotal, 0, len(byName))
+	for _, total := range byName {
+		totals = append(totals, *total)
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].TotalSeconds != totals[j].TotalSeconds {
+			return totals[i].TotalSeconds > totals[j].TotalSeconds
+		}
+		return totals[i].Name < totals[j].Name
+	})
+	return totals, nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Target levels: how a total compares to its target, for coloring it without redoing the math
+const (
+	targetUnder = "under"
+	targetOn    = "on"
+	targetOver  = "over"
+)
+
+// targetTolerance is how far a total may be from its target and still count as on target
+const targetTolerance = 0.1
+
+// workdaysPerWeek turns a daily target into a weekly one for weeks without planned hours
+const workdaysPerWeek = 5
+
+// targetLevel compares seconds with a target; without a target there is no level
+func targetLevel(seconds, target int64) string {
+	switch {
+	case target <= 0:
+		return ""
+	case float64(seconds) < float64(target)*(1-targetTolerance):
+		return targetUnder
+	case float64(seconds) > float64(target)*(1+targetTolerance):
+		return targetOver
+	default:
+		return targetOn
+	}
+}
+
+// targetLevelClass is the Bulma color of a target level: warning below, success on and danger above the target
+func targetLevelClass(level string) string {
+	switch level {
+	case targetUnder:
+		return "is-warning"
+	case targetOn:
+		return "is-success"
+	case targetOver:
+		return "is-danger"
+	default:
+		return ""
+	}
+}
+
+// applyDailyTarget fills in the group's daily target and, while a round runs, when today's total reaches it at the
+// current pace. The estimate only moves when a round starts or stops, so the live channel's "rounds" event is
+// enough to keep the dashboard current.
+func applyDailyTarget(state *AppState, targetMinutes int, now time.Time) {
+	if targetMinutes <= 0 {
+		return
+	}
+	target := int64(targetMinutes) * 60
+	state.DailyTargetSeconds = target
+	state.DailyTargetFormatted = formatTimesheetHours(target)
+	state.DailyTargetLevel = targetLevel(state.TotalTodaySeconds, target)
+	state.DailyTargetClass = targetLevelClass(state.DailyTargetLevel)
+
+	remaining := target - state.TotalTodaySeconds
+	if remaining <= 0 {
+		state.TargetReached = true
+		return
+	}
+	state.TargetRemainingFormatted = formatDuration(remaining)
+	if !state.IsRunning {
+		return
+	}
+	eta := now.Add(time.Duration(remaining) * time.Second)
+	state.TargetETA = &eta
+	state.TargetETAStr = eta.Format("15:04")
+	if eta.Format("2006-01-02") != now.Format("2006-01-02") {
+		state.TargetETAStr = eta.Format("Mon 15:04")
+	}
+}
+
+// weeklyTarget is a group's target for the week starting at start: the hours planned for it on /planning, or its
+// daily target on every workday when nothing is planned. Day exceptions replace the target of their day, including
+// weekend days.
+func weeklyTarget(plannedSeconds int64, dailyTargetMinutes int, exceptions map[string]CapacityException, start time.Time) int64 {
+	if plannedSeconds > 0 {
+		return plannedSeconds
+	}
+	var minutes int
+	for i := 0; i < 7; i++ {
+		daily := dailyTargetMinutes
+		if i >= workdaysPerWeek {
+			daily = 0
+		}
+		minutes += dayTargetMinutes(daily, exceptions, start.AddDate(0, 0, i).Format("2006-01-02"))
+	}
+	return int64(minutes) * 60
+}
+
+// applyWeeklyTarget fills in the group's weekly target and how this week's total compares to it
+func applyWeeklyTarget(state *AppState, plannedSeconds int64, dailyTargetMinutes int, exceptions map[string]CapacityException, start time.Time) {
+	target := weeklyTarget(plannedSeconds, dailyTargetMinutes, exceptions, start)
+	if target <= 0 {
+		return
+	}
+	state.WeeklyTargetSeconds = target
+	state.WeeklyTargetFormatted = formatTimesheetHours(target)
+	state.WeeklyTargetLevel = targetLevel(state.TotalWeekSeconds, target)
+	state.WeeklyTargetClass = targetLevelClass(state.WeeklyTargetLevel)
+}
+
+// plannedWeekSeconds sums the hours planned for the week starting at start per working group of the user
+func plannedWeekSeconds(ctx context.Context, userID uint, start time.Time) (map[uint]int64, error) {
+	var rows []struct {
+		WorkingGroupID uint
+		Minutes        int64
+	}
+	err := db.WithContext(ctx).Model(&PlannedHours{}).
+		Select("working_group_id, SUM(minutes) AS minutes").
+		Where("user_id = ? AND date >= ? AND date < ?", userID,
+			start.Format("2006-01-02"), start.AddDate(0, 0, 7).Format("2006-01-02")).
+		Group("working_group_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	planned := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		planned[row.WorkingGroupID] = row.Minutes * 60
+	}
+	return planned, nil
+}
+
+// GroupWeekStatus is one working group's week so far against its weekly target, for the heat strip of the dashboard
+type GroupWeekStatus struct {
+	GroupID               uint   `json:"group_id"`
+	GroupName             string `json:"group_name"`
+	GroupColor            string `json:"group_color"`
+	GroupIcon             string `json:"group_icon,omitempty"`
+	TotalWeekSeconds      int64  `json:"total_week_seconds"`
+	TotalWeekFormatted    string `json:"total_week"`
+	WeeklyTargetSeconds   int64  `json:"weekly_target_seconds,omitempty"`
+	WeeklyTargetFormatted string `json:"-"`
+	Level                 string `json:"level,omitempty"` // under, on or over, empty without a target
+	Class                 string `json:"-"`
+}
+
+// groupWeekStatuses compares every group's week so far with its weekly target
+func groupWeekStatuses(groups []WorkingGroup, totals map[uint]groupRoundTotals, planned map[uint]int64,
+	exceptions map[uint]map[string]CapacityException, start time.Time) []GroupWeekStatus {
+	statuses := make([]GroupWeekStatus, 0, len(groups))
+	for _, group := range groups {
+		week := totals[group.ID].WeekSeconds
+		target := weeklyTarget(planned[group.ID], group.DailyTargetMinutes, exceptions[group.ID], start)
+		status := GroupWeekStatus{
+			GroupID:             group.ID,
+			GroupName:           group.Name,
+			GroupColor:          groupColor(group),
+			GroupIcon:           group.Icon,
+			TotalWeekSeconds:    week,
+			TotalWeekFormatted:  formatDuration(week),
+			WeeklyTargetSeconds: target,
+			Level:               targetLevel(week, target),
+		}
+		if target > 0 {
+			status.WeeklyTargetFormatted = formatTimesheetHours(target)
+		}
+		status.Class = targetLevelClass(status.Level)
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
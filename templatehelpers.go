@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gofiber/template/handlebars/v2"
+	"github.com/mailgun/raymond/v2"
+)
+
+// Views show text users typed in (group names, notes, file names) on many pages. {{value}} escapes it, and user
+// content must never go through {{{value}}}, which doesn't. multiline, groupLabel and highlight are for text that
+// needs more than escaping; they escape first and only then add markup, so their output is as safe as {{value}}.
+//
+// duration, date, plural, percent and money format the numbers and times views are given, so handlers pass seconds and
+// times as they are instead of a formatted copy of each.
+func registerTemplateHelpers(engine *handlebars.Engine) {
+	engine.AddFuncMap(map[string]interface{}{
+		"multiline":  multilineHelper,
+		"groupLabel": groupLabelHelper,
+		"highlight":  highlightHelper,
+		"duration":   durationHelper,
+		"date":       dateHelper,
+		"plural":     pluralHelper,
+		"percent":    percentHelper,
+		"money":      moneyHelper,
+	})
+}
+
+// multilineHelper shows text with its line breaks, such as a note: {{multiline Note}}
+func multilineHelper(text interface{}) raymond.SafeString {
+	escaped := raymond.Escape(raymond.Str(text))
+	escaped = strings.NewReplacer("\r\n", "<br>", "\r", "<br>", "\n", "<br>").Replace(escaped)
+	return raymond.SafeString(escaped)
+}
+
+// groupLabelHelper is a working group's name, or "Group #<id>" when it has none: {{groupLabel Name ID}}. Like any
+// helper result that isn't a SafeString, Handlebars escapes it.
+func groupLabelHelper(name, id interface{}) string {
+	if label := strings.TrimSpace(raymond.Str(name)); label != "" {
+		return label
+	}
+	return fmt.Sprintf("Group #%s", raymond.Str(id))
+}
+
+// highlightHelper is multiline with the words of a search marked, such as a note in the search results:
+// {{highlight Note @root.Terms}}. Matches are found in the text as typed and each piece is escaped on its own, so a
+// word can't match inside an escaped character.
+func highlightHelper(text, terms interface{}) raymond.SafeString {
+	words, _ := terms.([]string)
+	if len(words) == 0 {
+		return multilineHelper(text)
+	}
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = regexp.QuoteMeta(word)
+	}
+	pattern := regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+	value := raymond.Str(text)
+	var marked strings.Builder
+	last := 0
+	for _, match := range pattern.FindAllStringIndex(value, -1) {
+		marked.WriteString(string(multilineHelper(value[last:match[0]])))
+		marked.WriteString("<mark>" + string(multilineHelper(value[match[0]:match[1]])) + "</mark>")
+		last = match[1]
+	}
+	marked.WriteString(string(multilineHelper(value[last:])))
+	return raymond.SafeString(marked.String())
+}
+
+// helperNumber reads a number passed to a helper, whatever its Go type; anything else counts as 0
+func helperNumber(value interface{}) float64 {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	}
+	return 0
+}
+
+// durationHelper shows seconds as HH:MM:SS, like every total: {{duration TotalSeconds}}
+func durationHelper(seconds interface{}) string {
+	return formatDuration(int64(helperNumber(seconds)))
+}
+
+// dateLayouts are the names dateHelper takes for the formats views use
+var dateLayouts = map[string]string{
+	"datetime": "2006-01-02 15:04:05",
+	"minutes":  "2006-01-02 15:04",
+	"date":     "2006-01-02",
+	"time":     "15:04",
+	"day":      "Monday, January 2, 2006",
+}
+
+// dateHelper formats a time by a layout name from dateLayouts, or a Go layout: {{date StartTime "datetime"}}. A nil
+// or zero time shows as nothing, so views can {{#if}} around it.
+func dateHelper(value interface{}, layout string) string {
+	var t time.Time
+	switch v := value.(type) {
+	case time.Time:
+		t = v
+	case *time.Time:
+		if v != nil {
+			t = *v
+		}
+	}
+	if t.IsZero() {
+		return ""
+	}
+	if named, ok := dateLayouts[layout]; ok {
+		layout = named
+	}
+	return t.Format(layout)
+}
+
+// pluralHelper shows a count with a noun that agrees with it: {{plural RoundCount "round"}} is "1 round" or
+// "3 rounds". Nouns that don't just take an s give theirs: {{plural Count "entry" plural="entries"}}.
+func pluralHelper(count interface{}, singular string, options *raymond.Options) string {
+	n := helperNumber(count)
+	if n == 1 {
+		return "1 " + singular
+	}
+	plural := options.HashStr("plural")
+	if plural == "" {
+		plural = singular + "s"
+	}
+	return fmt.Sprintf("%s %s", raymond.Str(count), plural)
+}
+
+// percentHelper shows part as a whole percentage of total, 0% when total is 0: {{percent TotalSeconds GroupSeconds}}
+func percentHelper(part, total interface{}) string {
+	whole := helperNumber(total)
+	if whole == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%d%%", int(helperNumber(part)*100/whole))
+}
+
+// moneyHelper shows an amount in cents with its currency: {{money EarnedCents Currency}}
+func moneyHelper(cents interface{}, currency string) string {
+	return formatMoney(int64(helperNumber(cents)), currency)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/template/handlebars/v2"
+)
+
+// Text a user could type as a group name, icon, note or tag, each trying to leave the element or attribute it is
+// shown in
+var (
+	hostileName = `<script>alert("name")</script>`
+	hostileIcon = `"><img src=x onerror=alert(1)>`
+	hostileNote = "</textarea><script>alert('note')</script>\n\" onmouseover=\"alert(2)"
+	hostileTag  = `tag"><svg onload=alert(3)>`
+)
+
+// unescaped are the pieces of the hostile values that only show up in a page when they weren't escaped
+var unescaped = []string{"<script>alert(", "<img src=x", "<svg onload", `" onmouseover="`, "</textarea><script>"}
+
+func assertEscaped(t *testing.T, page, body string) {
+	t.Helper()
+	for _, raw := range unescaped {
+		if strings.Contains(body, raw) {
+			t.Errorf("%s shows %q unescaped", page, raw)
+		}
+	}
+}
+
+func TestMultilineHelperEscapes(t *testing.T) {
+	got := string(multilineHelper(hostileNote))
+	want := "&lt;/textarea&gt;&lt;script&gt;alert(&apos;note&apos;)&lt;/script&gt;<br>&quot; onmouseover=&quot;alert(2)"
+	if got != want {
+		t.Errorf("multiline = %q, want %q", got, want)
+	}
+}
+
+func TestHighlightHelperEscapes(t *testing.T) {
+	// A term that is part of the markup, not of the text, must not be able to split an escaped character
+	got := string(highlightHelper(`<b>"quote"</b> & alert`, []string{"alert", "quot", "b"}))
+	for _, raw := range []string{"<b>", `"quote"`, " & "} {
+		if strings.Contains(got, raw) {
+			t.Errorf("highlight = %q, shows %q unescaped", got, raw)
+		}
+	}
+	if !strings.Contains(got, "<mark>alert</mark>") {
+		t.Errorf("highlight = %q, want alert marked", got)
+	}
+}
+
+// newTestViews loads the embedded views with the helpers, like main does
+func newTestViews(t *testing.T) *handlebars.Engine {
+	t.Helper()
+	views, err := fs.Sub(embeddedFS, "views")
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := handlebars.NewFileSystem(http.FS(views), ".hbs")
+	registerTemplateHelpers(engine)
+	if err := engine.Load(); err != nil {
+		t.Fatalf("loading views: %v", err)
+	}
+	return engine
+}
+
+// TestPagesEscapeUserContent renders the pages that show group names, icons, notes and tags with values that try to
+// break out of their markup, and checks none of it reaches the page as markup
+func TestPagesEscapeUserContent(t *testing.T) {
+	useTestDatabase(t, "sqlite", "")
+	user, group := createTestGroup(t)
+	if err := db.Model(&group).Updates(map[string]interface{}{"name": hostileName, "icon": hostileIcon}).Error; err != nil {
+		t.Fatalf("naming group: %v", err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	end := now.Add(-time.Hour)
+	finished := Round{WorkingGroupID: group.ID, StartTime: end.Add(-time.Hour), EndTime: &end, Note: hostileNote,
+		Source: sourceManual, Tags: []Tag{{UserID: user.ID, Name: hostileTag}}}
+	running := Round{WorkingGroupID: group.ID, StartTime: now.Add(-10 * time.Minute), Note: hostileNote, Source: sourceManual}
+	for _, round := range []*Round{&finished, &running} {
+		if err := db.Create(round).Error; err != nil {
+			t.Fatalf("creating round: %v", err)
+		}
+	}
+
+	app := fiber.New(fiber.Config{Views: newTestViews(t), PassLocalsToViews: true})
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user", &user)
+		c.Locals("BasePath", "")
+		c.Locals("CSRFToken", "test")
+		return c.Next()
+	})
+	app.Get("/", renderIndex)
+	app.Get("/status", getStatus)
+	app.Get("/basic", renderBasicStatus)
+	app.Get("/board", renderBoard)
+	app.Get("/stats", renderStats)
+	app.Get("/stats/day/:date", renderDayDetail)
+	app.Get("/rounds", renderRoundList)
+	app.Get("/rounds/:id", renderRoundDetail)
+	app.Get("/search", renderSearch)
+	app.Get("/groups/manage", renderGroupManagement)
+	app.Get("/calendar", renderCalendar)
+
+	pages := []string{
+		"/",
+		fmt.Sprintf("/status?group_id=%d", group.ID),
+		fmt.Sprintf("/basic?group_id=%d", group.ID),
+		"/board",
+		fmt.Sprintf("/stats?group_id=%d", group.ID),
+		fmt.Sprintf("/stats/day/%s?group_id=%d", finished.StartTime.Format("2006-01-02"), group.ID),
+		"/rounds",
+		fmt.Sprintf("/rounds/%d", finished.ID),
+		"/search?q=alert",
+		"/groups/manage",
+		fmt.Sprintf("/calendar?view=week&date=%s&group_id=%d", now.Format("2006-01-02"), group.ID),
+	}
+	for _, page := range pages {
+		response, err := app.Test(httptest.NewRequest(http.MethodGet, page, nil), -1)
+		if err != nil {
+			t.Fatalf("%s: %v", page, err)
+		}
+		body, _ := io.ReadAll(response.Body)
+		if response.StatusCode != fiber.StatusOK {
+			t.Errorf("%s answered %d: %s", page, response.StatusCode, body)
+			continue
+		}
+		if !strings.Contains(string(body), "&lt;script&gt;alert(") {
+			t.Errorf("%s doesn't show the escaped group name or note", page)
+		}
+		assertEscaped(t, page, string(body))
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// timesheetClient marks the rounds the timesheet creates; only those are adjusted when a cell is edited
+const timesheetClient = "timesheet"
+
+// timesheetCell is the time of one group on one day
+type timesheetCell struct {
+	Name    string // Form field, e.g. "h_3_2025-03-03"
+	Value   string // Hours as h:mm, empty for none
+	Fixed   string // Tracked time the cell cannot go below, when there is any
+	Running bool   // A round is running that day; it counts once stopped
+}
+
+type timesheetRow struct {
+	GroupID   uint
+	GroupName string
+	Cells     []timesheetCell
+	Total     string
+}
+
+type timesheetDay struct {
+	Date  string // YYYY-MM-DD
+	Label string // e.g. "Mon 3"
+	Total string
+}
+
+// dayTotals holds the finished rounds of one group on one day
+type dayTotals struct {
+	fixed      int64   // Tracked rounds and billed timesheet rounds, left alone by the timesheet
+	adjustable []Round // Unbilled timesheet rounds, replaced when the cell changes
+	running    bool
+}
+
+func (t dayTotals) total() int64 {
+	total := t.fixed
+	for _, round := range t.adjustable {
+		total += roundWorkedSeconds(round, *round.EndTime)
+	}
+	return total
+}
+
+// weekStart returns Monday 00:00 of the week containing t
+func weekStart(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -offset)
+}
+
+// parseTimesheetWeek reads ?week= (any date of the week), defaulting to the current week
+func parseTimesheetWeek(value string) (time.Time, error) {
+	if value == "" {
+		return weekStart(time.Now()), nil
+	}
+	date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return weekStart(date), nil
+}
+
+// parseTimesheetHours accepts "7:30", "7.5", "7,5", "7h30", "7h" and "45m"; empty means no time
+func parseTimesheetHours(value string) (int64, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return 0, nil
+	}
+	var seconds int64
+	if hours, minutes, ok := strings.Cut(strings.ReplaceAll(value, "h", ":"), ":"); ok {
+		h, err := strconv.Atoi(strings.TrimSpace(hours))
+		if err != nil || h < 0 {
+			return 0, fmt.Errorf("invalid hours %q", value)
+		}
+		m := 0
+		if minutes = strings.TrimSpace(minutes); minutes != "" {
+			if m, err = strconv.Atoi(minutes); err != nil || m < 0 || m > 59 {
+				return 0, fmt.Errorf("invalid minutes %q", value)
+			}
+		}
+		seconds = int64(h*3600 + m*60)
+	} else if minutes, ok := strings.CutSuffix(value, "m"); ok {
+		m, err := strconv.Atoi(strings.TrimSpace(minutes))
+		if err != nil || m < 0 {
+			return 0, fmt.Errorf("invalid minutes %q", value)
+		}
+		seconds = int64(m * 60)
+	} else {
+		hours, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", "."), 64)
+		if err != nil || hours < 0 || math.IsNaN(hours) {
+			return 0, fmt.Errorf("invalid hours %q", value)
+		}
+		seconds = int64(math.Round(hours*60)) * 60
+	}
+	if seconds > 24*3600 {
+		return 0, fmt.Errorf("more than 24 hours in %q", value)
+	}
+	return seconds, nil
+}
+
+// formatTimesheetHours renders seconds as h:mm, empty for zero
+func formatTimesheetHours(seconds int64) string {
+	minutes := (seconds + 30) / 60
+	if minutes <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d:%02d", minutes/60, minutes%60)
+}
+
+// loadTimesheet collects the rounds of the user's groups that started in the week, per group and day
+func loadTimesheet(userID uint, start time.Time) (map[uint]map[string]*dayTotals, error) {
+	var rounds []Round
+	if err := db.Scopes(userRounds(userID)).
+		Where("start_time >= ? AND start_time < ?", start, start.AddDate(0, 0, 7)).
+		Find(&rounds).Error; err != nil {
+		return nil, err
+	}
+	totals := make(map[uint]map[string]*dayTotals)
+	for _, round := range rounds {
+		if totals[round.WorkingGroupID] == nil {
+			totals[round.WorkingGroupID] = make(map[string]*dayTotals)
+		}
+		date := round.StartTime.In(time.Local).Format("2006-01-02")
+		day := totals[round.WorkingGroupID][date]
+		if day == nil {
+			day = &dayTotals{}
+			totals[round.WorkingGroupID][date] = day
+		}
+		switch {
+		case round.EndTime == nil:
+			day.running = true
+		case round.StartedBy == timesheetClient && round.InvoiceID == nil:
+			day.adjustable = append(day.adjustable, round)
+		default:
+			day.fixed += roundWorkedSeconds(round, *round.EndTime)
+		}
+	}
+	return totals, nil
+}
+
+// renderTimesheet shows a week as a grid of groups and days
+func renderTimesheet(c *fiber.Ctx) error {
+	start, err := parseTimesheetWeek(c.Query("week"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid week")
+	}
+	userID := currentUserID(c)
+	groups, err := getWorkingGroupsOrdered(userID)
+	if err != nil {
+		requestLog(c).Println("Error loading working groups:", err)
+		return c.Status(500).SendString("Error loading timesheet")
+	}
+	totals, err := loadTimesheet(userID, start)
+	if err != nil {
+		requestLog(c).Println("Error loading timesheet:", err)
+		return c.Status(500).SendString("Error loading timesheet")
+	}
+
+	days := make([]timesheetDay, 7)
+	dayTotalSeconds := make([]int64, 7)
+	for i := range days {
+		date := start.AddDate(0, 0, i)
+		days[i] = timesheetDay{Date: date.Format("2006-01-02"), Label: date.Format("Mon 2")}
+	}
+	var weekTotal int64
+	rows := make([]timesheetRow, 0, len(groups))
+	for _, group := range groups {
+		row := timesheetRow{GroupID: group.ID, GroupName: group.Name}
+		var rowTotal int64
+		for i, day := range days {
+			cell := timesheetCell{Name: fmt.Sprintf("h_%d_%s", group.ID, day.Date)}
+			if t := totals[group.ID][day.Date]; t != nil {
+				cell.Value = formatTimesheetHours(t.total())
+				cell.Fixed = formatTimesheetHours(t.fixed)
+				cell.Running = t.running
+				rowTotal += t.total()
+				dayTotalSeconds[i] += t.total()
+			}
+			row.Cells = append(row.Cells, cell)
+		}
+		row.Total = formatTimesheetHours(rowTotal)
+		weekTotal += rowTotal
+		rows = append(rows, row)
+	}
+	for i := range days {
+		days[i].Total = formatTimesheetHours(dayTotalSeconds[i])
+	}
+
+	return c.Render("timesheet", fiber.Map{
+		"Week":      start.Format("2006-01-02"),
+		"WeekLabel": start.Format("Jan 2") + " – " + start.AddDate(0, 0, 6).Format("Jan 2, 2006"),
+		"PrevWeek":  start.AddDate(0, 0, -7).Format("2006-01-02"),
+		"NextWeek":  start.AddDate(0, 0, 7).Format("2006-01-02"),
+		"Days":      days,
+		"Rows":      rows,
+		"WeekTotal": formatTimesheetHours(weekTotal),
+		"Saved":     c.Query("saved") != "",
+		"Can":       permissionsView(c),
+	})
+}
+
+// timesheetChange is one edited cell: the group and day, and the time the timesheet rounds should add up to
+type timesheetChange struct {
+	group   WorkingGroup
+	day     time.Time
+	current dayTotals
+	seconds int64 // Length of the timesheet round, 0 removes it
+}
+
+// saveTimesheet applies the edited cells. Tracked rounds are never touched: a cell can only add time on top of
+// them, and the difference is kept in a single "timesheet" round that is replaced on every edit.
+func saveTimesheet(c *fiber.Ctx) error {
+	start, err := parseTimesheetWeek(c.FormValue("week"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid week")
+	}
+	userID := currentUserID(c)
+	groups, err := getWorkingGroupsOrdered(userID)
+	if err != nil {
+		requestLog(c).Println("Error loading working groups:", err)
+		return c.Status(500).SendString("Error saving timesheet")
+	}
+	totals, err := loadTimesheet(userID, start)
+	if err != nil {
+		requestLog(c).Println("Error loading timesheet:", err)
+		return c.Status(500).SendString("Error saving timesheet")
+	}
+
+	var changes []timesheetChange
+	for _, group := range groups {
+		for i := 0; i < 7; i++ {
+			day := start.AddDate(0, 0, i)
+			date := day.Format("2006-01-02")
+			field := fmt.Sprintf("h_%d_%s", group.ID, date)
+			if c.Request().PostArgs().Peek(field) == nil {
+				continue // Not part of the form, e.g. a group created after the page was loaded
+			}
+			seconds, err := parseTimesheetHours(c.FormValue(field))
+			if err != nil {
+				return c.Status(400).SendString(fmt.Sprintf("%s on %s: %v", group.Name, date, err))
+			}
+			current := dayTotals{}
+			if t := totals[group.ID][date]; t != nil {
+				current = *t
+			}
+			// Unchanged cells keep their rounds, even when the typed value was rounded to the minute
+			if formatTimesheetHours(seconds) == formatTimesheetHours(current.total()) {
+				continue
+			}
+			if (seconds+30)/60 < (current.fixed+30)/60 {
+				return c.Status(400).SendString(fmt.Sprintf("%s on %s: %s are already tracked; edit those rounds instead",
+					group.Name, date, formatTimesheetHours(current.fixed)))
+			}
+			changes = append(changes, timesheetChange{group: group, day: day, current: current, seconds: max(seconds-current.fixed, 0)})
+		}
+	}
+
+	client := clientInfoFromRequest(c)
+	var created []Round
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, change := range changes {
+			for _, round := range change.current.adjustable {
+				if err := deleteRoundPauses(tx, round.ID); err != nil {
+					return err
+				}
+				if err := tx.Delete(&Round{}, round.ID).Error; err != nil {
+					return err
+				}
+				if err := recordTombstone(tx, userID, "round", round.ID, round.SyncID); err != nil {
+					return err
+				}
+			}
+			if change.seconds == 0 {
+				continue
+			}
+			// Place the time from 9:00, or so it ends at midnight when the day is too full for that
+			dayEnd := change.day.AddDate(0, 0, 1)
+			duration := time.Duration(change.seconds) * time.Second
+			startTime := change.day.Add(9 * time.Hour)
+			if startTime.Add(duration).After(dayEnd) {
+				startTime = dayEnd.Add(-duration)
+			}
+			endTime := startTime.Add(duration)
+			round := Round{
+				StartTime:      startTime,
+				EndTime:        &endTime,
+				WorkingGroupID: change.group.ID,
+				StartedBy:      timesheetClient,
+				StartUserAgent: client.UserAgent,
+				StoppedBy:      timesheetClient,
+				StopUserAgent:  client.UserAgent,
+				Source:         sourceTimesheet,
+			}
+			if err := tx.Create(&round).Error; err != nil {
+				return err
+			}
+			created = append(created, round)
+		}
+		return nil
+	})
+	if err != nil {
+		requestLog(c).Println("Error saving timesheet:", err)
+		return c.Status(500).SendString("Error saving timesheet")
+	}
+
+	client.Name = timesheetClient
+	for _, change := range changes {
+		date := change.day.Format("2006-01-02")
+		var roundID *uint
+		for i := range created {
+			if created[i].WorkingGroupID == change.group.ID && created[i].StartTime.Format("2006-01-02") == date {
+				roundID = &created[i].ID
+			}
+		}
+		hours := formatTimesheetHours(change.current.fixed + change.seconds)
+		if hours == "" {
+			hours = "0:00"
+		}
+		recordAudit("round.timesheet", client, change.group.ID, roundID, fmt.Sprintf("Set '%s' on %s to %s", change.group.Name, date, hours))
+		notifyRoundChange(change.group.ID)
+	}
+
+	return c.Redirect("/timesheet?week="+start.Format("2006-01-02")+"&saved=1", fiber.StatusSeeOther)
+}
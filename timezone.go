@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Report clocks: which time zone reports put a round's times and days in. Home is the server's time zone (TZ), which
+// every report used before rounds remembered theirs; local is the time zone the round was recorded in, the wall clock
+// where its owner was at the time.
+const (
+	clockHome  = "home"
+	clockLocal = "local"
+)
+
+// timeZoneCookie is set by /static/timezone.js to the browser's IANA time zone, e.g. "Europe/Berlin"
+const timeZoneCookie = "tz"
+
+// zoneCache keeps loaded locations by name, as time.LoadLocation reads the zone database every time
+var zoneCache sync.Map
+
+// loadZone returns the named time zone, or the home time zone for an empty or unknown name
+func loadZone(name string) *time.Location {
+	if name == "" {
+		return time.Local
+	}
+	if location, ok := zoneCache.Load(name); ok {
+		return location.(*time.Location)
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return time.Local
+	}
+	zoneCache.Store(name, location)
+	return location
+}
+
+// validTimeZone reports whether name is an IANA time zone that can be stored with a round
+func validTimeZone(name string) bool {
+	if name == "" || name == "Local" || len(name) > 64 {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// clientTimeZone is the time zone a request was sent from: the X-Time-Zone header of API clients, or the cookie of
+// browsers. Empty when neither is there or the value isn't a known zone, which means home.
+func clientTimeZone(c *fiber.Ctx) string {
+	name := c.Get("X-Time-Zone")
+	if name == "" {
+		name = c.Cookies(timeZoneCookie)
+	}
+	if !validTimeZone(name) {
+		return ""
+	}
+	// The browser reports the zone it is in, and that is home more often than not; storing nothing keeps rounds
+	// following the home zone if it is ever changed
+	if name == time.Local.String() {
+		return ""
+	}
+	return name
+}
+
+// parseClock reads the ?clock= of a report; empty means home
+func parseClock(value string) (string, error) {
+	switch value {
+	case "", clockHome:
+		return clockHome, nil
+	case clockLocal:
+		return clockLocal, nil
+	default:
+		return "", errors.New("clock must be home or local")
+	}
+}
+
+// roundClock puts a time of round in the time zone the report asked for
+func roundClock(t time.Time, round Round, clock string) time.Time {
+	if clock == clockLocal {
+		return t.In(loadZone(round.TimeZone))
+	}
+	return t.In(time.Local)
+}
+
+// zoneOffsetSQL is the UTC offset of loc in seconds at a time between from and to, given in seconds since 1970 by the
+// SQL expression unix. Not every database knows time zones, so it is a CASE with a branch per offset change in
+// between, taken from Go's zone data; a span without changes is a plain number.
+func zoneOffsetSQL(unix string, loc *time.Location, from, to time.Time) string {
+	var sql strings.Builder
+	for t := from.In(loc); ; {
+		_, offset := t.Zone()
+		_, end := t.ZoneBounds()
+		if end.IsZero() || end.After(to) {
+			if sql.Len() == 0 {
+				return strconv.Itoa(offset)
+			}
+			fmt.Fprintf(&sql, " ELSE %d END", offset)
+			return sql.String()
+		}
+		if sql.Len() == 0 {
+			sql.WriteString("CASE")
+		}
+		fmt.Fprintf(&sql, " WHEN %s < %d THEN %d", unix, end.Unix(), offset)
+		t = end
+	}
+}
+
+// roundTimeZoneName is the time zone a round was recorded in, for showing next to it
+func roundTimeZoneName(round Round) string {
+	if round.TimeZone != "" {
+		return round.TimeZone
+	}
+	return homeTimeZoneName()
+}
+
+// homeTimeZoneName is the server's time zone. Go calls it "Local" when TZ doesn't name one, e.g. when it comes from
+// /etc/localtime, so then its current abbreviation such as "CET" stands in.
+func homeTimeZoneName() string {
+	if name := time.Local.String(); name != "Local" {
+		return name
+	}
+	name, _ := time.Now().Zone()
+	return name
+}
+
+// csvTimeZone names the time zone of a round's times in an export with the given clock
+func csvTimeZone(round Round, clock string) string {
+	if clock == clockLocal {
+		return roundTimeZoneName(round)
+	}
+	return homeTimeZoneName()
+}
+
+// roundLocalTimes is how the round page shows a round recorded away from home: its start and end on the wall clock
+// there. Nil for rounds recorded at home, whose times are shown as they are.
+func roundLocalTimes(round Round) fiber.Map {
+	if round.TimeZone == "" {
+		return nil
+	}
+	endStr := ""
+	if round.EndTime != nil {
+		endStr = roundClock(*round.EndTime, round, clockLocal).Format("2006-01-02 15:04:05")
+	}
+	return fiber.Map{
+		"TimeZone": round.TimeZone,
+		"StartStr": roundClock(round.StartTime, round, clockLocal).Format("2006-01-02 15:04:05"),
+		"EndStr":   endStr,
+	}
+}
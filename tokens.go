@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Token scopes, ordered from least to most privileged
+const (
+	scopeRead    = "read"    // status, stats and exports
+	scopeControl = "control" // read plus starting and stopping rounds
+	scopeAdmin   = "admin"   // everything, including resets and group management
+)
+
+var scopeLevels = map[string]int{
+	scopeRead:    1,
+	scopeControl: 2,
+	scopeAdmin:   3,
+}
+
+// APIToken is a named bearer token used by scripts and widgets
+type APIToken struct {
+	ID               uint   `gorm:"primaryKey"`
+	UserID           uint   `gorm:"uniqueIndex:idx_api_tokens_user_name;default:0"` // Requests made with the token act as this user
+	Name             string `gorm:"uniqueIndex:idx_api_tokens_user_name;size:191;not null"`
+	TokenHash        string `gorm:"uniqueIndex;size:191;not null"` // SHA-256 of the token, the token itself is never stored
+	Prefix           string // First characters of the token, shown to tell tokens apart
+	Scope            string `gorm:"not null"`
+	LastUsedAt       *time.Time
+	RequestCount     int64 `gorm:"default:0"` // Requests made since the token was created
+	RateLimitedCount int64 `gorm:"default:0"` // Of those, requests answered with 429
+	CreatedAt        time.Time
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateToken() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "wh_" + hex.EncodeToString(buf), nil
+}
+
+// tokenAuth resolves the bearer token of the request, if any, and stores it in the context
+func tokenAuth(c *fiber.Ctx) error {
+	header := c.Get(fiber.HeaderAuthorization)
+	if !strings.HasPrefix(header, "Bearer ") {
+		return c.Next()
+	}
+
+	var token APIToken
+	if err := db.Where("token_hash = ?", hashToken(strings.TrimSpace(header[len("Bearer "):]))).First(&token).Error; err != nil {
+		return c.Status(401).SendString("Invalid API token")
+	}
+
+	now := time.Now()
+	usage := map[string]interface{}{"last_used_at": now, "request_count": gorm.Expr("request_count + 1")}
+	if err := db.Model(&token).UpdateColumns(usage).Error; err != nil {
+		requestLog(c).Println("Warning: failed to update token usage:", err)
+	}
+	c.Locals("apiToken", &token)
+	return c.Next()
+}
+
+func requestToken(c *fiber.Ctx) *APIToken {
+	token, _ := c.Locals("apiToken").(*APIToken)
+	return token
+}
+
+func renderTokens(c *fiber.Ctx) error {
+	return renderTokensPage(c, "")
+}
+
+func renderTokensPage(c *fiber.Ctx, newToken string) error {
+	var tokens []APIToken
+	if err := db.Where("user_id = ?", currentUserID(c)).Order("name ASC").Find(&tokens).Error; err != nil {
+		requestLog(c).Println("Error fetching API tokens:", err)
+		return c.Status(500).SendString("Error loading API tokens")
+	}
+
+	var tokenViews []fiber.Map
+	for _, token := range tokens {
+		lastUsed := "Never"
+		if token.LastUsedAt != nil {
+			lastUsed = token.LastUsedAt.Format("2006-01-02 15:04:05")
+		}
+		var quotas []string
+		for _, bucket := range []string{"api", "write"} {
+			if quota, ok := currentTokenQuotas(token.ID)[bucket]; ok {
+				quotas = append(quotas, fmt.Sprintf("%s: %d of %d left, resets in %s", bucket, quota.Remaining, quota.Limit,
+					time.Until(quota.ResetAt).Round(time.Second)))
+			}
+		}
+		tokenViews = append(tokenViews, fiber.Map{
+			"ID":          token.ID,
+			"Name":        token.Name,
+			"Prefix":      token.Prefix,
+			"Scope":       token.Scope,
+			"CreatedAt":   token.CreatedAt.Format("2006-01-02 15:04:05"),
+			"LastUsed":    lastUsed,
+			"Requests":    token.RequestCount,
+			"RateLimited": token.RateLimitedCount,
+			"Quotas":      quotas,
+		})
+	}
+
+	return c.Render("tokens", fiber.Map{
+		"Tokens":   tokenViews,
+		"NewToken": newToken,
+	})
+}
+
+func createTokenHandler(c *fiber.Ctx) error {
+	name := strings.TrimSpace(c.FormValue("name"))
+	if name == "" {
+		return c.Status(400).SendString("Token name cannot be empty")
+	}
+
+	scope := c.FormValue("scope")
+	if _, ok := scopeLevels[scope]; !ok {
+		return c.Status(400).SendString("Invalid token scope")
+	}
+	if scopeLevels[scope] > requestLevel(c) {
+		return c.Status(403).SendString("A token cannot have more privileges than your role")
+	}
+
+	plain, err := generateToken()
+	if err != nil {
+		requestLog(c).Println("Error generating API token:", err)
+		return c.Status(500).SendString("Error creating API token")
+	}
+
+	token := APIToken{
+		UserID:    currentUserID(c),
+		Name:      name,
+		TokenHash: hashToken(plain),
+		Prefix:    plain[:10],
+		Scope:     scope,
+	}
+	if err := db.Create(&token).Error; err != nil {
+		requestLog(c).Println("Error creating API token:", err)
+		return c.Status(500).SendString("Error creating API token")
+	}
+	recordAudit("token.create", clientInfoFromRequest(c), 0, nil, fmt.Sprintf("Created %s token '%s'", scope, name))
+
+	return renderTokensPage(c, plain)
+}
+
+func deleteTokenHandler(c *fiber.Ctx) error {
+	id, err := parseGroupID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid API token")
+	}
+
+	var token APIToken
+	if err := db.Where("user_id = ?", currentUserID(c)).First(&token, id).Error; err != nil {
+		return c.Status(404).SendString("API token not found")
+	}
+
+	if err := db.Delete(&token).Error; err != nil {
+		requestLog(c).Println("Error deleting API token:", err)
+		return c.Status(500).SendString("Error deleting API token")
+	}
+	recordAudit("token.delete", clientInfoFromRequest(c), 0, nil, fmt.Sprintf("Revoked token '%s'", token.Name))
+
+	return c.Redirect("/tokens", fiber.StatusSeeOther)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// tracer creates the app's spans. Until configureTracing installs a provider it hands out no-op spans, so
+// instrumented code costs next to nothing when tracing is off.
+var tracer = otel.Tracer("hoursweb")
+
+// traceContextKey is the Locals key of the request span's context. Templates get the locals too, which is how
+// tracedViews finds the request a rendering belongs to.
+const traceContextKey = "traceContext"
+
+// tracingEnabled reports whether spans are exported
+func tracingEnabled() bool {
+	return cfg.Tracing.Endpoint != ""
+}
+
+// configureTracing exports spans in batches to the OTLP/HTTP collector at cfg.Tracing.Endpoint, and adds spans to
+// database queries made while handling a request
+func configureTracing() {
+	if !tracingEnabled() {
+		return
+	}
+	// Like OTEL_EXPORTER_OTLP_ENDPOINT, the endpoint is the collector's base URL
+	exporter, err := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(strings.TrimRight(cfg.Tracing.Endpoint, "/")+"/v1/traces"))
+	if err != nil {
+		log.Println("Warning: tracing disabled:", err)
+		return
+	}
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(cfg.Tracing.ServiceName))),
+	))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	if err := db.Use(gormTracing{}); err != nil {
+		log.Println("Warning: failed to trace database queries:", err)
+	}
+	log.Printf("Sending traces to %s", cfg.Tracing.Endpoint)
+}
+
+// traceContext is the context of the request's span, for passing on to instrumented helpers and queries
+func traceContext(c *fiber.Ctx) context.Context {
+	if ctx, ok := c.Locals(traceContextKey).(context.Context); ok {
+		return ctx
+	}
+	return context.Background()
+}
+
+// headerCarrier reads and writes trace headers such as traceparent on a Fiber request
+type headerCarrier struct {
+	c *fiber.Ctx
+}
+
+func (h headerCarrier) Get(key string) string { return h.c.Get(key) }
+func (h headerCarrier) Set(key, value string) { h.c.Request().Header.Set(key, value) }
+func (h headerCarrier) Keys() []string {
+	var keys []string
+	h.c.Request().Header.VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}
+
+// traceRequests wraps each request in a server span named after its route, continuing the caller's trace when a
+// traceparent header is sent
+func traceRequests(c *fiber.Ctx) error {
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), headerCarrier{c})
+	ctx, span := tracer.Start(ctx, c.Method()+" "+c.Path(),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(c.Method()),
+			semconv.URLPath(c.Path()),
+			semconv.UserAgentOriginal(c.Get(fiber.HeaderUserAgent)),
+		))
+	defer span.End()
+	c.Locals(traceContextKey, ctx)
+
+	err := c.Next()
+
+	status := c.Response().StatusCode()
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		status = fiberErr.Code
+	} else if err != nil {
+		status = fiber.StatusInternalServerError
+	}
+	// The route is only known once the request has been routed
+	route := c.Route().Path
+	span.SetName(c.Method() + " " + route)
+	span.SetAttributes(
+		semconv.HTTPRoute(route),
+		semconv.HTTPResponseStatusCode(status),
+		attribute.String("request.id", requestID(c)),
+	)
+	if status >= 500 {
+		span.SetStatus(codes.Error, fmt.Sprintf("HTTP %d", status))
+	}
+	return err
+}
+
+// tracedViews adds a span for every template rendered during a traced request
+type tracedViews struct {
+	fiber.Views
+}
+
+func (v tracedViews) Render(w io.Writer, name string, bind interface{}, layout ...string) error {
+	ctx := context.Background()
+	if values, ok := bind.(fiber.Map); ok {
+		if parent, ok := values[traceContextKey].(context.Context); ok {
+			ctx = parent
+		}
+	}
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return v.Views.Render(w, name, bind, layout...)
+	}
+
+	_, span := tracer.Start(ctx, "render "+name)
+	defer span.End()
+	err := v.Views.Render(w, name, bind, layout...)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// gormTracing is a GORM plugin that adds a client span for every query run with the context of a traced request
+// (db.WithContext(traceContext(c))). Queries of background jobs and untraced requests are left alone.
+type gormTracing struct{}
+
+const gormSpanKey = "tracing:span"
+
+func (gormTracing) Name() string {
+	return "tracing"
+}
+
+func (gormTracing) Initialize(db *gorm.DB) error {
+	system := db.Dialector.Name()
+	if system == "postgres" {
+		system = "postgresql"
+	}
+
+	before := func(operation string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			ctx := tx.Statement.Context
+			if ctx == nil || !trace.SpanContextFromContext(ctx).IsValid() {
+				return
+			}
+			_, span := tracer.Start(ctx, "gorm."+operation,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(semconv.DBSystemKey.String(system), semconv.DBOperationName(operation)))
+			tx.InstanceSet(gormSpanKey, span)
+		}
+	}
+	after := func(tx *gorm.DB) {
+		value, ok := tx.InstanceGet(gormSpanKey)
+		if !ok {
+			return
+		}
+		span := value.(trace.Span)
+		defer span.End()
+		span.SetAttributes(
+			semconv.DBCollectionName(tx.Statement.Table),
+			semconv.DBQueryText(tx.Statement.SQL.String()),
+			attribute.Int64("db.rows_affected", tx.Statement.RowsAffected),
+		)
+		if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			span.RecordError(tx.Error)
+			span.SetStatus(codes.Error, tx.Error.Error())
+		}
+	}
+
+	callbacks := db.Callback()
+	for _, err := range []error{
+		callbacks.Create().Before("gorm:create").Register("tracing:before_create", before("create")),
+		callbacks.Create().After("gorm:create").Register("tracing:after_create", after),
+		callbacks.Query().Before("gorm:query").Register("tracing:before_query", before("select")),
+		callbacks.Query().After("gorm:query").Register("tracing:after_query", after),
+		callbacks.Update().Before("gorm:update").Register("tracing:before_update", before("update")),
+		callbacks.Update().After("gorm:update").Register("tracing:after_update", after),
+		callbacks.Delete().Before("gorm:delete").Register("tracing:before_delete", before("delete")),
+		callbacks.Delete().After("gorm:delete").Register("tracing:after_delete", after),
+		callbacks.Row().Before("gorm:row").Register("tracing:before_row", before("row")),
+		callbacks.Row().After("gorm:row").Register("tracing:after_row", after),
+		callbacks.Raw().Before("gorm:raw").Register("tracing:before_raw", before("raw")),
+		callbacks.Raw().After("gorm:raw").Register("tracing:after_raw", after),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
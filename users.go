@@ -0,0 +1,526 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// User owns working groups (and through them rounds) and API tokens
+type User struct {
+	ID           uint   `gorm:"primaryKey" json:"id"`
+	Username     string `gorm:"uniqueIndex;size:191;not null" json:"username"`
+	PasswordHash string `json:"-"`
+	Role         string `gorm:"not null;default:member" json:"role"`
+	Email        string `gorm:"index" json:"email,omitempty"`       // Where email-in confirmations are sent
+	EmailInHash  string `gorm:"index;size:64" json:"-"`             // SHA-256 of the key in the user's secret email-in address
+	Phone        string `gorm:"index" json:"phone,omitempty"`       // E.164 number for SMS entry, e.g. +15550100200
+	OIDCSubject  string `gorm:"column:oidc_subject;index" json:"-"` // Set for accounts provisioned through single sign-on
+	// Country or region whose public holidays are days off, e.g. DE-BY; see holidayCountries
+	HolidayRegion string    `gorm:"size:10" json:"holiday_region,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func (u *User) setPassword(password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.PasswordHash = string(hash)
+	return nil
+}
+
+func (u *User) checkPassword(password string) bool {
+	return u.PasswordHash != "" && bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
+
+// userGroups limits a query on working groups to those owned by the user
+func userGroups(userID uint) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("working_groups.user_id = ?", userID)
+	}
+}
+
+// userRounds limits a query on rounds (or any table with working_group_id) to the user's groups
+func userRounds(userID uint) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("working_group_id IN (?)", db.Model(&WorkingGroup{}).Select("id").Where("user_id = ?", userID))
+	}
+}
+
+func currentUser(c *fiber.Ctx) *User {
+	user, _ := c.Locals("user").(*User)
+	return user
+}
+
+// currentUserID returns the ID of the signed-in user; routes behind requireLogin always have one
+func currentUserID(c *fiber.Ctx) uint {
+	if user := currentUser(c); user != nil {
+		return user.ID
+	}
+	return 0
+}
+
+// publicPath reports whether a path is reachable without signing in
+func publicPath(path string) bool {
+	if cfg.Auth.Mode == authModeBasic && (path == "/login" || path == "/setup") {
+		return false
+	}
+	return path == "/login" || path == "/setup" ||
+		path == "/api/openapi.json" || path == "/api/docs" ||
+		strings.HasPrefix(path, "/static/") ||
+		strings.HasPrefix(path, "/auth/") ||
+		strings.HasPrefix(path, "/inbound/") ||
+		strings.HasPrefix(path, "/a/")
+}
+
+// requireLogin resolves the user from the API token or session cookie and rejects anonymous requests
+func requireLogin(c *fiber.Ctx) error {
+	if token := requestToken(c); token != nil {
+		var user User
+		if err := db.First(&user, token.UserID).Error; err != nil {
+			return c.Status(401).SendString("API token is not linked to an account, complete /setup first")
+		}
+		c.Locals("user", &user)
+		return c.Next()
+	}
+
+	if user, ok := basicAuthUser(c); ok {
+		if wait := loginLockedFor(loginAddressKey(c.IP())); wait > 0 {
+			setRetryAfter(c, wait)
+			return c.Status(fiber.StatusTooManyRequests).SendString("Too many failed sign-ins. Try again in " + loginWait(wait) + ".")
+		}
+		if user == nil {
+			basicAuthFailed(c)
+			c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="Hours Tracker"`)
+			return c.Status(401).SendString("Invalid credentials")
+		}
+		clearLoginFailures(loginAddressKey(c.IP()))
+		c.Locals("user", user)
+		return c.Next()
+	}
+
+	if user, session := userFromSession(c); user != nil {
+		c.Locals("user", user)
+		c.Locals("session", session)
+		return c.Next()
+	}
+
+	if publicPath(c.Path()) {
+		return c.Next()
+	}
+
+	if strings.HasPrefix(c.Path(), "/api/") || strings.HasPrefix(c.Path(), "/grafana") {
+		return c.Status(401).JSON(apiError{"authentication required"})
+	}
+	if cfg.Auth.Mode == authModeBasic {
+		c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="Hours Tracker"`)
+		return c.Status(401).SendString("Authentication required")
+	}
+	var userCount int64
+	if err := db.Model(&User{}).Count(&userCount).Error; err == nil && userCount == 0 && cfg.Auth.Mode == authModePassword {
+		return redirectTo(c, "/setup")
+	}
+	return redirectTo(c, "/login")
+}
+
+// redirectTo redirects regular requests and asks HTMX to navigate for partial requests
+func redirectTo(c *fiber.Ctx, location string) error {
+	if c.Get("HX-Request") != "" {
+		c.Set("HX-Redirect", location)
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+	return c.Redirect(location, fiber.StatusSeeOther)
+}
+
+func renderLogin(c *fiber.Ctx) error {
+	return c.Render("login", loginView(fiber.Map{}))
+}
+
+// loginView adds the single sign-on button details to the login and setup pages
+func loginView(data fiber.Map) fiber.Map {
+	data["PasswordLogin"] = cfg.Auth.Mode != authModeOIDC
+	if oidcEnabled() {
+		data["OIDC"] = true
+		data["OIDCLabel"] = oidcButtonLabel()
+	}
+	return data
+}
+
+func loginHandler(c *fiber.Ctx) error {
+	if cfg.Auth.Mode == authModeOIDC {
+		return c.Status(403).SendString("Password sign-in is disabled, use single sign-on")
+	}
+	username := strings.TrimSpace(c.FormValue("username"))
+	password := c.FormValue("password")
+	if wait := loginLockedFor(loginAccountKey(username), loginAddressKey(c.IP())); wait > 0 {
+		return renderLoginLocked(c, username, wait)
+	}
+
+	var user User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil || !user.checkPassword(password) {
+		var known *User
+		if err == nil {
+			known = &user
+		}
+		if wait := loginFailed(c, username, known); wait > 0 {
+			return renderLoginLocked(c, username, wait)
+		}
+		return c.Status(401).Render("login", loginView(fiber.Map{
+			"Error":    "Invalid username or password",
+			"Username": username,
+		}))
+	}
+	clearLoginFailures(loginAccountKey(username), loginAddressKey(c.IP()))
+
+	if err := startSession(c, user, c.FormValue("remember") != ""); err != nil {
+		requestLog(c).Println("Error creating session:", err)
+		return c.Status(500).SendString("Error signing in")
+	}
+	return c.Redirect("/", fiber.StatusSeeOther)
+}
+
+func renderSetup(c *fiber.Ctx) error {
+	var userCount int64
+	db.Model(&User{}).Count(&userCount)
+	if userCount > 0 || cfg.Auth.Mode == authModeOIDC {
+		return c.Redirect("/login", fiber.StatusSeeOther)
+	}
+	return c.Render("login", loginView(fiber.Map{"Setup": true, "Templates": groupTemplateViews(""), "DefaultGroup": cfg.DefaultGroup}))
+}
+
+// setupHandler creates the first account, which takes over all data recorded before accounts existed
+func setupHandler(c *fiber.Ctx) error {
+	if cfg.Auth.Mode == authModeOIDC {
+		return c.Status(403).SendString("Password sign-in is disabled, use single sign-on")
+	}
+	username := strings.TrimSpace(c.FormValue("username"))
+	password := c.FormValue("password")
+	template, err := chosenGroupTemplate(c)
+	if username == "" || len(password) < 8 || err != nil {
+		message := "Choose a username and a password of at least 8 characters"
+		if err != nil {
+			message = "Choose one of the group templates"
+		}
+		return c.Status(400).Render("login", loginView(fiber.Map{
+			"Setup":        true,
+			"Error":        message,
+			"Username":     username,
+			"Templates":    groupTemplateViews(c.FormValue("template")),
+			"DefaultGroup": cfg.DefaultGroup,
+		}))
+	}
+
+	var user User
+	var groups []WorkingGroup
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var userCount int64
+		if err := tx.Model(&User{}).Count(&userCount).Error; err != nil {
+			return err
+		}
+		if userCount > 0 {
+			return fmt.Errorf("setup has already been completed")
+		}
+
+		user = User{Username: username, Role: roleAdmin}
+		if err := user.setPassword(password); err != nil {
+			return err
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if err := claimUnownedData(tx, user.ID); err != nil {
+			return err
+		}
+		if template == nil {
+			return nil
+		}
+		var err error
+		groups, err = applyGroupTemplate(tx, user.ID, *template)
+		return err
+	})
+	if err != nil {
+		requestLog(c).Println("Error completing setup:", err)
+		return c.Status(400).SendString("Error completing setup: " + err.Error())
+	}
+
+	requestLog(c).Printf("Created first user '%s'", user.Username)
+	if template != nil {
+		requestLog(c).Printf("Set up %d working groups from the %s template", len(groups), template.Label)
+		if err := applyFirstRunSchedule(*template); err != nil {
+			requestLog(c).Println("Error saving do-not-disturb windows of the template:", err)
+		}
+	}
+	if err := startSession(c, user, c.FormValue("remember") != ""); err != nil {
+		requestLog(c).Println("Error creating session:", err)
+	}
+	return c.Redirect("/", fiber.StatusSeeOther)
+}
+
+// dropGlobalUniqueIndexes removes single-column unique indexes that became per-user composites
+func dropGlobalUniqueIndexes() {
+	if db.Migrator().HasIndex(&GroupMappingRule{}, "idx_group_mapping_rules_domain") {
+		if err := db.Migrator().DropIndex(&GroupMappingRule{}, "idx_group_mapping_rules_domain"); err != nil {
+			log.Println("Warning: failed to drop old mapping rule index:", err)
+		}
+	}
+}
+
+func isLastAdmin(tx *gorm.DB, user User) bool {
+	if user.Role != roleAdmin {
+		return false
+	}
+	var adminCount int64
+	tx.Model(&User{}).Where("role = ?", roleAdmin).Count(&adminCount)
+	return adminCount <= 1
+}
+
+// ensureAdminExists promotes the oldest account when no admin is left, e.g. after upgrading from a version without roles
+func ensureAdminExists() {
+	var adminCount int64
+	if err := db.Model(&User{}).Where("role = ?", roleAdmin).Count(&adminCount).Error; err != nil || adminCount > 0 {
+		return
+	}
+	if ownerID := defaultOwnerID(); ownerID != 0 {
+		if err := db.Model(&User{}).Where("id = ?", ownerID).Update("role", roleAdmin).Error; err != nil {
+			log.Println("Warning: failed to promote first user to admin:", err)
+		}
+	}
+}
+
+// claimUnownedData assigns rows created before user accounts existed to the given user
+func claimUnownedData(tx *gorm.DB, userID uint) error {
+	for _, model := range []interface{}{&WorkingGroup{}, &APIToken{}, &AuditEntry{}, &CalendarFeed{}, &GroupMappingRule{}} {
+		if err := tx.Model(model).Where("user_id = 0 OR user_id IS NULL").Update("user_id", userID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func renderUsers(c *fiber.Ctx) error {
+	return renderUsersPage(c, "")
+}
+
+// renderUsersPage renders the users page; a new email-in address is shown once, right after it was made
+func renderUsersPage(c *fiber.Ctx, newEmailIn string) error {
+	var users []User
+	if err := db.Order("username ASC").Find(&users).Error; err != nil {
+		requestLog(c).Println("Error fetching users:", err)
+		return c.Status(500).SendString("Error loading users")
+	}
+
+	currentID := currentUserID(c)
+	var userViews []fiber.Map
+	for _, user := range users {
+		lockedFor := ""
+		if wait := loginLockedFor(loginAccountKey(user.Username)); wait > 0 {
+			lockedFor = loginWait(wait)
+		}
+		userViews = append(userViews, fiber.Map{
+			"ID":          user.ID,
+			"Username":    user.Username,
+			"Role":        user.Role,
+			"RoleOptions": roleOptions(user.Role),
+			"IsCurrent":   user.ID == currentID,
+			"LockedFor":   lockedFor,
+			"CreatedAt":   user.CreatedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+
+	return c.Render("users", fiber.Map{
+		"Users":          userViews,
+		"NewRoleOptions": roleOptions(roleMember),
+		"Templates":      groupTemplateViews(""),
+		"DefaultGroup":   cfg.DefaultGroup,
+		"Can":            permissionsView(c),
+		"Passkeys":       passkeyViews(currentID),
+		"HasPassword":    currentUser(c).PasswordHash != "",
+		"Sessions":       sessionViews(c),
+		"Email":          currentUser(c).Email,
+		"EmailIn":        emailInEnabled(),
+		"HasEmailIn":     currentUser(c).EmailInHash != "",
+		"NewEmailIn":     newEmailIn,
+		"Phone":          currentUser(c).Phone,
+		"SMSIn":          cfg.Inbound.TwilioAuthToken != "",
+	})
+}
+
+func roleOptions(selected string) []fiber.Map {
+	var options []fiber.Map
+	for _, role := range roles {
+		options = append(options, fiber.Map{"Value": role, "Selected": role == selected})
+	}
+	return options
+}
+
+func createUserHandler(c *fiber.Ctx) error {
+	username := strings.TrimSpace(c.FormValue("username"))
+	password := c.FormValue("password")
+	if username == "" || len(password) < 8 {
+		return c.Status(400).SendString("Username and a password of at least 8 characters are required")
+	}
+
+	role := c.FormValue("role", roleMember)
+	if !validRole(role) {
+		return c.Status(400).SendString("Invalid role")
+	}
+	template, err := chosenGroupTemplate(c)
+	if err != nil {
+		return c.Status(400).SendString("Invalid group template")
+	}
+
+	user := User{Username: username, Role: role}
+	if err := user.setPassword(password); err != nil {
+		requestLog(c).Println("Error hashing password:", err)
+		return c.Status(500).SendString("Error creating user")
+	}
+	if err := db.Create(&user).Error; err != nil {
+		requestLog(c).Println("Error creating user:", err)
+		return c.Status(400).SendString("Error creating user (is the username taken?)")
+	}
+	details := fmt.Sprintf("Created %s '%s'", role, username)
+	if template != nil {
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			_, err := applyGroupTemplate(tx, user.ID, *template)
+			return err
+		}); err != nil {
+			requestLog(c).Println("Error creating the groups of the template:", err)
+		}
+		details += fmt.Sprintf(" with the %s groups", template.Label)
+	}
+	ensureDefaultWorkingGroup(user.ID)
+	recordAudit("user.create", clientInfoFromRequest(c), 0, nil, details)
+
+	return c.Redirect("/users", fiber.StatusSeeOther)
+}
+
+func updateUserRoleHandler(c *fiber.Ctx) error {
+	id, err := parseGroupID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).SendString("Invalid user")
+	}
+	role := c.FormValue("role")
+	if !validRole(role) {
+		return c.Status(400).SendString("Invalid role")
+	}
+
+	var user User
+	if err := db.First(&user, id).Error; err != nil {
+		return c.Status(404).SendString("User not found")
+	}
+	if role != roleAdmin && isLastAdmin(db, user) {
+		return c.Status(400).SendString("Cannot demote the last admin")
+	}
+
+	if err := db.Model(&user).Update("role", role).Error; err != nil {
+		requestLog(c).Println("Error updating user role:", err)
+		return c.Status(500).SendString("Error updating user")
+	}
+	recordAudit("user.role", clientInfoFromRequest(c), 0, nil, fmt.Sprintf("Changed role of '%s' to %s", user.Username, role))
+
+	return c.Redirect("/users", fiber.StatusSeeOther)
+}
+
+func changePasswordHandler(c *fiber.Ctx) error {
+	user := currentUser(c)
+	if isSharedAuthUser(user) {
+		return c.Status(400).SendString("The password of this account is set by AUTH_PASS")
+	}
+	// Passwordless accounts (passkeys only) may set a new password without one
+	if user.PasswordHash != "" && !user.checkPassword(c.FormValue("current_password")) {
+		return c.Status(400).SendString("Current password is incorrect")
+	}
+	password := c.FormValue("new_password")
+	if len(password) < 8 {
+		return c.Status(400).SendString("The new password must have at least 8 characters")
+	}
+
+	if err := user.setPassword(password); err != nil {
+		requestLog(c).Println("Error hashing password:", err)
+		return c.Status(500).SendString("Error changing password")
+	}
+	if err := db.Model(user).Update("password_hash", user.PasswordHash).Error; err != nil {
+		requestLog(c).Println("Error changing password:", err)
+		return c.Status(500).SendString("Error changing password")
+	}
+	var keepID uint
+	if session := currentSession(c); session != nil {
+		keepID = session.ID
+	}
+	if err := revokeOtherSessions(user.ID, keepID); err != nil {
+		requestLog(c).Println("Error revoking sessions:", err)
+	}
+	recordAudit("user.password", clientInfoFromRequest(c), 0, nil, "Changed password, signed out other sessions")
+
+	return c.Redirect("/users", fiber.StatusSeeOther)
+}
+
+// updateEmailHandler sets the address the user sends email-in messages from
+func updateEmailHandler(c *fiber.Ctx) error {
+	user := currentUser(c)
+	email := strings.TrimSpace(c.FormValue("email"))
+	if email != "" {
+		address, err := mail.ParseAddress(email)
+		if err != nil {
+			return c.Status(400).SendString("Invalid email address")
+		}
+		email = address.Address
+		var taken int64
+		db.Model(&User{}).Where("LOWER(email) = ? AND id <> ?", strings.ToLower(email), user.ID).Count(&taken)
+		if taken > 0 {
+			return c.Status(409).SendString("This email address belongs to another account")
+		}
+	}
+
+	if err := db.Model(user).Update("email", email).Error; err != nil {
+		requestLog(c).Println("Error updating email:", err)
+		return c.Status(500).SendString("Error updating email")
+	}
+	return c.Redirect("/users", fiber.StatusSeeOther)
+}
+
+// updatePhoneHandler sets the number the user texts SMS commands from
+func updatePhoneHandler(c *fiber.Ctx) error {
+	user := currentUser(c)
+	phone := normalizePhone(c.FormValue("phone"))
+	if phone != "" {
+		if !strings.HasPrefix(phone, "+") || len(phone) < 8 {
+			return c.Status(400).SendString("Enter the number in international format, e.g. +15550100200")
+		}
+		var taken int64
+		db.Model(&User{}).Where("phone = ? AND id <> ?", phone, user.ID).Count(&taken)
+		if taken > 0 {
+			return c.Status(409).SendString("This number belongs to another account")
+		}
+	}
+
+	if err := db.Model(user).Update("phone", phone).Error; err != nil {
+		requestLog(c).Println("Error updating phone:", err)
+		return c.Status(500).SendString("Error updating phone number")
+	}
+	return c.Redirect("/users", fiber.StatusSeeOther)
+}
+
+// findUserGroup loads a working group owned by the user
+func findUserGroup(userID, groupID uint) (WorkingGroup, error) {
+	var group WorkingGroup
+	err := db.Scopes(userGroups(userID)).First(&group, groupID).Error
+	return group, err
+}
+
+// defaultOwnerID returns the first account, which owns data created outside a request (0 before setup)
+func defaultOwnerID() uint {
+	var user User
+	if err := db.Order("id ASC").First(&user).Error; err != nil {
+		return 0
+	}
+	return user.ID
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// voiceRequest covers the webhook bodies of Alexa custom skills, Dialogflow (Google Assistant) fulfillment and a
+// plain {"intent": "...", "group": "..."} form for other assistants and shortcuts
+type voiceRequest struct {
+	// Alexa
+	Version string `json:"version"`
+	Context struct {
+		System struct {
+			User struct {
+				AccessToken string `json:"accessToken"`
+			} `json:"user"`
+		} `json:"System"`
+	} `json:"context"`
+	Request struct {
+		Type   string `json:"type"`
+		Intent struct {
+			Name  string `json:"name"`
+			Slots map[string]struct {
+				Value string `json:"value"`
+			} `json:"slots"`
+		} `json:"intent"`
+	} `json:"request"`
+
+	// Dialogflow
+	QueryResult struct {
+		Intent struct {
+			DisplayName string `json:"displayName"`
+		} `json:"intent"`
+		Parameters map[string]interface{} `json:"parameters"`
+	} `json:"queryResult"`
+	OriginalDetectIntentRequest struct {
+		Payload struct {
+			User struct {
+				AccessToken string `json:"accessToken"`
+			} `json:"user"`
+		} `json:"payload"`
+	} `json:"originalDetectIntentRequest"`
+
+	// Plain
+	Intent string `json:"intent"`
+	Group  string `json:"group"`
+}
+
+func (r voiceRequest) source() string {
+	switch {
+	case r.Version != "" && r.Request.Type != "":
+		return "alexa"
+	case r.QueryResult.Intent.DisplayName != "":
+		return "dialogflow"
+	default:
+		return "plain"
+	}
+}
+
+func (r voiceRequest) intentAndGroup() (string, string) {
+	switch r.source() {
+	case "alexa":
+		if r.Request.Type != "IntentRequest" {
+			return r.Request.Type, ""
+		}
+		return r.Request.Intent.Name, r.Request.Intent.Slots["group"].Value
+	case "dialogflow":
+		group, _ := r.QueryResult.Parameters["group"].(string)
+		return r.QueryResult.Intent.DisplayName, group
+	default:
+		return r.Intent, r.Group
+	}
+}
+
+func (r voiceRequest) accessToken() string {
+	if token := r.Context.System.User.AccessToken; token != "" {
+		return token
+	}
+	return r.OriginalDetectIntentRequest.Payload.User.AccessToken
+}
+
+// voiceAction maps an intent name to "start", "stop", "status", "help" or "end".
+// "StartTrackingIntent", "start_tracking" and "Start" all mean the same.
+func voiceAction(intent string) string {
+	switch intent {
+	case "AMAZON.StopIntent", "AMAZON.CancelIntent", "AMAZON.NavigateHomeIntent", "SessionEndedRequest":
+		return "end"
+	case "AMAZON.HelpIntent", "AMAZON.FallbackIntent", "LaunchRequest":
+		return "help"
+	}
+	name := looseName(intent)
+	switch {
+	case strings.HasPrefix(name, "start"):
+		return "start"
+	case strings.HasPrefix(name, "stop"):
+		return "stop"
+	case strings.HasPrefix(name, "status"), strings.HasPrefix(name, "today"), strings.HasPrefix(name, "howlong"):
+		return "status"
+	}
+	return "help"
+}
+
+// speakDuration renders seconds the way they are read out, e.g. "2 hours and 5 minutes"
+func speakDuration(seconds int64) string {
+	hours := seconds / 3600
+	minutes := (seconds % 3600) / 60
+	plural := func(n int64, unit string) string {
+		if n == 1 {
+			return "1 " + unit
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+	switch {
+	case hours == 0:
+		return plural(minutes, "minute")
+	case minutes == 0:
+		return plural(hours, "hour")
+	default:
+		return plural(hours, "hour") + " and " + plural(minutes, "minute")
+	}
+}
+
+// voiceHandler answers assistant webhooks. The account is identified by an API token, sent as a bearer token or,
+// for Alexa and Google account linking, as the access token inside the request body.
+func voiceHandler(c *fiber.Ctx) error {
+	var request voiceRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(400).JSON(apiError{"invalid request body"})
+	}
+
+	if requestToken(c) == nil && request.accessToken() != "" {
+		var token APIToken
+		var user User
+		if db.Where("token_hash = ?", hashToken(request.accessToken())).First(&token).Error == nil &&
+			db.First(&user, token.UserID).Error == nil {
+			c.Locals("apiToken", &token)
+			c.Locals("user", &user)
+		}
+	}
+	user := currentUser(c)
+	if user == nil {
+		if request.source() == "plain" {
+			return c.Status(401).JSON(apiError{"authentication required"})
+		}
+		return sendVoiceResponse(c, request.source(), "Please link your Hours Tracker account in the assistant app first.", true)
+	}
+
+	intent, groupName := request.intentAndGroup()
+	action := voiceAction(intent)
+	if action == "end" {
+		return sendVoiceResponse(c, request.source(), "Goodbye.", false)
+	}
+
+	client := clientInfoFromRequest(c)
+	client.Name = "voice:" + request.source()
+	client.Source = sourceVoice
+	speech := runVoiceIntent(c, *user, action, strings.TrimSpace(groupName), client)
+	return sendVoiceResponse(c, request.source(), speech, false)
+}
+
+func runVoiceIntent(c *fiber.Ctx, user User, action, groupName string, client ClientInfo) string {
+	if (action == "start" || action == "stop") && requestLevel(c) < scopeLevels[scopeControl] {
+		return "Your account can only check your hours, not start or stop tracking."
+	}
+
+	switch action {
+	case "start":
+		group, err := smsGroup(user.ID, groupName)
+		if err != nil {
+			return voiceGroupError(user.ID, groupName)
+		}
+		if _, err := startRound(group.ID, client); err != nil {
+			if errors.Is(err, errRoundRunning) {
+				return "You are already tracking " + group.Name + "."
+			}
+			requestLog(c).Println("Error starting round from voice assistant:", err)
+			return "Sorry, I could not start tracking " + group.Name + "."
+		}
+		return "Started tracking " + group.Name + "."
+	case "stop":
+		group, err := smsRunningGroup(user.ID, groupName)
+		if err != nil {
+			if groupName != "" {
+				return voiceGroupError(user.ID, groupName)
+			}
+			return "You are not tracking anything right now."
+		}
+		round, err := stopRound(group.ID, client)
+		if err != nil {
+			if errors.Is(err, errNoRoundRunning) {
+				return "You are not tracking " + group.Name + " right now."
+			}
+			requestLog(c).Println("Error stopping round from voice assistant:", err)
+			return "Sorry, I could not stop tracking " + group.Name + "."
+		}
+		if round.Discarded {
+			return fmt.Sprintf("Discarded %s after %s, that was too short to count. You have worked %s today.", group.Name,
+				speakDuration(roundWorkedSeconds(round, *round.EndTime)), speakDuration(todaySeconds(user.ID)))
+		}
+		return fmt.Sprintf("Stopped %s after %s. You have worked %s today.", group.Name,
+			speakDuration(roundWorkedSeconds(round, *round.EndTime)), speakDuration(todaySeconds(user.ID)))
+	case "status":
+		speech := fmt.Sprintf("You have worked %s today.", speakDuration(todaySeconds(user.ID)))
+		if group, err := smsRunningGroup(user.ID, ""); err == nil {
+			var round Round
+			if db.Select("paused_at").Where("working_group_id = ? AND end_time IS NULL", group.ID).
+				Take(&round).Error == nil && round.PausedAt != nil {
+				speech += " " + group.Name + " has been paused since " + round.PausedAt.Format("15:04") + "."
+			} else {
+				speech += " You are tracking " + group.Name + "."
+			}
+		}
+		return speech
+	}
+	return "You can say start tracking followed by a group, stop tracking, or ask how long you have worked today."
+}
+
+func voiceGroupError(userID uint, name string) string {
+	groups, _ := getWorkingGroupsOrdered(userID)
+	names := make([]string, 0, len(groups))
+	for _, group := range groups {
+		names = append(names, group.Name)
+	}
+	return fmt.Sprintf("I could not find a group called %s. Your groups are %s.", name, strings.Join(names, ", "))
+}
+
+// sendVoiceResponse wraps the speech in the response format of the assistant that sent the request
+func sendVoiceResponse(c *fiber.Ctx, source, speech string, linkAccount bool) error {
+	switch source {
+	case "alexa":
+		response := fiber.Map{
+			"outputSpeech":     fiber.Map{"type": "PlainText", "text": speech},
+			"shouldEndSession": true,
+		}
+		if linkAccount {
+			response["card"] = fiber.Map{"type": "LinkAccount"}
+		}
+		return c.JSON(fiber.Map{"version": "1.0", "response": response})
+	case "dialogflow":
+		return c.JSON(fiber.Map{"fulfillmentText": speech})
+	default:
+		return c.JSON(fiber.Map{"speech": speech})
+	}
+}
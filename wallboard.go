@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// wallboardState is what a wall display needs of a group and no more. Like the watch, it counts the running round up
+// from Since itself, leaving its pauses out, so it only has to ask again when a round starts, stops or pauses.
+type wallboardState struct {
+	GroupID      uint   `json:"group_id"`
+	GroupName    string `json:"group_name"`
+	GroupColor   string `json:"group_color"`
+	GroupIcon    string `json:"group_icon,omitempty"`
+	Running      bool   `json:"running"`
+	Since        int64  `json:"since,omitempty"`         // Unix start of the running round
+	Paused       int64  `json:"paused,omitempty"`        // Seconds of the running round's finished pauses
+	PausedAt     int64  `json:"paused_at,omitempty"`     // Unix start of the running round's pause, 0 unless it is paused
+	RunningToday bool   `json:"running_today,omitempty"` // The running round started today, so it adds to Today
+	RunningWeek  bool   `json:"running_week,omitempty"`  // The running round started this week, so it adds to Week
+	Today        int64  `json:"today"`                   // Seconds of today's finished rounds
+	Week         int64  `json:"week"`                    // Seconds of this week's finished rounds
+	TodayTarget  int64  `json:"today_target,omitempty"`  // Seconds, 0 without a daily target
+	WeekTarget   int64  `json:"week_target,omitempty"`
+	Version      uint32 `json:"version"` // Changes with the round, the totals, the targets and the day; pass it back as ?v=
+}
+
+// buildWallboardState reads the group's running round and the rounds it finished this week
+func buildWallboardState(ctx context.Context, group WorkingGroup) wallboardState {
+	state := wallboardState{
+		GroupID:    group.ID,
+		GroupName:  group.Name,
+		GroupColor: groupColor(group),
+		GroupIcon:  group.Icon,
+	}
+
+	now := time.Now()
+	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	week := weekStart(now)
+
+	var active Round
+	if db.WithContext(ctx).Select("start_time", "paused_at", "paused_seconds").
+		Where("working_group_id = ? AND end_time IS NULL", group.ID).Order("start_time DESC").Take(&active).Error == nil {
+		state.Running = true
+		state.Since = active.StartTime.Unix()
+		state.Paused = active.PausedSeconds
+		if active.PausedAt != nil {
+			state.PausedAt = active.PausedAt.Unix()
+		}
+		state.RunningToday = !active.StartTime.Before(todayStart)
+		state.RunningWeek = !active.StartTime.Before(week)
+	}
+
+	var rounds []Round
+	db.WithContext(ctx).Select("start_time", "end_time", "paused_seconds").
+		Where("working_group_id = ? AND start_time >= ? AND end_time IS NOT NULL", group.ID, week).
+		Find(&rounds)
+	for _, round := range rounds {
+		seconds := roundWorkedSeconds(round, *round.EndTime)
+		state.Week += seconds
+		if !round.StartTime.Before(todayStart) {
+			state.Today += seconds
+		}
+	}
+
+	exceptions, err := loadCapacityExceptions(ctx, group.UserID, week, week.AddDate(0, 0, 7))
+	if err != nil {
+		log.Println("Error loading day exceptions:", err)
+	}
+	planned, err := plannedWeekSeconds(ctx, group.UserID, week)
+	if err != nil {
+		log.Println("Error loading planned hours:", err)
+	}
+	state.TodayTarget = int64(dayTargetMinutes(group.DailyTargetMinutes, exceptions[group.ID], now.Format("2006-01-02"))) * 60
+	state.WeekTarget = weeklyTarget(planned[group.ID], group.DailyTargetMinutes, exceptions[group.ID], week)
+
+	hash := fnv.New32a()
+	fmt.Fprintf(hash, "%t:%d:%d:%d:%d:%d:%d:%d:%s", state.Running, state.Since, state.Paused, state.PausedAt, state.Today,
+		state.Week, state.TodayTarget, state.WeekTarget, todayStart.Format("2006-01-02"))
+	state.Version = hash.Sum32()
+	return state
+}
+
+// wallboardGroup is the group of ?group_id=, or the default group
+func wallboardGroup(c *fiber.Ctx) (WorkingGroup, error) {
+	groupID, err := deckGroupID(c)
+	if err != nil {
+		return WorkingGroup{}, err
+	}
+	return findUserGroup(currentUserID(c), groupID)
+}
+
+// renderWallboard shows one group full screen for a monitor on the wall; the page keeps itself current through
+// GET /api/v1/wallboard
+func renderWallboard(c *fiber.Ctx) error {
+	group, err := wallboardGroup(c)
+	if err != nil {
+		return c.Status(404).SendString("Working group not found")
+	}
+	return c.Render("wallboard", fiber.Map{
+		"State": buildWallboardState(traceContext(c), group),
+	})
+}
+
+// apiWallboard returns the wallboard state; with ?v= it waits up to ?wait= seconds for a change, like the watch
+func apiWallboard(c *fiber.Ctx) error {
+	group, err := wallboardGroup(c)
+	if err != nil {
+		return sendAPIRoundError(c, err, "error loading status")
+	}
+	return longPollRounds(c, group.ID, func() (interface{}, uint32) {
+		state := buildWallboardState(traceContext(c), group)
+		return state, state.Version
+	})
+}
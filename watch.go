@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const maxWatchWait = 120 * time.Second
+
+// watchState is the smallest useful status for watch complications. The watch counts the
+// elapsed time locally from Since, less Paused, up to PausedAt while the round is paused, so it
+// only has to ask again when the state changes.
+type watchState struct {
+	Running  int    `json:"r"`            // 1 while a round is running
+	Since    int64  `json:"s"`            // Unix start of the running round, 0 when idle
+	Paused   int64  `json:"p,omitempty"`  // Seconds of the running round's finished pauses
+	PausedAt int64  `json:"pa,omitempty"` // Unix start of the running round's pause, 0 unless it is paused
+	Today    int64  `json:"t"`            // Seconds of finished rounds today
+	Version  uint32 `json:"v"`            // Changes whenever any of the above changes; pass it back as ?v= to long-poll
+	GroupID  uint   `json:"g"`
+}
+
+// roundWatchers wakes long-polling requests when the rounds of a group change
+var roundWatchers = struct {
+	sync.Mutex
+	groups map[uint]chan struct{}
+}{groups: make(map[uint]chan struct{})}
+
+// roundChanges returns a channel that is closed on the next change of the group's rounds
+func roundChanges(groupID uint) <-chan struct{} {
+	roundWatchers.Lock()
+	defer roundWatchers.Unlock()
+	ch, ok := roundWatchers.groups[groupID]
+	if !ok {
+		ch = make(chan struct{})
+		roundWatchers.groups[groupID] = ch
+	}
+	return ch
+}
+
+// notifyRoundChange wakes everyone waiting on the group's rounds, long-polling watches and open dashboards alike
+func notifyRoundChange(groupID uint) {
+	roundWatchers.Lock()
+	if ch, ok := roundWatchers.groups[groupID]; ok {
+		close(ch)
+		delete(roundWatchers.groups, groupID)
+	}
+	roundWatchers.Unlock()
+	notifyPresenceRounds(groupID)
+}
+
+func buildWatchState(groupID uint) watchState {
+	state := watchState{GroupID: groupID}
+
+	var active Round
+	if db.Select("start_time", "paused_at", "paused_seconds").Where("working_group_id = ? AND end_time IS NULL", groupID).
+		First(&active).Error == nil {
+		state.Running = 1
+		state.Since = active.StartTime.Unix()
+		state.Paused = active.PausedSeconds
+		if active.PausedAt != nil {
+			state.PausedAt = active.PausedAt.Unix()
+		}
+	}
+
+	now := time.Now()
+	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	var rounds []Round
+	db.Select("start_time", "end_time", "paused_seconds").
+		Where("working_group_id = ? AND start_time >= ? AND end_time IS NOT NULL", groupID, todayStart).
+		Find(&rounds)
+	for _, round := range rounds {
+		state.Today += roundWorkedSeconds(round, *round.EndTime)
+	}
+
+	hash := fnv.New32a()
+	fmt.Fprintf(hash, "%d:%d:%d:%d:%d:%s", state.Running, state.Since, state.Paused, state.PausedAt, state.Today,
+		todayStart.Format("2006-01-02"))
+	state.Version = hash.Sum32()
+	return state
+}
+
+// apiWatchStatus returns the watch state; with ?v= it waits up to ?wait= seconds for a change
+// and answers 304 Not Modified if nothing happened
+func apiWatchStatus(c *fiber.Ctx) error {
+	groupID, err := deckGroupID(c)
+	if err != nil {
+		return sendAPIRoundError(c, err, "error loading status")
+	}
+	return longPollRounds(c, groupID, func() (interface{}, uint32) {
+		state := buildWatchState(groupID)
+		return state, state.Version
+	})
+}
+
+// longPollRounds answers with the state from build. When the client passes the version it has as ?v=, it waits up to
+// ?wait= seconds for the group's rounds to change first, and answers 304 Not Modified if the version stayed the same.
+func longPollRounds(c *fiber.Ctx, groupID uint, build func() (interface{}, uint32)) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	known, _ := strconv.ParseUint(c.Query("v"), 10, 32)
+	wait := time.Duration(c.QueryInt("wait", 0)) * time.Second
+	if wait > maxWatchWait {
+		wait = maxWatchWait
+	}
+
+	// Subscribe before reading the state so that a change in between is not missed
+	changed := roundChanges(groupID)
+	state, version := build()
+	if c.Query("v") == "" || uint32(known) != version {
+		return c.JSON(state)
+	}
+	if wait <= 0 {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-changed:
+	case <-timer.C:
+	}
+
+	state, version = build()
+	if uint32(known) == version {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+	return c.JSON(state)
+}
+
+// apiWatchToggle starts or stops a round and returns the new watch state
+func apiWatchToggle(c *fiber.Ctx) error {
+	groupID, err := deckGroupID(c)
+	if err != nil {
+		return sendAPIRoundError(c, err, "error toggling round")
+	}
+
+	client := clientInfoFromRequest(c)
+	var active Round
+	if db.Where("working_group_id = ? AND end_time IS NULL", groupID).First(&active).Error == nil {
+		_, err = stopRound(groupID, client)
+	} else {
+		_, err = startRound(groupID, client)
+	}
+	if err != nil {
+		return sendAPIRoundError(c, err, "error toggling round")
+	}
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(buildWatchState(groupID))
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xlsxPartLimit caps how much of one part of a workbook is read, so a small upload can't unpack into gigabytes
+const xlsxPartLimit = 64 << 20
+
+var errXLSXPartMissing = errors.New("part missing from the workbook")
+
+// Kinds of number formats, by how readXLSX writes a number in them
+const (
+	xlsxNumber   = ""
+	xlsxDate     = "date"     // Days since the workbook's epoch, maybe with a time of day
+	xlsxDuration = "duration" // Elapsed time in days, like [h]:mm
+)
+
+// xlsxBuiltinDates are the built-in number formats that show dates or times; 46 is [h]:mm:ss
+var xlsxBuiltinDates = map[int]string{
+	14: xlsxDate, 15: xlsxDate, 16: xlsxDate, 17: xlsxDate, 18: xlsxDate, 19: xlsxDate, 20: xlsxDate, 21: xlsxDate,
+	22: xlsxDate, 27: xlsxDate, 30: xlsxDate, 36: xlsxDate, 45: xlsxDate, 46: xlsxDuration, 47: xlsxDate,
+	50: xlsxDate, 57: xlsxDate,
+}
+
+type xlsxWorkbook struct {
+	Properties struct {
+		Date1904 bool `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxText is a shared or inline string: plain, or in runs of differently formatted text
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	for _, run := range t.Runs {
+		b.WriteString(run.T)
+	}
+	return b.String()
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxStyles struct {
+	NumFmts []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	CellXfs []struct {
+		NumFmtID int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Number int `xml:"r,attr"`
+		Cells  []struct {
+			Ref    string   `xml:"r,attr"`
+			Type   string   `xml:"t,attr"`
+			Style  int      `xml:"s,attr"`
+			Value  string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSX returns the cells of the first worksheet of an Excel workbook with the line each row is on. Cells
+// formatted as dates or times read "2006-01-02 15:04:05", "2006-01-02" or "15:04:05", elapsed times "1:30:00", like
+// in a CSV export of the sheet; other numbers as they are stored.
+func readXLSX(data []byte) ([]importRecord, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not an Excel workbook: %w", err)
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+	readPart := func(name string, v interface{}) error {
+		file, ok := files[name]
+		if !ok {
+			return fmt.Errorf("%w: %s", errXLSXPartMissing, name)
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		return xml.NewDecoder(io.LimitReader(reader, xlsxPartLimit)).Decode(v)
+	}
+
+	var workbook xlsxWorkbook
+	if err := readPart("xl/workbook.xml", &workbook); err != nil {
+		return nil, fmt.Errorf("reading workbook: %w", err)
+	}
+	if len(workbook.Sheets) == 0 {
+		return nil, errors.New("the workbook has no sheets")
+	}
+	var relationships xlsxRelationships
+	if err := readPart("xl/_rels/workbook.xml.rels", &relationships); err != nil {
+		return nil, fmt.Errorf("reading workbook: %w", err)
+	}
+	sheetPart := ""
+	for _, relationship := range relationships.Relationships {
+		if relationship.ID == workbook.Sheets[0].RID {
+			// Targets are relative to xl/, or absolute within the package
+			if strings.HasPrefix(relationship.Target, "/") {
+				sheetPart = strings.TrimPrefix(relationship.Target, "/")
+			} else {
+				sheetPart = path.Join("xl", relationship.Target)
+			}
+		}
+	}
+	if sheetPart == "" {
+		return nil, fmt.Errorf("sheet %q not found in the workbook", workbook.Sheets[0].Name)
+	}
+
+	// Workbooks with only numbers have no shared strings, and styles are optional too
+	var shared xlsxSharedStrings
+	if err := readPart("xl/sharedStrings.xml", &shared); err != nil && !errors.Is(err, errXLSXPartMissing) {
+		return nil, fmt.Errorf("reading shared strings: %w", err)
+	}
+	var styles xlsxStyles
+	if err := readPart("xl/styles.xml", &styles); err != nil && !errors.Is(err, errXLSXPartMissing) {
+		return nil, fmt.Errorf("reading styles: %w", err)
+	}
+	customFormats := make(map[int]string, len(styles.NumFmts))
+	for _, format := range styles.NumFmts {
+		customFormats[format.ID] = xlsxFormatKind(format.Code)
+	}
+	styleKind := func(style int) string {
+		if style < 0 || style >= len(styles.CellXfs) {
+			return xlsxNumber
+		}
+		id := styles.CellXfs[style].NumFmtID
+		if kind, ok := customFormats[id]; ok {
+			return kind
+		}
+		return xlsxBuiltinDates[id]
+	}
+
+	var sheet xlsxSheet
+	if err := readPart(sheetPart, &sheet); err != nil {
+		return nil, fmt.Errorf("reading sheet %q: %w", workbook.Sheets[0].Name, err)
+	}
+	records := make([]importRecord, 0, len(sheet.Rows))
+	for i, row := range sheet.Rows {
+		record := importRecord{Line: row.Number}
+		if record.Line == 0 {
+			record.Line = i + 1
+		}
+		for j, cell := range row.Cells {
+			column := j
+			if cell.Ref != "" {
+				column = xlsxColumn(cell.Ref)
+			}
+			if column < 0 || column >= maxImportColumns {
+				continue
+			}
+			var value string
+			switch cell.Type {
+			case "s":
+				index, err := strconv.Atoi(cell.Value)
+				if err != nil || index < 0 || index >= len(shared.Items) {
+					return nil, fmt.Errorf("cell %s refers to a missing string", cell.Ref)
+				}
+				value = shared.Items[index].String()
+			case "inlineStr":
+				value = cell.Inline.String()
+			case "b":
+				value = map[string]string{"0": "FALSE", "1": "TRUE"}[cell.Value]
+			case "", "n":
+				value = xlsxNumberText(cell.Value, styleKind(cell.Style), workbook.Properties.Date1904)
+			default: // str (a formula's text) and e (an error such as #N/A)
+				value = cell.Value
+			}
+			for len(record.Cells) <= column {
+				record.Cells = append(record.Cells, "")
+			}
+			record.Cells[column] = value
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// xlsxColumn is the zero-based column of a cell reference such as "AB12", -1 when there is none
+func xlsxColumn(ref string) int {
+	column := 0
+	for i := 0; i < len(ref); i++ {
+		ch := ref[i]
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		column = column*26 + int(ch-'A'+1)
+	}
+	return column - 1
+}
+
+// xlsxFormatKind tells date, time and elapsed time formats apart from number formats by their placeholders, after
+// leaving out literal text, escaped characters and sections such as [Red] or [$€-407]
+func xlsxFormatKind(code string) string {
+	var placeholders strings.Builder
+	quoted := false
+	for i := 0; i < len(code); i++ {
+		ch := code[i]
+		switch {
+		case ch == '"':
+			quoted = !quoted
+		case quoted:
+		case ch == '\\' || ch == '_' || ch == '*':
+			i++ // The next character is shown as it is, or only makes room
+		case ch == '[':
+			end := strings.IndexByte(code[i:], ']')
+			if end < 0 {
+				i = len(code)
+				continue
+			}
+			section := strings.ToLower(code[i+1 : i+end])
+			if section != "" && strings.Trim(section, "hms") == "" {
+				return xlsxDuration
+			}
+			i += end
+		default:
+			placeholders.WriteByte(ch | 0x20) // Lowercase, as Excel takes YYYY and yyyy alike
+		}
+	}
+	if strings.ContainsAny(placeholders.String(), "ymdhs") {
+		return xlsxDate
+	}
+	return xlsxNumber
+}
+
+// xlsxNumberText writes a stored number the way the cell's format kind calls for
+func xlsxNumberText(value, kind string, date1904 bool) string {
+	if kind == xlsxNumber || value == "" {
+		return value
+	}
+	days, err := strconv.ParseFloat(value, 64)
+	if err != nil || days < 0 || days > 2958465 { // Beyond 9999-12-31 Excel shows ### too
+		return value
+	}
+	seconds := int64(math.Round(days * 86400))
+	if kind == xlsxDuration {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	if days < 1 {
+		return time.Unix(seconds, 0).UTC().Format("15:04:05")
+	}
+	// Dates count from the last day of 1899, which makes up for Excel counting 29 February 1900
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	t := epoch.Add(time.Duration(seconds) * time.Second)
+	if seconds%86400 == 0 {
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01-02 15:04:05")
+}